@@ -1,22 +1,25 @@
 // Copyright 2018 Northern.tech AS
 //
-//    Licensed under the Apache License, Version 2.0 (the "License");
-//    you may not use this file except in compliance with the License.
-//    You may obtain a copy of the License at
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
 //
-//        http://www.apache.org/licenses/LICENSE-2.0
+//	    http://www.apache.org/licenses/LICENSE-2.0
 //
-//    Unless required by applicable law or agreed to in writing, software
-//    distributed under the License is distributed on an "AS IS" BASIS,
-//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-//    See the License for the specific language governing permissions and
-//    limitations under the License.
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
 package http
 
 import (
 	"encoding/json"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mendersoftware/go-lib-micro/identity"
 
@@ -34,23 +37,38 @@ import (
 )
 
 const (
-	uriAuthReqs = "/api/devices/v1/authentication/auth_requests"
+	uriAuthReqs         = "/api/devices/v1/authentication/auth_requests"
+	uriAuthReqChallenge = "/api/devices/v1/authentication/auth_requests/challenge"
+	uriKeyRotation      = "/api/devices/v1/authentication/key_rotation"
+	uriDeviceAuthz      = "/api/devices/v1/authentication/device_authorization"
+	uriDeviceToken      = "/api/devices/v1/authentication/token"
+	uriTokenRenew       = "/api/devices/v1/authentication/tokens/renew"
 
 	uriDevices       = "/api/management/v1/devauth/devices"
 	uriDevicesCount  = "/api/management/v1/devauth/devices/count"
+	uriDevicesEvents = "/api/management/v1/devauth/devices/events"
 	uriDevice        = "/api/management/v1/devauth/devices/:id"
 	uriToken         = "/api/management/v1/devauth/tokens/:id"
+	uriDeviceTokens  = "/api/management/v1/devauth/devices/:id/tokens"
 	uriDeviceAuthSet = "/api/management/v1/devauth/devices/:id/auth/:aid"
 	uriDeviceStatus  = "/api/management/v1/devauth/devices/:id/auth/:aid/status"
 	uriLimit         = "/api/management/v1/devauth/limits/:name"
+	uriStatistics    = "/api/management/v1/devauth/statistics"
 
 	// internal API
 	uriTokenVerify        = "/api/internal/v1/devauth/tokens/verify"
+	uriTokenIntrospect    = "/api/internal/v1/devauth/tokens/introspect"
 	uriTenantLimit        = "/api/internal/v1/devauth/tenant/:id/limits/:name"
 	uriTokens             = "/api/internal/v1/devauth/tokens"
+	uriRevokedTokens      = "/api/internal/v1/devauth/tokens/revoked"
+	uriRevocationGateways = "/api/internal/v1/devauth/tokens/revoked/gateways"
 	uriTenants            = "/api/internal/v1/devauth/tenants"
 	uriTenantDeviceStatus = "/api/internal/v1/devauth/tenants/:tid/devices/:did/status"
 	uriTenantDevices      = "/api/internal/v1/devauth/tenants/:tid/devices"
+	uriTenantSuspend      = "/api/internal/v1/devauth/tenants/:tid/suspend"
+	uriTenantDevicesCount = "/api/internal/v1/devauth/tenants/:tid/devices/count"
+	uriJWKS               = "/api/internal/v1/devauth/.well-known/jwks.json"
+	uriKeyPolicy          = "/api/internal/v1/devauth/config/key_policy"
 
 	// migrated devadm api
 	uriDevadmAuthSetStatus = "/api/management/v1/admission/devices/:aid/status"
@@ -58,57 +76,149 @@ const (
 	uriDevadmDevice        = "/api/management/v1/admission/devices/:aid"
 
 	// management API v2
-	v2uriDevices             = "/api/management/v2/devauth/devices"
-	v2uriDevicesCount        = "/api/management/v2/devauth/devices/count"
-	v2uriDevice              = "/api/management/v2/devauth/devices/:id"
-	v2uriDeviceAuthSet       = "/api/management/v2/devauth/devices/:id/auth/:aid"
-	v2uriDeviceAuthSetStatus = "/api/management/v2/devauth/devices/:id/auth/:aid/status"
-	v2uriToken               = "/api/management/v2/devauth/tokens/:id"
-	v2uriDevicesLimit        = "/api/management/v2/devauth/limits/:name"
-
-	HdrAuthReqSign = "X-MEN-Signature"
+	v2uriDevices              = "/api/management/v2/devauth/devices"
+	v2uriDevicesCount         = "/api/management/v2/devauth/devices/count"
+	v2uriDevicesExport        = "/api/management/v2/devauth/devices/export"
+	v2uriDevicesImport        = "/api/management/v2/devauth/devices/import"
+	v2uriDevicesStatus        = "/api/management/v2/devauth/devices/status"
+	v2uriDevicesPurge         = "/api/management/v2/devauth/devices/purge_rejected"
+	v2uriDevice               = "/api/management/v2/devauth/devices/:id"
+	v2uriDeviceAuthSet        = "/api/management/v2/devauth/devices/:id/auth/:aid"
+	v2uriDeviceAuthSetStatus  = "/api/management/v2/devauth/devices/:id/auth/:aid/status"
+	v2uriDeviceAuthSetResolve = "/api/management/v2/devauth/devices/:id/auth/:aid/resolve_conflict"
+	v2uriDeviceQuarantine     = "/api/management/v2/devauth/devices/:id/quarantine"
+	v2uriDeviceKeys           = "/api/management/v2/devauth/devices/:id/keys"
+	v2uriDeviceKey            = "/api/management/v2/devauth/devices/:id/keys/:aid"
+	v2uriDeviceTokens         = "/api/management/v2/devauth/devices/:id/tokens"
+	v2uriDeviceStatusHistory  = "/api/management/v2/devauth/devices/:id/status/history"
+	v2uriToken                = "/api/management/v2/devauth/tokens/:id"
+	v2uriDevicesLimit         = "/api/management/v2/devauth/limits/:name"
+	v2uriDeviceAuthz          = "/api/management/v2/devauth/device_authorizations/:code"
+	v2uriDeviceAuthzStatus    = "/api/management/v2/devauth/device_authorizations/:code/status"
+	v2uriTransfers            = "/api/management/v2/devauth/transfers"
+	v2uriTransfer             = "/api/management/v2/devauth/transfers/:id"
+	v2uriTransferAccept       = "/api/management/v2/devauth/transfers/:id/accept"
+	v2uriTransferDecline      = "/api/management/v2/devauth/transfers/:id/decline"
+	v2uriDeviceDecommission   = "/api/management/v2/devauth/devices/:id/decommission_at"
+	v2uriDeviceGroup          = "/api/management/v2/devauth/devices/:id/group"
+	v2uriDecommissions        = "/api/management/v2/devauth/decommissions"
+	v2uriOffboardingTokens    = "/api/management/v2/devauth/offboarding_tokens"
+	v2uriBootstrapTokens      = "/api/management/v2/devauth/bootstrap_tokens"
+	v2uriTokenAudit           = "/api/management/v2/devauth/audit/tokens"
+
+	HdrAuthReqSign      = "X-MEN-Signature"
+	HdrAuthReqSignAlg   = "X-MEN-Signature-Alg"
+	HdrAuthReqTimestamp = "X-MEN-Request-Timestamp"
+	HdrRefreshToken     = "X-MEN-Refresh-Token"
+
+	// traffic classes, see TrafficClass
+	TrafficClassVerify = "verify"
+	TrafficClassEnroll = "enroll"
+
+	// device access token error responses (RFC 8628, sec. 3.5 and
+	// RFC 6749, sec. 5.2)
+	oauthErrInvalidRequest       = "invalid_request"
+	oauthErrUnauthorizedClient   = "unauthorized_client"
+	oauthErrUnsupportedGrantType = "unsupported_grant_type"
+	oauthErrInvalidGrant         = "invalid_grant"
+	oauthErrAuthorizationPending = "authorization_pending"
+	oauthErrSlowDown             = "slow_down"
+	oauthErrAccessDenied         = "access_denied"
+	oauthErrExpiredToken         = "expired_token"
+
+	oauthTokenTypeBearer       = "Bearer"
+	oauthFormParamGrantType    = "grant_type"
+	oauthFormParamDeviceCode   = "device_code"
+	oauthFormParamToken        = "token"
+	oauthFormParamRefreshToken = "refresh_token"
+
+	// grant type of refresh token requests (RFC 6749, sec. 6)
+	oauthGrantTypeRefreshToken = "refresh_token"
+
+	// status of the auth set status endpoint dropping a pending auth set
+	statusDismissed = "dismissed"
+
+	// period of the statistics, in hours; auth request counts are kept
+	// for a bit longer than the maximum
+	defaultStatisticsHours = 24
+	maxStatisticsHours     = 7 * 24
+
+	// max age of the rejected devices to purge, in days
+	maxPurgeRejectedDays = 10 * 365
 )
 
 var (
 	ErrIncorrectStatus = errors.New("incorrect device status")
 	ErrNoAuthHeader    = errors.New("no authorization header")
 
-	DevStatuses = []string{model.DevStatusPending, model.DevStatusRejected, model.DevStatusAccepted, model.DevStatusPreauth}
+	DevStatuses = []string{model.DevStatusPending, model.DevStatusRejected, model.DevStatusAccepted, model.DevStatusPreauth, model.DevStatusQuarantined}
+
+	importFormats = []string{model.PreAuthImportFormatCSV, model.PreAuthImportFormatNDJSON}
 )
 
 type DevAuthApiHandlers struct {
-	devAuth devauth.App
-	db      store.DataStore
+	devAuth     devauth.App
+	db          store.DataStore
+	middlewares []rest.Middleware
 }
 
 type DevAuthApiStatus struct {
 	Status string `json:"status"`
 }
 
-func NewDevAuthApiHandlers(devAuth devauth.App, db store.DataStore) ApiHandler {
+type DevAuthApiDecommissionAt struct {
+	DecommissionAt time.Time `json:"decommission_at"`
+}
+
+type DevAuthApiGroup struct {
+	Group string `json:"group"`
+}
+
+type DevAuthApiConflictResolution struct {
+	Others string `json:"others"`
+}
+
+// NewDevAuthApiHandlers creates the API handlers. Optional middlewares
+// (e.g. custom authentication, metrics or header rewriting) are run, in the
+// given order, for every request before it is routed; they come after any
+// middlewares set up on the rest.Api the app is used with.
+func NewDevAuthApiHandlers(devAuth devauth.App, db store.DataStore,
+	middlewares ...rest.Middleware) ApiHandler {
 	return &DevAuthApiHandlers{
-		devAuth: devAuth,
-		db:      db,
+		devAuth:     devAuth,
+		db:          db,
+		middlewares: middlewares,
 	}
 }
 
 func (d *DevAuthApiHandlers) GetApp() (rest.App, error) {
 	routes := []*rest.Route{
 		rest.Post(uriAuthReqs, d.SubmitAuthRequestHandler),
+		rest.Post(uriAuthReqChallenge, d.AuthChallengeHandler),
+		rest.Post(uriKeyRotation, d.RotateDeviceKeyHandler),
+		rest.Post(uriDeviceAuthz, d.SubmitDeviceAuthorizationHandler),
+		rest.Post(uriDeviceToken, d.DeviceTokenHandler),
+		rest.Post(uriTokenRenew, d.RenewTokenHandler),
 		rest.Get(uriDevices, d.GetDevicesHandler),
-		rest.Post(uriDevices, d.PreauthDeviceHandler),
+		rest.Post(uriDevices, d.idempotent(d.PreauthDeviceHandler)),
 		rest.Get(uriDevicesCount, d.GetDevicesCountV1Handler),
+		rest.Get(uriDevicesEvents, d.GetDeviceEventsHandler),
 		rest.Get(uriDevice, d.GetDeviceHandler),
 		rest.Delete(uriDevice, d.DeleteDeviceV1Handler),
 		rest.Delete(uriDeviceAuthSet, d.DeleteDeviceAuthSetV1Handler),
 		rest.Delete(uriToken, d.DeleteTokenV1Handler),
+		rest.Delete(uriDeviceTokens, d.DeleteDeviceTokensHandler),
 		rest.Post(uriTokenVerify, d.VerifyTokenHandler),
+		rest.Post(uriTokenIntrospect, d.IntrospectTokenHandler),
 		rest.Delete(uriTokens, d.DeleteTokensHandler),
-		rest.Put(uriDeviceStatus, d.UpdateDeviceStatusV1Handler),
+		rest.Get(uriRevokedTokens, d.GetRevokedTokensHandler),
+		rest.Get(uriRevocationGateways, d.GetRevocationGatewaysHandler),
+		rest.Put(uriDeviceStatus, d.idempotent(d.UpdateDeviceStatusV1Handler)),
 
 		rest.Put(uriTenantLimit, d.PutTenantLimitHandler),
 		rest.Get(uriTenantLimit, d.GetTenantLimitHandler),
 		rest.Get(uriLimit, d.GetLimitV1Handler),
+		rest.Get(uriStatistics, d.GetStatisticsHandler),
 
 		rest.Post(uriTenants, d.ProvisionTenantHandler),
 		rest.Get(uriTenantDeviceStatus, d.GetTenantDeviceStatus),
@@ -119,18 +229,51 @@ func (d *DevAuthApiHandlers) GetApp() (rest.App, error) {
 		rest.Get(uriDevadmDevice, d.DevAdmGetDeviceHandler),
 		rest.Delete(uriDevadmDevice, d.DevAdmDeleteDeviceAuthSetHandler),
 		rest.Get(uriTenantDevices, d.GetTenantDevicesHandler),
+		rest.Get(uriTenantDevicesCount, d.GetTenantDevicesCountHandler),
+		rest.Post(uriTenantSuspend, d.SuspendTenantHandler),
+		rest.Delete(uriTenantSuspend, d.ResumeTenantHandler),
+		rest.Get(uriJWKS, d.GetJWKSHandler),
+		rest.Get(uriKeyPolicy, d.GetKeyPolicyHandler),
 
 		// API v2
 		rest.Get(v2uriDevicesCount, d.GetDevicesCountHandler),
+		rest.Get(v2uriDevicesExport, d.GetDevicesExportHandler),
 		rest.Get(v2uriDevices, d.GetDevicesV2Handler),
-		rest.Post(v2uriDevices, d.PostDevicesV2Handler),
+		rest.Post(v2uriDevices, d.idempotent(d.PostDevicesV2Handler)),
+		rest.Post(v2uriDevicesImport, d.PostDevicesImportHandler),
+		rest.Put(v2uriDevicesStatus, d.idempotent(d.UpdateDevicesStatusHandler)),
+		rest.Post(v2uriDevicesPurge, d.PurgeRejectedDevicesHandler),
 		rest.Get(v2uriDevice, d.GetDeviceV2Handler),
 		rest.Delete(v2uriDevice, d.DeleteDeviceHandler),
+		rest.Patch(v2uriDevice, d.PatchDeviceHandler),
+		rest.Get(v2uriDeviceAuthSet, d.GetDeviceAuthSetHandler),
 		rest.Delete(v2uriDeviceAuthSet, d.DeleteDeviceAuthSetHandler),
-		rest.Put(v2uriDeviceAuthSetStatus, d.UpdateDeviceStatusHandler),
+		rest.Put(v2uriDeviceAuthSetStatus, d.idempotent(d.UpdateDeviceStatusHandler)),
 		rest.Get(v2uriDeviceAuthSetStatus, d.GetAuthSetStatusHandler),
+		rest.Post(v2uriDeviceAuthSetResolve, d.ResolveAuthSetConflictHandler),
+		rest.Put(v2uriDeviceQuarantine, d.QuarantineDeviceHandler),
+		rest.Delete(v2uriDeviceQuarantine, d.ReleaseDeviceQuarantineHandler),
+		rest.Get(v2uriDeviceKeys, d.GetDeviceKeysHandler),
+		rest.Delete(v2uriDeviceKey, d.RevokeDeviceKeyHandler),
+		rest.Get(v2uriDeviceTokens, d.GetDeviceTokensHandler),
+		rest.Get(v2uriDeviceStatusHistory, d.GetDeviceStatusHistoryHandler),
 		rest.Delete(v2uriToken, d.DeleteTokenHandler),
 		rest.Get(v2uriDevicesLimit, d.GetLimitHandler),
+		rest.Get(v2uriDeviceAuthz, d.GetDeviceAuthorizationHandler),
+		rest.Put(v2uriDeviceAuthzStatus, d.UpdateDeviceAuthorizationStatusHandler),
+		rest.Post(v2uriTransfers, d.PostTransferHandler),
+		rest.Get(v2uriTransfer, d.GetTransferHandler),
+		rest.Delete(v2uriTransfer, d.DeleteTransferHandler),
+		rest.Post(v2uriTransferAccept, d.AcceptTransferHandler),
+		rest.Post(v2uriTransferDecline, d.DeclineTransferHandler),
+		rest.Put(v2uriDeviceDecommission, d.PutDecommissionAtHandler),
+		rest.Delete(v2uriDeviceDecommission, d.DeleteDecommissionAtHandler),
+		rest.Put(v2uriDeviceGroup, d.PutDeviceGroupHandler),
+		rest.Delete(v2uriDeviceGroup, d.DeleteDeviceGroupHandler),
+		rest.Get(v2uriDecommissions, d.GetDecommissionsHandler),
+		rest.Get(v2uriOffboardingTokens, d.GetOffboardingTokensHandler),
+		rest.Post(v2uriBootstrapTokens, d.PostBootstrapTokenHandler),
+		rest.Get(v2uriTokenAudit, d.GetTokenAuditHandler),
 	}
 
 	app, err := rest.MakeRouter(
@@ -141,135 +284,1070 @@ func (d *DevAuthApiHandlers) GetApp() (rest.App, error) {
 		return nil, errors.Wrap(err, "failed to create router")
 	}
 
+	if len(d.middlewares) > 0 {
+		app = rest.AppSimple(rest.WrapMiddlewares(d.middlewares, app.AppFunc()))
+	}
+
 	return app, nil
 }
 
+// TrafficClass tells token verification requests from device enrollment
+// (auth and device authorization) requests, for prioritizing the former
+// under load. Other requests have no class.
+func TrafficClass(r *rest.Request) string {
+	if r.Method != http.MethodPost {
+		return ""
+	}
+
+	switch r.URL.Path {
+	case uriTokenVerify, uriTokenIntrospect:
+		return TrafficClassVerify
+	case uriAuthReqs, uriAuthReqChallenge, uriKeyRotation, uriDeviceAuthz, uriDeviceToken,
+		uriTokenRenew:
+		return TrafficClassEnroll
+	default:
+		return ""
+	}
+}
+
+// FormRequest tells requests to the OAuth 2.0 endpoints, which take form
+// encoded instead of JSON bodies
+func FormRequest(r *rest.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+
+	switch r.URL.Path {
+	case uriDeviceToken, uriTokenIntrospect:
+		return true
+	default:
+		return false
+	}
+}
+
+// ImportRequest tells device imports, which take CSV or NDJSON bodies
+func ImportRequest(r *rest.Request) bool {
+	return r.Method == http.MethodPost && r.URL.Path == v2uriDevicesImport
+}
+
+// EventStreamRequest tells requests for server-sent event streams, which
+// are long-lived and written to bit by bit
+func EventStreamRequest(r *rest.Request) bool {
+	return r.Method == http.MethodGet && r.URL.Path == uriDevicesEvents
+}
+
+// MergePatchRequest tells PATCH requests with JSON merge patch bodies,
+// which are JSON as well
+func MergePatchRequest(r *rest.Request) bool {
+	if r.Method != http.MethodPatch {
+		return false
+	}
+	mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediatype == "application/merge-patch+json"
+}
+
 func (d *DevAuthApiHandlers) SubmitAuthRequestHandler(w rest.ResponseWriter, r *rest.Request) {
-	var authreq model.AuthReq
+	ctx := r.Context()
+
+	authreq := decodeAuthRequest(w, r)
+	if authreq == nil {
+		return
+	}
+
+	token, err := d.devAuth.SubmitAuthRequest(ctx, authreq)
+	if err != nil {
+		authRequestError(w, r, err)
+		return
+	}
+
+	refreshToken, err := d.devAuth.IssueRefreshToken(ctx, token)
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, log.FromContext(ctx), err)
+		return
+	}
+	if refreshToken != "" {
+		w.Header().Set(HdrRefreshToken, refreshToken)
+	}
+
+	w.(http.ResponseWriter).Write([]byte(token))
+	w.Header().Set("Content-Type", "application/jwt")
+}
 
+// AuthChallengeHandler hands out a nonce for the device's next auth request
+func (d *DevAuthApiHandlers) AuthChallengeHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
+	// the body is optional, only devices attesting their key with a TPM
+	// need to send one
+	if !checkRequestBody(w, r, schemaAuthChallengeReq) {
+		return
+	}
+
+	var req model.AuthChallengeReq
+	err := r.DecodeJsonPayload(&req)
+	if err != nil && err != rest.ErrJsonPayloadEmpty {
+		err = errors.Wrap(err, "failed to decode auth challenge request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := d.devAuth.NewAuthChallenge(ctx, &req)
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteJson(challenge)
+}
+
+// decodeAuthRequest reads and validates a signed auth request, on failure
+// writes an error response and returns nil
+func decodeAuthRequest(w rest.ResponseWriter, r *rest.Request) *model.AuthReq {
+	var authreq model.AuthReq
+
+	l := log.FromContext(r.Context())
+
 	//validate req body by reading raw content manually
 	//(raw body will be needed later, DecodeJsonPayload would
 	//unmarshal and close it)
 	body, err := utils.ReadBodyRaw(r)
 	if err != nil {
-		err = errors.Wrap(err, "failed to decode auth request")
+		err = errors.Wrap(err, "failed to decode auth request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return nil
+	}
+
+	err = json.Unmarshal(body, &authreq)
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode auth request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return nil
+	}
+
+	err = schemaAuthReq.Validate(body)
+	if err == nil {
+		err = authreq.Validate()
+	}
+	if err != nil {
+		err = errors.Wrap(err, "invalid auth request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return nil
+	}
+
+	//verify signature
+	signature := r.Header.Get(HdrAuthReqSign)
+	if signature == "" {
+		rest_utils.RestErrWithLog(w, r, l, errors.New("missing request signature header"), http.StatusBadRequest)
+		return nil
+	}
+	alg := r.Header.Get(HdrAuthReqSignAlg)
+	if alg != "" && !utils.IsSignatureAlg(alg) {
+		rest_utils.RestErrWithLog(w, r, l, errors.Errorf("unsupported signature algorithm: %s", alg), http.StatusBadRequest)
+		return nil
+	}
+
+	// the timestamp, if any, is signed along with the body
+	signed := body
+	if ts := r.Header.Get(HdrAuthReqTimestamp); ts != "" {
+		sec, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			rest_utils.RestErrWithLog(w, r, l, errors.New("invalid request timestamp header"), http.StatusBadRequest)
+			return nil
+		}
+		timestamp := time.Unix(sec, 0)
+		authreq.Timestamp = &timestamp
+		signed = append([]byte(ts+"\n"), body...)
+	}
+
+	err = utils.VerifyAuthReqSignAlg(alg, signature, authreq.PubKeyStruct, signed)
+	if err != nil {
+		rest_utils.RestErrWithLogMsg(w, r, l, err, http.StatusUnauthorized, "signature verification failed")
+		return nil
+	}
+
+	// verified by the listener
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		authreq.ClientCert = r.TLS.PeerCertificates[0]
+	}
+
+	return &authreq
+}
+
+// RotateDeviceKeyHandler replaces the key of the device's accepted auth set;
+// the request is signed with the current key
+func (d *DevAuthApiHandlers) RotateDeviceKeyHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var req model.KeyRotationReq
+
+	body, err := utils.ReadBodyRaw(r)
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode key rotation request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err = schemaKeyRotationReq.Validate(body)
+	if err == nil {
+		err = req.Validate()
+	}
+	if err != nil {
+		err = errors.Wrap(err, "invalid key rotation request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		req.ClientCert = r.TLS.PeerCertificates[0]
+	}
+
+	signature := r.Header.Get(HdrAuthReqSign)
+	if signature == "" {
+		rest_utils.RestErrWithLog(w, r, l, errors.New("missing request signature header"), http.StatusBadRequest)
+		return
+	}
+	alg := r.Header.Get(HdrAuthReqSignAlg)
+	if alg != "" && !utils.IsSignatureAlg(alg) {
+		rest_utils.RestErrWithLog(w, r, l, errors.Errorf("unsupported signature algorithm: %s", alg), http.StatusBadRequest)
+		return
+	}
+
+	err = utils.VerifyAuthReqSignAlg(alg, signature, req.PubKeyStruct, body)
+	if err != nil {
+		rest_utils.RestErrWithLogMsg(w, r, l, err, http.StatusUnauthorized, "signature verification failed")
+		return
+	}
+
+	if err := d.devAuth.RotateDeviceKey(ctx, &req); err != nil {
+		authRequestError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RenewTokenHandler exchanges the device's valid token, given in the
+// Authorization header, for a new one
+func (d *DevAuthApiHandlers) RenewTokenHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tokenStr, err := extractToken(r.Header)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, ErrNoAuthHeader, http.StatusUnauthorized)
+		return
+	}
+
+	token, err := d.devAuth.RenewToken(ctx, tokenStr)
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	refreshToken, err := d.devAuth.IssueRefreshToken(ctx, token)
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+	if refreshToken != "" {
+		w.Header().Set(HdrRefreshToken, refreshToken)
+	}
+
+	w.Header().Set("Content-Type", "application/jwt")
+	w.(http.ResponseWriter).Write([]byte(token))
+}
+
+// authRequestError writes an error response for errors of auth request
+// processing
+func authRequestError(w rest.ResponseWriter, r *rest.Request, err error) {
+	l := log.FromContext(r.Context())
+
+	switch err {
+	case devauth.ErrDevIdAuthIdMismatch, devauth.ErrMaxDeviceCountReached:
+		// error is always set to unauthorized, client does not need to
+		// know why
+		rest_utils.RestErrWithWarningMsg(w, r, l, devauth.ErrDevAuthUnauthorized,
+			http.StatusUnauthorized, "unauthorized")
+	default:
+		restErr(w, r, l, err)
+	}
+}
+
+func (d *DevAuthApiHandlers) SubmitDeviceAuthorizationHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	authreq := decodeAuthRequest(w, r)
+	if authreq == nil {
+		return
+	}
+
+	res, err := d.devAuth.SubmitDeviceAuthorization(ctx, authreq)
+	if err != nil {
+		if err == devauth.ErrDeviceAuthzDisabled {
+			rest_utils.RestErrWithWarningMsg(w, r, l, err,
+				http.StatusBadRequest, oauthErrUnauthorizedClient)
+			return
+		}
+		authRequestError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteJson(res)
+}
+
+type deviceToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// DeviceTokenHandler implements the device access token request of the
+// device authorization grant (RFC 8628, sec. 3.4), and the refresh token
+// request (RFC 6749, sec. 6)
+func (d *DevAuthApiHandlers) DeviceTokenHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := r.ParseForm(); err != nil {
+		rest_utils.RestErrWithLogMsg(w, r, l, err,
+			http.StatusBadRequest, oauthErrInvalidRequest)
+		return
+	}
+
+	switch r.PostFormValue(oauthFormParamGrantType) {
+	case model.GrantTypeDeviceCode:
+		d.deviceCodeGrant(w, r)
+	case oauthGrantTypeRefreshToken:
+		d.refreshTokenGrant(w, r)
+	default:
+		rest_utils.RestErrWithLogMsg(w, r, l,
+			errors.New("unsupported grant type"),
+			http.StatusBadRequest, oauthErrUnsupportedGrantType)
+	}
+}
+
+func (d *DevAuthApiHandlers) deviceCodeGrant(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	deviceCode := r.PostFormValue(oauthFormParamDeviceCode)
+	if deviceCode == "" {
+		rest_utils.RestErrWithLogMsg(w, r, l,
+			errors.New("missing device code"),
+			http.StatusBadRequest, oauthErrInvalidRequest)
+		return
+	}
+
+	token, err := d.devAuth.PollDeviceAuthorization(ctx, deviceCode)
+	switch err {
+	case nil:
+		refreshToken, err := d.devAuth.IssueRefreshToken(ctx, token)
+		if err != nil {
+			rest_utils.RestErrWithLogInternal(w, r, l, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteJson(deviceToken{
+			AccessToken:  token,
+			TokenType:    oauthTokenTypeBearer,
+			RefreshToken: refreshToken,
+		})
+	case devauth.ErrAuthorizationPending:
+		rest_utils.RestErrWithDebugMsg(w, r, l, err,
+			http.StatusBadRequest, oauthErrAuthorizationPending)
+	case devauth.ErrSlowDown:
+		rest_utils.RestErrWithInfoMsg(w, r, l, err,
+			http.StatusBadRequest, oauthErrSlowDown)
+	case devauth.ErrAccessDenied:
+		rest_utils.RestErrWithWarningMsg(w, r, l, err,
+			http.StatusBadRequest, oauthErrAccessDenied)
+	case devauth.ErrExpiredToken:
+		rest_utils.RestErrWithWarningMsg(w, r, l, err,
+			http.StatusBadRequest, oauthErrExpiredToken)
+	case devauth.ErrInvalidGrant:
+		rest_utils.RestErrWithWarningMsg(w, r, l, err,
+			http.StatusBadRequest, oauthErrInvalidGrant)
+	default:
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+	}
+}
+
+// refreshTokenGrant exchanges a refresh token for a new device token, without
+// another signed auth request; the refresh token is replaced as well
+func (d *DevAuthApiHandlers) refreshTokenGrant(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	refreshToken := r.PostFormValue(oauthFormParamRefreshToken)
+	if refreshToken == "" {
+		rest_utils.RestErrWithLogMsg(w, r, l,
+			errors.New("missing refresh token"),
+			http.StatusBadRequest, oauthErrInvalidRequest)
+		return
+	}
+
+	token, refreshToken, err := d.devAuth.RefreshToken(ctx, refreshToken)
+	switch err {
+	case nil:
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteJson(deviceToken{
+			AccessToken:  token,
+			TokenType:    oauthTokenTypeBearer,
+			RefreshToken: refreshToken,
+		})
+	case devauth.ErrInvalidRefreshToken:
+		rest_utils.RestErrWithWarningMsg(w, r, l, err,
+			http.StatusBadRequest, oauthErrInvalidGrant)
+	default:
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+	}
+}
+
+func (d *DevAuthApiHandlers) GetDeviceAuthorizationHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	res, err := d.devAuth.GetDeviceAuthorization(ctx, r.PathParam("code"))
+	switch err {
+	case nil:
+		w.WriteJson(res)
+	default:
+		restErr(w, r, l, err)
+	}
+}
+
+func (d *DevAuthApiHandlers) UpdateDeviceAuthorizationStatusHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if !checkRequestBody(w, r, schemaDecisionStatus) {
+		return
+	}
+
+	var status DevAuthApiStatus
+	err := r.DecodeJsonPayload(&status)
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode status data")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if status.Status != model.DevStatusAccepted &&
+		status.Status != model.DevStatusRejected {
+		rest_utils.RestErrWithLog(w, r, l, ErrIncorrectStatus, http.StatusBadRequest)
+		return
+	}
+
+	err = d.devAuth.SetDeviceAuthorizationStatus(ctx, r.PathParam("code"), status.Status)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case store.ErrDevNotFound:
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusNotFound)
+	default:
+		restErr(w, r, l, err)
+	}
+}
+
+func (d *DevAuthApiHandlers) PostTransferHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if !checkRequestBody(w, r, schemaTransferReq) {
+		return
+	}
+
+	var req model.TransferReq
+	err := r.DecodeJsonPayload(&req)
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode transfer request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := d.devAuth.StartDeviceTransfer(ctx, &req)
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.WriteJson(transfer)
+}
+
+func (d *DevAuthApiHandlers) PostBootstrapTokenHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if !checkRequestBody(w, r, schemaBootstrapTokenReq) {
+		return
+	}
+
+	var req model.BootstrapTokenReq
+	err := r.DecodeJsonPayload(&req)
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode bootstrap token request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	token, err := d.devAuth.CreateBootstrapToken(ctx, &req)
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	w.WriteJson(token)
+}
+
+func (d *DevAuthApiHandlers) GetTransferHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	transfer, err := d.devAuth.GetDeviceTransfer(ctx, r.PathParam("id"))
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(transfer)
+}
+
+func (d *DevAuthApiHandlers) DeleteTransferHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := d.devAuth.CancelDeviceTransfer(ctx, r.PathParam("id"))
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *DevAuthApiHandlers) AcceptTransferHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := d.devAuth.AcceptDeviceTransfer(ctx, r.PathParam("id"))
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *DevAuthApiHandlers) DeclineTransferHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := d.devAuth.DeclineDeviceTransfer(ctx, r.PathParam("id"))
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PatchDeviceHandler applies a JSON merge patch of the notes, labels and
+// group to the device and responds with the updated device
+func (d *DevAuthApiHandlers) PatchDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if !checkRequestBody(w, r, schemaDeviceAnnotations) {
+		return
+	}
+
+	var req model.DeviceAnnotations
+	err := r.DecodeJsonPayload(&req)
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode device patch")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	devId := r.PathParam("id")
+
+	err = d.devAuth.UpdateDeviceAnnotations(ctx, devId, &req)
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	dev, err := d.devAuth.GetDevice(ctx, devId)
+	switch {
+	case err == store.ErrDevNotFound:
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusNotFound)
+	case dev != nil:
+		apiDev, _ := deviceV2FromDbModel(dev)
+		_ = w.WriteJson(apiDev)
+	default:
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+	}
+}
+
+func (d *DevAuthApiHandlers) PutDecommissionAtHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if !checkRequestBody(w, r, schemaDecommissionAt) {
+		return
+	}
+
+	var req DevAuthApiDecommissionAt
+	err := r.DecodeJsonPayload(&req)
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode decommissioning time")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err = d.devAuth.ScheduleDecommission(ctx, r.PathParam("id"), req.DecommissionAt)
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *DevAuthApiHandlers) DeleteDecommissionAtHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := d.devAuth.CancelScheduledDecommission(ctx, r.PathParam("id"))
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *DevAuthApiHandlers) GetDeviceStatusHistoryHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	skip := (page - 1) * perPage
+	limit := perPage + 1
+	changes, err := d.devAuth.GetDeviceStatusHistory(ctx,
+		r.PathParam("id"), uint(skip), uint(limit))
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	len := len(changes)
+	hasNext := false
+	if uint64(len) > perPage {
+		hasNext = true
+		len = int(perPage)
+	}
+
+	for _, link := range rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext) {
+		w.Header().Add("Link", link)
+	}
+
+	_ = w.WriteJson(changes[:len])
+}
+
+func (d *DevAuthApiHandlers) PutDeviceGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if !checkRequestBody(w, r, schemaDeviceGroup) {
+		return
+	}
+
+	var req DevAuthApiGroup
+	err := r.DecodeJsonPayload(&req)
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode device group")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err = d.devAuth.SetDeviceGroup(ctx, r.PathParam("id"), req.Group)
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *DevAuthApiHandlers) DeleteDeviceGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := d.devAuth.SetDeviceGroup(ctx, r.PathParam("id"), "")
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *DevAuthApiHandlers) GetDecommissionsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	skip := (page - 1) * perPage
+	limit := perPage + 1
+	devs, err := d.devAuth.GetScheduledDecommissions(ctx, uint(skip), uint(limit))
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	len := len(devs)
+	hasNext := false
+	if uint64(len) > perPage {
+		hasNext = true
+		len = int(perPage)
+	}
+
+	for _, link := range rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext) {
+		w.Header().Add("Link", link)
+	}
+
+	outDevs, err := devicesV2FromDbModel(devs[:len])
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(outDevs)
+}
+
+func (d *DevAuthApiHandlers) GetOffboardingTokensHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	skip := (page - 1) * perPage
+	limit := perPage + 1
+	toks, err := d.devAuth.GetOffboardingTokens(ctx, uint(skip), uint(limit))
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	len := len(toks)
+	hasNext := false
+	if uint64(len) > perPage {
+		hasNext = true
+		len = int(perPage)
+	}
+
+	for _, link := range rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext) {
+		w.Header().Add("Link", link)
+	}
+
+	w.WriteJson(toks[:len])
+}
+
+func (d *DevAuthApiHandlers) PreauthDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+	l.Warn("This endpoint has been deprecated and will be removed in a future version.")
+
+	if !checkRequestBody(w, r, schemaPreAuthReq) {
+		return
+	}
+
+	req, err := model.ParsePreAuthReq(r.Body)
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode preauth request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err = d.devAuth.PreauthorizeDevice(ctx, req)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusCreated)
+	default:
+		restErr(w, r, l, err)
+	}
+}
+
+func (d *DevAuthApiHandlers) PostDevicesV2Handler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if !checkRequestBody(w, r, schemaPreAuthReqV2) {
+		return
+	}
+
+	req, err := parsePreAuthReq(r.Body)
+	if err != nil {
+		err = errors.Wrap(err, "failed to decode preauth request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	reqDbModel, err := req.getDbModel()
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	err = d.devAuth.PreauthorizeDevice(ctx, reqDbModel)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusCreated)
+	default:
+		restErr(w, r, l, err)
+	}
+}
+
+// PostDevicesImportHandler preauthorizes the devices listed in the request
+// body, CSV or newline delimited JSON by the 'format' parameter. The body
+// is parsed as it's read, so it may hold any number of devices.
+func (d *DevAuthApiHandlers) PostDevicesImportHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	format, err := rest_utils.ParseQueryParmStr(r, "format", false, importFormats)
+	if err != nil {
 		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
+	if format == "" {
+		format = model.PreAuthImportFormatCSV
+	}
 
-	err = json.Unmarshal(body, &authreq)
+	in, err := model.NewPreAuthImportReader(r.Body, format)
 	if err != nil {
-		err = errors.Wrap(err, "failed to decode auth request")
 		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	err = authreq.Validate()
+	res, err := d.devAuth.ImportPreauthorizedDevices(ctx, in)
 	if err != nil {
-		err = errors.Wrap(err, "invalid auth request")
-		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		restErr(w, r, l, err)
 		return
 	}
 
-	//verify signature
-	signature := r.Header.Get(HdrAuthReqSign)
-	if signature == "" {
-		rest_utils.RestErrWithLog(w, r, l, errors.New("missing request signature header"), http.StatusBadRequest)
-		return
+	_ = w.WriteJson(res)
+}
+
+// parseDeviceFilter reads the device listing filters, the device status
+// and the identity data search term, the sort order and the cursor, from
+// the query
+func parseDeviceFilter(r *rest.Request) (store.DeviceFilter, error) {
+	status, err := rest_utils.ParseQueryParmStr(r, model.DevKeyStatus, false, DevStatuses)
+	if err != nil {
+		return store.DeviceFilter{}, err
 	}
 
-	err = utils.VerifyAuthReqSign(signature, authreq.PubKeyStruct, body)
+	exact, err := rest_utils.ParseQueryParmBool(r, "search_exact", false, nil)
 	if err != nil {
-		rest_utils.RestErrWithLogMsg(w, r, l, err, http.StatusUnauthorized, "signature verification failed")
-		return
+		return store.DeviceFilter{}, err
 	}
 
-	token, err := d.devAuth.SubmitAuthRequest(ctx, &authreq)
+	conflict, err := rest_utils.ParseQueryParmBool(r, model.DevKeyConflict, false, nil)
+	if err != nil {
+		return store.DeviceFilter{}, err
+	}
 
+	sort, err := parseDeviceSort(r.URL.Query().Get("sort"))
 	if err != nil {
-		if devauth.IsErrDevAuthUnauthorized(err) {
-			rest_utils.RestErrWithWarningMsg(w, r, l, err,
-				http.StatusUnauthorized, errors.Cause(err).Error())
-			return
-		} else if devauth.IsErrDevAuthBadRequest(err) {
-			rest_utils.RestErrWithWarningMsg(w, r, l, err,
-				http.StatusBadRequest, errors.Cause(err).Error())
-			return
-		}
+		return store.DeviceFilter{}, err
 	}
 
-	switch err {
-	case devauth.ErrDevIdAuthIdMismatch, devauth.ErrMaxDeviceCountReached:
-		// error is always set to unauthorized, client does not need to
-		// know why
-		rest_utils.RestErrWithWarningMsg(w, r, l, devauth.ErrDevAuthUnauthorized,
-			http.StatusUnauthorized, "unauthorized")
-		return
-	case nil:
-		w.(http.ResponseWriter).Write([]byte(token))
-		w.Header().Set("Content-Type", "application/jwt")
-		return
-	default:
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
-		return
+	after, err := parseCursor(r, sort.String())
+	if err != nil {
+		return store.DeviceFilter{}, err
 	}
+
+	filter := store.DeviceFilter{
+		Status:      status,
+		Group:       r.URL.Query().Get(model.DevKeyGroup),
+		Search:      r.URL.Query().Get("search"),
+		SearchExact: exact != nil && *exact,
+		Conflict:    conflict != nil && *conflict,
+		Sort:        sort,
+		After:       after,
+	}
+
+	if filter.CreatedAfter, err = parseTimeParam(r, "created_after"); err != nil {
+		return store.DeviceFilter{}, err
+	}
+	if filter.CreatedBefore, err = parseTimeParam(r, "created_before"); err != nil {
+		return store.DeviceFilter{}, err
+	}
+	if filter.UpdatedAfter, err = parseTimeParam(r, "updated_after"); err != nil {
+		return store.DeviceFilter{}, err
+	}
+
+	return filter, nil
 }
 
-func (d *DevAuthApiHandlers) PreauthDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
+// parseTimeParam parses the optional RFC3339 timestamp query parameter
+func parseTimeParam(r *rest.Request, name string) (*time.Time, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, errors.Errorf("%s must be an RFC3339 timestamp", name)
+	}
+	return &ts, nil
+}
+
+// GetDevicesExportHandler streams the devices matching the listing filters,
+// as CSV or newline delimited JSON. Devices are written as they're fetched,
+// so an error past the first batch can only cut the export short.
+func (d *DevAuthApiHandlers) GetDevicesExportHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
-	l.Warn("This endpoint has been deprecated and will be removed in a future version.")
 
-	req, err := model.ParsePreAuthReq(r.Body)
+	format, err := rest_utils.ParseQueryParmStr(r, "format", false, exportFormats)
 	if err != nil {
-		err = errors.Wrap(err, "failed to decode preauth request")
 		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
-
-	err = d.devAuth.PreauthorizeDevice(ctx, req)
-	switch err {
-	case nil:
-		w.WriteHeader(http.StatusCreated)
-	case devauth.ErrDeviceExists:
-		rest_utils.RestErrWithLog(w, r, l, err, http.StatusConflict)
-	default:
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+	if format == "" {
+		format = exportFormatCSV
 	}
-}
 
-func (d *DevAuthApiHandlers) PostDevicesV2Handler(w rest.ResponseWriter, r *rest.Request) {
-	ctx := r.Context()
-
-	l := log.FromContext(ctx)
-
-	req, err := parsePreAuthReq(r.Body)
+	filter, err := parseDeviceFilter(r)
 	if err != nil {
-		err = errors.Wrap(err, "failed to decode preauth request")
 		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	reqDbModel, err := req.getDbModel()
+	var out deviceExportWriter
+	err = d.devAuth.ExportDevices(ctx, filter, func(dev *model.Device) error {
+		if out == nil {
+			out = newDeviceExportWriter(w.(http.ResponseWriter), format)
+		}
+		return out.Write(deviceExportFromDbModel(dev))
+	})
 	if err != nil {
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		if out == nil {
+			rest_utils.RestErrWithLogInternal(w, r, l, err)
+			return
+		}
+		l.Errorf("device export cut short: %v", err)
 		return
 	}
 
-	err = d.devAuth.PreauthorizeDevice(ctx, reqDbModel)
-	switch err {
-	case nil:
-		w.WriteHeader(http.StatusCreated)
-	case devauth.ErrDeviceExists:
-		rest_utils.RestErrWithLog(w, r, l, err, http.StatusConflict)
+	if out == nil {
+		out = newDeviceExportWriter(w.(http.ResponseWriter), format)
+	}
+	if err := out.Flush(); err != nil {
+		l.Errorf("device export cut short: %v", err)
+	}
+}
+
+// parseDeviceSort parses the device listing order, given as the field
+// optionally followed by ':asc' or ':desc', e.g. 'created_ts:desc'
+func parseDeviceSort(s string) (store.DeviceSort, error) {
+	if s == "" {
+		return store.DeviceSort{}, nil
+	}
+
+	errSort := errors.New("sort must be one of: id, created_ts, status, " +
+		"optionally followed by ':asc' or ':desc'")
+
+	field, order := s, "asc"
+	if i := strings.Index(s, ":"); i >= 0 {
+		field, order = s[:i], s[i+1:]
+	}
+
+	sort := store.DeviceSort{Field: field}
+	switch field {
+	case store.DeviceSortId, store.DeviceSortCreatedTs, store.DeviceSortStatus:
 	default:
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return store.DeviceSort{}, errSort
+	}
+	switch order {
+	case "asc":
+	case "desc":
+		sort.Desc = true
+	default:
+		return store.DeviceSort{}, errSort
 	}
+
+	return sort, nil
 }
 
 func (d *DevAuthApiHandlers) GetDevicesHandler(w rest.ResponseWriter, r *rest.Request) {
@@ -285,9 +1363,33 @@ func (d *DevAuthApiHandlers) GetDevicesHandler(w rest.ResponseWriter, r *rest.Re
 		return
 	}
 
+	cursorPaging, err := isCursorPaging(r)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseDeviceFilter(r)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
 	skip := (page - 1) * perPage
+	if cursorPaging {
+		skip = 0
+	}
 	limit := perPage + 1
-	devs, err := d.devAuth.GetDevices(ctx, uint(skip), uint(limit), store.DeviceFilter{})
+	devs, err := d.devAuth.GetDevices(ctx, uint(skip), uint(limit), filter)
+	if errors.Cause(err) == store.ErrInvalidCursor {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	total, err := d.devAuth.CountDevices(ctx, filter)
 	if err != nil {
 		rest_utils.RestErrWithLogInternal(w, r, l, err)
 		return
@@ -300,12 +1402,22 @@ func (d *DevAuthApiHandlers) GetDevicesHandler(w rest.ResponseWriter, r *rest.Re
 		len = int(perPage)
 	}
 
-	links := rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext)
+	var links []string
+	if cursorPaging {
+		var next *store.Cursor
+		if hasNext {
+			next = filter.Sort.Cursor(&devs[len-1])
+		}
+		links = makeCursorLinkHdrs(r, perPage, next)
+	} else {
+		links = makePageLinkHdrs(r, page, perPage, hasNext, total)
+	}
 
 	for _, l := range links {
 		w.Header().Add("Link", l)
 	}
-	w.WriteJson(devs[:len])
+	w.Header().Set(hdrTotalCount, strconv.Itoa(total))
+	writeJsonETag(w, r, devs[:len])
 }
 
 func (d *DevAuthApiHandlers) GetDevicesV2Handler(w rest.ResponseWriter, r *rest.Request) {
@@ -320,16 +1432,33 @@ func (d *DevAuthApiHandlers) GetDevicesV2Handler(w rest.ResponseWriter, r *rest.
 		return
 	}
 
-	status, err := rest_utils.ParseQueryParmStr(r, model.DevKeyStatus, false, DevStatuses)
+	cursorPaging, err := isCursorPaging(r)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseDeviceFilter(r)
 	if err != nil {
 		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
 	skip := (page - 1) * perPage
+	if cursorPaging {
+		skip = 0
+	}
 	limit := perPage + 1
-	devs, err := d.devAuth.GetDevices(ctx, uint(skip), uint(limit),
-		store.DeviceFilter{Status: status})
+	devs, err := d.devAuth.GetDevices(ctx, uint(skip), uint(limit), filter)
+	if errors.Cause(err) == store.ErrInvalidCursor {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	total, err := d.devAuth.CountDevices(ctx, filter)
 	if err != nil {
 		rest_utils.RestErrWithLogInternal(w, r, l, err)
 		return
@@ -342,11 +1471,21 @@ func (d *DevAuthApiHandlers) GetDevicesV2Handler(w rest.ResponseWriter, r *rest.
 		len = int(perPage)
 	}
 
-	links := rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext)
+	var links []string
+	if cursorPaging {
+		var next *store.Cursor
+		if hasNext {
+			next = filter.Sort.Cursor(&devs[len-1])
+		}
+		links = makeCursorLinkHdrs(r, perPage, next)
+	} else {
+		links = makePageLinkHdrs(r, page, perPage, hasNext, total)
+	}
 
 	for _, l := range links {
 		w.Header().Add("Link", l)
 	}
+	w.Header().Set(hdrTotalCount, strconv.Itoa(total))
 
 	outDevs, err := devicesV2FromDbModel(devs[:len])
 	if err != nil {
@@ -354,7 +1493,7 @@ func (d *DevAuthApiHandlers) GetDevicesV2Handler(w rest.ResponseWriter, r *rest.
 		return
 	}
 
-	w.WriteJson(outDevs)
+	writeJsonETag(w, r, outDevs)
 }
 
 func (d *DevAuthApiHandlers) GetDevicesCountV1Handler(w rest.ResponseWriter, r *rest.Request) {
@@ -376,20 +1515,76 @@ func (d *DevAuthApiHandlers) GetDevicesCountHandler(w rest.ResponseWriter, r *re
 		model.DevStatusRejected,
 		model.DevStatusPending,
 		model.DevStatusPreauth,
+		model.DevStatusQuarantined,
 		"":
 	default:
-		rest_utils.RestErrWithLog(w, r, l, errors.New("status must be one of: pending, accepted, rejected, preauthorized"), http.StatusBadRequest)
+		rest_utils.RestErrWithLog(w, r, l, errors.New("status must be one of: pending, accepted, rejected, preauthorized, quarantined"), http.StatusBadRequest)
+		return
+	}
+
+	counts, err := d.devAuth.GetDevCounts(ctx)
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	if status == "" {
+		w.WriteJson(counts)
 		return
 	}
+	w.WriteJson(model.Count{Count: counts.ByStatus(status)})
+}
+
+// GetStatisticsHandler returns the statistics of the tenant's devices,
+// over the last 'hours' hours, for dashboards
+func (d *DevAuthApiHandlers) GetStatisticsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := log.FromContext(ctx)
 
-	count, err := d.devAuth.GetDevCountByStatus(ctx, status)
+	hours, err := rest_utils.ParseQueryParmUInt(r, "hours", false,
+		1, maxStatisticsHours, defaultStatisticsHours)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
 
+	stats, err := d.devAuth.GetStatistics(ctx, time.Duration(hours)*time.Hour)
 	if err != nil {
 		rest_utils.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	w.WriteJson(model.Count{Count: count})
+	w.WriteJson(stats)
+}
+
+// PurgeRejectedDevicesHandler decommissions the rejected devices which
+// haven't attempted to authenticate for 'days' days, by default for the
+// configured retention; with 'dry_run', they're only counted
+func (d *DevAuthApiHandlers) PurgeRejectedDevicesHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := log.FromContext(ctx)
+
+	days, err := rest_utils.ParseQueryParmUInt(r, "days", false,
+		1, maxPurgeRejectedDays, 0)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := rest_utils.ParseQueryParmBool(r, "dry_run", false, nil)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	n, err := d.devAuth.PurgeRejectedDevices(ctx,
+		time.Duration(days)*24*time.Hour, dryRun != nil && *dryRun)
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(model.Count{Count: n})
 }
 
 func (d *DevAuthApiHandlers) GetDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
@@ -406,7 +1601,7 @@ func (d *DevAuthApiHandlers) GetDeviceHandler(w rest.ResponseWriter, r *rest.Req
 	case err == store.ErrDevNotFound:
 		rest_utils.RestErrWithLog(w, r, l, err, http.StatusNotFound)
 	case dev != nil:
-		w.WriteJson(dev)
+		writeJsonETag(w, r, dev)
 	default:
 		rest_utils.RestErrWithLogInternal(w, r, l, err)
 	}
@@ -426,7 +1621,7 @@ func (d *DevAuthApiHandlers) GetDeviceV2Handler(w rest.ResponseWriter, r *rest.R
 		rest_utils.RestErrWithLog(w, r, l, err, http.StatusNotFound)
 	case dev != nil:
 		apiDev, _ := deviceV2FromDbModel(dev)
-		w.WriteJson(apiDev)
+		writeJsonETag(w, r, apiDev)
 	default:
 		rest_utils.RestErrWithLogInternal(w, r, l, err)
 	}
@@ -489,6 +1684,48 @@ func (d *DevAuthApiHandlers) DeleteDeviceAuthSetHandler(w rest.ResponseWriter, r
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (d *DevAuthApiHandlers) GetDeviceKeysHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	keys, err := d.devAuth.GetDeviceKeys(ctx, r.PathParam("id"))
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(keys)
+}
+
+func (d *DevAuthApiHandlers) GetDeviceTokensHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tokens, err := d.devAuth.GetDeviceTokens(ctx, r.PathParam("id"))
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(tokens)
+}
+
+func (d *DevAuthApiHandlers) RevokeDeviceKeyHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := d.devAuth.RevokeDeviceKey(ctx, r.PathParam("id"), r.PathParam("aid"))
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (d *DevAuthApiHandlers) DevAdmDeleteDeviceAuthSetHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
@@ -551,6 +1788,25 @@ func (d *DevAuthApiHandlers) DeleteTokenHandler(w rest.ResponseWriter, r *rest.R
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// DeleteDeviceTokensHandler revokes all tokens of a device at once
+func (d *DevAuthApiHandlers) DeleteDeviceTokensHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	devId := r.PathParam("id")
+
+	err := d.devAuth.RevokeDeviceTokens(ctx, devId)
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case store.ErrDevNotFound:
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusNotFound)
+	default:
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+	}
+}
+
 func (d *DevAuthApiHandlers) VerifyTokenHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
@@ -562,11 +1818,24 @@ func (d *DevAuthApiHandlers) VerifyTokenHandler(w rest.ResponseWriter, r *rest.R
 		return
 	}
 
+	withClaims := false
+	if c := r.URL.Query().Get("claims"); c != "" {
+		withClaims, err = strconv.ParseBool(c)
+		if err != nil {
+			rest_utils.RestErrWithLog(w, r, l,
+				errors.New("claims must be a boolean"), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// verify token
 	err = d.devAuth.VerifyToken(ctx, tokenStr)
 	code := http.StatusOK
 	if err != nil {
 		switch err {
+		case devauth.ErrTokenExpiryGrace:
+			// accepted, but the device should authenticate again
+			code = http.StatusAccepted
 		case jwt.ErrTokenExpired:
 			code = http.StatusForbidden
 		case store.ErrTokenNotFound, jwt.ErrTokenInvalid:
@@ -575,10 +1844,100 @@ func (d *DevAuthApiHandlers) VerifyTokenHandler(w rest.ResponseWriter, r *rest.R
 			rest_utils.RestErrWithLogInternal(w, r, l, err)
 			return
 		}
-		l.Error(err)
+		l.Error(err)
+	}
+
+	if code != http.StatusOK || !withClaims {
+		w.WriteHeader(code)
+		return
+	}
+
+	// gateways may ask for the decoded claims, to not parse the token again
+	claims, err := d.devAuth.IntrospectToken(ctx, tokenStr)
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+	if !claims.Active {
+		// revoked or expired in between
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.WriteJson(claims)
+}
+
+// IntrospectTokenHandler implements token introspection (RFC 7662) for
+// device tokens, for gateways that don't speak the verify endpoint
+func (d *DevAuthApiHandlers) IntrospectTokenHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := r.ParseForm(); err != nil {
+		rest_utils.RestErrWithLogMsg(w, r, l, err,
+			http.StatusBadRequest, oauthErrInvalidRequest)
+		return
+	}
+
+	token := r.PostFormValue(oauthFormParamToken)
+	if token == "" {
+		rest_utils.RestErrWithLogMsg(w, r, l,
+			errors.New("missing token"),
+			http.StatusBadRequest, oauthErrInvalidRequest)
+		return
+	}
+
+	res, err := d.devAuth.IntrospectToken(ctx, token)
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteJson(res)
+}
+
+// GetJWKSHandler serves the keys device tokens can be verified with, for
+// services verifying them on their own
+func (d *DevAuthApiHandlers) GetJWKSHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	jwks, err := d.devAuth.GetJWKS(ctx)
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "max-age=300")
+	if jwks.Version != "" {
+		etag := `"` + jwks.Version + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			// the verifier's cached keys are still current
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.WriteJson(jwks)
+}
+
+// GetKeyPolicyHandler serves the minimum strength device public keys must
+// have to enroll
+func (d *DevAuthApiHandlers) GetKeyPolicyHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	policy, err := d.devAuth.GetKeyPolicy(ctx)
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
 	}
 
-	w.WriteHeader(code)
+	w.WriteJson(policy)
 }
 
 func (d *DevAuthApiHandlers) UpdateDeviceStatusV1Handler(w rest.ResponseWriter, r *rest.Request) {
@@ -597,6 +1956,10 @@ func (d *DevAuthApiHandlers) UpdateDeviceStatusHandler(w rest.ResponseWriter, r
 	devid := r.PathParam("id")
 	authid := r.PathParam("aid")
 
+	if !checkRequestBody(w, r, schemaDeviceStatus) {
+		return
+	}
+
 	var status DevAuthApiStatus
 	err := r.DecodeJsonPayload(&status)
 	if err != nil {
@@ -616,18 +1979,48 @@ func (d *DevAuthApiHandlers) UpdateDeviceStatusHandler(w rest.ResponseWriter, r
 		err = d.devAuth.RejectDeviceAuth(ctx, devid, authid)
 	} else if status.Status == model.DevStatusPending {
 		err = d.devAuth.ResetDeviceAuth(ctx, devid, authid)
+	} else if status.Status == statusDismissed {
+		err = d.devAuth.DismissDeviceAuth(ctx, devid, authid)
 	}
 	if err != nil {
 		switch err {
 		case store.ErrDevNotFound:
 			rest_utils.RestErrWithLog(w, r, l, err, http.StatusNotFound)
-		case devauth.ErrDevIdAuthIdMismatch:
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
-		case devauth.ErrMaxDeviceCountReached:
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
+		default:
+			restErr(w, r, l, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResolveAuthSetConflictHandler makes the auth set the authoritative one
+// of its conflict, dealing with the others as requested
+func (d *DevAuthApiHandlers) ResolveAuthSetConflictHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
 
+	if !checkRequestBody(w, r, schemaConflictResolution) {
+		return
+	}
+
+	var req DevAuthApiConflictResolution
+	if err := r.DecodeJsonPayload(&req); err != nil {
+		err = errors.Wrap(err, "failed to decode conflict resolution")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err := d.devAuth.ResolveAuthSetConflict(ctx,
+		r.PathParam("id"), r.PathParam("aid"), req.Others)
+	if err != nil {
+		switch err {
+		case store.ErrDevNotFound:
+			rest_utils.RestErrWithLog(w, r, l, err, http.StatusNotFound)
 		default:
-			rest_utils.RestErrWithLogInternal(w, r, l, err)
+			restErr(w, r, l, err)
 		}
 		return
 	}
@@ -635,6 +2028,68 @@ func (d *DevAuthApiHandlers) UpdateDeviceStatusHandler(w rest.ResponseWriter, r
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// QuarantineDeviceHandler quarantines the device, see
+// devauth.QuarantineDevice
+func (d *DevAuthApiHandlers) QuarantineDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := d.devAuth.QuarantineDevice(ctx, r.PathParam("id")); err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReleaseDeviceQuarantineHandler ends the device's quarantine
+func (d *DevAuthApiHandlers) ReleaseDeviceQuarantineHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := d.devAuth.ReleaseDeviceQuarantine(ctx, r.PathParam("id")); err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateDevicesStatusHandler accepts or rejects several devices at once;
+// the result of each device is returned rather than failing the whole
+// request
+func (d *DevAuthApiHandlers) UpdateDevicesStatusHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if !checkRequestBody(w, r, schemaDevicesStatusReq) {
+		return
+	}
+
+	var req model.DevicesStatusReq
+	if err := r.DecodeJsonPayload(&req); err != nil {
+		err = errors.Wrap(err, "failed to decode devices status request")
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	results, err := d.devAuth.UpdateDevicesStatus(ctx, &req)
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(results)
+}
+
 type LimitValue struct {
 	Limit uint64 `json:"limit"`
 }
@@ -654,6 +2109,10 @@ func (d *DevAuthApiHandlers) PutTenantLimitHandler(w rest.ResponseWriter, r *res
 		return
 	}
 
+	if !checkRequestBody(w, r, schemaLimit) {
+		return
+	}
+
 	var value LimitValue
 	err := r.DecodeJsonPayload(&value)
 	if err != nil {
@@ -721,6 +2180,18 @@ func (d *DevAuthApiHandlers) GetLimitHandler(w rest.ResponseWriter, r *rest.Requ
 		return
 	}
 
+	// the device limit comes with its usage, to tell if devices can be
+	// accepted
+	if name == model.LimitMaxDeviceCount {
+		usage, err := d.devAuth.GetDeviceLimitUsage(ctx)
+		if err != nil {
+			rest_utils.RestErrWithLogInternal(w, r, l, err)
+			return
+		}
+		_ = w.WriteJson(usage)
+		return
+	}
+
 	lim, err := d.devAuth.GetLimit(ctx, name)
 	if err != nil {
 		rest_utils.RestErrWithLogInternal(w, r, l, err)
@@ -752,6 +2223,167 @@ func (d *DevAuthApiHandlers) DeleteTokensHandler(w rest.ResponseWriter, r *rest.
 	}
 }
 
+// GetRevokedTokensHandler lists the revoked token ids, oldest first, for
+// gateways verifying tokens offline; 'since' is an RFC3339 timestamp
+func (d *DevAuthApiHandlers) GetRevokedTokensHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			rest_utils.RestErrWithLog(w, r, l,
+				errors.New("since must be an RFC3339 timestamp"),
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	skip := (page - 1) * perPage
+	limit := perPage + 1
+	toks, err := d.devAuth.GetRevokedTokens(ctx,
+		r.URL.Query().Get("tenant_id"), since, uint(skip), uint(limit))
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	len := len(toks)
+	hasNext := false
+	if uint64(len) > perPage {
+		hasNext = true
+		len = int(perPage)
+	}
+
+	for _, link := range rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext) {
+		w.Header().Add("Link", link)
+	}
+
+	w.WriteJson(toks[:len])
+}
+
+// GetTokenAuditHandler lists the token audit trail, newest first,
+// optionally filtered by device, token, action and time range
+func (d *DevAuthApiHandlers) GetTokenAuditHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	q := r.URL.Query()
+	filter := store.TokenAuditFilter{
+		DeviceId: q.Get("device_id"),
+		TokenId:  q.Get("token_id"),
+		Action:   q.Get("action"),
+	}
+	switch filter.Action {
+	case "", model.TokenAuditActionIssued, model.TokenAuditActionRevoked:
+	default:
+		rest_utils.RestErrWithLog(w, r, l,
+			errors.New("action must be one of: issued, revoked"),
+			http.StatusBadRequest)
+		return
+	}
+	if s := q.Get("from"); s != "" {
+		from, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			rest_utils.RestErrWithLog(w, r, l,
+				errors.New("from must be an RFC3339 timestamp"),
+				http.StatusBadRequest)
+			return
+		}
+		filter.From = &from
+	}
+	if s := q.Get("to"); s != "" {
+		to, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			rest_utils.RestErrWithLog(w, r, l,
+				errors.New("to must be an RFC3339 timestamp"),
+				http.StatusBadRequest)
+			return
+		}
+		filter.To = &to
+	}
+
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	cursorPaging, err := isCursorPaging(r)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	filter.After, err = parseCursor(r, store.TokenAuditSort)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	skip := (page - 1) * perPage
+	if cursorPaging {
+		skip = 0
+	}
+	limit := perPage + 1
+	recs, err := d.devAuth.GetTokenAuditRecords(ctx, filter, uint(skip), uint(limit))
+	if errors.Cause(err) == store.ErrInvalidCursor {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	len := len(recs)
+	hasNext := false
+	if uint64(len) > perPage {
+		hasNext = true
+		len = int(perPage)
+	}
+
+	var links []string
+	if cursorPaging {
+		var next *store.Cursor
+		if hasNext {
+			next = store.TokenAuditCursor(&recs[len-1])
+		}
+		links = makeCursorLinkHdrs(r, perPage, next)
+	} else {
+		links = rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext)
+	}
+	for _, link := range links {
+		w.Header().Add("Link", link)
+	}
+
+	w.WriteJson(recs[:len])
+}
+
+// GetRevocationGatewaysHandler reports the delivery status of revocations
+// pushed to the gateways
+func (d *DevAuthApiHandlers) GetRevocationGatewaysHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	status, err := d.devAuth.GetRevocationGateways(ctx)
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(status)
+}
+
 func (d *DevAuthApiHandlers) DevAdmUpdateAuthSetStatusHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 	l := log.FromContext(ctx)
@@ -760,6 +2392,10 @@ func (d *DevAuthApiHandlers) DevAdmUpdateAuthSetStatusHandler(w rest.ResponseWri
 
 	authid := r.PathParam("aid")
 
+	if !checkRequestBody(w, r, schemaDecisionStatus) {
+		return
+	}
+
 	var status model.Status
 	err := r.DecodeJsonPayload(&status)
 	if err != nil {
@@ -805,12 +2441,9 @@ func (d *DevAuthApiHandlers) DevAdmUpdateAuthSetStatusHandler(w rest.ResponseWri
 		w.WriteJson(&status)
 	case store.ErrDevNotFound:
 		rest_utils.RestErrWithLog(w, r, l, store.ErrAuthSetNotFound, http.StatusNotFound)
-	case devauth.ErrMaxDeviceCountReached:
-		rest_utils.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
 	default:
-		rest_utils.RestErrWithLogInternal(w, r, l,
-			errors.Wrap(err,
-				"failed to change auth set status"))
+		restErr(w, r, l, errors.Wrap(err,
+			"failed to change auth set status"))
 	}
 }
 
@@ -837,6 +2470,27 @@ func (d *DevAuthApiHandlers) DevAdmGetAuthSetStatusHandler(w rest.ResponseWriter
 	}
 }
 
+// GetDeviceAuthSetHandler returns an auth set of the device, along with the
+// origin of the auth request it was first seen with
+func (d *DevAuthApiHandlers) GetDeviceAuthSetHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := log.FromContext(ctx)
+
+	aset, err := d.devAuth.GetDeviceAuthSet(ctx, r.PathParam("id"), r.PathParam("aid"))
+	if err != nil {
+		restErr(w, r, l, err)
+		return
+	}
+
+	out, err := authSetV2FromDbModel(aset)
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(out)
+}
+
 func (d *DevAuthApiHandlers) GetAuthSetStatusHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 	l := log.FromContext(ctx)
@@ -918,6 +2572,10 @@ func (d *DevAuthApiHandlers) PostDevicesHandler(w rest.ResponseWriter, r *rest.R
 
 	l.Warn("This endpoint has been deprecated and will be removed in a future version.")
 
+	if !checkRequestBody(w, r, schemaDevAdmAuthSetReq) {
+		return
+	}
+
 	// parse authenticate set
 	defer r.Body.Close()
 	authSet, err := model.ParseDevAdmAuthSetReq(r.Body)
@@ -936,19 +2594,11 @@ func (d *DevAuthApiHandlers) PostDevicesHandler(w rest.ResponseWriter, r *rest.R
 
 	err = d.devAuth.PreauthorizeDevice(ctx, req)
 
-	if err != nil && devauth.IsErrDevAuthBadRequest(err) {
-		rest_utils.RestErrWithWarningMsg(w, r, l, err,
-			http.StatusBadRequest, errors.Cause(err).Error())
-		return
-	}
-
 	switch err {
 	case nil:
 		w.WriteHeader(http.StatusCreated)
-	case devauth.ErrDeviceExists:
-		rest_utils.RestErrWithLog(w, r, l, err, http.StatusConflict)
 	default:
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		restErr(w, r, l, err)
 	}
 }
 
@@ -956,6 +2606,10 @@ func (d *DevAuthApiHandlers) ProvisionTenantHandler(w rest.ResponseWriter, r *re
 	ctx := r.Context()
 	l := log.FromContext(ctx)
 
+	if !checkRequestBody(w, r, schemaNewTenant) {
+		return
+	}
+
 	defer r.Body.Close()
 
 	tenant, err := model.ParseNewTenant(r.Body)
@@ -973,6 +2627,34 @@ func (d *DevAuthApiHandlers) ProvisionTenantHandler(w rest.ResponseWriter, r *re
 	w.WriteHeader(http.StatusCreated)
 }
 
+// SuspendTenantHandler suspends the tenant and revokes all its tokens
+func (d *DevAuthApiHandlers) SuspendTenantHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := d.devAuth.SuspendTenant(ctx, r.PathParam("tid")); err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResumeTenantHandler lifts the tenant's suspension
+func (d *DevAuthApiHandlers) ResumeTenantHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := d.devAuth.ResumeTenant(ctx, r.PathParam("tid")); err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (d *DevAuthApiHandlers) GetTenantDeviceStatus(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
@@ -995,10 +2677,8 @@ func (d *DevAuthApiHandlers) GetTenantDeviceStatus(w rest.ResponseWriter, r *res
 	switch err {
 	case nil:
 		w.WriteJson(status)
-	case devauth.ErrDeviceNotFound:
-		rest_utils.RestErrWithLog(w, r, l, err, http.StatusNotFound)
 	default:
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		restErr(w, r, l, err)
 	}
 }
 
@@ -1018,6 +2698,23 @@ func (d *DevAuthApiHandlers) GetTenantDevicesHandler(w rest.ResponseWriter, r *r
 	d.GetDevicesV2Handler(w, r)
 }
 
+// GetTenantDevicesCountHandler counts the tenant's devices, e.g. for
+// billing to meter the accepted ones
+func (d *DevAuthApiHandlers) GetTenantDevicesCountHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := log.FromContext(ctx)
+
+	tid := r.PathParam("tid")
+	if tid == "" {
+		rest_utils.RestErrWithLog(w, r, l, errors.New("tenant id (tid) cannot be empty"), http.StatusBadRequest)
+		return
+	}
+	ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tid})
+	r.Request = r.WithContext(ctx)
+
+	d.GetDevicesCountHandler(w, r)
+}
+
 func (d *DevAuthApiHandlers) DevAdmGetDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 	l := log.FromContext(ctx)
@@ -1055,7 +2752,8 @@ func (d *DevAuthApiHandlers) DevAdmGetDeviceHandler(w rest.ResponseWriter, r *re
 func statusValidate(status *DevAuthApiStatus) error {
 	if status.Status != model.DevStatusAccepted &&
 		status.Status != model.DevStatusRejected &&
-		status.Status != model.DevStatusPending {
+		status.Status != model.DevStatusPending &&
+		status.Status != statusDismissed {
 		return ErrIncorrectStatus
 	} else {
 		return nil
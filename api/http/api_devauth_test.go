@@ -14,15 +14,22 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ant0ine/go-json-rest/rest/test"
@@ -33,14 +40,17 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/mendersoftware/deviceauth/catalog"
 	"github.com/mendersoftware/deviceauth/client/tenant"
 	"github.com/mendersoftware/deviceauth/devauth"
 	"github.com/mendersoftware/deviceauth/devauth/mocks"
 	"github.com/mendersoftware/deviceauth/jwt"
 	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/revocation"
 	"github.com/mendersoftware/deviceauth/store"
 	smocks "github.com/mendersoftware/deviceauth/store/mocks"
 	mtest "github.com/mendersoftware/deviceauth/utils/testing"
+	uto "github.com/mendersoftware/deviceauth/utils/to"
 	mt "github.com/mendersoftware/go-lib-micro/testing"
 )
 
@@ -116,6 +126,41 @@ func TestApiDevAuthSubmitAuthReq(t *testing.T) {
 	privkey := mtest.LoadPrivKey("testdata/private.pem", t)
 	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
 
+	rsaAuthReq := map[string]interface{}{
+		"id_data": `{"sn":"0001"}`,
+		"pubkey":  pubkeyStr,
+	}
+	rsaAuthReqBody, _ := json.Marshal(rsaAuthReq)
+
+	edPrivkey := mtest.LoadEd25519PrivKey("testdata/private_ed25519.pem", t)
+	edPubkeyStr := mtest.LoadPubKeyStr("testdata/public_ed25519.pem", t)
+	edAuthReq := map[string]interface{}{
+		"id_data":      `{"sn":"0001"}`,
+		"pubkey":       edPubkeyStr,
+		"tenant_token": "tenant-0001",
+	}
+	edAuthReqBody, _ := json.Marshal(edAuthReq)
+
+	ecPrivkey := mtest.LoadECDSAPrivKey("testdata/private_ecdsa_p256.pem", t)
+	ecAuthReq := map[string]interface{}{
+		"id_data": `{"sn":"0001"}`,
+		"pubkey":  mtest.LoadPubKeyStr("testdata/public_ecdsa_p256.pem", t),
+	}
+	ecAuthReqBody, _ := json.Marshal(ecAuthReq)
+
+	_, ecCert := mtest.IssueCert("0001", ecPrivkey.Public(), nil, ecPrivkey, false, t)
+	certAuthReq := map[string]interface{}{
+		"id_data":     `{"sn":"0001"}`,
+		"certificate": ecCert,
+	}
+	certAuthReqBody, _ := json.Marshal(certAuthReq)
+	certMismatchReq := map[string]interface{}{
+		"id_data":     `{"sn":"0001"}`,
+		"pubkey":      edPubkeyStr,
+		"certificate": ecCert,
+	}
+	certMismatchReqBody, _ := json.Marshal(certMismatchReq)
+
 	testCases := []struct {
 		req *http.Request
 
@@ -146,7 +191,7 @@ func TestApiDevAuthSubmitAuthReq(t *testing.T) {
 			"",
 			nil,
 			400,
-			RestError("invalid auth request: id_data must be provided"),
+			RestError("invalid auth request: id_data: is required"),
 		},
 		{
 			//incomplete body
@@ -161,7 +206,7 @@ func TestApiDevAuthSubmitAuthReq(t *testing.T) {
 			"",
 			nil,
 			400,
-			RestError("invalid auth request: pubkey must be provided"),
+			RestError("invalid auth request: pubkey or certificate must be provided"),
 		},
 		{
 			//complete body, missing signature header
@@ -277,12 +322,182 @@ func TestApiDevAuthSubmitAuthReq(t *testing.T) {
 			400,
 			RestError("invalid auth request: cannot decode public key"),
 		},
+		{
+			//OpenSSH public key, auth ok
+			makeAuthReq(
+				map[string]interface{}{
+					"id_data": `{"sn":"0001"}`,
+					"pubkey":  mtest.LoadPubKeyStr("testdata/public.ssh", t),
+				},
+				privkey,
+				"",
+				t),
+			"dummytoken",
+			nil,
+			200,
+			"dummytoken",
+		},
+		{
+			//base64 DER public key, auth ok
+			makeAuthReq(
+				map[string]interface{}{
+					"id_data": `{"sn":"0001"}`,
+					"pubkey":  mtest.LoadPubKeyStr("testdata/public.der.b64", t),
+				},
+				privkey,
+				"",
+				t),
+			"dummytoken",
+			nil,
+			200,
+			"dummytoken",
+		},
+		{
+			//RSA-PSS signature, auth ok
+			makeAuthReq(
+				rsaAuthReq,
+				nil,
+				string(mtest.AuthReqSignPSS(rsaAuthReqBody, privkey, t)),
+				t),
+			"dummytoken",
+			nil,
+			200,
+			"dummytoken",
+		},
+		{
+			//Ed25519 key + signature, auth ok
+			makeAuthReq(
+				edAuthReq,
+				nil,
+				string(mtest.AuthReqSignEd25519(edAuthReqBody, edPrivkey, t)),
+				t),
+			"dummytoken",
+			nil,
+			200,
+			"dummytoken",
+		},
+		{
+			//ECDSA key + signature, auth ok
+			makeAuthReq(
+				ecAuthReq,
+				nil,
+				string(mtest.AuthReqSignECDSA(ecAuthReqBody, ecPrivkey, t)),
+				t),
+			"dummytoken",
+			nil,
+			200,
+			"dummytoken",
+		},
+		{
+			//Ed25519 key, RSA signature
+			makeAuthReq(
+				edAuthReq,
+				privkey,
+				"",
+				t),
+			"dummytoken",
+			nil,
+			401,
+			RestError("signature verification failed"),
+		},
+		{
+			//certificate instead of pubkey, auth ok
+			makeAuthReq(
+				certAuthReq,
+				nil,
+				string(mtest.AuthReqSignECDSA(certAuthReqBody, ecPrivkey, t)),
+				t),
+			"dummytoken",
+			nil,
+			200,
+			"dummytoken",
+		},
+		{
+			//certificate not trusted
+			makeAuthReq(
+				certAuthReq,
+				nil,
+				string(mtest.AuthReqSignECDSA(certAuthReqBody, ecPrivkey, t)),
+				t),
+			"",
+			devauth.ErrDeviceCertNotTrusted,
+			401,
+			RestError("device certificate not trusted"),
+		},
+		{
+			//pubkey and certificate key differ
+			makeAuthReq(
+				certMismatchReq,
+				nil,
+				string(mtest.AuthReqSignECDSA(certMismatchReqBody, ecPrivkey, t)),
+				t),
+			"dummytoken",
+			nil,
+			400,
+			RestError("invalid auth request: pubkey doesn't match the certificate"),
+		},
+		{
+			//garbage certificate
+			makeAuthReq(
+				map[string]interface{}{
+					"id_data":     `{"sn":"0001"}`,
+					"certificate": "foo",
+				},
+				privkey,
+				"",
+				t),
+			"dummytoken",
+			nil,
+			400,
+			RestError("invalid auth request: cannot decode certificate"),
+		},
+		{
+			//key too weak for the key policy
+			makeAuthReq(
+				map[string]interface{}{
+					"id_data":      "{\"mac\":\"00:00:00:01\"}",
+					"pubkey":       pubkeyStr,
+					"tenant_token": "tenant-0001",
+				},
+				privkey,
+				"",
+				t),
+			"",
+			&devauth.Error{
+				Kind:    devauth.ErrKindBadRequest,
+				Code:    catalog.CodeWeakKey,
+				Message: "public key doesn't meet the key policy: key type rsa is not allowed",
+			},
+			400,
+			RestError("public key doesn't meet the key policy: key type rsa is not allowed"),
+		},
+		{
+			//nonce already used
+			makeAuthReq(
+				map[string]interface{}{
+					"id_data":      "{\"mac\":\"00:00:00:01\"}",
+					"pubkey":       pubkeyStr,
+					"tenant_token": "tenant-0001",
+					"nonce":        "Zm9vYmFy",
+				},
+				privkey,
+				"",
+				t),
+			"",
+			devauth.ErrAuthNonceInvalid,
+			401,
+			RestError("auth request nonce invalid or expired"),
+		},
 	}
 
 	for i := range testCases {
 		tc := testCases[i]
 		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
 			da := &mocks.App{}
+			da.On("IssueRefreshToken",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("string")).
+				Return("", nil)
 			da.On("SubmitAuthRequest",
 				mtest.ContextMatcher(),
 				mock.AnythingOfType("*model.AuthReq")).
@@ -306,2422 +521,7181 @@ func TestApiDevAuthSubmitAuthReq(t *testing.T) {
 	}
 }
 
-func TestApiDevAuthPreauthDevice(t *testing.T) {
+func TestApiDevAuthRenewToken(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
-
 	testCases := map[string]struct {
-		body interface{}
+		authHeader string
 
-		devAuthErr error
+		token        string
+		renewErr     error
+		refreshToken string
+		refreshErr   error
 
-		checker mt.ResponseChecker
+		code int
+		body string
 	}{
 		"ok": {
-			body: &model.PreAuthReq{
-				AuthSetId: "auth-set-id",
-				DeviceId:  "device-id",
-				IdData:    `{"sn":"0001"}`,
-				PubKey:    pubkeyStr,
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusCreated,
-				nil,
-				nil),
-		},
-		"invalid: id data is not json": {
-			body: &model.PreAuthReq{
-				AuthSetId: "auth-set-id",
-				DeviceId:  "device-id",
-				IdData:    `"sn":"0001"`,
-				PubKey:    pubkeyStr,
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: invalid character ':' after top-level value")),
-		},
-		"invalid: no auth set id": {
-			body: &model.PreAuthReq{
-				DeviceId: "device-id",
-				IdData:   `{"sn":"0001"}`,
-				PubKey:   pubkeyStr,
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: auth_set_id: non zero value required;")),
-		},
-		"invalid: no device_id": {
-			body: &model.PreAuthReq{
-				AuthSetId: "auth-set-id",
-				IdData:    `{"sn":"0001"}`,
-				PubKey:    pubkeyStr,
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: device_id: non zero value required;")),
-		},
-		"invalid: no id data": {
-			body: &model.PreAuthReq{
-				AuthSetId: "auth-set-id",
-				DeviceId:  "device-id",
-				PubKey:    pubkeyStr,
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: id_data: non zero value required;")),
-		},
-		"invalid: no pubkey": {
-			body: &model.PreAuthReq{
-				AuthSetId: "auth-set-id",
-				DeviceId:  "device-id",
-				IdData:    `{"sn":"0001"}`,
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: pubkey: non zero value required;")),
-		},
-		"invalid: no body": {
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: EOF")),
-		},
-		"invalid public key": {
-			body: &model.PreAuthReq{
-				AuthSetId: "auth-set-id",
-				DeviceId:  "device-id",
-				IdData:    `{"sn":"0001"}`,
-				PubKey:    "invalid",
-			},
-			devAuthErr: devauth.ErrDeviceExists,
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: cannot decode public key")),
-		},
-		"devauth: device exists": {
-			body: &model.PreAuthReq{
-				AuthSetId: "auth-set-id",
-				DeviceId:  "device-id",
-				IdData:    `{"sn":"0001"}`,
-				PubKey:    pubkeyStr,
-			},
-			devAuthErr: devauth.ErrDeviceExists,
-			checker: mt.NewJSONResponse(
-				http.StatusConflict,
-				nil,
-				restError("device already exists")),
+			authHeader: "Bearer old-token",
+			token:      "new-token",
+			code:       http.StatusOK,
+			body:       "new-token",
+		},
+		"ok, with refresh token": {
+			authHeader:   "Bearer old-token",
+			token:        "new-token",
+			refreshToken: "refresh-token",
+			code:         http.StatusOK,
+			body:         "new-token",
+		},
+		"error, no token": {
+			code: http.StatusUnauthorized,
+			body: RestError(ErrNoAuthHeader.Error()),
 		},
-		"devauth: generic error": {
-			body: &model.PreAuthReq{
-				AuthSetId: "auth-set-id",
-				DeviceId:  "device-id",
-				IdData:    `{"sn":"0001"}`,
-				PubKey:    pubkeyStr,
-			},
-			devAuthErr: errors.New("generic"),
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error")),
+		"error, token not valid": {
+			authHeader: "Bearer old-token",
+			renewErr:   devauth.ErrDevAuthUnauthorized,
+			code:       http.StatusUnauthorized,
+			body:       RestError(devauth.ErrDevAuthUnauthorized.Error()),
+		},
+		"error, internal": {
+			authHeader: "Bearer old-token",
+			renewErr:   errors.New("db failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
+		},
+		"error, refresh token": {
+			authHeader: "Bearer old-token",
+			token:      "new-token",
+			refreshErr: errors.New("db failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
 		},
 	}
 
 	for name, tc := range testCases {
-		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
 			da := &mocks.App{}
-			da.On("PreauthorizeDevice",
+			da.On("RenewToken",
 				mtest.ContextMatcher(),
-				tc.body).
-				Return(tc.devAuthErr)
+				"old-token").
+				Return(tc.token, tc.renewErr)
+			da.On("IssueRefreshToken",
+				mtest.ContextMatcher(),
+				"new-token").
+				Return(tc.refreshToken, tc.refreshErr)
 
 			apih := makeMockApiHandler(t, da, nil)
 
-			//make request
-			req := makeReq("POST",
-				"http://1.2.3.4/api/management/v1/devauth/devices",
-				"",
-				tc.body)
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/devices/v1/authentication/tokens/renew", nil)
+			if tc.authHeader != "" {
+				req.Header.Set("Authorization", tc.authHeader)
+			}
 
-			recorded := test.RunRequest(t, apih, req)
-			mt.CheckResponse(t, tc.checker, recorded)
+			recorded := runTestRequest(t, apih, req, tc.code, tc.body)
+			if tc.code == http.StatusOK {
+				assert.Equal(t, "application/jwt",
+					recorded.Recorder.HeaderMap.Get("Content-Type"))
+				assert.Equal(t, tc.refreshToken,
+					recorded.Recorder.HeaderMap.Get(HdrRefreshToken))
+			}
 		})
 	}
 }
 
-func TestApiV2DevAuthPreauthDevice(t *testing.T) {
+func TestApiDevAuthAuthChallenge(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
-
-	type brokenPreAuthReq struct {
-		IdData string `json:"identity_data"`
-		PubKey string `json:"pubkey"`
+	challenge := &model.AuthChallenge{
+		Nonce:     "Zm9vYmFy",
+		ExpiresIn: 60,
+	}
+	tpmReq := &model.TPMCredentialReq{
+		EKCertificate: "ek",
+		AKPublic:      "ak",
+	}
+	tpmChallenge := &model.AuthChallenge{
+		Nonce:     "Zm9vYmFy",
+		ExpiresIn: 60,
+		TPMCredential: &model.TPMCredential{
+			CredentialBlob:  "blob",
+			EncryptedSecret: "secret",
+		},
 	}
 
 	testCases := map[string]struct {
 		body interface{}
 
-		devAuthErr error
+		req       *model.AuthChallengeReq
+		challenge *model.AuthChallenge
+		err       error
 
-		checker mt.ResponseChecker
+		code     int
+		respBody string
 	}{
 		"ok": {
-			body: &preAuthReq{
-				IdData: map[string]interface{}{
-					"sn": "0001",
-				},
-				PubKey: pubkeyStr,
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusCreated,
-				nil,
-				nil),
-		},
-		"invalid: id data is not json": {
-			body: &brokenPreAuthReq{
-				IdData: `"sn":"0001"`,
-				PubKey: pubkeyStr,
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: json: cannot unmarshal string into Go struct field preAuthReq.identity_data of type map[string]interface {}")),
-		},
-		"invalid: no id data": {
-			body: &preAuthReq{
-				PubKey: pubkeyStr,
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: id_data: non zero value required;")),
-		},
-		"invalid: no pubkey": {
-			body: &preAuthReq{
-				IdData: map[string]interface{}{
-					"sn": "0001",
-				},
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: pubkey: non zero value required;")),
-		},
-		"invalid: no body": {
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: EOF")),
+			req:       &model.AuthChallengeReq{},
+			challenge: challenge,
+			code:      http.StatusOK,
+			respBody:  string(asJSON(challenge)),
 		},
-		"invalid public key": {
-			body: &preAuthReq{
-				IdData: map[string]interface{}{
-					"sn": "0001",
+		"ok, TPM credential": {
+			body: map[string]interface{}{
+				"tpm": map[string]interface{}{
+					"ek_certificate": "ek",
+					"ak_public":      "ak",
 				},
-				PubKey: "invalid",
 			},
-			devAuthErr: devauth.ErrDeviceExists,
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode preauth request: cannot decode public key")),
+			req:       &model.AuthChallengeReq{TPM: tpmReq},
+			challenge: tpmChallenge,
+			code:      http.StatusOK,
+			respBody:  string(asJSON(tpmChallenge)),
 		},
-		"devauth: device exists": {
-			body: &preAuthReq{
-				IdData: map[string]interface{}{
-					"sn": "0001",
+		"error, invalid TPM credential request": {
+			body: map[string]interface{}{
+				"tpm": map[string]interface{}{
+					"ek_certificate": "ek",
 				},
-				PubKey: pubkeyStr,
 			},
-			devAuthErr: devauth.ErrDeviceExists,
-			checker: mt.NewJSONResponse(
-				http.StatusConflict,
-				nil,
-				restError("device already exists")),
+			code:     http.StatusBadRequest,
+			respBody: RestError("invalid request body: tpm.ak_public: is required"),
 		},
-		"devauth: generic error": {
-			body: &preAuthReq{
-				IdData: map[string]interface{}{
-					"sn": "0001",
-				},
-				PubKey: pubkeyStr,
-			},
-			devAuthErr: errors.New("generic"),
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error")),
+		"error, internal": {
+			req:      &model.AuthChallengeReq{},
+			err:      errors.New("failed"),
+			code:     http.StatusInternalServerError,
+			respBody: RestError("internal error"),
 		},
 	}
 
 	for name, tc := range testCases {
-		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
 			da := &mocks.App{}
-			da.On("PreauthorizeDevice",
-				mtest.ContextMatcher(),
-				mock.AnythingOfType("*model.PreAuthReq")).
-				Return(tc.devAuthErr)
+			da.On("NewAuthChallenge",
+				mtest.ContextMatcher(), tc.req).
+				Return(tc.challenge, tc.err)
 
 			apih := makeMockApiHandler(t, da, nil)
 
-			//make request
-			req := makeReq("POST",
-				"http://1.2.3.4/api/management/v2/devauth/devices",
-				"",
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/devices/v1/authentication/auth_requests/challenge",
 				tc.body)
 
-			recorded := test.RunRequest(t, apih, req)
-			mt.CheckResponse(t, tc.checker, recorded)
+			recorded := runTestRequest(t, apih, req, tc.code, tc.respBody)
+			if tc.code == http.StatusOK {
+				assert.Equal(t, "no-store",
+					recorded.Recorder.HeaderMap.Get("Cache-Control"))
+			}
 		})
 	}
 }
 
-func TestApiDevAuthUpdateStatusDevice(t *testing.T) {
+func TestApiDevAuthSubmitAuthReqClientCert(t *testing.T) {
 	t.Parallel()
 
-	devs := map[string]struct {
-		dev *model.Device
-		err error
-	}{
-		"123,456": {
-			dev: &model.Device{
-				Id:     "foo",
-				PubKey: "foobar",
-				Status: "accepted",
-				IdData: "deadcafe",
-			},
-			err: nil,
-		},
-		"234,567": {
-			dev: nil,
-			err: devauth.ErrDevIdAuthIdMismatch,
-		},
-		"345,678": {
-			dev: nil,
-			err: errors.New("processing failed"),
-		},
-		"567,890": {
-			dev: &model.Device{
-				Id:     "foo",
-				PubKey: "foobar",
-				Status: "pending",
-				IdData: "deadcafe",
-			},
-			err: devauth.ErrMaxDeviceCountReached,
-		},
-	}
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
 
-	mockaction := func(_ context.Context, dev_id string, auth_id string) error {
-		d, ok := devs[dev_id+","+auth_id]
-		if ok == false {
-			return store.ErrDevNotFound
-		}
-		if d.err != nil {
-			return d.err
-		}
-		return nil
+	privkey := mtest.LoadPrivKey("testdata/private.pem", t)
+	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
+	cert, _ := mtest.IssueCert("00:01:02:03:04:05", privkey.Public(), nil, privkey, false, t)
+
+	req := makeAuthReq(
+		map[string]interface{}{
+			"id_data": `{"mac":"00:01:02:03:04:05"}`,
+			"pubkey":  pubkeyStr,
+		},
+		privkey,
+		"",
+		t)
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
 	}
+
 	da := &mocks.App{}
-	da.On("AcceptDeviceAuth",
-		mtest.ContextMatcher(),
-		mock.AnythingOfType("string"),
-		mock.AnythingOfType("string")).Return(mockaction)
-	da.On("RejectDeviceAuth",
+	da.On("IssueRefreshToken",
 		mtest.ContextMatcher(),
-		mock.AnythingOfType("string"),
-		mock.AnythingOfType("string")).Return(mockaction)
-	da.On("ResetDeviceAuth",
+		mock.AnythingOfType("string")).
+		Return("", nil)
+	da.On("SubmitAuthRequest",
 		mtest.ContextMatcher(),
-		mock.AnythingOfType("string"),
-		mock.AnythingOfType("string")).Return(mockaction)
+		mock.MatchedBy(func(r *model.AuthReq) bool {
+			return r.ClientCert == cert
+		})).
+		Return("dummytoken", nil)
 
 	apih := makeMockApiHandler(t, da, nil)
+
+	runTestRequest(t, apih, req, http.StatusOK, "dummytoken")
+	da.AssertExpectations(t)
+}
+
+func TestApiDevAuthSubmitAuthReqRefreshToken(t *testing.T) {
+	t.Parallel()
+
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	accstatus := DevAuthApiStatus{"accepted"}
-	rejstatus := DevAuthApiStatus{"rejected"}
-	penstatus := DevAuthApiStatus{"pending"}
+	privkey := mtest.LoadPrivKey("testdata/private.pem", t)
+	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
+
+	payload := map[string]interface{}{
+		"id_data": `{"mac":"00:01:02:03:04:05"}`,
+		"pubkey":  pubkeyStr,
+	}
+
+	testCases := map[string]struct {
+		refreshToken    string
+		refreshTokenErr error
 
-	tcases := []struct {
-		req  *http.Request
 		code int
 		body string
 	}{
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/management/v1/devauth/devices/123/auth/456/status", nil),
-			code: http.StatusBadRequest,
-			body: RestError("failed to decode status data: JSON payload is empty"),
-		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/management/v1/devauth/devices/123/auth/456/status",
-				DevAuthApiStatus{"foo"}),
-			code: http.StatusBadRequest,
-			body: RestError("incorrect device status"),
-		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/management/v1/devauth/devices/123/auth/456/status",
-				accstatus),
-			code: http.StatusNoContent,
-		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/management/v1/devauth/devices/345/auth/678/status",
-				accstatus),
-			code: http.StatusInternalServerError,
-			body: RestError("internal error"),
-		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/management/v1/devauth/devices/999/auth/123/status",
-				accstatus),
-			code: http.StatusNotFound,
-			body: RestError(store.ErrDevNotFound.Error()),
-		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/management/v1/devauth/devices/123/auth/456/status",
-				rejstatus),
-			code: http.StatusNoContent,
-		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/management/v1/devauth/devices/123/auth/456/status",
-				penstatus),
-			code: http.StatusNoContent,
+		"ok": {
+			refreshToken: "refresh",
+			code:         http.StatusOK,
+			body:         "dummytoken",
 		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/management/v1/devauth/devices/234/auth/567/status",
-				penstatus),
-			code: http.StatusBadRequest,
-			body: RestError("dev auth: dev ID and auth ID mismatch"),
+		"ok, refresh tokens disabled": {
+			code: http.StatusOK,
+			body: "dummytoken",
 		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/management/v1/devauth/devices/567/auth/890/status",
-				accstatus),
-			code: http.StatusUnprocessableEntity,
-			body: RestError("maximum number of accepted devices reached"),
+		"error": {
+			refreshTokenErr: errors.New("db failed"),
+			code:            http.StatusInternalServerError,
+			body:            RestError("internal error"),
 		},
 	}
 
-	for idx := range tcases {
-		tc := tcases[idx]
-		t.Run(fmt.Sprintf("tc %d", idx), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
-		})
-	}
-
-}
-
-func TestApiDevAuthDevAdmUpdateAuthSetStatus(t *testing.T) {
+			da := &mocks.App{}
+			da.On("SubmitAuthRequest",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("*model.AuthReq")).
+				Return("dummytoken", nil)
+			da.On("IssueRefreshToken",
+				mtest.ContextMatcher(),
+				"dummytoken").
+				Return(tc.refreshToken, tc.refreshTokenErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			req := makeAuthReq(payload, privkey, "", t)
+			recorded := runTestRequest(t, apih, req, tc.code, tc.body)
+			assert.Equal(t, tc.refreshToken,
+				recorded.Recorder.HeaderMap.Get(HdrRefreshToken))
+		})
+	}
+}
+
+func TestApiDevAuthSubmitAuthReqTimestamp(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := map[string]struct {
-		status interface{}
-		aid    string
+	privkey := mtest.LoadPrivKey("testdata/private.pem", t)
+	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
 
-		dbGetAuthSetRes *model.AuthSet
-		dbGetAuthSetErr error
+	payload := map[string]interface{}{
+		"id_data": `{"mac":"00:01:02:03:04:05"}`,
+		"pubkey":  pubkeyStr,
+	}
+	body, err := json.Marshal(payload)
+	assert.NoError(t, err)
 
-		appAcceptRejectErr error
+	testCases := map[string]struct {
+		timestamp string
+		signed    []byte
 
 		code int
 		body string
 	}{
 		"ok": {
-			status:          &model.Status{Status: model.DevStatusAccepted},
-			aid:             "foo",
-			dbGetAuthSetRes: &model.AuthSet{Id: "foo", DeviceId: "bar"},
-			body:            string(asJSON(&model.Status{Status: "accepted"})),
-			code:            http.StatusOK,
-		},
-		"ok 2": {
-			status:          &model.Status{Status: model.DevStatusRejected},
-			aid:             "foo",
-			dbGetAuthSetRes: &model.AuthSet{Id: "foo", DeviceId: "bar"},
-			body:            string(asJSON(&model.Status{Status: "rejected"})),
-			code:            http.StatusOK,
-		},
-		"error: empty payload": {
-			status: nil,
-			code:   http.StatusBadRequest,
-			body:   RestError("failed to decode status data: JSON payload is empty"),
-		},
-		"error: invalid status": {
-			status: &model.Status{Status: "foo"},
-			code:   http.StatusBadRequest,
-			body:   RestError("incorrect device status"),
+			timestamp: "1700000000",
+			signed:    append([]byte("1700000000\n"), body...),
+			code:      http.StatusOK,
+			body:      "dummytoken",
+		},
+		"error, timestamp not signed": {
+			timestamp: "1700000000",
+			signed:    body,
+			code:      http.StatusUnauthorized,
+			body:      RestError("signature verification failed"),
+		},
+		"error, other timestamp signed": {
+			timestamp: "1700000000",
+			signed:    append([]byte("1700000001\n"), body...),
+			code:      http.StatusUnauthorized,
+			body:      RestError("signature verification failed"),
+		},
+		"error, invalid timestamp": {
+			timestamp: "2023-11-14T22:13:20Z",
+			signed:    append([]byte("2023-11-14T22:13:20Z\n"), body...),
+			code:      http.StatusBadRequest,
+			body:      RestError("invalid request timestamp header"),
 		},
-		"error: get auth set: not found": {
-			status: &model.Status{Status: model.DevStatusAccepted},
-
-			aid:             "foo",
-			dbGetAuthSetErr: store.ErrDevNotFound,
+	}
 
-			body: RestError("authorization set not found"),
-			code: http.StatusNotFound,
-		},
-		"error: get auth set: generic": {
-			status: &model.Status{Status: model.DevStatusRejected},
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-			aid:             "foo",
-			dbGetAuthSetErr: errors.New("some internal error"),
+			req := makeAuthReq(payload, nil,
+				string(mtest.AuthReqSign(tc.signed, privkey, t)), t)
+			req.Header.Set(HdrAuthReqTimestamp, tc.timestamp)
 
-			body: RestError("internal error"),
-			code: http.StatusInternalServerError,
-		},
-		"error: accept: not found": {
-			status: &model.Status{Status: model.DevStatusAccepted},
+			da := &mocks.App{}
+			da.On("IssueRefreshToken",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("string")).
+				Return("", nil)
+			da.On("SubmitAuthRequest",
+				mtest.ContextMatcher(),
+				mock.MatchedBy(func(r *model.AuthReq) bool {
+					return r.Timestamp != nil && r.Timestamp.Unix() == 1700000000
+				})).
+				Return("dummytoken", nil)
 
-			aid:                "foo",
-			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
-			appAcceptRejectErr: store.ErrDevNotFound,
+			apih := makeMockApiHandler(t, da, nil)
 
-			body: RestError("authorization set not found"),
-			code: http.StatusNotFound,
-		},
-		"error: accept: max devices": {
-			status: &model.Status{Status: model.DevStatusAccepted},
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
 
-			aid:                "foo",
-			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
-			appAcceptRejectErr: devauth.ErrMaxDeviceCountReached,
+func TestApiDevAuthSubmitAuthReqSignatureAlg(t *testing.T) {
+	t.Parallel()
 
-			body: RestError("maximum number of accepted devices reached"),
-			code: http.StatusUnprocessableEntity,
-		},
-		"error: accept: generic": {
-			status: &model.Status{Status: model.DevStatusAccepted},
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
 
-			aid:                "foo",
-			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
-			appAcceptRejectErr: errors.New("some internal error"),
+	privkey := mtest.LoadPrivKey("testdata/private.pem", t)
+	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
 
-			body: RestError("internal error"),
-			code: http.StatusInternalServerError,
-		},
-		"error: reject: not found": {
-			status: &model.Status{Status: model.DevStatusRejected},
+	payload := map[string]interface{}{
+		"id_data": `{"mac":"00:01:02:03:04:05"}`,
+		"pubkey":  pubkeyStr,
+	}
 
-			aid:                "foo",
-			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
-			appAcceptRejectErr: store.ErrDevNotFound,
+	testCases := map[string]struct {
+		alg string
 
-			body: RestError("authorization set not found"),
-			code: http.StatusNotFound,
+		code int
+		body string
+	}{
+		"ok, no algorithm": {
+			code: http.StatusOK,
+			body: "dummytoken",
 		},
-		"error: reject: generic": {
-			status: &model.Status{Status: model.DevStatusRejected},
-
-			aid:                "foo",
-			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
-			appAcceptRejectErr: errors.New("some internal error"),
-
-			body: RestError("internal error"),
-			code: http.StatusInternalServerError,
+		"ok": {
+			alg:  "rsa-sha256",
+			code: http.StatusOK,
+			body: "dummytoken",
+		},
+		"error, algorithm does not match the key": {
+			alg:  "ed25519",
+			code: http.StatusUnauthorized,
+			body: RestError("signature verification failed"),
+		},
+		"error, unsupported algorithm": {
+			alg:  "dsa-sha1",
+			code: http.StatusBadRequest,
+			body: RestError("unsupported signature algorithm: dsa-sha1"),
 		},
 	}
 
-	for idx := range tcases {
-		tc := tcases[idx]
-		t.Run(fmt.Sprintf("tc %s", idx), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			req := test.MakeSimpleRequest("PUT",
-				fmt.Sprintf("http://1.2.3.4/api/management/v1/admission/devices/%s/status", tc.aid),
-				tc.status)
+			req := makeAuthReq(payload, privkey, "", t)
+			if tc.alg != "" {
+				req.Header.Set(HdrAuthReqSignAlg, tc.alg)
+			}
 
 			da := &mocks.App{}
-			da.On("AcceptDeviceAuth",
-				mtest.ContextMatcher(),
-				mock.AnythingOfType("string"),
-				tc.aid).Return(tc.appAcceptRejectErr)
-			da.On("RejectDeviceAuth",
+			da.On("IssueRefreshToken",
 				mtest.ContextMatcher(),
-				mock.AnythingOfType("string"),
-				tc.aid).Return(tc.appAcceptRejectErr)
-
-			db := &smocks.DataStore{}
-			db.On("GetAuthSetById",
+				mock.AnythingOfType("string")).
+				Return("", nil)
+			da.On("SubmitAuthRequest",
 				mtest.ContextMatcher(),
-				tc.aid).Return(tc.dbGetAuthSetRes, tc.dbGetAuthSetErr)
+				mock.AnythingOfType("*model.AuthReq")).
+				Return("dummytoken", nil)
 
-			apih := makeMockApiHandler(t, da, db)
+			apih := makeMockApiHandler(t, da, nil)
 
 			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
 }
 
-func TestApiDevAuthDevAdmGetDeviceStatus(t *testing.T) {
+func TestApiDevAuthRotateDeviceKey(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := map[string]struct {
-		aid string
-
-		dbAuthSet *model.AuthSet
-		dbErr     error
-
-		checker mt.ResponseChecker
-	}{
-		"ok": {
-			aid: "foo",
-
-			dbAuthSet: &model.AuthSet{Status: "accepted"},
+	privkey := mtest.LoadPrivKey("testdata/private.pem", t)
+	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
 
-			checker: mt.NewJSONResponse(
-				http.StatusOK,
-				nil,
-				model.Status{Status: "accepted"}),
-		},
-		"error: not found": {
-			aid: "foo",
+	newKey := mtest.LoadECDSAPrivKey("testdata/private_ecdsa_p256.pem", t)
+	newPubkeyStr := mtest.LoadPubKeyStr("testdata/public_ecdsa_p256.pem", t)
 
-			dbErr: store.ErrDevNotFound,
+	payload := map[string]interface{}{
+		"id_data":    `{"mac":"00:01:02:03:04:05"}`,
+		"pubkey":     pubkeyStr,
+		"new_pubkey": newPubkeyStr,
+	}
+	body, err := json.Marshal(payload)
+	assert.NoError(t, err)
 
-			checker: mt.NewJSONResponse(
-				http.StatusNotFound,
-				nil,
-				restError("authorization set not found")),
-		},
-		"error: generic": {
-			aid: "foo",
+	testCases := map[string]struct {
+		payload   interface{}
+		signature string
 
-			dbErr: errors.New("generic error"),
+		devAuthErr error
 
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error")),
+		code int
+		body string
+	}{
+		"ok": {
+			payload:   payload,
+			signature: string(mtest.AuthReqSign(body, privkey, t)),
+			code:      http.StatusNoContent,
+		},
+		"error, signed with new key": {
+			payload:   payload,
+			signature: string(mtest.AuthReqSignECDSA(body, newKey, t)),
+			code:      http.StatusUnauthorized,
+			body:      RestError("signature verification failed"),
+		},
+		"error, no signature": {
+			payload: payload,
+			code:    http.StatusBadRequest,
+			body:    RestError("missing request signature header"),
+		},
+		"error, same key": {
+			payload: map[string]interface{}{
+				"id_data":    `{"mac":"00:01:02:03:04:05"}`,
+				"pubkey":     pubkeyStr,
+				"new_pubkey": pubkeyStr,
+			},
+			code: http.StatusBadRequest,
+			body: RestError("invalid key rotation request: new_pubkey must differ from pubkey"),
+		},
+		"error, new key exists": {
+			payload:    payload,
+			signature:  string(mtest.AuthReqSign(body, privkey, t)),
+			devAuthErr: devauth.ErrDeviceKeyExists,
+			code:       http.StatusConflict,
+			body:       RestError("the device already has an auth set with the new key"),
+		},
+		"error, not accepted": {
+			payload:    payload,
+			signature:  string(mtest.AuthReqSign(body, privkey, t)),
+			devAuthErr: devauth.ErrDevAuthUnauthorized,
+			code:       http.StatusUnauthorized,
+			body:       RestError("dev auth: unauthorized"),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %s", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			req := makeReq("GET",
-				fmt.Sprintf("http://1.2.3.4/api/management/v1/admission/devices/%s/status", tc.aid),
-				"", nil)
-
-			db := &smocks.DataStore{}
-			db.On("GetAuthSetById",
+			da := &mocks.App{}
+			da.On("RotateDeviceKey",
 				mtest.ContextMatcher(),
-				tc.aid).Return(tc.dbAuthSet, tc.dbErr)
+				mock.MatchedBy(func(r *model.KeyRotationReq) bool {
+					return r.NewPubKey == newPubkeyStr
+				})).
+				Return(tc.devAuthErr)
 
-			apih := makeMockApiHandler(t, nil, db)
+			apih := makeMockApiHandler(t, da, nil)
 
-			recorded := test.RunRequest(t, apih, req)
-			mt.CheckResponse(t, tc.checker, recorded)
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/devices/v1/authentication/key_rotation",
+				tc.payload)
+			if tc.signature != "" {
+				req.Header.Set(HdrAuthReqSign, tc.signature)
+			}
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
 }
 
-func TestApiDevAuthVerifyToken(t *testing.T) {
+func TestApiDevAuthPreauthDevice(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := []struct {
-		req     *http.Request
-		code    int
-		body    string
-		headers map[string]string
-		err     error
+	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
+
+	testCases := map[string]struct {
+		body interface{}
+
+		devAuthErr error
+
+		checker mt.ResponseChecker
 	}{
-		{
-			req: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
-			code: http.StatusUnauthorized,
-			body: RestError(ErrNoAuthHeader.Error()),
-			err:  nil,
-		},
-		{
-			req: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
-			code: 200,
-			headers: map[string]string{
-				"authorization": "dummytoken",
+		"ok": {
+			body: &model.PreAuthReq{
+				AuthSetId: "auth-set-id",
+				DeviceId:  "device-id",
+				IdData:    `{"sn":"0001"}`,
+				PubKey:    pubkeyStr,
 			},
-			err: nil,
-		},
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				nil),
+		},
+		"invalid: id data is not json": {
+			body: &model.PreAuthReq{
+				AuthSetId: "auth-set-id",
+				DeviceId:  "device-id",
+				IdData:    `"sn":"0001"`,
+				PubKey:    pubkeyStr,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode preauth request: invalid character ':' after top-level value")),
+		},
+		"invalid: no auth set id": {
+			body: &model.PreAuthReq{
+				DeviceId: "device-id",
+				IdData:   `{"sn":"0001"}`,
+				PubKey:   pubkeyStr,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("invalid request body: auth_set_id: must not be empty")),
+		},
+		"invalid: no device_id": {
+			body: &model.PreAuthReq{
+				AuthSetId: "auth-set-id",
+				IdData:    `{"sn":"0001"}`,
+				PubKey:    pubkeyStr,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("invalid request body: device_id: must not be empty")),
+		},
+		"invalid: no id data": {
+			body: &model.PreAuthReq{
+				AuthSetId: "auth-set-id",
+				DeviceId:  "device-id",
+				PubKey:    pubkeyStr,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("invalid request body: id_data: must not be empty")),
+		},
+		"invalid: no pubkey": {
+			body: &model.PreAuthReq{
+				AuthSetId: "auth-set-id",
+				DeviceId:  "device-id",
+				IdData:    `{"sn":"0001"}`,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("invalid request body: pubkey: must not be empty")),
+		},
+		"invalid: no body": {
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode preauth request: EOF")),
+		},
+		"invalid public key": {
+			body: &model.PreAuthReq{
+				AuthSetId: "auth-set-id",
+				DeviceId:  "device-id",
+				IdData:    `{"sn":"0001"}`,
+				PubKey:    "invalid",
+			},
+			devAuthErr: devauth.ErrDeviceExists,
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode preauth request: cannot decode public key")),
+		},
+		"devauth: device exists": {
+			body: &model.PreAuthReq{
+				AuthSetId: "auth-set-id",
+				DeviceId:  "device-id",
+				IdData:    `{"sn":"0001"}`,
+				PubKey:    pubkeyStr,
+			},
+			devAuthErr: devauth.ErrDeviceExists,
+			checker: mt.NewJSONResponse(
+				http.StatusConflict,
+				nil,
+				restError("device already exists")),
+		},
+		"devauth: generic error": {
+			body: &model.PreAuthReq{
+				AuthSetId: "auth-set-id",
+				DeviceId:  "device-id",
+				IdData:    `{"sn":"0001"}`,
+				PubKey:    pubkeyStr,
+			},
+			devAuthErr: errors.New("generic"),
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			da := &mocks.App{}
+			da.On("PreauthorizeDevice",
+				mtest.ContextMatcher(),
+				tc.body).
+				Return(tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			//make request
+			req := makeReq("POST",
+				"http://1.2.3.4/api/management/v1/devauth/devices",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, apih, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestApiV2DevAuthPreauthDevice(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
+
+	type brokenPreAuthReq struct {
+		IdData string `json:"identity_data"`
+		PubKey string `json:"pubkey"`
+	}
+
+	testCases := map[string]struct {
+		body interface{}
+
+		devAuthErr error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: &preAuthReq{
+				IdData: map[string]interface{}{
+					"sn": "0001",
+				},
+				PubKey: pubkeyStr,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				nil),
+		},
+		"invalid: id data is not json": {
+			body: &brokenPreAuthReq{
+				IdData: `"sn":"0001"`,
+				PubKey: pubkeyStr,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("invalid request body: identity_data: must be of type object")),
+		},
+		"invalid: no id data": {
+			body: &preAuthReq{
+				PubKey: pubkeyStr,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("invalid request body: identity_data: is required")),
+		},
+		"invalid: no pubkey": {
+			body: &preAuthReq{
+				IdData: map[string]interface{}{
+					"sn": "0001",
+				},
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("invalid request body: pubkey: must not be empty")),
+		},
+		"invalid: no body": {
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode preauth request: EOF")),
+		},
+		"invalid public key": {
+			body: &preAuthReq{
+				IdData: map[string]interface{}{
+					"sn": "0001",
+				},
+				PubKey: "invalid",
+			},
+			devAuthErr: devauth.ErrDeviceExists,
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode preauth request: cannot decode public key")),
+		},
+		"devauth: device exists": {
+			body: &preAuthReq{
+				IdData: map[string]interface{}{
+					"sn": "0001",
+				},
+				PubKey: pubkeyStr,
+			},
+			devAuthErr: devauth.ErrDeviceExists,
+			checker: mt.NewJSONResponse(
+				http.StatusConflict,
+				nil,
+				restError("device already exists")),
+		},
+		"devauth: generic error": {
+			body: &preAuthReq{
+				IdData: map[string]interface{}{
+					"sn": "0001",
+				},
+				PubKey: pubkeyStr,
+			},
+			devAuthErr: errors.New("generic"),
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			da := &mocks.App{}
+			da.On("PreauthorizeDevice",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("*model.PreAuthReq")).
+				Return(tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			//make request
+			req := makeReq("POST",
+				"http://1.2.3.4/api/management/v2/devauth/devices",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, apih, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestApiDevAuthUpdateStatusDevice(t *testing.T) {
+	t.Parallel()
+
+	devs := map[string]struct {
+		dev *model.Device
+		err error
+	}{
+		"123,456": {
+			dev: &model.Device{
+				Id:     "foo",
+				PubKey: "foobar",
+				Status: "accepted",
+				IdData: "deadcafe",
+			},
+			err: nil,
+		},
+		"234,567": {
+			dev: nil,
+			err: devauth.ErrDevIdAuthIdMismatch,
+		},
+		"345,678": {
+			dev: nil,
+			err: errors.New("processing failed"),
+		},
+		"567,890": {
+			dev: &model.Device{
+				Id:     "foo",
+				PubKey: "foobar",
+				Status: "pending",
+				IdData: "deadcafe",
+			},
+			err: devauth.ErrMaxDeviceCountReached,
+		},
+		"456,789": {
+			dev: nil,
+			err: devauth.ErrAuthSetNotPending,
+		},
+	}
+
+	mockaction := func(_ context.Context, dev_id string, auth_id string) error {
+		d, ok := devs[dev_id+","+auth_id]
+		if ok == false {
+			return store.ErrDevNotFound
+		}
+		if d.err != nil {
+			return d.err
+		}
+		return nil
+	}
+	da := &mocks.App{}
+	da.On("AcceptDeviceAuth",
+		mtest.ContextMatcher(),
+		mock.AnythingOfType("string"),
+		mock.AnythingOfType("string")).Return(mockaction)
+	da.On("RejectDeviceAuth",
+		mtest.ContextMatcher(),
+		mock.AnythingOfType("string"),
+		mock.AnythingOfType("string")).Return(mockaction)
+	da.On("ResetDeviceAuth",
+		mtest.ContextMatcher(),
+		mock.AnythingOfType("string"),
+		mock.AnythingOfType("string")).Return(mockaction)
+	da.On("DismissDeviceAuth",
+		mtest.ContextMatcher(),
+		mock.AnythingOfType("string"),
+		mock.AnythingOfType("string")).Return(mockaction)
+
+	apih := makeMockApiHandler(t, da, nil)
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	accstatus := DevAuthApiStatus{"accepted"}
+	rejstatus := DevAuthApiStatus{"rejected"}
+	penstatus := DevAuthApiStatus{"pending"}
+	disstatus := DevAuthApiStatus{"dismissed"}
+
+	tcases := []struct {
+		req  *http.Request
+		code int
+		body string
+	}{
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/devauth/devices/123/auth/456/status", nil),
+			code: http.StatusBadRequest,
+			body: RestError("failed to decode status data: JSON payload is empty"),
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/devauth/devices/123/auth/456/status",
+				DevAuthApiStatus{"foo"}),
+			code: http.StatusBadRequest,
+			body: RestError("invalid request body: status: must be one of: accepted, rejected, pending, dismissed"),
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/devauth/devices/123/auth/456/status",
+				accstatus),
+			code: http.StatusNoContent,
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/devauth/devices/345/auth/678/status",
+				accstatus),
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/devauth/devices/999/auth/123/status",
+				accstatus),
+			code: http.StatusNotFound,
+			body: RestError(store.ErrDevNotFound.Error()),
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/devauth/devices/123/auth/456/status",
+				rejstatus),
+			code: http.StatusNoContent,
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/devauth/devices/123/auth/456/status",
+				penstatus),
+			code: http.StatusNoContent,
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/devauth/devices/234/auth/567/status",
+				penstatus),
+			code: http.StatusBadRequest,
+			body: RestError("dev auth: dev ID and auth ID mismatch"),
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/devauth/devices/567/auth/890/status",
+				accstatus),
+			code: http.StatusUnprocessableEntity,
+			body: RestError("maximum number of accepted devices reached"),
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v2/devauth/devices/123/auth/456/status",
+				disstatus),
+			code: http.StatusNoContent,
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v2/devauth/devices/456/auth/789/status",
+				disstatus),
+			code: http.StatusConflict,
+			body: RestError("only pending auth sets can be dismissed"),
+		},
+	}
+
+	for idx := range tcases {
+		tc := tcases[idx]
+		t.Run(fmt.Sprintf("tc %d", idx), func(t *testing.T) {
+			t.Parallel()
+
+			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+		})
+	}
+
+}
+
+func TestApiDevAuthIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	const (
+		path = "/api/management/v2/devauth/devices/123/auth/456/status"
+		body = `{"status":"accepted"}`
+	)
+	sum := sha256.Sum256([]byte("PUT " + path + "\n" + body))
+
+	isKey := mock.MatchedBy(func(r model.IdempotencyRecord) bool {
+		return r.Key == "key1" && bytes.Equal(r.RequestSha256, sum[:])
+	})
+
+	tcases := map[string]struct {
+		key string
+
+		setup func(da *mocks.App, db *smocks.DataStore)
+
+		code     int
+		body     string
+		replayed bool
+	}{
+		"no key": {
+			setup: func(da *mocks.App, db *smocks.DataStore) {
+				da.On("AcceptDeviceAuth",
+					mtest.ContextMatcher(), "123", "456").
+					Return(nil)
+			},
+			code: http.StatusNoContent,
+		},
+		"new key": {
+			key: "key1",
+			setup: func(da *mocks.App, db *smocks.DataStore) {
+				db.On("AddIdempotencyRecord",
+					mtest.ContextMatcher(), isKey).
+					Return(nil)
+				da.On("AcceptDeviceAuth",
+					mtest.ContextMatcher(), "123", "456").
+					Return(nil)
+				db.On("SetIdempotencyResponse",
+					mtest.ContextMatcher(), "key1",
+					mock.MatchedBy(func(r model.IdempotencyResponse) bool {
+						return r.Status == http.StatusNoContent &&
+							len(r.Body) == 0
+					})).
+					Return(nil)
+			},
+			code: http.StatusNoContent,
+		},
+		"new key, error recorded": {
+			key: "key1",
+			setup: func(da *mocks.App, db *smocks.DataStore) {
+				db.On("AddIdempotencyRecord",
+					mtest.ContextMatcher(), isKey).
+					Return(nil)
+				da.On("AcceptDeviceAuth",
+					mtest.ContextMatcher(), "123", "456").
+					Return(devauth.ErrMaxDeviceCountReached)
+				db.On("SetIdempotencyResponse",
+					mtest.ContextMatcher(), "key1",
+					mock.MatchedBy(func(r model.IdempotencyResponse) bool {
+						return r.Status == http.StatusUnprocessableEntity &&
+							string(r.Body) == RestError("maximum number of accepted devices reached")
+					})).
+					Return(nil)
+			},
+			code: http.StatusUnprocessableEntity,
+			body: RestError("maximum number of accepted devices reached"),
+		},
+		"new key, server error frees the key": {
+			key: "key1",
+			setup: func(da *mocks.App, db *smocks.DataStore) {
+				db.On("AddIdempotencyRecord",
+					mtest.ContextMatcher(), isKey).
+					Return(nil)
+				da.On("AcceptDeviceAuth",
+					mtest.ContextMatcher(), "123", "456").
+					Return(errors.New("db failed"))
+				db.On("DeleteIdempotencyRecord",
+					mtest.ContextMatcher(), "key1").
+					Return(nil)
+			},
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+		"retry, replayed": {
+			key: "key1",
+			setup: func(da *mocks.App, db *smocks.DataStore) {
+				db.On("AddIdempotencyRecord",
+					mtest.ContextMatcher(), isKey).
+					Return(store.ErrObjectExists)
+				db.On("GetIdempotencyRecord",
+					mtest.ContextMatcher(), "key1").
+					Return(&model.IdempotencyRecord{
+						Key:           "key1",
+						RequestSha256: sum[:],
+						Response: &model.IdempotencyResponse{
+							Status: http.StatusNoContent,
+						},
+					}, nil)
+			},
+			code:     http.StatusNoContent,
+			replayed: true,
+		},
+		"retry, still in progress": {
+			key: "key1",
+			setup: func(da *mocks.App, db *smocks.DataStore) {
+				db.On("AddIdempotencyRecord",
+					mtest.ContextMatcher(), isKey).
+					Return(store.ErrObjectExists)
+				db.On("GetIdempotencyRecord",
+					mtest.ContextMatcher(), "key1").
+					Return(&model.IdempotencyRecord{
+						Key:           "key1",
+						RequestSha256: sum[:],
+					}, nil)
+			},
+			code: http.StatusConflict,
+			body: RestError("a request with the idempotency key is still in progress"),
+		},
+		"key reused for another request": {
+			key: "key1",
+			setup: func(da *mocks.App, db *smocks.DataStore) {
+				db.On("AddIdempotencyRecord",
+					mtest.ContextMatcher(), isKey).
+					Return(store.ErrObjectExists)
+				db.On("GetIdempotencyRecord",
+					mtest.ContextMatcher(), "key1").
+					Return(&model.IdempotencyRecord{
+						Key:           "key1",
+						RequestSha256: []byte("other"),
+						Response: &model.IdempotencyResponse{
+							Status: http.StatusNoContent,
+						},
+					}, nil)
+			},
+			code: http.StatusUnprocessableEntity,
+			body: RestError("idempotency key already used for a different request"),
+		},
+		"key too long": {
+			key:   strings.Repeat("k", 256),
+			setup: func(da *mocks.App, db *smocks.DataStore) {},
+			code:  http.StatusBadRequest,
+			body:  RestError("idempotency key must not be longer than 255 characters"),
+		},
+		"db error": {
+			key: "key1",
+			setup: func(da *mocks.App, db *smocks.DataStore) {
+				db.On("AddIdempotencyRecord",
+					mtest.ContextMatcher(), isKey).
+					Return(errors.New("db failed"))
+			},
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+	}
+
+	for name, tc := range tcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			db := &smocks.DataStore{}
+			tc.setup(da, db)
+
+			apih := makeMockApiHandler(t, da, db)
+
+			req, _ := http.NewRequest("PUT", "http://1.2.3.4"+path,
+				strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.key != "" {
+				req.Header.Set("Idempotency-Key", tc.key)
+			}
+
+			rec := runTestRequest(t, apih, req, tc.code, tc.body)
+			if tc.replayed {
+				rec.HeaderIs("Idempotent-Replayed", "true")
+			} else {
+				rec.HeaderIs("Idempotent-Replayed", "")
+			}
+
+			da.AssertExpectations(t)
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestApiDevAuthDevAdmUpdateAuthSetStatus(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := map[string]struct {
+		status interface{}
+		aid    string
+
+		dbGetAuthSetRes *model.AuthSet
+		dbGetAuthSetErr error
+
+		appAcceptRejectErr error
+
+		code int
+		body string
+	}{
+		"ok": {
+			status:          &model.Status{Status: model.DevStatusAccepted},
+			aid:             "foo",
+			dbGetAuthSetRes: &model.AuthSet{Id: "foo", DeviceId: "bar"},
+			body:            string(asJSON(&model.Status{Status: "accepted"})),
+			code:            http.StatusOK,
+		},
+		"ok 2": {
+			status:          &model.Status{Status: model.DevStatusRejected},
+			aid:             "foo",
+			dbGetAuthSetRes: &model.AuthSet{Id: "foo", DeviceId: "bar"},
+			body:            string(asJSON(&model.Status{Status: "rejected"})),
+			code:            http.StatusOK,
+		},
+		"error: empty payload": {
+			status: nil,
+			code:   http.StatusBadRequest,
+			body:   RestError("failed to decode status data: JSON payload is empty"),
+		},
+		"error: invalid status": {
+			status: &model.Status{Status: "foo"},
+			code:   http.StatusBadRequest,
+			body:   RestError("invalid request body: status: must be one of: accepted, rejected"),
+		},
+		"error: get auth set: not found": {
+			status: &model.Status{Status: model.DevStatusAccepted},
+
+			aid:             "foo",
+			dbGetAuthSetErr: store.ErrDevNotFound,
+
+			body: RestError("authorization set not found"),
+			code: http.StatusNotFound,
+		},
+		"error: get auth set: generic": {
+			status: &model.Status{Status: model.DevStatusRejected},
+
+			aid:             "foo",
+			dbGetAuthSetErr: errors.New("some internal error"),
+
+			body: RestError("internal error"),
+			code: http.StatusInternalServerError,
+		},
+		"error: accept: not found": {
+			status: &model.Status{Status: model.DevStatusAccepted},
+
+			aid:                "foo",
+			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
+			appAcceptRejectErr: store.ErrDevNotFound,
+
+			body: RestError("authorization set not found"),
+			code: http.StatusNotFound,
+		},
+		"error: accept: max devices": {
+			status: &model.Status{Status: model.DevStatusAccepted},
+
+			aid:                "foo",
+			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
+			appAcceptRejectErr: devauth.ErrMaxDeviceCountReached,
+
+			body: RestError("maximum number of accepted devices reached"),
+			code: http.StatusUnprocessableEntity,
+		},
+		"error: accept: quarantined": {
+			status: &model.Status{Status: model.DevStatusAccepted},
+
+			aid:                "foo",
+			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
+			appAcceptRejectErr: devauth.ErrDeviceQuarantined,
+
+			body: RestError("device is quarantined"),
+			code: http.StatusForbidden,
+		},
+		"error: accept: generic": {
+			status: &model.Status{Status: model.DevStatusAccepted},
+
+			aid:                "foo",
+			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
+			appAcceptRejectErr: errors.New("some internal error"),
+
+			body: RestError("internal error"),
+			code: http.StatusInternalServerError,
+		},
+		"error: reject: not found": {
+			status: &model.Status{Status: model.DevStatusRejected},
+
+			aid:                "foo",
+			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
+			appAcceptRejectErr: store.ErrDevNotFound,
+
+			body: RestError("authorization set not found"),
+			code: http.StatusNotFound,
+		},
+		"error: reject: generic": {
+			status: &model.Status{Status: model.DevStatusRejected},
+
+			aid:                "foo",
+			dbGetAuthSetRes:    &model.AuthSet{Id: "foo", DeviceId: "dev-foo"},
+			appAcceptRejectErr: errors.New("some internal error"),
+
+			body: RestError("internal error"),
+			code: http.StatusInternalServerError,
+		},
+	}
+
+	for idx := range tcases {
+		tc := tcases[idx]
+		t.Run(fmt.Sprintf("tc %s", idx), func(t *testing.T) {
+			t.Parallel()
+
+			req := test.MakeSimpleRequest("PUT",
+				fmt.Sprintf("http://1.2.3.4/api/management/v1/admission/devices/%s/status", tc.aid),
+				tc.status)
+
+			da := &mocks.App{}
+			da.On("AcceptDeviceAuth",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("string"),
+				tc.aid).Return(tc.appAcceptRejectErr)
+			da.On("RejectDeviceAuth",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("string"),
+				tc.aid).Return(tc.appAcceptRejectErr)
+
+			db := &smocks.DataStore{}
+			db.On("GetAuthSetById",
+				mtest.ContextMatcher(),
+				tc.aid).Return(tc.dbGetAuthSetRes, tc.dbGetAuthSetErr)
+
+			apih := makeMockApiHandler(t, da, db)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthDevAdmGetDeviceStatus(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := map[string]struct {
+		aid string
+
+		dbAuthSet *model.AuthSet
+		dbErr     error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			aid: "foo",
+
+			dbAuthSet: &model.AuthSet{Status: "accepted"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				model.Status{Status: "accepted"}),
+		},
+		"error: not found": {
+			aid: "foo",
+
+			dbErr: store.ErrDevNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError("authorization set not found")),
+		},
+		"error: generic": {
+			aid: "foo",
+
+			dbErr: errors.New("generic error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %s", i), func(t *testing.T) {
+			t.Parallel()
+
+			req := makeReq("GET",
+				fmt.Sprintf("http://1.2.3.4/api/management/v1/admission/devices/%s/status", tc.aid),
+				"", nil)
+
+			db := &smocks.DataStore{}
+			db.On("GetAuthSetById",
+				mtest.ContextMatcher(),
+				tc.aid).Return(tc.dbAuthSet, tc.dbErr)
+
+			apih := makeMockApiHandler(t, nil, db)
+
+			recorded := test.RunRequest(t, apih, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestApiDevAuthVerifyToken(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := []struct {
+		req     *http.Request
+		code    int
+		body    string
+		headers map[string]string
+		err     error
+	}{
+		{
+			req: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
+			code: http.StatusUnauthorized,
+			body: RestError(ErrNoAuthHeader.Error()),
+			err:  nil,
+		},
+		{
+			req: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
+			code: 200,
+			headers: map[string]string{
+				"authorization": "dummytoken",
+			},
+			err: nil,
+		},
+		{
+			req: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
+			code: http.StatusForbidden,
+			headers: map[string]string{
+				"authorization": "dummytoken",
+			},
+			err: jwt.ErrTokenExpired,
+		},
+		{
+			req: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
+			code: http.StatusAccepted,
+			headers: map[string]string{
+				"authorization": "dummytoken",
+			},
+			err: devauth.ErrTokenExpiryGrace,
+		},
+		{
+			req: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
+			code: http.StatusUnauthorized,
+			headers: map[string]string{
+				"authorization": "dummytoken",
+			},
+			err: jwt.ErrTokenInvalid,
+		},
+		{
+			req: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
+			code: 500,
+			body: RestError("internal error"),
+			headers: map[string]string{
+				"authorization": "dummytoken",
+			},
+			err: errors.New("some error that will only be logged"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("VerifyToken",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("string")).
+				Return(tc.err)
+
+			apih := makeMockApiHandler(t, da, nil)
+			if len(tc.headers) > 0 {
+				tc.req.Header.Set("authorization", tc.headers["authorization"])
+			}
+			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+		})
+	}
+
+}
+
+func TestApiDevAuthVerifyTokenClaims(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	claims := &model.TokenIntrospection{
+		Active:    true,
+		TokenType: model.TokenTypeBearer,
+		ExpiresAt: 1700000000,
+		Subject:   "dev-1",
+		ID:        "jti-1",
+		DeviceId:  "dev-1",
+		Tenant:    "tenant-1",
+		Status:    model.DevStatusAccepted,
+	}
+
+	tcases := map[string]struct {
+		query string
+
+		verifyErr     error
+		claims        *model.TokenIntrospection
+		introspectErr error
+
+		code int
+		body string
+	}{
+		"ok": {
+			query:  "?claims=true",
+			claims: claims,
+			code:   http.StatusOK,
+			body:   string(asJSON(claims)),
+		},
+		"ok, claims not requested": {
+			query: "?claims=false",
+			code:  http.StatusOK,
+		},
+		"error, bad claims parameter": {
+			query: "?claims=foo",
+			code:  http.StatusBadRequest,
+			body:  RestError("claims must be a boolean"),
+		},
+		"error, token expired": {
+			query:     "?claims=true",
+			verifyErr: jwt.ErrTokenExpired,
+			code:      http.StatusForbidden,
+		},
+		"error, token inactive": {
+			query:  "?claims=true",
+			claims: &model.TokenIntrospection{Active: false},
+			code:   http.StatusUnauthorized,
+		},
+		"error, introspection": {
+			query:         "?claims=true",
+			introspectErr: errors.New("db failed"),
+			code:          http.StatusInternalServerError,
+			body:          RestError("internal error"),
+		},
+	}
+
+	for name, tc := range tcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("VerifyToken",
+				mtest.ContextMatcher(),
+				"dummytoken").
+				Return(tc.verifyErr)
+			da.On("IntrospectToken",
+				mtest.ContextMatcher(),
+				"dummytoken").
+				Return(tc.claims, tc.introspectErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify"+tc.query, nil)
+			req.Header.Set("Authorization", "Bearer dummytoken")
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthDeleteToken(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := []struct {
+		req  *http.Request
+		code int
+		body string
+		err  error
+	}{
+		{
+			req: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/tokens/foo", nil),
+			code: http.StatusNoContent,
+			err:  nil,
+		},
+		{
+			req: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/tokens/foo", nil),
+			code: http.StatusNotFound,
+			err:  store.ErrTokenNotFound,
+		},
+		{
+			req: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/tokens/foo", nil),
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+			err:  errors.New("some error that will only be logged"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("RevokeToken",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("string")).
+				Return(tc.err)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+		})
+	}
+
+}
+
+func TestApiDevAuthDeleteDeviceTokens(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := map[string]struct {
+		err  error
+		code int
+		body string
+	}{
+		"ok": {
+			code: http.StatusNoContent,
+		},
+		"device not found": {
+			err:  store.ErrDevNotFound,
+			code: http.StatusNotFound,
+			body: RestError(store.ErrDevNotFound.Error()),
+		},
+		"error": {
+			err:  errors.New("some error that will only be logged"),
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+	}
+
+	for name, tc := range tcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("RevokeDeviceTokens",
+				mtest.ContextMatcher(), "foo").
+				Return(tc.err)
+
+			req := test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/devices/foo/tokens", nil)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, req, tc.code, tc.body)
+			da.AssertExpectations(t)
+		})
+	}
+}
+
+func TestApiGetDevice(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	dev := &model.Device{
+		Id:     "foo",
+		PubKey: "pubkey",
+		Status: model.DevStatusPending,
+	}
+	tcases := []struct {
+		req    *http.Request
+		code   int
+		body   string
+		device *model.Device
+		err    error
+	}{
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/devices/foo", nil),
+			code:   http.StatusOK,
+			device: dev,
+			err:    nil,
+			body:   string(asJSON(dev)),
+		},
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/devices/bar", nil),
+			code: http.StatusNotFound,
+			err:  store.ErrDevNotFound,
+			body: RestError("device not found"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("GetDevice",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("string")).
+				Return(tc.device, tc.err)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiGetDeviceV2(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	dev := &model.Device{
+		Id:     "foo",
+		IdData: `{"mac": "00:00:00:01"}`,
+		IdDataStruct: map[string]interface{}{
+			"mac": "00:00:00:01",
+		},
+		PubKey: "pubkey",
+		Status: model.DevStatusPending,
+		AuthSets: []model.AuthSet{
+			model.AuthSet{
+				Id:       "1",
+				DeviceId: "foo",
+				IdData:   `{"mac": "00:00:00:01"}`,
+				IdDataStruct: map[string]interface{}{
+					"mac": "00:00:00:01",
+				},
+			},
+		},
+	}
+
+	apiDev, _ := deviceV2FromDbModel(dev)
+
+	tcases := []struct {
+		req *http.Request
+
+		device *model.Device
+		err    error
+
+		code int
+		body string
+	}{
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices/foo", nil),
+			device: dev,
+			err:    nil,
+
+			code: http.StatusOK,
+			body: string(asJSON(apiDev)),
+		},
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices/bar", nil),
+			device: nil,
+			err:    store.ErrDevNotFound,
+
+			code: http.StatusNotFound,
+			body: RestError("device not found"),
+		},
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices/bar", nil),
+			device: nil,
+			err:    errors.New("generic error"),
+
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("GetDevice",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("string")).
+				Return(tc.device, tc.err)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiGetDeviceETag(t *testing.T) {
+	t.Parallel()
+
+	dev := &model.Device{
+		Id:     "foo",
+		PubKey: "pubkey",
+		Status: model.DevStatusPending,
+	}
+	devs := []model.Device{*dev}
+
+	da := &mocks.App{}
+	da.On("GetDevice",
+		mtest.ContextMatcher(),
+		"foo").
+		Return(dev, nil)
+	da.On("GetDevices",
+		mtest.ContextMatcher(),
+		mock.AnythingOfType("uint"),
+		mock.AnythingOfType("uint"),
+		mock.AnythingOfType("store.DeviceFilter")).
+		Return(devs, nil)
+	da.On("CountDevices",
+		mtest.ContextMatcher(),
+		mock.AnythingOfType("store.DeviceFilter")).
+		Return(1, nil)
+
+	apiDev, _ := deviceV2FromDbModel(dev)
+	apiDevs, _ := devicesV2FromDbModel(devs)
+
+	tcases := map[string]struct {
+		url  string
+		body string
+	}{
+		"device": {
+			url:  "http://1.2.3.4/api/management/v2/devauth/devices/foo",
+			body: string(asJSON(apiDev)),
+		},
+		"devices": {
+			url:  "http://1.2.3.4/api/management/v2/devauth/devices",
+			body: string(asJSON(apiDevs)),
+		},
+		"devices v1": {
+			url:  "http://1.2.3.4/api/management/v1/devauth/devices",
+			body: string(asJSON(devs)),
+		},
+	}
+
+	for name, tc := range tcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("GET", tc.url, nil)
+			rec := runTestRequest(t, apih, req, http.StatusOK, tc.body)
+			etag := rec.Recorder.HeaderMap.Get("ETag")
+			assert.Regexp(t, `^"[0-9a-f]{64}"$`, etag)
+
+			// same representation, same tag
+			req = test.MakeSimpleRequest("GET", tc.url, nil)
+			rec = runTestRequest(t, apih, req, http.StatusOK, tc.body)
+			rec.HeaderIs("ETag", etag)
+
+			req = test.MakeSimpleRequest("GET", tc.url, nil)
+			req.Header.Set("If-None-Match", `"bogus", W/`+etag)
+			rec = runTestRequest(t, apih, req, http.StatusNotModified, "")
+			rec.HeaderIs("ETag", etag)
+
+			req = test.MakeSimpleRequest("GET", tc.url, nil)
+			req.Header.Set("If-None-Match", `"bogus"`)
+			runTestRequest(t, apih, req, http.StatusOK, tc.body)
+		})
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	t.Parallel()
+
+	tcases := map[string]struct {
+		header string
+		match  bool
+	}{
+		"no header": {},
+		"match": {
+			header: `"foo"`,
+			match:  true,
+		},
+		"weak match": {
+			header: `W/"foo"`,
+			match:  true,
+		},
+		"list": {
+			header: `"bar", "foo"`,
+			match:  true,
+		},
+		"any": {
+			header: `*`,
+			match:  true,
+		},
+		"mismatch": {
+			header: `"bar", "baz"`,
+		},
+		"unquoted": {
+			header: `foo`,
+		},
+	}
+
+	for name, tc := range tcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.match, etagMatch(tc.header, `"foo"`))
+		})
+	}
+}
+
+func TestApiGetDevicesV2(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	devs := []model.Device{
+		{
+			Id:     "id1",
+			PubKey: "pubkey",
+			Status: model.DevStatusPending,
+		},
+		{
+			Id:     "id2",
+			PubKey: "pubkey2",
+			Status: model.DevStatusRejected,
+		},
+		{
+			Id:     "id3",
+			PubKey: "pubkey3",
+			Status: model.DevStatusRejected,
+		},
+		{
+			Id:     "id4",
+			PubKey: "pubkey4",
+			Status: model.DevStatusAccepted,
+		},
+		{
+			Id:     "id5",
+			PubKey: "pubkey5",
+			Status: model.DevStatusPreauth,
+		},
+	}
+
+	outDevs, err := devicesV2FromDbModel(devs)
+	assert.NoError(t, err)
+
+	link := func(page int, rel string) string {
+		return fmt.Sprintf("<http://1.2.3.4/api/management/v2/devauth/devices?"+
+			"page=%d&per_page=2>; rel=\"%s\"", page, rel)
+	}
+
+	tcases := map[string]struct {
+		req      *http.Request
+		code     int
+		body     string
+		devices  []model.Device
+		err      error
+		skip     uint
+		limit    uint
+		filter   store.DeviceFilter
+		total    int
+		countErr error
+		links    []string
+	}{
+		"ok": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices", nil),
+			code:    http.StatusOK,
+			devices: devs,
+			err:     nil,
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			total:   5,
+			body:    string(asJSON(outDevs)),
+		},
+		"no devices": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices", nil),
+			code:    http.StatusOK,
+			devices: []model.Device{},
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			err:     nil,
+			body:    "[]",
+		},
+		// this test does not check if the devices were skipped
+		// it is only checking if endpoint limits number of devices in the response
+		"limit number of devices": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?page=2&per_page=2", nil),
+			devices: devs,
+			skip:    2,
+			limit:   3,
+			total:   7,
+			code:    http.StatusOK,
+			// reqquested 2 devices per page, so expect only 2
+			body: string(asJSON(outDevs[:2])),
+			links: []string{
+				link(1, "prev"),
+				link(3, "next"),
+				link(1, "first"),
+				link(4, "last"),
+			},
+		},
+		"last page": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?page=3&per_page=2", nil),
+			devices: devs[4:],
+			skip:    4,
+			limit:   3,
+			total:   5,
+			code:    http.StatusOK,
+			body:    string(asJSON(outDevs[4:])),
+			links: []string{
+				link(2, "prev"),
+				link(1, "first"),
+				link(3, "last"),
+			},
+		},
+		"no devices, last page is the first one": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?per_page=2", nil),
+			devices: []model.Device{},
+			skip:    0,
+			limit:   3,
+			code:    http.StatusOK,
+			body:    "[]",
+			links: []string{
+				link(1, "first"),
+				link(1, "last"),
+			},
+		},
+		"search": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?status=pending&search=00:11", nil),
+			devices: devs[:1],
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			filter: store.DeviceFilter{
+				Status: model.DevStatusPending,
+				Search: "00:11",
+			},
+			code: http.StatusOK,
+			body: string(asJSON(outDevs[:1])),
+		},
+		"search, exact": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?search=SN0001&search_exact=true", nil),
+			devices: devs[:1],
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			filter: store.DeviceFilter{
+				Search:      "SN0001",
+				SearchExact: true,
+			},
+			code: http.StatusOK,
+			body: string(asJSON(outDevs[:1])),
+		},
+		"group": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?status=pending&group=site-1", nil),
+			devices: devs[:1],
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			filter: store.DeviceFilter{
+				Status: model.DevStatusPending,
+				Group:  "site-1",
+			},
+			code: http.StatusOK,
+			body: string(asJSON(outDevs[:1])),
+		},
+		"time range": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?created_after=2018-10-01T12:00:00Z&created_before=2018-10-02T12:00:00Z&updated_after=2018-10-03T12:00:00Z", nil),
+			devices: devs[:1],
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			filter: store.DeviceFilter{
+				CreatedAfter: uto.TimePtr(
+					time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)),
+				CreatedBefore: uto.TimePtr(
+					time.Date(2018, 10, 2, 12, 0, 0, 0, time.UTC)),
+				UpdatedAfter: uto.TimePtr(
+					time.Date(2018, 10, 3, 12, 0, 0, 0, time.UTC)),
+			},
+			code: http.StatusOK,
+			body: string(asJSON(outDevs[:1])),
+		},
+		"conflict": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?conflict=true", nil),
+			devices: devs[:1],
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			filter: store.DeviceFilter{
+				Conflict: true,
+			},
+			code: http.StatusOK,
+			body: string(asJSON(outDevs[:1])),
+		},
+		"sort": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?status=pending&sort=created_ts:desc", nil),
+			devices: devs[:1],
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			filter: store.DeviceFilter{
+				Status: model.DevStatusPending,
+				Sort: store.DeviceSort{
+					Field: store.DeviceSortCreatedTs,
+					Desc:  true,
+				},
+			},
+			code: http.StatusOK,
+			body: string(asJSON(outDevs[:1])),
+		},
+		"sort, ascending by default": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?sort=status", nil),
+			devices: devs,
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			filter: store.DeviceFilter{
+				Sort: store.DeviceSort{Field: store.DeviceSortStatus},
+			},
+			code: http.StatusOK,
+			body: string(asJSON(outDevs)),
+		},
+		"bad sort field": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?sort=id_data", nil),
+			code: http.StatusBadRequest,
+			body: RestError("sort must be one of: id, created_ts, status, optionally followed by ':asc' or ':desc'"),
+		},
+		"bad sort order": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?sort=id:up", nil),
+			code: http.StatusBadRequest,
+			body: RestError("sort must be one of: id, created_ts, status, optionally followed by ':asc' or ':desc'"),
+		},
+		"bad created_after": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?created_after=yesterday", nil),
+			code: http.StatusBadRequest,
+			body: RestError("created_after must be an RFC3339 timestamp"),
+		},
+		"bad updated_after": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?updated_after=2018-10-01", nil),
+			code: http.StatusBadRequest,
+			body: RestError("updated_after must be an RFC3339 timestamp"),
+		},
+		"bad conflict": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?conflict=maybe", nil),
+			code: http.StatusBadRequest,
+			body: RestError(rest_utils.MsgQueryParmInvalid("conflict")),
+		},
+		"bad search_exact": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?search=SN0001&search_exact=maybe", nil),
+			code: http.StatusBadRequest,
+			body: RestError(rest_utils.MsgQueryParmInvalid("search_exact")),
+		},
+		"internal error": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?page=2&per_page=2", nil),
+			skip:  2,
+			limit: 3,
+			code:  http.StatusInternalServerError,
+			err:   errors.New("failed"),
+			body:  RestError("internal error"),
+		},
+		"internal error, count": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices?page=2&per_page=2", nil),
+			devices:  devs,
+			skip:     2,
+			limit:    3,
+			countErr: errors.New("failed"),
+			code:     http.StatusInternalServerError,
+			body:     RestError("internal error"),
+		},
+	}
+
+	for name := range tcases {
+		tc := tcases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("GetDevices",
+				mtest.ContextMatcher(),
+				tc.skip, tc.limit, tc.filter).Return(
+				tc.devices, tc.err)
+			da.On("CountDevices",
+				mtest.ContextMatcher(),
+				tc.filter).Return(
+				tc.total, tc.countErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+			recorded := runTestRequest(t, apih, tc.req, tc.code, tc.body)
+			if tc.code == http.StatusOK {
+				assert.Equal(t, strconv.Itoa(tc.total),
+					recorded.Recorder.Header().Get("X-Total-Count"))
+			}
+			if tc.links != nil {
+				assert.Equal(t, tc.links, recorded.Recorder.Header()["Link"])
+			}
+		})
+	}
+}
+
+func TestApiGetDevicesV2Cursor(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	devs := []model.Device{
+		{
+			Id:        "id3",
+			Status:    model.DevStatusPending,
+			CreatedTs: ts.Add(time.Hour),
+		},
+		{
+			Id:        "id1",
+			Status:    model.DevStatusPending,
+			CreatedTs: ts.Add(time.Minute),
+		},
+		{
+			Id:        "id2",
+			Status:    model.DevStatusPending,
+			CreatedTs: ts,
+		},
+	}
+
+	outDevs, err := devicesV2FromDbModel(devs)
+	assert.NoError(t, err)
+
+	sort := store.DeviceSort{Field: store.DeviceSortCreatedTs, Desc: true}
+	after := sort.Cursor(&devs[0])
+	next := sort.Cursor(&devs[1])
+
+	link := func(after, rel string) string {
+		return fmt.Sprintf("<http://1.2.3.4/api/management/v2/devauth/devices?"+
+			"after=%s&per_page=2&sort=created_ts%%3Adesc>; rel=\"%s\"", after, rel)
+	}
+
+	tcases := map[string]struct {
+		query string
+
+		filter  *store.DeviceFilter
+		devices []model.Device
+		err     error
+
+		code  int
+		body  string
+		links []string
+	}{
+		"first page": {
+			query: "?sort=created_ts:desc&after=&per_page=2",
+			filter: &store.DeviceFilter{
+				Sort: sort,
+			},
+			devices: devs,
+			code:    http.StatusOK,
+			body:    string(asJSON(outDevs[:2])),
+			links: []string{
+				link(next.Encode(), "next"),
+				link("", "first"),
+			},
+		},
+		"last page": {
+			query: "?sort=created_ts:desc&after=" + after.Encode() + "&per_page=2",
+			filter: &store.DeviceFilter{
+				Sort:  sort,
+				After: after,
+			},
+			devices: devs[1:],
+			code:    http.StatusOK,
+			body:    string(asJSON(outDevs[1:])),
+			links: []string{
+				link("", "first"),
+			},
+		},
+		"error, page along with cursor": {
+			query: "?after=&page=2",
+			code:  http.StatusBadRequest,
+			body:  RestError("page can't be used along with after"),
+		},
+		"error, invalid cursor": {
+			query: "?after=foo",
+			code:  http.StatusBadRequest,
+			body:  RestError(store.ErrInvalidCursor.Error()),
+		},
+		"error, cursor of another sort order": {
+			query: "?after=" + after.Encode(),
+			code:  http.StatusBadRequest,
+			body:  RestError("cursor doesn't match the sort order"),
+		},
+		"error, cursor rejected by the store": {
+			query: "?sort=created_ts:desc&after=" + after.Encode() + "&per_page=2",
+			filter: &store.DeviceFilter{
+				Sort:  sort,
+				After: after,
+			},
+			err:  store.ErrInvalidCursor,
+			code: http.StatusBadRequest,
+			body: RestError(store.ErrInvalidCursor.Error()),
+		},
+	}
+
+	for name := range tcases {
+		tc := tcases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			if tc.filter != nil {
+				da.On("GetDevices",
+					mtest.ContextMatcher(),
+					uint(0), uint(3),
+					mock.MatchedBy(func(f store.DeviceFilter) bool {
+						return assert.ObjectsAreEqual(tc.filter.Sort, f.Sort) &&
+							(tc.filter.After == nil) == (f.After == nil) &&
+							(f.After == nil || f.After.Encode() == tc.filter.After.Encode())
+					})).
+					Return(tc.devices, tc.err)
+			}
+			if tc.err == nil && tc.filter != nil {
+				da.On("CountDevices",
+					mtest.ContextMatcher(),
+					mock.AnythingOfType("store.DeviceFilter")).
+					Return(len(devs), nil)
+			}
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices"+tc.query, nil)
+
+			recorded := runTestRequest(t, apih, req, tc.code, tc.body)
+			if tc.links != nil {
+				assert.Equal(t, tc.links, recorded.Recorder.Header()["Link"])
+			}
+			da.AssertExpectations(t)
+		})
+	}
+}
+
+func TestApiGetDevices(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	devs := []model.Device{
+		{
+			Id:     "foo",
+			PubKey: "pubkey",
+			Status: model.DevStatusPending,
+		},
+		{
+			Id:     "bar",
+			PubKey: "pubkey2",
+			Status: model.DevStatusRejected,
+		},
+		{
+			Id:     "baz",
+			PubKey: "pubkey3",
+			Status: model.DevStatusRejected,
+		},
+	}
+
+	tcases := []struct {
+		req     *http.Request
+		code    int
+		body    string
+		devices []model.Device
+		err     error
+		skip    uint
+		limit   uint
+		filter  store.DeviceFilter
+	}{
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/devices", nil),
+			code:    http.StatusOK,
+			devices: devs,
+			err:     nil,
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			body:    string(asJSON(devs)),
+		},
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/devices", nil),
+			code:    http.StatusOK,
+			devices: []model.Device{},
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			err:     nil,
+			body:    "[]",
+		},
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/devices?page=2&per_page=2", nil),
+			devices: devs,
+			skip:    2,
+			limit:   3,
+			code:    http.StatusOK,
+			// reqquested 2 devices per page, so expect only 2
+			body: string(asJSON(devs[:2])),
+		},
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/devices?status=rejected", nil),
+			devices: devs[1:],
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			filter:  store.DeviceFilter{Status: model.DevStatusRejected},
+			code:    http.StatusOK,
+			body:    string(asJSON(devs[1:])),
+		},
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/devices?search=foo", nil),
+			devices: devs[:1],
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			filter:  store.DeviceFilter{Search: "foo"},
+			code:    http.StatusOK,
+			body:    string(asJSON(devs[:1])),
+		},
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/devices?status=foo", nil),
+			code: http.StatusBadRequest,
+			body: RestError(rest_utils.MsgQueryParmOneOf("status", DevStatuses)),
+		},
+		{
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/devices?page=2&per_page=2", nil),
+			skip:  2,
+			limit: 3,
+			code:  http.StatusInternalServerError,
+			err:   errors.New("failed"),
+			body:  RestError("internal error"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %v", i), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("GetDevices",
+				mtest.ContextMatcher(),
+				tc.skip, tc.limit, tc.filter).Return(
+				tc.devices, tc.err)
+			da.On("CountDevices",
+				mtest.ContextMatcher(),
+				tc.filter).Return(
+				len(tc.devices), nil)
+
+			apih := makeMockApiHandler(t, da, nil)
+			recorded := runTestRequest(t, apih, tc.req, tc.code, tc.body)
+			if tc.code == http.StatusOK {
+				assert.Equal(t, strconv.Itoa(len(tc.devices)),
+					recorded.Recorder.Header().Get("X-Total-Count"))
+			}
+		})
+	}
+}
+
+func asJSON(sth interface{}) []byte {
+	data, _ := json.Marshal(sth)
+	return data
+}
+
+func TestApiDevAuthDecommissionDevice(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := []struct {
+		req  *http.Request
+		code int
+		body string
+		err  error
+	}{
+		{
+			req: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/devices/foo", nil),
+			code: http.StatusNoContent,
+			err:  nil,
+		},
+		{
+			req: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/devices/foo", nil),
+			code: http.StatusNotFound,
+			err:  store.ErrDevNotFound,
+		},
+		{
+			req: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/devices/foo", nil),
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+			err:  errors.New("some error that will only be logged"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("DecommissionDevice",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("string")).
+				Return(tc.err)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthPutTenantLimit(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := []struct {
+		req    *http.Request
+		code   int
+		body   string
+		tenant string
+		limit  model.Limit
+		err    error
+	}{
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/internal/v1/devauth/tenant/foo/limits/max_devices",
+				map[string]int{
+					"limit": 123,
+				}),
+			limit: model.Limit{
+				Name:  model.LimitMaxDeviceCount,
+				Value: 123,
+			},
+			tenant: "foo",
+			code:   http.StatusNoContent,
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/internal/v1/devauth/tenant/foo/limits/max_devices",
+				[]string{"garbage"}),
+			code: http.StatusBadRequest,
+			body: RestError("invalid request body: (root): must be of type object"),
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/internal/v1/devauth/tenant/foo/limits/bogus-limit",
+				map[string]int{
+					"limit": 123,
+				}),
+			code: http.StatusBadRequest,
+			body: RestError("unsupported limit bogus-limit"),
+		},
+		{
+			req: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/internal/v1/devauth/tenant/foo/limits/max_devices",
+				map[string]int{
+					"limit": 123,
+				}),
+			tenant: "foo",
+			limit:  model.Limit{Name: model.LimitMaxDeviceCount, Value: 123},
+			code:   http.StatusInternalServerError,
+			err:    errors.New("failed"),
+			body:   RestError("internal error"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("SetTenantLimit",
+				mtest.ContextMatcher(),
+				tc.tenant,
+				tc.limit).
+				Return(tc.err)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthGetLimit(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := []struct {
+		limit string
+
+		daLimit *model.Limit
+		daUsage *model.DeviceLimitUsage
+		daErr   error
+
+		code int
+		body string
+	}{
+		{
+			limit: "max_devices",
+
+			daUsage: &model.DeviceLimitUsage{
+				Limit: 123,
+				Usage: 100,
+			},
+			daErr: nil,
+
+			code: http.StatusOK,
+			body: `{"limit":123,"usage":100}`,
+		},
+		{
+			limit: "token_expiration",
+
+			daLimit: &model.Limit{
+				Name:  model.LimitTokenExpiration,
+				Value: 3600,
+			},
+			daErr: nil,
+
+			code: http.StatusOK,
+			body: string(asJSON(
+				LimitValue{
+					Limit: 3600,
+				},
+			)),
+		},
+		{
+			limit: "bogus",
+
+			code: http.StatusBadRequest,
+			body: RestError("unsupported limit bogus"),
+		},
+		{
+			limit: "max_devices",
+
+			daUsage: nil,
+			daErr:   errors.New("generic error"),
+
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+		{
+			limit: "token_expiration",
+
+			daLimit: nil,
+			daErr:   errors.New("generic error"),
+
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/limits/"+tc.limit,
+				nil)
+
+			da := &mocks.App{}
+			da.On("GetLimit",
+				mtest.ContextMatcher(),
+				tc.limit).
+				Return(tc.daLimit, tc.daErr)
+			da.On("GetDeviceLimitUsage",
+				mtest.ContextMatcher()).
+				Return(tc.daUsage, tc.daErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthGetTenantLimit(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := []struct {
+		limit    string
+		tenantId string
+
+		daLimit *model.Limit
+		daErr   error
+
+		code int
+		body string
+	}{
+		{
+			limit:    "max_devices",
+			tenantId: "tenant-foo",
+
+			daLimit: &model.Limit{
+				Name:  model.LimitMaxDeviceCount,
+				Value: 123,
+			},
+			daErr: nil,
+
+			code: http.StatusOK,
+			body: string(asJSON(
+				LimitValue{
+					Limit: 123,
+				},
+			)),
+		},
+		{
+			limit:    "bogus",
+			tenantId: "tenant-foo",
+
+			code: http.StatusBadRequest,
+			body: RestError("unsupported limit bogus"),
+		},
+		{
+			limit:    "max_devices",
+			tenantId: "tenant-foo",
+
+			daLimit: nil,
+			daErr:   errors.New("generic error"),
+
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/tenant/"+
+					tc.tenantId+
+					"/limits/"+
+					tc.limit,
+
+				nil)
+
+			da := &mocks.App{}
+			da.On("GetTenantLimit",
+				mtest.ContextMatcher(),
+				tc.limit,
+				tc.tenantId).
+				Return(tc.daLimit, tc.daErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthGetDevicesCount(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	counts := &model.DeviceCounts{
+		Count:         16,
+		Pending:       5,
+		Accepted:      0,
+		Rejected:      4,
+		Preauthorized: 7,
+	}
+
+	tcases := []struct {
+		status string
+
+		daCounts *model.DeviceCounts
+		daErr    error
+
+		code int
+		body string
+	}{
+		{
+			status: "pending",
+
+			daCounts: counts,
+			daErr:    nil,
+
+			code: http.StatusOK,
+			body: string(asJSON(
+				model.Count{
+					Count: 5,
+				},
+			)),
+		},
+		{
+			status: "accepted",
+
+			daCounts: counts,
+			daErr:    nil,
+
+			code: http.StatusOK,
+			body: string(asJSON(
+				model.Count{
+					Count: 0,
+				},
+			)),
+		},
+		{
+			status: "rejected",
+
+			daCounts: counts,
+			daErr:    nil,
+
+			code: http.StatusOK,
+			body: string(asJSON(
+				model.Count{
+					Count: 4,
+				},
+			)),
+		},
+		{
+			status: model.DevStatusPreauth,
+
+			daCounts: counts,
+			daErr:    nil,
+
+			code: http.StatusOK,
+			body: string(asJSON(
+				model.Count{
+					Count: 7,
+				},
+			)),
+		},
+		{
+			status: "",
+
+			daCounts: counts,
+			daErr:    nil,
+
+			code: http.StatusOK,
+			body: string(asJSON(counts)),
+		},
+		{
+			status: "bogus",
+
+			code: http.StatusBadRequest,
+			body: RestError("status must be one of: pending, accepted, rejected, preauthorized, quarantined"),
+		},
+		{
+			status: "accepted",
+
+			daErr: errors.New("generic error"),
+
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			url := "http://1.2.3.4/api/management/v1/devauth/devices/count"
+			if tc.status != "" {
+				url += "?status=" + tc.status
+			}
+
+			req := test.MakeSimpleRequest("GET", url, nil)
+
+			da := &mocks.App{}
+			da.On("GetDevCounts",
+				mtest.ContextMatcher()).
+				Return(tc.daCounts, tc.daErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthGetTenantDevicesCount(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	counts := &model.DeviceCounts{
+		Count:    12,
+		Pending:  2,
+		Accepted: 9,
+		Rejected: 1,
+	}
+
+	tcases := map[string]struct {
+		status string
+
+		daCounts *model.DeviceCounts
+		daErr    error
+
+		code int
+		body string
+	}{
+		"ok, accepted": {
+			status:   "accepted",
+			daCounts: counts,
+			code:     http.StatusOK,
+			body:     string(asJSON(model.Count{Count: 9})),
+		},
+		"ok, all": {
+			daCounts: counts,
+			code:     http.StatusOK,
+			body:     string(asJSON(counts)),
+		},
+		"error, bad status": {
+			status: "bogus",
+			code:   http.StatusBadRequest,
+			body:   RestError("status must be one of: pending, accepted, rejected, preauthorized, quarantined"),
+		},
+		"error, internal": {
+			status: "accepted",
+			daErr:  errors.New("generic error"),
+			code:   http.StatusInternalServerError,
+			body:   RestError("internal error"),
+		},
+	}
+
+	for name, tc := range tcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			url := "http://1.2.3.4/api/internal/v1/devauth/tenants/foo/devices/count"
+			if tc.status != "" {
+				url += "?status=" + tc.status
+			}
+
+			req := test.MakeSimpleRequest("GET", url, nil)
+
+			da := &mocks.App{}
+			da.On("GetDevCounts",
+				mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})).
+				Return(tc.daCounts, tc.daErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthGetStatistics(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	rate := 0.75
+	stats := &model.Statistics{
+		Devices: model.DeviceCounts{
+			Count:    3,
+			Pending:  1,
+			Accepted: 2,
+		},
+		AuthRequests: []model.HourlyCount{{
+			Hour:  time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+			Count: 42,
+		}},
+		AcceptanceRate: &rate,
+		PendingBacklog: model.PendingBacklog{
+			Count:  1,
+			AgeP50: 60,
+			AgeP90: 60,
+			AgeP99: 60,
+			AgeMax: 60,
+		},
+	}
+
+	tcases := map[string]struct {
+		query string
+
+		period  time.Duration
+		daStats *model.Statistics
+		daErr   error
+
+		code int
+		body string
+	}{
+		"ok": {
+			period:  24 * time.Hour,
+			daStats: stats,
+
+			code: http.StatusOK,
+			body: string(asJSON(stats)),
+		},
+		"ok, hours": {
+			query:   "?hours=168",
+			period:  168 * time.Hour,
+			daStats: stats,
+
+			code: http.StatusOK,
+			body: string(asJSON(stats)),
+		},
+		"error, hours out of bounds": {
+			query: "?hours=169",
+
+			code: http.StatusBadRequest,
+			body: RestError("Param hours is out of bounds"),
+		},
+		"error, bad hours": {
+			query: "?hours=foo",
+
+			code: http.StatusBadRequest,
+			body: RestError("Can't parse param hours"),
+		},
+		"error, internal": {
+			period: 24 * time.Hour,
+			daErr:  errors.New("generic error"),
+
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+	}
+
+	for name := range tcases {
+		tc := tcases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/statistics"+tc.query,
+				nil)
+
+			da := &mocks.App{}
+			da.On("GetStatistics",
+				mtest.ContextMatcher(), tc.period).
+				Return(tc.daStats, tc.daErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthPurgeRejectedDevices(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := map[string]struct {
+		query string
+
+		olderThan time.Duration
+		dryRun    bool
+		daCount   int
+		daErr     error
+
+		code int
+		body string
+	}{
+		"ok, configured retention": {
+			daCount: 3,
+
+			code: http.StatusOK,
+			body: string(asJSON(model.Count{Count: 3})),
+		},
+		"ok, days, dry run": {
+			query:     "?days=30&dry_run=true",
+			olderThan: 30 * 24 * time.Hour,
+			dryRun:    true,
+			daCount:   5,
+
+			code: http.StatusOK,
+			body: string(asJSON(model.Count{Count: 5})),
+		},
+		"error, days out of bounds": {
+			query: "?days=0",
+
+			code: http.StatusBadRequest,
+			body: RestError("Param days is out of bounds"),
+		},
+		"error, bad dry run": {
+			query: "?dry_run=maybe",
+
+			code: http.StatusBadRequest,
+			body: RestError("Can't parse param dry_run"),
+		},
+		"error, no retention": {
+			daErr: devauth.ErrRejectedRetentionNotSet,
+
+			code: http.StatusBadRequest,
+			body: RestError(devauth.ErrRejectedRetentionNotSet.Error()),
+		},
+		"error, internal": {
+			daErr: errors.New("generic error"),
+
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+	}
+
+	for name := range tcases {
+		tc := tcases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/devauth/devices/purge_rejected"+tc.query,
+				nil)
+
+			da := &mocks.App{}
+			da.On("PurgeRejectedDevices",
+				mtest.ContextMatcher(), tc.olderThan, tc.dryRun).
+				Return(tc.daCount, tc.daErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthPostTenants(t *testing.T) {
+	testCases := map[string]struct {
+		req        *http.Request
+		devAuthErr error
+		respCode   int
+		respBody   string
+	}{
+		"ok": {
+			req: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tenants",
+				model.NewTenant{TenantId: "foo"}),
+			respCode: 201,
+			respBody: "",
+		},
+		"error: empty request": {
+			req: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tenants",
+				nil),
+			respCode: 400,
+			respBody: RestError("EOF"),
+		},
+		"error: no tenant_id": {
+			req: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tenants",
+				model.NewTenant{TenantId: ""},
+			),
+			respCode: 400,
+			respBody: RestError("invalid request body: tenant_id: must not be empty"),
+		},
+		"error: generic": {
+			req: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/devauth/tenants",
+				model.NewTenant{TenantId: "foo"},
+			),
+			devAuthErr: errors.New("can't provision tenant"),
+			respCode:   500,
+			respBody:   RestError("internal error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+		da := &mocks.App{}
+
+		da.On("ProvisionTenant",
+			mock.MatchedBy(func(c context.Context) bool { return true }),
+			mock.AnythingOfType("string")).Return(tc.devAuthErr)
+
+		apih := makeMockApiHandler(t, da, nil)
+
+		rest.ErrorFieldName = "error"
+
+		runTestRequest(t, apih, tc.req, tc.respCode, tc.respBody)
+	}
+}
+
+func makeReq(method, url, auth string, body interface{}) *http.Request {
+	req := test.MakeSimpleRequest(method, url, body)
+
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	req.Header.Add(requestid.RequestIdHeader, "test")
+
+	return req
+}
+
+func restError(status string) map[string]interface{} {
+	return map[string]interface{}{"error": status, "request_id": "test"}
+}
+
+func TestApiDevAuthDeleteDeviceAuthSet(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := []struct {
+		req  *http.Request
+		code int
+		body string
+		err  error
+	}{
+		{
+			req: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/devices/foo/auth/bar", nil),
+			code: http.StatusNoContent,
+			err:  nil,
+		},
+		{
+			req: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/devices/foo/auth/bar", nil),
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+			err:  store.ErrAuthSetNotFound,
+		},
+		{
+			req: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/devices/foo/auth/bar", nil),
+			code: http.StatusNotFound,
+			err:  store.ErrDevNotFound,
+		},
+		{
+			req: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v1/devauth/devices/foo/auth/bar", nil),
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+			err:  errors.New("some error that will only be logged"),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("DeleteAuthSet",
+				mtest.ContextMatcher(),
+				"foo",
+				"bar").
+				Return(tc.err)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDeleteTokens(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := map[string]struct {
+		tenantId string
+		deviceId string
+
+		devAuthErr error
+
+		checker mt.ResponseChecker
+	}{
+		"ok, all tokens": {
+			tenantId: "foo",
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil),
+		},
+		"ok, device's tokens": {
+			tenantId: "foo",
+			deviceId: "dev-foo",
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil),
+		},
+		"error, no tenant id": {
+			deviceId: "dev-foo",
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("tenant_id must be provided")),
+		},
+		"error, devauth": {
+			tenantId:   "foo",
+			devAuthErr: errors.New("generic error"),
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+	}
+
+	for n := range tcases {
+		tc := tcases[n]
+		t.Run(fmt.Sprintf("tc %s", n), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("DeleteTokens",
+				mtest.ContextMatcher(),
+				tc.tenantId,
+				tc.deviceId).
+				Return(tc.devAuthErr)
+
+			//make request
+			url := fmt.Sprintf("http://1.2.3.4/api/internal/v1/devauth/tokens?tenant_id=%v&device_id=%v",
+				tc.tenantId,
+				tc.deviceId)
+
+			req := makeReq("DELETE",
+				url,
+				"",
+				nil)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			recorded := test.RunRequest(t, apih, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestApiDevAuthSuspendTenant(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := map[string]struct {
+		method     string
+		devAuthErr error
+
+		checker mt.ResponseChecker
+	}{
+		"ok, suspend": {
+			method: "POST",
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil),
+		},
+		"ok, resume": {
+			method: "DELETE",
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil),
+		},
+		"error, suspend": {
+			method:     "POST",
+			devAuthErr: errors.New("generic error"),
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+		"error, resume": {
+			method:     "DELETE",
+			devAuthErr: errors.New("generic error"),
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+	}
+
+	for n := range tcases {
+		tc := tcases[n]
+		t.Run(fmt.Sprintf("tc %s", n), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("SuspendTenant", mtest.ContextMatcher(), "foo").
+				Return(tc.devAuthErr)
+			da.On("ResumeTenant", mtest.ContextMatcher(), "foo").
+				Return(tc.devAuthErr)
+
+			req := makeReq(tc.method,
+				"http://1.2.3.4/api/internal/v1/devauth/tenants/foo/suspend",
+				"",
+				nil)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			recorded := test.RunRequest(t, apih, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+
+			if tc.method == "POST" {
+				da.AssertNotCalled(t, "ResumeTenant", mock.Anything, mock.Anything)
+			} else {
+				da.AssertNotCalled(t, "SuspendTenant", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestApiDevAuthGetTenantDeviceStatus(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := map[string]struct {
+		tid string
+		did string
+
+		daStatus *model.Status
+		daErr    error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			tid: "foo",
+			did: "bar",
+
+			daStatus: &model.Status{Status: "accepted"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				model.Status{Status: "accepted"}),
+		},
+		"error: tenant id empty": {
+			did: "bar",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("tenant id (tid) cannot be empty")),
+		},
+		"error: device id empty": {
+			tid: "foo",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("device id (did) cannot be empty")),
+		},
+		"error: not found": {
+			tid: "foo",
+			did: "bar",
+
+			daErr: devauth.ErrDeviceNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError("device not found")),
+		},
+		"error: generic": {
+			tid: "foo",
+			did: "bar",
+
+			daErr: errors.New("generic error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+	}
+
+	for i := range tcases {
+		tc := tcases[i]
+		t.Run(fmt.Sprintf("tc %s", i), func(t *testing.T) {
+			t.Parallel()
+
+			req := makeReq("GET",
+				fmt.Sprintf("http://1.2.3.4/api/internal/v1/devauth/tenants/%s/devices/%s/status", tc.tid, tc.did),
+				"",
+				nil)
+
+			da := &mocks.App{}
+			da.On("GetTenantDeviceStatus",
+				mtest.ContextMatcher(),
+				tc.tid,
+				tc.did,
+			).Return(tc.daStatus, tc.daErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			recorded := test.RunRequest(t, apih, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestApiDevAuthDevAdmGetDevices(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := map[string]struct {
+		skip   int
+		limit  int
+		filter store.AuthSetFilter
+
+		getAuthSetsRes []model.DevAdmAuthSet
+		getAuthSetsErr error
+
+		req *http.Request
+
+		code  int
+		body  string
+		links []string
+	}{
+		"valid pagination, no next page": {
+			skip:  15,
+			limit: 6,
+
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/admission/devices?page=4&per_page=5", nil),
+
+			getAuthSetsRes: mockAuthSets(5),
+
+			code: 200,
+			body: toJsonString(t, mockAuthSets(5)),
+			links: []string{
+				`<http://1.2.3.4/api/management/v1/admission/devices?page=3&per_page=5>; rel="prev"`,
+				`<http://1.2.3.4/api/management/v1/admission/devices?page=1&per_page=5>; rel="first"`,
+			},
+		},
+
+		"valid pagination, with next page": {
+			skip:  15,
+			limit: 6,
+
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/admission/devices?page=4&per_page=5", nil),
+
+			getAuthSetsRes: mockAuthSets(9),
+
+			code: 200,
+			body: toJsonString(t, mockAuthSets(5)),
+			links: []string{
+				`<http://1.2.3.4/api/management/v1/admission/devices?page=3&per_page=5>; rel="prev"`,
+				`<http://1.2.3.4/api/management/v1/admission/devices?page=1&per_page=5>; rel="first"`,
+			},
+		},
+		"invalid pagination: format": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/admission/devices?page=foo&per_page=5", nil),
+			code: 400,
+			body: RestError(rest_utils.MsgQueryParmInvalid("page")),
+		},
+		"invalid pagination: bounds": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/admission/devices?page=0&per_page=5", nil),
+			code: 400,
+			body: RestError(rest_utils.MsgQueryParmLimit("page")),
+		},
+		"valid status: accepted": {
+			skip:   15,
+			limit:  6,
+			filter: store.AuthSetFilter{Status: "accepted"},
+
+			getAuthSetsRes: mockAuthSets(6),
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/admission/devices?page=4&per_page=5&status=accepted", nil),
+			code: 200,
+			body: toJsonString(t, mockAuthSets(5)),
+		},
+		"valid status: preauthorized": {
+			skip:   15,
+			limit:  6,
+			filter: store.AuthSetFilter{Status: "preauthorized"},
+
+			getAuthSetsRes: mockAuthSets(6),
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/admission/devices?page=4&per_page=5&status=preauthorized", nil),
+			code: 200,
+			body: toJsonString(t, mockAuthSets(5)),
+		},
+		"invalid status": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/admission/devices?page=1&per_page=5&status=foo", nil),
+			code: 400,
+			body: RestError(rest_utils.MsgQueryParmOneOf("status", DevStatuses)),
+		},
+		"db.GetAuthSets error": {
+			skip:           15,
+			limit:          6,
+			getAuthSetsErr: errors.New("db error"),
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/admission/devices?page=4&per_page=5", nil),
+			code: 500,
+			body: RestError("internal error"),
+		},
+	}
+
+	for idx := range tcases {
+		tc := tcases[idx]
+		t.Run(fmt.Sprintf("tc %s", idx), func(t *testing.T) {
+			t.Parallel()
+
+			db := &smocks.DataStore{}
+			db.On("GetAuthSets",
+				mtest.ContextMatcher(),
+				tc.skip,
+				tc.limit,
+				tc.filter).Return(tc.getAuthSetsRes, tc.getAuthSetsErr)
+
+			apih := makeMockApiHandler(t, nil, db)
+
+			recorded := runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			for _, h := range tc.links {
+				assert.Equal(t, h, ExtractHeader("Link", h, recorded))
+			}
+		})
+	}
+}
+
+func TestApiDevAuthDevAdmGetDevice(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := map[string]struct {
+		aid string
+
+		dbAuthSet *model.AuthSet
+		dbErr     error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			aid: "foo",
+
+			dbAuthSet: &model.AuthSet{
+				Id:       "foo",
+				DeviceId: "foo-dev",
+				IdData:   `{"sn": "dev-foo-sn"}`,
+				Status:   "accepted",
+				PubKey:   "foo-dev-key",
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				&model.DevAdmAuthSet{
+					Id:             "foo",
+					DeviceId:       "foo-dev",
+					DeviceIdentity: `{"sn": "dev-foo-sn"}`,
+					Status:         "accepted",
+					Key:            "foo-dev-key",
+					Attributes: map[string]interface{}{
+						"sn": "dev-foo-sn",
+					}}),
+		},
+		"error: not found": {
+			aid: "foo",
+
+			dbErr: store.ErrDevNotFound,
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError("authorization set not found")),
+		},
+		"error: generic db error": {
+			aid: "foo",
+
+			dbErr: errors.New("an error"),
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+		"error: auth set conversion error": {
+			aid: "foo",
+
+			dbAuthSet: &model.AuthSet{
+				Id:       "foo",
+				DeviceId: "foo-dev",
+				IdData:   "not json",
+				Status:   "accepted",
+				PubKey:   "foo-dev-key",
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+	}
+
+	for idx := range tcases {
+		tc := tcases[idx]
+		t.Run(fmt.Sprintf("tc %s", idx), func(t *testing.T) {
+			t.Parallel()
+
+			db := &smocks.DataStore{}
+			db.On("GetAuthSetById",
+				mtest.ContextMatcher(),
+				tc.aid).Return(tc.dbAuthSet, tc.dbErr)
+
+			apih := makeMockApiHandler(t, nil, db)
+
+			//make request
+			req := makeReq("GET",
+				"http://1.2.3.4/api/management/v1/admission/devices/"+tc.aid,
+				"",
+				nil)
+			recorded := test.RunRequest(t, apih, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestApiDevAuthDevAdmDeleteDeviceAuthSet(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	tcases := map[string]struct {
+		aid string
+
+		dbAuthSet *model.AuthSet
+		dbErr     error
+
+		daErr error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			aid: "foo",
+
+			dbAuthSet: &model.AuthSet{
+				Id:       "foo",
+				DeviceId: "foo-dev",
+				IdData:   `{"sn": "dev-foo-sn"}`,
+				Status:   "accepted",
+				PubKey:   "foo-dev-key",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil),
+		},
+		"error: not found (db)": {
+			aid: "foo",
+
+			dbErr: store.ErrDevNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil),
+		},
+
+		"error: not found(app)": {
+			aid: "foo",
+
+			dbAuthSet: &model.AuthSet{
+				Id:       "foo",
+				DeviceId: "foo-dev",
+				IdData:   `{"sn": "dev-foo-sn"}`,
+				Status:   "accepted",
+				PubKey:   "foo-dev-key",
+			},
+
+			daErr: store.ErrDevNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil),
+		},
+		"error: generic db error": {
+			aid: "foo",
+
+			dbErr: errors.New("an error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+		"error: generic app error": {
+			aid: "foo",
+
+			dbAuthSet: &model.AuthSet{
+				Id:       "foo",
+				DeviceId: "foo-dev",
+				IdData:   `{"sn": "dev-foo-sn"}`,
+				Status:   "accepted",
+				PubKey:   "foo-dev-key",
+			},
+
+			daErr: errors.New("an error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+	}
+
+	for idx := range tcases {
+		tc := tcases[idx]
+		t.Run(fmt.Sprintf("tc %s", idx), func(t *testing.T) {
+			t.Parallel()
+
+			db := &smocks.DataStore{}
+			db.On("GetAuthSetById",
+				mtest.ContextMatcher(),
+				tc.aid).Return(tc.dbAuthSet, tc.dbErr)
+
+			da := &mocks.App{}
+			if tc.dbAuthSet != nil {
+				da.On("DeleteAuthSet",
+					mtest.ContextMatcher(),
+					tc.dbAuthSet.DeviceId,
+					tc.aid).Return(tc.daErr)
+			} else {
+				da.On("DeleteAuthSet",
+					mtest.ContextMatcher(),
+					mock.AnythingOfType("string"),
+					tc.aid).Return(tc.daErr)
+			}
+
+			apih := makeMockApiHandler(t, da, db)
+
+			//make request
+			req := makeReq("DELETE",
+				"http://1.2.3.4/api/management/v1/admission/devices/"+tc.aid,
+				"",
+				nil)
+			recorded := test.RunRequest(t, apih, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func mockAuthSets(num int) []model.DevAdmAuthSet {
+	var sets []model.DevAdmAuthSet
+	for i := 0; i < num; i++ {
+		sets = append(sets, model.DevAdmAuthSet{
+			Id:       strconv.Itoa(i),
+			DeviceId: strconv.Itoa(i),
+		})
+	}
+	return sets
+}
+
+func ExtractHeader(hdr, val string, r *test.Recorded) string {
+	rec := r.Recorder
+	for _, v := range rec.Header()[hdr] {
+		if v == val {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func TestApiDevAuthDevAdmPostDeviceAuth(t *testing.T) {
+	validKey := `
+-----BEGIN PUBLIC KEY-----
+MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAzogVU7RGDilbsoUt/DdH
+VJvcepl0A5+xzGQ50cq1VE/Dyyy8Zp0jzRXCnnu9nu395mAFSZGotZVr+sWEpO3c
+yC3VmXdBZmXmQdZqbdD/GuixJOYfqta2ytbIUPRXFN7/I7sgzxnXWBYXYmObYvdP
+okP0mQanY+WKxp7Q16pt1RoqoAd0kmV39g13rFl35muSHbSBoAW3GBF3gO+mF5Ty
+1ddp/XcgLOsmvNNjY+2HOD5F/RX0fs07mWnbD7x+xz7KEKjF+H7ZpkqCwmwCXaf0
+iyYyh1852rti3Afw4mDxuVSD7sd9ggvYMc0QHIpQNkD4YWOhNiE1AB0zH57VbUYG
+UwIDAQAB
+-----END PUBLIC KEY-----`
+
+	testCases := map[string]struct {
+		body interface{}
+
+		devAuthErr error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: &model.DevAdmAuthSetReq{Key: validKey, DeviceId: toJsonString(t,
+				map[string]string{
+					"mac": "00:00:00:01",
+				}),
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				nil),
+		},
+		"error, invalid key": {
+			body: &model.DevAdmAuthSetReq{Key: "foo", DeviceId: toJsonString(t,
+				map[string]string{
+					"mac": "00:00:00:01",
+				}),
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("cannot decode public key")),
+		},
+		"error: empty request": {
+			body: nil,
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("EOF")),
+		},
+		"error: generic": {
+			body: &model.DevAdmAuthSetReq{Key: validKey, DeviceId: toJsonString(t,
+				map[string]string{
+					"mac": "00:00:00:01",
+				})},
+			devAuthErr: errors.New("generic error"),
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error")),
+		},
+		"error: no key": {
+			body: &model.DevAdmAuthSetReq{Key: "", DeviceId: toJsonString(t,
+				map[string]string{
+					"mac": "00:00:00:01",
+				})},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("invalid request body: key: must not be empty")),
+		},
+		"error: no identity data": {
+			body: &model.DevAdmAuthSetReq{Key: validKey},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("invalid request body: device_identity: must not be empty")),
+		},
+		"error: invalid id data": {
+			body: &model.DevAdmAuthSetReq{Key: validKey, DeviceId: "{mac: 1234}"},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode attributes data: invalid character 'm' looking for beginning of object key string")),
+		},
+		"error: conflict": {
+			body: &model.DevAdmAuthSetReq{Key: validKey, DeviceId: toJsonString(t,
+				map[string]string{
+					"mac": "00:00:00:01",
+				})},
+			devAuthErr: devauth.ErrDeviceExists,
+			checker: mt.NewJSONResponse(
+				http.StatusConflict,
+				nil,
+				restError("device already exists")),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+		da := &mocks.App{}
+		da.On("PreauthorizeDevice",
+			mtest.ContextMatcher(),
+			mock.AnythingOfType("*model.PreAuthReq")).
+			Return(tc.devAuthErr)
+
+		apih := makeMockApiHandler(t, da, nil)
+
+		//make request
+		req := makeReq("POST",
+			"http://1.2.3.4/api/management/v1/admission/devices",
+			"",
+			tc.body)
+
+		recorded := test.RunRequest(t, apih, req)
+		mt.CheckResponse(t, tc.checker, recorded)
+	}
+}
+
+func toJsonString(t *testing.T, d interface{}) string {
+	out, err := json.Marshal(d)
+	if err != nil {
+		t.FailNow()
+	}
+
+	return string(out)
+}
+
+func TestApiGetTenantDevicesV2(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	devs := []model.Device{
 		{
-			req: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
-			code: http.StatusForbidden,
-			headers: map[string]string{
-				"authorization": "dummytoken",
+			Id:     "id1",
+			PubKey: "pubkey",
+			Status: model.DevStatusPending,
+		},
+		{
+			Id:     "id2",
+			PubKey: "pubkey2",
+			Status: model.DevStatusRejected,
+		},
+		{
+			Id:     "id3",
+			PubKey: "pubkey3",
+			Status: model.DevStatusRejected,
+		},
+		{
+			Id:     "id4",
+			PubKey: "pubkey4",
+			Status: model.DevStatusAccepted,
+		},
+		{
+			Id:     "id5",
+			PubKey: "pubkey5",
+			Status: model.DevStatusPreauth,
+		},
+	}
+
+	outDevs, err := devicesV2FromDbModel(devs)
+	assert.NoError(t, err)
+
+	tcases := map[string]struct {
+		req       *http.Request
+		code      int
+		body      string
+		devices   []model.Device
+		err       error
+		skip      uint
+		limit     uint
+		tenant_id string
+	}{
+		"ok": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/tenants/powerpuff123/devices", nil),
+			code:      http.StatusOK,
+			devices:   devs,
+			err:       nil,
+			skip:      0,
+			limit:     rest_utils.PerPageDefault + 1,
+			body:      string(asJSON(outDevs)),
+			tenant_id: "powerpuff123",
+		},
+		"no devices": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/tenants/powerpuff123/devices", nil),
+			code:      http.StatusOK,
+			devices:   []model.Device{},
+			skip:      0,
+			limit:     rest_utils.PerPageDefault + 1,
+			err:       nil,
+			body:      "[]",
+			tenant_id: "powerpuff123",
+		},
+		// this test does not check if the devices were skipped
+		// it is only checking if endpoint limits number of devices in the response
+		"limit number of devices": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/tenants/powerpuff123/devices?page=2&per_page=2", nil),
+			devices: devs,
+			skip:    2,
+			limit:   3,
+			code:    http.StatusOK,
+			// reqquested 2 devices per page, so expect only 2
+			body:      string(asJSON(outDevs[:2])),
+			tenant_id: "powerpuff123",
+		},
+		"internal error": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/tenants/powerpuff123/devices?page=2&per_page=2", nil),
+			skip:      2,
+			limit:     3,
+			code:      http.StatusInternalServerError,
+			err:       errors.New("failed"),
+			body:      RestError("internal error"),
+			tenant_id: "powerpuff123",
+		},
+		"tenant_id not valid": {
+			req: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/tenants//devices", nil),
+			code: http.StatusBadRequest,
+			err:  errors.New("failed"),
+			body: RestError("tenant id (tid) cannot be empty"),
+		},
+	}
+
+	for name := range tcases {
+		tc := tcases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("GetDevices",
+				mock.MatchedBy(func(c context.Context) bool {
+					if identity.FromContext(c).Tenant != tc.tenant_id {
+						assert.FailNow(t, "Tenant ID from request mismatch", identity.FromContext(c).Tenant)
+						return false
+					}
+					return true
+				}),
+				tc.skip, tc.limit, mock.AnythingOfType("store.DeviceFilter")).Return(
+				tc.devices, tc.err)
+			da.On("CountDevices",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("store.DeviceFilter")).Return(
+				len(tc.devices), nil)
+
+			apih := makeMockApiHandler(t, da, nil)
+			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthSubmitDeviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	privkey := mtest.LoadPrivKey("testdata/private.pem", t)
+	pubkeyStr := mtest.LoadPubKeyStr("testdata/public.pem", t)
+
+	authReq := map[string]interface{}{
+		"id_data": `{"sn":"0001"}`,
+		"pubkey":  pubkeyStr,
+	}
+
+	authz := &model.DeviceAuthorization{
+		DeviceCode:              "devicecode",
+		UserCode:                "WDJB-MJHT",
+		VerificationUri:         "https://mender/authorize",
+		VerificationUriComplete: "https://mender/authorize?user_code=WDJB-MJHT",
+		ExpiresIn:               900,
+		Interval:                5,
+	}
+
+	testCases := map[string]struct {
+		req *http.Request
+
+		devAuthRes *model.DeviceAuthorization
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"ok": {
+			req:        makeAuthReq(authReq, privkey, "", t),
+			devAuthRes: authz,
+			code:       http.StatusOK,
+			body:       string(asJSON(authz)),
+		},
+		"error, bad signature": {
+			req:  makeAuthReq(authReq, nil, "foo", t),
+			code: http.StatusUnauthorized,
+			body: RestError("signature verification failed"),
+		},
+		"error, disabled": {
+			req:        makeAuthReq(authReq, privkey, "", t),
+			devAuthErr: devauth.ErrDeviceAuthzDisabled,
+			code:       http.StatusBadRequest,
+			body:       RestError("unauthorized_client"),
+		},
+		"error, unauthorized": {
+			req:        makeAuthReq(authReq, privkey, "", t),
+			devAuthErr: devauth.ErrMaxDeviceCountReached,
+			code:       http.StatusUnauthorized,
+			body:       RestError("unauthorized"),
+		},
+		"error, internal": {
+			req:        makeAuthReq(authReq, privkey, "", t),
+			devAuthErr: errors.New("db failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("SubmitDeviceAuthorization",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("*model.AuthReq")).
+				Return(tc.devAuthRes, tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			tc.req.URL.Path = "/api/devices/v1/authentication/device_authorization"
+			recorded := runTestRequest(t, apih, tc.req, tc.code, tc.body)
+			if tc.code == http.StatusOK {
+				assert.Equal(t, "no-store",
+					recorded.Recorder.HeaderMap.Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestApiDevAuthDeviceToken(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	makeTokenReq := func(form url.Values) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost,
+			"http://1.2.3.4/api/devices/v1/authentication/token",
+			strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	validForm := url.Values{
+		"grant_type":  []string{model.GrantTypeDeviceCode},
+		"device_code": []string{"devicecode"},
+	}
+
+	testCases := map[string]struct {
+		req *http.Request
+
+		devAuthToken string
+		devAuthErr   error
+
+		code int
+		body string
+	}{
+		"ok": {
+			req:          makeTokenReq(validForm),
+			devAuthToken: "dummytoken",
+			code:         http.StatusOK,
+			body:         `{"access_token":"dummytoken","token_type":"Bearer"}`,
+		},
+		"pending": {
+			req:        makeTokenReq(validForm),
+			devAuthErr: devauth.ErrAuthorizationPending,
+			code:       http.StatusBadRequest,
+			body:       RestError("authorization_pending"),
+		},
+		"slow down": {
+			req:        makeTokenReq(validForm),
+			devAuthErr: devauth.ErrSlowDown,
+			code:       http.StatusBadRequest,
+			body:       RestError("slow_down"),
+		},
+		"denied": {
+			req:        makeTokenReq(validForm),
+			devAuthErr: devauth.ErrAccessDenied,
+			code:       http.StatusBadRequest,
+			body:       RestError("access_denied"),
+		},
+		"expired": {
+			req:        makeTokenReq(validForm),
+			devAuthErr: devauth.ErrExpiredToken,
+			code:       http.StatusBadRequest,
+			body:       RestError("expired_token"),
+		},
+		"invalid grant": {
+			req:        makeTokenReq(validForm),
+			devAuthErr: devauth.ErrInvalidGrant,
+			code:       http.StatusBadRequest,
+			body:       RestError("invalid_grant"),
+		},
+		"internal error": {
+			req:        makeTokenReq(validForm),
+			devAuthErr: errors.New("db failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
+		},
+		"unsupported grant type": {
+			req: makeTokenReq(url.Values{
+				"grant_type":  []string{"password"},
+				"device_code": []string{"devicecode"},
+			}),
+			code: http.StatusBadRequest,
+			body: RestError("unsupported_grant_type"),
+		},
+		"missing device code": {
+			req: makeTokenReq(url.Values{
+				"grant_type": []string{model.GrantTypeDeviceCode},
+			}),
+			code: http.StatusBadRequest,
+			body: RestError("invalid_request"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("IssueRefreshToken",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("string")).
+				Return("", nil)
+			da.On("PollDeviceAuthorization",
+				mtest.ContextMatcher(),
+				"devicecode").
+				Return(tc.devAuthToken, tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			recorded := runTestRequest(t, apih, tc.req, tc.code, tc.body)
+			if tc.code == http.StatusOK {
+				assert.Equal(t, "no-store",
+					recorded.Recorder.HeaderMap.Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestApiDevAuthRefreshToken(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	makeTokenReq := func(form url.Values) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost,
+			"http://1.2.3.4/api/devices/v1/authentication/token",
+			strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	validForm := url.Values{
+		"grant_type":    []string{"refresh_token"},
+		"refresh_token": []string{"refresh"},
+	}
+
+	testCases := map[string]struct {
+		req *http.Request
+
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"ok": {
+			req:  makeTokenReq(validForm),
+			code: http.StatusOK,
+			body: `{"access_token":"dummytoken","token_type":"Bearer","refresh_token":"newrefresh"}`,
+		},
+		"invalid refresh token": {
+			req:        makeTokenReq(validForm),
+			devAuthErr: devauth.ErrInvalidRefreshToken,
+			code:       http.StatusBadRequest,
+			body:       RestError("invalid_grant"),
+		},
+		"internal error": {
+			req:        makeTokenReq(validForm),
+			devAuthErr: errors.New("db failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
+		},
+		"missing refresh token": {
+			req: makeTokenReq(url.Values{
+				"grant_type": []string{"refresh_token"},
+			}),
+			code: http.StatusBadRequest,
+			body: RestError("invalid_request"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			if tc.devAuthErr != nil {
+				da.On("RefreshToken", mtest.ContextMatcher(), "refresh").
+					Return("", "", tc.devAuthErr)
+			} else {
+				da.On("RefreshToken", mtest.ContextMatcher(), "refresh").
+					Return("dummytoken", "newrefresh", nil)
+			}
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			recorded := runTestRequest(t, apih, tc.req, tc.code, tc.body)
+			if tc.code == http.StatusOK {
+				assert.Equal(t, "no-store",
+					recorded.Recorder.HeaderMap.Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestApiDevAuthIntrospectToken(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	makeIntrospectReq := func(form url.Values) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost,
+			"http://1.2.3.4/api/internal/v1/devauth/tokens/introspect",
+			strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	active := &model.TokenIntrospection{
+		Active:    true,
+		TokenType: "Bearer",
+		ExpiresAt: 1700003600,
+		Subject:   "dev1",
+		DeviceId:  "dev1",
+		Tenant:    "tenant1",
+		Status:    model.DevStatusAccepted,
+	}
+
+	testCases := map[string]struct {
+		req *http.Request
+
+		devAuthRes *model.TokenIntrospection
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"ok, active": {
+			req:        makeIntrospectReq(url.Values{"token": []string{"token"}}),
+			devAuthRes: active,
+			code:       http.StatusOK,
+			body:       string(asJSON(active)),
+		},
+		"ok, inactive": {
+			req:        makeIntrospectReq(url.Values{"token": []string{"token"}}),
+			devAuthRes: &model.TokenIntrospection{},
+			code:       http.StatusOK,
+			body:       `{"active":false}`,
+		},
+		"error, missing token": {
+			req:  makeIntrospectReq(url.Values{"token_type_hint": []string{"access_token"}}),
+			code: http.StatusBadRequest,
+			body: RestError("invalid_request"),
+		},
+		"error, internal": {
+			req:        makeIntrospectReq(url.Values{"token": []string{"token"}}),
+			devAuthErr: errors.New("db failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("IntrospectToken",
+				mtest.ContextMatcher(),
+				"token").
+				Return(tc.devAuthRes, tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			recorded := runTestRequest(t, apih, tc.req, tc.code, tc.body)
+			if tc.code == http.StatusOK {
+				assert.Equal(t, "no-store",
+					recorded.Recorder.HeaderMap.Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestApiDevAuthGetDeviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	dc := &model.DeviceCode{
+		UserCode:  "WDJB-MJHT",
+		DeviceId:  "dev1",
+		AuthSetId: "aid1",
+		IdDataStruct: map[string]interface{}{
+			"sn": "0001",
+		},
+	}
+
+	testCases := map[string]struct {
+		devAuthRes *model.DeviceCode
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"ok": {
+			devAuthRes: dc,
+			code:       http.StatusOK,
+			body:       string(asJSON(dc)),
+		},
+		"not found": {
+			devAuthErr: devauth.ErrUserCodeNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrUserCodeNotFound.Error()),
+		},
+		"internal error": {
+			devAuthErr: errors.New("db failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("GetDeviceAuthorization",
+				mtest.ContextMatcher(),
+				"WDJB-MJHT").
+				Return(tc.devAuthRes, tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/device_authorizations/WDJB-MJHT",
+				nil)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthUpdateDeviceAuthorizationStatus(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	testCases := map[string]struct {
+		status interface{}
+
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"accepted": {
+			status: DevAuthApiStatus{Status: "accepted"},
+			code:   http.StatusNoContent,
+		},
+		"rejected": {
+			status: DevAuthApiStatus{Status: "rejected"},
+			code:   http.StatusNoContent,
+		},
+		"error, bad status": {
+			status: DevAuthApiStatus{Status: "pending"},
+			code:   http.StatusBadRequest,
+			body:   RestError("invalid request body: status: must be one of: accepted, rejected"),
+		},
+		"error, bad payload": {
+			status: "foo",
+			code:   http.StatusBadRequest,
+			body:   RestError("invalid request body: (root): must be of type object"),
+		},
+		"error, not found": {
+			status:     DevAuthApiStatus{Status: "accepted"},
+			devAuthErr: devauth.ErrUserCodeNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrUserCodeNotFound.Error()),
+		},
+		"error, limit": {
+			status:     DevAuthApiStatus{Status: "accepted"},
+			devAuthErr: devauth.ErrMaxDeviceCountReached,
+			code:       http.StatusUnprocessableEntity,
+			body:       RestError(devauth.ErrMaxDeviceCountReached.Error()),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("SetDeviceAuthorizationStatus",
+				mtest.ContextMatcher(),
+				"WDJB-MJHT",
+				mock.AnythingOfType("string")).
+				Return(tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v2/devauth/device_authorizations/WDJB-MJHT/status",
+				tc.status)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthPostTransfer(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	transfer := &model.Transfer{
+		Id:        "transfer1",
+		DeviceId:  "dev1",
+		ToOwner:   "bob",
+		Status:    model.TransferStatusPendingAcceptance,
+		CreatedTs: time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+		UpdatedTs: time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	testCases := map[string]struct {
+		req interface{}
+
+		transfer   *model.Transfer
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"ok": {
+			req: model.TransferReq{
+				DeviceId: "dev1",
+				ToOwner:  "bob",
 			},
-			err: jwt.ErrTokenExpired,
+			transfer: transfer,
+			code:     http.StatusCreated,
+			body:     string(asJSON(transfer)),
 		},
-		{
-			req: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
-			code: http.StatusUnauthorized,
-			headers: map[string]string{
-				"authorization": "dummytoken",
+		"error, no device id": {
+			req: map[string]string{
+				"to_owner": "bob",
 			},
-			err: jwt.ErrTokenInvalid,
+			code: http.StatusBadRequest,
+			body: RestError("invalid request body: device_id: is required"),
+		},
+		"error, no destination": {
+			req: model.TransferReq{
+				DeviceId: "dev1",
+			},
+			code: http.StatusBadRequest,
+			body: RestError("to_owner or to_tenant_id must be provided"),
+		},
+		"error, device not found": {
+			req: model.TransferReq{
+				DeviceId: "dev1",
+				ToOwner:  "bob",
+			},
+			devAuthErr: devauth.ErrDeviceNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrDeviceNotFound.Error()),
+		},
+		"error, in progress": {
+			req: model.TransferReq{
+				DeviceId: "dev1",
+				ToOwner:  "bob",
+			},
+			devAuthErr: devauth.ErrTransferInProgress,
+			code:       http.StatusConflict,
+			body:       RestError(devauth.ErrTransferInProgress.Error()),
+		},
+		"error, internal": {
+			req: model.TransferReq{
+				DeviceId: "dev1",
+				ToOwner:  "bob",
+			},
+			devAuthErr: errors.New("db connection failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
 		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("StartDeviceTransfer",
+				mtest.ContextMatcher(),
+				mock.AnythingOfType("*model.TransferReq")).
+				Return(tc.transfer, tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/devauth/transfers",
+				tc.req)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthUpdateDevicesStatus(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	results := []model.DeviceStatusResult{
 		{
-			req: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/devauth/tokens/verify", nil),
-			code: 500,
-			body: RestError("internal error"),
-			headers: map[string]string{
-				"authorization": "dummytoken",
+			DeviceId: "dev1",
+			Status:   model.DevStatusAccepted,
+		},
+		{
+			DeviceId: "dev2",
+			Error:    devauth.ErrNoPendingAuthSet.Error(),
+		},
+	}
+
+	manyIds := make([]string, model.DevicesStatusMaxCount+1)
+	for i := range manyIds {
+		manyIds[i] = fmt.Sprintf("dev%d", i)
+	}
+
+	testCases := map[string]struct {
+		req interface{}
+
+		results    []model.DeviceStatusResult
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"ok, by ids": {
+			req: model.DevicesStatusReq{
+				Status:    model.DevStatusAccepted,
+				DeviceIds: []string{"dev1", "dev2"},
 			},
-			err: errors.New("some error that will only be logged"),
+			results: results,
+			code:    http.StatusOK,
+			body:    string(asJSON(results)),
+		},
+		"ok, by filter": {
+			req: model.DevicesStatusReq{
+				Status: model.DevStatusRejected,
+				Filter: &model.DevicesStatusFilter{
+					Status: model.DevStatusPending,
+					Search: "SN00",
+				},
+			},
+			results: []model.DeviceStatusResult{},
+			code:    http.StatusOK,
+			body:    "[]",
+		},
+		"error, bad status": {
+			req: model.DevicesStatusReq{
+				Status:    model.DevStatusPending,
+				DeviceIds: []string{"dev1"},
+			},
+			code: http.StatusBadRequest,
+			body: RestError("invalid request body: status: must be one of: accepted, rejected"),
+		},
+		"error, no devices": {
+			req: model.DevicesStatusReq{
+				Status: model.DevStatusAccepted,
+			},
+			code: http.StatusBadRequest,
+			body: RestError("device_ids or filter must be provided"),
+		},
+		"error, ids along with filter": {
+			req: model.DevicesStatusReq{
+				Status:    model.DevStatusAccepted,
+				DeviceIds: []string{"dev1"},
+				Filter:    &model.DevicesStatusFilter{},
+			},
+			code: http.StatusBadRequest,
+			body: RestError("device_ids can't be used along with filter"),
+		},
+		"error, too many devices": {
+			req: model.DevicesStatusReq{
+				Status:    model.DevStatusAccepted,
+				DeviceIds: manyIds,
+			},
+			code: http.StatusBadRequest,
+			body: RestError("at most 1000 devices can be updated at once"),
+		},
+		"error, internal": {
+			req: model.DevicesStatusReq{
+				Status:    model.DevStatusAccepted,
+				DeviceIds: []string{"dev1"},
+			},
+			devAuthErr: errors.New("db connection failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("VerifyToken",
+			da.On("UpdateDevicesStatus",
 				mtest.ContextMatcher(),
-				mock.AnythingOfType("string")).
-				Return(tc.err)
+				mock.AnythingOfType("*model.DevicesStatusReq")).
+				Return(tc.results, tc.devAuthErr)
 
 			apih := makeMockApiHandler(t, da, nil)
-			if len(tc.headers) > 0 {
-				tc.req.Header.Set("authorization", tc.headers["authorization"])
-			}
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			req := test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v2/devauth/devices/status",
+				tc.req)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
+}
+
+func TestApiDevAuthGetTransfer(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	transfer := &model.Transfer{
+		Id:         "transfer1",
+		DeviceId:   "dev1",
+		ToTenantId: "tenant2",
+		Status:     model.TransferStatusPendingEnrollment,
+		CreatedTs:  time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+		UpdatedTs:  time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	testCases := map[string]struct {
+		transfer   *model.Transfer
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"ok": {
+			transfer: transfer,
+			code:     http.StatusOK,
+			body:     string(asJSON(transfer)),
+		},
+		"error, not found": {
+			devAuthErr: devauth.ErrTransferNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrTransferNotFound.Error()),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("GetDeviceTransfer",
+				mtest.ContextMatcher(),
+				"transfer1").
+				Return(tc.transfer, tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/transfers/transfer1", nil)
 
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
 }
 
-func TestApiDevAuthDeleteToken(t *testing.T) {
+func TestApiDevAuthDeleteTransfer(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := []struct {
-		req  *http.Request
+	testCases := map[string]struct {
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"ok": {
+			code: http.StatusNoContent,
+		},
+		"error, not found": {
+			devAuthErr: devauth.ErrTransferNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrTransferNotFound.Error()),
+		},
+		"error, not pending": {
+			devAuthErr: devauth.ErrTransferNotPending,
+			code:       http.StatusConflict,
+			body:       RestError(devauth.ErrTransferNotPending.Error()),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On("CancelDeviceTransfer",
+				mtest.ContextMatcher(),
+				"transfer1").
+				Return(tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v2/devauth/transfers/transfer1", nil)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthTransferApproval(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	testCases := map[string]struct {
+		action     string
+		method     string
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"ok, accept": {
+			action: "accept",
+			method: "AcceptDeviceTransfer",
+			code:   http.StatusNoContent,
+		},
+		"ok, decline": {
+			action: "decline",
+			method: "DeclineDeviceTransfer",
+			code:   http.StatusNoContent,
+		},
+		"error, not found": {
+			action:     "accept",
+			method:     "AcceptDeviceTransfer",
+			devAuthErr: devauth.ErrTransferNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrTransferNotFound.Error()),
+		},
+		"error, not awaiting approval": {
+			action:     "decline",
+			method:     "DeclineDeviceTransfer",
+			devAuthErr: devauth.ErrTransferNotApprovable,
+			code:       http.StatusConflict,
+			body:       RestError(devauth.ErrTransferNotApprovable.Error()),
+		},
+		"error, internal": {
+			action:     "accept",
+			method:     "AcceptDeviceTransfer",
+			devAuthErr: errors.New("failed to decommission device"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			da := &mocks.App{}
+			da.On(tc.method,
+				mtest.ContextMatcher(),
+				"transfer1").
+				Return(tc.devAuthErr)
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/devauth/transfers/transfer1/"+
+					tc.action, nil)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestApiDevAuthPutDecommissionAt(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	at := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		req interface{}
+
+		devAuthErr error
+
 		code int
 		body string
-		err  error
 	}{
-		{
-			req: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/management/v1/devauth/tokens/foo", nil),
+		"ok": {
+			req:  DevAuthApiDecommissionAt{DecommissionAt: at},
 			code: http.StatusNoContent,
-			err:  nil,
 		},
-		{
-			req: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/management/v1/devauth/tokens/foo", nil),
-			code: http.StatusNotFound,
-			err:  store.ErrTokenNotFound,
+		"error, no time": {
+			req:  map[string]string{},
+			code: http.StatusBadRequest,
+			body: RestError("invalid request body: decommission_at: is required"),
 		},
-		{
-			req: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/management/v1/devauth/tokens/foo", nil),
-			code: http.StatusInternalServerError,
-			body: RestError("internal error"),
-			err:  errors.New("some error that will only be logged"),
+		"error, in the past": {
+			req:        DevAuthApiDecommissionAt{DecommissionAt: at},
+			devAuthErr: devauth.ErrDecommissionAtPast,
+			code:       http.StatusBadRequest,
+			body:       RestError(devauth.ErrDecommissionAtPast.Error()),
+		},
+		"error, device not found": {
+			req:        DevAuthApiDecommissionAt{DecommissionAt: at},
+			devAuthErr: devauth.ErrDeviceNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrDeviceNotFound.Error()),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("RevokeToken",
+			da.On("ScheduleDecommission",
 				mtest.ContextMatcher(),
-				mock.AnythingOfType("string")).
-				Return(tc.err)
+				"dev1",
+				mock.MatchedBy(func(t time.Time) bool {
+					return t.Equal(at)
+				})).
+				Return(tc.devAuthErr)
 
 			apih := makeMockApiHandler(t, da, nil)
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			req := test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/decommission_at",
+				tc.req)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
-
 }
 
-func TestApiGetDevice(t *testing.T) {
+func TestApiDevAuthGetDevicesExport(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	dev := &model.Device{
-		Id:     "foo",
-		PubKey: "pubkey",
-		Status: model.DevStatusPending,
-	}
-	tcases := []struct {
-		req    *http.Request
-		code   int
-		body   string
-		device *model.Device
-		err    error
-	}{
+	pubkey := mtest.LoadPubKeyStr("testdata/public.pem", t)
+	edPubkey := mtest.LoadPubKeyStr("testdata/public_ed25519.pem", t)
+
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	later := ts.Add(time.Minute)
+	devs := []model.Device{
 		{
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/devauth/devices/foo", nil),
-			code:   http.StatusOK,
-			device: dev,
-			err:    nil,
-			body:   string(asJSON(dev)),
+			Id:           "dev1",
+			IdDataStruct: map[string]interface{}{"sn": "0001", "mac": "00:11"},
+			Status:       model.DevStatusAccepted,
+			CreatedTs:    ts,
+			UpdatedTs:    ts.Add(time.Hour),
+			AuthSets: []model.AuthSet{
+				{
+					Id:        "aid1",
+					PubKey:    pubkey,
+					KeyType:   "rsa",
+					Status:    model.DevStatusAccepted,
+					Timestamp: &ts,
+				},
+				{
+					Id:        "aid2",
+					PubKey:    edPubkey,
+					KeyType:   "ed25519",
+					Status:    model.DevStatusPending,
+					Timestamp: &later,
+				},
+			},
 		},
 		{
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/devauth/devices/bar", nil),
-			code: http.StatusNotFound,
-			err:  store.ErrDevNotFound,
-			body: RestError("device not found"),
+			Id:           "dev2",
+			IdDataStruct: map[string]interface{}{"sn": "0002"},
+			Status:       model.DevStatusPending,
+			CreatedTs:    ts,
+			UpdatedTs:    ts,
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
+	rsaFpr := "427219bf24916e859c9a2cab3ebe8005a85ad54829bfb95ac67e1e230c60398d"
 
-		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+	testCases := map[string]struct {
+		query string
+
+		filter store.DeviceFilter
+		devs   []model.Device
+		err    error
+
+		code        int
+		contentType string
+		body        string
+	}{
+		"ok, csv": {
+			devs:        devs,
+			code:        http.StatusOK,
+			contentType: "text/csv",
+			body: "id,identity_data,status,key_type,key_fingerprint,created_ts,updated_ts\n" +
+				`dev1,"{""mac"":""00:11"",""sn"":""0001""}",accepted,rsa,` + rsaFpr +
+				",2018-10-01T12:00:00Z,2018-10-01T13:00:00Z\n" +
+				`dev2,"{""sn"":""0002""}",pending,,,2018-10-01T12:00:00Z,2018-10-01T12:00:00Z` + "\n",
+		},
+		"ok, csv, no devices": {
+			query:       "?format=csv&status=rejected",
+			filter:      store.DeviceFilter{Status: model.DevStatusRejected},
+			code:        http.StatusOK,
+			contentType: "text/csv",
+			body:        "id,identity_data,status,key_type,key_fingerprint,created_ts,updated_ts\n",
+		},
+		"ok, ndjson": {
+			query:       "?format=ndjson&group=site-1",
+			filter:      store.DeviceFilter{Group: "site-1"},
+			devs:        devs,
+			code:        http.StatusOK,
+			contentType: "application/x-ndjson",
+			body: `{"id":"dev1","identity_data":{"mac":"00:11","sn":"0001"},` +
+				`"status":"accepted","key_type":"rsa","key_fingerprint":"` + rsaFpr + `",` +
+				`"created_ts":"2018-10-01T12:00:00Z","updated_ts":"2018-10-01T13:00:00Z"}` + "\n" +
+				`{"id":"dev2","identity_data":{"sn":"0002"},"status":"pending",` +
+				`"created_ts":"2018-10-01T12:00:00Z","updated_ts":"2018-10-01T12:00:00Z"}` + "\n",
+		},
+		"error, bad format": {
+			query: "?format=xml",
+			code:  http.StatusBadRequest,
+			body: RestError(rest_utils.MsgQueryParmOneOf("format",
+				exportFormats)),
+		},
+		"error, internal": {
+			err:  errors.New("db connection failed"),
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("GetDevice",
+			da.On("ExportDevices",
 				mtest.ContextMatcher(),
-				mock.AnythingOfType("string")).
-				Return(tc.device, tc.err)
+				tc.filter,
+				mock.AnythingOfType("func(*model.Device) error")).
+				Return(func(_ context.Context, _ store.DeviceFilter,
+					fn func(*model.Device) error) error {
+					for i := range tc.devs {
+						if err := fn(&tc.devs[i]); err != nil {
+							return err
+						}
+					}
+					return tc.err
+				})
 
 			apih := makeMockApiHandler(t, da, nil)
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices/export"+tc.query,
+				nil)
+
+			recorded := runTestRequest(t, apih, req, tc.code, tc.body)
+			if tc.contentType != "" {
+				recorded.HeaderIs("Content-Type", tc.contentType)
+			}
 		})
 	}
 }
 
-func TestApiGetDeviceV2(t *testing.T) {
+func TestApiDevAuthPostDevicesImport(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	dev := &model.Device{
-		Id:     "foo",
-		IdData: `{"mac": "00:00:00:01"}`,
-		IdDataStruct: map[string]interface{}{
-			"mac": "00:00:00:01",
-		},
-		PubKey: "pubkey",
-		Status: model.DevStatusPending,
-		AuthSets: []model.AuthSet{
-			model.AuthSet{
-				Id:       "1",
-				DeviceId: "foo",
-				IdData:   `{"mac": "00:00:00:01"}`,
-				IdDataStruct: map[string]interface{}{
-					"mac": "00:00:00:01",
-				},
-			},
+	res := &model.PreAuthImportResult{
+		Preauthorized: 1,
+		Errors: []model.PreAuthImportError{
+			{Record: 2, Error: "device already exists"},
 		},
 	}
 
-	apiDev, _ := deviceV2FromDbModel(dev)
-
-	tcases := []struct {
-		req *http.Request
+	testCases := map[string]struct {
+		query string
+		body  string
 
-		device *model.Device
+		format string
+		res    *model.PreAuthImportResult
 		err    error
 
-		code int
-		body string
+		code    int
+		resBody string
 	}{
-		{
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v2/devauth/devices/foo", nil),
-			device: dev,
-			err:    nil,
-
-			code: http.StatusOK,
-			body: string(asJSON(apiDev)),
-		},
-		{
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v2/devauth/devices/bar", nil),
-			device: nil,
-			err:    store.ErrDevNotFound,
-
-			code: http.StatusNotFound,
-			body: RestError("device not found"),
+		"ok, csv": {
+			body:    "identity_data,pubkey\n",
+			format:  model.PreAuthImportFormatCSV,
+			res:     res,
+			code:    http.StatusOK,
+			resBody: string(asJSON(res)),
 		},
-		{
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v2/devauth/devices/bar", nil),
-			device: nil,
-			err:    errors.New("generic error"),
-
-			code: http.StatusInternalServerError,
-			body: RestError("internal error"),
+		"ok, ndjson": {
+			query:   "?format=ndjson",
+			body:    "{}\n",
+			format:  model.PreAuthImportFormatNDJSON,
+			res:     res,
+			code:    http.StatusOK,
+			resBody: string(asJSON(res)),
+		},
+		"error, bad format": {
+			query: "?format=xml",
+			code:  http.StatusBadRequest,
+			resBody: RestError(rest_utils.MsgQueryParmOneOf("format",
+				importFormats)),
+		},
+		"error, csv header": {
+			body:    "id,pubkey\n",
+			code:    http.StatusBadRequest,
+			resBody: RestError("missing CSV column: identity_data"),
+		},
+		"error, input": {
+			query:   "?format=ndjson",
+			body:    "{}\n",
+			format:  model.PreAuthImportFormatNDJSON,
+			res:     res,
+			err:     devauth.MakeErrDevAuthBadRequest(errors.New("failed to read record 2: unexpected EOF")),
+			code:    http.StatusBadRequest,
+			resBody: RestError("failed to read record 2: unexpected EOF"),
+		},
+		"error, internal": {
+			query:   "?format=ndjson",
+			body:    "{}\n",
+			format:  model.PreAuthImportFormatNDJSON,
+			err:     errors.New("failed to add devices: db error"),
+			code:    http.StatusInternalServerError,
+			resBody: RestError("internal error"),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-
-		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("GetDevice",
-				mtest.ContextMatcher(),
-				mock.AnythingOfType("string")).
-				Return(tc.device, tc.err)
+			if tc.format != "" {
+				da.On("ImportPreauthorizedDevices",
+					mtest.ContextMatcher(),
+					mock.AnythingOfType("*model.PreAuthImportReader")).
+					Return(tc.res, tc.err)
+			}
 
 			apih := makeMockApiHandler(t, da, nil)
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			req, err := http.NewRequest("POST",
+				"http://1.2.3.4/api/management/v2/devauth/devices/import"+tc.query,
+				strings.NewReader(tc.body))
+			assert.NoError(t, err)
+
+			runTestRequest(t, apih, req, tc.code, tc.resBody)
+			da.AssertExpectations(t)
 		})
 	}
 }
 
-func TestApiGetDevicesV2(t *testing.T) {
+func TestApiDevAuthPatchDevice(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	devs := []model.Device{
-		{
-			Id:     "id1",
-			PubKey: "pubkey",
-			Status: model.DevStatusPending,
-		},
-		{
-			Id:     "id2",
-			PubKey: "pubkey2",
-			Status: model.DevStatusRejected,
-		},
-		{
-			Id:     "id3",
-			PubKey: "pubkey3",
-			Status: model.DevStatusRejected,
-		},
-		{
-			Id:     "id4",
-			PubKey: "pubkey4",
-			Status: model.DevStatusAccepted,
-		},
-		{
-			Id:     "id5",
-			PubKey: "pubkey5",
-			Status: model.DevStatusPreauth,
-		},
+	str := func(s string) *string {
+		return &s
 	}
 
-	outDevs, err := devicesV2FromDbModel(devs)
-	assert.NoError(t, err)
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	dev := &model.Device{
+		Id:           "dev1",
+		IdDataStruct: map[string]interface{}{"sn": "0001"},
+		Status:       model.DevStatusAccepted,
+		Group:        "site-1",
+		Alias:        "lobby-kiosk",
+		Notes:        "rejected, not ours",
+		Labels:       map[string]string{"owner": "ops"},
+		CreatedTs:    ts,
+		UpdatedTs:    ts,
+		AuthSets:     []model.AuthSet{},
+	}
+	apiDev, _ := deviceV2FromDbModel(dev)
 
-	tcases := map[string]struct {
-		req     *http.Request
-		code    int
-		body    string
-		devices []model.Device
-		err     error
-		skip    uint
-		limit   uint
+	testCases := map[string]struct {
+		req interface{}
+
+		a          *model.DeviceAnnotations
+		devAuthErr error
+		dev        *model.Device
+		devErr     error
+
+		code int
+		body string
 	}{
 		"ok": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v2/devauth/devices", nil),
-			code:    http.StatusOK,
-			devices: devs,
-			err:     nil,
-			skip:    0,
-			limit:   rest_utils.PerPageDefault + 1,
-			body:    string(asJSON(outDevs)),
+			req: map[string]interface{}{
+				"alias": "lobby-kiosk",
+				"notes": "rejected, not ours",
+				"labels": map[string]interface{}{
+					"owner": "ops",
+					"site":  nil,
+				},
+				"group": "site-1",
+			},
+			a: &model.DeviceAnnotations{
+				Alias: str("lobby-kiosk"),
+				Notes: str("rejected, not ours"),
+				Labels: map[string]*string{
+					"owner": str("ops"),
+					"site":  nil,
+				},
+				Group: str("site-1"),
+			},
+			dev:  dev,
+			code: http.StatusOK,
+			body: string(asJSON(apiDev)),
 		},
-		"no devices": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v2/devauth/devices", nil),
-			code:    http.StatusOK,
-			devices: []model.Device{},
-			skip:    0,
-			limit:   rest_utils.PerPageDefault + 1,
-			err:     nil,
-			body:    "[]",
+		"ok, notes cleared": {
+			req:  map[string]interface{}{"notes": ""},
+			a:    &model.DeviceAnnotations{Notes: str("")},
+			dev:  dev,
+			code: http.StatusOK,
+			body: string(asJSON(apiDev)),
 		},
-		// this test does not check if the devices were skipped
-		// it is only checking if endpoint limits number of devices in the response
-		"limit number of devices": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v2/devauth/devices?page=2&per_page=2", nil),
-			devices: devs,
-			skip:    2,
-			limit:   3,
-			code:    http.StatusOK,
-			// reqquested 2 devices per page, so expect only 2
-			body: string(asJSON(outDevs[:2])),
+		"ok, notes and group removed": {
+			req:  map[string]interface{}{"notes": nil, "group": nil},
+			a:    &model.DeviceAnnotations{Notes: str(""), Group: str("")},
+			dev:  dev,
+			code: http.StatusOK,
+			body: string(asJSON(apiDev)),
 		},
-		"internal error": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v2/devauth/devices?page=2&per_page=2", nil),
-			skip:  2,
-			limit: 3,
-			code:  http.StatusInternalServerError,
-			err:   errors.New("failed"),
-			body:  RestError("internal error"),
+		"ok, alias removed": {
+			req:  map[string]interface{}{"alias": nil},
+			a:    &model.DeviceAnnotations{Alias: str("")},
+			dev:  dev,
+			code: http.StatusOK,
+			body: string(asJSON(apiDev)),
+		},
+		"error, alias too long": {
+			req: map[string]interface{}{
+				"alias": strings.Repeat("a", model.DeviceAliasMaxLength+1),
+			},
+			code: http.StatusBadRequest,
+			body: RestError("alias must be at most 256 characters long"),
+		},
+		"error, unknown field": {
+			req:  map[string]interface{}{"status": "accepted"},
+			code: http.StatusBadRequest,
+			body: RestError("invalid request body: status: is not allowed"),
+		},
+		"error, nothing to update": {
+			req:  map[string]interface{}{},
+			code: http.StatusBadRequest,
+			body: RestError("alias, notes, labels or group must be provided"),
+		},
+		"error, invalid group": {
+			req:  map[string]interface{}{"group": "site 1"},
+			code: http.StatusBadRequest,
+			body: RestError("invalid request body: group: must match pattern '^[A-Za-z0-9_-]*$'"),
+		},
+		"error, invalid label": {
+			req: map[string]interface{}{
+				"labels": map[string]interface{}{"a.b": "foo"},
+			},
+			code: http.StatusBadRequest,
+			body: RestError("invalid label \"a.b\": must not be empty " +
+				"or contain '.' or '$'"),
+		},
+		"error, too many labels": {
+			req: map[string]interface{}{
+				"labels": map[string]interface{}{"owner": "ops"},
+			},
+			a: &model.DeviceAnnotations{
+				Labels: map[string]*string{"owner": str("ops")},
+			},
+			devAuthErr: devauth.ErrMaxDeviceLabelsReached,
+			code:       http.StatusBadRequest,
+			body:       RestError(devauth.ErrMaxDeviceLabelsReached.Error()),
+		},
+		"error, device not found": {
+			req:        map[string]interface{}{"notes": "foo"},
+			a:          &model.DeviceAnnotations{Notes: str("foo")},
+			devAuthErr: devauth.ErrDeviceNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrDeviceNotFound.Error()),
+		},
+		"error, device gone": {
+			req:    map[string]interface{}{"notes": "foo"},
+			a:      &model.DeviceAnnotations{Notes: str("foo")},
+			devErr: store.ErrDevNotFound,
+			code:   http.StatusNotFound,
+			body:   RestError(store.ErrDevNotFound.Error()),
+		},
+		"error, get device": {
+			req:    map[string]interface{}{"notes": "foo"},
+			a:      &model.DeviceAnnotations{Notes: str("foo")},
+			devErr: errors.New("db error"),
+			code:   http.StatusInternalServerError,
+			body:   RestError("internal error"),
 		},
 	}
 
-	for name := range tcases {
-		tc := tcases[name]
-		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("GetDevices",
-				mtest.ContextMatcher(),
-				tc.skip, tc.limit, mock.AnythingOfType("store.DeviceFilter")).Return(
-				tc.devices, tc.err)
+			if tc.a != nil {
+				da.On("UpdateDeviceAnnotations",
+					mtest.ContextMatcher(),
+					"dev1",
+					tc.a).
+					Return(tc.devAuthErr)
+			}
+			if tc.dev != nil || tc.devErr != nil {
+				da.On("GetDevice",
+					mtest.ContextMatcher(),
+					"dev1").
+					Return(tc.dev, tc.devErr)
+			}
 
 			apih := makeMockApiHandler(t, da, nil)
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			req := test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1",
+				tc.req)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
+			da.AssertExpectations(t)
 		})
 	}
 }
 
-func TestApiGetDevices(t *testing.T) {
+func TestApiDevAuthDeleteDecommissionAt(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	devs := []model.Device{
-		{
-			Id:     "foo",
-			PubKey: "pubkey",
-			Status: model.DevStatusPending,
-		},
-		{
-			Id:     "bar",
-			PubKey: "pubkey2",
-			Status: model.DevStatusRejected,
-		},
-		{
-			Id:     "baz",
-			PubKey: "pubkey3",
-			Status: model.DevStatusRejected,
-		},
-	}
+	testCases := map[string]struct {
+		devAuthErr error
 
-	tcases := []struct {
-		req     *http.Request
-		code    int
-		body    string
-		devices []model.Device
-		err     error
-		skip    uint
-		limit   uint
+		code int
+		body string
 	}{
-		{
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/devauth/devices", nil),
-			code:    http.StatusOK,
-			devices: devs,
-			err:     nil,
-			skip:    0,
-			limit:   rest_utils.PerPageDefault + 1,
-			body:    string(asJSON(devs)),
-		},
-		{
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/devauth/devices", nil),
-			code:    http.StatusOK,
-			devices: []model.Device{},
-			skip:    0,
-			limit:   rest_utils.PerPageDefault + 1,
-			err:     nil,
-			body:    "[]",
-		},
-		{
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/devauth/devices?page=2&per_page=2", nil),
-			devices: devs,
-			skip:    2,
-			limit:   3,
-			code:    http.StatusOK,
-			// reqquested 2 devices per page, so expect only 2
-			body: string(asJSON(devs[:2])),
+		"ok": {
+			code: http.StatusNoContent,
 		},
-		{
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/devauth/devices?page=2&per_page=2", nil),
-			skip:  2,
-			limit: 3,
-			code:  http.StatusInternalServerError,
-			err:   errors.New("failed"),
-			body:  RestError("internal error"),
+		"error, device not found": {
+			devAuthErr: devauth.ErrDeviceNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrDeviceNotFound.Error()),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %v", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("GetDevices",
+			da.On("CancelScheduledDecommission",
 				mtest.ContextMatcher(),
-				tc.skip, tc.limit, mock.AnythingOfType("store.DeviceFilter")).Return(
-				tc.devices, tc.err)
+				"dev1").
+				Return(tc.devAuthErr)
 
 			apih := makeMockApiHandler(t, da, nil)
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			req := test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/decommission_at",
+				nil)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
 }
 
-func asJSON(sth interface{}) []byte {
-	data, _ := json.Marshal(sth)
-	return data
-}
-
-func TestApiDevAuthDecommissionDevice(t *testing.T) {
+func TestApiDevAuthPutDeviceGroup(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := []struct {
-		req  *http.Request
+	testCases := map[string]struct {
+		req interface{}
+
+		group      string
+		devAuthErr error
+
 		code int
 		body string
-		err  error
 	}{
-		{
-			req: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/management/v1/devauth/devices/foo", nil),
-			code: http.StatusNoContent,
-			err:  nil,
+		"ok": {
+			req:   DevAuthApiGroup{Group: "site-1"},
+			group: "site-1",
+			code:  http.StatusNoContent,
 		},
-		{
-			req: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/management/v1/devauth/devices/foo", nil),
-			code: http.StatusNotFound,
-			err:  store.ErrDevNotFound,
+		"error, no group": {
+			req:  map[string]string{},
+			code: http.StatusBadRequest,
+			body: RestError("invalid request body: group: is required"),
 		},
-		{
-			req: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/management/v1/devauth/devices/foo", nil),
-			code: http.StatusInternalServerError,
-			body: RestError("internal error"),
-			err:  errors.New("some error that will only be logged"),
+		"error, invalid group": {
+			req:  DevAuthApiGroup{Group: "site 1"},
+			code: http.StatusBadRequest,
+			body: RestError("invalid request body: group: " +
+				"must match pattern '^[A-Za-z0-9_-]+$'"),
+		},
+		"error, device not found": {
+			req:        DevAuthApiGroup{Group: "site-1"},
+			group:      "site-1",
+			devAuthErr: devauth.ErrDeviceNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrDeviceNotFound.Error()),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("DecommissionDevice",
-				mtest.ContextMatcher(),
-				mock.AnythingOfType("string")).
-				Return(tc.err)
+			if tc.group != "" {
+				da.On("SetDeviceGroup",
+					mtest.ContextMatcher(),
+					"dev1",
+					tc.group).
+					Return(tc.devAuthErr)
+			}
 
 			apih := makeMockApiHandler(t, da, nil)
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			req := test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/group",
+				tc.req)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
 }
 
-func TestApiDevAuthPutTenantLimit(t *testing.T) {
+func TestApiDevAuthDeleteDeviceGroup(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := []struct {
-		req    *http.Request
-		code   int
-		body   string
-		tenant string
-		limit  model.Limit
-		err    error
+	testCases := map[string]struct {
+		devAuthErr error
+
+		code int
+		body string
 	}{
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/internal/v1/devauth/tenant/foo/limits/max_devices",
-				map[string]int{
-					"limit": 123,
-				}),
-			limit: model.Limit{
-				Name:  model.LimitMaxDeviceCount,
-				Value: 123,
-			},
-			tenant: "foo",
-			code:   http.StatusNoContent,
-		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/internal/v1/devauth/tenant/foo/limits/max_devices",
-				[]string{"garbage"}),
-			code: http.StatusBadRequest,
-			body: RestError("failed to decode limit request: json: cannot unmarshal array into Go value of type http.LimitValue"),
-		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/internal/v1/devauth/tenant/foo/limits/bogus-limit",
-				map[string]int{
-					"limit": 123,
-				}),
-			code: http.StatusBadRequest,
-			body: RestError("unsupported limit bogus-limit"),
+		"ok": {
+			code: http.StatusNoContent,
 		},
-		{
-			req: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/internal/v1/devauth/tenant/foo/limits/max_devices",
-				map[string]int{
-					"limit": 123,
-				}),
-			tenant: "foo",
-			limit:  model.Limit{Name: model.LimitMaxDeviceCount, Value: 123},
-			code:   http.StatusInternalServerError,
-			err:    errors.New("failed"),
-			body:   RestError("internal error"),
+		"error, device not found": {
+			devAuthErr: devauth.ErrDeviceNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrDeviceNotFound.Error()),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("SetTenantLimit",
+			da.On("SetDeviceGroup",
 				mtest.ContextMatcher(),
-				tc.tenant,
-				tc.limit).
-				Return(tc.err)
+				"dev1",
+				"").
+				Return(tc.devAuthErr)
 
 			apih := makeMockApiHandler(t, da, nil)
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			req := test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/group",
+				nil)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
 }
 
-func TestApiDevAuthGetLimit(t *testing.T) {
+func TestApiDevAuthGetDeviceAuthSet(t *testing.T) {
 	t.Parallel()
 
-	// enforce specific field naming in errors returned by API
-	updateRestErrorFieldName()
-
-	tcases := []struct {
-		limit string
-
-		daLimit *model.Limit
-		daErr   error
-
-		code int
-		body string
-	}{
-		{
-			limit: "max_devices",
-
-			daLimit: &model.Limit{
-				Name:  model.LimitMaxDeviceCount,
-				Value: 123,
-			},
-			daErr: nil,
-
-			code: http.StatusOK,
-			body: string(asJSON(
-				LimitValue{
-					Limit: 123,
-				},
-			)),
-		},
-		{
-			limit: "bogus",
-
-			code: http.StatusBadRequest,
-			body: RestError("unsupported limit bogus"),
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	ts := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	aset := &model.AuthSet{
+		Id:           "aid1",
+		IdData:       `{"sn":"0001"}`,
+		IdDataStruct: map[string]interface{}{"sn": "0001"},
+		PubKey:       "key1",
+		DeviceId:     "dev1",
+		Timestamp:    &ts,
+		Status:       model.DevStatusPending,
+		FirstRequest: &model.AuthSetRequest{
+			SourceIP:  "192.168.1.2",
+			UserAgent: "mender/1.7.0",
+			RequestId: "req1",
 		},
-		{
-			limit: "max_devices",
+	}
+	out, err := authSetV2FromDbModel(aset)
+	assert.NoError(t, err)
 
-			daLimit: nil,
-			daErr:   errors.New("generic error"),
+	testCases := map[string]struct {
+		aset       *model.AuthSet
+		devAuthErr error
 
-			code: http.StatusInternalServerError,
-			body: RestError("internal error"),
+		code int
+		body string
+	}{
+		"ok": {
+			aset: aset,
+			code: http.StatusOK,
+			body: string(asJSON(out)),
+		},
+		"error, auth set not found": {
+			devAuthErr: devauth.ErrAuthSetNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrAuthSetNotFound.Error()),
+		},
+		"error, internal": {
+			devAuthErr: errors.New("db connection failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			req := test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/devauth/limits/"+tc.limit,
-				nil)
-
 			da := &mocks.App{}
-			da.On("GetLimit",
+			da.On("GetDeviceAuthSet",
 				mtest.ContextMatcher(),
-				tc.limit).
-				Return(tc.daLimit, tc.daErr)
+				"dev1", "aid1").
+				Return(tc.aset, tc.devAuthErr)
 
 			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/auth/aid1",
+				nil)
+
 			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
 }
 
-func TestApiDevAuthGetTenantLimit(t *testing.T) {
+func TestApiDevAuthResolveAuthSetConflict(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := []struct {
-		limit    string
-		tenantId string
+	testCases := map[string]struct {
+		body interface{}
 
-		daLimit *model.Limit
-		daErr   error
+		others     string
+		devAuthErr error
 
 		code int
-		body string
+		resp string
 	}{
-		{
-			limit:    "max_devices",
-			tenantId: "tenant-foo",
-
-			daLimit: &model.Limit{
-				Name:  model.LimitMaxDeviceCount,
-				Value: 123,
-			},
-			daErr: nil,
-
-			code: http.StatusOK,
-			body: string(asJSON(
-				LimitValue{
-					Limit: 123,
-				},
-			)),
+		"ok, reject": {
+			body:   map[string]string{"others": "reject"},
+			others: model.ConflictOthersReject,
+			code:   http.StatusNoContent,
 		},
-		{
-			limit:    "bogus",
-			tenantId: "tenant-foo",
-
+		"ok, decommission": {
+			body:   map[string]string{"others": "decommission"},
+			others: model.ConflictOthersDecommission,
+			code:   http.StatusNoContent,
+		},
+		"error, bad others": {
+			body: map[string]string{"others": "dismiss"},
 			code: http.StatusBadRequest,
-			body: RestError("unsupported limit bogus"),
+			resp: RestError("invalid request body: others: must be one of: reject, decommission"),
 		},
-		{
-			limit:    "max_devices",
-			tenantId: "tenant-foo",
-
-			daLimit: nil,
-			daErr:   errors.New("generic error"),
-
-			code: http.StatusInternalServerError,
-			body: RestError("internal error"),
+		"error, no body": {
+			code: http.StatusBadRequest,
+			resp: RestError("failed to decode conflict resolution: JSON payload is empty"),
+		},
+		"error, no conflict": {
+			body:       map[string]string{"others": "reject"},
+			others:     model.ConflictOthersReject,
+			devAuthErr: devauth.ErrAuthSetNoConflict,
+			code:       http.StatusConflict,
+			resp:       RestError(devauth.ErrAuthSetNoConflict.Error()),
+		},
+		"error, auth set not found": {
+			body:       map[string]string{"others": "reject"},
+			others:     model.ConflictOthersReject,
+			devAuthErr: devauth.ErrAuthSetNotFound,
+			code:       http.StatusNotFound,
+			resp:       RestError(devauth.ErrAuthSetNotFound.Error()),
+		},
+		"error, device not found": {
+			body:       map[string]string{"others": "reject"},
+			others:     model.ConflictOthersReject,
+			devAuthErr: store.ErrDevNotFound,
+			code:       http.StatusNotFound,
+			resp:       RestError(store.ErrDevNotFound.Error()),
+		},
+		"error, internal": {
+			body:       map[string]string{"others": "reject"},
+			others:     model.ConflictOthersReject,
+			devAuthErr: errors.New("db connection failed"),
+			code:       http.StatusInternalServerError,
+			resp:       RestError("internal error"),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			req := test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/internal/v1/devauth/tenant/"+
-					tc.tenantId+
-					"/limits/"+
-					tc.limit,
-
-				nil)
-
 			da := &mocks.App{}
-			da.On("GetTenantLimit",
+			da.On("ResolveAuthSetConflict",
 				mtest.ContextMatcher(),
-				tc.limit,
-				tc.tenantId).
-				Return(tc.daLimit, tc.daErr)
+				"dev1", "aid1", tc.others).
+				Return(tc.devAuthErr)
 
 			apih := makeMockApiHandler(t, da, nil)
-			runTestRequest(t, apih, req, tc.code, tc.body)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/auth/aid1/resolve_conflict",
+				tc.body)
+
+			runTestRequest(t, apih, req, tc.code, tc.resp)
 		})
 	}
 }
 
-func TestApiDevAuthGetDevicesCount(t *testing.T) {
+func TestApiDevAuthQuarantineDevice(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := []struct {
-		req    *http.Request
-		status string
-
-		daCnt int
-		daErr error
+	testCases := map[string]struct {
+		method     string
+		devAuthErr error
 
 		code int
-		body string
+		resp string
 	}{
-		{
-			status: "pending",
+		"ok, quarantine": {
+			method: "PUT",
+			code:   http.StatusNoContent,
+		},
+		"ok, release": {
+			method: "DELETE",
+			code:   http.StatusNoContent,
+		},
+		"error, quarantine, device not found": {
+			method:     "PUT",
+			devAuthErr: devauth.ErrDeviceNotFound,
+			code:       http.StatusNotFound,
+			resp:       RestError(devauth.ErrDeviceNotFound.Error()),
+		},
+		"error, quarantine, internal": {
+			method:     "PUT",
+			devAuthErr: errors.New("db connection failed"),
+			code:       http.StatusInternalServerError,
+			resp:       RestError("internal error"),
+		},
+		"error, release, not quarantined": {
+			method:     "DELETE",
+			devAuthErr: devauth.ErrDeviceNotQuarantined,
+			code:       http.StatusConflict,
+			resp:       RestError(devauth.ErrDeviceNotQuarantined.Error()),
+		},
+		"error, release, device not found": {
+			method:     "DELETE",
+			devAuthErr: devauth.ErrDeviceNotFound,
+			code:       http.StatusNotFound,
+			resp:       RestError(devauth.ErrDeviceNotFound.Error()),
+		},
+	}
 
-			daCnt: 5,
-			daErr: nil,
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-			code: http.StatusOK,
-			body: string(asJSON(
-				model.Count{
-					Count: 5,
-				},
-			)),
-		},
-		{
-			status: "accepted",
+			da := &mocks.App{}
+			da.On("QuarantineDevice", mtest.ContextMatcher(), "dev1").
+				Return(tc.devAuthErr)
+			da.On("ReleaseDeviceQuarantine", mtest.ContextMatcher(), "dev1").
+				Return(tc.devAuthErr)
 
-			daCnt: 0,
-			daErr: nil,
+			apih := makeMockApiHandler(t, da, nil)
 
-			code: http.StatusOK,
-			body: string(asJSON(
-				model.Count{
-					Count: 0,
-				},
-			)),
-		},
-		{
-			status: "rejected",
+			req := test.MakeSimpleRequest(tc.method,
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/quarantine",
+				nil)
 
-			daCnt: 4,
-			daErr: nil,
+			runTestRequest(t, apih, req, tc.code, tc.resp)
 
-			code: http.StatusOK,
-			body: string(asJSON(
-				model.Count{
-					Count: 4,
-				},
-			)),
-		},
-		{
-			status: model.DevStatusPreauth,
+			if tc.method == "PUT" {
+				da.AssertNotCalled(t, "ReleaseDeviceQuarantine",
+					mock.Anything, mock.Anything)
+			} else {
+				da.AssertNotCalled(t, "QuarantineDevice",
+					mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
 
-			daCnt: 7,
-			daErr: nil,
+func TestApiDevAuthGetDeviceKeys(t *testing.T) {
+	t.Parallel()
 
-			code: http.StatusOK,
-			body: string(asJSON(
-				model.Count{
-					Count: 7,
-				},
-			)),
-		},
-		{
-			status: "",
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
 
-			daCnt: 10,
-			daErr: nil,
+	ts := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys := []model.DeviceKey{
+		{Id: "aid1", PubKey: "key1", KeyType: "rsa", Timestamp: &ts},
+		{Id: "aid2", PubKey: "key2", KeyType: "ed25519", Timestamp: &ts},
+	}
 
+	testCases := map[string]struct {
+		keys       []model.DeviceKey
+		devAuthErr error
+
+		code int
+		body string
+	}{
+		"ok": {
+			keys: keys,
 			code: http.StatusOK,
-			body: string(asJSON(
-				model.Count{
-					Count: 10,
-				},
-			)),
+			body: string(asJSON(keys)),
 		},
-		{
-			status: "bogus",
-
-			code: http.StatusBadRequest,
-			body: RestError("status must be one of: pending, accepted, rejected, preauthorized"),
+		"error, device not found": {
+			devAuthErr: devauth.ErrDeviceNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrDeviceNotFound.Error()),
 		},
-		{
-			status: "accepted",
-
-			daErr: errors.New("generic error"),
-
-			code: http.StatusInternalServerError,
-			body: RestError("internal error"),
+		"error, internal": {
+			devAuthErr: errors.New("db connection failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			url := "http://1.2.3.4/api/management/v1/devauth/devices/count"
-			if tc.status != "" {
-				url += "?status=" + tc.status
-			}
-
-			req := test.MakeSimpleRequest("GET", url, nil)
-
 			da := &mocks.App{}
-			da.On("GetDevCountByStatus",
+			da.On("GetDeviceKeys",
 				mtest.ContextMatcher(),
-				tc.status).
-				Return(tc.daCnt, tc.daErr)
+				"dev1").
+				Return(tc.keys, tc.devAuthErr)
 
 			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/keys",
+				nil)
+
 			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
 }
 
-func TestApiDevAuthPostTenants(t *testing.T) {
+func TestApiDevAuthGetDeviceTokens(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	ts := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	tokens := []model.DeviceToken{
+		{Id: "jti1", AuthSetId: "aid1", LastUsed: &ts},
+		{Id: "jti2", AuthSetId: "aid2", ExpiresAt: &ts},
+	}
+
 	testCases := map[string]struct {
-		req        *http.Request
+		tokens     []model.DeviceToken
 		devAuthErr error
-		respCode   int
-		respBody   string
+
+		code int
+		body string
 	}{
 		"ok": {
-			req: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/devauth/tenants",
-				model.NewTenant{TenantId: "foo"}),
-			respCode: 201,
-			respBody: "",
-		},
-		"error: empty request": {
-			req: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/devauth/tenants",
-				nil),
-			respCode: 400,
-			respBody: RestError("EOF"),
-		},
-		"error: no tenant_id": {
-			req: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/devauth/tenants",
-				model.NewTenant{TenantId: ""},
-			),
-			respCode: 400,
-			respBody: RestError("tenant_id must be provided"),
-		},
-		"error: generic": {
-			req: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/devauth/tenants",
-				model.NewTenant{TenantId: "foo"},
-			),
-			devAuthErr: errors.New("can't provision tenant"),
-			respCode:   500,
-			respBody:   RestError("internal error"),
+			tokens: tokens,
+			code:   http.StatusOK,
+			body:   string(asJSON(tokens)),
+		},
+		"error, device not found": {
+			devAuthErr: devauth.ErrDeviceNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrDeviceNotFound.Error()),
+		},
+		"error, internal": {
+			devAuthErr: errors.New("db connection failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
 		},
 	}
 
 	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
-		da := &mocks.App{}
-
-		da.On("ProvisionTenant",
-			mock.MatchedBy(func(c context.Context) bool { return true }),
-			mock.AnythingOfType("string")).Return(tc.devAuthErr)
-
-		apih := makeMockApiHandler(t, da, nil)
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-		rest.ErrorFieldName = "error"
+			da := &mocks.App{}
+			da.On("GetDeviceTokens",
+				mtest.ContextMatcher(),
+				"dev1").
+				Return(tc.tokens, tc.devAuthErr)
 
-		runTestRequest(t, apih, tc.req, tc.respCode, tc.respBody)
-	}
-}
+			apih := makeMockApiHandler(t, da, nil)
 
-func makeReq(method, url, auth string, body interface{}) *http.Request {
-	req := test.MakeSimpleRequest(method, url, body)
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/tokens",
+				nil)
 
-	if auth != "" {
-		req.Header.Set("Authorization", auth)
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
 	}
-	req.Header.Add(requestid.RequestIdHeader, "test")
-
-	return req
-}
-
-func restError(status string) map[string]interface{} {
-	return map[string]interface{}{"error": status, "request_id": "test"}
 }
 
-func TestApiDevAuthDeleteDeviceAuthSet(t *testing.T) {
+func TestApiDevAuthPostBootstrapToken(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := []struct {
-		req  *http.Request
+	token := &model.NewBootstrapToken{
+		Token:     "token",
+		ExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	testCases := map[string]struct {
+		body interface{}
+
+		devAuthReq *model.BootstrapTokenReq
+		devAuthRes *model.NewBootstrapToken
+		devAuthErr error
+
 		code int
-		body string
-		err  error
+		resp string
 	}{
-		{
-			req: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/management/v1/devauth/devices/foo/auth/bar", nil),
-			code: http.StatusNoContent,
-			err:  nil,
-		},
-		{
-			req: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/management/v1/devauth/devices/foo/auth/bar", nil),
-			code: http.StatusInternalServerError,
-			body: RestError("internal error"),
-			err:  store.ErrAuthSetNotFound,
+		"ok": {
+			body: map[string]interface{}{
+				"identity_data": map[string]interface{}{"sn": "0001"},
+				"expires_in":    600,
+			},
+			devAuthReq: &model.BootstrapTokenReq{
+				IdData:    map[string]interface{}{"sn": "0001"},
+				ExpiresIn: 600,
+			},
+			devAuthRes: token,
+			code:       http.StatusCreated,
+			resp:       string(asJSON(token)),
 		},
-		{
-			req: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/management/v1/devauth/devices/foo/auth/bar", nil),
-			code: http.StatusNotFound,
-			err:  store.ErrDevNotFound,
+		"error, no identity data": {
+			body: map[string]interface{}{
+				"identity_data": map[string]interface{}{},
+			},
+			code: http.StatusBadRequest,
+			resp: RestError("invalid request body: identity_data: must have at least 1 properties"),
 		},
-		{
-			req: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/management/v1/devauth/devices/foo/auth/bar", nil),
-			code: http.StatusInternalServerError,
-			body: RestError("internal error"),
-			err:  errors.New("some error that will only be logged"),
+		"error, internal": {
+			body: map[string]interface{}{
+				"identity_data": map[string]interface{}{"sn": "0001"},
+			},
+			devAuthReq: &model.BootstrapTokenReq{
+				IdData: map[string]interface{}{"sn": "0001"},
+			},
+			devAuthErr: errors.New("db connection failed"),
+			code:       http.StatusInternalServerError,
+			resp:       RestError("internal error"),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("DeleteAuthSet",
-				mtest.ContextMatcher(),
-				"foo",
-				"bar").
-				Return(tc.err)
+			if tc.devAuthReq != nil {
+				da.On("CreateBootstrapToken",
+					mtest.ContextMatcher(),
+					tc.devAuthReq).
+					Return(tc.devAuthRes, tc.devAuthErr)
+			}
 
 			apih := makeMockApiHandler(t, da, nil)
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/devauth/bootstrap_tokens",
+				tc.body)
+
+			recorded := runTestRequest(t, apih, req, tc.code, tc.resp)
+			if tc.code == http.StatusCreated {
+				assert.Equal(t, "no-store",
+					recorded.Recorder.Header().Get("Cache-Control"))
+			}
+			da.AssertExpectations(t)
 		})
 	}
 }
 
-func TestApiDeleteTokens(t *testing.T) {
+func TestApiDevAuthRevokeDeviceKey(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := map[string]struct {
-		tenantId string
-		deviceId string
-
+	testCases := map[string]struct {
 		devAuthErr error
 
-		checker mt.ResponseChecker
+		code int
+		body string
 	}{
-		"ok, all tokens": {
-			tenantId: "foo",
-			checker: mt.NewJSONResponse(
-				http.StatusNoContent,
-				nil,
-				nil),
-		},
-		"ok, device's tokens": {
-			tenantId: "foo",
-			deviceId: "dev-foo",
-			checker: mt.NewJSONResponse(
-				http.StatusNoContent,
-				nil,
-				nil),
+		"ok": {
+			code: http.StatusNoContent,
 		},
-		"error, no tenant id": {
-			deviceId: "dev-foo",
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("tenant_id must be provided")),
+		"error, key not found": {
+			devAuthErr: devauth.ErrDeviceKeyNotFound,
+			code:       http.StatusNotFound,
+			body:       RestError(devauth.ErrDeviceKeyNotFound.Error()),
 		},
-		"error, devauth": {
-			tenantId:   "foo",
-			devAuthErr: errors.New("generic error"),
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error")),
+		"error, internal": {
+			devAuthErr: errors.New("db connection failed"),
+			code:       http.StatusInternalServerError,
+			body:       RestError("internal error"),
 		},
 	}
 
-	for n := range tcases {
-		tc := tcases[n]
-		t.Run(fmt.Sprintf("tc %s", n), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("DeleteTokens",
+			da.On("RevokeDeviceKey",
 				mtest.ContextMatcher(),
-				tc.tenantId,
-				tc.deviceId).
+				"dev1", "aid1").
 				Return(tc.devAuthErr)
 
-			//make request
-			url := fmt.Sprintf("http://1.2.3.4/api/internal/v1/devauth/tokens?tenant_id=%v&device_id=%v",
-				tc.tenantId,
-				tc.deviceId)
+			apih := makeMockApiHandler(t, da, nil)
 
-			req := makeReq("DELETE",
-				url,
-				"",
+			req := test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/keys/aid1",
 				nil)
 
-			apih := makeMockApiHandler(t, da, nil)
-
-			recorded := test.RunRequest(t, apih, req)
-			mt.CheckResponse(t, tc.checker, recorded)
+			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
 }
 
-func TestApiDevAuthGetTenantDeviceStatus(t *testing.T) {
+func TestApiDevAuthGetDecommissions(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := map[string]struct {
-		tid string
-		did string
+	at := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	devs := []model.Device{
+		{Id: "dev1", DecommissionAt: &at},
+		{Id: "dev2", DecommissionAt: &at},
+		{Id: "dev3", DecommissionAt: &at},
+	}
 
-		daStatus *model.Status
-		daErr    error
+	outDevs, err := devicesV2FromDbModel(devs)
+	assert.NoError(t, err)
 
-		checker mt.ResponseChecker
+	testCases := map[string]struct {
+		query string
+
+		skip  uint64
+		limit uint64
+		devs  []model.Device
+		err   error
+
+		code int
+		body string
 	}{
 		"ok": {
-			tid: "foo",
-			did: "bar",
+			skip:  0,
+			limit: rest_utils.PerPageDefault + 1,
+			devs:  devs,
+			code:  http.StatusOK,
+			body:  string(asJSON(outDevs)),
+		},
+		"ok, paging": {
+			query: "?page=2&per_page=2",
+			skip:  2,
+			limit: 3,
+			devs:  devs,
+			code:  http.StatusOK,
+			body:  string(asJSON(outDevs[:2])),
+		},
+		"error, bad paging": {
+			query: "?page=foo",
+			code:  http.StatusBadRequest,
+			body:  RestError(rest_utils.MsgQueryParmInvalid("page")),
+		},
+		"error, internal": {
+			skip:  0,
+			limit: rest_utils.PerPageDefault + 1,
+			err:   errors.New("db connection failed"),
+			code:  http.StatusInternalServerError,
+			body:  RestError("internal error"),
+		},
+	}
 
-			daStatus: &model.Status{Status: "accepted"},
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-			checker: mt.NewJSONResponse(
-				http.StatusOK,
-				nil,
-				model.Status{Status: "accepted"}),
-		},
-		"error: tenant id empty": {
-			did: "bar",
+			da := &mocks.App{}
+			da.On("GetScheduledDecommissions",
+				mtest.ContextMatcher(),
+				uint(tc.skip), uint(tc.limit)).
+				Return(tc.devs, tc.err)
 
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("tenant id (tid) cannot be empty")),
-		},
-		"error: device id empty": {
-			tid: "foo",
+			apih := makeMockApiHandler(t, da, nil)
 
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("device id (did) cannot be empty")),
-		},
-		"error: not found": {
-			tid: "foo",
-			did: "bar",
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/decommissions"+tc.query,
+				nil)
 
-			daErr: devauth.ErrDeviceNotFound,
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
 
-			checker: mt.NewJSONResponse(
-				http.StatusNotFound,
-				nil,
-				restError("device not found")),
-		},
-		"error: generic": {
-			tid: "foo",
-			did: "bar",
+func TestApiDevAuthGetDeviceEvents(t *testing.T) {
+	// not parallel, the poll interval is shortened for the test
+	defer func(d time.Duration) {
+		deviceEventsPollInterval = d
+	}(deviceEventsPollInterval)
+	deviceEventsPollInterval = time.Millisecond
 
-			daErr: errors.New("generic error"),
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
 
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error")),
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	changes := []model.DeviceStatusChange{
+		{
+			Id:        "c1",
+			DeviceId:  "dev1",
+			To:        model.DevStatusPending,
+			Timestamp: ts,
+		},
+		{
+			Id:        "c2",
+			DeviceId:  "dev1",
+			From:      model.DevStatusPending,
+			To:        model.DevStatusAccepted,
+			UserId:    "user1",
+			Timestamp: ts.Add(time.Second),
 		},
 	}
 
-	for i := range tcases {
-		tc := tcases[i]
-		t.Run(fmt.Sprintf("tc %s", i), func(t *testing.T) {
-			t.Parallel()
+	event := func(name string, c model.DeviceStatusChange) string {
+		return "id: " + store.StatusChangeCursor(&c).Encode() + "\n" +
+			"event: " + name + "\n" +
+			"data: " + string(asJSON(c)) + "\n\n"
+	}
 
-			req := makeReq("GET",
-				fmt.Sprintf("http://1.2.3.4/api/internal/v1/devauth/tenants/%s/devices/%s/status", tc.tid, tc.did),
-				"",
-				nil)
+	resume := store.StatusChangeCursor(&changes[0])
+	otherSort := store.TokenAuditCursor(&model.TokenAuditRecord{Id: "r1"})
+
+	tcases := map[string]struct {
+		lastEventId string
+
+		changes []model.DeviceStatusChange
+		err     error
+
+		// cursor of the first fetch, from now if nil
+		after *store.Cursor
 
+		code int
+		body string
+	}{
+		"ok": {
+			changes: changes,
+			code:    http.StatusOK,
+			body: event("created", changes[0]) +
+				event("accepted", changes[1]),
+		},
+		"ok, resumed": {
+			lastEventId: resume.Encode(),
+			changes:     changes[1:],
+			after:       resume,
+			code:        http.StatusOK,
+			body:        event("accepted", changes[1]),
+		},
+		"error, stream ends": {
+			err:  errors.New("db failed"),
+			code: http.StatusOK,
+		},
+		"error, invalid Last-Event-ID": {
+			lastEventId: "foo",
+			code:        http.StatusBadRequest,
+			body:        RestError("invalid Last-Event-ID: invalid cursor"),
+		},
+		"error, Last-Event-ID of another listing": {
+			lastEventId: otherSort.Encode(),
+			code:        http.StatusBadRequest,
+			body:        RestError("invalid Last-Event-ID: cursor doesn't match the sort order"),
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// the changes are returned by the first fetch; the stream
+			// is closed on the next one, which has to follow them
+			var calls []*store.Cursor
 			da := &mocks.App{}
-			da.On("GetTenantDeviceStatus",
+			da.On("GetDeviceStatusChanges",
 				mtest.ContextMatcher(),
-				tc.tid,
-				tc.did,
-			).Return(tc.daStatus, tc.daErr)
+				mock.AnythingOfType("*store.Cursor"),
+				uint(deviceEventsBatch)).
+				Return(
+					func(_ context.Context, after *store.Cursor, _ uint) []model.DeviceStatusChange {
+						calls = append(calls, after)
+						if len(calls) > 1 {
+							cancel()
+							return nil
+						}
+						return tc.changes
+					},
+					func(_ context.Context, _ *store.Cursor, _ uint) error {
+						if len(calls) > 1 {
+							return context.Canceled
+						}
+						return tc.err
+					})
 
 			apih := makeMockApiHandler(t, da, nil)
 
-			recorded := test.RunRequest(t, apih, req)
-			mt.CheckResponse(t, tc.checker, recorded)
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v1/devauth/devices/events", nil)
+			if tc.lastEventId != "" {
+				req.Header.Set("Last-Event-ID", tc.lastEventId)
+			}
+			req = req.WithContext(ctx)
+
+			rec := runTestRequest(t, apih, req, tc.code, tc.body)
+			if tc.code != http.StatusOK {
+				return
+			}
+			rec.HeaderIs("Content-Type", "text/event-stream")
+
+			if tc.after != nil {
+				assert.Equal(t, tc.after, calls[0])
+			} else {
+				assert.Equal(t, store.StatusChangeSort, calls[0].Sort)
+				assert.NotNil(t, calls[0].Ts)
+			}
+			if tc.err == nil {
+				assert.Len(t, calls, 2)
+				last := tc.changes[len(tc.changes)-1]
+				assert.Equal(t, store.StatusChangeCursor(&last), calls[1])
+			}
 		})
 	}
 }
 
-func TestApiDevAuthDevAdmGetDevices(t *testing.T) {
+func TestApiDevAuthGetDeviceStatusHistory(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := map[string]struct {
-		skip   int
-		limit  int
-		filter store.AuthSetFilter
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	changes := []model.DeviceStatusChange{
+		{
+			Id:        "c3",
+			DeviceId:  "dev1",
+			From:      model.DevStatusAccepted,
+			To:        model.DevStatusRejected,
+			UserId:    "user1",
+			SourceIP:  "10.0.0.1",
+			Timestamp: ts.Add(time.Hour),
+		},
+		{
+			Id:        "c2",
+			DeviceId:  "dev1",
+			From:      model.DevStatusPending,
+			To:        model.DevStatusAccepted,
+			UserId:    "user1",
+			Timestamp: ts.Add(time.Minute),
+		},
+		{
+			Id:        "c1",
+			DeviceId:  "dev1",
+			To:        model.DevStatusPending,
+			Timestamp: ts,
+		},
+	}
 
-		getAuthSetsRes []model.DevAdmAuthSet
-		getAuthSetsErr error
+	testCases := map[string]struct {
+		query string
 
-		req *http.Request
+		skip    uint64
+		limit   uint64
+		changes []model.DeviceStatusChange
+		err     error
 
-		code  int
-		body  string
-		links []string
+		code int
+		body string
 	}{
-		"valid pagination, no next page": {
-			skip:  15,
-			limit: 6,
+		"ok": {
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			changes: changes,
+			code:    http.StatusOK,
+			body:    string(asJSON(changes)),
+		},
+		"ok, paging": {
+			query:   "?page=2&per_page=2",
+			skip:    2,
+			limit:   3,
+			changes: changes,
+			code:    http.StatusOK,
+			body:    string(asJSON(changes[:2])),
+		},
+		"ok, empty": {
+			skip:    0,
+			limit:   rest_utils.PerPageDefault + 1,
+			changes: []model.DeviceStatusChange{},
+			code:    http.StatusOK,
+			body:    "[]",
+		},
+		"error, bad paging": {
+			query: "?per_page=foo",
+			code:  http.StatusBadRequest,
+			body:  RestError(rest_utils.MsgQueryParmInvalid("per_page")),
+		},
+		"error, internal": {
+			skip:  0,
+			limit: rest_utils.PerPageDefault + 1,
+			err:   errors.New("db connection failed"),
+			code:  http.StatusInternalServerError,
+			body:  RestError("internal error"),
+		},
+	}
 
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/admission/devices?page=4&per_page=5", nil),
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-			getAuthSetsRes: mockAuthSets(5),
+			da := &mocks.App{}
+			da.On("GetDeviceStatusHistory",
+				mtest.ContextMatcher(), "dev1",
+				uint(tc.skip), uint(tc.limit)).
+				Return(tc.changes, tc.err)
 
-			code: 200,
-			body: toJsonString(t, mockAuthSets(5)),
-			links: []string{
-				`<http://1.2.3.4/api/management/v1/admission/devices?page=3&per_page=5>; rel="prev"`,
-				`<http://1.2.3.4/api/management/v1/admission/devices?page=1&per_page=5>; rel="first"`,
-			},
-		},
+			apih := makeMockApiHandler(t, da, nil)
 
-		"valid pagination, with next page": {
-			skip:  15,
-			limit: 6,
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/devices/dev1/status/history"+tc.query,
+				nil)
 
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/admission/devices?page=4&per_page=5", nil),
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
 
-			getAuthSetsRes: mockAuthSets(9),
+func TestApiDevAuthGetOffboardingTokens(t *testing.T) {
+	t.Parallel()
 
-			code: 200,
-			body: toJsonString(t, mockAuthSets(5)),
-			links: []string{
-				`<http://1.2.3.4/api/management/v1/admission/devices?page=3&per_page=5>; rel="prev"`,
-				`<http://1.2.3.4/api/management/v1/admission/devices?page=1&per_page=5>; rel="first"`,
-			},
-		},
-		"invalid pagination: format": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/admission/devices?page=foo&per_page=5", nil),
-			code: 400,
-			body: RestError(rest_utils.MsgQueryParmInvalid("page")),
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	toks := []model.OffboardingToken{
+		{
+			Id:        "jti2",
+			DeviceId:  "dev2",
+			Reason:    model.OffboardingReasonDecommissioned,
+			Token:     "secret2",
+			CreatedTs: ts,
+			ExpiresAt: ts.Add(5 * time.Minute),
 		},
-		"invalid pagination: bounds": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/admission/devices?page=0&per_page=5", nil),
-			code: 400,
-			body: RestError(rest_utils.MsgQueryParmLimit("page")),
+		{
+			Id:         "jti1",
+			DeviceId:   "dev1",
+			Reason:     model.OffboardingReasonRejected,
+			Token:      "secret1",
+			CreatedTs:  ts,
+			ExpiresAt:  ts.Add(5 * time.Minute),
+			ClaimedTs:  &ts,
+			LastUsedTs: &ts,
+			Uses:       1,
 		},
-		"valid status: accepted": {
-			skip:   15,
-			limit:  6,
-			filter: store.AuthSetFilter{Status: "accepted"},
+	}
 
-			getAuthSetsRes: mockAuthSets(6),
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/admission/devices?page=4&per_page=5&status=accepted", nil),
-			code: 200,
-			body: toJsonString(t, mockAuthSets(5)),
-		},
-		"valid status: preauthorized": {
-			skip:   15,
-			limit:  6,
-			filter: store.AuthSetFilter{Status: "preauthorized"},
+	testCases := map[string]struct {
+		query string
 
-			getAuthSetsRes: mockAuthSets(6),
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/admission/devices?page=4&per_page=5&status=preauthorized", nil),
-			code: 200,
-			body: toJsonString(t, mockAuthSets(5)),
-		},
-		"invalid status": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/admission/devices?page=1&per_page=5&status=foo", nil),
-			code: 400,
-			body: RestError(rest_utils.MsgQueryParmOneOf("status", DevStatuses)),
-		},
-		"db.GetAuthSets error": {
-			skip:           15,
-			limit:          6,
-			getAuthSetsErr: errors.New("db error"),
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/management/v1/admission/devices?page=4&per_page=5", nil),
-			code: 500,
-			body: RestError("internal error"),
+		skip  uint64
+		limit uint64
+		toks  []model.OffboardingToken
+		err   error
+
+		code int
+		body string
+	}{
+		"ok": {
+			skip:  0,
+			limit: rest_utils.PerPageDefault + 1,
+			toks:  toks,
+			code:  http.StatusOK,
+			body:  string(asJSON(toks)),
+		},
+		"ok, paging": {
+			query: "?page=2&per_page=1",
+			skip:  1,
+			limit: 2,
+			toks:  toks,
+			code:  http.StatusOK,
+			body:  string(asJSON(toks[:1])),
+		},
+		"error, internal": {
+			skip:  0,
+			limit: rest_utils.PerPageDefault + 1,
+			err:   errors.New("db connection failed"),
+			code:  http.StatusInternalServerError,
+			body:  RestError("internal error"),
 		},
 	}
 
-	for idx := range tcases {
-		tc := tcases[idx]
-		t.Run(fmt.Sprintf("tc %s", idx), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			db := &smocks.DataStore{}
-			db.On("GetAuthSets",
+			da := &mocks.App{}
+			da.On("GetOffboardingTokens",
 				mtest.ContextMatcher(),
-				tc.skip,
-				tc.limit,
-				tc.filter).Return(tc.getAuthSetsRes, tc.getAuthSetsErr)
+				uint(tc.skip), uint(tc.limit)).
+				Return(tc.toks, tc.err)
 
-			apih := makeMockApiHandler(t, nil, db)
+			apih := makeMockApiHandler(t, da, nil)
 
-			recorded := runTestRequest(t, apih, tc.req, tc.code, tc.body)
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/offboarding_tokens"+tc.query,
+				nil)
 
-			for _, h := range tc.links {
-				assert.Equal(t, h, ExtractHeader("Link", h, recorded))
-			}
+			recorded := runTestRequest(t, apih, req, tc.code, tc.body)
+			// the tokens themselves are never exposed
+			assert.NotContains(t, recorded.Recorder.Body.String(), "secret")
 		})
 	}
 }
 
-func TestApiDevAuthDevAdmGetDevice(t *testing.T) {
+func TestApiDevAuthGetTokenAudit(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := map[string]struct {
-		aid string
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	recs := []model.TokenAuditRecord{
+		{
+			Id:        "rec2",
+			Action:    model.TokenAuditActionRevoked,
+			TokenId:   "jti1",
+			DeviceId:  "dev1",
+			Trigger:   "renewed",
+			SourceIP:  "10.0.0.1",
+			Timestamp: ts.Add(time.Minute),
+		},
+		{
+			Id:        "rec1",
+			Action:    model.TokenAuditActionIssued,
+			TokenId:   "jti1",
+			DeviceId:  "dev1",
+			Trigger:   model.TokenAuditTriggerAuthRequest,
+			SourceIP:  "10.0.0.1",
+			Timestamp: ts,
+		},
+	}
+	to := ts.Add(time.Hour)
 
-		dbAuthSet *model.AuthSet
-		dbErr     error
+	testCases := map[string]struct {
+		query string
 
-		checker mt.ResponseChecker
+		filter *store.TokenAuditFilter
+		skip   uint64
+		limit  uint64
+		recs   []model.TokenAuditRecord
+		err    error
+
+		code int
+		body string
 	}{
 		"ok": {
-			aid: "foo",
-
-			dbAuthSet: &model.AuthSet{
-				Id:       "foo",
-				DeviceId: "foo-dev",
-				IdData:   `{"sn": "dev-foo-sn"}`,
-				Status:   "accepted",
-				PubKey:   "foo-dev-key",
+			filter: &store.TokenAuditFilter{},
+			skip:   0,
+			limit:  rest_utils.PerPageDefault + 1,
+			recs:   recs,
+			code:   http.StatusOK,
+			body:   string(asJSON(recs)),
+		},
+		"ok, filters, paging": {
+			query: "?device_id=dev1&token_id=jti1&action=issued" +
+				"&from=2018-10-01T12:00:00Z&to=2018-10-01T13:00:00Z" +
+				"&page=2&per_page=1",
+			filter: &store.TokenAuditFilter{
+				DeviceId: "dev1",
+				TokenId:  "jti1",
+				Action:   model.TokenAuditActionIssued,
+				From:     &ts,
+				To:       &to,
 			},
-			checker: mt.NewJSONResponse(
-				http.StatusOK,
-				nil,
-				&model.DevAdmAuthSet{
-					Id:             "foo",
-					DeviceId:       "foo-dev",
-					DeviceIdentity: `{"sn": "dev-foo-sn"}`,
-					Status:         "accepted",
-					Key:            "foo-dev-key",
-					Attributes: map[string]interface{}{
-						"sn": "dev-foo-sn",
-					}}),
-		},
-		"error: not found": {
-			aid: "foo",
-
-			dbErr: store.ErrDevNotFound,
-			checker: mt.NewJSONResponse(
-				http.StatusNotFound,
-				nil,
-				restError("authorization set not found")),
-		},
-		"error: generic db error": {
-			aid: "foo",
-
-			dbErr: errors.New("an error"),
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error")),
-		},
-		"error: auth set conversion error": {
-			aid: "foo",
-
-			dbAuthSet: &model.AuthSet{
-				Id:       "foo",
-				DeviceId: "foo-dev",
-				IdData:   "not json",
-				Status:   "accepted",
-				PubKey:   "foo-dev-key",
+			skip:  1,
+			limit: 2,
+			recs:  recs,
+			code:  http.StatusOK,
+			body:  string(asJSON(recs[:1])),
+		},
+		"ok, cursor": {
+			query: "?after=" + store.TokenAuditCursor(&recs[0]).Encode(),
+			filter: &store.TokenAuditFilter{
+				After: store.TokenAuditCursor(&recs[0]),
 			},
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error")),
+			skip:  0,
+			limit: rest_utils.PerPageDefault + 1,
+			recs:  recs[1:],
+			code:  http.StatusOK,
+			body:  string(asJSON(recs[1:])),
+		},
+		"error, cursor of another listing": {
+			query: "?after=" + store.Cursor{Sort: "id:asc", Id: "dev1"}.Encode(),
+			code:  http.StatusBadRequest,
+			body:  RestError("cursor doesn't match the sort order"),
+		},
+		"error, bad action": {
+			query: "?action=refreshed",
+			code:  http.StatusBadRequest,
+			body:  RestError("action must be one of: issued, revoked"),
+		},
+		"error, bad from": {
+			query: "?from=yesterday",
+			code:  http.StatusBadRequest,
+			body:  RestError("from must be an RFC3339 timestamp"),
+		},
+		"error, bad to": {
+			query: "?to=tomorrow",
+			code:  http.StatusBadRequest,
+			body:  RestError("to must be an RFC3339 timestamp"),
+		},
+		"error, internal": {
+			filter: &store.TokenAuditFilter{},
+			skip:   0,
+			limit:  rest_utils.PerPageDefault + 1,
+			err:    errors.New("db connection failed"),
+			code:   http.StatusInternalServerError,
+			body:   RestError("internal error"),
 		},
 	}
 
-	for idx := range tcases {
-		tc := tcases[idx]
-		t.Run(fmt.Sprintf("tc %s", idx), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			db := &smocks.DataStore{}
-			db.On("GetAuthSetById",
-				mtest.ContextMatcher(),
-				tc.aid).Return(tc.dbAuthSet, tc.dbErr)
-
-			apih := makeMockApiHandler(t, nil, db)
-
-			//make request
-			req := makeReq("GET",
-				"http://1.2.3.4/api/management/v1/admission/devices/"+tc.aid,
-				"",
+			da := &mocks.App{}
+			if tc.filter != nil {
+				da.On("GetTokenAuditRecords",
+					mtest.ContextMatcher(), *tc.filter,
+					uint(tc.skip), uint(tc.limit)).
+					Return(tc.recs, tc.err)
+			}
+
+			apih := makeMockApiHandler(t, da, nil)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/devauth/audit/tokens"+tc.query,
 				nil)
-			recorded := test.RunRequest(t, apih, req)
 
-			mt.CheckResponse(t, tc.checker, recorded)
+			runTestRequest(t, apih, req, tc.code, tc.body)
+			da.AssertExpectations(t)
 		})
 	}
 }
 
-func TestApiDevAuthDevAdmDeleteDeviceAuthSet(t *testing.T) {
+func TestApiDevAuthGetRevokedTokens(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	tcases := map[string]struct {
-		aid string
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	toks := []model.RevokedToken{
+		{Id: "jti1", RevokedTs: ts},
+		{Id: "jti2", RevokedTs: ts.Add(time.Minute)},
+	}
 
-		dbAuthSet *model.AuthSet
-		dbErr     error
+	testCases := map[string]struct {
+		query string
 
-		daErr error
+		tenant string
+		since  time.Time
+		skip   uint64
+		limit  uint64
+		toks   []model.RevokedToken
+		err    error
 
-		checker mt.ResponseChecker
+		code int
+		body string
 	}{
 		"ok": {
-			aid: "foo",
-
-			dbAuthSet: &model.AuthSet{
-				Id:       "foo",
-				DeviceId: "foo-dev",
-				IdData:   `{"sn": "dev-foo-sn"}`,
-				Status:   "accepted",
-				PubKey:   "foo-dev-key",
-			},
-
-			checker: mt.NewJSONResponse(
-				http.StatusNoContent,
-				nil,
-				nil),
+			skip:  0,
+			limit: rest_utils.PerPageDefault + 1,
+			toks:  toks,
+			code:  http.StatusOK,
+			body:  string(asJSON(toks)),
+		},
+		"ok, tenant, since, paging": {
+			query:  "?tenant_id=foo&since=2018-10-01T12:00:00Z&page=2&per_page=1",
+			tenant: "foo",
+			since:  ts,
+			skip:   1,
+			limit:  2,
+			toks:   toks,
+			code:   http.StatusOK,
+			body:   string(asJSON(toks[:1])),
 		},
-		"error: not found (db)": {
-			aid: "foo",
+		"error, bad since": {
+			query: "?since=yesterday",
+			code:  http.StatusBadRequest,
+			body:  RestError("since must be an RFC3339 timestamp"),
+		},
+		"error, internal": {
+			skip:  0,
+			limit: rest_utils.PerPageDefault + 1,
+			err:   errors.New("db connection failed"),
+			code:  http.StatusInternalServerError,
+			body:  RestError("internal error"),
+		},
+	}
 
-			dbErr: store.ErrDevNotFound,
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-			checker: mt.NewJSONResponse(
-				http.StatusNoContent,
-				nil,
-				nil),
-		},
+			da := &mocks.App{}
+			da.On("GetRevokedTokens",
+				mtest.ContextMatcher(), tc.tenant,
+				mock.MatchedBy(func(since time.Time) bool {
+					return since.Equal(tc.since)
+				}),
+				uint(tc.skip), uint(tc.limit)).
+				Return(tc.toks, tc.err)
 
-		"error: not found(app)": {
-			aid: "foo",
+			apih := makeMockApiHandler(t, da, nil)
 
-			dbAuthSet: &model.AuthSet{
-				Id:       "foo",
-				DeviceId: "foo-dev",
-				IdData:   `{"sn": "dev-foo-sn"}`,
-				Status:   "accepted",
-				PubKey:   "foo-dev-key",
-			},
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/tokens/revoked"+tc.query,
+				nil)
 
-			daErr: store.ErrDevNotFound,
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
 
-			checker: mt.NewJSONResponse(
-				http.StatusNoContent,
-				nil,
-				nil),
-		},
-		"error: generic db error": {
-			aid: "foo",
+func TestApiDevAuthGetRevocationGateways(t *testing.T) {
+	t.Parallel()
 
-			dbErr: errors.New("an error"),
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
 
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error")),
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	gateways := []revocation.GatewayStatus{
+		{
+			Name:           "edge",
+			URL:            "https://edge/revocations",
+			Pending:        1,
+			Delivered:      10,
+			Failed:         1,
+			LastDeliveryTs: &ts,
+			LastFailureTs:  &ts,
+			LastError:      "failed to send revocation event",
 		},
-		"error: generic app error": {
-			aid: "foo",
-
-			dbAuthSet: &model.AuthSet{
-				Id:       "foo",
-				DeviceId: "foo-dev",
-				IdData:   `{"sn": "dev-foo-sn"}`,
-				Status:   "accepted",
-				PubKey:   "foo-dev-key",
-			},
+	}
 
-			daErr: errors.New("an error"),
+	testCases := map[string]struct {
+		gateways []revocation.GatewayStatus
+		err      error
 
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error")),
+		code int
+		body string
+	}{
+		"ok": {
+			gateways: gateways,
+			code:     http.StatusOK,
+			body:     string(asJSON(gateways)),
+		},
+		"ok, none": {
+			gateways: []revocation.GatewayStatus{},
+			code:     http.StatusOK,
+			body:     "[]",
+		},
+		"error, internal": {
+			err:  errors.New("failed"),
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
 		},
 	}
 
-	for idx := range tcases {
-		tc := tcases[idx]
-		t.Run(fmt.Sprintf("tc %s", idx), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			db := &smocks.DataStore{}
-			db.On("GetAuthSetById",
-				mtest.ContextMatcher(),
-				tc.aid).Return(tc.dbAuthSet, tc.dbErr)
-
 			da := &mocks.App{}
-			if tc.dbAuthSet != nil {
-				da.On("DeleteAuthSet",
-					mtest.ContextMatcher(),
-					tc.dbAuthSet.DeviceId,
-					tc.aid).Return(tc.daErr)
-			} else {
-				da.On("DeleteAuthSet",
-					mtest.ContextMatcher(),
-					mock.AnythingOfType("string"),
-					tc.aid).Return(tc.daErr)
-			}
+			da.On("GetRevocationGateways", mtest.ContextMatcher()).
+				Return(tc.gateways, tc.err)
 
-			apih := makeMockApiHandler(t, da, db)
+			apih := makeMockApiHandler(t, da, nil)
 
-			//make request
-			req := makeReq("DELETE",
-				"http://1.2.3.4/api/management/v1/admission/devices/"+tc.aid,
-				"",
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/tokens/revoked/gateways",
 				nil)
-			recorded := test.RunRequest(t, apih, req)
-
-			mt.CheckResponse(t, tc.checker, recorded)
-		})
-	}
-}
 
-func mockAuthSets(num int) []model.DevAdmAuthSet {
-	var sets []model.DevAdmAuthSet
-	for i := 0; i < num; i++ {
-		sets = append(sets, model.DevAdmAuthSet{
-			Id:       strconv.Itoa(i),
-			DeviceId: strconv.Itoa(i),
+			runTestRequest(t, apih, req, tc.code, tc.body)
 		})
 	}
-	return sets
 }
 
-func ExtractHeader(hdr, val string, r *test.Recorded) string {
-	rec := r.Recorder
-	for _, v := range rec.Header()[hdr] {
-		if v == val {
-			return v
-		}
-	}
+func TestApiDevAuthGetJWKS(t *testing.T) {
+	t.Parallel()
 
-	return ""
-}
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
 
-func TestApiDevAuthDevAdmPostDeviceAuth(t *testing.T) {
-	validKey := `
------BEGIN PUBLIC KEY-----
-MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAzogVU7RGDilbsoUt/DdH
-VJvcepl0A5+xzGQ50cq1VE/Dyyy8Zp0jzRXCnnu9nu395mAFSZGotZVr+sWEpO3c
-yC3VmXdBZmXmQdZqbdD/GuixJOYfqta2ytbIUPRXFN7/I7sgzxnXWBYXYmObYvdP
-okP0mQanY+WKxp7Q16pt1RoqoAd0kmV39g13rFl35muSHbSBoAW3GBF3gO+mF5Ty
-1ddp/XcgLOsmvNNjY+2HOD5F/RX0fs07mWnbD7x+xz7KEKjF+H7ZpkqCwmwCXaf0
-iyYyh1852rti3Afw4mDxuVSD7sd9ggvYMc0QHIpQNkD4YWOhNiE1AB0zH57VbUYG
-UwIDAQAB
------END PUBLIC KEY-----`
+	jwks := &jwt.JWKS{
+		Keys: []jwt.JWK{
+			{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: "EdDSA",
+				Kid: "kid1",
+				Crv: "Ed25519",
+				X:   "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo",
+			},
+		},
+		Version: "v1",
+	}
 
 	testCases := map[string]struct {
-		body interface{}
+		ifNoneMatch string
 
-		devAuthErr error
+		jwks *jwt.JWKS
+		err  error
 
-		checker mt.ResponseChecker
-	}{
-		"ok": {
-			body: &model.DevAdmAuthSetReq{Key: validKey, DeviceId: toJsonString(t,
-				map[string]string{
-					"mac": "00:00:00:01",
-				}),
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusCreated,
-				nil,
-				nil),
-		},
-		"error, invalid key": {
-			body: &model.DevAdmAuthSetReq{Key: "foo", DeviceId: toJsonString(t,
-				map[string]string{
-					"mac": "00:00:00:01",
-				}),
-			},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("cannot decode public key")),
-		},
-		"error: empty request": {
-			body: nil,
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("EOF")),
-		},
-		"error: generic": {
-			body: &model.DevAdmAuthSetReq{Key: validKey, DeviceId: toJsonString(t,
-				map[string]string{
-					"mac": "00:00:00:01",
-				})},
-			devAuthErr: errors.New("generic error"),
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error")),
-		},
-		"error: no key": {
-			body: &model.DevAdmAuthSetReq{Key: "", DeviceId: toJsonString(t,
-				map[string]string{
-					"mac": "00:00:00:01",
-				})},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("key: non zero value required;")),
-		},
-		"error: no identity data": {
-			body: &model.DevAdmAuthSetReq{Key: validKey},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("device_identity: non zero value required;")),
-		},
-		"error: invalid id data": {
-			body: &model.DevAdmAuthSetReq{Key: validKey, DeviceId: "{mac: 1234}"},
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("failed to decode attributes data: invalid character 'm' looking for beginning of object key string")),
-		},
-		"error: conflict": {
-			body: &model.DevAdmAuthSetReq{Key: validKey, DeviceId: toJsonString(t,
-				map[string]string{
-					"mac": "00:00:00:01",
-				})},
-			devAuthErr: devauth.ErrDeviceExists,
-			checker: mt.NewJSONResponse(
-				http.StatusConflict,
-				nil,
-				restError("device already exists")),
+		code int
+		body string
+	}{
+		"ok": {
+			jwks: jwks,
+			code: http.StatusOK,
+			body: string(asJSON(jwks)),
+		},
+		"ok, stale version": {
+			ifNoneMatch: `"v0"`,
+			jwks:        jwks,
+			code:        http.StatusOK,
+			body:        string(asJSON(jwks)),
+		},
+		"ok, not modified": {
+			ifNoneMatch: `"v1"`,
+			jwks:        jwks,
+			code:        http.StatusNotModified,
+		},
+		"error, internal": {
+			err:  errors.New("failed"),
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
 		},
 	}
 
 	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
-		da := &mocks.App{}
-		da.On("PreauthorizeDevice",
-			mtest.ContextMatcher(),
-			mock.AnythingOfType("*model.PreAuthReq")).
-			Return(tc.devAuthErr)
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-		apih := makeMockApiHandler(t, da, nil)
+			da := &mocks.App{}
+			da.On("GetJWKS",
+				mtest.ContextMatcher()).
+				Return(tc.jwks, tc.err)
 
-		//make request
-		req := makeReq("POST",
-			"http://1.2.3.4/api/management/v1/admission/devices",
-			"",
-			tc.body)
+			apih := makeMockApiHandler(t, da, nil)
 
-		recorded := test.RunRequest(t, apih, req)
-		mt.CheckResponse(t, tc.checker, recorded)
-	}
-}
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/.well-known/jwks.json",
+				nil)
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
 
-func toJsonString(t *testing.T, d interface{}) string {
-	out, err := json.Marshal(d)
-	if err != nil {
-		t.FailNow()
+			recorded := runTestRequest(t, apih, req, tc.code, tc.body)
+			if tc.err == nil {
+				recorded.HeaderIs("ETag", `"v1"`)
+				recorded.HeaderIs("Cache-Control", "max-age=300")
+			}
+		})
 	}
-
-	return string(out)
 }
 
-func TestApiGetTenantDevicesV2(t *testing.T) {
+func TestApiDevAuthGetKeyPolicy(t *testing.T) {
 	t.Parallel()
 
 	// enforce specific field naming in errors returned by API
 	updateRestErrorFieldName()
 
-	devs := []model.Device{
-		{
-			Id:     "id1",
-			PubKey: "pubkey",
-			Status: model.DevStatusPending,
-		},
-		{
-			Id:     "id2",
-			PubKey: "pubkey2",
-			Status: model.DevStatusRejected,
-		},
-		{
-			Id:     "id3",
-			PubKey: "pubkey3",
-			Status: model.DevStatusRejected,
-		},
-		{
-			Id:     "id4",
-			PubKey: "pubkey4",
-			Status: model.DevStatusAccepted,
-		},
-		{
-			Id:     "id5",
-			PubKey: "pubkey5",
-			Status: model.DevStatusPreauth,
-		},
+	policy := &model.KeyPolicy{
+		MinRSABits:      2048,
+		AllowedKeyTypes: []string{"rsa", "ed25519"},
 	}
 
-	outDevs, err := devicesV2FromDbModel(devs)
-	assert.NoError(t, err)
+	testCases := map[string]struct {
+		policy *model.KeyPolicy
+		err    error
 
-	tcases := map[string]struct {
-		req       *http.Request
-		code      int
-		body      string
-		devices   []model.Device
-		err       error
-		skip      uint
-		limit     uint
-		tenant_id string
+		code int
+		body string
 	}{
 		"ok": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/internal/v1/devauth/tenants/powerpuff123/devices", nil),
-			code:      http.StatusOK,
-			devices:   devs,
-			err:       nil,
-			skip:      0,
-			limit:     rest_utils.PerPageDefault + 1,
-			body:      string(asJSON(outDevs)),
-			tenant_id: "powerpuff123",
-		},
-		"no devices": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/internal/v1/devauth/tenants/powerpuff123/devices", nil),
-			code:      http.StatusOK,
-			devices:   []model.Device{},
-			skip:      0,
-			limit:     rest_utils.PerPageDefault + 1,
-			err:       nil,
-			body:      "[]",
-			tenant_id: "powerpuff123",
-		},
-		// this test does not check if the devices were skipped
-		// it is only checking if endpoint limits number of devices in the response
-		"limit number of devices": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/internal/v1/devauth/tenants/powerpuff123/devices?page=2&per_page=2", nil),
-			devices: devs,
-			skip:    2,
-			limit:   3,
-			code:    http.StatusOK,
-			// reqquested 2 devices per page, so expect only 2
-			body:      string(asJSON(outDevs[:2])),
-			tenant_id: "powerpuff123",
-		},
-		"internal error": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/internal/v1/devauth/tenants/powerpuff123/devices?page=2&per_page=2", nil),
-			skip:      2,
-			limit:     3,
-			code:      http.StatusInternalServerError,
-			err:       errors.New("failed"),
-			body:      RestError("internal error"),
-			tenant_id: "powerpuff123",
+			policy: policy,
+			code:   http.StatusOK,
+			body:   string(asJSON(policy)),
 		},
-		"tenant_id not valid": {
-			req: test.MakeSimpleRequest("GET",
-				"http://1.2.3.4/api/internal/v1/devauth/tenants//devices", nil),
-			code: http.StatusBadRequest,
+		"error, internal": {
 			err:  errors.New("failed"),
-			body: RestError("tenant id (tid) cannot be empty"),
+			code: http.StatusInternalServerError,
+			body: RestError("internal error"),
 		},
 	}
 
-	for name := range tcases {
-		tc := tcases[name]
-		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
 			da := &mocks.App{}
-			da.On("GetDevices",
-				mock.MatchedBy(func(c context.Context) bool {
-					if identity.FromContext(c).Tenant != tc.tenant_id {
-						assert.FailNow(t, "Tenant ID from request mismatch", identity.FromContext(c).Tenant)
-						return false
-					}
-					return true
-				}),
-				tc.skip, tc.limit, mock.AnythingOfType("store.DeviceFilter")).Return(
-				tc.devices, tc.err)
+			da.On("GetKeyPolicy",
+				mtest.ContextMatcher()).
+				Return(tc.policy, tc.err)
 
 			apih := makeMockApiHandler(t, da, nil)
-			runTestRequest(t, apih, tc.req, tc.code, tc.body)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/config/key_policy",
+				nil)
+
+			runTestRequest(t, apih, req, tc.code, tc.body)
+		})
+	}
+}
+
+func TestTrafficClass(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		method string
+		path   string
+		class  string
+	}{
+		{"POST", "/api/internal/v1/devauth/tokens/verify", TrafficClassVerify},
+		{"POST", "/api/internal/v1/devauth/tokens/introspect", TrafficClassVerify},
+		{"POST", "/api/devices/v1/authentication/auth_requests", TrafficClassEnroll},
+		{"POST", "/api/devices/v1/authentication/auth_requests/challenge", TrafficClassEnroll},
+		{"POST", "/api/devices/v1/authentication/key_rotation", TrafficClassEnroll},
+		{"POST", "/api/devices/v1/authentication/device_authorization", TrafficClassEnroll},
+		{"POST", "/api/devices/v1/authentication/token", TrafficClassEnroll},
+		{"POST", "/api/devices/v1/authentication/tokens/renew", TrafficClassEnroll},
+		{"OPTIONS", "/api/devices/v1/authentication/auth_requests", ""},
+		{"GET", "/api/management/v2/devauth/devices", ""},
+	}
+
+	for _, tc := range testCases {
+		req := test.MakeSimpleRequest(tc.method, "http://1.2.3.4"+tc.path, nil)
+		assert.Equal(t, tc.class, TrafficClass(&rest.Request{Request: req}),
+			tc.method+" "+tc.path)
+	}
+}
+
+func TestFormRequest(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		method string
+		path   string
+		form   bool
+	}{
+		{"POST", "/api/devices/v1/authentication/token", true},
+		{"POST", "/api/internal/v1/devauth/tokens/introspect", true},
+		{"POST", "/api/devices/v1/authentication/auth_requests", false},
+		{"OPTIONS", "/api/devices/v1/authentication/token", false},
+	}
+
+	for _, tc := range testCases {
+		req := test.MakeSimpleRequest(tc.method, "http://1.2.3.4"+tc.path, nil)
+		assert.Equal(t, tc.form, FormRequest(&rest.Request{Request: req}),
+			tc.method+" "+tc.path)
+	}
+}
+
+func TestImportRequest(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		method string
+		path   string
+		imp    bool
+	}{
+		{"POST", "/api/management/v2/devauth/devices/import", true},
+		{"POST", "/api/management/v2/devauth/devices", false},
+		{"GET", "/api/management/v2/devauth/devices/import", false},
+	}
+
+	for _, tc := range testCases {
+		req := test.MakeSimpleRequest(tc.method, "http://1.2.3.4"+tc.path, nil)
+		assert.Equal(t, tc.imp, ImportRequest(&rest.Request{Request: req}),
+			tc.method+" "+tc.path)
+	}
+}
+
+func TestEventStreamRequest(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		method string
+		path   string
+		stream bool
+	}{
+		{"GET", "/api/management/v1/devauth/devices/events", true},
+		{"GET", "/api/management/v1/devauth/devices", false},
+		{"POST", "/api/management/v1/devauth/devices/events", false},
+	}
+
+	for _, tc := range testCases {
+		req := test.MakeSimpleRequest(tc.method, "http://1.2.3.4"+tc.path, nil)
+		assert.Equal(t, tc.stream, EventStreamRequest(&rest.Request{Request: req}),
+			tc.method+" "+tc.path)
+	}
+}
+
+func TestMergePatchRequest(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		method      string
+		contentType string
+		patch       bool
+	}{
+		{"PATCH", "application/merge-patch+json", true},
+		{"PATCH", "application/merge-patch+json; charset=utf-8", true},
+		{"PATCH", "application/json", false},
+		{"PUT", "application/merge-patch+json", false},
+	}
+
+	for _, tc := range testCases {
+		req := test.MakeSimpleRequest(tc.method,
+			"http://1.2.3.4/api/management/v2/devauth/devices/dev1", nil)
+		req.Header.Set("Content-Type", tc.contentType)
+		assert.Equal(t, tc.patch, MergePatchRequest(&rest.Request{Request: req}),
+			tc.method+" "+tc.contentType)
+	}
+}
+
+func TestApiDevAuthCustomMiddlewares(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	var order []string
+	header := rest.MiddlewareSimple(func(h rest.HandlerFunc) rest.HandlerFunc {
+		return func(w rest.ResponseWriter, r *rest.Request) {
+			order = append(order, "header")
+			w.Header().Set("X-Custom", "foo")
+			h(w, r)
+		}
+	})
+	auth := rest.MiddlewareSimple(func(h rest.HandlerFunc) rest.HandlerFunc {
+		return func(w rest.ResponseWriter, r *rest.Request) {
+			order = append(order, "auth")
+			if r.Header.Get("X-Corp-Auth") == "" {
+				rest.Error(w, "corporate auth required", http.StatusForbidden)
+				return
+			}
+			h(w, r)
+		}
+	})
+
+	da := &mocks.App{}
+	da.On("RevokeToken",
+		mtest.ContextMatcher(),
+		"foo").Return(nil)
+
+	handlers := NewDevAuthApiHandlers(da, nil, header, auth)
+	app, err := handlers.GetApp()
+	assert.NoError(t, err)
+
+	api := rest.NewApi()
+	api.SetApp(app)
+	apih := api.MakeHandler()
+
+	req := test.MakeSimpleRequest("DELETE",
+		"http://1.2.3.4/api/management/v2/devauth/tokens/foo", nil)
+	recorded := runTestRequest(t, apih, req, http.StatusForbidden,
+		`{"error":"corporate auth required"}`)
+	assert.Equal(t, "foo", recorded.Recorder.HeaderMap.Get("X-Custom"))
+	assert.Equal(t, []string{"header", "auth"}, order)
+	da.AssertNotCalled(t, "RevokeToken", mtest.ContextMatcher(), "foo")
+
+	req.Header.Set("X-Corp-Auth", "ok")
+	runTestRequest(t, apih, req, http.StatusNoContent, "")
+	da.AssertExpectations(t)
+}
+
+func TestApiDevAuthErrorTranslation(t *testing.T) {
+	t.Parallel()
+
+	// enforce specific field naming in errors returned by API
+	updateRestErrorFieldName()
+
+	da := &mocks.App{}
+	da.On("GetTenantDeviceStatus",
+		mtest.ContextMatcher(),
+		"foo", "bar").Return(nil, devauth.ErrDeviceNotFound)
+	da.On("GetTenantDeviceStatus",
+		mtest.ContextMatcher(),
+		"foo", "baz").Return(nil,
+		devauth.MakeErrDevAuthBadRequest(errors.New("invalid device id")))
+
+	handlers := NewDevAuthApiHandlers(da, nil,
+		&requestid.RequestIdMiddleware{},
+		&TranslationMiddleware{
+			Translator: catalog.Translations{
+				"de": {
+					catalog.CodeDeviceNotFound: "Gerät nicht gefunden",
+					catalog.CodeBadRequest:     "Ungültige Anfrage",
+				},
+			},
+		})
+	app, err := handlers.GetApp()
+	assert.NoError(t, err)
+
+	api := rest.NewApi()
+	api.SetApp(app)
+	apih := api.MakeHandler()
+
+	testCases := map[string]struct {
+		devId          string
+		acceptLanguage string
+
+		code int
+		body string
+		lang string
+	}{
+		"translated": {
+			devId:          "bar",
+			acceptLanguage: "fr;q=0.9, de-AT",
+			code:           http.StatusNotFound,
+			body:           RestError("Gerät nicht gefunden"),
+			lang:           "de",
+		},
+		"no translation": {
+			devId:          "bar",
+			acceptLanguage: "fr",
+			code:           http.StatusNotFound,
+			body:           RestError("device not found"),
+		},
+		"no accept-language": {
+			devId: "bar",
+			code:  http.StatusNotFound,
+			body:  RestError("device not found"),
+		},
+		"specific message": {
+			devId:          "baz",
+			acceptLanguage: "de",
+			code:           http.StatusBadRequest,
+			body:           RestError("invalid device id"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/devauth/tenants/foo/devices/"+
+					tc.devId+"/status",
+				nil)
+			if tc.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tc.acceptLanguage)
+			}
+
+			recorded := runTestRequest(t, apih, req, tc.code, tc.body)
+			assert.Equal(t, tc.lang,
+				recorded.Recorder.HeaderMap.Get("Content-Language"))
 		})
 	}
 }
@@ -0,0 +1,151 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+const (
+	hdrLastEventId = "Last-Event-ID"
+
+	// event of devices added, other events are named after the new status
+	deviceEventCreated = "created"
+
+	// the most status changes fetched at once
+	deviceEventsBatch = 100
+)
+
+var (
+	// how often the stream checks for new status changes
+	deviceEventsPollInterval = time.Second
+
+	// idle streams get a comment this often, so that proxies don't drop
+	// the connection
+	deviceEventsKeepAlive = 30 * time.Second
+)
+
+// GetDeviceEventsHandler streams the status changes of the devices as
+// server-sent events, as they are recorded in the status history, which
+// all service instances share. A client reconnecting with Last-Event-ID
+// resumes right after that event.
+func (d *DevAuthApiHandlers) GetDeviceEventsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	now := time.Now().UTC()
+	after := &store.Cursor{Sort: store.StatusChangeSort, Ts: &now}
+	if id := r.Header.Get(hdrLastEventId); id != "" {
+		c, err := store.ParseCursor(id)
+		if err == nil && c.Sort != store.StatusChangeSort {
+			err = errCursorSort
+		}
+		if err != nil {
+			rest_utils.RestErrWithLog(w, r, l,
+				errors.Wrap(err, "invalid "+hdrLastEventId),
+				http.StatusBadRequest)
+			return
+		}
+		after = c
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		rest_utils.RestErrWithLogInternal(w, r, l,
+			errors.New("response writer doesn't support streaming"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	poll := time.NewTicker(deviceEventsPollInterval)
+	defer poll.Stop()
+	lastWrite := time.Now()
+
+	for {
+		changes, err := d.devAuth.GetDeviceStatusChanges(ctx, after,
+			deviceEventsBatch)
+		if err != nil {
+			// the client reconnects and resumes after the last event
+			if ctx.Err() == nil {
+				l.Errorf("failed to fetch device status changes: %v", err)
+			}
+			return
+		}
+
+		for i := range changes {
+			if err := writeDeviceEvent(w, &changes[i]); err != nil {
+				return
+			}
+			after = store.StatusChangeCursor(&changes[i])
+		}
+		switch {
+		case len(changes) > 0:
+			flusher.Flush()
+			lastWrite = time.Now()
+		case time.Since(lastWrite) >= deviceEventsKeepAlive:
+			_, err := w.(http.ResponseWriter).Write([]byte(": keep-alive\n\n"))
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+			lastWrite = time.Now()
+		}
+
+		// more changes are waiting
+		if len(changes) == deviceEventsBatch {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		}
+	}
+}
+
+// writeDeviceEvent writes the status change as an event named 'created'
+// for devices added and after the new status otherwise; the event id is
+// the cursor positioned after the change
+func writeDeviceEvent(w rest.ResponseWriter, c *model.DeviceStatusChange) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	event := c.To
+	if c.From == "" {
+		event = deviceEventCreated
+	}
+
+	_, err = fmt.Fprintf(w.(http.ResponseWriter), "id: %s\nevent: %s\ndata: %s\n\n",
+		store.StatusChangeCursor(c).Encode(), event, data)
+	return err
+}
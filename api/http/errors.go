@@ -0,0 +1,78 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/devauth"
+)
+
+// response status of each application error kind
+var errKindStatus = map[devauth.ErrorKind]int{
+	devauth.ErrKindBadRequest:    http.StatusBadRequest,
+	devauth.ErrKindUnauthorized:  http.StatusUnauthorized,
+	devauth.ErrKindNotFound:      http.StatusNotFound,
+	devauth.ErrKindConflict:      http.StatusConflict,
+	devauth.ErrKindUnprocessable: http.StatusUnprocessableEntity,
+	devauth.ErrKindForbidden:     http.StatusForbidden,
+}
+
+// restErr writes the error response for an error returned by the
+// application; typed errors get the status of their kind and their user
+// message, localized if a translation for the client's Accept-Language is
+// available, the internal detail only goes to the log. Any other error is
+// an internal error.
+func restErr(w rest.ResponseWriter, r *rest.Request, l *log.Logger, err error) {
+	e, ok := errors.Cause(err).(*devauth.Error)
+	if !ok {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	code, ok := errKindStatus[e.Kind]
+	if !ok {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	msg, lang := catalog.Localize(r.Context(), e.Code,
+		catalog.ParseAcceptLanguage(r.Header.Get("Accept-Language")),
+		e.Message)
+	if lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+
+	rest_utils.RestErrWithWarningMsg(w, r, l, err, code, msg)
+}
+
+// TranslationMiddleware makes the translator available for localizing error
+// messages of the requests it handles
+type TranslationMiddleware struct {
+	Translator catalog.Translator
+}
+
+func (mw *TranslationMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		ctx := catalog.WithTranslator(r.Context(), mw.Translator)
+		r.Request = r.WithContext(ctx)
+		h(w, r)
+	}
+}
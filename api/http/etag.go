@@ -0,0 +1,77 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
+)
+
+const (
+	hdrETag        = "ETag"
+	hdrIfNoneMatch = "If-None-Match"
+)
+
+// headers which are part of a representation along with its body, so
+// that a listing page is revalidated when the paging changes as well
+var etagHeaders = []string{hdrTotalCount, "Link"}
+
+// writeJsonETag writes v as JSON tagged with a strong ETag computed
+// from the payload, or answers 304 Not Modified with no body if the
+// client lists that ETag in If-None-Match
+func writeJsonETag(w rest.ResponseWriter, r *rest.Request, v interface{}) {
+	b, err := w.EncodeJson(v)
+	if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, log.FromContext(r.Context()), err)
+		return
+	}
+
+	etag := makeETag(b, w.Header())
+	w.Header().Set(hdrETag, etag)
+
+	if etagMatch(r.Header.Get(hdrIfNoneMatch), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.(http.ResponseWriter).Write(b)
+}
+
+func makeETag(body []byte, hdr http.Header) string {
+	h := sha256.New()
+	h.Write(body)
+	for _, name := range etagHeaders {
+		for _, v := range hdr[http.CanonicalHeaderKey(name)] {
+			h.Write([]byte("\n" + name + ": " + v))
+		}
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// etagMatch tells if an If-None-Match header lists the ETag; the
+// comparison is weak, as RFC 7232 mandates for If-None-Match
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
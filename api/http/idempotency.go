@@ -0,0 +1,205 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	"github.com/mendersoftware/deviceauth/utils"
+)
+
+const (
+	hdrIdempotencyKey = "Idempotency-Key"
+
+	// set on responses replayed for a retried request
+	hdrIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen = 255
+)
+
+// response headers recorded along with the status and body; the others
+// are set anew by the middlewares for each request
+var idempotencyHeaders = []string{"Content-Type", "Location"}
+
+var (
+	ErrIdempotencyKeyTooLong = errors.New(
+		"idempotency key must not be longer than 255 characters")
+	ErrIdempotencyKeyReused = errors.New(
+		"idempotency key already used for a different request")
+	ErrIdempotencyKeyInProgress = errors.New(
+		"a request with the idempotency key is still in progress")
+)
+
+// idempotent makes the handler honor the Idempotency-Key header: the
+// response to the first request made with a key is recorded and returned
+// to retries of the same request, which aren't handled again. Server
+// errors aren't recorded, so that the request can be retried.
+func (d *DevAuthApiHandlers) idempotent(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		key := r.Header.Get(hdrIdempotencyKey)
+		if key == "" {
+			h(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		l := log.FromContext(ctx)
+
+		if len(key) > maxIdempotencyKeyLen {
+			rest_utils.RestErrWithLog(w, r, l, ErrIdempotencyKeyTooLong,
+				http.StatusBadRequest)
+			return
+		}
+
+		body, err := utils.ReadBodyRaw(r)
+		if err != nil {
+			rest_utils.RestErrWithLog(w, r, l,
+				errors.Wrap(err, "failed to read request body"),
+				http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		sum := requestSha256(r, body)
+
+		err = d.db.AddIdempotencyRecord(ctx, model.IdempotencyRecord{
+			Key:           key,
+			RequestSha256: sum,
+			CreatedTs:     time.Now().UTC(),
+		})
+		if err == store.ErrObjectExists {
+			d.replayIdempotent(w, r, key, sum)
+			return
+		} else if err != nil {
+			rest_utils.RestErrWithLogInternal(w, r, l, err)
+			return
+		}
+
+		rw := &recordingResponseWriter{ResponseWriter: w}
+		h(rw, r)
+
+		if rw.status >= http.StatusInternalServerError {
+			err = d.db.DeleteIdempotencyRecord(ctx, key)
+		} else {
+			err = d.db.SetIdempotencyResponse(ctx, key, rw.response())
+		}
+		if err != nil {
+			l.Errorf("failed to record response for idempotency key %s: %v",
+				key, err)
+		}
+	}
+}
+
+func (d *DevAuthApiHandlers) replayIdempotent(w rest.ResponseWriter, r *rest.Request, key string, sum []byte) {
+	ctx := r.Context()
+	l := log.FromContext(ctx)
+
+	rec, err := d.db.GetIdempotencyRecord(ctx, key)
+	switch {
+	case err == store.ErrIdempotencyRecordNotFound:
+		// freed by a failed request in the meantime
+		rest_utils.RestErrWithLog(w, r, l, ErrIdempotencyKeyInProgress,
+			http.StatusConflict)
+		return
+	case err != nil:
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	case !bytes.Equal(rec.RequestSha256, sum):
+		rest_utils.RestErrWithLog(w, r, l, ErrIdempotencyKeyReused,
+			http.StatusUnprocessableEntity)
+		return
+	case rec.Response == nil:
+		rest_utils.RestErrWithLog(w, r, l, ErrIdempotencyKeyInProgress,
+			http.StatusConflict)
+		return
+	}
+
+	for name, vals := range rec.Response.Header {
+		w.Header()[name] = vals
+	}
+	w.Header().Set(hdrIdempotentReplayed, "true")
+	w.WriteHeader(rec.Response.Status)
+	if len(rec.Response.Body) > 0 {
+		w.(http.ResponseWriter).Write(rec.Response.Body)
+	}
+}
+
+// requestSha256 tells requests made with the same key apart
+func requestSha256(r *rest.Request, body []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// recordingResponseWriter keeps a copy of the response written
+type recordingResponseWriter struct {
+	rest.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.(http.ResponseWriter).Write(b)
+}
+
+func (w *recordingResponseWriter) WriteJson(v interface{}) error {
+	b, err := w.EncodeJson(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (w *recordingResponseWriter) response() model.IdempotencyResponse {
+	resp := model.IdempotencyResponse{
+		Status: w.status,
+		Body:   w.body.Bytes(),
+	}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	for _, name := range idempotencyHeaders {
+		if vals, ok := w.Header()[name]; ok {
+			if resp.Header == nil {
+				resp.Header = map[string][]string{}
+			}
+			resp.Header[name] = vals
+		}
+	}
+	return resp
+}
@@ -23,8 +23,16 @@ type authSetV2 struct {
 	Id        string                 `json:"id"`
 	IdData    map[string]interface{} `json:"identity_data"`
 	PubKey    string                 `json:"pubkey"`
+	KeyType   string                 `json:"key_type,omitempty"`
 	Timestamp *time.Time             `json:"ts"`
 	Status    string                 `json:"status"`
+
+	Annotations map[string]interface{} `json:"annotations,omitempty"`
+	Conflict    string                 `json:"conflict,omitempty"`
+
+	TPMAttestation *model.TPMAttestationResult `json:"tpm_attestation,omitempty"`
+
+	FirstRequest *model.AuthSetRequest `json:"first_request,omitempty"`
 }
 
 func authSetV2FromDbModel(dbAuthSet *model.AuthSet) (*authSetV2, error) {
@@ -32,8 +40,16 @@ func authSetV2FromDbModel(dbAuthSet *model.AuthSet) (*authSetV2, error) {
 		Id:        dbAuthSet.Id,
 		IdData:    dbAuthSet.IdDataStruct,
 		PubKey:    dbAuthSet.PubKey,
+		KeyType:   dbAuthSet.KeyType,
 		Timestamp: dbAuthSet.Timestamp,
 		Status:    dbAuthSet.Status,
+
+		Annotations: dbAuthSet.Annotations,
+		Conflict:    dbAuthSet.Conflict,
+
+		TPMAttestation: dbAuthSet.TPMAttestation,
+
+		FirstRequest: dbAuthSet.FirstRequest,
 	}, nil
 }
 
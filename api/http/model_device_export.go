@@ -0,0 +1,177 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/utils"
+)
+
+// device export formats
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+)
+
+var exportFormats = []string{exportFormatCSV, exportFormatNDJSON}
+
+// deviceExport is a device as exported, one per line
+type deviceExport struct {
+	Id        string                 `json:"id"`
+	IdData    map[string]interface{} `json:"identity_data"`
+	Status    string                 `json:"status"`
+	KeyType   string                 `json:"key_type,omitempty"`
+	KeyFpr    string                 `json:"key_fingerprint,omitempty"`
+	CreatedTs time.Time              `json:"created_ts"`
+	UpdatedTs time.Time              `json:"updated_ts"`
+}
+
+// columns of CSV exports, in the order of deviceExport.csvRecord
+var deviceExportColumns = []string{
+	"id",
+	"identity_data",
+	"status",
+	"key_type",
+	"key_fingerprint",
+	"created_ts",
+	"updated_ts",
+}
+
+// deviceExportFromDbModel exports the device with the key of its accepted
+// auth set, or of its newest one if none is accepted
+func deviceExportFromDbModel(dev *model.Device) *deviceExport {
+	out := &deviceExport{
+		Id:        dev.Id,
+		IdData:    dev.IdDataStruct,
+		Status:    dev.Status,
+		CreatedTs: dev.CreatedTs,
+		UpdatedTs: dev.UpdatedTs,
+	}
+
+	var key *model.AuthSet
+	for i := range dev.AuthSets {
+		a := &dev.AuthSets[i]
+		switch {
+		case key == nil:
+			key = a
+		case key.Status == model.DevStatusAccepted:
+		case a.Status == model.DevStatusAccepted:
+			key = a
+		case a.Timestamp != nil &&
+			(key.Timestamp == nil || a.Timestamp.After(*key.Timestamp)):
+			key = a
+		}
+	}
+	if key != nil {
+		out.KeyType = key.KeyType
+		out.KeyFpr = utils.PubKeyFingerprint(key.PubKey)
+	}
+
+	return out
+}
+
+// csvRecord returns the CSV columns of the device, see deviceExportColumns;
+// the identity data is given as a JSON object
+func (d *deviceExport) csvRecord() ([]string, error) {
+	idData, err := json.Marshal(d.IdData)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{
+		d.Id,
+		string(idData),
+		d.Status,
+		d.KeyType,
+		d.KeyFpr,
+		d.CreatedTs.Format(time.RFC3339Nano),
+		d.UpdatedTs.Format(time.RFC3339Nano),
+	}, nil
+}
+
+// deviceExportWriter writes the devices of an export in one of the export
+// formats; the output is buffered until Flush
+type deviceExportWriter interface {
+	Write(d *deviceExport) error
+	Flush() error
+}
+
+// newDeviceExportWriter sets the headers of the export response, and
+// returns the writer of the devices in the format
+func newDeviceExportWriter(w http.ResponseWriter, format string) deviceExportWriter {
+	w.Header().Set("Content-Disposition",
+		"attachment; filename=\"devices."+format+"\"")
+
+	if format == exportFormatNDJSON {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		bw := bufio.NewWriter(w)
+		return &ndjsonDeviceExportWriter{w: bw, enc: json.NewEncoder(bw)}
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	return &csvDeviceExportWriter{w: csv.NewWriter(w)}
+}
+
+type csvDeviceExportWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (c *csvDeviceExportWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.w.Write(deviceExportColumns)
+}
+
+func (c *csvDeviceExportWriter) Write(d *deviceExport) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	rec, err := d.csvRecord()
+	if err != nil {
+		return err
+	}
+	return c.w.Write(rec)
+}
+
+func (c *csvDeviceExportWriter) Flush() error {
+	// the header is there even if there are no devices
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonDeviceExportWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (n *ndjsonDeviceExportWriter) Write(d *deviceExport) error {
+	return n.enc.Encode(d)
+}
+
+func (n *ndjsonDeviceExportWriter) Flush() error {
+	return n.w.Flush()
+}
@@ -23,7 +23,18 @@ type deviceV2 struct {
 	Id              string                 `json:"id"`
 	IdData          map[string]interface{} `json:"identity_data"`
 	Status          string                 `json:"status"`
+	KeyType         string                 `json:"key_type,omitempty"`
 	Decommissioning bool                   `json:"decommissioning"`
+	Owner           string                 `json:"owner,omitempty"`
+	Group           string                 `json:"group,omitempty"`
+	TransferId      string                 `json:"transfer_id,omitempty"`
+	DecommissionAt  *time.Time             `json:"decommission_at,omitempty"`
+	TokenLastUsed   *time.Time             `json:"token_last_used,omitempty"`
+	LastCheckin     *time.Time             `json:"last_checkin,omitempty"`
+	Alias           string                 `json:"alias,omitempty"`
+	Notes           string                 `json:"notes,omitempty"`
+	Labels          map[string]string      `json:"labels,omitempty"`
+	Conflict        bool                   `json:"conflict,omitempty"`
 	CreatedTs       time.Time              `json:"created_ts"`
 	UpdatedTs       time.Time              `json:"updated_ts"`
 	AuthSets        []authSetV2            `json:"auth_sets"`
@@ -38,7 +49,18 @@ func deviceV2FromDbModel(dbDevice *model.Device) (*deviceV2, error) {
 		Id:              dbDevice.Id,
 		IdData:          dbDevice.IdDataStruct,
 		Status:          dbDevice.Status,
+		KeyType:         dbDevice.KeyType,
 		Decommissioning: dbDevice.Decommissioning,
+		Owner:           dbDevice.Owner,
+		Group:           dbDevice.Group,
+		TransferId:      dbDevice.TransferId,
+		DecommissionAt:  dbDevice.DecommissionAt,
+		TokenLastUsed:   dbDevice.TokenLastUsed,
+		LastCheckin:     dbDevice.LastCheckin,
+		Alias:           dbDevice.Alias,
+		Notes:           dbDevice.Notes,
+		Labels:          dbDevice.Labels,
+		Conflict:        dbDevice.Conflict,
 		CreatedTs:       dbDevice.CreatedTs,
 		UpdatedTs:       dbDevice.UpdatedTs,
 		AuthSets:        authSets,
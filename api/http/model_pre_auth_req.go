@@ -14,7 +14,6 @@
 package http
 
 import (
-	"crypto/rsa"
 	"encoding/json"
 	"io"
 
@@ -66,12 +65,11 @@ func (r *preAuthReq) validate() error {
 		return err
 	}
 
-	keyStruct, ok := key.(*rsa.PublicKey)
-	if !ok {
+	if !utils.IsDeviceKey(key) {
 		return errors.New("cannot decode public key")
 	}
 
-	serialized, err := utils.SerializePubKey(keyStruct)
+	serialized, err := utils.SerializePubKey(key)
 	if err != nil {
 		return err
 	}
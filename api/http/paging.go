@@ -0,0 +1,111 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// query parameter of the cursor listings are paged with, in place of
+// page numbers
+const paramAfter = "after"
+
+const (
+	// relation of the link to the last page of a listing
+	linkLast = "last"
+
+	// header carrying the number of items a listing has over all pages
+	hdrTotalCount = "X-Total-Count"
+)
+
+var errCursorSort = errors.New("cursor doesn't match the sort order")
+
+// isCursorPaging tells whether the listing is paged with cursors, given
+// with the 'after' parameter, rather than page numbers; an empty cursor
+// lists from the beginning
+func isCursorPaging(r *rest.Request) (bool, error) {
+	q := r.URL.Query()
+	if _, ok := q[paramAfter]; !ok {
+		return false, nil
+	}
+	if q.Get(rest_utils.PageName) != "" {
+		return false, errors.Errorf("%s can't be used along with %s",
+			rest_utils.PageName, paramAfter)
+	}
+	return true, nil
+}
+
+// parseCursor decodes the cursor of the 'after' parameter, if any, and
+// checks that it is valid for the listing's sort order
+func parseCursor(r *rest.Request, sort string) (*store.Cursor, error) {
+	s := r.URL.Query().Get(paramAfter)
+	if s == "" {
+		return nil, nil
+	}
+
+	c, err := store.ParseCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	if c.Sort != sort {
+		return nil, errCursorSort
+	}
+
+	return c, nil
+}
+
+// makePageLinkHdrs returns the prev, next and first page links of a listing
+// along with the link to its last page, as follows from the total number
+// of items
+func makePageLinkHdrs(r *rest.Request, page, perPage uint64, hasNext bool, total int) []string {
+	links := rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext)
+
+	last := (uint64(total) + perPage - 1) / perPage
+	if last < 1 {
+		last = 1
+	}
+	return append(links, rest_utils.MakeLink(linkLast, r, last, perPage))
+}
+
+// makeCursorLinkHdrs returns the links to the first page of a cursor paged
+// listing and, if there are more items, to the page after the cursor
+func makeCursorLinkHdrs(r *rest.Request, perPage uint64, next *store.Cursor) []string {
+	link := func(rel, after string) string {
+		url := *r.URL
+		q := url.Query()
+		q.Set(paramAfter, after)
+		q.Set(rest_utils.PerPageName, strconv.FormatUint(perPage, 10))
+		url.RawQuery = q.Encode()
+
+		url.Host = r.Host
+		if url.Scheme == "" {
+			url.Scheme = rest_utils.DefaultScheme
+		}
+
+		return fmt.Sprintf(rest_utils.LinkTmpl, url.String(), rel)
+	}
+
+	var links []string
+	if next != nil {
+		links = append(links, link(rest_utils.LinkNext, next.Encode()))
+	}
+	return append(links, link(rest_utils.LinkFirst, ""))
+}
@@ -0,0 +1,256 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/utils"
+	"github.com/mendersoftware/deviceauth/utils/schema"
+)
+
+// request body schemas
+var (
+	schemaAuthReq = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"id_data": {"type": "string", "minLength": 1},
+			"pubkey": {"type": "string", "minLength": 1},
+			"certificate": {"type": "string", "minLength": 1},
+			"tenant_token": {"type": "string"},
+			"nonce": {"type": "string", "minLength": 1},
+			"bootstrap_token": {"type": "string", "minLength": 1},
+			"tpm_attestation": {
+				"type": "object",
+				"properties": {
+					"ek_certificate": {"type": "string", "minLength": 1},
+					"ak_public": {"type": "string", "minLength": 1},
+					"key_public": {"type": "string", "minLength": 1},
+					"certify_info": {"type": "string", "minLength": 1},
+					"certify_signature": {"type": "string", "minLength": 1},
+					"activated_credential": {"type": "string", "minLength": 1}
+				},
+				"required": ["ek_certificate", "ak_public", "key_public",
+					"certify_info", "certify_signature", "activated_credential"]
+			}
+		},
+		"required": ["id_data"]
+	}`)
+
+	schemaAuthChallengeReq = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"tpm": {
+				"type": "object",
+				"properties": {
+					"ek_certificate": {"type": "string", "minLength": 1},
+					"ak_public": {"type": "string", "minLength": 1}
+				},
+				"required": ["ek_certificate", "ak_public"]
+			}
+		}
+	}`)
+
+	schemaKeyRotationReq = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"id_data": {"type": "string", "minLength": 1},
+			"pubkey": {"type": "string", "minLength": 1},
+			"new_pubkey": {"type": "string", "minLength": 1},
+			"certificate": {"type": "string", "minLength": 1},
+			"tenant_token": {"type": "string"}
+		},
+		"required": ["id_data", "pubkey", "new_pubkey"]
+	}`)
+
+	schemaPreAuthReq = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"device_id": {"type": "string", "minLength": 1},
+			"auth_set_id": {"type": "string", "minLength": 1},
+			"id_data": {"type": "string", "minLength": 1},
+			"pubkey": {"type": "string", "minLength": 1}
+		},
+		"required": ["device_id", "auth_set_id", "id_data", "pubkey"]
+	}`)
+
+	schemaPreAuthReqV2 = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"identity_data": {"type": "object", "minProperties": 1},
+			"pubkey": {"type": "string", "minLength": 1}
+		},
+		"required": ["identity_data", "pubkey"]
+	}`)
+
+	schemaDevAdmAuthSetReq = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"device_identity": {"type": "string", "minLength": 1},
+			"key": {"type": "string", "minLength": 1}
+		},
+		"required": ["device_identity", "key"]
+	}`)
+
+	schemaDeviceStatus = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"status": {"enum": ["accepted", "rejected", "pending", "dismissed"]}
+		},
+		"required": ["status"]
+	}`)
+
+	schemaConflictResolution = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"others": {"enum": ["reject", "decommission"]}
+		},
+		"required": ["others"]
+	}`)
+
+	schemaDecisionStatus = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"status": {"enum": ["accepted", "rejected"]}
+		},
+		"required": ["status"]
+	}`)
+
+	schemaDevicesStatusReq = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"status": {"enum": ["accepted", "rejected"]},
+			"device_ids": {
+				"type": "array",
+				"items": {"type": "string", "minLength": 1}
+			},
+			"filter": {
+				"type": "object",
+				"properties": {
+					"status": {"enum": ["pending", "rejected", "accepted", "preauthorized"]},
+					"group": {"type": "string"},
+					"search": {"type": "string"},
+					"search_exact": {"type": "boolean"}
+				}
+			}
+		},
+		"required": ["status"]
+	}`)
+
+	schemaDeviceAnnotations = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"alias": {"type": ["string", "null"]},
+			"notes": {"type": ["string", "null"]},
+			"labels": {"type": ["object", "null"]},
+			"group": {
+				"type": ["string", "null"],
+				"maxLength": 1024,
+				"pattern": "^[A-Za-z0-9_-]*$"
+			}
+		},
+		"additionalProperties": false
+	}`)
+
+	schemaLimit = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"limit": {"type": "integer", "minimum": 0}
+		},
+		"required": ["limit"]
+	}`)
+
+	schemaTransferReq = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"device_id": {"type": "string", "minLength": 1},
+			"to_owner": {"type": "string"},
+			"to_tenant_id": {"type": "string"}
+		},
+		"required": ["device_id"]
+	}`)
+
+	schemaDeviceGroup = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"group": {
+				"type": "string",
+				"minLength": 1,
+				"maxLength": 1024,
+				"pattern": "^[A-Za-z0-9_-]+$"
+			}
+		},
+		"required": ["group"]
+	}`)
+
+	schemaDecommissionAt = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"decommission_at": {"type": "string", "minLength": 1}
+		},
+		"required": ["decommission_at"]
+	}`)
+
+	schemaBootstrapTokenReq = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"identity_data": {"type": "object", "minProperties": 1},
+			"expires_in": {"type": "integer", "minimum": 1}
+		},
+		"required": ["identity_data"]
+	}`)
+
+	schemaNewTenant = schema.MustCompile(`{
+		"type": "object",
+		"properties": {
+			"tenant_id": {"type": "string", "minLength": 1}
+		},
+		"required": ["tenant_id"]
+	}`)
+)
+
+// checkRequestBody validates the request body against the schema; if it
+// doesn't conform, writes a 400 response listing the violations and returns
+// false. The body is left in place for the handler to decode; malformed
+// JSON is left for the decoder to report.
+func checkRequestBody(w rest.ResponseWriter, r *rest.Request, s *schema.Schema) bool {
+	l := log.FromContext(r.Context())
+
+	body, err := utils.ReadBodyRaw(r)
+	if err != nil {
+		rest_utils.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to read request body"),
+			http.StatusBadRequest)
+		return false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err := s.Validate(body); err != nil {
+		if _, ok := err.(schema.ValidationErrors); ok {
+			rest_utils.RestErrWithLog(w, r, l,
+				errors.Wrap(err, "invalid request body"),
+				http.StatusBadRequest)
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,288 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+// Package catalog keeps the user facing error messages, keyed by error code,
+// and allows translating them according to the client's Accept-Language.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Code identifies a user facing error message
+type Code string
+
+const (
+	CodeUnauthorized          Code = "unauthorized"
+	CodeBadRequest            Code = "bad_request"
+	CodeDevIdAuthIdMismatch   Code = "dev_id_auth_id_mismatch"
+	CodeMaxDeviceCountReached Code = "max_device_count_reached"
+	CodeDeviceExists          Code = "device_exists"
+	CodeDeviceNotFound        Code = "device_not_found"
+
+	CodeDeviceAuthzDisabled  Code = "device_authz_disabled"
+	CodeAuthorizationPending Code = "authorization_pending"
+	CodeSlowDown             Code = "slow_down"
+	CodeAccessDenied         Code = "access_denied"
+	CodeExpiredToken         Code = "expired_token"
+	CodeInvalidGrant         Code = "invalid_grant"
+	CodeUserCodeNotFound     Code = "user_code_not_found"
+
+	CodeTransferNotFound       Code = "transfer_not_found"
+	CodeTransferInProgress     Code = "transfer_in_progress"
+	CodeTransferNotPending     Code = "transfer_not_pending"
+	CodeTransferTenantDisabled Code = "transfer_tenant_disabled"
+	CodeTransferNotApprovable  Code = "transfer_not_approvable"
+
+	CodeDecommissionAtPast Code = "decommission_at_past"
+
+	CodeRejectedRetentionNotSet Code = "rejected_device_retention_not_set"
+
+	CodeDeviceQuarantined    Code = "device_quarantined"
+	CodeDeviceNotQuarantined Code = "device_not_quarantined"
+
+	CodeTenantSuspended Code = "tenant_suspended"
+
+	CodeDeviceCertsDisabled  Code = "device_certs_disabled"
+	CodeDeviceCertNotTrusted Code = "device_cert_not_trusted"
+	CodeDeviceCertRequired   Code = "device_cert_required"
+	CodeClientCertRequired   Code = "client_cert_required"
+	CodeClientCertMismatch   Code = "client_cert_mismatch"
+
+	CodeWeakKey Code = "weak_key"
+
+	CodeAuthNonceRequired Code = "auth_nonce_required"
+	CodeAuthNonceInvalid  Code = "auth_nonce_invalid"
+
+	CodeAuthTimestampRequired Code = "auth_timestamp_required"
+	CodeAuthTimestampSkew     Code = "auth_timestamp_skew"
+
+	CodeTPMAttestationDisabled Code = "tpm_attestation_disabled"
+
+	CodeDeviceKeyExists      Code = "device_key_exists"
+	CodeDeviceKeyNotFound    Code = "device_key_not_found"
+	CodeMaxDeviceKeysReached Code = "max_device_keys_reached"
+
+	CodeInvalidRefreshToken Code = "invalid_refresh_token"
+
+	CodeInvalidBootstrapToken Code = "invalid_bootstrap_token"
+
+	CodeNoPendingAuthSet  Code = "no_pending_auth_set"
+	CodeAuthSetNotFound   Code = "auth_set_not_found"
+	CodeAuthSetNotPending Code = "auth_set_not_pending"
+	CodeAuthSetNoConflict Code = "auth_set_no_conflict"
+
+	CodeMaxDeviceLabelsReached Code = "max_device_labels_reached"
+)
+
+// default (English) messages
+var messages = map[Code]string{
+	CodeUnauthorized:          "dev auth: unauthorized",
+	CodeBadRequest:            "dev auth: bad request",
+	CodeDevIdAuthIdMismatch:   "dev auth: dev ID and auth ID mismatch",
+	CodeMaxDeviceCountReached: "maximum number of accepted devices reached",
+	CodeDeviceExists:          "device already exists",
+	CodeDeviceNotFound:        "device not found",
+
+	CodeDeviceAuthzDisabled:  "device authorization grant is not enabled",
+	CodeAuthorizationPending: "authorization pending",
+	CodeSlowDown:             "polling too frequently",
+	CodeAccessDenied:         "access denied",
+	CodeExpiredToken:         "device code expired",
+	CodeInvalidGrant:         "invalid device code",
+	CodeUserCodeNotFound:     "user code not found",
+
+	CodeTransferNotFound:       "transfer not found",
+	CodeTransferInProgress:     "device transfer already in progress",
+	CodeTransferNotPending:     "transfer already completed or cancelled",
+	CodeTransferTenantDisabled: "transfers to other tenants require multi-tenancy",
+	CodeTransferNotApprovable:  "transfer is not awaiting approval",
+
+	CodeDecommissionAtPast: "decommissioning time must be in the future",
+
+	CodeRejectedRetentionNotSet: "no rejected device retention configured, the age is required",
+
+	CodeDeviceQuarantined:    "device is quarantined",
+	CodeDeviceNotQuarantined: "device is not quarantined",
+
+	CodeTenantSuspended: "account suspended",
+
+	CodeDeviceCertsDisabled:  "certificate enrollment is not enabled",
+	CodeDeviceCertNotTrusted: "device certificate not trusted",
+	CodeDeviceCertRequired:   "device certificate required",
+	CodeClientCertRequired:   "client certificate required",
+	CodeClientCertMismatch:   "client certificate doesn't match the identity data",
+
+	CodeWeakKey: "public key doesn't meet the key policy",
+
+	CodeAuthNonceRequired: "auth request nonce required",
+	CodeAuthNonceInvalid:  "auth request nonce invalid or expired",
+
+	CodeAuthTimestampRequired: "auth request timestamp required",
+	CodeAuthTimestampSkew:     "auth request timestamp too far off the server time",
+
+	CodeTPMAttestationDisabled: "TPM attestation is not enabled",
+
+	CodeDeviceKeyExists:      "the device already has an auth set with the new key",
+	CodeDeviceKeyNotFound:    "device key not found",
+	CodeMaxDeviceKeysReached: "maximum number of accepted keys for the device reached",
+
+	CodeInvalidRefreshToken: "invalid refresh token",
+
+	CodeInvalidBootstrapToken: "invalid bootstrap token",
+
+	CodeNoPendingAuthSet:  "the device has no pending auth set to accept",
+	CodeAuthSetNotFound:   "auth set not found",
+	CodeAuthSetNotPending: "only pending auth sets can be dismissed",
+	CodeAuthSetNoConflict: "the auth set is not in conflict",
+
+	CodeMaxDeviceLabelsReached: "maximum number of labels for the device reached",
+}
+
+// Message returns the default message for the code; the code itself if it's
+// not in the catalog
+func Message(code Code) string {
+	if msg, ok := messages[code]; ok {
+		return msg
+	}
+	return string(code)
+}
+
+// Translator is the hook for localizing messages; returns the message for
+// the code in the first of the languages it has a translation for, and that
+// language
+type Translator interface {
+	Translate(code Code, langs []string) (msg string, lang string, ok bool)
+}
+
+// Translations is a Translator backed by a static table, messages by code
+// by language tag (e.g. "de", "pt-BR")
+type Translations map[string]map[Code]string
+
+// LoadTranslations reads translations from a JSON file, keyed by language
+// tag and code, e.g. {"de": {"device_exists": "Gerät existiert bereits"}}
+func LoadTranslations(path string) (Translations, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read translations")
+	}
+
+	var t Translations
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, errors.Wrap(err, "failed to parse translations")
+	}
+
+	// language tags are case insensitive
+	norm := make(Translations, len(t))
+	for lang, msgs := range t {
+		norm[strings.ToLower(lang)] = msgs
+	}
+	return norm, nil
+}
+
+// Translate looks up each language, falling back from a regional variant to
+// its base language (e.g. "de-at" to "de")
+func (t Translations) Translate(code Code, langs []string) (string, string, bool) {
+	for _, lang := range langs {
+		for tag := lang; tag != ""; {
+			if msg, ok := t[tag][code]; ok {
+				return msg, tag, true
+			}
+			i := strings.LastIndex(tag, "-")
+			if i < 0 {
+				break
+			}
+			tag = tag[:i]
+		}
+	}
+	return "", "", false
+}
+
+// ParseAcceptLanguage returns the language tags of an Accept-Language header,
+// lowercase, most preferred first; the wildcard and tags with zero quality
+// are skipped
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		tags = append(tags, weighted{tag, q})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	langs := make([]string, len(tags))
+	for i, t := range tags {
+		langs[i] = t.tag
+	}
+	return langs
+}
+
+type translatorKey struct{}
+
+// WithTranslator stores the translator for a request in ctx
+func WithTranslator(ctx context.Context, t Translator) context.Context {
+	return context.WithValue(ctx, translatorKey{}, t)
+}
+
+// Localize returns the message for the code in one of the languages, if
+// there's a translator in ctx that has it; otherwise returns msg as is, with
+// an empty language. Only the code's own message is localized, a more
+// specific msg is returned as is, so that its detail isn't lost.
+func Localize(ctx context.Context, code Code, langs []string, msg string) (string, string) {
+	t, ok := ctx.Value(translatorKey{}).(Translator)
+	if !ok || t == nil || code == "" || len(langs) == 0 {
+		return msg, ""
+	}
+	if msg != Message(code) {
+		return msg, ""
+	}
+
+	if tmsg, lang, ok := t.Translate(code, langs); ok {
+		return tmsg, lang
+	}
+	return msg, ""
+}
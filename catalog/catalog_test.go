@@ -0,0 +1,141 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package catalog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage(t *testing.T) {
+	assert.Equal(t, "device already exists", Message(CodeDeviceExists))
+	assert.Equal(t, "no_such_code", Message(Code("no_such_code")))
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string][]string{
+		"":                            {},
+		"de":                          {"de"},
+		"da, en-GB;q=0.8, en;q=0.7":   {"da", "en-gb", "en"},
+		"en;q=0.5, pt-BR, *;q=0.1":    {"pt-br", "en"},
+		"fr;q=0, de;q=bogus, it;q=.3": {"it"},
+	}
+
+	for header, langs := range testCases {
+		t.Run(header, func(t *testing.T) {
+			assert.Equal(t, langs, ParseAcceptLanguage(header))
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	t.Parallel()
+
+	tr := Translations{
+		"de":    {CodeDeviceExists: "Gerät existiert bereits"},
+		"pt-br": {CodeDeviceExists: "dispositivo já existe"},
+	}
+
+	testCases := map[string]struct {
+		code  Code
+		langs []string
+
+		msg  string
+		lang string
+		ok   bool
+	}{
+		"exact": {
+			code:  CodeDeviceExists,
+			langs: []string{"pt-br"},
+			msg:   "dispositivo já existe",
+			lang:  "pt-br",
+			ok:    true,
+		},
+		"base language": {
+			code:  CodeDeviceExists,
+			langs: []string{"fr", "de-at"},
+			msg:   "Gerät existiert bereits",
+			lang:  "de",
+			ok:    true,
+		},
+		"no language": {
+			code:  CodeDeviceExists,
+			langs: []string{"pt"},
+		},
+		"no code": {
+			code:  CodeDeviceNotFound,
+			langs: []string{"de"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			msg, lang, ok := tr.Translate(tc.code, tc.langs)
+			assert.Equal(t, tc.msg, msg)
+			assert.Equal(t, tc.lang, lang)
+			assert.Equal(t, tc.ok, ok)
+		})
+	}
+}
+
+func TestLoadTranslations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "translations.json")
+	err = ioutil.WriteFile(path,
+		[]byte(`{"pt-BR": {"device_exists": "dispositivo já existe"}}`), 0600)
+	assert.NoError(t, err)
+
+	tr, err := LoadTranslations(path)
+	assert.NoError(t, err)
+	assert.Equal(t, Translations{
+		"pt-br": {CodeDeviceExists: "dispositivo já existe"},
+	}, tr)
+
+	_, err = LoadTranslations(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestLocalize(t *testing.T) {
+	ctx := context.Background()
+	langs := []string{"de"}
+
+	msg, lang := Localize(ctx, CodeDeviceExists, langs, "device already exists")
+	assert.Equal(t, "device already exists", msg)
+	assert.Equal(t, "", lang)
+
+	ctx = WithTranslator(ctx, Translations{
+		"de": {CodeDeviceExists: "Gerät existiert bereits"},
+	})
+	msg, lang = Localize(ctx, CodeDeviceExists, langs, "device already exists")
+	assert.Equal(t, "Gerät existiert bereits", msg)
+	assert.Equal(t, "de", lang)
+
+	// specific messages aren't replaced with the code's generic one
+	ctx = WithTranslator(ctx, Translations{
+		"de": {CodeBadRequest: "Ungültige Anfrage"},
+	})
+	msg, lang = Localize(ctx, CodeBadRequest, langs, "invalid device id")
+	assert.Equal(t, "invalid device id", msg)
+	assert.Equal(t, "", lang)
+}
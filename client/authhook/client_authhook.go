@@ -0,0 +1,157 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package authhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+const (
+	// default request timeout, 10s?
+	defaultReqTimeout = time.Duration(10) * time.Second
+)
+
+// CheckAuthReq is the payload POSTed to the auth request check webhook
+type CheckAuthReq struct {
+	// Request ID
+	RequestId string `json:"request_id"`
+	// Tenant ID, empty in single tenant setups
+	TenantId string `json:"tenant_id,omitempty"`
+	// Device identity data
+	IdData map[string]interface{} `json:"id_data"`
+	// Device public key
+	PubKey string `json:"pubkey"`
+}
+
+// Config conveys client configuration
+type Config struct {
+	// Webhook URL
+	HookAddr string
+	// Shared secret sent as a bearer token (optional)
+	Secret string
+	// Request timeout
+	Timeout time.Duration
+}
+
+// ClientRunner is an interface of auth request check webhook client
+type ClientRunner interface {
+	CheckAuthRequest(ctx context.Context, r *model.AuthReq) (*model.AuthReqCheck, error)
+}
+
+// Client is an opaque implementation of auth request check webhook client.
+// Implements ClientRunner interface
+type Client struct {
+	conf Config
+	mu   sync.RWMutex
+}
+
+// SetSecret replaces the shared secret, e.g. after it was rotated in an
+// external secret store
+func (c *Client) SetSecret(secret string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conf.Secret = secret
+}
+
+func (c *Client) secret() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conf.Secret
+}
+
+// CheckAuthRequest will submit auth request data to the configured webhook,
+// which is expected to respond with 200 and a JSON encoded model.AuthReqCheck
+func (c *Client) CheckAuthRequest(ctx context.Context, r *model.AuthReq) (*model.AuthReqCheck, error) {
+	l := log.FromContext(ctx)
+	client := http.Client{}
+
+	checkReq := CheckAuthReq{
+		RequestId: requestid.FromContext(ctx),
+		PubKey:    r.PubKey,
+	}
+
+	if ident := identity.FromContext(ctx); ident != nil {
+		checkReq.TenantId = ident.Tenant
+	}
+
+	if err := json.Unmarshal([]byte(r.IdData), &checkReq.IdData); err != nil {
+		return nil, errors.Wrap(err, "failed to decode identity data")
+	}
+
+	body, err := json.Marshal(checkReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode auth request check")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.conf.HookAddr, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if secret := c.secret(); secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.conf.Timeout)
+	defer cancel()
+
+	rsp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to submit auth request check")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		body, err := ioutil.ReadAll(rsp.Body)
+		if err != nil {
+			body = []byte("<failed to read>")
+		}
+		l.Errorf("auth request check %s %s failed with status %v, response text: %s",
+			req.Method, req.URL, rsp.Status, body)
+
+		return nil, errors.Errorf(
+			"auth request check failed with status %v", rsp.Status)
+	}
+
+	var res model.AuthReqCheck
+	if err := json.NewDecoder(rsp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "failed to decode auth request check result")
+	}
+
+	return &res, nil
+}
+
+func NewClient(c Config) *Client {
+	if c.Timeout == 0 {
+		c.Timeout = defaultReqTimeout
+	}
+
+	return &Client{
+		conf: c,
+	}
+}
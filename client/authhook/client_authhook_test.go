@@ -0,0 +1,150 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package authhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ct "github.com/mendersoftware/deviceauth/client/testing"
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+func TestGetClient(t *testing.T) {
+	t.Parallel()
+
+	c := NewClient(Config{
+		HookAddr: "localhost:6666",
+	})
+	assert.NotNil(t, c)
+}
+
+func TestClientCheckAuthRequest(t *testing.T) {
+	t.Parallel()
+
+	authReq := &model.AuthReq{
+		IdData: `{"mac":"00:00:00:01"}`,
+		PubKey: "pubkey",
+	}
+
+	testCases := map[string]struct {
+		status int
+		body   []byte
+		req    *model.AuthReq
+
+		res *model.AuthReqCheck
+		err string
+	}{
+		"ok": {
+			status: http.StatusOK,
+			body:   []byte(`{"reject": false, "annotations": {"fw": "1.0"}}`),
+			req:    authReq,
+			res: &model.AuthReqCheck{
+				Annotations: map[string]interface{}{"fw": "1.0"},
+			},
+		},
+		"rejected": {
+			status: http.StatusOK,
+			body:   []byte(`{"reject": true, "reason": "unknown serial"}`),
+			req:    authReq,
+			res: &model.AuthReqCheck{
+				Reject: true,
+				Reason: "unknown serial",
+			},
+		},
+		"error: bad status": {
+			status: http.StatusInternalServerError,
+			req:    authReq,
+			err:    "auth request check failed with status 500 Internal Server Error",
+		},
+		"error: bad response": {
+			status: http.StatusOK,
+			body:   []byte(`not json`),
+			req:    authReq,
+			err:    "failed to decode auth request check result: invalid character 'o' in literal null (expecting 'u')",
+		},
+		"error: bad id data": {
+			status: http.StatusOK,
+			req: &model.AuthReq{
+				IdData: "foo",
+			},
+			err: "failed to decode identity data: invalid character 'o' in literal false (expecting 'a')",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, rd := ct.NewMockServer(tc.status, tc.body)
+			defer s.Close()
+
+			c := NewClient(Config{
+				HookAddr: s.URL,
+			})
+
+			res, err := c.CheckAuthRequest(context.Background(), tc.req)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.res, res)
+
+			var sent CheckAuthReq
+			assert.NoError(t, json.Unmarshal(rd.ReqBody, &sent))
+			assert.Equal(t, "pubkey", sent.PubKey)
+			assert.Equal(t, "00:00:00:01", sent.IdData["mac"])
+			assert.Empty(t, rd.Headers.Get("Authorization"))
+		})
+	}
+}
+
+func TestClientCheckAuthRequestSecret(t *testing.T) {
+	t.Parallel()
+
+	s, rd := ct.NewMockServer(http.StatusOK, []byte(`{}`))
+	defer s.Close()
+
+	c := NewClient(Config{
+		HookAddr: s.URL,
+		Secret:   "foo",
+	})
+
+	_, err := c.CheckAuthRequest(context.Background(),
+		&model.AuthReq{IdData: "{}"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer foo", rd.Headers.Get("Authorization"))
+
+	c.SetSecret("bar")
+
+	_, err = c.CheckAuthRequest(context.Background(),
+		&model.AuthReq{IdData: "{}"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer bar", rd.Headers.Get("Authorization"))
+}
+
+func TestClientReqNoHost(t *testing.T) {
+	t.Parallel()
+
+	c := NewClient(Config{
+		HookAddr: "http://somehost:1234",
+	})
+
+	_, err := c.CheckAuthRequest(context.Background(), &model.AuthReq{IdData: "{}"})
+	assert.Error(t, err, "expected an error")
+}
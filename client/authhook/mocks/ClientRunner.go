@@ -0,0 +1,46 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mocks
+
+import context "context"
+import mock "github.com/stretchr/testify/mock"
+import model "github.com/mendersoftware/deviceauth/model"
+
+// ClientRunner is an autogenerated mock type for the ClientRunner type
+type ClientRunner struct {
+	mock.Mock
+}
+
+// CheckAuthRequest provides a mock function with given fields: ctx, r
+func (_m *ClientRunner) CheckAuthRequest(ctx context.Context, r *model.AuthReq) (*model.AuthReqCheck, error) {
+	ret := _m.Called(ctx, r)
+
+	var r0 *model.AuthReqCheck
+	if rf, ok := ret.Get(0).(func(context.Context, *model.AuthReq) *model.AuthReqCheck); ok {
+		r0 = rf(ctx, r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AuthReqCheck)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.AuthReq) error); ok {
+		r1 = rf(ctx, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
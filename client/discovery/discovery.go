@@ -0,0 +1,226 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package discovery
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SchemePrefix marks addresses resolved via DNS SRV records, e.g.:
+	// srv+http://_tenantadm._tcp.mender.local/
+	SchemePrefix = "srv+"
+
+	// time SRV lookup results are cached for
+	defaultCacheTTL = 30 * time.Second
+	// time a failed endpoint is moved to the end of the list for
+	defaultDownTime = 30 * time.Second
+)
+
+var (
+	ErrNoEndpoints = errors.New("no endpoints found")
+)
+
+type lookupSRVFunc func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+// Endpoint is a downstream service address; either a static URL, or a DNS
+// SRV record name resolving to a set of replicas
+type Endpoint struct {
+	static string
+
+	srv    bool
+	scheme string
+	name   string
+	path   string
+
+	lookup   lookupSRVFunc
+	cacheTTL time.Duration
+	downTime time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	addrs     []string
+	fetchedAt time.Time
+	down      map[string]time.Time
+}
+
+// NewEndpoint creates an endpoint for the given address; addresses with
+// the 'srv+' scheme prefix are resolved via DNS SRV, any other address is
+// used as is
+func NewEndpoint(addr string) *Endpoint {
+	e := &Endpoint{
+		static:   addr,
+		lookup:   net.DefaultResolver.LookupSRV,
+		cacheTTL: defaultCacheTTL,
+		downTime: defaultDownTime,
+		now:      time.Now,
+		down:     map[string]time.Time{},
+	}
+
+	if !strings.HasPrefix(addr, SchemePrefix) {
+		return e
+	}
+
+	u, err := url.Parse(strings.TrimPrefix(addr, SchemePrefix))
+	if err != nil || u.Host == "" {
+		// leave it to the HTTP client to report the bad address
+		return e
+	}
+
+	e.srv = true
+	e.scheme = u.Scheme
+	e.name = u.Host
+	e.path = u.Path
+	return e
+}
+
+// Addrs returns the base URLs of the endpoint, in the order they should be
+// tried: by SRV priority and weight, with endpoints that failed recently last
+func (e *Endpoint) Addrs(ctx context.Context) ([]string, error) {
+	if !e.srv {
+		return []string{e.static}, nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	if e.addrs == nil || now.Sub(e.fetchedAt) > e.cacheTTL {
+		addrs, err := e.resolve(ctx)
+		if err != nil {
+			if e.addrs == nil {
+				return nil, err
+			}
+			// keep serving the stale set if DNS is unavailable
+		} else {
+			e.addrs = addrs
+			e.fetchedAt = now
+		}
+	}
+
+	healthy := make([]string, 0, len(e.addrs))
+	var unhealthy []string
+	for _, a := range e.addrs {
+		if t, ok := e.down[a]; ok && now.Sub(t) < e.downTime {
+			unhealthy = append(unhealthy, a)
+		} else {
+			delete(e.down, a)
+			healthy = append(healthy, a)
+		}
+	}
+
+	return append(healthy, unhealthy...), nil
+}
+
+func (e *Endpoint) resolve(ctx context.Context) ([]string, error) {
+	_, recs, err := e.lookup(ctx, "", "", e.name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve SRV records of %s", e.name)
+	}
+	if len(recs) == 0 {
+		return nil, errors.Wrap(ErrNoEndpoints, e.name)
+	}
+
+	addrs := make([]string, len(recs))
+	for i, rec := range recs {
+		host := strings.TrimSuffix(rec.Target, ".")
+		u := url.URL{
+			Scheme: e.scheme,
+			Host:   net.JoinHostPort(host, strconv.Itoa(int(rec.Port))),
+			Path:   e.path,
+		}
+		addrs[i] = u.String()
+	}
+	return addrs, nil
+}
+
+// MarkDown moves the address to the end of the list for a while
+func (e *Endpoint) MarkDown(addr string) {
+	if !e.srv {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.down[addr] = e.now()
+}
+
+// unavailable tells whether the status means the instance couldn't handle
+// the request at all, rather than failed processing it
+func unavailable(status int) bool {
+	switch status {
+	case http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// notSent tells whether the request failed before it was sent, i.e. the
+// connection couldn't be established
+func notSent(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	operr, ok := err.(*net.OpError)
+	return ok && operr.Op == "dial"
+}
+
+// Do calls the request function with consecutive endpoint addresses until
+// one responds. Failures to connect are retried on the next address.
+// Responses saying the instance is unavailable (502, 503, 504), and errors
+// after the request was sent, e.g. timeouts, are retried only if the
+// request is idempotent, i.e. safe to send more than once; any other
+// response, including other server errors, is returned as is. So is the
+// last attempt's response.
+func (e *Endpoint) Do(ctx context.Context, idempotent bool,
+	do func(addr string) (*http.Response, error)) (*http.Response, error) {
+
+	addrs, err := e.Addrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rsp *http.Response
+	for i, addr := range addrs {
+		rsp, err = do(addr)
+		if err == nil && !unavailable(rsp.StatusCode) {
+			return rsp, nil
+		}
+
+		e.MarkDown(addr)
+
+		// the instance may have processed the request
+		if !idempotent && (err == nil || !notSent(err)) {
+			return rsp, err
+		}
+		if i == len(addrs)-1 || ctx.Err() != nil {
+			break
+		}
+		if rsp != nil {
+			rsp.Body.Close()
+		}
+	}
+	return rsp, err
+}
@@ -0,0 +1,256 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointStatic(t *testing.T) {
+	t.Parallel()
+
+	for _, addr := range []string{
+		"http://mender-tenantadm:8080/",
+		"",
+		"srv+http://%zz",
+	} {
+		e := NewEndpoint(addr)
+		addrs, err := e.Addrs(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{addr}, addrs)
+
+		e.MarkDown(addr)
+		addrs, _ = e.Addrs(context.Background())
+		assert.Equal(t, []string{addr}, addrs)
+	}
+}
+
+func TestEndpointSRV(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	lookups := 0
+	var lookupErr error
+
+	e := NewEndpoint("srv+http://_tenantadm._tcp.mender.local/base")
+	e.now = func() time.Time { return now }
+	e.lookup = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		lookups++
+		assert.Equal(t, "_tenantadm._tcp.mender.local", name)
+		if lookupErr != nil {
+			return "", nil, lookupErr
+		}
+		return "", []*net.SRV{
+			{Target: "tenantadm-0.mender.local.", Port: 8080},
+			{Target: "tenantadm-1.mender.local.", Port: 8081},
+		}, nil
+	}
+
+	addrs, err := e.Addrs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"http://tenantadm-0.mender.local:8080/base",
+		"http://tenantadm-1.mender.local:8081/base",
+	}, addrs)
+
+	// failed endpoints go last until the down time passes
+	e.MarkDown("http://tenantadm-0.mender.local:8080/base")
+	addrs, _ = e.Addrs(context.Background())
+	assert.Equal(t, []string{
+		"http://tenantadm-1.mender.local:8081/base",
+		"http://tenantadm-0.mender.local:8080/base",
+	}, addrs)
+	assert.Equal(t, 1, lookups)
+
+	// stale records are served if DNS fails
+	now = now.Add(defaultDownTime + time.Second)
+	lookupErr = errors.New("dns failed")
+	addrs, err = e.Addrs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"http://tenantadm-0.mender.local:8080/base",
+		"http://tenantadm-1.mender.local:8081/base",
+	}, addrs)
+	assert.Equal(t, 2, lookups)
+}
+
+func TestEndpointSRVLookupError(t *testing.T) {
+	t.Parallel()
+
+	e := NewEndpoint("srv+http://_tenantadm._tcp.mender.local")
+	e.lookup = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, nil
+	}
+
+	_, err := e.Addrs(context.Background())
+	assert.EqualError(t, err, "_tenantadm._tcp.mender.local: no endpoints found")
+
+	_, err = e.Do(context.Background(), true, func(addr string) (*http.Response, error) {
+		t.Fatal("should not be called")
+		return nil, nil
+	})
+	assert.Error(t, err)
+}
+
+func TestEndpointDo(t *testing.T) {
+	t.Parallel()
+
+	failing := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer failing.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+	defer broken.Close()
+
+	ok := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	defer ok.Close()
+
+	// closes the connection having read the request
+	hangup := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}))
+	defer hangup.Close()
+
+	testCases := map[string]struct {
+		targets       []string
+		notIdempotent bool
+
+		status int
+		err    bool
+		tried  int
+		down   bool
+	}{
+		"first ok": {
+			targets: []string{ok.URL, failing.URL},
+			status:  http.StatusOK,
+			tried:   1,
+		},
+		"failover on unavailable": {
+			targets: []string{failing.URL, ok.URL},
+			status:  http.StatusOK,
+			tried:   2,
+			down:    true,
+		},
+		"no failover on unavailable, not idempotent": {
+			targets:       []string{failing.URL, ok.URL},
+			notIdempotent: true,
+			status:        http.StatusServiceUnavailable,
+			tried:         1,
+			down:          true,
+		},
+		"no failover on application error": {
+			targets: []string{broken.URL, ok.URL},
+			status:  http.StatusInternalServerError,
+			tried:   1,
+		},
+		"failover on connection error": {
+			targets: []string{"http://127.0.0.1:0", ok.URL},
+			status:  http.StatusOK,
+			tried:   2,
+			down:    true,
+		},
+		"failover on connection error, not idempotent": {
+			targets:       []string{"http://127.0.0.1:0", ok.URL},
+			notIdempotent: true,
+			status:        http.StatusOK,
+			tried:         2,
+			down:          true,
+		},
+		"failover on error after sending": {
+			targets: []string{hangup.URL, ok.URL},
+			status:  http.StatusOK,
+			tried:   2,
+			down:    true,
+		},
+		"no failover on error after sending, not idempotent": {
+			targets:       []string{hangup.URL, ok.URL},
+			notIdempotent: true,
+			err:           true,
+			tried:         1,
+			down:          true,
+		},
+		"all failing, last response returned": {
+			targets: []string{"http://127.0.0.1:0", failing.URL},
+			status:  http.StatusServiceUnavailable,
+			tried:   2,
+		},
+		"all failing, last error returned": {
+			targets: []string{failing.URL, "http://127.0.0.1:0"},
+			err:     true,
+			tried:   2,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recs := make([]*net.SRV, len(tc.targets))
+			for i := range tc.targets {
+				recs[i] = &net.SRV{Target: "host", Port: uint16(i)}
+			}
+
+			e := NewEndpoint("srv+http://_svc._tcp.local")
+			e.lookup = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+				return "", recs, nil
+			}
+			// map resolved addresses to test servers
+			addrs, _ := e.Addrs(context.Background())
+			targets := map[string]string{}
+			for i, a := range addrs {
+				targets[a] = tc.targets[i]
+			}
+
+			tried := 0
+			rsp, err := e.Do(context.Background(), !tc.notIdempotent,
+				func(addr string) (*http.Response, error) {
+					tried++
+					return http.Get(targets[addr])
+				})
+			assert.Equal(t, tc.tried, tried)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.status, rsp.StatusCode)
+				rsp.Body.Close()
+			}
+
+			// unavailable endpoints are tried last next time, those
+			// failing to process the request are not
+			addrs, _ = e.Addrs(context.Background())
+			if tc.down {
+				assert.Equal(t, tc.targets[1], targets[addrs[0]])
+			} else {
+				assert.Equal(t, tc.targets[0], targets[addrs[0]])
+			}
+		})
+	}
+}
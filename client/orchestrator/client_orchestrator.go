@@ -24,6 +24,7 @@ import (
 	"github.com/mendersoftware/go-lib-micro/log"
 	"github.com/pkg/errors"
 
+	"github.com/mendersoftware/deviceauth/client/discovery"
 	"github.com/mendersoftware/deviceauth/model"
 	"github.com/mendersoftware/deviceauth/utils"
 )
@@ -60,7 +61,8 @@ type ProvisionDeviceReq struct {
 
 // Config conveys client configuration
 type Config struct {
-	// Orchestrator host
+	// Orchestrator host; use the 'srv+' scheme prefix for DNS SRV
+	// discovery, e.g. srv+http://_conductor._tcp.mender.local
 	OrchestratorAddr string
 	// Request timeout
 	Timeout time.Duration
@@ -75,7 +77,8 @@ type ClientRunner interface {
 // Client is an opaque implementation of orchestrator client. Implements
 // ClientRunner interface
 type Client struct {
-	conf Config
+	conf     Config
+	endpoint *discovery.Endpoint
 }
 
 func (co *Client) SubmitDeviceDecommisioningJob(ctx context.Context, decommissioningReq DecommissioningReq) error {
@@ -90,23 +93,25 @@ func (co *Client) SubmitDeviceDecommisioningJob(ctx context.Context, decommissio
 		return errors.Wrapf(err, "failed to submit device decommissioning job")
 	}
 
-	contentReader := bytes.NewReader(DecommissioningReqJson)
-
-	req, err := http.NewRequest(
-		http.MethodPost,
-		utils.JoinURL(co.conf.OrchestratorAddr, DeviceDecommissioningOrchestratorUri),
-		contentReader)
-	if err != nil {
-		return errors.Wrapf(err, "failed to create request")
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
 	// set the device admission request timeout
 	ctx, cancel := context.WithTimeout(ctx, co.conf.Timeout)
 	defer cancel()
 
-	rsp, err := client.Do(req.WithContext(ctx))
+	var req *http.Request
+	// each request starts a workflow, so it must not be resent
+	rsp, err := co.endpoint.Do(ctx, false, func(addr string) (*http.Response, error) {
+		req, err = http.NewRequest(
+			http.MethodPost,
+			utils.JoinURL(addr, DeviceDecommissioningOrchestratorUri),
+			bytes.NewReader(DecommissioningReqJson))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create request")
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		return client.Do(req.WithContext(ctx))
+	})
 	if err != nil {
 		return errors.Wrapf(err, "failed to submit decommissioning job")
 	}
@@ -138,23 +143,25 @@ func (co *Client) SubmitProvisionDeviceJob(ctx context.Context, provisionDeviceR
 		return errors.Wrapf(err, "failed to submit provision device job")
 	}
 
-	contentReader := bytes.NewReader(ProvisionDeviceReqJson)
-
-	req, err := http.NewRequest(
-		http.MethodPost,
-		utils.JoinURL(co.conf.OrchestratorAddr, ProvisionDeviceOrchestratorUri),
-		contentReader)
-	if err != nil {
-		return errors.Wrapf(err, "failed to create request")
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
 	// set the device admission request timeout
 	ctx, cancel := context.WithTimeout(ctx, co.conf.Timeout)
 	defer cancel()
 
-	rsp, err := client.Do(req.WithContext(ctx))
+	var req *http.Request
+	// each request starts a workflow, so it must not be resent
+	rsp, err := co.endpoint.Do(ctx, false, func(addr string) (*http.Response, error) {
+		req, err = http.NewRequest(
+			http.MethodPost,
+			utils.JoinURL(addr, ProvisionDeviceOrchestratorUri),
+			bytes.NewReader(ProvisionDeviceReqJson))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create request")
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		return client.Do(req.WithContext(ctx))
+	})
 	if err != nil {
 		return errors.Wrapf(err, "failed to submit provision device job")
 	}
@@ -180,6 +187,7 @@ func NewClient(c Config) *Client {
 	}
 
 	return &Client{
-		conf: c,
+		conf:     c,
+		endpoint: discovery.NewEndpoint(c.OrchestratorAddr),
 	}
 }
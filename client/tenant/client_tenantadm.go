@@ -24,6 +24,7 @@ import (
 	"github.com/mendersoftware/go-lib-micro/rest_utils"
 	"github.com/pkg/errors"
 
+	"github.com/mendersoftware/deviceauth/client/discovery"
 	"github.com/mendersoftware/deviceauth/utils"
 )
 
@@ -48,7 +49,8 @@ func MakeErrTokenVerificationFailed(apiErr error) error {
 
 // ClientConfig conveys client configuration
 type Config struct {
-	// Tenant administrator service address
+	// Tenant administrator service address; use the 'srv+' scheme prefix
+	// for DNS SRV discovery, e.g. srv+http://_tenantadm._tcp.mender.local
 	TenantAdmAddr string
 	// Request timeout
 	Timeout time.Duration
@@ -62,7 +64,8 @@ type ClientRunner interface {
 // Client is an opaque implementation of tenant administrator client. Implements
 // ClientRunner interface
 type Client struct {
-	conf Config
+	conf     Config
+	endpoint *discovery.Endpoint
 }
 
 // VerifyToken will execute a request to tenenatadm's endpoint for token
@@ -74,20 +77,23 @@ func (tc *Client) VerifyToken(ctx context.Context, token string,
 
 	// TODO sanitize token
 
-	url := utils.JoinURL(tc.conf.TenantAdmAddr, TenantVerifyUri)
+	ctx, cancel := context.WithTimeout(ctx, tc.conf.Timeout)
+	defer cancel()
 
-	req, err := http.NewRequest(http.MethodPost, url, nil)
-	if err != nil {
-		return errors.Wrap(err, "failed to create request to tenant administrator")
-	}
+	// verification has no side effects, so it may be retried elsewhere
+	rsp, err := tc.endpoint.Do(ctx, true, func(addr string) (*http.Response, error) {
+		url := utils.JoinURL(addr, TenantVerifyUri)
 
-	// tenant token is passed in Authorization header
-	req.Header.Add("Authorization", "Bearer "+token)
+		req, err := http.NewRequest(http.MethodPost, url, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create request to tenant administrator")
+		}
 
-	ctx, cancel := context.WithTimeout(ctx, tc.conf.Timeout)
-	defer cancel()
+		// tenant token is passed in Authorization header
+		req.Header.Add("Authorization", "Bearer "+token)
 
-	rsp, err := client.Do(req.WithContext(ctx))
+		return client.Do(req.WithContext(ctx))
+	})
 	if err != nil {
 		l.Errorf("tenantadm request failed: %v", err)
 		return errors.Wrap(err, "request to verify token failed")
@@ -119,6 +125,7 @@ func NewClient(c Config) *Client {
 	}
 
 	return &Client{
-		conf: c,
+		conf:     c,
+		endpoint: discovery.NewEndpoint(c.TenantAdmAddr),
 	}
 }
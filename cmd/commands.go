@@ -16,13 +16,23 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/mendersoftware/go-lib-micro/config"
 	"github.com/mendersoftware/go-lib-micro/identity"
 	mstore "github.com/mendersoftware/go-lib-micro/store"
 	"github.com/pkg/errors"
 
+	"github.com/mendersoftware/deviceauth/client/orchestrator"
 	dconfig "github.com/mendersoftware/deviceauth/config"
+	"github.com/mendersoftware/deviceauth/devauth"
+	"github.com/mendersoftware/deviceauth/jwt"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/secrets"
+	"github.com/mendersoftware/deviceauth/store"
 	"github.com/mendersoftware/deviceauth/store/mongo"
 )
 
@@ -51,6 +61,8 @@ func Migrate(c config.Reader, tenant string, listTenantsFlag bool) error {
 		return listTenants(db)
 	}
 
+	db = db.WithRevokedTokenRetention(time.Duration(
+		c.GetInt(dconfig.SettingRevokedTokensRetention)) * time.Second)
 	db = db.WithAutomigrate().(*mongo.DataStoreMongo)
 
 	tenantCtx := identity.WithContext(context.Background(), &identity.Identity{
@@ -193,3 +205,229 @@ func decommissioningCleanupExecute(db *mongo.DataStoreMongo, dbName string) erro
 
 	return nil
 }
+
+func PurgeTokens(tenant string, batchSize int) error {
+	db, err := mongo.NewDataStoreMongo(makeDataStoreConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to db")
+	}
+
+	return purgeTokensWithDataStore(context.Background(), tenant, batchSize, db)
+}
+
+// purgeTokensWithDataStore deletes the expired tokens of the tenant, or of
+// all tenants if not given
+func purgeTokensWithDataStore(ctx context.Context, tenant string, batchSize int, db store.DataStore) error {
+	tenants := []string{tenant}
+	if tenant == "" {
+		ids, err := db.GetTenantIds(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list tenants")
+		}
+		tenants = append(tenants, ids...)
+	}
+
+	now := time.Now().UTC()
+	for _, tenantId := range tenants {
+		tenantCtx := ctx
+		if tenantId != "" {
+			tenantCtx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenantId,
+			})
+		}
+
+		n, err := db.DeleteExpiredTokens(tenantCtx, now, batchSize)
+		if err != nil {
+			return errors.Wrapf(err, "failed to purge expired tokens, tenant: %q", tenantId)
+		}
+		if n > 0 {
+			fmt.Printf("purged %d expired tokens, tenant: %q\n", n, tenantId)
+		}
+	}
+
+	return nil
+}
+
+func PurgeRejectedDevices(tenant string, olderThan time.Duration, dryRun bool) error {
+	db, err := mongo.NewDataStoreMongo(makeDataStoreConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to db")
+	}
+
+	co := orchestrator.NewClient(orchestrator.Config{
+		OrchestratorAddr: config.Config.GetString(dconfig.SettingOrchestratorAddr),
+		Timeout:          time.Duration(30) * time.Second,
+	})
+
+	return purgeRejectedDevicesWithDataStore(context.Background(),
+		tenant, olderThan, dryRun, db, co)
+}
+
+// purgeRejectedDevicesWithDataStore decommissions the rejected devices of
+// the tenant, or of all tenants if not given, which haven't attempted to
+// authenticate for olderThan; with dryRun, they're only counted
+func purgeRejectedDevicesWithDataStore(ctx context.Context, tenant string,
+	olderThan time.Duration, dryRun bool,
+	db store.DataStore, co orchestrator.ClientRunner) error {
+
+	tenants := []string{tenant}
+	if tenant == "" {
+		ids, err := db.GetTenantIds(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list tenants")
+		}
+		tenants = append(tenants, ids...)
+	}
+
+	da := devauth.NewDevAuth(db, co, nil, devauth.Config{})
+	for _, tenantId := range tenants {
+		tenantCtx := ctx
+		if tenantId != "" {
+			tenantCtx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenantId,
+			})
+		}
+
+		n, err := da.PurgeRejectedDevices(tenantCtx, olderThan, dryRun)
+		if err != nil {
+			return errors.Wrapf(err, "failed to purge rejected devices, tenant: %q", tenantId)
+		}
+		if dryRun {
+			fmt.Printf("would purge %d rejected devices, tenant: %q\n", n, tenantId)
+		} else if n > 0 {
+			fmt.Printf("purged %d rejected devices, tenant: %q\n", n, tenantId)
+		}
+	}
+
+	return nil
+}
+
+func ImportDevices(path, format, tenant string) error {
+	db, err := mongo.NewDataStoreMongo(makeDataStoreConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to db")
+	}
+
+	return importDevicesWithDataStore(context.Background(), path, format, tenant, db)
+}
+
+// importDevicesWithDataStore preauthorizes the devices listed in the file,
+// CSV or NDJSON as given, or by the file extension if not
+func importDevicesWithDataStore(ctx context.Context, path, format, tenant string, db store.DataStore) error {
+	if format == "" {
+		format = model.PreAuthImportFormatNDJSON
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = model.PreAuthImportFormatCSV
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open import file")
+	}
+	defer f.Close()
+
+	in, err := model.NewPreAuthImportReader(f, format)
+	if err != nil {
+		return err
+	}
+
+	if tenant != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{
+			Tenant: tenant,
+		})
+	}
+
+	res, err := devauth.NewDevAuth(db, nil, nil, devauth.Config{}).
+		ImportPreauthorizedDevices(ctx, in)
+	if res != nil {
+		for _, e := range res.Errors {
+			fmt.Printf("record %d: %s\n", e.Record, e.Error)
+		}
+		fmt.Printf("preauthorized %d devices, tenant: %q\n", res.Preauthorized, tenant)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to import devices")
+	}
+	if len(res.Errors) > 0 {
+		return errors.Errorf("%d devices not imported", len(res.Errors))
+	}
+
+	return nil
+}
+
+func ServerKeys(addRef, alg, retireKid string) error {
+	db, err := mongo.NewDataStoreMongo(makeDataStoreConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to db")
+	}
+
+	return serverKeysWithDataStore(context.Background(), addRef, alg, retireKid, db)
+}
+
+func serverKeysWithDataStore(ctx context.Context, addRef, alg, retireKid string, db store.DataStore) error {
+	switch {
+	case addRef != "":
+		return addServerKey(ctx, addRef, alg, db)
+	case retireKid != "":
+		err := db.RetireServerKey(ctx, retireKid, time.Now())
+		if err != nil {
+			return errors.Wrap(err, "failed to retire server key")
+		}
+		fmt.Println("retired key:", retireKid)
+		return nil
+	default:
+		return listServerKeys(ctx, db)
+	}
+}
+
+// addServerKey stores a reference to the key, resolved by the service on
+// every load; file paths are stored as file:// references, the file must
+// be available to the service at the same path
+func addServerKey(ctx context.Context, ref, alg string, db store.DataStore) error {
+	resolver := secrets.NewResolver()
+	if !resolver.IsRef(ref) {
+		path, err := filepath.Abs(ref)
+		if err != nil {
+			return errors.Wrap(err, "failed to read server key")
+		}
+		ref = "file://" + path
+	}
+
+	pem, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "failed to read server key")
+	}
+
+	// validates the key, and gets its ID
+	h, err := jwt.NewKeyHandler(alg, pem)
+	if err != nil {
+		return err
+	}
+
+	err = db.AddServerKey(ctx, model.ServerKey{
+		Id:            h.KeyID(),
+		Algorithm:     alg,
+		PrivateKeyRef: ref,
+		CreatedTs:     time.Now(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to add server key")
+	}
+
+	fmt.Println("added key:", h.KeyID())
+	return nil
+}
+
+func listServerKeys(ctx context.Context, db store.DataStore) error {
+	keys, err := db.GetServerKeys(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve server keys")
+	}
+
+	for _, k := range keys {
+		fmt.Println(k.Id, k.Algorithm, k.CreatedTs.Format(time.RFC3339))
+	}
+
+	return nil
+}
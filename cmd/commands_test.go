@@ -1,27 +1,39 @@
 // Copyright 2018 Northern.tech AS
 //
-//    Licensed under the Apache License, Version 2.0 (the "License");
-//    you may not use this file except in compliance with the License.
-//    You may obtain a copy of the License at
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
 //
-//        http://www.apache.org/licenses/LICENSE-2.0
+//	    http://www.apache.org/licenses/LICENSE-2.0
 //
-//    Unless required by applicable law or agreed to in writing, software
-//    distributed under the License is distributed on an "AS IS" BASIS,
-//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-//    See the License for the specific language governing permissions and
-//    limitations under the License.
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
 package cmd
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/mendersoftware/go-lib-micro/identity"
 	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 
+	morchestrator "github.com/mendersoftware/deviceauth/client/orchestrator/mocks"
 	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
 	"github.com/mendersoftware/deviceauth/store/mongo"
 )
 
@@ -96,7 +108,7 @@ func TestMaintenanceWithDataStore(t *testing.T) {
 		},
 		"do nothing with tenant": {
 			decommissioningCleanupFlag: false,
-			tenant: "foo",
+			tenant:                     "foo",
 		},
 		"dry run without data": {
 			decommissioningCleanupFlag: true,
@@ -109,9 +121,9 @@ func TestMaintenanceWithDataStore(t *testing.T) {
 		},
 		"dry run with tenant": {
 			decommissioningCleanupFlag: true,
-			tenant:       "foo",
-			dryRunFlag:   true,
-			withDataSets: true,
+			tenant:                     "foo",
+			dryRunFlag:                 true,
+			withDataSets:               true,
 		},
 		"run without data": {
 			decommissioningCleanupFlag: true,
@@ -122,8 +134,8 @@ func TestMaintenanceWithDataStore(t *testing.T) {
 		},
 		"run with tenant": {
 			decommissioningCleanupFlag: true,
-			tenant:       "foo",
-			withDataSets: true,
+			tenant:                     "foo",
+			withDataSets:               true,
 		},
 	}
 
@@ -162,3 +174,364 @@ func TestMaintenanceWithDataStore(t *testing.T) {
 
 	}
 }
+
+func TestServerKeysWithDataStore(t *testing.T) {
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privKey)
+	assert.NoError(t, err)
+
+	f, err := ioutil.TempFile("", "server-key")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	assert.NoError(t, pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	f.Close()
+
+	testCases := map[string]struct {
+		addPath   string
+		alg       string
+		retireKid string
+
+		setup func(db *mstore.DataStore)
+
+		err string
+	}{
+		"ok, add": {
+			addPath: f.Name(),
+			alg:     "EdDSA",
+			setup: func(db *mstore.DataStore) {
+				db.On("AddServerKey", context.Background(),
+					mock.MatchedBy(func(k model.ServerKey) bool {
+						return k.Id != "" && k.Algorithm == "EdDSA" &&
+							k.PrivateKeyRef == "file://"+f.Name()
+					})).Return(nil)
+			},
+		},
+		"error, add, key mismatch": {
+			addPath: f.Name(),
+			alg:     "RS256",
+			err:     "failed to read rsa private key",
+		},
+		"error, add, no file": {
+			addPath: "/nonexistent",
+			alg:     "EdDSA",
+			err:     "failed to read server key",
+		},
+		"error, add, exists": {
+			addPath: f.Name(),
+			alg:     "EdDSA",
+			setup: func(db *mstore.DataStore) {
+				db.On("AddServerKey", context.Background(),
+					mock.AnythingOfType("model.ServerKey")).
+					Return(store.ErrObjectExists)
+			},
+			err: "failed to add server key: object exists",
+		},
+		"ok, retire": {
+			retireKid: "kid1",
+			setup: func(db *mstore.DataStore) {
+				db.On("RetireServerKey", context.Background(), "kid1",
+					mock.AnythingOfType("time.Time")).Return(nil)
+			},
+		},
+		"error, retire": {
+			retireKid: "kid1",
+			setup: func(db *mstore.DataStore) {
+				db.On("RetireServerKey", context.Background(), "kid1",
+					mock.AnythingOfType("time.Time")).
+					Return(store.ErrServerKeyNotFound)
+			},
+			err: "failed to retire server key: server key not found",
+		},
+		"ok, list": {
+			setup: func(db *mstore.DataStore) {
+				db.On("GetServerKeys", context.Background()).
+					Return([]model.ServerKey{{Id: "kid1", Algorithm: "RS256"}}, nil)
+			},
+		},
+		"error, list": {
+			setup: func(db *mstore.DataStore) {
+				db.On("GetServerKeys", context.Background()).
+					Return(nil, errors.New("db error"))
+			},
+			err: "failed to retrieve server keys: db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			if tc.setup != nil {
+				tc.setup(db)
+			}
+
+			err := serverKeysWithDataStore(context.Background(),
+				tc.addPath, tc.alg, tc.retireKid, db)
+			if tc.err != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPurgeTokensWithDataStore(t *testing.T) {
+	tenantMatcher := func(tenant string) interface{} {
+		return mock.MatchedBy(func(ctx context.Context) bool {
+			ident := identity.FromContext(ctx)
+			if tenant == "" {
+				return ident == nil
+			}
+			return ident != nil && ident.Tenant == tenant
+		})
+	}
+
+	testCases := map[string]struct {
+		tenant string
+
+		setup func(db *mstore.DataStore)
+
+		err string
+	}{
+		"ok, tenant": {
+			tenant: "tenant1",
+			setup: func(db *mstore.DataStore) {
+				db.On("DeleteExpiredTokens", tenantMatcher("tenant1"),
+					mock.AnythingOfType("time.Time"), 100).
+					Return(3, nil)
+			},
+		},
+		"ok, all tenants": {
+			setup: func(db *mstore.DataStore) {
+				db.On("GetTenantIds", context.Background()).
+					Return([]string{"tenant1", "tenant2"}, nil)
+				for _, tenant := range []string{"", "tenant1", "tenant2"} {
+					db.On("DeleteExpiredTokens", tenantMatcher(tenant),
+						mock.AnythingOfType("time.Time"), 100).
+						Return(1, nil)
+				}
+			},
+		},
+		"error, tenants": {
+			setup: func(db *mstore.DataStore) {
+				db.On("GetTenantIds", context.Background()).
+					Return(nil, errors.New("db error"))
+			},
+			err: "failed to list tenants: db error",
+		},
+		"error, purge": {
+			tenant: "tenant1",
+			setup: func(db *mstore.DataStore) {
+				db.On("DeleteExpiredTokens", tenantMatcher("tenant1"),
+					mock.AnythingOfType("time.Time"), 100).
+					Return(0, errors.New("db error"))
+			},
+			err: `failed to purge expired tokens, tenant: "tenant1": db error`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			tc.setup(db)
+
+			err := purgeTokensWithDataStore(context.Background(),
+				tc.tenant, 100, db)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				db.AssertExpectations(t)
+			}
+		})
+	}
+}
+
+func TestPurgeRejectedDevicesWithDataStore(t *testing.T) {
+	tenantMatcher := func(tenant string) interface{} {
+		return mock.MatchedBy(func(ctx context.Context) bool {
+			ident := identity.FromContext(ctx)
+			if tenant == "" {
+				return ident == nil
+			}
+			return ident != nil && ident.Tenant == tenant
+		})
+	}
+
+	testCases := map[string]struct {
+		tenant    string
+		olderThan time.Duration
+		dryRun    bool
+
+		setup func(db *mstore.DataStore)
+
+		err string
+	}{
+		"ok, tenant": {
+			tenant:    "tenant1",
+			olderThan: 24 * time.Hour,
+			setup: func(db *mstore.DataStore) {
+				db.On("GetStaleRejectedDevices", tenantMatcher("tenant1"),
+					mock.AnythingOfType("time.Time"), uint(0), uint(100)).
+					Return([]model.Device{{Id: "dev1"}}, nil)
+				db.On("UpdateDevice", tenantMatcher("tenant1"),
+					model.Device{Id: "dev1"},
+					mock.AnythingOfType("model.DeviceUpdate")).Return(nil)
+				db.On("DeleteAuthSetsForDevice", tenantMatcher("tenant1"), "dev1").
+					Return(nil)
+				db.On("DeleteTokenByDevId", tenantMatcher("tenant1"), "dev1").
+					Return(nil)
+				db.On("DeleteDevice", tenantMatcher("tenant1"), "dev1").
+					Return(nil)
+			},
+		},
+		"ok, all tenants, dry run": {
+			olderThan: 24 * time.Hour,
+			dryRun:    true,
+			setup: func(db *mstore.DataStore) {
+				db.On("GetTenantIds", context.Background()).
+					Return([]string{"tenant1", "tenant2"}, nil)
+				for _, tenant := range []string{"", "tenant1", "tenant2"} {
+					db.On("GetStaleRejectedDevices", tenantMatcher(tenant),
+						mock.AnythingOfType("time.Time"), uint(0), uint(100)).
+						Return([]model.Device{{Id: "dev1"}}, nil)
+				}
+			},
+		},
+		"error, no retention": {
+			tenant: "tenant1",
+			setup:  func(db *mstore.DataStore) {},
+			err: `failed to purge rejected devices, tenant: "tenant1": ` +
+				"no rejected device retention configured, the age is required",
+		},
+		"error, tenants": {
+			olderThan: 24 * time.Hour,
+			setup: func(db *mstore.DataStore) {
+				db.On("GetTenantIds", context.Background()).
+					Return(nil, errors.New("db error"))
+			},
+			err: "failed to list tenants: db error",
+		},
+		"error, purge": {
+			tenant:    "tenant1",
+			olderThan: 24 * time.Hour,
+			setup: func(db *mstore.DataStore) {
+				db.On("GetStaleRejectedDevices", tenantMatcher("tenant1"),
+					mock.AnythingOfType("time.Time"), uint(0), uint(100)).
+					Return(nil, errors.New("db error"))
+			},
+			err: `failed to purge rejected devices, tenant: "tenant1": ` +
+				"failed to list stale rejected devices: db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			tc.setup(db)
+
+			co := &morchestrator.ClientRunner{}
+			co.On("SubmitDeviceDecommisioningJob", mock.Anything,
+				mock.AnythingOfType("orchestrator.DecommissioningReq")).
+				Return(nil)
+
+			err := purgeRejectedDevicesWithDataStore(context.Background(),
+				tc.tenant, tc.olderThan, tc.dryRun, db, co)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				db.AssertExpectations(t)
+			}
+		})
+	}
+}
+
+func TestImportDevicesWithDataStore(t *testing.T) {
+	pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(pubKey)
+	assert.NoError(t, err)
+	pubKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	f, err := ioutil.TempFile("", "devices*.csv")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("identity_data,pubkey\n" +
+		`"{""mac"":""00:01""}","` + string(pubKeyPEM) + "\"\n" +
+		`"{""mac"":""00:02""}","` + string(pubKeyPEM) + "\"\n")
+	assert.NoError(t, err)
+	f.Close()
+
+	testCases := map[string]struct {
+		path   string
+		format string
+		tenant string
+
+		devErrs []error
+		devsErr error
+
+		err string
+	}{
+		"ok, tenant": {
+			path:    f.Name(),
+			tenant:  "tenant1",
+			devErrs: []error{nil, nil},
+		},
+		"ok, some failed": {
+			path:    f.Name(),
+			devErrs: []error{nil, store.ErrObjectExists},
+			err:     "1 devices not imported",
+		},
+		"error, db": {
+			path:    f.Name(),
+			format:  model.PreAuthImportFormatCSV,
+			devsErr: errors.New("db error"),
+			err:     "failed to import devices: failed to add devices: db error",
+		},
+		"error, file": {
+			path: f.Name() + ".missing",
+			err:  "failed to open import file: open " + f.Name() + ".missing: no such file or directory",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			ctxMatcher := mock.MatchedBy(func(ctx context.Context) bool {
+				ident := identity.FromContext(ctx)
+				if tc.tenant == "" {
+					return ident == nil
+				}
+				return ident != nil && ident.Tenant == tc.tenant
+			})
+			if tc.devErrs != nil || tc.devsErr != nil {
+				db.On("AddDevices", ctxMatcher,
+					mock.AnythingOfType("[]model.Device")).
+					Return(tc.devErrs, tc.devsErr)
+			}
+			if tc.devErrs != nil {
+				db.On("AddAuthSets", ctxMatcher,
+					mock.AnythingOfType("[]model.AuthSet")).
+					Return(func(_ context.Context, sets []model.AuthSet) []error {
+						return make([]error, len(sets))
+					}, nil)
+				db.On("AddDeviceStatusChanges", ctxMatcher,
+					mock.AnythingOfType("[]model.DeviceStatusChange")).
+					Return(nil)
+			}
+
+			err := importDevicesWithDataStore(context.Background(),
+				tc.path, tc.format, tc.tenant, db)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				db.AssertExpectations(t)
+			}
+		})
+	}
+}
@@ -21,9 +21,42 @@ const (
 	SettingListen        = "listen"
 	SettingListenDefault = ":8080"
 
+	SettingTLSCertPath        = "tls_cert_path"
+	SettingTLSCertPathDefault = ""
+
+	SettingTLSKeyPath        = "tls_key_path"
+	SettingTLSKeyPathDefault = ""
+
 	SettingMiddleware        = "middleware"
 	SettingMiddlewareDefault = "prod"
 
+	SettingTrustedProxies        = "trusted_proxies"
+	SettingTrustedProxiesDefault = 0
+
+	SettingMaxConnections        = "max_connections"
+	SettingMaxConnectionsDefault = 0 // no limit
+
+	SettingConnectionLimitMode        = "connection_limit_mode"
+	SettingConnectionLimitModeDefault = "queue"
+
+	SettingMaxConcurrentRequests        = "max_concurrent_requests"
+	SettingMaxConcurrentRequestsDefault = 0 // no limit
+
+	SettingPriorityWorkers        = "priority_workers"
+	SettingPriorityWorkersDefault = 0 // disabled
+
+	SettingPriorityVerifyWeight        = "priority_verify_weight"
+	SettingPriorityVerifyWeightDefault = 4
+
+	SettingPriorityEnrollWeight        = "priority_enroll_weight"
+	SettingPriorityEnrollWeightDefault = 1
+
+	SettingPriorityQueueSize        = "priority_queue_size"
+	SettingPriorityQueueSizeDefault = 1000
+
+	SettingPriorityQueueTimeout        = "priority_queue_timeout"
+	SettingPriorityQueueTimeoutDefault = 10
+
 	SettingDb        = "mongo"
 	SettingDbDefault = "mongo-device-auth"
 
@@ -48,35 +81,259 @@ const (
 	SettingTenantAdmAddr        = "tenantadm_addr"
 	SettingTenantAdmAddrDefault = ""
 
+	SettingAuthReqHookAddr        = "auth_req_hook_addr"
+	SettingAuthReqHookAddrDefault = ""
+
+	SettingAuthReqHookSecret = "auth_req_hook_secret"
+
 	SettingServerPrivKeyPath        = "server_priv_key_path"
 	SettingServerPrivKeyPathDefault = "/etc/deviceauth/rsa/private.pem"
 
 	SettingJWTIssuer        = "jwt_issuer"
 	SettingJWTIssuerDefault = "Mender"
 
+	SettingJWTAudience        = "jwt_audience"
+	SettingJWTAudienceDefault = ""
+
+	SettingJWTTenantIssuersPath        = "jwt_tenant_issuers_path"
+	SettingJWTTenantIssuersPathDefault = ""
+
+	SettingJWTScopesPath        = "jwt_scopes_path"
+	SettingJWTScopesPathDefault = ""
+
 	SettingJWTExpirationTimeout        = "jwt_exp_timeout"
 	SettingJWTExpirationTimeoutDefault = "604800" //one week
 
+	SettingJWTRefreshExpirationTimeout        = "jwt_refresh_exp_timeout"
+	SettingJWTRefreshExpirationTimeoutDefault = 0
+
+	SettingJWTMaxLifetime        = "jwt_max_lifetime"
+	SettingJWTMaxLifetimeDefault = 0
+
+	SettingJWTExpiryGrace        = "jwt_expiry_grace"
+	SettingJWTExpiryGraceDefault = 0
+
+	SettingBootstrapTokenExpirationTimeout        = "bootstrap_token_exp_timeout"
+	SettingBootstrapTokenExpirationTimeoutDefault = 86400
+
+	SettingRevokedTokensRetention        = "revoked_tokens_retention"
+	SettingRevokedTokensRetentionDefault = 604800
+
+	SettingJWTAlgorithm        = "jwt_algorithm"
+	SettingJWTAlgorithmDefault = "RS256"
+
+	SettingJWTSigner        = "jwt_signer"
+	SettingJWTSignerDefault = "file"
+
+	SettingJWTVaultTransitMount        = "jwt_vault_transit_mount"
+	SettingJWTVaultTransitMountDefault = "transit"
+
+	SettingJWTVaultTransitKey        = "jwt_vault_transit_key"
+	SettingJWTVaultTransitKeyDefault = "deviceauth"
+
+	SettingServerFallbackPrivKeyPath        = "server_fallback_priv_key_path"
+	SettingServerFallbackPrivKeyPathDefault = ""
+
+	SettingJWTFallbackAlgorithm        = "jwt_fallback_algorithm"
+	SettingJWTFallbackAlgorithmDefault = "RS256"
+
+	SettingJWTEncryption        = "jwt_encryption"
+	SettingJWTEncryptionDefault = false
+
+	SettingJWTEncryptionKeyPath        = "jwt_encryption_key_path"
+	SettingJWTEncryptionKeyPathDefault = ""
+
+	SettingJWTClaimsTemplatePath        = "jwt_claims_template_path"
+	SettingJWTClaimsTemplatePathDefault = ""
+
+	SettingServerKeysRefreshInterval        = "server_keys_refresh_interval"
+	SettingServerKeysRefreshIntervalDefault = 60
+
 	SettingMaxDevicesLimitDefault        = "max_devices_limit_default"
 	SettingMaxDevicesLimitDefaultDefault = "0" // no limit
 
+	SettingSecretsRefreshInterval        = "secrets_refresh_interval"
+	SettingSecretsRefreshIntervalDefault = 300
+
+	SettingDeviceAuthzVerificationUri        = "device_authz_verification_uri"
+	SettingDeviceAuthzVerificationUriDefault = ""
+
+	SettingDeviceAuthzExpirationTimeout        = "device_authz_exp_timeout"
+	SettingDeviceAuthzExpirationTimeoutDefault = 900
+
+	SettingDeviceAuthzInterval        = "device_authz_interval"
+	SettingDeviceAuthzIntervalDefault = 5
+
+	SettingSpiffeTrustDomain        = "spiffe_trust_domain"
+	SettingSpiffeTrustDomainDefault = ""
+
+	SettingNotifyConfigPath        = "notify_config_path"
+	SettingNotifyConfigPathDefault = ""
+
+	SettingRevocationGatewaysPath        = "revocation_gateways_path"
+	SettingRevocationGatewaysPathDefault = ""
+
+	SettingNotifySMTPAddr     = "notify_smtp_addr"
+	SettingNotifySMTPUsername = "notify_smtp_username"
+	SettingNotifySMTPPassword = "notify_smtp_password"
+
+	SettingNotifyEmailFrom        = "notify_email_from"
+	SettingNotifyEmailFromDefault = "mender@localhost"
+
+	SettingNotifyPendingDigestInterval        = "notify_pending_digest_interval"
+	SettingNotifyPendingDigestIntervalDefault = 86400
+
+	SettingErrorTranslationsPath        = "error_translations_path"
+	SettingErrorTranslationsPathDefault = ""
+
+	SettingDecommissionSchedulerInterval        = "decommission_scheduler_interval"
+	SettingDecommissionSchedulerIntervalDefault = 60
+
+	SettingTokenUsageFlushInterval        = "token_usage_flush_interval"
+	SettingTokenUsageFlushIntervalDefault = 60
+
+	SettingDeviceCheckinFlushInterval        = "device_checkin_flush_interval"
+	SettingDeviceCheckinFlushIntervalDefault = 60
+
+	SettingTokenPurgeInterval        = "token_purge_interval"
+	SettingTokenPurgeIntervalDefault = 3600
+
+	SettingTokenPurgeBatchSize        = "token_purge_batch_size"
+	SettingTokenPurgeBatchSizeDefault = 1000
+
+	SettingOffboardingTokenScope = "offboarding_token_scope"
+
+	SettingOffboardingGracePeriod        = "offboarding_grace_period"
+	SettingOffboardingGracePeriodDefault = 0
+
+	SettingDeviceCACertsPath        = "device_ca_certs_path"
+	SettingDeviceCACertsPathDefault = ""
+
+	SettingDevicesMTLS        = "devices_mtls"
+	SettingDevicesMTLSDefault = false
+
+	SettingDevicesMTLSIdentityAttribute        = "devices_mtls_identity_attribute"
+	SettingDevicesMTLSIdentityAttributeDefault = "mac"
+
+	SettingKeyPolicyMinRSABits        = "key_policy_min_rsa_bits"
+	SettingKeyPolicyMinRSABitsDefault = 0
+
+	SettingKeyPolicyAllowedKeyTypes = "key_policy_allowed_key_types"
+
+	SettingAuthChallengeRequired        = "auth_challenge_required"
+	SettingAuthChallengeRequiredDefault = false
+
+	SettingAuthChallengeExpirationTimeout        = "auth_challenge_exp_timeout"
+	SettingAuthChallengeExpirationTimeoutDefault = 60
+
+	SettingAuthReqTimestampRequired        = "auth_request_timestamp_required"
+	SettingAuthReqTimestampRequiredDefault = false
+
+	SettingAuthReqMaxClockSkew        = "auth_request_max_clock_skew"
+	SettingAuthReqMaxClockSkewDefault = 300
+
+	SettingTPMCACertsPath        = "tpm_ca_certs_path"
+	SettingTPMCACertsPathDefault = ""
+
+	SettingMaxDeviceKeys        = "max_device_keys"
+	SettingMaxDeviceKeysDefault = 1
+
+	SettingMaxDeviceTokens        = "max_device_tokens"
+	SettingMaxDeviceTokensDefault = 0
+
+	SettingTokenAudit        = "token_audit"
+	SettingTokenAuditDefault = true
+
+	SettingTokenAuditRetention        = "token_audit_retention"
+	SettingTokenAuditRetentionDefault = 7776000
+
+	SettingIdempotencyKeyRetention        = "idempotency_key_retention"
+	SettingIdempotencyKeyRetentionDefault = 86400
+
+	SettingRejectedDeviceRetention        = "rejected_device_retention"
+	SettingRejectedDeviceRetentionDefault = 0 // rejected devices are kept
+
+	SettingRejectedDevicePurgeInterval        = "rejected_device_purge_interval"
+	SettingRejectedDevicePurgeIntervalDefault = 86400
 )
 
 var (
 	Validators = []config.Validator{}
 	Defaults   = []config.Default{
 		{Key: SettingListen, Value: SettingListenDefault},
+		{Key: SettingTLSCertPath, Value: SettingTLSCertPathDefault},
+		{Key: SettingTLSKeyPath, Value: SettingTLSKeyPathDefault},
 		{Key: SettingMiddleware, Value: SettingMiddlewareDefault},
+		{Key: SettingTrustedProxies, Value: SettingTrustedProxiesDefault},
+		{Key: SettingMaxConnections, Value: SettingMaxConnectionsDefault},
+		{Key: SettingConnectionLimitMode, Value: SettingConnectionLimitModeDefault},
+		{Key: SettingMaxConcurrentRequests, Value: SettingMaxConcurrentRequestsDefault},
+		{Key: SettingPriorityWorkers, Value: SettingPriorityWorkersDefault},
+		{Key: SettingPriorityVerifyWeight, Value: SettingPriorityVerifyWeightDefault},
+		{Key: SettingPriorityEnrollWeight, Value: SettingPriorityEnrollWeightDefault},
+		{Key: SettingPriorityQueueSize, Value: SettingPriorityQueueSizeDefault},
+		{Key: SettingPriorityQueueTimeout, Value: SettingPriorityQueueTimeoutDefault},
 		{Key: SettingDb, Value: SettingDbDefault},
 		{Key: SettingDevAdmAddr, Value: SettingDevAdmAddrDefault},
 		{Key: SettingInventoryAddr, Value: SettingInventoryAddrDefault},
 		{Key: SettingOrchestratorAddr, Value: SettingOrchestratorAddrDefault},
 		{Key: SettingTenantAdmAddr, Value: SettingTenantAdmAddrDefault},
+		{Key: SettingAuthReqHookAddr, Value: SettingAuthReqHookAddrDefault},
 		{Key: SettingServerPrivKeyPath, Value: SettingServerPrivKeyPathDefault},
 		{Key: SettingJWTIssuer, Value: SettingJWTIssuerDefault},
+		{Key: SettingJWTAudience, Value: SettingJWTAudienceDefault},
+		{Key: SettingJWTTenantIssuersPath, Value: SettingJWTTenantIssuersPathDefault},
+		{Key: SettingJWTScopesPath, Value: SettingJWTScopesPathDefault},
 		{Key: SettingJWTExpirationTimeout, Value: SettingJWTExpirationTimeoutDefault},
+		{Key: SettingJWTRefreshExpirationTimeout, Value: SettingJWTRefreshExpirationTimeoutDefault},
+		{Key: SettingJWTMaxLifetime, Value: SettingJWTMaxLifetimeDefault},
+		{Key: SettingJWTExpiryGrace, Value: SettingJWTExpiryGraceDefault},
+		{Key: SettingBootstrapTokenExpirationTimeout, Value: SettingBootstrapTokenExpirationTimeoutDefault},
+		{Key: SettingRevokedTokensRetention, Value: SettingRevokedTokensRetentionDefault},
+		{Key: SettingJWTAlgorithm, Value: SettingJWTAlgorithmDefault},
+		{Key: SettingJWTSigner, Value: SettingJWTSignerDefault},
+		{Key: SettingJWTVaultTransitMount, Value: SettingJWTVaultTransitMountDefault},
+		{Key: SettingJWTVaultTransitKey, Value: SettingJWTVaultTransitKeyDefault},
+		{Key: SettingServerFallbackPrivKeyPath, Value: SettingServerFallbackPrivKeyPathDefault},
+		{Key: SettingJWTFallbackAlgorithm, Value: SettingJWTFallbackAlgorithmDefault},
+		{Key: SettingJWTEncryption, Value: SettingJWTEncryptionDefault},
+		{Key: SettingJWTEncryptionKeyPath, Value: SettingJWTEncryptionKeyPathDefault},
+		{Key: SettingJWTClaimsTemplatePath, Value: SettingJWTClaimsTemplatePathDefault},
+		{Key: SettingServerKeysRefreshInterval, Value: SettingServerKeysRefreshIntervalDefault},
 		{Key: SettingDbSSL, Value: SettingDbSSLDefault},
 		{Key: SettingDbSSLSkipVerify, Value: SettingDbSSLSkipVerifyDefault},
 		{Key: SettingMaxDevicesLimitDefault, Value: SettingMaxDevicesLimitDefaultDefault},
+		{Key: SettingSecretsRefreshInterval, Value: SettingSecretsRefreshIntervalDefault},
+		{Key: SettingDeviceAuthzVerificationUri, Value: SettingDeviceAuthzVerificationUriDefault},
+		{Key: SettingDeviceAuthzExpirationTimeout, Value: SettingDeviceAuthzExpirationTimeoutDefault},
+		{Key: SettingDeviceAuthzInterval, Value: SettingDeviceAuthzIntervalDefault},
+		{Key: SettingSpiffeTrustDomain, Value: SettingSpiffeTrustDomainDefault},
+		{Key: SettingNotifyConfigPath, Value: SettingNotifyConfigPathDefault},
+		{Key: SettingNotifyEmailFrom, Value: SettingNotifyEmailFromDefault},
+		{Key: SettingNotifyPendingDigestInterval, Value: SettingNotifyPendingDigestIntervalDefault},
+		{Key: SettingRevocationGatewaysPath, Value: SettingRevocationGatewaysPathDefault},
+		{Key: SettingErrorTranslationsPath, Value: SettingErrorTranslationsPathDefault},
+		{Key: SettingDecommissionSchedulerInterval, Value: SettingDecommissionSchedulerIntervalDefault},
+		{Key: SettingTokenUsageFlushInterval, Value: SettingTokenUsageFlushIntervalDefault},
+		{Key: SettingDeviceCheckinFlushInterval, Value: SettingDeviceCheckinFlushIntervalDefault},
+		{Key: SettingTokenPurgeInterval, Value: SettingTokenPurgeIntervalDefault},
+		{Key: SettingTokenPurgeBatchSize, Value: SettingTokenPurgeBatchSizeDefault},
+		{Key: SettingOffboardingGracePeriod, Value: SettingOffboardingGracePeriodDefault},
+		{Key: SettingDeviceCACertsPath, Value: SettingDeviceCACertsPathDefault},
+		{Key: SettingDevicesMTLS, Value: SettingDevicesMTLSDefault},
+		{Key: SettingDevicesMTLSIdentityAttribute, Value: SettingDevicesMTLSIdentityAttributeDefault},
+		{Key: SettingKeyPolicyMinRSABits, Value: SettingKeyPolicyMinRSABitsDefault},
+		{Key: SettingAuthChallengeRequired, Value: SettingAuthChallengeRequiredDefault},
+		{Key: SettingAuthChallengeExpirationTimeout, Value: SettingAuthChallengeExpirationTimeoutDefault},
+		{Key: SettingAuthReqTimestampRequired, Value: SettingAuthReqTimestampRequiredDefault},
+		{Key: SettingAuthReqMaxClockSkew, Value: SettingAuthReqMaxClockSkewDefault},
+		{Key: SettingTPMCACertsPath, Value: SettingTPMCACertsPathDefault},
+		{Key: SettingMaxDeviceKeys, Value: SettingMaxDeviceKeysDefault},
+		{Key: SettingMaxDeviceTokens, Value: SettingMaxDeviceTokensDefault},
+		{Key: SettingTokenAudit, Value: SettingTokenAuditDefault},
+		{Key: SettingTokenAuditRetention, Value: SettingTokenAuditRetentionDefault},
+		{Key: SettingIdempotencyKeyRetention, Value: SettingIdempotencyKeyRetentionDefault},
+		{Key: SettingRejectedDeviceRetention, Value: SettingRejectedDeviceRetentionDefault},
+		{Key: SettingRejectedDevicePurgeInterval, Value: SettingRejectedDevicePurgeIntervalDefault},
 	}
 )
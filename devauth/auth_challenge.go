@@ -0,0 +1,140 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+var (
+	ErrAuthNonceRequired     = NewError(ErrKindUnauthorized, catalog.CodeAuthNonceRequired)
+	ErrAuthNonceInvalid      = NewError(ErrKindUnauthorized, catalog.CodeAuthNonceInvalid)
+	ErrAuthTimestampRequired = NewError(ErrKindUnauthorized, catalog.CodeAuthTimestampRequired)
+	ErrAuthTimestampSkew     = NewError(ErrKindUnauthorized, catalog.CodeAuthTimestampSkew)
+)
+
+const (
+	authNonceLength = 32
+
+	defaultAuthChallengeExpirationTime = 60
+	defaultAuthReqMaxClockSkew         = 300
+)
+
+// NewAuthChallenge hands out a nonce for the device to include in its next
+// auth request; the request's signature then covers the nonce, and as each
+// nonce is accepted only once, the request can't be replayed. Devices about
+// to attest their key with a TPM also get a credential for the TPM to
+// activate, proving their AK resident in the TPM.
+func (d *DevAuth) NewAuthChallenge(ctx context.Context, req *model.AuthChallengeReq) (*model.AuthChallenge, error) {
+	expiration := d.config.AuthChallengeExpirationTime
+	if expiration == 0 {
+		expiration = defaultAuthChallengeExpirationTime
+	}
+
+	var cred *model.TPMCredential
+	var activation *model.TPMActivation
+	if req != nil && req.TPM != nil {
+		if d.tpmVerifier == nil {
+			return nil, ErrTPMAttestationDisabled
+		}
+		var err error
+		cred, activation, err = d.tpmVerifier.MakeCredential(req.TPM)
+		if err != nil {
+			return nil, MakeErrDevAuthBadRequest(err)
+		}
+	}
+
+	buf := make([]byte, authNonceLength)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, errors.Wrap(err, "failed to generate auth nonce")
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(buf)
+
+	err := d.db.AddAuthNonce(ctx, model.AuthNonce{
+		Id:            nonce,
+		ExpiresAt:     time.Now().Add(time.Duration(expiration) * time.Second),
+		TPMActivation: activation,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to store auth nonce")
+	}
+
+	return &model.AuthChallenge{
+		Nonce:         nonce,
+		ExpiresIn:     expiration,
+		TPMCredential: cred,
+	}, nil
+}
+
+// verifyAuthNonce uses up the nonce of the auth request, if any, and returns
+// it; requests without a nonce are only accepted if challenges aren't
+// required
+func (d *DevAuth) verifyAuthNonce(ctx context.Context, r *model.AuthReq) (*model.AuthNonce, error) {
+	if r.Nonce == "" {
+		if d.config.AuthChallengeRequired {
+			return nil, ErrAuthNonceRequired
+		}
+		return nil, nil
+	}
+
+	nonce, err := d.db.UseAuthNonce(ctx, r.Nonce, time.Now())
+	switch err {
+	case nil:
+		return nonce, nil
+	case store.ErrAuthNonceNotFound:
+		return nil, ErrAuthNonceInvalid
+	default:
+		return nil, errors.Wrap(err, "failed to verify auth nonce")
+	}
+}
+
+// verifyAuthReqTimestamp checks the signed timestamp of the auth request, if
+// any, against the current time; a lighter replay protection than auth
+// challenges, as sniffed requests can only be replayed within the allowed
+// clock skew
+func (d *DevAuth) verifyAuthReqTimestamp(ctx context.Context, r *model.AuthReq) error {
+	if r.Timestamp == nil {
+		if d.config.AuthReqTimestampRequired {
+			return ErrAuthTimestampRequired
+		}
+		return nil
+	}
+
+	maxSkew := d.config.AuthReqMaxClockSkew
+	if maxSkew == 0 {
+		maxSkew = defaultAuthReqMaxClockSkew
+	}
+
+	skew := time.Since(*r.Timestamp)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > time.Duration(maxSkew)*time.Second {
+		log.FromContext(ctx).Warnf("auth request timestamp %s off by %s",
+			r.Timestamp.UTC().Format(time.RFC3339), skew)
+		return ErrAuthTimestampSkew
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/devauth/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestDevAuthNewAuthChallenge(t *testing.T) {
+	t.Parallel()
+
+	tpmReq := &model.TPMCredentialReq{
+		EKCertificate: "ek",
+		AKPublic:      "ak",
+	}
+	cred := &model.TPMCredential{
+		CredentialBlob:  "blob",
+		EncryptedSecret: "secret",
+	}
+	activation := &model.TPMActivation{
+		EKCertificateDigest: []byte("ek"),
+		AKName:              []byte("ak"),
+		SecretDigest:        []byte("secret"),
+	}
+
+	testCases := map[string]struct {
+		expiration  int64
+		req         *model.AuthChallengeReq
+		tpmDisabled bool
+		credErr     error
+		dbErr       error
+
+		expiresIn int64
+		err       string
+	}{
+		"ok": {
+			expiration: 30,
+			expiresIn:  30,
+		},
+		"ok, default expiration": {
+			req:       &model.AuthChallengeReq{},
+			expiresIn: defaultAuthChallengeExpirationTime,
+		},
+		"ok, TPM credential": {
+			req:       &model.AuthChallengeReq{TPM: tpmReq},
+			expiresIn: defaultAuthChallengeExpirationTime,
+		},
+		"error, TPM attestation disabled": {
+			req:         &model.AuthChallengeReq{TPM: tpmReq},
+			tpmDisabled: true,
+			err:         ErrTPMAttestationDisabled.Error(),
+		},
+		"error, TPM credential": {
+			req:     &model.AuthChallengeReq{TPM: tpmReq},
+			credErr: errors.New("EK certificate verification failed"),
+			err: "dev auth: bad request: " +
+				"EK certificate verification failed",
+		},
+		"error, db": {
+			dbErr: errors.New("db failed"),
+			err:   "failed to store auth nonce: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			verifier := &mocks.TPMVerifier{}
+			if tc.credErr != nil {
+				verifier.On("MakeCredential", tpmReq).
+					Return(nil, nil, tc.credErr)
+			} else {
+				verifier.On("MakeCredential", tpmReq).
+					Return(cred, activation, nil)
+			}
+
+			var stored model.AuthNonce
+			db := &mstore.DataStore{}
+			db.On("AddAuthNonce", ctx,
+				mock.AnythingOfType("model.AuthNonce")).
+				Run(func(args mock.Arguments) {
+					stored = args.Get(1).(model.AuthNonce)
+				}).
+				Return(tc.dbErr)
+
+			d := NewDevAuth(db, nil, nil, Config{
+				AuthChallengeExpirationTime: tc.expiration,
+			})
+			if !tc.tpmDisabled {
+				d = d.WithTPMAttestation(verifier)
+			}
+
+			res, err := d.NewAuthChallenge(ctx, tc.req)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				if tc.dbErr == nil {
+					db.AssertNotCalled(t, "AddAuthNonce",
+						mock.Anything, mock.Anything)
+				}
+				return
+			}
+
+			if tc.req != nil && tc.req.TPM != nil {
+				assert.Equal(t, cred, res.TPMCredential)
+				assert.Equal(t, activation, stored.TPMActivation)
+			} else {
+				assert.Nil(t, res.TPMCredential)
+				assert.Nil(t, stored.TPMActivation)
+				verifier.AssertNotCalled(t, "MakeCredential", mock.Anything)
+			}
+
+			assert.NoError(t, err)
+			assert.Len(t, res.Nonce, 43)
+			assert.Equal(t, res.Nonce, stored.Id)
+			assert.Equal(t, tc.expiresIn, res.ExpiresIn)
+			assert.WithinDuration(t,
+				time.Now().Add(time.Duration(tc.expiresIn)*time.Second),
+				stored.ExpiresAt, time.Second)
+		})
+	}
+}
+
+func TestDevAuthVerifyAuthNonce(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		required bool
+		nonce    string
+		dbErr    error
+
+		err error
+	}{
+		"ok": {
+			required: true,
+			nonce:    "nonce1",
+		},
+		"ok, no nonce": {},
+		"ok, not required": {
+			nonce: "nonce1",
+		},
+		"error, no nonce": {
+			required: true,
+			err:      ErrAuthNonceRequired,
+		},
+		"error, unknown nonce": {
+			nonce: "nonce1",
+			dbErr: store.ErrAuthNonceNotFound,
+			err:   ErrAuthNonceInvalid,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			var dbNonce *model.AuthNonce
+			if tc.dbErr == nil {
+				dbNonce = &model.AuthNonce{Id: tc.nonce}
+			}
+			db.On("UseAuthNonce", ctx, tc.nonce,
+				mock.AnythingOfType("time.Time")).
+				Return(dbNonce, tc.dbErr)
+
+			d := NewDevAuth(db, nil, nil, Config{
+				AuthChallengeRequired: tc.required,
+			})
+
+			nonce, err := d.verifyAuthNonce(ctx, &model.AuthReq{
+				Nonce: tc.nonce,
+			})
+			assert.Equal(t, tc.err, err)
+			if tc.err == nil && tc.nonce != "" {
+				assert.Equal(t, dbNonce, nonce)
+			} else {
+				assert.Nil(t, nonce)
+			}
+			if tc.nonce == "" {
+				db.AssertNotCalled(t, "UseAuthNonce",
+					mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestDevAuthVerifyAuthReqTimestamp(t *testing.T) {
+	t.Parallel()
+
+	at := func(d time.Duration) *time.Time {
+		ts := time.Now().Add(d)
+		return &ts
+	}
+
+	testCases := map[string]struct {
+		required  bool
+		maxSkew   int64
+		timestamp *time.Time
+
+		err error
+	}{
+		"ok": {
+			required:  true,
+			timestamp: at(-time.Minute),
+		},
+		"ok, ahead": {
+			timestamp: at(4 * time.Minute),
+		},
+		"ok, no timestamp": {},
+		"ok, custom skew": {
+			maxSkew:   3600,
+			timestamp: at(-30 * time.Minute),
+		},
+		"error, no timestamp": {
+			required: true,
+			err:      ErrAuthTimestampRequired,
+		},
+		"error, too old": {
+			timestamp: at(-10 * time.Minute),
+			err:       ErrAuthTimestampSkew,
+		},
+		"error, too far ahead": {
+			maxSkew:   10,
+			timestamp: at(time.Minute),
+			err:       ErrAuthTimestampSkew,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			d := NewDevAuth(nil, nil, nil, Config{
+				AuthReqTimestampRequired: tc.required,
+				AuthReqMaxClockSkew:      tc.maxSkew,
+			})
+
+			err := d.verifyAuthReqTimestamp(context.Background(), &model.AuthReq{
+				Timestamp: tc.timestamp,
+			})
+			assert.Equal(t, tc.err, err)
+		})
+	}
+}
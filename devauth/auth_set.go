@@ -0,0 +1,96 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	ctxhttpheader "github.com/mendersoftware/go-lib-micro/context/httpheader"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+var (
+	ErrAuthSetNotFound   = NewError(ErrKindNotFound, catalog.CodeAuthSetNotFound)
+	ErrAuthSetNotPending = NewError(ErrKindConflict, catalog.CodeAuthSetNotPending)
+)
+
+// GetDeviceAuthSet returns an auth set of the device
+func (d *DevAuth) GetDeviceAuthSet(ctx context.Context, devId, authId string) (*model.AuthSet, error) {
+	aset, err := d.db.GetAuthSetById(ctx, authId)
+	switch err {
+	case nil:
+		break
+	case store.ErrDevNotFound:
+		return nil, ErrAuthSetNotFound
+	default:
+		return nil, errors.Wrap(err, "db get auth set error")
+	}
+
+	if aset.DeviceId != devId {
+		return nil, ErrAuthSetNotFound
+	}
+
+	return aset, nil
+}
+
+// DismissDeviceAuth drops a pending auth set of the device; unlike
+// rejecting it, this doesn't block the device, which may retry later.
+// A device left without auth sets is removed, to show up as a new one
+// when it retries.
+func (d *DevAuth) DismissDeviceAuth(ctx context.Context, devId, authId string) error {
+	aset, err := d.GetDeviceAuthSet(ctx, devId, authId)
+	if err != nil {
+		return err
+	}
+	if aset.Status != model.DevStatusPending {
+		return ErrAuthSetNotPending
+	}
+
+	if err := d.db.DeleteAuthSetForDevice(ctx, devId, authId); err != nil {
+		return errors.Wrap(err, "db delete auth set error")
+	}
+
+	status, err := d.db.GetDeviceStatus(ctx, devId)
+	switch err {
+	case nil:
+		return d.updateDeviceStatus(ctx, devId, status)
+	case store.ErrAuthSetNotFound:
+		if err := d.db.DeleteDevice(ctx, devId); err != nil &&
+			err != store.ErrDevNotFound {
+			return errors.Wrap(err, "db delete device error")
+		}
+		return nil
+	default:
+		return errors.Wrap(err, "Cannot determine device status")
+	}
+}
+
+// authSetRequest describes the auth request being handled, as recorded
+// with the auth sets it adds; nil if nothing is known of it
+func authSetRequest(ctx context.Context) *model.AuthSetRequest {
+	r := model.AuthSetRequest{
+		SourceIP:  sourceIPFromContext(ctx),
+		UserAgent: ctxhttpheader.FromContext(ctx, "User-Agent"),
+		RequestId: requestid.FromContext(ctx),
+	}
+	if r == (model.AuthSetRequest{}) {
+		return nil
+	}
+	return &r
+}
@@ -0,0 +1,182 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+var (
+	ErrAuthSetNoConflict = NewError(ErrKindConflict, catalog.CodeAuthSetNoConflict)
+)
+
+// detectAuthSetConflicts flags the new auth set, and the devices involved,
+// if its key is used by other devices too, or if its device already has
+// an admitted auth set with a different key. Failures are only logged,
+// the auth set is recorded already.
+func (d *DevAuth) detectAuthSetConflicts(ctx context.Context, aset *model.AuthSet) {
+	l := log.FromContext(ctx)
+
+	sets, err := d.db.GetAuthSetsByPubKey(ctx, aset.PubKey)
+	if err != nil {
+		l.Errorf("failed to check auth set %s for conflicts: %v", aset.Id, err)
+		return
+	}
+
+	devIds := []string{aset.DeviceId}
+	seen := map[string]bool{aset.DeviceId: true}
+	for _, s := range sets {
+		if !seen[s.DeviceId] {
+			seen[s.DeviceId] = true
+			devIds = append(devIds, s.DeviceId)
+		}
+	}
+	if len(devIds) > 1 {
+		l.Warnf("auth set %s: key used by devices %v", aset.Id, devIds)
+		// the sets of the other devices are in conflict too
+		d.flagAuthSetConflict(ctx, model.AuthSet{PubKey: aset.PubKey},
+			model.AuthSetConflictPubKey, devIds)
+		aset.Conflict = model.AuthSetConflictPubKey
+		return
+	}
+
+	sets, err = d.db.GetAuthSetsForDevice(ctx, aset.DeviceId)
+	if err != nil {
+		l.Errorf("failed to check auth set %s for conflicts: %v", aset.Id, err)
+		return
+	}
+
+	for _, s := range sets {
+		if s.PubKey == aset.PubKey {
+			continue
+		}
+		if s.Status == model.DevStatusAccepted || s.Status == model.DevStatusPreauth {
+			l.Warnf("auth set %s: device %s already has %s auth set %s",
+				aset.Id, aset.DeviceId, s.Status, s.Id)
+			d.flagAuthSetConflict(ctx, model.AuthSet{Id: aset.Id},
+				model.AuthSetConflictIdData, devIds)
+			aset.Conflict = model.AuthSetConflictIdData
+			return
+		}
+	}
+}
+
+// flagAuthSetConflict marks the auth sets matching the filter, and the
+// devices, as in conflict
+func (d *DevAuth) flagAuthSetConflict(ctx context.Context, filter model.AuthSet, conflict string, devIds []string) {
+	l := log.FromContext(ctx)
+
+	err := d.db.UpdateAuthSet(ctx, filter, model.AuthSetUpdate{
+		Conflict: conflict,
+	})
+	if err != nil {
+		l.Errorf("failed to flag auth set conflict: %v", err)
+	}
+
+	for _, id := range devIds {
+		err := d.db.UpdateDevice(ctx, model.Device{Id: id}, model.DeviceUpdate{
+			Conflict: to.BoolPtr(true),
+		})
+		if err != nil {
+			l.Errorf("failed to flag conflict of device %s: %v", id, err)
+		}
+	}
+}
+
+// ResolveAuthSetConflict makes the auth set, which has to be in conflict,
+// the authoritative one: it's accepted and the auth sets it conflicts with
+// are rejected. With a key conflict, the other devices using the key may
+// be decommissioned instead, e.g. if they're clones; the device's own
+// other keys are always rejected. The conflict markers of the devices
+// involved are cleared.
+func (d *DevAuth) ResolveAuthSetConflict(ctx context.Context, devId, authId, others string) error {
+	l := log.FromContext(ctx)
+
+	aset, err := d.GetDeviceAuthSet(ctx, devId, authId)
+	if err != nil {
+		return err
+	}
+	if aset.Conflict == "" {
+		return ErrAuthSetNoConflict
+	}
+
+	// the authoritative auth set first, not to change anything else if it
+	// can't be accepted, e.g. for the device limit
+	if err := d.AcceptDeviceAuth(ctx, devId, authId); err != nil {
+		return err
+	}
+
+	devIds := []string{devId}
+
+	switch aset.Conflict {
+	case model.AuthSetConflictPubKey:
+		sets, err := d.db.GetAuthSetsByPubKey(ctx, aset.PubKey)
+		if err != nil {
+			return errors.Wrap(err, "db get auth sets error")
+		}
+
+		seen := map[string]bool{devId: true}
+		for _, s := range sets {
+			if s.DeviceId == devId {
+				continue
+			}
+			if !seen[s.DeviceId] {
+				seen[s.DeviceId] = true
+				devIds = append(devIds, s.DeviceId)
+
+				if others == model.ConflictOthersDecommission {
+					l.Infof("decommissioning device %s in conflict with auth set %s",
+						s.DeviceId, authId)
+					if err := d.DecommissionDevice(ctx, s.DeviceId); err != nil {
+						return err
+					}
+				}
+			}
+			if others != model.ConflictOthersDecommission &&
+				s.Status != model.DevStatusRejected {
+				if err := d.RejectDeviceAuth(ctx, s.DeviceId, s.Id); err != nil {
+					return err
+				}
+			}
+		}
+
+	case model.AuthSetConflictIdData:
+		sets, err := d.db.GetAuthSetsForDevice(ctx, devId)
+		if err != nil {
+			return errors.Wrap(err, "db get auth sets error")
+		}
+
+		for _, s := range sets {
+			if s.Id == authId || s.Status == model.DevStatusRejected {
+				continue
+			}
+			if err := d.RejectDeviceAuth(ctx, devId, s.Id); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := d.db.ClearConflicts(ctx, devIds); err != nil {
+		return errors.Wrap(err, "db clear conflicts error")
+	}
+
+	return nil
+}
@@ -0,0 +1,293 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/client/orchestrator"
+	morchestrator "github.com/mendersoftware/deviceauth/client/orchestrator/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestDevAuthDetectAuthSetConflicts(t *testing.T) {
+	t.Parallel()
+
+	aset := model.AuthSet{
+		Id:       "aid1",
+		DeviceId: "dev1",
+		PubKey:   "key1",
+		Status:   model.DevStatusPending,
+	}
+
+	testCases := map[string]struct {
+		keySets    []model.AuthSet
+		keySetsErr error
+		devSets    []model.AuthSet
+
+		conflict       string
+		conflictFilter model.AuthSet
+		conflictDevs   []string
+	}{
+		"no conflict": {
+			keySets: []model.AuthSet{aset},
+			devSets: []model.AuthSet{
+				aset,
+				{
+					Id:       "aid0",
+					DeviceId: "dev1",
+					PubKey:   "key0",
+					Status:   model.DevStatusRejected,
+				},
+			},
+		},
+		"key used by other devices": {
+			keySets: []model.AuthSet{
+				aset,
+				{Id: "aid2", DeviceId: "dev2", PubKey: "key1"},
+				{Id: "aid3", DeviceId: "dev3", PubKey: "key1"},
+				{Id: "aid4", DeviceId: "dev2", PubKey: "key1"},
+			},
+
+			conflict:       model.AuthSetConflictPubKey,
+			conflictFilter: model.AuthSet{PubKey: "key1"},
+			conflictDevs:   []string{"dev1", "dev2", "dev3"},
+		},
+		"device has another admitted key": {
+			keySets: []model.AuthSet{aset},
+			devSets: []model.AuthSet{
+				aset,
+				{
+					Id:       "aid0",
+					DeviceId: "dev1",
+					PubKey:   "key0",
+					Status:   model.DevStatusAccepted,
+				},
+			},
+
+			conflict:       model.AuthSetConflictIdData,
+			conflictFilter: model.AuthSet{Id: "aid1"},
+			conflictDevs:   []string{"dev1"},
+		},
+		"error": {
+			keySetsErr: errors.New("db failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetAuthSetsByPubKey", ctx, "key1").
+				Return(tc.keySets, tc.keySetsErr)
+			if tc.devSets != nil {
+				db.On("GetAuthSetsForDevice", ctx, "dev1").
+					Return(tc.devSets, nil)
+			}
+			if tc.conflict != "" {
+				db.On("UpdateAuthSet", ctx, tc.conflictFilter,
+					model.AuthSetUpdate{Conflict: tc.conflict}).
+					Return(nil)
+				for _, id := range tc.conflictDevs {
+					db.On("UpdateDevice", ctx, model.Device{Id: id},
+						model.DeviceUpdate{Conflict: to.BoolPtr(true)}).
+						Return(nil)
+				}
+			}
+
+			a := aset
+			d := NewDevAuth(db, nil, nil, Config{})
+			d.detectAuthSetConflicts(ctx, &a)
+
+			assert.Equal(t, tc.conflict, a.Conflict)
+			db.AssertExpectations(t)
+			if tc.conflict == "" {
+				db.AssertNotCalled(t, "UpdateAuthSet")
+				db.AssertNotCalled(t, "UpdateDevice")
+			}
+		})
+	}
+}
+
+func TestDevAuthResolveAuthSetConflict(t *testing.T) {
+	t.Parallel()
+
+	// accepted already, to keep the accept path short
+	aset := model.AuthSet{
+		Id:       "aid1",
+		DeviceId: "dev1",
+		PubKey:   "key1",
+		Status:   model.DevStatusAccepted,
+		Conflict: model.AuthSetConflictPubKey,
+	}
+	idDataSet := aset
+	idDataSet.Conflict = model.AuthSetConflictIdData
+
+	devStatus := map[string]string{
+		"dev1": model.DevStatusAccepted,
+		"dev2": model.DevStatusRejected,
+	}
+
+	testCases := map[string]struct {
+		aset    *model.AuthSet
+		asetErr error
+		others  string
+
+		keySets []model.AuthSet
+		devSets []model.AuthSet
+
+		rejects       []model.AuthSet
+		decommissions []string
+		cleared       []string
+
+		err error
+	}{
+		"key conflict, reject others": {
+			aset:   &aset,
+			others: model.ConflictOthersReject,
+			keySets: []model.AuthSet{
+				aset,
+				{Id: "aid2", DeviceId: "dev2", PubKey: "key1", Status: model.DevStatusPending},
+				{Id: "aid3", DeviceId: "dev3", PubKey: "key1", Status: model.DevStatusRejected},
+			},
+
+			rejects: []model.AuthSet{
+				{Id: "aid2", DeviceId: "dev2", PubKey: "key1", Status: model.DevStatusPending},
+			},
+			cleared: []string{"dev1", "dev2", "dev3"},
+		},
+		"key conflict, decommission others": {
+			aset:   &aset,
+			others: model.ConflictOthersDecommission,
+			keySets: []model.AuthSet{
+				aset,
+				{Id: "aid2", DeviceId: "dev2", PubKey: "key1", Status: model.DevStatusPending},
+				{Id: "aid3", DeviceId: "dev3", PubKey: "key1", Status: model.DevStatusRejected},
+				{Id: "aid4", DeviceId: "dev2", PubKey: "key1", Status: model.DevStatusRejected},
+			},
+
+			decommissions: []string{"dev2", "dev3"},
+			cleared:       []string{"dev1", "dev2", "dev3"},
+		},
+		"id data conflict": {
+			aset:   &idDataSet,
+			others: model.ConflictOthersReject,
+			devSets: []model.AuthSet{
+				idDataSet,
+				{Id: "aid0", DeviceId: "dev1", PubKey: "key0", Status: model.DevStatusPending},
+				{Id: "aid5", DeviceId: "dev1", PubKey: "key5", Status: model.DevStatusRejected},
+			},
+
+			rejects: []model.AuthSet{
+				{Id: "aid0", DeviceId: "dev1", PubKey: "key0", Status: model.DevStatusPending},
+			},
+			cleared: []string{"dev1"},
+		},
+		"error, no conflict": {
+			aset: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusPending,
+			},
+			others: model.ConflictOthersReject,
+
+			err: ErrAuthSetNoConflict,
+		},
+		"error, auth set not found": {
+			asetErr: store.ErrDevNotFound,
+			others:  model.ConflictOthersReject,
+
+			err: ErrAuthSetNotFound,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			co := &morchestrator.ClientRunner{}
+
+			db.On("GetAuthSetById", ctx, "aid1").
+				Return(tc.aset, tc.asetErr)
+			if tc.err == nil {
+				db.On("GetDeviceById", ctx, "dev1").
+					Return(&model.Device{
+						Id:     "dev1",
+						Status: model.DevStatusAccepted,
+					}, nil)
+			}
+			if tc.keySets != nil {
+				db.On("GetAuthSetsByPubKey", ctx, "key1").
+					Return(tc.keySets, nil)
+			}
+			if tc.devSets != nil {
+				db.On("GetAuthSetsForDevice", ctx, "dev1").
+					Return(tc.devSets, nil)
+			}
+			for i := range tc.rejects {
+				s := tc.rejects[i]
+				db.On("GetAuthSetById", ctx, s.Id).
+					Return(&s, nil)
+				db.On("UpdateAuthSet", ctx, s,
+					model.AuthSetUpdate{Status: model.DevStatusRejected}).
+					Return(nil)
+				db.On("GetDeviceStatus", ctx, s.DeviceId).
+					Return(devStatus[s.DeviceId], nil)
+				db.On("SetDeviceStatus", ctx, s.DeviceId, devStatus[s.DeviceId]).
+					Return(devStatus[s.DeviceId], nil)
+			}
+			for _, id := range tc.decommissions {
+				db.On("UpdateDevice", ctx, model.Device{Id: id},
+					model.DeviceUpdate{Decommissioning: to.BoolPtr(true)}).
+					Return(nil)
+				co.On("SubmitDeviceDecommisioningJob", ctx,
+					orchestrator.DecommissioningReq{DeviceId: id}).
+					Return(nil)
+				db.On("DeleteAuthSetsForDevice", ctx, id).Return(nil)
+				db.On("DeleteTokenByDevId", ctx, id).Return(nil)
+				db.On("DeleteDevice", ctx, id).Return(nil)
+			}
+			if tc.cleared != nil {
+				db.On("ClearConflicts", ctx, tc.cleared).Return(nil)
+			}
+
+			d := NewDevAuth(db, co, nil, Config{})
+			err := d.ResolveAuthSetConflict(ctx, "dev1", "aid1", tc.others)
+
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+				db.AssertNotCalled(t, "ClearConflicts")
+			} else {
+				assert.NoError(t, err)
+			}
+			db.AssertExpectations(t)
+			co.AssertExpectations(t)
+		})
+	}
+}
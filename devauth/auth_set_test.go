@@ -0,0 +1,205 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	ctxhttpheader "github.com/mendersoftware/go-lib-micro/context/httpheader"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthGetDeviceAuthSet(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		aset    *model.AuthSet
+		asetErr error
+
+		err string
+	}{
+		"ok": {
+			aset: &model.AuthSet{Id: "aid1", DeviceId: "dev1"},
+		},
+		"error, not found": {
+			asetErr: store.ErrDevNotFound,
+			err:     ErrAuthSetNotFound.Error(),
+		},
+		"error, auth set of another device": {
+			aset: &model.AuthSet{Id: "aid1", DeviceId: "dev2"},
+			err:  ErrAuthSetNotFound.Error(),
+		},
+		"error, db": {
+			asetErr: errors.New("db connection failed"),
+			err:     "db get auth set error: db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := mstore.DataStore{}
+			db.On("GetAuthSetById", mtesting.ContextMatcher(), "aid1").
+				Return(tc.aset, tc.asetErr)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			aset, err := devauth.GetDeviceAuthSet(ctx, "dev1", "aid1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Nil(t, aset)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.aset, aset)
+			}
+		})
+	}
+}
+
+func TestDevAuthDismissDeviceAuth(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		aset *model.AuthSet
+
+		status    string
+		statusErr error
+
+		deleted bool
+		err     string
+	}{
+		"ok": {
+			aset: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusPending,
+			},
+			status: model.DevStatusAccepted,
+		},
+		"ok, last auth set": {
+			aset: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusPending,
+			},
+			statusErr: store.ErrAuthSetNotFound,
+			deleted:   true,
+		},
+		"error, not found": {
+			err: ErrAuthSetNotFound.Error(),
+		},
+		"error, not pending": {
+			aset: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusRejected,
+			},
+			err: ErrAuthSetNotPending.Error(),
+		},
+		"error, db": {
+			aset: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusPending,
+			},
+			statusErr: errors.New("db connection failed"),
+			err:       "Cannot determine device status: db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := mstore.DataStore{}
+			if tc.aset != nil {
+				db.On("GetAuthSetById", mtesting.ContextMatcher(), "aid1").
+					Return(tc.aset, nil)
+			} else {
+				db.On("GetAuthSetById", mtesting.ContextMatcher(), "aid1").
+					Return(nil, store.ErrDevNotFound)
+			}
+			db.On("DeleteAuthSetForDevice", mtesting.ContextMatcher(),
+				"dev1", "aid1").
+				Return(nil)
+			db.On("GetDeviceStatus", mtesting.ContextMatcher(), "dev1").
+				Return(tc.status, tc.statusErr)
+			db.On("SetDeviceStatus", mtesting.ContextMatcher(),
+				"dev1", tc.status).
+				Return(tc.status, nil)
+			db.On("DeleteDevice", mtesting.ContextMatcher(), "dev1").
+				Return(nil)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.DismissDeviceAuth(ctx, "dev1", "aid1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				db.AssertNotCalled(t, "SetDeviceStatus",
+					mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tc.aset == nil || tc.aset.Status != model.DevStatusPending {
+				db.AssertNotCalled(t, "DeleteAuthSetForDevice",
+					mock.Anything, mock.Anything, mock.Anything)
+			}
+			if tc.deleted {
+				db.AssertNotCalled(t, "SetDeviceStatus",
+					mock.Anything, mock.Anything, mock.Anything)
+				db.AssertCalled(t, "DeleteDevice",
+					mtesting.ContextMatcher(), "dev1")
+			} else {
+				db.AssertNotCalled(t, "DeleteDevice",
+					mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestAuthSetRequest(t *testing.T) {
+	t.Parallel()
+
+	ctx := WithSourceIP(context.Background(), "192.168.1.2")
+	ctx = requestid.WithContext(ctx, "req1")
+	ctx = ctxhttpheader.WithContext(ctx,
+		http.Header{"User-Agent": []string{"mender/1.7.0"}},
+		"User-Agent")
+
+	assert.Equal(t, &model.AuthSetRequest{
+		SourceIP:  "192.168.1.2",
+		UserAgent: "mender/1.7.0",
+		RequestId: "req1",
+	}, authSetRequest(ctx))
+
+	assert.Nil(t, authSetRequest(context.Background()))
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+var (
+	ErrInvalidBootstrapToken = NewError(ErrKindUnauthorized, catalog.CodeInvalidBootstrapToken)
+)
+
+// CreateBootstrapToken issues a single use token getting the first auth
+// request of a device with the given identity data accepted
+func (d *DevAuth) CreateBootstrapToken(ctx context.Context, req *model.BootstrapTokenReq) (*model.NewBootstrapToken, error) {
+	idDataHash, err := idDataHash(req.IdData)
+	if err != nil {
+		return nil, MakeErrDevAuthBadRequest(err)
+	}
+
+	expiresIn := d.config.BootstrapTokenExpirationTime
+	if req.ExpiresIn > 0 && req.ExpiresIn < expiresIn {
+		expiresIn = req.ExpiresIn
+	}
+
+	token, err := randomDeviceCode()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate bootstrap token")
+	}
+
+	now := time.Now().UTC()
+	bt := model.BootstrapToken{
+		Id:           hashCode(token),
+		IdDataSha256: idDataHash,
+		CreatedTs:    now,
+		ExpiresAt:    now.Add(time.Duration(expiresIn) * time.Second),
+	}
+	if err := d.db.AddBootstrapToken(ctx, bt); err != nil {
+		return nil, errors.Wrap(err, "failed to store bootstrap token")
+	}
+
+	return &model.NewBootstrapToken{
+		Token:     token,
+		ExpiresAt: bt.ExpiresAt,
+	}, nil
+}
+
+// useBootstrapToken accepts the pending auth set of an auth request carrying
+// a bootstrap token for its identity data; the token is used up only if the
+// auth set is accepted. Auth sets rejected by operators stay rejected.
+func (d *DevAuth) useBootstrapToken(ctx context.Context, r *model.AuthReq, authSet *model.AuthSet) error {
+	l := log.FromContext(ctx)
+
+	if authSet.Status != model.DevStatusPending {
+		l.Warnf("bootstrap token not used, device %s auth set %s is %s",
+			authSet.DeviceId, authSet.Id, authSet.Status)
+		return nil
+	}
+
+	idData, _, err := parseIdData(r.IdData)
+	if err != nil {
+		return MakeErrDevAuthBadRequest(err)
+	}
+	idDataHash, err := idDataHash(idData)
+	if err != nil {
+		return MakeErrDevAuthBadRequest(err)
+	}
+
+	// claimed first, so that the token is used once; mongo keeps the
+	// claim time in milliseconds
+	id := hashCode(r.BootstrapToken)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	bt, err := d.db.UseBootstrapToken(ctx, id, idDataHash, now)
+	switch err {
+	case nil:
+		break
+	case store.ErrBootstrapTokenNotFound:
+		l.Warnf("invalid bootstrap token for device %s", authSet.DeviceId)
+		return ErrInvalidBootstrapToken
+	default:
+		return err
+	}
+
+	if err := d.AcceptDeviceAuth(ctx, authSet.DeviceId, authSet.Id); err != nil {
+		if rerr := d.db.ReleaseBootstrapToken(ctx, id, now); rerr != nil {
+			l.Errorf("failed to release bootstrap token for device %s: %v",
+				authSet.DeviceId, rerr)
+		}
+		return err
+	}
+	authSet.Status = model.DevStatusAccepted
+
+	l.Infof("bootstrap token created at %s used, device %s auth set %s accepted",
+		bt.CreatedTs.Format(time.RFC3339), authSet.DeviceId, authSet.Id)
+	return nil
+}
+
+// idDataHash hashes the identity data independent of its formatting and
+// attribute order, unlike the auth set's id data hash
+func idDataHash(idData map[string]interface{}) ([]byte, error) {
+	// map keys are marshaled sorted
+	data, err := json.Marshal(idData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode identity data")
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
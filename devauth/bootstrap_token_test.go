@@ -0,0 +1,220 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestIdDataHash(t *testing.T) {
+	t.Parallel()
+
+	idData, _, err := parseIdData(`{"sn": "0001", "mac": "00:11:22:33:44:55"}`)
+	assert.NoError(t, err)
+
+	h1, err := idDataHash(idData)
+	assert.NoError(t, err)
+	h2, err := idDataHash(map[string]interface{}{
+		"mac": "00:11:22:33:44:55",
+		"sn":  "0001",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, h1, h2)
+
+	h3, err := idDataHash(map[string]interface{}{"sn": "0002"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, h1, h3)
+}
+
+func TestDevAuthCreateBootstrapToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		expiresIn int64
+		dbErr     error
+
+		outExpiresIn time.Duration
+		err          string
+	}{
+		"ok": {
+			outExpiresIn: time.Hour,
+		},
+		"ok, shorter": {
+			expiresIn:    600,
+			outExpiresIn: 10 * time.Minute,
+		},
+		"ok, longer": {
+			expiresIn:    7200,
+			outExpiresIn: time.Hour,
+		},
+		"error, db": {
+			dbErr: errors.New("db failed"),
+			err:   "failed to store bootstrap token: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			idData := map[string]interface{}{"sn": "0001"}
+			hash, _ := idDataHash(idData)
+
+			var stored model.BootstrapToken
+			db := &mstore.DataStore{}
+			db.On("AddBootstrapToken", ctx,
+				mock.MatchedBy(func(bt model.BootstrapToken) bool {
+					stored = bt
+					return true
+				})).Return(tc.dbErr)
+
+			d := NewDevAuth(db, nil, nil, Config{
+				BootstrapTokenExpirationTime: 3600,
+			})
+
+			res, err := d.CreateBootstrapToken(ctx, &model.BootstrapTokenReq{
+				IdData:    idData,
+				ExpiresIn: tc.expiresIn,
+			})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NotEmpty(t, res.Token)
+			assert.Equal(t, hashCode(res.Token), stored.Id)
+			assert.Equal(t, hash, stored.IdDataSha256)
+			assert.Equal(t, stored.ExpiresAt, res.ExpiresAt)
+			assert.Equal(t, tc.outExpiresIn,
+				stored.ExpiresAt.Sub(stored.CreatedTs))
+		})
+	}
+}
+
+func TestDevAuthUseBootstrapToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		idData string
+		status string
+
+		dbUseErr     error
+		dbGetAuthErr error
+
+		released bool
+		err      string
+	}{
+		"ok": {
+			idData: `{"sn": "0001"}`,
+		},
+		"ok, rejected auth set stays rejected": {
+			idData: `{"sn": "0001"}`,
+			status: model.DevStatusRejected,
+		},
+		"error, bad id data": {
+			idData: `{"sn": `,
+			err:    "dev auth: bad request: failed to parse identity data: {\"sn\": : unexpected end of JSON input",
+		},
+		"error, invalid token": {
+			idData:   `{"sn": "0001"}`,
+			dbUseErr: store.ErrBootstrapTokenNotFound,
+			err:      ErrInvalidBootstrapToken.Error(),
+		},
+		"error, db": {
+			idData:   `{"sn": "0001"}`,
+			dbUseErr: errors.New("db failed"),
+			err:      "db failed",
+		},
+		"error, accept": {
+			idData:       `{"sn": "0001"}`,
+			dbGetAuthErr: errors.New("db failed"),
+			released:     true,
+			err:          "db get auth set error: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			hash, _ := idDataHash(map[string]interface{}{"sn": "0001"})
+
+			db := &mstore.DataStore{}
+			db.On("UseBootstrapToken", ctx, hashCode("token"), hash,
+				mock.AnythingOfType("time.Time")).
+				Return(&model.BootstrapToken{}, tc.dbUseErr)
+			// the set got accepted in between, nothing left to do
+			db.On("GetAuthSetById", ctx, "aid1").
+				Return(&model.AuthSet{
+					Id:       "aid1",
+					DeviceId: "dev1",
+					Status:   model.DevStatusAccepted,
+				}, tc.dbGetAuthErr)
+			db.On("GetDeviceById", ctx, "dev1").
+				Return(&model.Device{Id: "dev1"}, nil)
+			db.On("ReleaseBootstrapToken", ctx, hashCode("token"),
+				mock.AnythingOfType("time.Time")).Return(nil)
+
+			d := NewDevAuth(db, nil, nil, Config{})
+
+			status := tc.status
+			if status == "" {
+				status = model.DevStatusPending
+			}
+			authSet := &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   status,
+			}
+			err := d.useBootstrapToken(ctx, &model.AuthReq{
+				IdData:         tc.idData,
+				BootstrapToken: "token",
+			}, authSet)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Equal(t, model.DevStatusPending, authSet.Status)
+			} else if status != model.DevStatusPending {
+				assert.NoError(t, err)
+				assert.Equal(t, status, authSet.Status)
+				db.AssertNotCalled(t, "UseBootstrapToken", ctx, hashCode("token"),
+					mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, model.DevStatusAccepted, authSet.Status)
+			}
+			if tc.released {
+				db.AssertCalled(t, "ReleaseBootstrapToken", ctx, hashCode("token"),
+					mock.AnythingOfType("time.Time"))
+			} else {
+				db.AssertNotCalled(t, "ReleaseBootstrapToken", ctx, hashCode("token"),
+					mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// number of due devices fetched at once by the decommissioning job
+const decommissionBatchSize = 100
+
+var (
+	ErrDecommissionAtPast = NewError(ErrKindBadRequest, catalog.CodeDecommissionAtPast)
+)
+
+// ScheduleDecommission sets the time the device gets decommissioned at, see
+// DecommissionScheduledDevices
+func (d *DevAuth) ScheduleDecommission(ctx context.Context, devId string, at time.Time) error {
+	if !at.After(time.Now()) {
+		return ErrDecommissionAtPast
+	}
+
+	at = at.UTC()
+	return d.setDecommissionAt(ctx, devId, &at)
+}
+
+// CancelScheduledDecommission clears the device's decommissioning time
+func (d *DevAuth) CancelScheduledDecommission(ctx context.Context, devId string) error {
+	return d.setDecommissionAt(ctx, devId, nil)
+}
+
+func (d *DevAuth) setDecommissionAt(ctx context.Context, devId string, at *time.Time) error {
+	err := d.db.SetDeviceDecommissionAt(ctx, devId, at)
+	switch err {
+	case nil:
+		return nil
+	case store.ErrDevNotFound:
+		return ErrDeviceNotFound
+	default:
+		return errors.Wrap(err, "failed to set decommissioning time")
+	}
+}
+
+// GetScheduledDecommissions lists the devices scheduled for decommissioning,
+// soonest first
+func (d *DevAuth) GetScheduledDecommissions(ctx context.Context, skip, limit uint) ([]model.Device, error) {
+	devs, err := d.db.GetScheduledDecommissions(ctx, time.Time{}, skip, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list scheduled decommissions")
+	}
+	return devs, nil
+}
+
+// DecommissionScheduledDevices decommissions the devices whose time has
+// come, in all tenants. Each device is claimed first, so that concurrent
+// runs don't decommission it twice. Devices failing to decommission are
+// logged and retried on the next run.
+func (d *DevAuth) DecommissionScheduledDevices(ctx context.Context) error {
+	l := log.FromContext(ctx)
+
+	tenants := []string{""}
+	if d.verifyTenant {
+		ids, err := d.db.GetTenantIds(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list tenants")
+		}
+		tenants = ids
+	}
+
+	now := time.Now().UTC()
+	for _, tenantId := range tenants {
+		// there's no incoming request to pass on, the decommissioning
+		// workflows are authorized by deviceauth itself
+		tenantCtx, err := d.serviceContext(ctx, tenantId)
+		if err != nil {
+			l.Errorf("scheduled decommissioning failed, tenant: %q: %v",
+				tenantId, err)
+			continue
+		}
+
+		if err := d.decommissionDueDevices(tenantCtx, now); err != nil {
+			l.Errorf("scheduled decommissioning failed, tenant: %q: %v",
+				tenantId, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *DevAuth) decommissionDueDevices(ctx context.Context, now time.Time) error {
+	l := log.FromContext(ctx)
+
+	// decommissioned devices are gone from the list, skip over the
+	// failed ones only
+	var skip uint
+	for {
+		devs, err := d.db.GetScheduledDecommissions(ctx, now, skip, decommissionBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed to list scheduled decommissions")
+		}
+
+		for _, dev := range devs {
+			switch err := d.db.ClaimDecommission(ctx, dev.Id, now); err {
+			case nil:
+			case store.ErrDevNotFound:
+				// claimed by another run, or rescheduled
+				continue
+			default:
+				l.Errorf("failed to claim device %s for decommissioning: %v",
+					dev.Id, err)
+				skip++
+				continue
+			}
+
+			if err := d.DecommissionDevice(ctx, dev.Id); err != nil {
+				l.Errorf("failed to decommission device %s: %v", dev.Id, err)
+				// back on schedule, for the next run
+				err := d.db.SetDeviceDecommissionAt(ctx, dev.Id, dev.DecommissionAt)
+				if err == nil {
+					skip++
+				} else if err != store.ErrDevNotFound {
+					l.Errorf("failed to reschedule decommissioning of device %s: %v",
+						dev.Id, err)
+				}
+				continue
+			}
+			l.Infof("device %s decommissioned as scheduled at %s",
+				dev.Id, dev.DecommissionAt.Format(time.RFC3339))
+		}
+
+		if len(devs) < decommissionBatchSize {
+			return nil
+		}
+	}
+}
+
+// RunDecommissionScheduler runs DecommissionScheduledDevices every interval,
+// until ctx is done
+func (d *DevAuth) RunDecommissionScheduler(ctx context.Context, interval time.Duration) {
+	l := log.FromContext(ctx)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := d.DecommissionScheduledDevices(ctx); err != nil {
+			l.Errorf("scheduled decommissioning failed: %v", err)
+		}
+	}
+}
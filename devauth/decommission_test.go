@@ -0,0 +1,163 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/client/orchestrator"
+	morchestrator "github.com/mendersoftware/deviceauth/client/orchestrator/mocks"
+	"github.com/mendersoftware/deviceauth/jwt"
+	mjwt "github.com/mendersoftware/deviceauth/jwt/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthScheduleDecommission(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		at time.Time
+
+		dbErr error
+
+		err string
+	}{
+		"ok": {
+			at: time.Now().Add(time.Hour),
+		},
+		"error, in the past": {
+			at:  time.Now().Add(-time.Minute),
+			err: ErrDecommissionAtPast.Error(),
+		},
+		"error, device not found": {
+			at:    time.Now().Add(time.Hour),
+			dbErr: store.ErrDevNotFound,
+			err:   ErrDeviceNotFound.Error(),
+		},
+		"error, db": {
+			at:    time.Now().Add(time.Hour),
+			dbErr: errors.New("db connection failed"),
+			err:   "failed to set decommissioning time: db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := mstore.DataStore{}
+			db.On("SetDeviceDecommissionAt", ctx, "dev1",
+				mock.MatchedBy(func(at *time.Time) bool {
+					return at != nil && at.Equal(tc.at)
+				})).Return(tc.dbErr)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.ScheduleDecommission(ctx, "dev1", tc.at)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDevAuthDecommissionScheduledDevices(t *testing.T) {
+	t.Parallel()
+
+	at := time.Now().Add(-time.Minute)
+	ctxMatcher := mtesting.ContextMatcher()
+	tenantMatcher := func(tenantId string) interface{} {
+		return mock.MatchedBy(func(ctx context.Context) bool {
+			ident := identity.FromContext(ctx)
+			return ident != nil && ident.Tenant == tenantId
+		})
+	}
+
+	db := mstore.DataStore{}
+	db.On("GetTenantIds", ctxMatcher).Return([]string{"tenant1", "tenant2"}, nil)
+	db.On("GetScheduledDecommissions", tenantMatcher("tenant1"),
+		mock.AnythingOfType("time.Time"), uint(0), uint(decommissionBatchSize)).
+		Return([]model.Device{
+			{Id: "dev1", DecommissionAt: &at},
+			{Id: "dev2", DecommissionAt: &at},
+			{Id: "dev3", DecommissionAt: &at},
+		}, nil)
+	db.On("GetScheduledDecommissions", tenantMatcher("tenant2"),
+		mock.AnythingOfType("time.Time"), uint(0), uint(decommissionBatchSize)).
+		Return(nil, errors.New("db connection failed"))
+
+	// dev3 is claimed by another replica
+	for _, id := range []string{"dev1", "dev2"} {
+		db.On("ClaimDecommission", ctxMatcher, id,
+			mock.AnythingOfType("time.Time")).Return(nil)
+	}
+	db.On("ClaimDecommission", ctxMatcher, "dev3",
+		mock.AnythingOfType("time.Time")).Return(store.ErrDevNotFound)
+
+	// dev1 fails to decommission, and is rescheduled, dev2 goes through
+	db.On("UpdateDevice", ctxMatcher, model.Device{Id: "dev1"},
+		mock.AnythingOfType("model.DeviceUpdate")).
+		Return(errors.New("db connection failed"))
+	db.On("SetDeviceDecommissionAt", ctxMatcher, "dev1", &at).Return(nil)
+	db.On("UpdateDevice", ctxMatcher, model.Device{Id: "dev2"},
+		mock.AnythingOfType("model.DeviceUpdate")).Return(nil)
+	db.On("DeleteAuthSetsForDevice", ctxMatcher, "dev2").Return(nil)
+	db.On("DeleteTokenByDevId", ctxMatcher, "dev2").Return(nil)
+	db.On("DeleteDevice", ctxMatcher, "dev2").Return(nil)
+
+	co := morchestrator.ClientRunner{}
+	co.On("SubmitDeviceDecommisioningJob", ctxMatcher,
+		mock.MatchedBy(func(req orchestrator.DecommissioningReq) bool {
+			return req.DeviceId == "dev2" &&
+				req.RequestId != "" &&
+				req.Authorization == "Bearer servicetoken"
+		})).Return(nil)
+
+	jwth := mjwt.Handler{}
+	jwth.On("ToJWT",
+		mock.MatchedBy(func(jt *jwt.Token) bool {
+			return jt.Claims.Subject == serviceTokenSubject &&
+				jt.Claims.Tenant != "" &&
+				!jt.Claims.Device
+		})).
+		Return("servicetoken", nil)
+
+	devauth := NewDevAuth(&db, &co, &jwth, Config{})
+	devauth.verifyTenant = true
+
+	err := devauth.DecommissionScheduledDevices(context.Background())
+	assert.NoError(t, err)
+
+	co.AssertExpectations(t)
+	db.AssertCalled(t, "DeleteDevice", ctxMatcher, "dev2")
+	db.AssertNotCalled(t, "DeleteDevice", ctxMatcher, "dev1")
+	db.AssertNotCalled(t, "UpdateDevice", ctxMatcher, model.Device{Id: "dev3"},
+		mock.Anything)
+	db.AssertExpectations(t)
+}
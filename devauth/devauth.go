@@ -16,14 +16,13 @@ package devauth
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/Azure/go-autorest/autorest/to"
-	"github.com/globalsign/mgo/bson"
 	"github.com/mendersoftware/go-lib-micro/apiclient"
 	ctxhttpheader "github.com/mendersoftware/go-lib-micro/context/httpheader"
 	"github.com/mendersoftware/go-lib-micro/identity"
@@ -37,41 +36,14 @@ import (
 	"github.com/mendersoftware/deviceauth/client/tenant"
 	"github.com/mendersoftware/deviceauth/jwt"
 	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/notify"
+	"github.com/mendersoftware/deviceauth/revocation"
 	"github.com/mendersoftware/deviceauth/store"
 	"github.com/mendersoftware/deviceauth/store/mongo"
+	"github.com/mendersoftware/deviceauth/utils"
 	uto "github.com/mendersoftware/deviceauth/utils/to"
 )
 
-const (
-	MsgErrDevAuthUnauthorized = "dev auth: unauthorized"
-	MsgErrDevAuthBadRequest   = "dev auth: bad request"
-)
-
-var (
-	ErrDevAuthUnauthorized   = errors.New(MsgErrDevAuthUnauthorized)
-	ErrDevIdAuthIdMismatch   = errors.New("dev auth: dev ID and auth ID mismatch")
-	ErrMaxDeviceCountReached = errors.New("maximum number of accepted devices reached")
-	ErrDeviceExists          = errors.New("device already exists")
-	ErrDeviceNotFound        = errors.New("device not found")
-	ErrDevAuthBadRequest     = errors.New(MsgErrDevAuthBadRequest)
-)
-
-func IsErrDevAuthUnauthorized(e error) bool {
-	return strings.HasPrefix(e.Error(), MsgErrDevAuthUnauthorized)
-}
-
-func MakeErrDevAuthUnauthorized(e error) error {
-	return errors.Wrap(e, MsgErrDevAuthUnauthorized)
-}
-
-func IsErrDevAuthBadRequest(e error) bool {
-	return strings.HasPrefix(e.Error(), MsgErrDevAuthBadRequest)
-}
-
-func MakeErrDevAuthBadRequest(e error) error {
-	return errors.Wrap(e, MsgErrDevAuthBadRequest)
-}
-
 // Expiration Timeout should be moved to database
 // Do we need Expiration Timeout per device?
 const (
@@ -90,29 +62,93 @@ type App interface {
 	SubmitAuthRequest(ctx context.Context, r *model.AuthReq) (string, error)
 
 	GetDevices(ctx context.Context, skip, limit uint, filter store.DeviceFilter) ([]model.Device, error)
+	ExportDevices(ctx context.Context, filter store.DeviceFilter, fn func(*model.Device) error) error
 	GetDevice(ctx context.Context, dev_id string) (*model.Device, error)
 	DecommissionDevice(ctx context.Context, dev_id string) error
+	UpdateDeviceAnnotations(ctx context.Context, dev_id string, a *model.DeviceAnnotations) error
+	SetDeviceGroup(ctx context.Context, dev_id string, group string) error
+	GetDeviceAuthSet(ctx context.Context, dev_id string, auth_id string) (*model.AuthSet, error)
 	DeleteAuthSet(ctx context.Context, dev_id string, auth_id string) error
 	AcceptDeviceAuth(ctx context.Context, dev_id string, auth_id string) error
 	RejectDeviceAuth(ctx context.Context, dev_id string, auth_id string) error
 	ResetDeviceAuth(ctx context.Context, dev_id string, auth_id string) error
+	DismissDeviceAuth(ctx context.Context, dev_id string, auth_id string) error
+	ResolveAuthSetConflict(ctx context.Context, dev_id string, auth_id string, others string) error
+	UpdateDevicesStatus(ctx context.Context, req *model.DevicesStatusReq) ([]model.DeviceStatusResult, error)
 	PreauthorizeDevice(ctx context.Context, req *model.PreAuthReq) error
+	ImportPreauthorizedDevices(ctx context.Context, r *model.PreAuthImportReader) (*model.PreAuthImportResult, error)
 	GetDeviceToken(ctx context.Context, dev_id string) (*model.Token, error)
 
 	RevokeToken(ctx context.Context, token_id string) error
+	RevokeDeviceTokens(ctx context.Context, dev_id string) error
+	GetDeviceTokens(ctx context.Context, dev_id string) ([]model.DeviceToken, error)
 	VerifyToken(ctx context.Context, token string) error
+	IntrospectToken(ctx context.Context, token string) (*model.TokenIntrospection, error)
+	IssueRefreshToken(ctx context.Context, token string) (string, error)
+	RenewToken(ctx context.Context, token string) (string, error)
+	CreateBootstrapToken(ctx context.Context, req *model.BootstrapTokenReq) (*model.NewBootstrapToken, error)
+	RefreshToken(ctx context.Context, refreshToken string) (string, string, error)
 	DeleteTokens(ctx context.Context, tenant_id, device_id string) error
+	GetRevokedTokens(ctx context.Context, tenant_id string, since time.Time, skip, limit uint) ([]model.RevokedToken, error)
+	GetTokenAuditRecords(ctx context.Context, filter store.TokenAuditFilter, skip, limit uint) ([]model.TokenAuditRecord, error)
+	GetDeviceStatusHistory(ctx context.Context, dev_id string, skip, limit uint) ([]model.DeviceStatusChange, error)
+	GetDeviceStatusChanges(ctx context.Context, after *store.Cursor, limit uint) ([]model.DeviceStatusChange, error)
 
 	SetTenantLimit(ctx context.Context, tenant_id string, limit model.Limit) error
 
 	GetLimit(ctx context.Context, name string) (*model.Limit, error)
+	GetDeviceLimitUsage(ctx context.Context) (*model.DeviceLimitUsage, error)
 	GetTenantLimit(ctx context.Context, name, tenant_id string) (*model.Limit, error)
 
 	GetDevCountByStatus(ctx context.Context, status string) (int, error)
+	GetDevCounts(ctx context.Context) (*model.DeviceCounts, error)
+	GetStatistics(ctx context.Context, period time.Duration) (*model.Statistics, error)
+	CountDevices(ctx context.Context, filter store.DeviceFilter) (int, error)
 
 	ProvisionTenant(ctx context.Context, tenant_id string) error
+	SuspendTenant(ctx context.Context, tenantId string) error
+	ResumeTenant(ctx context.Context, tenantId string) error
 
 	GetTenantDeviceStatus(ctx context.Context, tenantId, deviceId string) (*model.Status, error)
+
+	SubmitDeviceAuthorization(ctx context.Context, r *model.AuthReq) (*model.DeviceAuthorization, error)
+	PollDeviceAuthorization(ctx context.Context, deviceCode string) (string, error)
+	GetDeviceAuthorization(ctx context.Context, userCode string) (*model.DeviceCode, error)
+	SetDeviceAuthorizationStatus(ctx context.Context, userCode string, status string) error
+
+	StartDeviceTransfer(ctx context.Context, req *model.TransferReq) (*model.Transfer, error)
+	GetDeviceTransfer(ctx context.Context, id string) (*model.Transfer, error)
+	CancelDeviceTransfer(ctx context.Context, id string) error
+	AcceptDeviceTransfer(ctx context.Context, id string) error
+	DeclineDeviceTransfer(ctx context.Context, id string) error
+
+	ScheduleDecommission(ctx context.Context, devId string, at time.Time) error
+	CancelScheduledDecommission(ctx context.Context, devId string) error
+	GetScheduledDecommissions(ctx context.Context, skip, limit uint) ([]model.Device, error)
+	PurgeRejectedDevices(ctx context.Context, olderThan time.Duration, dryRun bool) (int, error)
+
+	QuarantineDevice(ctx context.Context, devId string) error
+	ReleaseDeviceQuarantine(ctx context.Context, devId string) error
+
+	GetOffboardingTokens(ctx context.Context, skip, limit uint) ([]model.OffboardingToken, error)
+	GetRevocationGateways(ctx context.Context) ([]revocation.GatewayStatus, error)
+
+	GetJWKS(ctx context.Context) (*jwt.JWKS, error)
+	GetKeyPolicy(ctx context.Context) (*model.KeyPolicy, error)
+
+	NewAuthChallenge(ctx context.Context, req *model.AuthChallengeReq) (*model.AuthChallenge, error)
+	RotateDeviceKey(ctx context.Context, r *model.KeyRotationReq) error
+	GetDeviceKeys(ctx context.Context, dev_id string) ([]model.DeviceKey, error)
+	RevokeDeviceKey(ctx context.Context, dev_id string, auth_id string) error
+}
+
+// AuthReqHook is a pluggable check invoked for each incoming auth request,
+// allowing for custom validation (e.g. firmware hash, supply-chain database
+// lookup) without modifying the service.
+type AuthReqHook interface {
+	// CheckAuthRequest returns the check outcome; returning an error
+	// means the check could not be performed and fails the request
+	CheckAuthRequest(ctx context.Context, r *model.AuthReq) (*model.AuthReqCheck, error)
 }
 
 type DevAuth struct {
@@ -122,16 +158,84 @@ type DevAuth struct {
 	jwt          jwt.Handler
 	clientGetter ApiClientGetter
 	verifyTenant bool
+	authReqHooks []AuthReqHook
+	tpmVerifier  TPMVerifier
+	notifier     notify.Notifier
+	tokenUsage   *tokenUsage
+	checkins     *deviceCheckins
+	revocations  revocation.Publisher
 	config       Config
 }
 
 type Config struct {
 	// token issuer
 	Issuer string
+	// token audience
+	Audience string
+	// per tenant token issuers and audiences, overriding the defaults
+	TenantIssuers map[string]TokenIssuer
+	// device API scopes of tenants' tokens; tokens are unrestricted if nil
+	TokenScopes *TokenScopePolicy
 	// token expiration time
 	ExpirationTime int64
+	// refresh token expiration time; refresh tokens are disabled if 0
+	RefreshExpirationTime int64
+	// bootstrap token expiration time, default and max
+	BootstrapTokenExpirationTime int64
+	// max token lifetime; if set, verifying a token extends its
+	// expiration time, up to the max lifetime (sliding expiration)
+	MaxLifetime int64
 	// max devices limit default
 	MaxDevicesLimitDefault uint64
+	// device authorization grant verification URI, presented to the
+	// device; the grant is disabled if not set
+	DeviceAuthzVerificationUri string
+	// device authorization grant device/user code expiration time
+	DeviceAuthzExpirationTime int64
+	// device authorization grant minimal polling interval
+	DeviceAuthzInterval int64
+	// SPIFFE trust domain; if set, tokens carry the device's SPIFFE ID
+	SpiffeTrustDomain string
+	// device API path prefixes offboarding tokens are valid for; offboarding
+	// tokens are disabled if empty
+	OffboardingTokenScope []string
+	// offboarding grace period default, for tenants without own setting
+	OffboardingGracePeriodDefault uint64
+	// CA certificates device certificates are verified against;
+	// certificate enrollment is disabled if nil
+	DeviceCACerts *x509.CertPool
+	// id data attribute matched against the subject common name of the
+	// TLS client certificate; if set, auth requests require a client
+	// certificate
+	MTLSIdentityAttribute string
+	// minimum strength of device public keys
+	KeyPolicy model.KeyPolicy
+	// if set, auth requests must carry a nonce from an auth challenge
+	AuthChallengeRequired bool
+	// auth challenge nonce expiration time
+	AuthChallengeExpirationTime int64
+	// if set, auth requests must carry a signed timestamp
+	AuthReqTimestampRequired bool
+	// max difference of the auth request timestamp to the current time,
+	// in seconds
+	AuthReqMaxClockSkew int64
+	// max accepted keys per device; if 1 or less, accepting an auth set
+	// rejects the device's other auth sets
+	MaxDeviceKeys int
+	// additional claims of device tokens
+	ClaimsTemplate jwt.ClaimsTemplate
+	// how long after expiring, in seconds, tokens are still accepted, with
+	// ErrTokenExpiryGrace
+	TokenExpiryGrace int64
+	// max tokens a device may hold; issuing more revokes the oldest ones,
+	// unlimited if 0
+	MaxDeviceTokens int
+	// if set, token issuances and revocations are recorded in the token
+	// audit trail
+	TokenAudit bool
+	// how long, in seconds, rejected devices are kept after their last
+	// auth attempt; kept forever if 0
+	RejectedDeviceRetention int64
 }
 
 func NewDevAuth(d store.DataStore, co orchestrator.ClientRunner,
@@ -149,6 +253,7 @@ func NewDevAuth(d store.DataStore, co orchestrator.ClientRunner,
 
 func (d *DevAuth) getDeviceFromAuthRequest(ctx context.Context, r *model.AuthReq) (*model.Device, error) {
 	dev := model.NewDevice("", r.IdData, r.PubKey)
+	dev.KeyType = utils.PubKeyType(r.PubKey)
 
 	l := log.FromContext(ctx)
 
@@ -166,6 +271,7 @@ func (d *DevAuth) getDeviceFromAuthRequest(ctx context.Context, r *model.AuthReq
 		l.Errorf("failed to add/find device: %v", err)
 		return nil, err
 	}
+	added := err == nil
 
 	// either the device was added or it was already present, in any case,
 	// pull it from DB
@@ -174,6 +280,9 @@ func (d *DevAuth) getDeviceFromAuthRequest(ctx context.Context, r *model.AuthReq
 		l.Error("failed to find device but could not add either")
 		return nil, errors.New("failed to locate device")
 	}
+	if added {
+		d.recordStatusChange(ctx, dev.Id, "", dev.Status)
+	}
 
 	// check if the device is in the decommissioning state
 	if dev.Decommissioning {
@@ -181,6 +290,18 @@ func (d *DevAuth) getDeviceFromAuthRequest(ctx context.Context, r *model.AuthReq
 		return nil, ErrDevAuthUnauthorized
 	}
 
+	if dev.Status == model.DevStatusQuarantined {
+		l.Warnf("Device %s is quarantined", dev.Id)
+		return nil, ErrDeviceQuarantined
+	}
+
+	// a device enrolling in a tenant may be transferred from another one
+	if added && d.verifyTenant {
+		if err := d.completeTenantTransfer(ctx, dev); err != nil {
+			l.Errorf("failed to complete device transfer: %v", err)
+		}
+	}
+
 	return dev, nil
 }
 
@@ -240,28 +361,134 @@ func (d *DevAuth) verifyTenantToken(ctx context.Context, tenantToken string) (co
 }
 
 func (d *DevAuth) SubmitAuthRequest(ctx context.Context, r *model.AuthReq) (string, error) {
-	l := log.FromContext(ctx)
+	ctx, err := d.authRequestContext(ctx, r)
+	if err != nil {
+		return "", err
+	}
+	d.countAuthRequest(ctx)
 
-	if d.verifyTenant {
-		tctx, err := d.verifyTenantToken(ctx, r.TenantToken)
-		if err != nil {
+	attestation, err := d.verifyAuthRequest(ctx, r)
+	if err != nil {
+		return "", err
+	}
+
+	// an offboarded device gets its final token, if there's one waiting
+	if token, err := d.claimOffboardingToken(ctx, r); err != nil || token != "" {
+		return token, err
+	}
+
+	authSet, err := d.recordAuthRequest(ctx, r, attestation)
+	if err != nil {
+		return "", err
+	}
+	d.recordCheckin(ctx, authSet.DeviceId)
+
+	if r.BootstrapToken != "" && authSet.Status != model.DevStatusAccepted {
+		if err := d.useBootstrapToken(ctx, r, authSet); err != nil {
 			return "", err
 		}
+	}
+
+	// request was already present in DB, check its status
+	if authSet.Status == model.DevStatusAccepted {
+		return d.issueToken(ctx, authSet, model.TokenAuditTriggerAuthRequest)
+	}
+
+	// no token, return device unauthorized
+	return "", ErrDevAuthUnauthorized
+
+}
+
+// authRequestContext verifies the auth request's tenant token, if needed,
+// and that the tenant is not suspended; returns a context updated with
+// tenant identity
+func (d *DevAuth) authRequestContext(ctx context.Context, r *model.AuthReq) (context.Context, error) {
+	if !d.verifyTenant {
+		return ctx, nil
+	}
+
+	ctx, err := d.verifyTenantToken(ctx, r.TenantToken)
+	if err != nil {
+		return ctx, err
+	}
+	if err := d.checkTenantSuspended(ctx); err != nil {
+		return ctx, err
+	}
+	return ctx, nil
+}
+
+// verifyAuthRequest verifies the auth request's certificates, key, nonce,
+// timestamp and TPM attestation; nothing is handed out to the device before
+// it passes, the nonce is used up. Returns the verified attestation, if any.
+func (d *DevAuth) verifyAuthRequest(ctx context.Context, r *model.AuthReq) (*model.TPMAttestationResult, error) {
+	if err := d.verifyClientCert(ctx, r); err != nil {
+		return nil, err
+	}
+
+	if err := d.verifyDeviceCert(ctx, r); err != nil {
+		return nil, err
+	}
+
+	if err := d.checkKeyPolicy(ctx, r.PubKeyStruct); err != nil {
+		return nil, err
+	}
+
+	nonce, err := d.verifyAuthNonce(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.verifyAuthReqTimestamp(ctx, r); err != nil {
+		return nil, err
+	}
+
+	return d.verifyTPMAttestation(ctx, r, nonce)
+}
 
-		// update context
-		ctx = tctx
+// recordAuthRequest records the device and auth set the auth request
+// carries, along with the attestation verifyAuthRequest returned; ctx is
+// expected to come from authRequestContext
+func (d *DevAuth) recordAuthRequest(ctx context.Context, r *model.AuthReq, attestation *model.TPMAttestationResult) (*model.AuthSet, error) {
+	annotations, err := d.checkAuthRequest(ctx, r)
+	if err != nil {
+		return nil, err
 	}
 
 	// first, try to handle preauthorization
 	authSet, err := d.processPreAuthRequest(ctx, r)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// if not a preauth request, process with regular auth request handling
 	if authSet == nil {
 		authSet, err = d.processAuthRequest(ctx, r)
 		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(annotations) > 0 || attestation != nil {
+		if err := d.db.UpdateAuthSet(ctx, *authSet, model.AuthSetUpdate{
+			Annotations:    annotations,
+			TPMAttestation: attestation,
+		}); err != nil {
+			return nil, errors.Wrap(err, "failed to annotate auth set")
+		}
+	}
+
+	return authSet, nil
+}
+
+// issueToken generates, signs and records a new token for an accepted
+// auth set
+func (d *DevAuth) issueToken(ctx context.Context, authSet *model.AuthSet, trigger string) (string, error) {
+	l := log.FromContext(ctx)
+
+	// checked here as well as on auth requests, tokens are also issued
+	// for refresh tokens, renewals and device authorization polls
+	if d.verifyTenant && tenantFromContext(ctx) != "" {
+		if err := d.checkTenantSuspended(ctx); err != nil {
 			return "", err
 		}
 	}
@@ -272,47 +499,128 @@ func (d *DevAuth) SubmitAuthRequest(ctx context.Context, r *model.AuthReq) (stri
 		return "", err
 	}
 
-	// request was already present in DB, check its status
-	if authSet.Status == model.DevStatusAccepted {
-		rawJwt := &jwt.Token{
-			Claims: jwt.Claims{
-				ID:        uid.String(),
-				Issuer:    d.config.Issuer,
-				ExpiresAt: time.Now().Unix() + d.config.ExpirationTime,
-				Subject:   authSet.DeviceId,
-				Device:    true,
-			},
+	expiration, err := d.tokenExpiration(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	rawJwt := &jwt.Token{
+		Claims: jwt.Claims{
+			ID:        uid.String(),
+			ExpiresAt: now.Unix() + expiration,
+			Subject:   authSet.DeviceId,
+			Device:    true,
+		},
+	}
+	if d.config.MaxLifetime > 0 {
+		// sliding expiration: the token expires when it's not used within
+		// the expiration time, see VerifyToken
+		rawJwt.Claims.ExpiresAt = now.Unix() + d.config.MaxLifetime
+	}
+
+	if d.verifyTenant {
+		// update token tenant claim if needed
+		ident := identity.FromContext(ctx)
+		if ident != nil && ident.Tenant != "" {
+			rawJwt.Claims.Tenant = ident.Tenant
 		}
+	}
 
-		if d.verifyTenant {
-			// update token tenant claim if needed
-			ident := identity.FromContext(ctx)
-			if ident != nil && ident.Tenant != "" {
-				rawJwt.Claims.Tenant = ident.Tenant
-			}
+	iss := d.tokenIssuer(rawJwt.Claims.Tenant)
+	rawJwt.Claims.Issuer = iss.Issuer
+	rawJwt.Claims.Audience = iss.Audience
+	rawJwt.Claims.Scope = d.tokenScope(tenantFromContext(ctx))
+
+	if d.config.SpiffeTrustDomain != "" {
+		rawJwt.Claims.SpiffeID = jwt.SpiffeID(d.config.SpiffeTrustDomain,
+			rawJwt.Claims.Tenant, authSet.DeviceId)
+	}
+
+	if len(d.config.ClaimsTemplate) > 0 {
+		idData := authSet.IdDataStruct
+		if idData == nil {
+			idData, _, _ = parseIdData(authSet.IdData)
 		}
+		rawJwt.Claims.Extra = d.config.ClaimsTemplate.Claims(jwt.ClaimsData{
+			DeviceId: authSet.DeviceId,
+			Tenant:   rawJwt.Claims.Tenant,
+			Status:   authSet.Status,
+			IdData:   idData,
+		})
+	}
+
+	// sign and encode as JWT
+	raw, err := rawJwt.MarshalJWT(d.signToken(ctx))
+	if err != nil {
+		return "", errors.Wrap(err, "generate token error")
+	}
+
+	token := model.NewToken(rawJwt.Claims.ID, authSet.DeviceId, string(raw))
+	token = token.WithAuthSet(authSet)
+	exp := time.Unix(rawJwt.Claims.ExpiresAt, 0).UTC()
+	token.Exp = &exp
+	issued := now.UTC()
+	token.IssuedTs = &issued
+	if d.config.MaxLifetime > 0 {
+		expiresAt := now.Add(time.Duration(expiration) * time.Second)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := d.db.AddToken(ctx, *token); err != nil {
+		return "", errors.Wrap(err, "add token error")
+	}
 
-		// sign and encode as JWT
-		raw, err := rawJwt.MarshalJWT(d.signToken(ctx))
+	d.limitDeviceTokens(ctx, authSet.DeviceId)
+
+	l.Infof("Token %v assigned to device %v auth set %v",
+		token.Id, authSet.DeviceId, authSet.Id)
+	d.auditToken(ctx, model.TokenAuditRecord{
+		Action:   model.TokenAuditActionIssued,
+		TokenId:  token.Id,
+		DeviceId: authSet.DeviceId,
+		Trigger:  trigger,
+	})
+	return token.Token, nil
+}
+
+// checkAuthRequest runs the auth request through all configured hooks;
+// returns merged annotations or an error if any of the hooks vetoed the request
+func (d *DevAuth) checkAuthRequest(ctx context.Context, r *model.AuthReq) (map[string]interface{}, error) {
+	l := log.FromContext(ctx)
+
+	var annotations map[string]interface{}
+
+	for _, hook := range d.authReqHooks {
+		res, err := hook.CheckAuthRequest(ctx, r)
 		if err != nil {
-			return "", errors.Wrap(err, "generate token error")
+			return nil, errors.Wrap(err, "auth request check failed")
 		}
 
-		token := model.NewToken(rawJwt.Claims.ID, authSet.DeviceId, string(raw))
-		token = token.WithAuthSet(authSet)
-
-		if err := d.db.AddToken(ctx, *token); err != nil {
-			return "", errors.Wrap(err, "add token error")
+		if res.Reject {
+			l.Warnf("auth request rejected by check: %s", res.Reason)
+			d.notify(ctx, notify.Notification{
+				Kind:    notify.KindSecurityAlert,
+				Subject: "Device auth request rejected",
+				Message: "An auth request was rejected by the auth request check: " +
+					res.Reason,
+				Fields: map[string]string{
+					"id_data": r.IdData,
+				},
+			})
+			return nil, MakeErrDevAuthUnauthorized(
+				errors.Errorf("auth request rejected: %s", res.Reason))
 		}
 
-		l.Infof("Token %v assigned to device %v auth set %v",
-			token.Id, authSet.DeviceId, authSet.Id)
-		return token.Token, nil
+		for k, v := range res.Annotations {
+			if annotations == nil {
+				annotations = make(map[string]interface{}, len(res.Annotations))
+			}
+			annotations[k] = v
+		}
 	}
 
-	// no token, return device unauthorized
-	return "", ErrDevAuthUnauthorized
-
+	return annotations, nil
 }
 
 func (d *DevAuth) processPreAuthRequest(ctx context.Context, r *model.AuthReq) (*model.AuthSet, error) {
@@ -347,6 +655,10 @@ func (d *DevAuth) processPreAuthRequest(ctx context.Context, r *model.AuthReq) (
 		return nil, err
 	}
 
+	if dev.Status == model.DevStatusQuarantined {
+		return nil, ErrDeviceQuarantined
+	}
+
 	if dev.Status == model.DevStatusAccepted {
 		deviceAlreadyAccepted = true
 	}
@@ -358,6 +670,7 @@ func (d *DevAuth) processPreAuthRequest(ctx context.Context, r *model.AuthReq) (
 	}
 
 	if !allow {
+		d.notifyLimitReached(ctx, aset.DeviceId)
 		return nil, ErrMaxDeviceCountReached
 	}
 
@@ -406,16 +719,17 @@ func (d *DevAuth) updateDeviceStatus(ctx context.Context, devId, status string)
 		}
 	}
 
-	if err := d.db.UpdateDevice(ctx,
-		model.Device{
-			Id: devId,
-		},
-		model.DeviceUpdate{
-			Status:    status,
-			UpdatedTs: uto.TimePtr(time.Now().UTC()),
-		}); err != nil {
+	prev, err := d.db.SetDeviceStatus(ctx, devId, status)
+	if err != nil {
 		return errors.Wrap(err, "failed to update device status")
 	}
+	if prev == model.DevStatusQuarantined {
+		// kept until released, see ReleaseDeviceQuarantine
+		return nil
+	}
+	if prev != status {
+		d.recordStatusChange(ctx, devId, prev, status)
+	}
 	return nil
 }
 
@@ -442,9 +756,11 @@ func (d *DevAuth) processAuthRequest(ctx context.Context, r *model.AuthReq) (*mo
 		IdDataStruct: idDataStruct,
 		IdDataSha256: idDataSha256,
 		PubKey:       r.PubKey,
+		KeyType:      utils.PubKeyType(r.PubKey),
 		DeviceId:     dev.Id,
 		Status:       model.DevStatusPending,
 		Timestamp:    uto.TimePtr(time.Now()),
+		FirstRequest: authSetRequest(ctx),
 	}
 
 	// record authentication request
@@ -452,6 +768,7 @@ func (d *DevAuth) processAuthRequest(ctx context.Context, r *model.AuthReq) (*mo
 	if err != nil && err != store.ErrObjectExists {
 		return nil, err
 	}
+	added := err == nil
 
 	// update the device status
 	if err := d.updateDeviceStatus(ctx, dev.Id, ""); err != nil {
@@ -466,6 +783,10 @@ func (d *DevAuth) processAuthRequest(ctx context.Context, r *model.AuthReq) (*mo
 		return nil, errors.New("failed to locate device auth set")
 	}
 
+	if added {
+		d.detectAuthSetConflicts(ctx, areq)
+	}
+
 	return areq, nil
 }
 
@@ -518,6 +839,19 @@ func (d *DevAuth) DecommissionDevice(ctx context.Context, devId string) error {
 		return err
 	}
 
+	if d.offboardingEnabled() {
+		sets, err := d.db.GetAuthSetsForDevice(ctx, devId)
+		if err != nil && err != store.ErrDevNotFound {
+			return errors.Wrap(err, "db get auth sets error")
+		}
+		for i := range sets {
+			if sets[i].Status == model.DevStatusAccepted {
+				d.issueOffboardingToken(ctx, &sets[i],
+					model.OffboardingReasonDecommissioned)
+			}
+		}
+	}
+
 	reqId := requestid.FromContext(ctx)
 
 	// submit device decommissioning job
@@ -537,7 +871,7 @@ func (d *DevAuth) DecommissionDevice(ctx context.Context, devId string) error {
 	}
 
 	// delete device tokens
-	if err := d.db.DeleteTokenByDevId(ctx, devId); err != nil && err != store.ErrTokenNotFound {
+	if err := d.deleteDeviceTokens(ctx, devId, revocation.ReasonDecommissioned); err != nil && err != store.ErrTokenNotFound {
 		return errors.Wrap(err, "db delete device tokens error")
 	}
 
@@ -563,7 +897,7 @@ func (d *DevAuth) DeleteAuthSet(ctx context.Context, devId string, authId string
 
 	// if the device authentication set is accepted delete device tokens
 	if authSet.Status == model.DevStatusAccepted {
-		if err := d.db.DeleteTokenByDevId(ctx, devId); err != nil && err != store.ErrTokenNotFound {
+		if err := d.deleteDeviceTokens(ctx, devId, revocation.ReasonRejected); err != nil && err != store.ErrTokenNotFound {
 			return errors.Wrap(err, "db delete device tokens error")
 		}
 	}
@@ -603,6 +937,10 @@ func (d *DevAuth) AcceptDeviceAuth(ctx context.Context, device_id string, auth_i
 		return err
 	}
 
+	if dev.Status == model.DevStatusQuarantined {
+		return ErrDeviceQuarantined
+	}
+
 	if dev.Status == model.DevStatusAccepted {
 		deviceAlreadyAccepted = true
 	}
@@ -620,6 +958,7 @@ func (d *DevAuth) AcceptDeviceAuth(ctx context.Context, device_id string, auth_i
 	}
 
 	if !allow {
+		d.notifyLimitReached(ctx, device_id)
 		return ErrMaxDeviceCountReached
 	}
 
@@ -627,6 +966,12 @@ func (d *DevAuth) AcceptDeviceAuth(ctx context.Context, device_id string, auth_i
 		return err
 	}
 
+	if dev.TransferId != "" {
+		if err := d.completeTransfer(ctx, dev); err != nil {
+			return err
+		}
+	}
+
 	if deviceAlreadyAccepted {
 		return nil
 	}
@@ -668,23 +1013,29 @@ func (d *DevAuth) setAuthSetStatus(ctx context.Context, device_id string, auth_i
 
 	if aset.Status == model.DevStatusAccepted && (status == model.DevStatusRejected || status == model.DevStatusPending) {
 		// delete device token
-		err := d.db.DeleteTokenByDevId(ctx, aset.DeviceId)
+		reason := revocation.ReasonRevoked
+		if status == model.DevStatusRejected {
+			reason = revocation.ReasonRejected
+		}
+		err := d.deleteDeviceTokens(ctx, aset.DeviceId, reason)
 		if err != nil && err != store.ErrTokenNotFound {
 			return errors.Wrap(err, "db delete device token error")
 		}
+
+		if status == model.DevStatusRejected {
+			d.issueOffboardingToken(ctx, aset, model.OffboardingReasonRejected)
+		}
 	}
 
 	// if accepting an auth set
 	if status == model.DevStatusAccepted {
-		// reject all accepted auth sets for this device first
+		// reject the auth sets superseded by this one first
+		filter, err := d.supersededAuthSets(ctx, device_id)
+		if err != nil {
+			return err
+		}
 		if err := d.db.UpdateAuthSet(ctx,
-			bson.M{
-				model.AuthSetKeyDeviceId: device_id,
-				"$or": []bson.M{
-					bson.M{model.AuthSetKeyStatus: model.DevStatusAccepted},
-					bson.M{model.AuthSetKeyStatus: model.DevStatusPreauth},
-				},
-			},
+			filter,
 			model.AuthSetUpdate{
 				Status: model.DevStatusRejected,
 			}); err != nil && err != store.ErrAuthSetNotFound {
@@ -735,18 +1086,11 @@ func (d *DevAuth) PreauthorizeDevice(ctx context.Context, req *model.PreAuthReq)
 	// this is the only safeguard against id data conflict - we won't try to handle it
 	// additionally on inserting the auth set (can't add an id data index on auth set - would prevent key rotation)
 
-	// FIXME: tenant_token is "" on purpose, will be removed
-	dev := model.NewDevice(req.DeviceId, req.IdData, req.PubKey)
-	dev.Status = model.DevStatusPreauth
-
-	idDataStruct, idDataSha256, err := parseIdData(req.IdData)
+	dev, authset, err := newPreauthorizedDevice(req)
 	if err != nil {
 		return MakeErrDevAuthBadRequest(err)
 	}
 
-	dev.IdDataStruct = idDataStruct
-	dev.IdDataSha256 = idDataSha256
-
 	err = d.db.AddDevice(ctx, *dev)
 	switch err {
 	case nil:
@@ -757,27 +1101,48 @@ func (d *DevAuth) PreauthorizeDevice(ctx context.Context, req *model.PreAuthReq)
 		return errors.Wrap(err, "failed to add device")
 	}
 
+	err = d.db.AddAuthSet(ctx, *authset)
+	switch err {
+	case nil:
+		d.recordStatusChange(ctx, dev.Id, "", dev.Status)
+		return nil
+	case store.ErrObjectExists:
+		return ErrDeviceExists
+	default:
+		return errors.Wrap(err, "failed to add auth set")
+	}
+}
+
+// newPreauthorizedDevice makes the device and auth set of a preauthorization
+// request
+func newPreauthorizedDevice(req *model.PreAuthReq) (*model.Device, *model.AuthSet, error) {
+	// FIXME: tenant_token is "" on purpose, will be removed
+	dev := model.NewDevice(req.DeviceId, req.IdData, req.PubKey)
+	dev.KeyType = utils.PubKeyType(req.PubKey)
+	dev.Status = model.DevStatusPreauth
+
+	idDataStruct, idDataSha256, err := parseIdData(req.IdData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dev.IdDataStruct = idDataStruct
+	dev.IdDataSha256 = idDataSha256
+
 	// record authentication request
-	authset := model.AuthSet{
+	authset := &model.AuthSet{
 		Id:           req.AuthSetId,
 		IdData:       req.IdData,
 		IdDataStruct: idDataStruct,
 		IdDataSha256: idDataSha256,
 		PubKey:       req.PubKey,
+		KeyType:      dev.KeyType,
 		DeviceId:     req.DeviceId,
 		Status:       model.DevStatusPreauth,
 		Timestamp:    uto.TimePtr(time.Now()),
 	}
 
-	err = d.db.AddAuthSet(ctx, authset)
-	switch err {
-	case nil:
-		return nil
-	case store.ErrObjectExists:
-		return ErrDeviceExists
-	default:
-		return errors.Wrap(err, "failed to add auth set")
-	}
+	return dev, authset, nil
 }
 
 func (*DevAuth) GetDeviceToken(ctx context.Context, dev_id string) (*model.Token, error) {
@@ -790,7 +1155,37 @@ func (d *DevAuth) RevokeToken(ctx context.Context, token_id string) error {
 
 	l.Warnf("Revoke token with jti: %s", token_id)
 
-	return d.db.DeleteToken(ctx, token_id)
+	if err := d.db.DeleteToken(ctx, token_id); err != nil {
+		return err
+	}
+
+	d.publishRevocation(ctx, revocation.Event{
+		Kind:    revocation.KindTokenRevoked,
+		TokenId: token_id,
+	})
+	return nil
+}
+
+// RevokeDeviceTokens revokes all tokens of a device, refresh tokens
+// included; returns store.ErrDevNotFound if there's no such device
+func (d *DevAuth) RevokeDeviceTokens(ctx context.Context, dev_id string) error {
+
+	l := log.FromContext(ctx)
+
+	if _, err := d.db.GetDeviceById(ctx, dev_id); err != nil {
+		if err == store.ErrDevNotFound {
+			return err
+		}
+		return errors.Wrap(err, "failed to get device")
+	}
+
+	l.Warnf("Revoke tokens of device: %s", dev_id)
+
+	tenant := ""
+	if ident := identity.FromContext(ctx); ident != nil {
+		tenant = ident.Tenant
+	}
+	return d.DeleteTokens(ctx, tenant, dev_id)
 }
 
 func verifyTenantClaim(ctx context.Context, verifyTenant bool, tenant string) error {
@@ -810,38 +1205,91 @@ func verifyTenantClaim(ctx context.Context, verifyTenant bool, tenant string) er
 	return nil
 }
 
+// GetJWKS returns the public keys device tokens can be verified with, the
+// signing key first, and the version of the set
+func (d *DevAuth) GetJWKS(ctx context.Context) (*jwt.JWKS, error) {
+	jwks := &jwt.JWKS{
+		Keys: []jwt.JWK{},
+	}
+	if ks, ok := d.jwt.(jwt.KeySet); ok {
+		jwks.Keys = append(jwks.Keys, ks.JWKS()...)
+	}
+	jwks.Version = jwt.KeySetVersion(jwks.Keys)
+	return jwks, nil
+}
+
 func (d *DevAuth) VerifyToken(ctx context.Context, raw string) error {
+	_, _, err := d.verifyToken(ctx, raw, true)
+	return err
+}
 
-	l := log.FromContext(ctx)
+// verifyToken verifies the token and returns its database record and auth
+// set, also along with ErrTokenExpiryGrace. If checkScope is set, the token's scope is checked
+// against the original URI of the request; otherwise, scopes are not
+// checked and offboarding tokens are rejected.
+func (d *DevAuth) verifyToken(ctx context.Context, raw string, checkScope bool) (*model.Token, *model.AuthSet, error) {
 
-	token := &jwt.Token{}
+	l := log.FromContext(ctx)
 
-	err := token.UnmarshalJWT([]byte(raw), d.jwt.FromJWT)
-	jti := token.Claims.ID
+	token, err := d.jwt.FromJWT(raw)
+	jti := ""
+	if token != nil {
+		jti = token.Claims.ID
+	}
+	// tokens expired within the grace period are still verified, and
+	// accepted with ErrTokenExpiryGrace
+	var graceErr error
+	if err == jwt.ErrTokenExpired && token != nil &&
+		d.withinExpiryGrace(time.Unix(token.Claims.ExpiresAt, 0)) {
+		l.Warnf("Token %s expired, within grace period", jti)
+		graceErr = ErrTokenExpiryGrace
+		err = nil
+	}
 	if err != nil {
 		if err == jwt.ErrTokenExpired && jti != "" {
 			l.Errorf("Token %s expired: %v", jti, err)
-			err := d.db.DeleteToken(ctx, jti)
+			err := d.db.DeleteExpiredToken(ctx, jti)
 			if err == store.ErrTokenNotFound {
 				l.Errorf("Token %s not found", jti)
-				return err
+				return nil, nil, err
 			}
 			if err != nil {
-				return errors.Wrapf(err, "Cannot delete token with jti: %s : %s", jti, err)
+				return nil, nil, errors.Wrapf(err, "Cannot delete token with jti: %s : %s", jti, err)
 			}
-			return jwt.ErrTokenExpired
+			return nil, nil, jwt.ErrTokenExpired
 		}
 		l.Errorf("Token %s invalid: %v", jti, err)
-		return jwt.ErrTokenInvalid
+		return nil, nil, jwt.ErrTokenInvalid
 	}
 
 	if token.Claims.Device != true {
 		l.Errorf("not a device token")
-		return jwt.ErrTokenInvalid
+		return nil, nil, jwt.ErrTokenInvalid
 	}
 
 	if err := verifyTenantClaim(ctx, d.verifyTenant, token.Claims.Tenant); err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	if err := d.verifyTokenIssuer(ctx, &token.Claims); err != nil {
+		return nil, nil, err
+	}
+
+	if token.Claims.Scope == jwt.ScopeOffboarding {
+		if !checkScope {
+			l.Errorf("offboarding token %s used out of scope", jti)
+			return nil, nil, jwt.ErrTokenInvalid
+		}
+		if err := d.verifyOffboardingToken(ctx, token); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, graceErr
+	}
+
+	if checkScope {
+		if err := d.verifyTokenScope(ctx, &token.Claims); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	// check if token is in the system
@@ -849,9 +1297,24 @@ func (d *DevAuth) VerifyToken(ctx context.Context, raw string) error {
 	if err != nil {
 		if err == store.ErrTokenNotFound {
 			l.Errorf("Token %s not found", jti)
-			return err
+			return nil, nil, err
+		}
+		return nil, nil, errors.Wrapf(err, "Cannot get token with id: %s from database: %s", jti, err)
+	}
+
+	if tok.ExpiresAt != nil && !time.Now().Before(*tok.ExpiresAt) {
+		if d.withinExpiryGrace(*tok.ExpiresAt) {
+			l.Warnf("Token %s expired, within grace period: not used since %v",
+				jti, tok.ExpiresAt)
+			graceErr = ErrTokenExpiryGrace
+		} else {
+			l.Errorf("Token %s expired: not used since %v", jti, tok.ExpiresAt)
+			err := d.db.DeleteExpiredToken(ctx, jti)
+			if err != nil && err != store.ErrTokenNotFound {
+				return nil, nil, errors.Wrapf(err, "Cannot delete token with jti: %s : %s", jti, err)
+			}
+			return nil, nil, jwt.ErrTokenExpired
 		}
-		return errors.Wrapf(err, "Cannot get token with id: %s from database: %s", jti, err)
 	}
 
 	auth, err := d.db.GetAuthSetById(ctx, tok.AuthSetId)
@@ -859,27 +1322,68 @@ func (d *DevAuth) VerifyToken(ctx context.Context, raw string) error {
 		if err == store.ErrTokenNotFound {
 			l.Errorf("Token %s auth set %s not found",
 				jti, tok.AuthSetId)
-			return err
+			return nil, nil, err
 		}
-		return err
+		return nil, nil, err
 	}
 
 	if auth.Status != model.DevStatusAccepted {
-		return jwt.ErrTokenInvalid
+		return nil, nil, jwt.ErrTokenInvalid
 	}
 
 	// reject authentication for device that is in the process of
 	// decommissioning
 	dev, err := d.db.GetDeviceById(ctx, auth.DeviceId)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	if dev.Decommissioning {
 		l.Errorf("Token %s rejected, device %s is being decommissioned", jti, auth.DeviceId)
-		return jwt.ErrTokenInvalid
+		return nil, nil, jwt.ErrTokenInvalid
 	}
 
-	return nil
+	// expired tokens are not extended, the device has to authenticate
+	// again
+	if tok.ExpiresAt != nil && graceErr == nil {
+		if err := d.extendTokenExpiration(ctx, tok, token.Claims.ExpiresAt); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	d.recordTokenUsage(ctx, tok)
+	d.recordCheckin(ctx, tok.DevId)
+
+	return tok, auth, graceErr
+}
+
+// extendTokenExpiration extends the sliding expiration time of a verified
+// token, up to its max lifetime ('exp' claim); to spare the database a write
+// on each verification, only once half of the expiration time has passed
+func (d *DevAuth) extendTokenExpiration(ctx context.Context, tok *model.Token, maxExp int64) error {
+	expiration, err := d.tokenExpiration(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	window := time.Duration(expiration) * time.Second
+	if tok.ExpiresAt.Sub(now) > window/2 {
+		return nil
+	}
+
+	expiresAt := now.Add(window)
+	if max := time.Unix(maxExp, 0); expiresAt.After(max) {
+		expiresAt = max
+	}
+	if !expiresAt.After(*tok.ExpiresAt) {
+		return nil
+	}
+
+	err = d.db.UpdateTokenExpiration(ctx, tok.Id, expiresAt)
+	if err != nil && err != store.ErrTokenNotFound {
+		return errors.Wrap(err, "failed to extend token expiration")
+	}
+	return err
 }
 
 func (d *DevAuth) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
@@ -889,8 +1393,13 @@ func (d *DevAuth) GetLimit(ctx context.Context, name string) (*model.Limit, erro
 	case nil:
 		return lim, nil
 	case store.ErrLimitNotFound:
-		if name == model.LimitMaxDeviceCount {
+		switch name {
+		case model.LimitMaxDeviceCount:
 			return &model.Limit{Name: name, Value: d.config.MaxDevicesLimitDefault}, nil
+		case model.LimitOffboardingGracePeriod:
+			return &model.Limit{Name: name, Value: d.config.OffboardingGracePeriodDefault}, nil
+		case model.LimitTokenExpiration:
+			return &model.Limit{Name: name, Value: uint64(d.config.ExpirationTime)}, nil
 		}
 		return &model.Limit{Name: name, Value: 0}, nil
 	default:
@@ -898,6 +1407,24 @@ func (d *DevAuth) GetLimit(ctx context.Context, name string) (*model.Limit, erro
 	}
 }
 
+// tokenExpiration returns the lifetime of device tokens, in seconds; tenants
+// may have their own, see model.LimitTokenExpiration
+func (d *DevAuth) tokenExpiration(ctx context.Context) (int64, error) {
+	ident := identity.FromContext(ctx)
+	if ident == nil || ident.Tenant == "" {
+		return d.config.ExpirationTime, nil
+	}
+
+	lim, err := d.GetLimit(ctx, model.LimitTokenExpiration)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get token expiration")
+	}
+	if lim.Value == 0 {
+		return d.config.ExpirationTime, nil
+	}
+	return int64(lim.Value), nil
+}
+
 func (d *DevAuth) GetTenantLimit(ctx context.Context, name, tenant_id string) (*model.Limit, error) {
 	ctx = identity.WithContext(ctx, &identity.Identity{
 		Tenant: tenant_id,
@@ -906,6 +1433,25 @@ func (d *DevAuth) GetTenantLimit(ctx context.Context, name, tenant_id string) (*
 	return d.GetLimit(ctx, name)
 }
 
+// GetDeviceLimitUsage returns the tenant's accepted device limit along
+// with the number of devices counting towards it
+func (d *DevAuth) GetDeviceLimitUsage(ctx context.Context) (*model.DeviceLimitUsage, error) {
+	limit, err := d.GetLimit(ctx, model.LimitMaxDeviceCount)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get current device limit")
+	}
+
+	accepted, err := d.db.GetDevCountByStatus(ctx, model.DevStatusAccepted)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get current device count")
+	}
+
+	return &model.DeviceLimitUsage{
+		Limit: limit.Value,
+		Usage: accepted,
+	}, nil
+}
+
 // WithTenantVerification will force verification of tenant token with tenant
 // administrator when processing device authentication requests. Returns an
 // updated devauth.
@@ -915,6 +1461,53 @@ func (d *DevAuth) WithTenantVerification(c tenant.ClientRunner) *DevAuth {
 	return d
 }
 
+// WithAuthReqHooks will make the auth request processing consult the given
+// hooks, which can veto or annotate device enrollment. Returns an updated
+// devauth.
+func (d *DevAuth) WithAuthReqHooks(hooks ...AuthReqHook) *DevAuth {
+	d.authReqHooks = append(d.authReqHooks, hooks...)
+	return d
+}
+
+// WithTPMAttestation will make devauth verify TPM attestations submitted
+// with auth requests, and record the result with the auth set. Returns an
+// updated devauth.
+func (d *DevAuth) WithTPMAttestation(v TPMVerifier) *DevAuth {
+	d.tpmVerifier = v
+	return d
+}
+
+// WithNotifier will make devauth send operator alerts, e.g. when the device
+// limit is reached. Returns an updated devauth.
+func (d *DevAuth) WithNotifier(n notify.Notifier) *DevAuth {
+	d.notifier = n
+	return d
+}
+
+// notify sends an operator alert for the tenant in context, if configured
+func (d *DevAuth) notify(ctx context.Context, n notify.Notification) {
+	if d.notifier == nil {
+		return
+	}
+
+	if ident := identity.FromContext(ctx); ident != nil {
+		n.TenantId = ident.Tenant
+	}
+	d.notifier.Notify(ctx, n)
+}
+
+func (d *DevAuth) notifyLimitReached(ctx context.Context, devId string) {
+	d.notify(ctx, notify.Notification{
+		Kind:    notify.KindLimitReached,
+		Subject: "Device limit reached",
+		Message: "A device could not be accepted, the maximum number " +
+			"of accepted devices has been reached.",
+		Fields: map[string]string{
+			"device_id": devId,
+		},
+	})
+}
+
 func (d *DevAuth) SetTenantLimit(ctx context.Context, tenant_id string, limit model.Limit) error {
 	l := log.FromContext(ctx)
 
@@ -937,6 +1530,17 @@ func (d *DevAuth) GetDevCountByStatus(ctx context.Context, status string) (int,
 	return d.db.GetDevCountByStatus(ctx, status)
 }
 
+// GetDevCounts returns the number of devices, in total and per status
+func (d *DevAuth) GetDevCounts(ctx context.Context) (*model.DeviceCounts, error) {
+	return d.db.GetDevCounts(ctx)
+}
+
+// CountDevices returns the number of devices the listing with the filter
+// has in total
+func (d *DevAuth) CountDevices(ctx context.Context, filter store.DeviceFilter) (int, error) {
+	return d.db.CountDevices(ctx, filter)
+}
+
 // canAcceptDevice checks if model.LimitMaxDeviceCount will be exceeded
 func (d *DevAuth) canAcceptDevice(ctx context.Context) (bool, error) {
 	limit, err := d.GetLimit(ctx, model.LimitMaxDeviceCount)
@@ -968,20 +1572,43 @@ func (d *DevAuth) DeleteTokens(ctx context.Context, tenant_id, device_id string)
 	var err error
 
 	if device_id != "" {
-		err = d.db.DeleteTokenByDevId(ctx, device_id)
+		err = d.deleteDeviceTokens(ctx, device_id, revocation.ReasonRevoked)
 	} else {
 		err = d.db.DeleteTokens(ctx)
+		if err == nil {
+			d.publishRevocation(ctx, revocation.Event{
+				Kind: revocation.KindTenantRevoked,
+			})
+		}
 	}
 
 	if err != nil && err != store.ErrTokenNotFound {
 		return errors.Wrapf(err, "failed to delete tokens for tenant: %v, device id: %v", tenant_id, device_id)
 	}
 
+	if err := d.db.DeleteRefreshTokens(ctx, tenant_id, device_id); err != nil {
+		return errors.Wrapf(err, "failed to delete refresh tokens for tenant: %v, device id: %v", tenant_id, device_id)
+	}
+
 	return nil
 }
 
+// GetRevokedTokens lists the tokens of the tenant revoked since the given
+// time, for offline token verification to sync with
+func (d *DevAuth) GetRevokedTokens(ctx context.Context, tenant_id string, since time.Time, skip, limit uint) ([]model.RevokedToken, error) {
+	ctx = identity.WithContext(ctx, &identity.Identity{
+		Tenant: tenant_id,
+	})
+
+	toks, err := d.db.GetRevokedTokens(ctx, since, skip, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list revoked tokens")
+	}
+	return toks, nil
+}
+
 func (d *DevAuth) ProvisionTenant(ctx context.Context, tenant_id string) error {
-	tenantCtx := identity.WithContext(context.Background(), &identity.Identity{
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
 		Tenant: tenant_id,
 	})
 
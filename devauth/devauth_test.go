@@ -15,10 +15,12 @@ package devauth
 
 import (
 	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/globalsign/mgo/bson"
@@ -27,12 +29,15 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	mauthhook "github.com/mendersoftware/deviceauth/client/authhook/mocks"
 	"github.com/mendersoftware/deviceauth/client/orchestrator"
 	morchestrator "github.com/mendersoftware/deviceauth/client/orchestrator/mocks"
 	mtenant "github.com/mendersoftware/deviceauth/client/tenant/mocks"
 	"github.com/mendersoftware/deviceauth/jwt"
 	mjwt "github.com/mendersoftware/deviceauth/jwt/mocks"
 	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/notify"
+	mnotify "github.com/mendersoftware/deviceauth/notify/mocks"
 	"github.com/mendersoftware/deviceauth/store"
 	mstore "github.com/mendersoftware/deviceauth/store/mocks"
 	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
@@ -68,9 +73,10 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 
 		devStatus string
 
-		// key of returned device
-		getDevByIdKey string
-		getDevByIdErr error
+		// key and status of returned device
+		getDevByIdKey    string
+		getDevByIdStatus string
+		getDevByIdErr    error
 
 		//id of returned device
 		getDevByKeyId string
@@ -83,6 +89,13 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 
 		tenantVerify          bool
 		tenantVerificationErr error
+		tenantSuspended       bool
+
+		spiffeTrustDomain string
+		spiffeID          string
+
+		claimsTemplate jwt.ClaimsTemplate
+		extraClaims    map[string]interface{}
 
 		res string
 		err error
@@ -127,6 +140,23 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 
 			err: ErrDevAuthUnauthorized,
 		},
+		{
+			//existing device, quarantined, no token even though the
+			//auth set is accepted
+			desc: "known, quarantined",
+
+			inReq: req,
+
+			addDeviceErr:  store.ErrObjectExists,
+			addAuthSetErr: store.ErrObjectExists,
+
+			devStatus:        model.DevStatusAccepted,
+			getDevByIdKey:    pubKey,
+			getDevByIdStatus: model.DevStatusQuarantined,
+			getDevByKeyId:    devId,
+
+			err: ErrDeviceQuarantined,
+		},
 		{
 			//existing, pending device
 			desc: "known, pending",
@@ -203,6 +233,28 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 			tenantVerify:          true,
 			tenantVerificationErr: errors.New("something something failed"),
 		},
+		{
+			//tenant suspended in deviceauth, tenant token is valid
+			desc: "known, accepted, tenant suspended",
+
+			inReq: model.AuthReq{
+				IdData:      idData,
+				TenantToken: "fake.eyJzdWIiOiJib2d1c2RldmljZSIsIm1lbmRlci50ZW5hbnQiOiJmb29iYXIifQ.fake",
+				PubKey:      pubKey,
+			},
+
+			addDeviceErr:  store.ErrObjectExists,
+			addAuthSetErr: store.ErrObjectExists,
+
+			devStatus:     model.DevStatusAccepted,
+			getDevByIdKey: pubKey,
+			getDevByKeyId: devId,
+
+			tenantVerify:    true,
+			tenantSuspended: true,
+
+			err: ErrTenantSuspended,
+		},
 		{
 			//new device - tenant token required but not provided
 			desc: "new device, missing but required tenant token",
@@ -292,6 +344,89 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 
 			devStatus: model.DevStatusAccepted,
 
+			res: "dummytoken",
+		},
+		{
+			desc: "known, accepted, give out token with SPIFFE ID",
+
+			inReq: req,
+
+			addDeviceErr:  store.ErrObjectExists,
+			addAuthSetErr: store.ErrObjectExists,
+
+			devStatus:     model.DevStatusAccepted,
+			getDevByIdKey: pubKey,
+			getDevByKeyId: devId,
+
+			spiffeTrustDomain: "mender.io",
+			spiffeID:          "spiffe://mender.io/device/dummy_devid",
+
+			res: "dummytoken",
+		},
+		{
+			desc: "known, accepted, tenant, give out token with tenant SPIFFE ID",
+
+			inReq: model.AuthReq{
+				IdData: idData,
+				// token with the following claims:
+				//   {
+				//      "sub": "bogusdevice",
+				//      "mender.tenant": "foobar"
+				//   }
+				TenantToken: "fake.eyJzdWIiOiJib2d1c2RldmljZSIsIm1lbmRlci50ZW5hbnQiOiJmb29iYXIifQ.fake",
+				PubKey:      pubKey,
+			},
+
+			addDeviceErr:  store.ErrObjectExists,
+			addAuthSetErr: store.ErrObjectExists,
+
+			getDevByIdKey: pubKey,
+			getDevByKeyId: devId,
+
+			tenantVerify: true,
+
+			devStatus: model.DevStatusAccepted,
+
+			spiffeTrustDomain: "mender.io",
+			spiffeID:          "spiffe://mender.io/tenant/foobar/device/dummy_devid",
+
+			res: "dummytoken",
+		},
+		{
+			desc: "known, accepted, tenant, give out token with templated claims",
+
+			inReq: model.AuthReq{
+				IdData: idData,
+				// token with the following claims:
+				//   {
+				//      "sub": "bogusdevice",
+				//      "mender.tenant": "foobar"
+				//   }
+				TenantToken: "fake.eyJzdWIiOiJib2d1c2RldmljZSIsIm1lbmRlci50ZW5hbnQiOiJmb29iYXIifQ.fake",
+				PubKey:      pubKey,
+			},
+
+			addDeviceErr:  store.ErrObjectExists,
+			addAuthSetErr: store.ErrObjectExists,
+
+			getDevByIdKey: pubKey,
+			getDevByKeyId: devId,
+
+			tenantVerify: true,
+
+			devStatus: model.DevStatusAccepted,
+
+			claimsTemplate: jwt.ClaimsTemplate{
+				"region": "eu-1",
+				"ref":    "{{tenant}}/{{device_id}}",
+				"state":  "{{status}}",
+			},
+			extraClaims: map[string]interface{}{
+				"region": "eu-1",
+				"ref":    "foobar/dummy_devid",
+				"state":  "accepted",
+			},
+
 			res: "dummytoken",
 		},
 	}
@@ -318,6 +453,10 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 			}
 
 			db := mstore.DataStore{}
+			db.On("IsTenantSuspended", ctxMatcher).
+				Return(tc.tenantSuspended, nil)
+			db.On("IncAuthRequestCount", ctxMatcher,
+				mock.AnythingOfType("time.Time")).Return(nil)
 			db.On("AddDevice",
 				ctxMatcher,
 				mock.MatchedBy(
@@ -334,6 +473,7 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 							PubKey:       tc.getDevByIdKey,
 							IdDataSha256: idDataHash,
 							Id:           devId,
+							Status:       tc.getDevByIdStatus,
 						}
 					}
 					return nil
@@ -345,6 +485,12 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 					func(m model.AuthSet) bool {
 						return m.DeviceId == devId
 					})).Return(tc.addAuthSetErr)
+			db.On("GetAuthSetsByPubKey",
+				ctxMatcher,
+				pubKey).Return([]model.AuthSet{}, nil)
+			db.On("GetAuthSetsForDevice",
+				ctxMatcher,
+				mock.AnythingOfType("string")).Return([]model.AuthSet{}, nil)
 			db.On("UpdateAuthSet",
 				ctxMatcher,
 				mock.MatchedBy(
@@ -371,13 +517,20 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 
 			db.On("AddToken",
 				ctxMatcher,
-				mock.AnythingOfType("model.Token")).Return(nil)
+				mock.MatchedBy(func(tok model.Token) bool {
+					// recorded for purging once expired
+					return tok.Exp != nil
+				})).Return(nil)
+			db.On("GetLimit", ctxMatcher, model.LimitTokenExpiration).
+				Return(nil, store.ErrLimitNotFound)
 			db.On("GetDeviceStatus", ctxMatcher,
 				mock.AnythingOfType("string")).Return(
 				"pending", nil)
-			db.On("UpdateDevice", ctxMatcher,
-				mock.AnythingOfType("model.Device"),
-				mock.AnythingOfType("model.DeviceUpdate")).Return(nil)
+			db.On("SetDeviceStatus", ctxMatcher,
+				mock.AnythingOfType("string"),
+				mock.AnythingOfType("string")).Return("", nil)
+			db.On("AddDeviceStatusChange", ctxMatcher,
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
 
 			jwth := mjwt.Handler{}
 			jwth.On("ToJWT",
@@ -386,11 +539,16 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 					return assert.NotNil(t, jt) &&
 						assert.Equal(t, devId, jt.Claims.Subject) &&
 						(tc.tenantVerify == false ||
-							assert.Equal(t, "foobar", jt.Claims.Tenant))
+							assert.Equal(t, "foobar", jt.Claims.Tenant)) &&
+						assert.Equal(t, tc.spiffeID, jt.Claims.SpiffeID) &&
+						assert.Equal(t, tc.extraClaims, jt.Claims.Extra)
 				})).
 				Return("dummytoken", nil)
 
-			devauth := NewDevAuth(&db, nil, &jwth, Config{})
+			devauth := NewDevAuth(&db, nil, &jwth, Config{
+				SpiffeTrustDomain: tc.spiffeTrustDomain,
+				ClaimsTemplate:    tc.claimsTemplate,
+			})
 
 			if tc.tenantVerify {
 				ct := mtenant.ClientRunner{}
@@ -415,6 +573,194 @@ func TestDevAuthSubmitAuthRequest(t *testing.T) {
 	}
 }
 
+func TestDevAuthSubmitAuthRequestHooks(t *testing.T) {
+	t.Parallel()
+
+	pubKey := "dummy_pubkey"
+	idData := "{\"mac\":\"00:00:00:01\"}"
+	devId := "dummy_devid"
+	authId := "dummy_aid"
+
+	_, idDataHash, err := parseIdData(idData)
+	assert.NoError(t, err)
+
+	req := model.AuthReq{
+		IdData: idData,
+		PubKey: pubKey,
+	}
+
+	testCases := []struct {
+		desc string
+
+		hookRes []*model.AuthReqCheck
+		hookErr error
+
+		annotations map[string]interface{}
+
+		res string
+		err error
+	}{
+		{
+			desc: "no annotations",
+
+			hookRes: []*model.AuthReqCheck{{}},
+
+			res: "dummytoken",
+		},
+		{
+			desc: "annotations merged",
+
+			hookRes: []*model.AuthReqCheck{
+				{
+					Annotations: map[string]interface{}{
+						"fw":  "1.0",
+						"foo": "bar",
+					},
+				},
+				{
+					Annotations: map[string]interface{}{
+						"fw": "2.0",
+					},
+				},
+			},
+
+			annotations: map[string]interface{}{
+				"fw":  "2.0",
+				"foo": "bar",
+			},
+
+			res: "dummytoken",
+		},
+		{
+			desc: "rejected",
+
+			hookRes: []*model.AuthReqCheck{
+				{},
+				{
+					Reject: true,
+					Reason: "unknown serial",
+				},
+			},
+
+			err: errors.New("dev auth: unauthorized: auth request rejected: unknown serial"),
+		},
+		{
+			desc: "hook error",
+
+			hookRes: []*model.AuthReqCheck{nil},
+			hookErr: errors.New("connection refused"),
+
+			err: errors.New("auth request check failed: connection refused"),
+		},
+	}
+
+	for tcidx := range testCases {
+		tc := testCases[tcidx]
+		t.Run(fmt.Sprintf("tc: %s", tc.desc), func(t *testing.T) {
+			t.Parallel()
+
+			ctxMatcher := mtesting.ContextMatcher()
+
+			db := mstore.DataStore{}
+			db.On("IncAuthRequestCount", ctxMatcher,
+				mock.AnythingOfType("time.Time")).Return(nil)
+			db.On("AddDevice",
+				ctxMatcher,
+				mock.AnythingOfType("model.Device")).Return(store.ErrObjectExists)
+			db.On("GetDeviceByIdentityDataHash",
+				ctxMatcher,
+				idDataHash).Return(
+				&model.Device{
+					PubKey:       pubKey,
+					IdDataSha256: idDataHash,
+					Id:           devId,
+				}, nil)
+			db.On("AddAuthSet",
+				ctxMatcher,
+				mock.AnythingOfType("model.AuthSet")).Return(store.ErrObjectExists)
+			db.On("GetAuthSetByIdDataHashKey",
+				ctxMatcher,
+				idDataHash, pubKey).Return(
+				&model.AuthSet{
+					Id:           authId,
+					DeviceId:     devId,
+					IdDataSha256: idDataHash,
+					PubKey:       pubKey,
+					Status:       model.DevStatusAccepted,
+				}, nil)
+			db.On("UpdateAuthSet",
+				ctxMatcher,
+				mock.AnythingOfType("model.AuthSet"),
+				model.AuthSetUpdate{
+					Annotations: tc.annotations,
+				}).Return(nil)
+			db.On("GetDeviceStatus", ctxMatcher,
+				devId).Return(model.DevStatusAccepted, nil)
+			db.On("SetDeviceStatus", ctxMatcher,
+				mock.AnythingOfType("string"),
+				mock.AnythingOfType("string")).Return("", nil)
+			db.On("AddDeviceStatusChange", ctxMatcher,
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
+			db.On("AddToken",
+				ctxMatcher,
+				mock.AnythingOfType("model.Token")).Return(nil)
+
+			jwth := mjwt.Handler{}
+			jwth.On("ToJWT",
+				mock.AnythingOfType("*jwt.Token")).
+				Return("dummytoken", nil)
+
+			notifier := mnotify.Notifier{}
+			notifier.On("Notify", ctxMatcher,
+				mock.MatchedBy(func(n notify.Notification) bool {
+					return n.Kind == notify.KindSecurityAlert &&
+						n.Fields["id_data"] == idData
+				})).Return()
+
+			devauth := NewDevAuth(&db, nil, &jwth, Config{}).
+				WithNotifier(&notifier)
+
+			for _, hr := range tc.hookRes {
+				hook := &mauthhook.ClientRunner{}
+				hook.On("CheckAuthRequest",
+					ctxMatcher,
+					&req).Return(hr, tc.hookErr)
+				devauth = devauth.WithAuthReqHooks(hook)
+			}
+
+			res, err := devauth.SubmitAuthRequest(context.Background(), &req)
+
+			assert.Equal(t, tc.res, res)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				db.AssertNotCalled(t, "AddDevice", ctxMatcher,
+					mock.AnythingOfType("model.Device"))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tc.desc == "rejected" {
+				notifier.AssertExpectations(t)
+			} else {
+				notifier.AssertNotCalled(t, "Notify", ctxMatcher,
+					mock.AnythingOfType("notify.Notification"))
+			}
+
+			if len(tc.annotations) > 0 {
+				db.AssertCalled(t, "UpdateAuthSet", ctxMatcher,
+					mock.AnythingOfType("model.AuthSet"),
+					model.AuthSetUpdate{
+						Annotations: tc.annotations,
+					})
+			} else {
+				db.AssertNotCalled(t, "UpdateAuthSet", ctxMatcher,
+					mock.AnythingOfType("model.AuthSet"),
+					mock.AnythingOfType("model.AuthSetUpdate"))
+			}
+		})
+	}
+}
+
 // still a Submit... test, but focuses on preauth
 func TestDevAuthSubmitAuthRequestPreauth(t *testing.T) {
 	idData := "{\"mac\":\"00:00:00:01\"}"
@@ -574,6 +920,8 @@ func TestDevAuthSubmitAuthRequestPreauth(t *testing.T) {
 
 			// setup mocks
 			db := mstore.DataStore{}
+			db.On("IncAuthRequestCount", ctx,
+				mock.AnythingOfType("time.Time")).Return(nil)
 
 			// get the auth set to check if preauthorized
 			db.On("GetAuthSetByIdDataHashKey",
@@ -619,16 +967,16 @@ func TestDevAuthSubmitAuthRequestPreauth(t *testing.T) {
 			).Return(nil)
 
 			// at the end of processing, updates the device status to 'accepted'
-			db.On("UpdateDevice",
+			db.On("SetDeviceStatus",
+				ctx, dummyDevId, model.DevStatusAccepted,
+			).Return(model.DevStatusPreauth, nil)
+			db.On("AddDeviceStatusChange",
 				ctx,
 				mock.MatchedBy(
-					func(m model.Device) bool {
-						return m.Id == dummyDevId
-
-					}),
-				mock.MatchedBy(
-					func(u model.DeviceUpdate) bool {
-						return u.Status == model.DevStatusAccepted
+					func(c model.DeviceStatusChange) bool {
+						return c.DeviceId == dummyDevId &&
+							c.From == model.DevStatusPreauth &&
+							c.To == model.DevStatusAccepted
 					}),
 			).Return(nil)
 
@@ -653,8 +1001,21 @@ func TestDevAuthSubmitAuthRequestPreauth(t *testing.T) {
 				mock.AnythingOfType("orchestrator.ProvisionDeviceReq")).
 				Return(tc.coSubmitProvisionDeviceJobErr)
 
+			notifier := mnotify.Notifier{}
+			notifier.On("Notify", ctx,
+				notify.Notification{
+					Kind:    notify.KindLimitReached,
+					Subject: "Device limit reached",
+					Message: "A device could not be accepted, the maximum number " +
+						"of accepted devices has been reached.",
+					Fields: map[string]string{
+						"device_id": dummyDevId,
+					},
+				}).Return()
+
 			// setup devauth
-			devauth := NewDevAuth(&db, &co, &jwth, Config{})
+			devauth := NewDevAuth(&db, &co, &jwth, Config{}).
+				WithNotifier(&notifier)
 
 			// test
 			res, err := devauth.SubmitAuthRequest(ctx, &inReq)
@@ -666,6 +1027,13 @@ func TestDevAuthSubmitAuthRequestPreauth(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 			}
+
+			if tc.err == ErrMaxDeviceCountReached {
+				notifier.AssertExpectations(t)
+			} else {
+				notifier.AssertNotCalled(t, "Notify", ctx,
+					mock.AnythingOfType("notify.Notification"))
+			}
 		})
 	}
 }
@@ -776,6 +1144,15 @@ func TestDevAuthPreauthorizeDevice(t *testing.T) {
 							(m.PubKey == tc.req.PubKey)
 					})).Return(tc.addAuthSetErr)
 
+			db.On("AddDeviceStatusChange",
+				ctxMatcher,
+				mock.MatchedBy(
+					func(c model.DeviceStatusChange) bool {
+						return c.DeviceId == tc.req.DeviceId &&
+							c.From == "" &&
+							c.To == model.DevStatusPreauth
+					})).Return(nil)
+
 			devauth := NewDevAuth(&db, nil, nil, Config{})
 			err := devauth.PreauthorizeDevice(context.Background(), tc.req)
 
@@ -981,6 +1358,19 @@ func TestDevAuthAcceptDevice(t *testing.T) {
 			dbGetDeviceByIdErr: errors.New("Get device failed"),
 			outErr:             "Get device failed",
 		},
+		{
+			aset: &model.AuthSet{
+				Id:       "dummy_aid",
+				DeviceId: "dummy_devid",
+			},
+			dev: &model.Device{
+				Id:     "dummy_devid",
+				Status: model.DevStatusQuarantined,
+			},
+			dbLimit: &model.Limit{Value: 5},
+			dbCount: 4,
+			outErr:  ErrDeviceQuarantined.Error(),
+		},
 	}
 
 	for idx := range testCases {
@@ -997,9 +1387,11 @@ func TestDevAuthAcceptDevice(t *testing.T) {
 				context.Background(), model.DevStatusAccepted).Return(tc.dbCount, tc.dbCountErr)
 			db.On("GetDeviceById",
 				context.Background(), "dummy_devid").Return(tc.dev, tc.dbGetDeviceByIdErr)
-			db.On("UpdateDevice", context.Background(),
-				mock.AnythingOfType("model.Device"),
-				mock.AnythingOfType("model.DeviceUpdate")).Return(nil)
+			db.On("SetDeviceStatus", context.Background(),
+				mock.AnythingOfType("string"),
+				mock.AnythingOfType("string")).Return("", nil)
+			db.On("AddDeviceStatusChange", context.Background(),
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
 
 			if tc.aset != nil {
 				// for rejecting all auth sets
@@ -1096,9 +1488,11 @@ func TestDevAuthRejectDevice(t *testing.T) {
 			db.On("GetDeviceStatus", context.Background(),
 				"dummy_devid").Return(
 				"accpted", nil)
-			db.On("UpdateDevice", context.Background(),
-				mock.AnythingOfType("model.Device"),
-				mock.AnythingOfType("model.DeviceUpdate")).Return(nil)
+			db.On("SetDeviceStatus", context.Background(),
+				mock.AnythingOfType("string"),
+				mock.AnythingOfType("string")).Return("", nil)
+			db.On("AddDeviceStatusChange", context.Background(),
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
 
 			devauth := NewDevAuth(&db, nil, nil, Config{})
 			err := devauth.RejectDeviceAuth(context.Background(), "dummy_devid", "dummy_aid")
@@ -1171,9 +1565,11 @@ func TestDevAuthResetDevice(t *testing.T) {
 			db.On("GetDeviceStatus", context.Background(),
 				"dummy_devid").Return(
 				"accpted", nil)
-			db.On("UpdateDevice", context.Background(),
-				mock.AnythingOfType("model.Device"),
-				mock.AnythingOfType("model.DeviceUpdate")).Return(nil)
+			db.On("SetDeviceStatus", context.Background(),
+				mock.AnythingOfType("string"),
+				mock.AnythingOfType("string")).Return("", nil)
+			db.On("AddDeviceStatusChange", context.Background(),
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
 
 			devauth := NewDevAuth(&db, nil, nil, Config{})
 			err := devauth.ResetDeviceAuth(context.Background(), "dummy_devid", "dummy_aid")
@@ -1346,7 +1742,7 @@ func TestDevAuthVerifyToken(t *testing.T) {
 				}, tc.validateErr)
 
 			if tc.validateErr == jwt.ErrTokenExpired {
-				db.On("DeleteToken",
+				db.On("DeleteExpiredToken",
 					context.Background(),
 					tc.jwToken.Claims.ID).Return(nil)
 			}
@@ -1381,6 +1777,110 @@ func TestDevAuthVerifyToken(t *testing.T) {
 	}
 }
 
+func TestDevAuthVerifyTokenSlidingExpiration(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	testCases := map[string]struct {
+		maxExp    int64
+		expiresAt time.Time
+
+		dbUpdateErr error
+
+		outExpiresAt time.Time
+		outErr       string
+	}{
+		"ok, not extended yet": {
+			maxExp:    now.Unix() + 86400,
+			expiresAt: now.Add(3500 * time.Second),
+		},
+		"ok, extended": {
+			maxExp:       now.Unix() + 86400,
+			expiresAt:    now.Add(600 * time.Second),
+			outExpiresAt: now.Add(3600 * time.Second),
+		},
+		"ok, extended up to max lifetime": {
+			maxExp:       now.Unix() + 1200,
+			expiresAt:    now.Add(600 * time.Second),
+			outExpiresAt: time.Unix(now.Unix()+1200, 0),
+		},
+		"ok, at max lifetime": {
+			maxExp:    now.Unix() + 600,
+			expiresAt: time.Unix(now.Unix()+600, 0),
+		},
+		"error, expired": {
+			maxExp:    now.Unix() + 86400,
+			expiresAt: now.Add(-time.Second),
+			outErr:    jwt.ErrTokenExpired.Error(),
+		},
+		"error, db": {
+			maxExp:       now.Unix() + 86400,
+			expiresAt:    now.Add(600 * time.Second),
+			dbUpdateErr:  errors.New("db error"),
+			outExpiresAt: now.Add(3600 * time.Second),
+			outErr:       "failed to extend token expiration: db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			ja := &mjwt.Handler{}
+			ja.On("FromJWT", "token").Return(&jwt.Token{
+				Claims: jwt.Claims{
+					ID:        "jti",
+					Subject:   "foodev",
+					ExpiresAt: tc.maxExp,
+					Device:    true,
+				},
+			}, nil)
+
+			db := &mstore.DataStore{}
+			db.On("GetToken", ctx, "jti").Return(&model.Token{
+				Id:        "jti",
+				AuthSetId: "foo",
+				ExpiresAt: &tc.expiresAt,
+			}, nil)
+			if tc.outErr == jwt.ErrTokenExpired.Error() {
+				db.On("DeleteExpiredToken", ctx, "jti").Return(nil)
+			} else {
+				db.On("GetAuthSetById", ctx, "foo").Return(&model.AuthSet{
+					Id:       "foo",
+					Status:   model.DevStatusAccepted,
+					DeviceId: "foodev",
+				}, nil)
+				db.On("GetDeviceById", ctx, "foodev").
+					Return(&model.Device{Id: "foodev"}, nil)
+			}
+			if !tc.outExpiresAt.IsZero() {
+				db.On("UpdateTokenExpiration", ctx, "jti",
+					mock.MatchedBy(func(exp time.Time) bool {
+						// allow for the time passed since now
+						d := exp.Sub(tc.outExpiresAt)
+						return d >= 0 && d < time.Minute
+					})).Return(tc.dbUpdateErr)
+			}
+
+			devauth := NewDevAuth(db, nil, ja, Config{
+				ExpirationTime: 3600,
+				MaxLifetime:    86400,
+			})
+			err := devauth.VerifyToken(ctx, "token")
+			if tc.outErr != "" {
+				assert.EqualError(t, err, tc.outErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			db.AssertExpectations(t)
+		})
+	}
+}
+
 func TestDevAuthDecommissionDevice(t *testing.T) {
 	t.Parallel()
 
@@ -1597,6 +2097,15 @@ func TestDevAuthGetLimit(t *testing.T) {
 
 			maxDevicesLimitDefaultConfig: 456,
 		},
+		"limit not found token_expiration": {
+			inName: model.LimitTokenExpiration,
+
+			dbLimit: nil,
+			dbErr:   store.ErrLimitNotFound,
+
+			outLimit: &model.Limit{Name: model.LimitTokenExpiration, Value: 3600},
+			outErr:   nil,
+		},
 		"generic error": {
 			inName: "max_devices",
 
@@ -1622,7 +2131,10 @@ func TestDevAuthGetLimit(t *testing.T) {
 				mock.AnythingOfType("model.DeviceUpdate")).Return(nil)
 
 			devauth := NewDevAuth(&db, nil, nil,
-				Config{MaxDevicesLimitDefault: tc.maxDevicesLimitDefaultConfig})
+				Config{
+					MaxDevicesLimitDefault: tc.maxDevicesLimitDefaultConfig,
+					ExpirationTime:         3600,
+				})
 			limit, err := devauth.GetLimit(ctx, tc.inName)
 
 			if tc.outErr != nil {
@@ -1635,6 +2147,71 @@ func TestDevAuthGetLimit(t *testing.T) {
 	}
 }
 
+func TestDevAuthTokenExpiration(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		tenant string
+
+		dbLimit *model.Limit
+		dbErr   error
+
+		out    int64
+		outErr string
+	}{
+		"no tenant": {
+			out: 3600,
+		},
+		"tenant": {
+			tenant:  "foo",
+			dbLimit: &model.Limit{Name: model.LimitTokenExpiration, Value: 600},
+			out:     600,
+		},
+		"tenant, default": {
+			tenant: "foo",
+			dbErr:  store.ErrLimitNotFound,
+			out:    3600,
+		},
+		"tenant, zero": {
+			tenant:  "foo",
+			dbLimit: &model.Limit{Name: model.LimitTokenExpiration, Value: 0},
+			out:     3600,
+		},
+		"error": {
+			tenant: "foo",
+			dbErr:  errors.New("db error"),
+			outErr: "failed to get token expiration: db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tc.tenant != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Tenant: tc.tenant,
+				})
+			}
+
+			db := mstore.DataStore{}
+			db.On("GetLimit", ctx, model.LimitTokenExpiration).
+				Return(tc.dbLimit, tc.dbErr)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{ExpirationTime: 3600})
+			exp, err := devauth.tokenExpiration(ctx)
+			if tc.outErr != "" {
+				assert.EqualError(t, err, tc.outErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.out, exp)
+			}
+		})
+	}
+}
+
 func TestDevAuthGetTenantLimit(t *testing.T) {
 	t.Parallel()
 
@@ -1716,6 +2293,65 @@ func TestDevAuthGetTenantLimit(t *testing.T) {
 	}
 }
 
+func TestDevAuthGetDeviceLimitUsage(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbLimit  *model.Limit
+		dbErr    error
+		count    int
+		countErr error
+
+		out *model.DeviceLimitUsage
+		err string
+	}{
+		"ok": {
+			dbLimit: &model.Limit{Name: model.LimitMaxDeviceCount, Value: 123},
+			count:   100,
+			out:     &model.DeviceLimitUsage{Limit: 123, Usage: 100},
+		},
+		"ok, default limit": {
+			dbErr: store.ErrLimitNotFound,
+			count: 5,
+			out:   &model.DeviceLimitUsage{Limit: 456, Usage: 5},
+		},
+		"error, limit": {
+			dbErr: errors.New("db error"),
+			err:   "can't get current device limit: db error",
+		},
+		"error, count": {
+			dbLimit:  &model.Limit{Name: model.LimitMaxDeviceCount, Value: 123},
+			countErr: errors.New("db error"),
+			err:      "can't get current device count: db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := mstore.DataStore{}
+			db.On("GetLimit", ctx, model.LimitMaxDeviceCount).
+				Return(tc.dbLimit, tc.dbErr)
+			db.On("GetDevCountByStatus", ctx, model.DevStatusAccepted).
+				Return(tc.count, tc.countErr)
+
+			d := NewDevAuth(&db, nil, nil, Config{MaxDevicesLimitDefault: 456})
+
+			usage, err := d.GetDeviceLimitUsage(ctx)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.out, usage)
+			}
+		})
+	}
+}
+
 func TestDevAuthGetDevCountByStatus(t *testing.T) {
 	t.Parallel()
 
@@ -1803,7 +2439,7 @@ func TestDevAuthProvisionTenant(t *testing.T) {
 			db := mstore.DataStore{}
 			db.On("MigrateTenant", ctx,
 				mock.AnythingOfType("string"),
-				"1.5.0",
+				"1.7.0",
 			).Return(tc.datastoreError)
 			db.On("WithAutomigrate").Return(&db)
 			devauth := NewDevAuth(&db, nil, nil, Config{})
@@ -1935,9 +2571,11 @@ func TestDevAuthDeleteAuthSet(t *testing.T) {
 			db.On("GetDeviceStatus", ctx,
 				tc.devId).Return(
 				"accpted", tc.dbGetDeviceStatusErr)
-			db.On("UpdateDevice", ctx,
-				mock.AnythingOfType("model.Device"),
-				mock.AnythingOfType("model.DeviceUpdate")).Return(tc.dbUpdateDeviceErr)
+			db.On("SetDeviceStatus", ctx,
+				mock.AnythingOfType("string"),
+				mock.AnythingOfType("string")).Return("", tc.dbUpdateDeviceErr)
+			db.On("AddDeviceStatusChange", ctx,
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
 
 			devauth := NewDevAuth(&db, nil, nil, Config{})
 			err := devauth.DeleteAuthSet(ctx, tc.devId, tc.authId)
@@ -1963,8 +2601,9 @@ func TestDeleteTokens(t *testing.T) {
 		tenantId string
 		deviceId string
 
-		dbErrDeleteTokenById error
-		dbErrDeleteTokens    error
+		dbErrDeleteTokenById     error
+		dbErrDeleteTokens        error
+		dbErrDeleteRefreshTokens error
 
 		outErr error
 	}{
@@ -1990,6 +2629,12 @@ func TestDeleteTokens(t *testing.T) {
 			dbErrDeleteTokens: errors.New("db error"),
 			outErr:            errors.New("failed to delete tokens for tenant: foo, device id: : db error"),
 		},
+		"error, refresh tokens": {
+			tenantId:                 "foo",
+			deviceId:                 "dev-foo",
+			dbErrDeleteRefreshTokens: errors.New("db error"),
+			outErr:                   errors.New("failed to delete refresh tokens for tenant: foo, device id: dev-foo: db error"),
+		},
 	}
 
 	for n := range testCases {
@@ -2005,6 +2650,8 @@ func TestDeleteTokens(t *testing.T) {
 				Return(tc.dbErrDeleteTokenById)
 			db.On("DeleteTokens", ctxMatcher).
 				Return(tc.dbErrDeleteTokens)
+			db.On("DeleteRefreshTokens", ctxMatcher, tc.tenantId, tc.deviceId).
+				Return(tc.dbErrDeleteRefreshTokens)
 
 			devauth := NewDevAuth(&db, nil, nil, Config{})
 			err := devauth.DeleteTokens(ctx, tc.tenantId, tc.deviceId)
@@ -2018,6 +2665,134 @@ func TestDeleteTokens(t *testing.T) {
 	}
 }
 
+func TestGetRevokedTokens(t *testing.T) {
+	t.Parallel()
+
+	since := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	toks := []model.RevokedToken{
+		{Id: "jti1", RevokedTs: since},
+	}
+
+	testCases := map[string]struct {
+		tenantId string
+
+		dbToks []model.RevokedToken
+		dbErr  error
+
+		outErr error
+	}{
+		"ok": {
+			tenantId: "foo",
+			dbToks:   toks,
+		},
+		"ok, no tenant": {
+			dbToks: toks,
+		},
+		"error": {
+			tenantId: "foo",
+			dbErr:    errors.New("db error"),
+			outErr:   errors.New("failed to list revoked tokens: db error"),
+		},
+	}
+
+	for n := range testCases {
+		tc := testCases[n]
+		t.Run(fmt.Sprintf("tc %s", n), func(t *testing.T) {
+			t.Parallel()
+
+			db := mstore.DataStore{}
+			db.On("GetRevokedTokens",
+				mock.MatchedBy(func(ctx context.Context) bool {
+					ident := identity.FromContext(ctx)
+					return ident != nil && ident.Tenant == tc.tenantId
+				}),
+				since, uint(0), uint(10)).
+				Return(tc.dbToks, tc.dbErr)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+			res, err := devauth.GetRevokedTokens(context.Background(),
+				tc.tenantId, since, 0, 10)
+
+			if tc.outErr != nil {
+				assert.EqualError(t, err, tc.outErr.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.dbToks, res)
+			}
+		})
+	}
+}
+
+func TestRevokeDeviceTokens(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		tenantId string
+
+		dbErrGetDevice       error
+		dbErrDeleteTokenById error
+
+		outErr error
+	}{
+		"ok": {
+			tenantId: "foo",
+		},
+		"ok, no tenant": {},
+		"ok, no tokens": {
+			tenantId:             "foo",
+			dbErrDeleteTokenById: store.ErrTokenNotFound,
+		},
+		"error, device not found": {
+			tenantId:       "foo",
+			dbErrGetDevice: store.ErrDevNotFound,
+			outErr:         store.ErrDevNotFound,
+		},
+		"error, get device": {
+			tenantId:       "foo",
+			dbErrGetDevice: errors.New("db error"),
+			outErr:         errors.New("failed to get device: db error"),
+		},
+		"error, delete tokens": {
+			tenantId:             "foo",
+			dbErrDeleteTokenById: errors.New("db error"),
+			outErr:               errors.New("failed to delete tokens for tenant: foo, device id: dev-foo: db error"),
+		},
+	}
+
+	for n := range testCases {
+		tc := testCases[n]
+		t.Run(fmt.Sprintf("tc %s", n), func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tc.tenantId != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Tenant: tc.tenantId,
+				})
+			}
+			ctxMatcher := mtesting.ContextMatcher()
+
+			db := mstore.DataStore{}
+			db.On("GetDeviceById", ctx, "dev-foo").
+				Return(&model.Device{Id: "dev-foo"}, tc.dbErrGetDevice)
+			db.On("DeleteTokenByDevId", ctxMatcher, "dev-foo").
+				Return(tc.dbErrDeleteTokenById)
+			db.On("DeleteRefreshTokens", ctxMatcher, tc.tenantId, "dev-foo").
+				Return(nil)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+			err := devauth.RevokeDeviceTokens(ctx, "dev-foo")
+
+			if tc.outErr != nil {
+				assert.EqualError(t, err, tc.outErr.Error())
+			} else {
+				assert.NoError(t, err)
+				db.AssertCalled(t, "DeleteRefreshTokens", ctxMatcher, tc.tenantId, "dev-foo")
+			}
+		})
+	}
+}
+
 func TestGetTenantDeviceStatus(t *testing.T) {
 	t.Parallel()
 
@@ -2090,3 +2865,26 @@ func TestGetTenantDeviceStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestDevAuthGetJWKS(t *testing.T) {
+	t.Parallel()
+
+	// handlers without published keys
+	devauth := NewDevAuth(&mstore.DataStore{}, nil, &mjwt.Handler{}, Config{})
+	jwks, err := devauth.GetJWKS(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &jwt.JWKS{
+		Keys:    []jwt.JWK{},
+		Version: jwt.KeySetVersion(nil),
+	}, jwks)
+
+	_, key, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	jwth := jwt.NewJWTHandlerEdDSA(key)
+
+	devauth = NewDevAuth(&mstore.DataStore{}, nil, jwth, Config{})
+	jwks, err = devauth.GetJWKS(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, jwth.JWKS(), jwks.Keys)
+	assert.Equal(t, jwt.KeySetVersion(jwth.JWKS()), jwks.Version)
+}
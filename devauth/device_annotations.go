@@ -0,0 +1,66 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+var (
+	ErrMaxDeviceLabelsReached = NewError(ErrKindBadRequest, catalog.CodeMaxDeviceLabelsReached)
+)
+
+// UpdateDeviceAnnotations updates the notes, labels and group of the device, see
+// model.DeviceAnnotations
+func (d *DevAuth) UpdateDeviceAnnotations(ctx context.Context, devId string, a *model.DeviceAnnotations) error {
+	dev, err := d.db.GetDeviceById(ctx, devId)
+	switch err {
+	case nil:
+		break
+	case store.ErrDevNotFound:
+		return ErrDeviceNotFound
+	default:
+		return errors.Wrap(err, "db get device error")
+	}
+
+	// the labels the device ends up with, as the update is merged
+	count := len(dev.Labels)
+	for k, v := range a.Labels {
+		_, ok := dev.Labels[k]
+		if ok && v == nil {
+			count--
+		} else if !ok && v != nil {
+			count++
+		}
+	}
+	if count > model.DeviceLabelsMaxCount {
+		return ErrMaxDeviceLabelsReached
+	}
+
+	err = d.db.UpdateDeviceAnnotations(ctx, devId, *a)
+	switch err {
+	case nil:
+		return nil
+	case store.ErrDevNotFound:
+		return ErrDeviceNotFound
+	default:
+		return errors.Wrap(err, "failed to update device annotations")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthUpdateDeviceAnnotations(t *testing.T) {
+	t.Parallel()
+
+	str := func(s string) *string {
+		return &s
+	}
+
+	// a device with as many labels as allowed
+	full := map[string]string{}
+	for i := 0; i < model.DeviceLabelsMaxCount; i++ {
+		full[fmt.Sprintf("label%d", i)] = "foo"
+	}
+
+	testCases := map[string]struct {
+		dev    *model.Device
+		devErr error
+		a      model.DeviceAnnotations
+
+		dbErr error
+
+		err string
+	}{
+		"ok": {
+			dev: &model.Device{Id: "dev1"},
+			a: model.DeviceAnnotations{
+				Notes:  str("rejected, not ours"),
+				Labels: map[string]*string{"owner": str("ops")},
+			},
+		},
+		"ok, label replaced": {
+			dev: &model.Device{Id: "dev1", Labels: full},
+			a: model.DeviceAnnotations{
+				Labels: map[string]*string{
+					"label0": nil,
+					"owner":  str("ops"),
+					"label1": str("bar"),
+				},
+			},
+		},
+		"error, too many labels": {
+			dev: &model.Device{Id: "dev1", Labels: full},
+			a: model.DeviceAnnotations{
+				Labels: map[string]*string{"owner": str("ops")},
+			},
+			err: ErrMaxDeviceLabelsReached.Error(),
+		},
+		"error, device not found": {
+			devErr: store.ErrDevNotFound,
+			a:      model.DeviceAnnotations{Notes: str("foo")},
+			err:    ErrDeviceNotFound.Error(),
+		},
+		"error, db": {
+			dev:   &model.Device{Id: "dev1"},
+			a:     model.DeviceAnnotations{Notes: str("foo")},
+			dbErr: errors.New("db connection failed"),
+			err:   "failed to update device annotations: db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := mstore.DataStore{}
+			db.On("GetDeviceById", mtesting.ContextMatcher(), "dev1").
+				Return(tc.dev, tc.devErr)
+			db.On("UpdateDeviceAnnotations", mtesting.ContextMatcher(),
+				"dev1", tc.a).
+				Return(tc.dbErr)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.UpdateDeviceAnnotations(ctx, "dev1", &tc.a)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tc.dev == nil || tc.err == ErrMaxDeviceLabelsReached.Error() {
+				db.AssertNotCalled(t, "UpdateDeviceAnnotations",
+					mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// device authorization grant (RFC 8628) errors, the poll errors map directly
+// to the error codes of the device access token response (sec. 3.5)
+var (
+	ErrDeviceAuthzDisabled  = NewError(ErrKindBadRequest, catalog.CodeDeviceAuthzDisabled)
+	ErrAuthorizationPending = NewError(ErrKindBadRequest, catalog.CodeAuthorizationPending)
+	ErrSlowDown             = NewError(ErrKindBadRequest, catalog.CodeSlowDown)
+	ErrAccessDenied         = NewError(ErrKindBadRequest, catalog.CodeAccessDenied)
+	ErrExpiredToken         = NewError(ErrKindBadRequest, catalog.CodeExpiredToken)
+	ErrInvalidGrant         = NewError(ErrKindBadRequest, catalog.CodeInvalidGrant)
+	ErrUserCodeNotFound     = NewError(ErrKindNotFound, catalog.CodeUserCodeNotFound)
+)
+
+const (
+	// user codes use consonants only, to avoid ambiguous characters and
+	// forming words (RFC 8628, sec. 6.1)
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+	userCodeRetries  = 3
+
+	deviceCodeLength = 32
+
+	// polling interval increase on each slow_down response
+	slowDownIncrement = 5
+
+	defaultDeviceAuthzExpirationTime = 900
+	defaultDeviceAuthzInterval       = 5
+)
+
+// SubmitDeviceAuthorization records the device's auth set just like
+// SubmitAuthRequest, but instead of a token hands out a device code for the
+// device to poll with, and a user code for the operator to approve the
+// device with
+func (d *DevAuth) SubmitDeviceAuthorization(ctx context.Context, r *model.AuthReq) (*model.DeviceAuthorization, error) {
+	l := log.FromContext(ctx)
+
+	if d.config.DeviceAuthzVerificationUri == "" {
+		return nil, ErrDeviceAuthzDisabled
+	}
+
+	ctx, err := d.authRequestContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	attestation, err := d.verifyAuthRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	authSet, err := d.recordAuthRequest(ctx, r, attestation)
+	if err != nil {
+		return nil, err
+	}
+
+	expiration := d.config.DeviceAuthzExpirationTime
+	if expiration == 0 {
+		expiration = defaultDeviceAuthzExpirationTime
+	}
+	interval := d.config.DeviceAuthzInterval
+	if interval == 0 {
+		interval = defaultDeviceAuthzInterval
+	}
+
+	deviceCode, err := randomDeviceCode()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate device code")
+	}
+
+	dc := model.DeviceCode{
+		Id:        hashCode(deviceCode),
+		DeviceId:  authSet.DeviceId,
+		AuthSetId: authSet.Id,
+		ExpiresAt: time.Now().Add(time.Duration(expiration) * time.Second),
+		Interval:  interval,
+	}
+	if ident := identity.FromContext(ctx); ident != nil {
+		dc.TenantId = ident.Tenant
+	}
+
+	// user codes are short, retry on the unlikely collision
+	for i := 0; ; i++ {
+		dc.UserCode, err = randomUserCode()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate user code")
+		}
+
+		err = d.db.AddDeviceCode(ctx, dc)
+		if err != store.ErrObjectExists || i == userCodeRetries {
+			break
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to store device code")
+	}
+
+	l.Infof("device authorization for device %s auth set %s started",
+		authSet.DeviceId, authSet.Id)
+
+	userCode := model.FormatUserCode(dc.UserCode)
+	uri := d.config.DeviceAuthzVerificationUri
+
+	sep := "?"
+	if strings.Contains(uri, "?") {
+		sep = "&"
+	}
+
+	return &model.DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationUri:         uri,
+		VerificationUriComplete: uri + sep + "user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               expiration,
+		Interval:                interval,
+	}, nil
+}
+
+// PollDeviceAuthorization checks the status of the auth set linked with the
+// device code, and once it is accepted, issues a token for the device
+func (d *DevAuth) PollDeviceAuthorization(ctx context.Context, deviceCode string) (string, error) {
+	dc, err := d.db.GetDeviceCode(ctx, hashCode(deviceCode))
+	if err != nil {
+		if err == store.ErrDeviceCodeNotFound {
+			return "", ErrInvalidGrant
+		}
+		return "", errors.Wrap(err, "failed to get device code")
+	}
+
+	now := time.Now()
+	if now.After(dc.ExpiresAt) {
+		return "", ErrExpiredToken
+	}
+
+	up := model.DeviceCodeUpdate{
+		LastPolledAt: &now,
+	}
+
+	tooEarly := dc.LastPolledAt != nil &&
+		now.Sub(*dc.LastPolledAt) < time.Duration(dc.Interval)*time.Second
+	if tooEarly {
+		up.Interval = dc.Interval + slowDownIncrement
+	}
+
+	if err := d.db.UpdateDeviceCode(ctx, dc.Id, up); err != nil {
+		return "", errors.Wrap(err, "failed to update device code")
+	}
+
+	if tooEarly {
+		return "", ErrSlowDown
+	}
+
+	// continue in the context of device's tenant
+	if dc.TenantId != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{
+			Tenant: dc.TenantId,
+		})
+	}
+
+	authSet, err := d.db.GetAuthSetById(ctx, dc.AuthSetId)
+	if err != nil && err != store.ErrDevNotFound {
+		return "", errors.Wrap(err, "db get auth set error")
+	}
+
+	switch {
+	case authSet == nil || authSet.Status == model.DevStatusRejected:
+		// auth set rejected or removed altogether
+		if err := d.db.DeleteDeviceCode(ctx, dc.Id); err != nil {
+			return "", errors.Wrap(err, "failed to delete device code")
+		}
+		return "", ErrAccessDenied
+
+	case authSet.Status == model.DevStatusAccepted:
+		dev, err := d.db.GetDeviceById(ctx, authSet.DeviceId)
+		if err != nil {
+			return "", errors.Wrap(err, "db get device error")
+		}
+		if dev.Decommissioning || dev.Status == model.DevStatusQuarantined {
+			log.FromContext(ctx).Warnf("device authorization of device %s refused, "+
+				"device is decommissioned or quarantined", dev.Id)
+			if err := d.db.DeleteDeviceCode(ctx, dc.Id); err != nil {
+				return "", errors.Wrap(err, "failed to delete device code")
+			}
+			return "", ErrAccessDenied
+		}
+
+		// device code can be used only once: claim it before issuing the
+		// token, only one of concurrent polls gets to remove it
+		err = d.db.DeleteDeviceCode(ctx, dc.Id)
+		switch err {
+		case nil:
+			break
+		case store.ErrDeviceCodeNotFound:
+			return "", ErrInvalidGrant
+		default:
+			return "", errors.Wrap(err, "failed to delete device code")
+		}
+
+		token, err := d.issueToken(ctx, authSet, model.TokenAuditTriggerDeviceAuthorization)
+		switch err {
+		case nil:
+			return token, nil
+		case ErrTenantSuspended:
+			// suspended since the code was issued
+			return "", ErrAccessDenied
+		default:
+			return "", err
+		}
+
+	default:
+		return "", ErrAuthorizationPending
+	}
+}
+
+// GetDeviceAuthorization returns the pending device authorization for given
+// user code, along with device identity data for the operator to verify
+func (d *DevAuth) GetDeviceAuthorization(ctx context.Context, userCode string) (*model.DeviceCode, error) {
+	dc, err := d.getDeviceCodeByUserCode(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	authSet, err := d.db.GetAuthSetById(ctx, dc.AuthSetId)
+	if err != nil {
+		if err == store.ErrDevNotFound {
+			return nil, ErrUserCodeNotFound
+		}
+		return nil, errors.Wrap(err, "db get auth set error")
+	}
+
+	dc.IdDataStruct = authSet.IdDataStruct
+	dc.UserCode = model.FormatUserCode(dc.UserCode)
+
+	return dc, nil
+}
+
+// SetDeviceAuthorizationStatus approves (accepts) or denies (rejects) the auth
+// set linked with given user code
+func (d *DevAuth) SetDeviceAuthorizationStatus(ctx context.Context, userCode string, status string) error {
+	dc, err := d.getDeviceCodeByUserCode(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case model.DevStatusAccepted:
+		return d.AcceptDeviceAuth(ctx, dc.DeviceId, dc.AuthSetId)
+	case model.DevStatusRejected:
+		return d.RejectDeviceAuth(ctx, dc.DeviceId, dc.AuthSetId)
+	default:
+		return MakeErrDevAuthBadRequest(
+			errors.Errorf("invalid device authorization status: %s", status))
+	}
+}
+
+// getDeviceCodeByUserCode finds a valid device code for given user code,
+// within the tenant given by context
+func (d *DevAuth) getDeviceCodeByUserCode(ctx context.Context, userCode string) (*model.DeviceCode, error) {
+	dc, err := d.db.GetDeviceCodeByUserCode(ctx, model.NormalizeUserCode(userCode))
+	if err != nil {
+		if err == store.ErrDeviceCodeNotFound {
+			return nil, ErrUserCodeNotFound
+		}
+		return nil, errors.Wrap(err, "failed to get device code")
+	}
+
+	var tenantId string
+	if ident := identity.FromContext(ctx); ident != nil {
+		tenantId = ident.Tenant
+	}
+
+	if dc.TenantId != tenantId || time.Now().After(dc.ExpiresAt) {
+		return nil, ErrUserCodeNotFound
+	}
+
+	return dc, nil
+}
+
+func randomDeviceCode() (string, error) {
+	buf := make([]byte, deviceCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func randomUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// device codes, refresh and bootstrap tokens are stored hashed, just like
+// passwords
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,546 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+	mjwt "github.com/mendersoftware/deviceauth/jwt/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthSubmitDeviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	pubKey := "dummy_pubkey"
+	idData := "{\"mac\":\"00:00:00:01\"}"
+
+	_, idDataHash, err := parseIdData(idData)
+	assert.NoError(t, err)
+
+	req := model.AuthReq{
+		IdData: idData,
+		PubKey: pubKey,
+	}
+
+	testCases := map[string]struct {
+		verificationUri string
+
+		addDeviceCodeErrs []error
+
+		uriComplete string
+		err         string
+	}{
+		"ok": {
+			verificationUri:   "https://mender/ui/#/authorize",
+			addDeviceCodeErrs: []error{nil},
+			uriComplete:       "https://mender/ui/#/authorize?user_code=",
+		},
+		"ok, user code collision": {
+			verificationUri:   "https://mender/authorize?foo=bar",
+			addDeviceCodeErrs: []error{store.ErrObjectExists, nil},
+			uriComplete:       "https://mender/authorize?foo=bar&user_code=",
+		},
+		"error, disabled": {
+			err: ErrDeviceAuthzDisabled.Error(),
+		},
+		"error, db": {
+			verificationUri:   "https://mender/authorize",
+			addDeviceCodeErrs: []error{errors.New("db failed")},
+			err:               "failed to store device code: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctxMatcher := mtesting.ContextMatcher()
+
+			db := mstore.DataStore{}
+			db.On("AddDevice", ctxMatcher,
+				mock.AnythingOfType("model.Device")).Return(store.ErrObjectExists)
+			db.On("GetDeviceByIdentityDataHash", ctxMatcher,
+				idDataHash).Return(&model.Device{Id: "dev1"}, nil)
+			db.On("AddAuthSet", ctxMatcher,
+				mock.AnythingOfType("model.AuthSet")).Return(nil)
+			db.On("GetAuthSetsByPubKey", ctxMatcher,
+				pubKey).Return([]model.AuthSet{}, nil)
+			db.On("GetAuthSetsForDevice", ctxMatcher,
+				"dev1").Return([]model.AuthSet{}, nil)
+			db.On("GetDeviceStatus", ctxMatcher,
+				"dev1").Return(model.DevStatusPending, nil)
+			db.On("SetDeviceStatus", ctxMatcher,
+				mock.AnythingOfType("string"),
+				mock.AnythingOfType("string")).Return("", nil)
+			db.On("AddDeviceStatusChange", ctxMatcher,
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
+			db.On("GetAuthSetByIdDataHashKey", ctxMatcher,
+				idDataHash, pubKey).Return(
+				&model.AuthSet{
+					Id:       "aid1",
+					DeviceId: "dev1",
+					PubKey:   pubKey,
+					Status:   model.DevStatusPending,
+				}, nil)
+
+			var codes []model.DeviceCode
+			for _, e := range tc.addDeviceCodeErrs {
+				db.On("AddDeviceCode", ctxMatcher,
+					mock.AnythingOfType("model.DeviceCode")).
+					Run(func(args mock.Arguments) {
+						codes = append(codes, args.Get(1).(model.DeviceCode))
+					}).
+					Return(e).Once()
+			}
+
+			devauth := NewDevAuth(&db, nil, nil, Config{
+				DeviceAuthzVerificationUri: tc.verificationUri,
+			})
+
+			res, err := devauth.SubmitDeviceAuthorization(context.Background(), &req)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.verificationUri, res.VerificationUri)
+			assert.Equal(t, tc.uriComplete+res.UserCode, res.VerificationUriComplete)
+			assert.Equal(t, int64(defaultDeviceAuthzExpirationTime), res.ExpiresIn)
+			assert.Equal(t, int64(defaultDeviceAuthzInterval), res.Interval)
+			assert.Regexp(t, "^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$",
+				res.UserCode)
+
+			// the last attempt was stored
+			dc := codes[len(codes)-1]
+			assert.Equal(t, hashCode(res.DeviceCode), dc.Id)
+			assert.Equal(t, model.NormalizeUserCode(res.UserCode), dc.UserCode)
+			assert.Equal(t, "dev1", dc.DeviceId)
+			assert.Equal(t, "aid1", dc.AuthSetId)
+			assert.WithinDuration(t,
+				time.Now().Add(defaultDeviceAuthzExpirationTime*time.Second),
+				dc.ExpiresAt, time.Minute)
+		})
+	}
+}
+
+func TestDevAuthPollDeviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	deviceCode := "devicecode"
+	codeId := hashCode(deviceCode)
+
+	recently := time.Now().Add(-time.Second)
+	longAgo := time.Now().Add(-time.Minute)
+
+	testCases := map[string]struct {
+		dc       *model.DeviceCode
+		dcErr    error
+		authSet  *model.AuthSet
+		asErr    error
+		dev      *model.Device
+		interval int64
+
+		suspended bool
+		deleteErr error
+
+		token string
+		err   error
+	}{
+		"ok": {
+			dc: &model.DeviceCode{
+				Id:           codeId,
+				TenantId:     "tenant1",
+				AuthSetId:    "aid1",
+				ExpiresAt:    time.Now().Add(time.Minute),
+				Interval:     5,
+				LastPolledAt: &longAgo,
+			},
+			authSet: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusAccepted,
+			},
+			token: "dummytoken",
+		},
+		"already used": {
+			dc: &model.DeviceCode{
+				Id:           codeId,
+				TenantId:     "tenant1",
+				AuthSetId:    "aid1",
+				ExpiresAt:    time.Now().Add(time.Minute),
+				Interval:     5,
+				LastPolledAt: &longAgo,
+			},
+			authSet: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusAccepted,
+			},
+			// claimed by a concurrent poll
+			deleteErr: store.ErrDeviceCodeNotFound,
+			err:       ErrInvalidGrant,
+		},
+		"quarantined": {
+			dc: &model.DeviceCode{
+				Id:           codeId,
+				TenantId:     "tenant1",
+				AuthSetId:    "aid1",
+				ExpiresAt:    time.Now().Add(time.Minute),
+				Interval:     5,
+				LastPolledAt: &longAgo,
+			},
+			authSet: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusAccepted,
+			},
+			dev: &model.Device{
+				Id:     "dev1",
+				Status: model.DevStatusQuarantined,
+			},
+			err: ErrAccessDenied,
+		},
+		"tenant suspended": {
+			dc: &model.DeviceCode{
+				Id:           codeId,
+				TenantId:     "tenant1",
+				AuthSetId:    "aid1",
+				ExpiresAt:    time.Now().Add(time.Minute),
+				Interval:     5,
+				LastPolledAt: &longAgo,
+			},
+			authSet: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusAccepted,
+			},
+			suspended: true,
+			err:       ErrAccessDenied,
+		},
+		"pending": {
+			dc: &model.DeviceCode{
+				Id:        codeId,
+				AuthSetId: "aid1",
+				ExpiresAt: time.Now().Add(time.Minute),
+				Interval:  5,
+			},
+			authSet: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusPending,
+			},
+			err: ErrAuthorizationPending,
+		},
+		"rejected": {
+			dc: &model.DeviceCode{
+				Id:        codeId,
+				AuthSetId: "aid1",
+				ExpiresAt: time.Now().Add(time.Minute),
+				Interval:  5,
+			},
+			authSet: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusRejected,
+			},
+			err: ErrAccessDenied,
+		},
+		"auth set removed": {
+			dc: &model.DeviceCode{
+				Id:        codeId,
+				AuthSetId: "aid1",
+				ExpiresAt: time.Now().Add(time.Minute),
+				Interval:  5,
+			},
+			asErr: store.ErrDevNotFound,
+			err:   ErrAccessDenied,
+		},
+		"slow down": {
+			dc: &model.DeviceCode{
+				Id:           codeId,
+				AuthSetId:    "aid1",
+				ExpiresAt:    time.Now().Add(time.Minute),
+				Interval:     5,
+				LastPolledAt: &recently,
+			},
+			interval: 10,
+			err:      ErrSlowDown,
+		},
+		"expired": {
+			dc: &model.DeviceCode{
+				Id:        codeId,
+				AuthSetId: "aid1",
+				ExpiresAt: time.Now().Add(-time.Second),
+			},
+			err: ErrExpiredToken,
+		},
+		"invalid": {
+			dcErr: store.ErrDeviceCodeNotFound,
+			err:   ErrInvalidGrant,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctxMatcher := mtesting.ContextMatcher()
+
+			db := mstore.DataStore{}
+			db.On("GetDeviceCode", ctxMatcher, codeId).Return(tc.dc, tc.dcErr)
+			db.On("UpdateDeviceCode", ctxMatcher, codeId,
+				mock.MatchedBy(func(up model.DeviceCodeUpdate) bool {
+					return up.LastPolledAt != nil &&
+						up.Interval == tc.interval
+				})).Return(nil)
+			claimed := false
+			db.On("DeleteDeviceCode", ctxMatcher, codeId).
+				Run(func(args mock.Arguments) {
+					claimed = tc.deleteErr == nil
+				}).
+				Return(tc.deleteErr)
+			db.On("GetAuthSetById",
+				mock.MatchedBy(func(ctx context.Context) bool {
+					if tc.dc.TenantId == "" {
+						return identity.FromContext(ctx) == nil
+					}
+					return identity.FromContext(ctx).Tenant == tc.dc.TenantId
+				}),
+				"aid1").Return(tc.authSet, tc.asErr)
+			dev := tc.dev
+			if dev == nil {
+				dev = &model.Device{
+					Id:     "dev1",
+					Status: model.DevStatusAccepted,
+				}
+			}
+			db.On("GetDeviceById", ctxMatcher, "dev1").Return(dev, nil)
+			db.On("IsTenantSuspended", ctxMatcher).Return(tc.suspended, nil)
+			db.On("AddToken", ctxMatcher,
+				mock.AnythingOfType("model.Token")).
+				Run(func(args mock.Arguments) {
+					// the code is claimed first
+					assert.True(t, claimed)
+				}).
+				Return(nil)
+			db.On("GetLimit", ctxMatcher, model.LimitTokenExpiration).
+				Return(nil, store.ErrLimitNotFound)
+
+			jwth := mjwt.Handler{}
+			jwth.On("ToJWT",
+				mock.MatchedBy(func(jt *jwt.Token) bool {
+					return jt.Claims.Subject == "dev1" &&
+						jt.Claims.Tenant == "tenant1"
+				})).
+				Return("dummytoken", nil)
+
+			devauth := NewDevAuth(&db, nil, &jwth, Config{})
+			devauth.verifyTenant = true
+
+			token, err := devauth.PollDeviceAuthorization(context.Background(), deviceCode)
+			assert.Equal(t, tc.token, token)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+
+			switch tc.err {
+			case nil, ErrAccessDenied, ErrInvalidGrant:
+				if tc.dcErr == nil {
+					db.AssertCalled(t, "DeleteDeviceCode", ctxMatcher, codeId)
+				} else {
+					db.AssertNotCalled(t, "DeleteDeviceCode", ctxMatcher, codeId)
+				}
+			default:
+				db.AssertNotCalled(t, "DeleteDeviceCode", ctxMatcher, codeId)
+			}
+			if tc.suspended || tc.dev != nil || tc.deleteErr != nil {
+				db.AssertNotCalled(t, "AddToken", ctxMatcher,
+					mock.AnythingOfType("model.Token"))
+			}
+		})
+	}
+}
+
+func TestDevAuthGetDeviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		tenant string
+		dc     *model.DeviceCode
+		dcErr  error
+
+		res *model.DeviceCode
+		err error
+	}{
+		"ok": {
+			tenant: "tenant1",
+			dc: &model.DeviceCode{
+				UserCode:  "WDJBMJHT",
+				TenantId:  "tenant1",
+				DeviceId:  "dev1",
+				AuthSetId: "aid1",
+				ExpiresAt: time.Now().Add(time.Minute),
+			},
+			res: &model.DeviceCode{
+				UserCode:  "WDJB-MJHT",
+				TenantId:  "tenant1",
+				DeviceId:  "dev1",
+				AuthSetId: "aid1",
+				IdDataStruct: map[string]interface{}{
+					"mac": "00:00:00:01",
+				},
+			},
+		},
+		"other tenant": {
+			tenant: "tenant2",
+			dc: &model.DeviceCode{
+				UserCode:  "WDJBMJHT",
+				TenantId:  "tenant1",
+				AuthSetId: "aid1",
+				ExpiresAt: time.Now().Add(time.Minute),
+			},
+			err: ErrUserCodeNotFound,
+		},
+		"expired": {
+			dc: &model.DeviceCode{
+				UserCode:  "WDJBMJHT",
+				AuthSetId: "aid1",
+				ExpiresAt: time.Now().Add(-time.Minute),
+			},
+			err: ErrUserCodeNotFound,
+		},
+		"not found": {
+			dcErr: store.ErrDeviceCodeNotFound,
+			err:   ErrUserCodeNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tc.tenant != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Tenant: tc.tenant,
+				})
+			}
+
+			db := mstore.DataStore{}
+			db.On("GetDeviceCodeByUserCode", ctx,
+				"WDJBMJHT").Return(tc.dc, tc.dcErr)
+			db.On("GetAuthSetById", ctx, "aid1").Return(
+				&model.AuthSet{
+					Id: "aid1",
+					IdDataStruct: map[string]interface{}{
+						"mac": "00:00:00:01",
+					},
+				}, nil)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			res, err := devauth.GetDeviceAuthorization(ctx, "wdjb-mjht")
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				return
+			}
+
+			assert.NoError(t, err)
+			res.ExpiresAt = time.Time{}
+			assert.Equal(t, tc.res, res)
+		})
+	}
+}
+
+func TestDevAuthSetDeviceAuthorizationStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		status string
+
+		err string
+	}{
+		"rejected": {
+			status: model.DevStatusRejected,
+		},
+		"error, invalid status": {
+			status: model.DevStatusPending,
+			err:    "dev auth: bad request: invalid device authorization status: pending",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctxMatcher := mtesting.ContextMatcher()
+
+			db := mstore.DataStore{}
+			db.On("GetDeviceCodeByUserCode", ctxMatcher, "WDJBMJHT").Return(
+				&model.DeviceCode{
+					UserCode:  "WDJBMJHT",
+					DeviceId:  "dev1",
+					AuthSetId: "aid1",
+					ExpiresAt: time.Now().Add(time.Minute),
+				}, nil)
+			db.On("GetAuthSetById", ctxMatcher, "aid1").Return(
+				&model.AuthSet{
+					Id:       "aid1",
+					DeviceId: "dev1",
+					Status:   model.DevStatusPending,
+				}, nil)
+			db.On("UpdateAuthSet", ctxMatcher,
+				mock.AnythingOfType("model.AuthSet"),
+				model.AuthSetUpdate{
+					Status: model.DevStatusRejected,
+				}).Return(nil)
+			db.On("GetDeviceStatus", ctxMatcher,
+				"dev1").Return(model.DevStatusRejected, nil)
+			db.On("SetDeviceStatus", ctxMatcher,
+				mock.AnythingOfType("string"),
+				mock.AnythingOfType("string")).Return("", nil)
+			db.On("AddDeviceStatusChange", ctxMatcher,
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.SetDeviceAuthorizationStatus(context.Background(),
+				"WDJB-MJHT", tc.status)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
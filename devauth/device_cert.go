@@ -0,0 +1,90 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+var (
+	ErrDeviceCertsDisabled  = NewError(ErrKindBadRequest, catalog.CodeDeviceCertsDisabled)
+	ErrDeviceCertNotTrusted = NewError(ErrKindUnauthorized, catalog.CodeDeviceCertNotTrusted)
+	ErrDeviceCertRequired   = NewError(ErrKindUnauthorized, catalog.CodeDeviceCertRequired)
+	ErrClientCertRequired   = NewError(ErrKindUnauthorized, catalog.CodeClientCertRequired)
+	ErrClientCertMismatch   = NewError(ErrKindUnauthorized, catalog.CodeClientCertMismatch)
+)
+
+// verifyDeviceCert verifies the certificate chain the device presented with
+// the auth request, if any, against the device CA certificates; the chain
+// must lead to one of the CAs and the device certificate be valid for client
+// authentication
+func (d *DevAuth) verifyDeviceCert(ctx context.Context, r *model.AuthReq) error {
+	if len(r.CertChain) == 0 {
+		return nil
+	}
+
+	if d.config.DeviceCACerts == nil {
+		return ErrDeviceCertsDisabled
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range r.CertChain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := r.CertChain[0].Verify(x509.VerifyOptions{
+		Roots:         d.config.DeviceCACerts,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		log.FromContext(ctx).Warnf("device certificate verification failed: %v", err)
+		return ErrDeviceCertNotTrusted
+	}
+
+	return nil
+}
+
+// verifyClientCert cross-checks the TLS client certificate of the auth
+// request with its identity data, if mutual TLS is enabled: the subject
+// common name must equal the configured id data attribute
+func (d *DevAuth) verifyClientCert(ctx context.Context, r *model.AuthReq) error {
+	attr := d.config.MTLSIdentityAttribute
+	if attr == "" {
+		return nil
+	}
+
+	if r.ClientCert == nil {
+		return ErrClientCertRequired
+	}
+
+	idData, _, err := parseIdData(r.IdData)
+	if err != nil {
+		return MakeErrDevAuthBadRequest(err)
+	}
+
+	if value, ok := idData[attr].(string); !ok || value != r.ClientCert.Subject.CommonName {
+		log.FromContext(ctx).Warnf("client certificate %q doesn't match identity data",
+			r.ClientCert.Subject.CommonName)
+		return ErrClientCertMismatch
+	}
+
+	return nil
+}
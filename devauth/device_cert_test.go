@@ -0,0 +1,154 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthVerifyDeviceCert(t *testing.T) {
+	t.Parallel()
+
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		return key
+	}
+
+	rootKey, interKey, devKey, otherKey := newKey(), newKey(), newKey(), newKey()
+
+	root, _ := mtesting.IssueCert("root", rootKey.Public(), nil, rootKey, true, t)
+	inter, _ := mtesting.IssueCert("intermediate", interKey.Public(), root, rootKey, true, t)
+	other, _ := mtesting.IssueCert("other", otherKey.Public(), nil, otherKey, true, t)
+
+	devByRoot, _ := mtesting.IssueCert("dev", devKey.Public(), root, rootKey, false, t)
+	devByInter, _ := mtesting.IssueCert("dev", devKey.Public(), inter, interKey, false, t)
+	devByOther, _ := mtesting.IssueCert("dev", devKey.Public(), other, otherKey, false, t)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(root)
+
+	testCases := map[string]struct {
+		chain []*x509.Certificate
+		pool  *x509.CertPool
+
+		err error
+	}{
+		"ok, no certificate": {
+			pool: pool,
+		},
+		"ok, no certificate, disabled": {},
+		"ok, signed by root": {
+			chain: []*x509.Certificate{devByRoot},
+			pool:  pool,
+		},
+		"ok, signed by intermediate": {
+			chain: []*x509.Certificate{devByInter, inter},
+			pool:  pool,
+		},
+		"error, disabled": {
+			chain: []*x509.Certificate{devByRoot},
+			err:   ErrDeviceCertsDisabled,
+		},
+		"error, intermediate missing": {
+			chain: []*x509.Certificate{devByInter},
+			pool:  pool,
+			err:   ErrDeviceCertNotTrusted,
+		},
+		"error, other CA": {
+			chain: []*x509.Certificate{devByOther, other},
+			pool:  pool,
+			err:   ErrDeviceCertNotTrusted,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			d := NewDevAuth(nil, nil, nil, Config{
+				DeviceCACerts: tc.pool,
+			})
+
+			err := d.verifyDeviceCert(context.Background(), &model.AuthReq{
+				CertChain: tc.chain,
+			})
+			assert.Equal(t, tc.err, err)
+		})
+	}
+}
+
+func TestDevAuthVerifyClientCert(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	cert, _ := mtesting.IssueCert("00:01:02:03:04:05", key.Public(), nil, key, false, t)
+
+	testCases := map[string]struct {
+		attr   string
+		idData string
+		cert   *x509.Certificate
+
+		err error
+	}{
+		"ok": {
+			attr:   "mac",
+			idData: `{"mac":"00:01:02:03:04:05","sn":"0001"}`,
+			cert:   cert,
+		},
+		"ok, disabled": {
+			idData: `{"mac":"00:01:02:03:04:06"}`,
+		},
+		"error, no certificate": {
+			attr:   "mac",
+			idData: `{"mac":"00:01:02:03:04:05"}`,
+			err:    ErrClientCertRequired,
+		},
+		"error, mismatch": {
+			attr:   "mac",
+			idData: `{"mac":"00:01:02:03:04:06"}`,
+			cert:   cert,
+			err:    ErrClientCertMismatch,
+		},
+		"error, attribute missing": {
+			attr:   "mac",
+			idData: `{"sn":"00:01:02:03:04:05"}`,
+			cert:   cert,
+			err:    ErrClientCertMismatch,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			d := NewDevAuth(nil, nil, nil, Config{
+				MTLSIdentityAttribute: tc.attr,
+			})
+
+			err := d.verifyClientCert(context.Background(), &model.AuthReq{
+				IdData:     tc.idData,
+				ClientCert: tc.cert,
+			})
+			assert.Equal(t, tc.err, err)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+// deviceCheckins collects the last check-in of devices, per tenant, until
+// they're written to the database in bulk
+type deviceCheckins struct {
+	lock     sync.Mutex
+	checkins map[string]map[string]time.Time
+}
+
+func newDeviceCheckins() *deviceCheckins {
+	return &deviceCheckins{
+		checkins: make(map[string]map[string]time.Time),
+	}
+}
+
+func (c *deviceCheckins) record(tenant, devId string, t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	devs, ok := c.checkins[tenant]
+	if !ok {
+		devs = make(map[string]time.Time)
+		c.checkins[tenant] = devs
+	}
+	devs[devId] = t
+}
+
+// take returns the collected check-ins and starts over
+func (c *deviceCheckins) take() map[string]map[string]time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	checkins := c.checkins
+	c.checkins = make(map[string]map[string]time.Time)
+	return checkins
+}
+
+// WithDeviceCheckinTracking will make devauth record the last time devices
+// verify their tokens or send auth requests; the records are kept in memory
+// until written to the database with FlushDeviceCheckins. Returns an
+// updated devauth.
+func (d *DevAuth) WithDeviceCheckinTracking() *DevAuth {
+	d.checkins = newDeviceCheckins()
+	return d
+}
+
+func (d *DevAuth) recordCheckin(ctx context.Context, devId string) {
+	if d.checkins == nil || devId == "" {
+		return
+	}
+
+	tenant := ""
+	if ident := identity.FromContext(ctx); ident != nil {
+		tenant = ident.Tenant
+	}
+	d.checkins.record(tenant, devId, time.Now())
+}
+
+// FlushDeviceCheckins writes the recorded check-ins to the database;
+// check-ins failing to be written are dropped
+func (d *DevAuth) FlushDeviceCheckins(ctx context.Context) error {
+	if d.checkins == nil {
+		return nil
+	}
+
+	var lastErr error
+	for tenant, devs := range d.checkins.take() {
+		checkins := make([]model.DeviceCheckin, 0, len(devs))
+		for id, t := range devs {
+			checkins = append(checkins, model.DeviceCheckin{
+				DeviceId: id,
+				Time:     t,
+			})
+		}
+
+		tenantCtx := ctx
+		if tenant != "" {
+			tenantCtx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenant,
+			})
+		}
+		if err := d.db.SetDevicesLastCheckin(tenantCtx, checkins); err != nil {
+			lastErr = errors.Wrapf(err,
+				"failed to record device check-ins for tenant: %v", tenant)
+		}
+	}
+	return lastErr
+}
+
+// RunDeviceCheckinFlush writes the recorded check-ins to the database
+// every interval, until the context is done
+func (d *DevAuth) RunDeviceCheckinFlush(ctx context.Context, interval time.Duration) {
+	l := log.FromContext(ctx)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := d.FlushDeviceCheckins(ctx); err != nil {
+			l.Errorf("device check-in flush failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestDevAuthFlushDeviceCheckins(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		tracking bool
+		dbErr    error
+
+		err string
+	}{
+		"ok": {
+			tracking: true,
+		},
+		"ok, not tracking": {},
+		"error, db": {
+			tracking: true,
+			dbErr:    errors.New("db failed"),
+			err:      "failed to record device check-ins for tenant: foo: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			tenantCtx := identity.WithContext(ctx, &identity.Identity{
+				Tenant: "foo",
+			})
+
+			db := &mstore.DataStore{}
+			d := NewDevAuth(db, nil, nil, Config{})
+			if tc.tracking {
+				d = d.WithDeviceCheckinTracking()
+			}
+
+			d.recordCheckin(tenantCtx, "dev1")
+			d.recordCheckin(tenantCtx, "dev1")
+
+			if tc.tracking {
+				db.On("SetDevicesLastCheckin",
+					mock.MatchedBy(func(c context.Context) bool {
+						ident := identity.FromContext(c)
+						return ident != nil && ident.Tenant == "foo"
+					}),
+					mock.MatchedBy(func(c []model.DeviceCheckin) bool {
+						return len(c) == 1 &&
+							c[0].DeviceId == "dev1" &&
+							time.Since(c[0].Time) < time.Minute
+					})).
+					Return(tc.dbErr).Once()
+			}
+
+			err := d.FlushDeviceCheckins(ctx)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// check-ins are written once
+			assert.NoError(t, d.FlushDeviceCheckins(ctx))
+			db.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// number of devices fetched at once by device exports
+const exportBatchSize = 100
+
+// ExportDevices passes the devices matching the filter, along with their
+// auth sets, to fn one at a time, in the filter's sort order. The devices
+// are fetched in batches, so that the whole fleet is never held in memory;
+// an error returned by fn stops the export.
+func (d *DevAuth) ExportDevices(ctx context.Context, filter store.DeviceFilter, fn func(*model.Device) error) error {
+	for {
+		devs, err := d.db.GetDevices(ctx, 0, exportBatchSize, filter)
+		if err != nil {
+			return errors.Wrap(err, "failed to list devices")
+		}
+
+		for i := range devs {
+			devs[i].AuthSets, err = d.db.GetAuthSetsForDevice(ctx, devs[i].Id)
+			if err != nil && err != store.ErrDevNotFound {
+				return errors.Wrap(err, "db get auth sets error")
+			}
+			if err := fn(&devs[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(devs) < exportBatchSize {
+			return nil
+		}
+		filter.After = filter.Sort.Cursor(&devs[len(devs)-1])
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthExportDevices(t *testing.T) {
+	t.Parallel()
+
+	devs := make([]model.Device, exportBatchSize+1)
+	for i := range devs {
+		devs[i] = model.Device{Id: fmt.Sprintf("dev%03d", i)}
+	}
+
+	sort := store.DeviceSort{Field: store.DeviceSortId}
+	first := store.DeviceFilter{Status: model.DevStatusAccepted, Sort: sort}
+	second := first
+	second.After = sort.Cursor(&devs[exportBatchSize-1])
+
+	testCases := map[string]struct {
+		devs    []model.Device
+		devsErr error
+		fnErr   error
+
+		ids []string
+		err string
+	}{
+		"ok, batches": {
+			devs: devs,
+		},
+		"ok, none": {
+			devs: []model.Device{},
+		},
+		"error, db": {
+			devsErr: errors.New("db connection failed"),
+			err:     "failed to list devices: db connection failed",
+		},
+		"error, callback": {
+			devs:  devs,
+			fnErr: errors.New("client gone"),
+			err:   "client gone",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := mstore.DataStore{}
+			batch := tc.devs
+			if len(batch) > exportBatchSize {
+				batch = batch[:exportBatchSize]
+				db.On("GetDevices", mtesting.ContextMatcher(),
+					uint(0), uint(exportBatchSize), second).
+					Return(tc.devs[exportBatchSize:], nil)
+			}
+			db.On("GetDevices", mtesting.ContextMatcher(),
+				uint(0), uint(exportBatchSize), first).
+				Return(batch, tc.devsErr)
+			for _, dev := range tc.devs {
+				db.On("GetAuthSetsForDevice", mtesting.ContextMatcher(),
+					dev.Id).
+					Return([]model.AuthSet{{Id: "aid-" + dev.Id}}, nil)
+			}
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			ids := []string{}
+			err := devauth.ExportDevices(ctx, first, func(dev *model.Device) error {
+				ids = append(ids, dev.Id)
+				assert.Equal(t, "aid-"+dev.Id, dev.AuthSets[0].Id)
+				return tc.fnErr
+			})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, ids, len(tc.devs))
+			}
+			if tc.fnErr != nil {
+				assert.Len(t, ids, 1)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// SetDeviceGroup puts the device in the group, or removes it from its group
+// if the group is empty
+func (d *DevAuth) SetDeviceGroup(ctx context.Context, devId, group string) error {
+	err := d.db.SetDeviceGroup(ctx, devId, group)
+	switch err {
+	case nil:
+		return nil
+	case store.ErrDevNotFound:
+		return ErrDeviceNotFound
+	default:
+		return errors.Wrap(err, "failed to set device group")
+	}
+}
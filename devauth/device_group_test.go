@@ -0,0 +1,77 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthSetDeviceGroup(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		group string
+		dbErr error
+
+		err string
+	}{
+		"ok": {
+			group: "site-1",
+		},
+		"ok, removed from group": {
+			group: "",
+		},
+		"error, device not found": {
+			group: "site-1",
+			dbErr: store.ErrDevNotFound,
+			err:   ErrDeviceNotFound.Error(),
+		},
+		"error, db": {
+			group: "site-1",
+			dbErr: errors.New("db connection failed"),
+			err:   "failed to set device group: db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := mstore.DataStore{}
+			db.On("SetDeviceGroup", mtesting.ContextMatcher(),
+				"dev1", tc.group).
+				Return(tc.dbErr)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.SetDeviceGroup(ctx, "dev1", tc.group)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
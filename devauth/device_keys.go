@@ -0,0 +1,158 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/revocation"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+var (
+	ErrDeviceKeyNotFound    = NewError(ErrKindNotFound, catalog.CodeDeviceKeyNotFound)
+	ErrMaxDeviceKeysReached = NewError(ErrKindConflict, catalog.CodeMaxDeviceKeysReached)
+)
+
+func (d *DevAuth) multipleDeviceKeys() bool {
+	return d.config.MaxDeviceKeys > 1
+}
+
+// supersededAuthSets returns the filter for the auth sets of the device to
+// reject when accepting another one: all accepted and preauthorized sets,
+// or, if the device may have multiple keys, only the preauthorized ones;
+// in that case fails with ErrMaxDeviceKeysReached if the device can't have
+// another key.
+func (d *DevAuth) supersededAuthSets(ctx context.Context, devId string) (bson.M, error) {
+	if !d.multipleDeviceKeys() {
+		return bson.M{
+			model.AuthSetKeyDeviceId: devId,
+			"$or": []bson.M{
+				bson.M{model.AuthSetKeyStatus: model.DevStatusAccepted},
+				bson.M{model.AuthSetKeyStatus: model.DevStatusPreauth},
+			},
+		}, nil
+	}
+
+	keys, err := d.acceptedAuthSets(ctx, devId)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) >= d.config.MaxDeviceKeys {
+		return nil, ErrMaxDeviceKeysReached
+	}
+
+	return bson.M{
+		model.AuthSetKeyDeviceId: devId,
+		model.AuthSetKeyStatus:   model.DevStatusPreauth,
+	}, nil
+}
+
+func (d *DevAuth) acceptedAuthSets(ctx context.Context, devId string) ([]model.AuthSet, error) {
+	sets, err := d.db.GetAuthSetsForDevice(ctx, devId)
+	if err != nil && err != store.ErrDevNotFound {
+		return nil, errors.Wrap(err, "db get auth sets error")
+	}
+
+	accepted := []model.AuthSet{}
+	for _, s := range sets {
+		if s.Status == model.DevStatusAccepted {
+			accepted = append(accepted, s)
+		}
+	}
+	return accepted, nil
+}
+
+// GetDeviceKeys returns the accepted keys of the device
+func (d *DevAuth) GetDeviceKeys(ctx context.Context, devId string) ([]model.DeviceKey, error) {
+	if _, err := d.db.GetDeviceById(ctx, devId); err != nil {
+		if err == store.ErrDevNotFound {
+			return nil, ErrDeviceNotFound
+		}
+		return nil, errors.Wrap(err, "db get device error")
+	}
+
+	sets, err := d.acceptedAuthSets(ctx, devId)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]model.DeviceKey, len(sets))
+	for i := range sets {
+		keys[i] = model.NewDeviceKey(sets[i])
+	}
+	return keys, nil
+}
+
+// RevokeDeviceKey rejects the accepted auth set of the key, leaving the
+// device's other keys accepted; tokens and refresh tokens issued for the
+// key are revoked. Revoking the last key rejects the device.
+func (d *DevAuth) RevokeDeviceKey(ctx context.Context, devId, authId string) error {
+	sets, err := d.acceptedAuthSets(ctx, devId)
+	if err != nil {
+		return err
+	}
+
+	var aset *model.AuthSet
+	for i := range sets {
+		if sets[i].Id == authId {
+			aset = &sets[i]
+		}
+	}
+	if aset == nil {
+		return ErrDeviceKeyNotFound
+	}
+
+	if len(sets) == 1 {
+		return d.RejectDeviceAuth(ctx, devId, authId)
+	}
+
+	// the device stays accepted, and keeps the tokens of its other keys
+	err = d.db.UpdateAuthSet(ctx,
+		model.AuthSet{
+			Id:     aset.Id,
+			Status: model.DevStatusAccepted,
+		},
+		model.AuthSetUpdate{
+			Status: model.DevStatusRejected,
+		})
+	if err == store.ErrAuthSetNotFound {
+		return ErrDeviceKeyNotFound
+	} else if err != nil {
+		return errors.Wrap(err, "db update device auth set error")
+	}
+
+	ids, err := d.db.DeleteAuthSetTokens(ctx, aset.Id)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke key tokens")
+	}
+	for _, id := range ids {
+		d.publishRevocation(ctx, revocation.Event{
+			Kind:     revocation.KindTokenRevoked,
+			TokenId:  id,
+			DeviceId: devId,
+		})
+	}
+
+	if err := d.db.DeleteAuthSetRefreshTokens(ctx, aset.Id); err != nil {
+		return errors.Wrap(err, "failed to revoke key refresh tokens")
+	}
+
+	return nil
+}
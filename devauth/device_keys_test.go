@@ -0,0 +1,314 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/revocation"
+	mrevocation "github.com/mendersoftware/deviceauth/revocation/mocks"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestDevAuthSupersededAuthSets(t *testing.T) {
+	t.Parallel()
+
+	oneAccepted := []model.AuthSet{
+		{Id: "aid1", DeviceId: "dev1", Status: model.DevStatusAccepted},
+		{Id: "aid2", DeviceId: "dev1", Status: model.DevStatusPending},
+	}
+	twoAccepted := []model.AuthSet{
+		{Id: "aid1", DeviceId: "dev1", Status: model.DevStatusAccepted},
+		{Id: "aid2", DeviceId: "dev1", Status: model.DevStatusAccepted},
+		{Id: "aid3", DeviceId: "dev1", Status: model.DevStatusPending},
+	}
+
+	testCases := map[string]struct {
+		maxKeys int
+		sets    []model.AuthSet
+		setsErr error
+
+		filter bson.M
+		err    string
+	}{
+		"single key": {
+			maxKeys: 1,
+			sets:    twoAccepted,
+			filter: bson.M{
+				model.AuthSetKeyDeviceId: "dev1",
+				"$or": []bson.M{
+					bson.M{model.AuthSetKeyStatus: model.DevStatusAccepted},
+					bson.M{model.AuthSetKeyStatus: model.DevStatusPreauth},
+				},
+			},
+		},
+		"multiple keys": {
+			maxKeys: 2,
+			sets:    oneAccepted,
+			filter: bson.M{
+				model.AuthSetKeyDeviceId: "dev1",
+				model.AuthSetKeyStatus:   model.DevStatusPreauth,
+			},
+		},
+		"multiple keys, limit reached": {
+			maxKeys: 2,
+			sets:    twoAccepted,
+			err:     ErrMaxDeviceKeysReached.Error(),
+		},
+		"error, db": {
+			maxKeys: 2,
+			setsErr: errors.New("db failed"),
+			err:     "db get auth sets error: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetAuthSetsForDevice", ctx, "dev1").
+				Return(tc.sets, tc.setsErr)
+
+			d := NewDevAuth(db, nil, nil, Config{
+				MaxDeviceKeys: tc.maxKeys,
+			})
+
+			filter, err := d.supersededAuthSets(ctx, "dev1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.filter, filter)
+			}
+		})
+	}
+}
+
+func TestDevAuthGetDeviceKeys(t *testing.T) {
+	t.Parallel()
+
+	sets := []model.AuthSet{
+		{Id: "aid1", DeviceId: "dev1", PubKey: "key1", KeyType: "rsa",
+			Status: model.DevStatusAccepted},
+		{Id: "aid2", DeviceId: "dev1", PubKey: "key2", KeyType: "ed25519",
+			Status: model.DevStatusAccepted},
+		{Id: "aid3", DeviceId: "dev1", PubKey: "key3",
+			Status: model.DevStatusRejected},
+	}
+
+	testCases := map[string]struct {
+		devErr  error
+		sets    []model.AuthSet
+		setsErr error
+
+		keys []model.DeviceKey
+		err  string
+	}{
+		"ok": {
+			sets: sets,
+			keys: []model.DeviceKey{
+				{Id: "aid1", PubKey: "key1", KeyType: "rsa"},
+				{Id: "aid2", PubKey: "key2", KeyType: "ed25519"},
+			},
+		},
+		"ok, no keys": {
+			setsErr: store.ErrDevNotFound,
+			keys:    []model.DeviceKey{},
+		},
+		"error, device not found": {
+			devErr: store.ErrDevNotFound,
+			err:    ErrDeviceNotFound.Error(),
+		},
+		"error, db": {
+			setsErr: errors.New("db failed"),
+			err:     "db get auth sets error: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetDeviceById", ctx, "dev1").
+				Return(&model.Device{Id: "dev1"}, tc.devErr)
+			db.On("GetAuthSetsForDevice", ctx, "dev1").
+				Return(tc.sets, tc.setsErr)
+
+			d := NewDevAuth(db, nil, nil, Config{MaxDeviceKeys: 2})
+
+			keys, err := d.GetDeviceKeys(ctx, "dev1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.keys, keys)
+			}
+		})
+	}
+}
+
+func TestDevAuthRevokeDeviceKey(t *testing.T) {
+	t.Parallel()
+
+	twoAccepted := []model.AuthSet{
+		{Id: "aid1", DeviceId: "dev1", Status: model.DevStatusAccepted},
+		{Id: "aid2", DeviceId: "dev1", Status: model.DevStatusAccepted},
+	}
+	oneAccepted := []model.AuthSet{
+		{Id: "aid1", DeviceId: "dev1", Status: model.DevStatusAccepted},
+		{Id: "aid2", DeviceId: "dev1", Status: model.DevStatusRejected},
+	}
+
+	testCases := map[string]struct {
+		authId     string
+		sets       []model.AuthSet
+		updateErr  error
+		tokens     []string
+		tokensErr  error
+		refreshErr error
+
+		rejectsDevice bool
+		err           string
+	}{
+		"ok": {
+			authId: "aid2",
+			sets:   twoAccepted,
+			tokens: []string{"jti1", "jti2"},
+		},
+		"ok, no tokens": {
+			authId: "aid2",
+			sets:   twoAccepted,
+		},
+		"ok, last key": {
+			authId:        "aid1",
+			sets:          oneAccepted,
+			rejectsDevice: true,
+		},
+		"error, key not accepted": {
+			authId: "aid2",
+			sets:   oneAccepted,
+			err:    ErrDeviceKeyNotFound.Error(),
+		},
+		"error, unknown key": {
+			authId: "aid3",
+			sets:   twoAccepted,
+			err:    ErrDeviceKeyNotFound.Error(),
+		},
+		"error, key changed": {
+			authId:    "aid2",
+			sets:      twoAccepted,
+			updateErr: store.ErrAuthSetNotFound,
+			err:       ErrDeviceKeyNotFound.Error(),
+		},
+		"error, db": {
+			authId:    "aid2",
+			sets:      twoAccepted,
+			updateErr: errors.New("db failed"),
+			err:       "db update device auth set error: db failed",
+		},
+		"error, tokens": {
+			authId:    "aid2",
+			sets:      twoAccepted,
+			tokensErr: errors.New("db failed"),
+			err:       "failed to revoke key tokens: db failed",
+		},
+		"error, refresh tokens": {
+			authId:     "aid2",
+			sets:       twoAccepted,
+			tokens:     []string{"jti1"},
+			refreshErr: errors.New("db failed"),
+			err:        "failed to revoke key refresh tokens: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetAuthSetsForDevice", ctx, "dev1").
+				Return(tc.sets, nil)
+			db.On("UpdateAuthSet", ctx,
+				model.AuthSet{Id: tc.authId, Status: model.DevStatusAccepted},
+				model.AuthSetUpdate{Status: model.DevStatusRejected}).
+				Return(tc.updateErr)
+			db.On("DeleteAuthSetTokens", ctx, tc.authId).
+				Return(tc.tokens, tc.tokensErr)
+			db.On("DeleteAuthSetRefreshTokens", ctx, tc.authId).
+				Return(tc.refreshErr)
+
+			pub := &mrevocation.Publisher{}
+			for _, id := range tc.tokens {
+				pub.On("Publish", ctx, revocation.Event{
+					Kind:     revocation.KindTokenRevoked,
+					TokenId:  id,
+					DeviceId: "dev1",
+				}).Return()
+			}
+			pub.On("Publish", ctx, revocation.Event{
+				Kind:     revocation.KindDeviceRevoked,
+				DeviceId: "dev1",
+				Reason:   revocation.ReasonRejected,
+			}).Return()
+
+			// rejecting the device, as with the status endpoint
+			db.On("GetAuthSetById", ctx, tc.authId).
+				Return(&tc.sets[0], nil)
+			db.On("DeleteTokenByDevId", ctx, "dev1").Return(nil)
+			db.On("UpdateAuthSet", ctx, tc.sets[0],
+				model.AuthSetUpdate{Status: model.DevStatusRejected}).
+				Return(nil)
+			db.On("GetDeviceStatus", ctx, "dev1").
+				Return(model.DevStatusRejected, nil)
+			db.On("SetDeviceStatus", ctx, "dev1", model.DevStatusRejected).
+				Return(model.DevStatusAccepted, nil)
+			db.On("AddDeviceStatusChange", ctx,
+				mock.AnythingOfType("model.DeviceStatusChange")).
+				Return(nil)
+
+			d := NewDevAuth(db, nil, nil, Config{MaxDeviceKeys: 2}).
+				WithRevocationPublisher(pub)
+
+			err := d.RevokeDeviceKey(ctx, "dev1", tc.authId)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.rejectsDevice {
+				db.AssertCalled(t, "SetDeviceStatus", ctx, "dev1",
+					model.DevStatusRejected)
+			} else {
+				db.AssertNotCalled(t, "DeleteTokenByDevId", ctx, "dev1")
+				db.AssertNotCalled(t, "SetDeviceStatus", ctx, "dev1",
+					model.DevStatusRejected)
+			}
+			published := len(tc.tokens)
+			if tc.rejectsDevice {
+				published++
+			}
+			assert.Len(t, pub.Calls, published)
+		})
+	}
+}
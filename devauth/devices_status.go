@@ -0,0 +1,128 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+var (
+	ErrNoPendingAuthSet = NewError(ErrKindConflict, catalog.CodeNoPendingAuthSet)
+)
+
+// UpdateDevicesStatus accepts or rejects the devices of the request one by
+// one; a device that can't be updated doesn't stop the others, its result
+// tells what went wrong instead. A filter selects at most
+// model.DevicesStatusMaxCount devices.
+func (d *DevAuth) UpdateDevicesStatus(ctx context.Context, req *model.DevicesStatusReq) ([]model.DeviceStatusResult, error) {
+	l := log.FromContext(ctx)
+
+	ids := req.DeviceIds
+	if req.Filter != nil {
+		devs, err := d.db.GetDevices(ctx, 0, model.DevicesStatusMaxCount,
+			store.DeviceFilter{
+				Status:      req.Filter.Status,
+				Group:       req.Filter.Group,
+				Search:      req.Filter.Search,
+				SearchExact: req.Filter.SearchExact,
+			})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch devices")
+		}
+		ids = make([]string, len(devs))
+		for i := range devs {
+			ids[i] = devs[i].Id
+		}
+	}
+
+	results := make([]model.DeviceStatusResult, len(ids))
+	for i, id := range ids {
+		results[i].DeviceId = id
+
+		err := d.setDeviceStatus(ctx, id, req.Status)
+		if err == store.ErrDevNotFound {
+			err = ErrDeviceNotFound
+		}
+		if err == nil {
+			results[i].Status = req.Status
+		} else if e, ok := errors.Cause(err).(*Error); ok &&
+			e.Kind != ErrKindInternal {
+			results[i].Error = e.Message
+		} else {
+			l.Errorf("failed to set device %s status to %s: %v",
+				id, req.Status, err)
+			results[i].Error = "internal error"
+		}
+	}
+
+	return results, nil
+}
+
+// setDeviceStatus accepts the device's most recent pending auth set, or
+// rejects all of its auth sets, depending on the status
+func (d *DevAuth) setDeviceStatus(ctx context.Context, devId, status string) error {
+	dev, err := d.db.GetDeviceById(ctx, devId)
+	if err != nil {
+		return err
+	}
+
+	if dev.Status == status {
+		return nil
+	}
+
+	sets, err := d.db.GetAuthSetsForDevice(ctx, devId)
+	if err != nil {
+		return errors.Wrap(err, "db get auth sets error")
+	}
+
+	if status == model.DevStatusAccepted {
+		var pending *model.AuthSet
+		for i := range sets {
+			if sets[i].Status == model.DevStatusPending &&
+				(pending == nil || newerAuthSet(&sets[i], pending)) {
+				pending = &sets[i]
+			}
+		}
+		if pending == nil {
+			return ErrNoPendingAuthSet
+		}
+		return d.AcceptDeviceAuth(ctx, devId, pending.Id)
+	}
+
+	for i := range sets {
+		if sets[i].Status == model.DevStatusRejected {
+			continue
+		}
+		if err := d.RejectDeviceAuth(ctx, devId, sets[i].Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newerAuthSet tells if auth set a was submitted after b; auth sets without
+// a timestamp are the oldest
+func newerAuthSet(a, b *model.AuthSet) bool {
+	if a.Timestamp == nil {
+		return false
+	}
+	return b.Timestamp == nil || a.Timestamp.After(*b.Timestamp)
+}
@@ -0,0 +1,234 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthUpdateDevicesStatus(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	tsLater := ts.Add(time.Hour)
+
+	testCases := map[string]struct {
+		status string
+
+		dev     *model.Device
+		devErr  error
+		sets    []model.AuthSet
+		setsErr error
+
+		// auth sets the status is set on
+		authSetIds []string
+
+		result model.DeviceStatusResult
+	}{
+		"reject": {
+			status: model.DevStatusRejected,
+			dev:    &model.Device{Id: "dev1", Status: model.DevStatusPending},
+			sets: []model.AuthSet{
+				{Id: "aid1", DeviceId: "dev1", Status: model.DevStatusPending},
+				{Id: "aid2", DeviceId: "dev1", Status: model.DevStatusRejected},
+			},
+			authSetIds: []string{"aid1"},
+			result: model.DeviceStatusResult{
+				DeviceId: "dev1",
+				Status:   model.DevStatusRejected,
+			},
+		},
+		"accept, already accepted": {
+			status: model.DevStatusAccepted,
+			dev:    &model.Device{Id: "dev1", Status: model.DevStatusAccepted},
+			result: model.DeviceStatusResult{
+				DeviceId: "dev1",
+				Status:   model.DevStatusAccepted,
+			},
+		},
+		"accept, latest pending auth set": {
+			status: model.DevStatusAccepted,
+			dev:    &model.Device{Id: "dev1", Status: model.DevStatusPending},
+			sets: []model.AuthSet{
+				{Id: "aid1", DeviceId: "dev1", Status: model.DevStatusPending, Timestamp: &ts},
+				{Id: "aid2", DeviceId: "dev1", Status: model.DevStatusPending, Timestamp: &tsLater},
+				{Id: "aid3", DeviceId: "dev1", Status: model.DevStatusRejected},
+			},
+			authSetIds: []string{"aid2"},
+			// the device limit makes the acceptance fail
+			result: model.DeviceStatusResult{
+				DeviceId: "dev1",
+				Error:    ErrMaxDeviceCountReached.Error(),
+			},
+		},
+		"error, no pending auth set": {
+			status: model.DevStatusAccepted,
+			dev:    &model.Device{Id: "dev1", Status: model.DevStatusRejected},
+			sets: []model.AuthSet{
+				{Id: "aid1", DeviceId: "dev1", Status: model.DevStatusRejected},
+			},
+			result: model.DeviceStatusResult{
+				DeviceId: "dev1",
+				Error:    ErrNoPendingAuthSet.Error(),
+			},
+		},
+		"error, device not found": {
+			status: model.DevStatusRejected,
+			devErr: store.ErrDevNotFound,
+			result: model.DeviceStatusResult{
+				DeviceId: "dev1",
+				Error:    ErrDeviceNotFound.Error(),
+			},
+		},
+		"error, db": {
+			status:  model.DevStatusRejected,
+			dev:     &model.Device{Id: "dev1", Status: model.DevStatusPending},
+			setsErr: errors.New("db connection failed"),
+			result: model.DeviceStatusResult{
+				DeviceId: "dev1",
+				Error:    "internal error",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			ctxMatcher := mtesting.ContextMatcher()
+
+			db := mstore.DataStore{}
+			db.On("GetDeviceById", ctxMatcher, "dev1").
+				Return(tc.dev, tc.devErr)
+			db.On("GetAuthSetsForDevice", ctxMatcher, "dev1").
+				Return(tc.sets, tc.setsErr)
+			for i := range tc.sets {
+				db.On("GetAuthSetById", ctxMatcher, tc.sets[i].Id).
+					Return(&tc.sets[i], nil)
+			}
+			db.On("UpdateAuthSet", ctxMatcher,
+				mock.AnythingOfType("model.AuthSet"),
+				model.AuthSetUpdate{
+					Status: model.DevStatusRejected,
+				}).Return(nil)
+			db.On("GetDeviceStatus", ctxMatcher, "dev1").
+				Return(model.DevStatusRejected, nil)
+			db.On("SetDeviceStatus", ctxMatcher,
+				"dev1", model.DevStatusRejected).
+				Return(model.DevStatusPending, nil)
+			db.On("AddDeviceStatusChange", ctxMatcher,
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
+			db.On("GetLimit", ctxMatcher, model.LimitMaxDeviceCount).
+				Return(&model.Limit{
+					Name:  model.LimitMaxDeviceCount,
+					Value: 1,
+				}, nil)
+			db.On("GetDevCountByStatus", ctxMatcher, model.DevStatusAccepted).
+				Return(1, nil)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			results, err := devauth.UpdateDevicesStatus(ctx,
+				&model.DevicesStatusReq{
+					Status:    tc.status,
+					DeviceIds: []string{"dev1"},
+				})
+			assert.NoError(t, err)
+			assert.Equal(t, []model.DeviceStatusResult{tc.result}, results)
+
+			updated := map[string]bool{}
+			for _, id := range tc.authSetIds {
+				updated[id] = true
+			}
+			for _, set := range tc.sets {
+				if updated[set.Id] {
+					db.AssertCalled(t, "GetAuthSetById", ctxMatcher, set.Id)
+				} else {
+					db.AssertNotCalled(t, "GetAuthSetById", ctxMatcher, set.Id)
+				}
+			}
+		})
+	}
+}
+
+func TestDevAuthUpdateDevicesStatusFilter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctxMatcher := mtesting.ContextMatcher()
+
+	filter := store.DeviceFilter{
+		Status: model.DevStatusAccepted,
+		Group:  "site-1",
+		Search: "SN00",
+	}
+
+	db := mstore.DataStore{}
+	db.On("GetDevices", ctxMatcher,
+		uint(0), uint(model.DevicesStatusMaxCount), filter).
+		Return([]model.Device{
+			{Id: "dev1", Status: model.DevStatusAccepted},
+			{Id: "dev2", Status: model.DevStatusAccepted},
+		}, nil).Once()
+	db.On("GetDeviceById", ctxMatcher, "dev1").
+		Return(&model.Device{Id: "dev1", Status: model.DevStatusAccepted}, nil)
+	db.On("GetDeviceById", ctxMatcher, "dev2").
+		Return(&model.Device{Id: "dev2", Status: model.DevStatusAccepted}, nil)
+
+	devauth := NewDevAuth(&db, nil, nil, Config{})
+
+	results, err := devauth.UpdateDevicesStatus(ctx,
+		&model.DevicesStatusReq{
+			Status: model.DevStatusAccepted,
+			Filter: &model.DevicesStatusFilter{
+				Status: filter.Status,
+				Group:  filter.Group,
+				Search: filter.Search,
+			},
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.DeviceStatusResult{
+		{DeviceId: "dev1", Status: model.DevStatusAccepted},
+		{DeviceId: "dev2", Status: model.DevStatusAccepted},
+	}, results)
+
+	db.On("GetDevices", ctxMatcher,
+		uint(0), uint(model.DevicesStatusMaxCount), filter).
+		Return(nil, errors.New("db connection failed"))
+
+	results, err = devauth.UpdateDevicesStatus(ctx,
+		&model.DevicesStatusReq{
+			Status: model.DevStatusAccepted,
+			Filter: &model.DevicesStatusFilter{
+				Status: filter.Status,
+				Group:  filter.Group,
+				Search: filter.Search,
+			},
+		})
+	assert.EqualError(t, err, "failed to fetch devices: db connection failed")
+	assert.Nil(t, results)
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+)
+
+var (
+	MsgErrDevAuthUnauthorized = catalog.Message(catalog.CodeUnauthorized)
+	MsgErrDevAuthBadRequest   = catalog.Message(catalog.CodeBadRequest)
+)
+
+// ErrorKind classifies application errors; the API layer maps each kind to
+// a response status
+type ErrorKind int
+
+const (
+	ErrKindInternal ErrorKind = iota
+	ErrKindBadRequest
+	ErrKindUnauthorized
+	ErrKindNotFound
+	ErrKindConflict
+	ErrKindUnprocessable
+	ErrKindForbidden
+)
+
+// Error is an application error. Message is safe to return to the client,
+// and can be localized by its catalog code; Err, if set, carries the internal
+// detail meant for the logs.
+type Error struct {
+	Kind    ErrorKind
+	Code    catalog.Code
+	Message string
+	Err     error
+}
+
+// NewError creates an error of given kind, with the catalog message of the
+// code and without further detail
+func NewError(kind ErrorKind, code catalog.Code) error {
+	return &Error{
+		Kind:    kind,
+		Code:    code,
+		Message: catalog.Message(code),
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of an application error, possibly wrapped with
+// errors.Wrap; any other error is internal
+func KindOf(err error) ErrorKind {
+	if e, ok := errors.Cause(err).(*Error); ok {
+		return e.Kind
+	}
+	return ErrKindInternal
+}
+
+var (
+	ErrDevAuthUnauthorized   = NewError(ErrKindUnauthorized, catalog.CodeUnauthorized)
+	ErrDevIdAuthIdMismatch   = NewError(ErrKindBadRequest, catalog.CodeDevIdAuthIdMismatch)
+	ErrMaxDeviceCountReached = NewError(ErrKindUnprocessable, catalog.CodeMaxDeviceCountReached)
+	ErrDeviceExists          = NewError(ErrKindConflict, catalog.CodeDeviceExists)
+	ErrDeviceNotFound        = NewError(ErrKindNotFound, catalog.CodeDeviceNotFound)
+	ErrDevAuthBadRequest     = NewError(ErrKindBadRequest, catalog.CodeBadRequest)
+)
+
+func IsErrDevAuthUnauthorized(e error) bool {
+	return KindOf(e) == ErrKindUnauthorized
+}
+
+// MakeErrDevAuthUnauthorized wraps e as an unauthorized error; the root
+// cause of e is what the client gets to see
+func MakeErrDevAuthUnauthorized(e error) error {
+	return &Error{
+		Kind:    ErrKindUnauthorized,
+		Code:    catalog.CodeUnauthorized,
+		Message: errors.Cause(e).Error(),
+		Err:     errors.Wrap(e, MsgErrDevAuthUnauthorized),
+	}
+}
+
+func IsErrDevAuthBadRequest(e error) bool {
+	return KindOf(e) == ErrKindBadRequest
+}
+
+// MakeErrDevAuthBadRequest wraps e as a bad request error; the root cause
+// of e is what the client gets to see
+func MakeErrDevAuthBadRequest(e error) error {
+	return &Error{
+		Kind:    ErrKindBadRequest,
+		Code:    catalog.CodeBadRequest,
+		Message: errors.Cause(e).Error(),
+		Err:     errors.Wrap(e, MsgErrDevAuthBadRequest),
+	}
+}
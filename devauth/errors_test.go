@@ -0,0 +1,80 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorKind(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		err error
+
+		kind    ErrorKind
+		message string
+		str     string
+	}{
+		"sentinel": {
+			err: ErrDeviceExists,
+
+			kind:    ErrKindConflict,
+			message: "device already exists",
+			str:     "device already exists",
+		},
+		"wrapped sentinel": {
+			err: errors.Wrap(ErrMaxDeviceCountReached, "failed to accept device"),
+
+			kind:    ErrKindUnprocessable,
+			message: "maximum number of accepted devices reached",
+			str:     "failed to accept device: maximum number of accepted devices reached",
+		},
+		"unauthorized": {
+			err: MakeErrDevAuthUnauthorized(
+				errors.Wrap(errors.New("account suspended"), "token verification failed")),
+
+			kind:    ErrKindUnauthorized,
+			message: "account suspended",
+			str:     "dev auth: unauthorized: token verification failed: account suspended",
+		},
+		"bad request": {
+			err: MakeErrDevAuthBadRequest(errors.New("invalid id data")),
+
+			kind:    ErrKindBadRequest,
+			message: "invalid id data",
+			str:     "dev auth: bad request: invalid id data",
+		},
+		"untyped": {
+			err: errors.New("db connection lost"),
+
+			kind: ErrKindInternal,
+			str:  "db connection lost",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.kind, KindOf(tc.err))
+			assert.EqualError(t, tc.err, tc.str)
+
+			if e, ok := errors.Cause(tc.err).(*Error); ok {
+				assert.Equal(t, tc.message, e.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+// checkKeyPolicy rejects device public keys weaker than the key policy
+// allows; the client is told why
+func (d *DevAuth) checkKeyPolicy(ctx context.Context, key interface{}) error {
+	err := d.config.KeyPolicy.Check(key)
+	if err == nil {
+		return nil
+	}
+
+	log.FromContext(ctx).Warnf("public key rejected by key policy: %v", err)
+	return &Error{
+		Kind:    ErrKindBadRequest,
+		Code:    catalog.CodeWeakKey,
+		Message: fmt.Sprintf("%s: %v", catalog.Message(catalog.CodeWeakKey), err),
+		Err:     err,
+	}
+}
+
+// GetKeyPolicy returns the key policy enforced on auth requests
+func (d *DevAuth) GetKeyPolicy(ctx context.Context) (*model.KeyPolicy, error) {
+	policy := d.config.KeyPolicy
+	if policy.AllowedKeyTypes == nil {
+		policy.AllowedKeyTypes = []string{}
+	}
+	return &policy, nil
+}
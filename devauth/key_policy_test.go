@@ -0,0 +1,107 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+func TestDevAuthCheckKeyPolicy(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		policy model.KeyPolicy
+		key    interface{}
+
+		err string
+	}{
+		"ok, no policy": {
+			key: &rsaKey.PublicKey,
+		},
+		"ok, RSA": {
+			policy: model.KeyPolicy{MinRSABits: 1024},
+			key:    &rsaKey.PublicKey,
+		},
+		"ok, ECDSA": {
+			policy: model.KeyPolicy{MinRSABits: 2048},
+			key:    &ecKey.PublicKey,
+		},
+		"ok, allowed type": {
+			policy: model.KeyPolicy{AllowedKeyTypes: []string{"rsa", "ed25519"}},
+			key:    edKey,
+		},
+		"error, RSA too short": {
+			policy: model.KeyPolicy{MinRSABits: 2048},
+			key:    &rsaKey.PublicKey,
+			err: "public key doesn't meet the key policy: " +
+				"RSA key of 1024 bits is shorter than the minimum of 2048 bits",
+		},
+		"error, type not allowed": {
+			policy: model.KeyPolicy{AllowedKeyTypes: []string{"rsa", "ed25519"}},
+			key:    &ecKey.PublicKey,
+			err: "public key doesn't meet the key policy: " +
+				"key type ecdsa-p256 is not allowed",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			d := NewDevAuth(nil, nil, nil, Config{
+				KeyPolicy: tc.policy,
+			})
+
+			err := d.checkKeyPolicy(context.Background(), tc.key)
+			if tc.err != "" {
+				assert.Equal(t, ErrKindBadRequest, KindOf(err))
+				assert.Equal(t, catalog.CodeWeakKey, err.(*Error).Code)
+				assert.Equal(t, tc.err, err.(*Error).Message)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDevAuthGetKeyPolicy(t *testing.T) {
+	t.Parallel()
+
+	d := NewDevAuth(nil, nil, nil, Config{
+		KeyPolicy: model.KeyPolicy{MinRSABits: 2048},
+	})
+
+	policy, err := d.GetKeyPolicy(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &model.KeyPolicy{
+		MinRSABits:      2048,
+		AllowedKeyTypes: []string{},
+	}, policy)
+}
@@ -0,0 +1,144 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/revocation"
+	"github.com/mendersoftware/deviceauth/store"
+	"github.com/mendersoftware/deviceauth/utils"
+	uto "github.com/mendersoftware/deviceauth/utils/to"
+)
+
+var (
+	ErrDeviceKeyExists = NewError(ErrKindConflict, catalog.CodeDeviceKeyExists)
+)
+
+// RotateDeviceKey replaces the key of the device's accepted auth set with
+// the new key, without the device having to be accepted again; tokens and
+// refresh tokens issued for the old key are revoked. The request is
+// expected to be signed with the old key; the new key has to pass the
+// enrollment checks a new auth set would.
+func (d *DevAuth) RotateDeviceKey(ctx context.Context, r *model.KeyRotationReq) error {
+	l := log.FromContext(ctx)
+
+	ctx, err := d.authRequestContext(ctx, &model.AuthReq{TenantToken: r.TenantToken})
+	if err != nil {
+		return err
+	}
+
+	if err := d.verifyRotatedKey(ctx, r); err != nil {
+		return err
+	}
+
+	_, idDataSha256, err := parseIdData(r.IdData)
+	if err != nil {
+		return MakeErrDevAuthBadRequest(err)
+	}
+
+	authSet, err := d.db.GetAuthSetByIdDataHashKey(ctx, idDataSha256, r.PubKey)
+	switch {
+	case err == store.ErrDevNotFound:
+		return ErrDevAuthUnauthorized
+	case err != nil:
+		return errors.Wrap(err, "failed to get auth set")
+	case authSet.Status != model.DevStatusAccepted:
+		return ErrDevAuthUnauthorized
+	}
+
+	_, err = d.db.GetAuthSetByIdDataHashKey(ctx, idDataSha256, r.NewPubKey)
+	if err == nil {
+		return ErrDeviceKeyExists
+	} else if err != store.ErrDevNotFound {
+		return errors.Wrap(err, "failed to get auth set")
+	}
+
+	// the swap only applies if the auth set wasn't changed in between
+	keyType := utils.KeyType(r.NewPubKeyStruct)
+	err = d.db.UpdateAuthSet(ctx,
+		model.AuthSet{
+			Id:     authSet.Id,
+			PubKey: r.PubKey,
+			Status: model.DevStatusAccepted,
+		},
+		model.AuthSetUpdate{
+			PubKey:    r.NewPubKey,
+			KeyType:   keyType,
+			Timestamp: uto.TimePtr(time.Now()),
+			// the attestation was of the old key
+			ClearTPMAttestation: true,
+		})
+	if err == store.ErrAuthSetNotFound {
+		return ErrDevAuthUnauthorized
+	} else if err != nil {
+		return errors.Wrap(err, "failed to update auth set")
+	}
+
+	err = d.db.UpdateDevice(ctx, model.Device{Id: authSet.DeviceId}, model.DeviceUpdate{
+		PubKey:    r.NewPubKey,
+		KeyType:   keyType,
+		UpdatedTs: uto.TimePtr(time.Now()),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to update device")
+	}
+
+	if err := d.deleteDeviceTokens(ctx, authSet.DeviceId,
+		revocation.ReasonKeyRotated); err != nil &&
+		err != store.ErrTokenNotFound {
+		return errors.Wrap(err, "failed to revoke device tokens")
+	}
+	err = d.db.DeleteRefreshTokens(ctx, tenantFromContext(ctx), authSet.DeviceId)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke device refresh tokens")
+	}
+
+	l.Infof("device %s rotated the key of auth set %s", authSet.DeviceId, authSet.Id)
+
+	return nil
+}
+
+// verifyRotatedKey runs the enrollment checks of verifyAuthRequest on the
+// new key: the TLS client certificate must match the identity data, and
+// with certificate enrollment enabled, the new key must come with a trusted
+// certificate, as the auth set may be bound to one
+func (d *DevAuth) verifyRotatedKey(ctx context.Context, r *model.KeyRotationReq) error {
+	req := &model.AuthReq{
+		IdData:       r.IdData,
+		PubKey:       r.NewPubKey,
+		PubKeyStruct: r.NewPubKeyStruct,
+		CertChain:    r.CertChain,
+		ClientCert:   r.ClientCert,
+	}
+
+	if err := d.verifyClientCert(ctx, req); err != nil {
+		return err
+	}
+
+	if d.config.DeviceCACerts != nil && len(r.CertChain) == 0 {
+		return ErrDeviceCertRequired
+	}
+	if err := d.verifyDeviceCert(ctx, req); err != nil {
+		return err
+	}
+
+	return d.checkKeyPolicy(ctx, r.NewPubKeyStruct)
+}
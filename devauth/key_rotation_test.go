@@ -0,0 +1,221 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	"github.com/mendersoftware/deviceauth/utils"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthRotateDeviceKey(t *testing.T) {
+	t.Parallel()
+
+	newKey := func() (string, interface{}) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		pem, err := utils.SerializePubKey(key.Public())
+		assert.NoError(t, err)
+		return pem, key.Public()
+	}
+	oldKey, _ := newKey()
+	newPubKey, newKeyStruct := newKey()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	ca, _ := mtesting.IssueCert("CA", caKey.Public(), nil, caKey, true, t)
+	caCerts := x509.NewCertPool()
+	caCerts.AddCert(ca)
+	devCert, _ := mtesting.IssueCert("dev", newKeyStruct, ca, caKey, false, t)
+	selfSigned, _ := mtesting.IssueCert("dev", caKey.Public(), nil, caKey, false, t)
+	clientCert, _ := mtesting.IssueCert("00:01:02:03:04:05", newKeyStruct, ca, caKey, false, t)
+
+	idData := `{"mac":"00:01:02:03:04:05"}`
+	_, idDataHash, err := parseIdData(idData)
+	assert.NoError(t, err)
+
+	req := &model.KeyRotationReq{
+		IdData:          idData,
+		PubKey:          oldKey,
+		NewPubKey:       newPubKey,
+		NewPubKeyStruct: newKeyStruct,
+	}
+
+	accepted := &model.AuthSet{
+		Id:       "aid1",
+		DeviceId: "dev1",
+		PubKey:   oldKey,
+		Status:   model.DevStatusAccepted,
+	}
+	pending := &model.AuthSet{
+		Id:       "aid1",
+		DeviceId: "dev1",
+		PubKey:   oldKey,
+		Status:   model.DevStatusPending,
+	}
+
+	testCases := map[string]struct {
+		keyPolicy model.KeyPolicy
+		caCerts   *x509.CertPool
+		mtlsAttr  string
+
+		certChain  []*x509.Certificate
+		clientCert *x509.Certificate
+
+		authSet    *model.AuthSet
+		authSetErr error
+		newKeyErr  error
+		updateErr  error
+		tokensErr  error
+		refreshErr error
+
+		err string
+	}{
+		"ok": {
+			authSet:   accepted,
+			newKeyErr: store.ErrDevNotFound,
+		},
+		"ok, device certificate": {
+			caCerts:   caCerts,
+			certChain: []*x509.Certificate{devCert},
+			authSet:   accepted,
+			newKeyErr: store.ErrDevNotFound,
+		},
+		"ok, client certificate": {
+			mtlsAttr:   "mac",
+			clientCert: clientCert,
+			authSet:    accepted,
+			newKeyErr:  store.ErrDevNotFound,
+		},
+		"error, device certificate required": {
+			caCerts: caCerts,
+			authSet: accepted,
+			err:     ErrDeviceCertRequired.Error(),
+		},
+		"error, device certificate not trusted": {
+			caCerts:   caCerts,
+			certChain: []*x509.Certificate{selfSigned},
+			authSet:   accepted,
+			err:       ErrDeviceCertNotTrusted.Error(),
+		},
+		"error, client certificate required": {
+			mtlsAttr: "mac",
+			authSet:  accepted,
+			err:      ErrClientCertRequired.Error(),
+		},
+		"error, refresh tokens": {
+			authSet:    accepted,
+			newKeyErr:  store.ErrDevNotFound,
+			refreshErr: errors.New("db failed"),
+			err:        "failed to revoke device refresh tokens: db failed",
+		},
+		"ok, no tokens": {
+			authSet:   accepted,
+			newKeyErr: store.ErrDevNotFound,
+			tokensErr: store.ErrTokenNotFound,
+		},
+		"error, unknown auth set": {
+			authSetErr: store.ErrDevNotFound,
+			err:        ErrDevAuthUnauthorized.Error(),
+		},
+		"error, auth set not accepted": {
+			authSet: pending,
+			err:     ErrDevAuthUnauthorized.Error(),
+		},
+		"error, new key exists": {
+			authSet: accepted,
+			err:     ErrDeviceKeyExists.Error(),
+		},
+		"error, new key too weak": {
+			keyPolicy: model.KeyPolicy{AllowedKeyTypes: []string{"rsa"}},
+			err:       "key type ecdsa-p256 is not allowed",
+		},
+		"error, auth set changed": {
+			authSet:   accepted,
+			newKeyErr: store.ErrDevNotFound,
+			updateErr: store.ErrAuthSetNotFound,
+			err:       ErrDevAuthUnauthorized.Error(),
+		},
+		"error, db": {
+			authSet:   accepted,
+			newKeyErr: store.ErrDevNotFound,
+			updateErr: errors.New("db failed"),
+			err:       "failed to update auth set: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetAuthSetByIdDataHashKey", ctx, idDataHash, oldKey).
+				Return(tc.authSet, tc.authSetErr)
+			db.On("GetAuthSetByIdDataHashKey", ctx, idDataHash, newPubKey).
+				Return(nil, tc.newKeyErr)
+			db.On("UpdateAuthSet", ctx,
+				model.AuthSet{
+					Id:     "aid1",
+					PubKey: oldKey,
+					Status: model.DevStatusAccepted,
+				},
+				mock.MatchedBy(func(up model.AuthSetUpdate) bool {
+					return up.PubKey == newPubKey && up.KeyType == "ecdsa-p256" &&
+						up.ClearTPMAttestation
+				})).
+				Return(tc.updateErr)
+			db.On("UpdateDevice", ctx, model.Device{Id: "dev1"},
+				mock.MatchedBy(func(up model.DeviceUpdate) bool {
+					return up.PubKey == newPubKey
+				})).
+				Return(nil)
+			db.On("DeleteTokenByDevId", ctx, "dev1").Return(tc.tokensErr)
+			db.On("DeleteRefreshTokens", ctx, "", "dev1").Return(tc.refreshErr)
+
+			d := NewDevAuth(db, nil, nil, Config{
+				KeyPolicy:             tc.keyPolicy,
+				DeviceCACerts:         tc.caCerts,
+				MTLSIdentityAttribute: tc.mtlsAttr,
+			})
+
+			r := *req
+			r.CertChain = tc.certChain
+			r.ClientCert = tc.clientCert
+
+			err := d.RotateDeviceKey(ctx, &r)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				if tc.refreshErr == nil {
+					db.AssertNotCalled(t, "DeleteTokenByDevId", ctx, "dev1")
+				}
+			} else {
+				assert.NoError(t, err)
+				db.AssertExpectations(t)
+			}
+		})
+	}
+}
@@ -14,10 +14,12 @@
 package mocks
 
 import context "context"
-
+import jwt "github.com/mendersoftware/deviceauth/jwt"
 import mock "github.com/stretchr/testify/mock"
 import model "github.com/mendersoftware/deviceauth/model"
+import revocation "github.com/mendersoftware/deviceauth/revocation"
 import store "github.com/mendersoftware/deviceauth/store"
+import time "time"
 
 // App is an autogenerated mock type for the App type
 type App struct {
@@ -38,6 +40,106 @@ func (_m *App) AcceptDeviceAuth(ctx context.Context, dev_id string, auth_id stri
 	return r0
 }
 
+// AcceptDeviceTransfer provides a mock function with given fields: ctx, id
+func (_m *App) AcceptDeviceTransfer(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CancelDeviceTransfer provides a mock function with given fields: ctx, id
+func (_m *App) CancelDeviceTransfer(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CancelScheduledDecommission provides a mock function with given fields: ctx, devId
+func (_m *App) CancelScheduledDecommission(ctx context.Context, devId string) error {
+	ret := _m.Called(ctx, devId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, devId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CountDevices provides a mock function with given fields: ctx, filter
+func (_m *App) CountDevices(ctx context.Context, filter store.DeviceFilter) (int, error) {
+	ret := _m.Called(ctx, filter)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, store.DeviceFilter) int); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, store.DeviceFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateBootstrapToken provides a mock function with given fields: ctx, req
+func (_m *App) CreateBootstrapToken(ctx context.Context, req *model.BootstrapTokenReq) (*model.NewBootstrapToken, error) {
+	ret := _m.Called(ctx, req)
+
+	var r0 *model.NewBootstrapToken
+	if rf, ok := ret.Get(0).(func(context.Context, *model.BootstrapTokenReq) *model.NewBootstrapToken); ok {
+		r0 = rf(ctx, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.NewBootstrapToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.BootstrapTokenReq) error); ok {
+		r1 = rf(ctx, req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeclineDeviceTransfer provides a mock function with given fields: ctx, id
+func (_m *App) DeclineDeviceTransfer(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DecommissionDevice provides a mock function with given fields: ctx, dev_id
 func (_m *App) DecommissionDevice(ctx context.Context, dev_id string) error {
 	ret := _m.Called(ctx, dev_id)
@@ -80,6 +182,34 @@ func (_m *App) DeleteTokens(ctx context.Context, tenant_id string, device_id str
 	return r0
 }
 
+// DismissDeviceAuth provides a mock function with given fields: ctx, dev_id, auth_id
+func (_m *App) DismissDeviceAuth(ctx context.Context, dev_id string, auth_id string) error {
+	ret := _m.Called(ctx, dev_id, auth_id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, dev_id, auth_id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ExportDevices provides a mock function with given fields: ctx, filter, fn
+func (_m *App) ExportDevices(ctx context.Context, filter store.DeviceFilter, fn func(*model.Device) error) error {
+	ret := _m.Called(ctx, filter, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, store.DeviceFilter, func(*model.Device) error) error); ok {
+		r0 = rf(ctx, filter, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetDevCountByStatus provides a mock function with given fields: ctx, status
 func (_m *App) GetDevCountByStatus(ctx context.Context, status string) (int, error) {
 	ret := _m.Called(ctx, status)
@@ -101,6 +231,29 @@ func (_m *App) GetDevCountByStatus(ctx context.Context, status string) (int, err
 	return r0, r1
 }
 
+// GetDevCounts provides a mock function with given fields: ctx
+func (_m *App) GetDevCounts(ctx context.Context) (*model.DeviceCounts, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.DeviceCounts
+	if rf, ok := ret.Get(0).(func(context.Context) *model.DeviceCounts); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceCounts)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetDevice provides a mock function with given fields: ctx, dev_id
 func (_m *App) GetDevice(ctx context.Context, dev_id string) (*model.Device, error) {
 	ret := _m.Called(ctx, dev_id)
@@ -124,22 +277,22 @@ func (_m *App) GetDevice(ctx context.Context, dev_id string) (*model.Device, err
 	return r0, r1
 }
 
-// GetDeviceToken provides a mock function with given fields: ctx, dev_id
-func (_m *App) GetDeviceToken(ctx context.Context, dev_id string) (*model.Token, error) {
-	ret := _m.Called(ctx, dev_id)
+// GetDeviceAuthSet provides a mock function with given fields: ctx, dev_id, auth_id
+func (_m *App) GetDeviceAuthSet(ctx context.Context, dev_id string, auth_id string) (*model.AuthSet, error) {
+	ret := _m.Called(ctx, dev_id, auth_id)
 
-	var r0 *model.Token
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Token); ok {
-		r0 = rf(ctx, dev_id)
+	var r0 *model.AuthSet
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.AuthSet); ok {
+		r0 = rf(ctx, dev_id, auth_id)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.Token)
+			r0 = ret.Get(0).(*model.AuthSet)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, dev_id)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, dev_id, auth_id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -147,22 +300,22 @@ func (_m *App) GetDeviceToken(ctx context.Context, dev_id string) (*model.Token,
 	return r0, r1
 }
 
-// GetDevices provides a mock function with given fields: ctx, skip, limit, filter
-func (_m *App) GetDevices(ctx context.Context, skip uint, limit uint, filter store.DeviceFilter) ([]model.Device, error) {
-	ret := _m.Called(ctx, skip, limit, filter)
+// GetDeviceAuthorization provides a mock function with given fields: ctx, userCode
+func (_m *App) GetDeviceAuthorization(ctx context.Context, userCode string) (*model.DeviceCode, error) {
+	ret := _m.Called(ctx, userCode)
 
-	var r0 []model.Device
-	if rf, ok := ret.Get(0).(func(context.Context, uint, uint, store.DeviceFilter) []model.Device); ok {
-		r0 = rf(ctx, skip, limit, filter)
+	var r0 *model.DeviceCode
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.DeviceCode); ok {
+		r0 = rf(ctx, userCode)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.Device)
+			r0 = ret.Get(0).(*model.DeviceCode)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, uint, uint, store.DeviceFilter) error); ok {
-		r1 = rf(ctx, skip, limit, filter)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userCode)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -170,22 +323,22 @@ func (_m *App) GetDevices(ctx context.Context, skip uint, limit uint, filter sto
 	return r0, r1
 }
 
-// GetLimit provides a mock function with given fields: ctx, name
-func (_m *App) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
-	ret := _m.Called(ctx, name)
+// GetDeviceKeys provides a mock function with given fields: ctx, dev_id
+func (_m *App) GetDeviceKeys(ctx context.Context, dev_id string) ([]model.DeviceKey, error) {
+	ret := _m.Called(ctx, dev_id)
 
-	var r0 *model.Limit
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Limit); ok {
-		r0 = rf(ctx, name)
+	var r0 []model.DeviceKey
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.DeviceKey); ok {
+		r0 = rf(ctx, dev_id)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.Limit)
+			r0 = ret.Get(0).([]model.DeviceKey)
 		}
 	}
 
 	var r1 error
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, name)
+		r1 = rf(ctx, dev_id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -193,22 +346,22 @@ func (_m *App) GetLimit(ctx context.Context, name string) (*model.Limit, error)
 	return r0, r1
 }
 
-// GetTenantDeviceStatus provides a mock function with given fields: ctx, tenantId, deviceId
-func (_m *App) GetTenantDeviceStatus(ctx context.Context, tenantId string, deviceId string) (*model.Status, error) {
-	ret := _m.Called(ctx, tenantId, deviceId)
+// GetDeviceLimitUsage provides a mock function with given fields: ctx
+func (_m *App) GetDeviceLimitUsage(ctx context.Context) (*model.DeviceLimitUsage, error) {
+	ret := _m.Called(ctx)
 
-	var r0 *model.Status
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.Status); ok {
-		r0 = rf(ctx, tenantId, deviceId)
+	var r0 *model.DeviceLimitUsage
+	if rf, ok := ret.Get(0).(func(context.Context) *model.DeviceLimitUsage); ok {
+		r0 = rf(ctx)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.Status)
+			r0 = ret.Get(0).(*model.DeviceLimitUsage)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
-		r1 = rf(ctx, tenantId, deviceId)
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -216,22 +369,22 @@ func (_m *App) GetTenantDeviceStatus(ctx context.Context, tenantId string, devic
 	return r0, r1
 }
 
-// GetTenantLimit provides a mock function with given fields: ctx, name, tenant_id
-func (_m *App) GetTenantLimit(ctx context.Context, name string, tenant_id string) (*model.Limit, error) {
-	ret := _m.Called(ctx, name, tenant_id)
+// GetDeviceStatusChanges provides a mock function with given fields: ctx, after, limit
+func (_m *App) GetDeviceStatusChanges(ctx context.Context, after *store.Cursor, limit uint) ([]model.DeviceStatusChange, error) {
+	ret := _m.Called(ctx, after, limit)
 
-	var r0 *model.Limit
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.Limit); ok {
-		r0 = rf(ctx, name, tenant_id)
+	var r0 []model.DeviceStatusChange
+	if rf, ok := ret.Get(0).(func(context.Context, *store.Cursor, uint) []model.DeviceStatusChange); ok {
+		r0 = rf(ctx, after, limit)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.Limit)
+			r0 = ret.Get(0).([]model.DeviceStatusChange)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
-		r1 = rf(ctx, name, tenant_id)
+	if rf, ok := ret.Get(1).(func(context.Context, *store.Cursor, uint) error); ok {
+		r1 = rf(ctx, after, limit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -239,104 +392,890 @@ func (_m *App) GetTenantLimit(ctx context.Context, name string, tenant_id string
 	return r0, r1
 }
 
-// PreauthorizeDevice provides a mock function with given fields: ctx, req
-func (_m *App) PreauthorizeDevice(ctx context.Context, req *model.PreAuthReq) error {
-	ret := _m.Called(ctx, req)
+// GetDeviceStatusHistory provides a mock function with given fields: ctx, dev_id, skip, limit
+func (_m *App) GetDeviceStatusHistory(ctx context.Context, dev_id string, skip uint, limit uint) ([]model.DeviceStatusChange, error) {
+	ret := _m.Called(ctx, dev_id, skip, limit)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, *model.PreAuthReq) error); ok {
-		r0 = rf(ctx, req)
+	var r0 []model.DeviceStatusChange
+	if rf, ok := ret.Get(0).(func(context.Context, string, uint, uint) []model.DeviceStatusChange); ok {
+		r0 = rf(ctx, dev_id, skip, limit)
 	} else {
-		r0 = ret.Error(0)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceStatusChange)
+		}
 	}
 
-	return r0
-}
-
-// ProvisionTenant provides a mock function with given fields: ctx, tenant_id
-func (_m *App) ProvisionTenant(ctx context.Context, tenant_id string) error {
-	ret := _m.Called(ctx, tenant_id)
-
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, tenant_id)
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, uint, uint) error); ok {
+		r1 = rf(ctx, dev_id, skip, limit)
 	} else {
-		r0 = ret.Error(0)
+		r1 = ret.Error(1)
 	}
 
-	return r0
+	return r0, r1
 }
 
-// RejectDeviceAuth provides a mock function with given fields: ctx, dev_id, auth_id
-func (_m *App) RejectDeviceAuth(ctx context.Context, dev_id string, auth_id string) error {
-	ret := _m.Called(ctx, dev_id, auth_id)
+// GetDeviceToken provides a mock function with given fields: ctx, dev_id
+func (_m *App) GetDeviceToken(ctx context.Context, dev_id string) (*model.Token, error) {
+	ret := _m.Called(ctx, dev_id)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
-		r0 = rf(ctx, dev_id, auth_id)
+	var r0 *model.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Token); ok {
+		r0 = rf(ctx, dev_id)
 	} else {
-		r0 = ret.Error(0)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Token)
+		}
 	}
 
-	return r0
-}
-
-// ResetDeviceAuth provides a mock function with given fields: ctx, dev_id, auth_id
-func (_m *App) ResetDeviceAuth(ctx context.Context, dev_id string, auth_id string) error {
-	ret := _m.Called(ctx, dev_id, auth_id)
-
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
-		r0 = rf(ctx, dev_id, auth_id)
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, dev_id)
 	} else {
-		r0 = ret.Error(0)
+		r1 = ret.Error(1)
 	}
 
-	return r0
+	return r0, r1
 }
 
-// RevokeToken provides a mock function with given fields: ctx, token_id
-func (_m *App) RevokeToken(ctx context.Context, token_id string) error {
-	ret := _m.Called(ctx, token_id)
+// GetDeviceTokens provides a mock function with given fields: ctx, devId
+func (_m *App) GetDeviceTokens(ctx context.Context, devId string) ([]model.DeviceToken, error) {
+	ret := _m.Called(ctx, devId)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, token_id)
+	var r0 []model.DeviceToken
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.DeviceToken); ok {
+		r0 = rf(ctx, devId)
 	} else {
-		r0 = ret.Error(0)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceToken)
+		}
 	}
 
-	return r0
-}
-
-// SetTenantLimit provides a mock function with given fields: ctx, tenant_id, limit
-func (_m *App) SetTenantLimit(ctx context.Context, tenant_id string, limit model.Limit) error {
-	ret := _m.Called(ctx, tenant_id, limit)
-
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, model.Limit) error); ok {
-		r0 = rf(ctx, tenant_id, limit)
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, devId)
 	} else {
-		r0 = ret.Error(0)
+		r1 = ret.Error(1)
 	}
 
-	return r0
+	return r0, r1
 }
 
-// SubmitAuthRequest provides a mock function with given fields: ctx, r
-func (_m *App) SubmitAuthRequest(ctx context.Context, r *model.AuthReq) (string, error) {
-	ret := _m.Called(ctx, r)
+// GetDeviceTransfer provides a mock function with given fields: ctx, id
+func (_m *App) GetDeviceTransfer(ctx context.Context, id string) (*model.Transfer, error) {
+	ret := _m.Called(ctx, id)
 
-	var r0 string
-	if rf, ok := ret.Get(0).(func(context.Context, *model.AuthReq) string); ok {
-		r0 = rf(ctx, r)
+	var r0 *model.Transfer
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Transfer); ok {
+		r0 = rf(ctx, id)
 	} else {
-		r0 = ret.Get(0).(string)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Transfer)
+		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, *model.AuthReq) error); ok {
-		r1 = rf(ctx, r)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevices provides a mock function with given fields: ctx, skip, limit, filter
+func (_m *App) GetDevices(ctx context.Context, skip uint, limit uint, filter store.DeviceFilter) ([]model.Device, error) {
+	ret := _m.Called(ctx, skip, limit, filter)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, uint, uint, store.DeviceFilter) []model.Device); ok {
+		r0 = rf(ctx, skip, limit, filter)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uint, uint, store.DeviceFilter) error); ok {
+		r1 = rf(ctx, skip, limit, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJWKS provides a mock function with given fields: ctx
+func (_m *App) GetJWKS(ctx context.Context) (*jwt.JWKS, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *jwt.JWKS
+	if rf, ok := ret.Get(0).(func(context.Context) *jwt.JWKS); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*jwt.JWKS)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetKeyPolicy provides a mock function with given fields: ctx
+func (_m *App) GetKeyPolicy(ctx context.Context) (*model.KeyPolicy, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.KeyPolicy
+	if rf, ok := ret.Get(0).(func(context.Context) *model.KeyPolicy); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.KeyPolicy)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLimit provides a mock function with given fields: ctx, name
+func (_m *App) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 *model.Limit
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Limit); ok {
+		r0 = rf(ctx, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Limit)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOffboardingTokens provides a mock function with given fields: ctx, skip, limit
+func (_m *App) GetOffboardingTokens(ctx context.Context, skip uint, limit uint) ([]model.OffboardingToken, error) {
+	ret := _m.Called(ctx, skip, limit)
+
+	var r0 []model.OffboardingToken
+	if rf, ok := ret.Get(0).(func(context.Context, uint, uint) []model.OffboardingToken); ok {
+		r0 = rf(ctx, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.OffboardingToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uint, uint) error); ok {
+		r1 = rf(ctx, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRevocationGateways provides a mock function with given fields: ctx
+func (_m *App) GetRevocationGateways(ctx context.Context) ([]revocation.GatewayStatus, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []revocation.GatewayStatus
+	if rf, ok := ret.Get(0).(func(context.Context) []revocation.GatewayStatus); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]revocation.GatewayStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRevokedTokens provides a mock function with given fields: ctx, tenant_id, since, skip, limit
+func (_m *App) GetRevokedTokens(ctx context.Context, tenant_id string, since time.Time, skip uint, limit uint) ([]model.RevokedToken, error) {
+	ret := _m.Called(ctx, tenant_id, since, skip, limit)
+
+	var r0 []model.RevokedToken
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time, uint, uint) []model.RevokedToken); ok {
+		r0 = rf(ctx, tenant_id, since, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.RevokedToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time, uint, uint) error); ok {
+		r1 = rf(ctx, tenant_id, since, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetScheduledDecommissions provides a mock function with given fields: ctx, skip, limit
+func (_m *App) GetScheduledDecommissions(ctx context.Context, skip uint, limit uint) ([]model.Device, error) {
+	ret := _m.Called(ctx, skip, limit)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, uint, uint) []model.Device); ok {
+		r0 = rf(ctx, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uint, uint) error); ok {
+		r1 = rf(ctx, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetStatistics provides a mock function with given fields: ctx, period
+func (_m *App) GetStatistics(ctx context.Context, period time.Duration) (*model.Statistics, error) {
+	ret := _m.Called(ctx, period)
+
+	var r0 *model.Statistics
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration) *model.Statistics); ok {
+		r0 = rf(ctx, period)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Statistics)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Duration) error); ok {
+		r1 = rf(ctx, period)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTenantDeviceStatus provides a mock function with given fields: ctx, tenantId, deviceId
+func (_m *App) GetTenantDeviceStatus(ctx context.Context, tenantId string, deviceId string) (*model.Status, error) {
+	ret := _m.Called(ctx, tenantId, deviceId)
+
+	var r0 *model.Status
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.Status); ok {
+		r0 = rf(ctx, tenantId, deviceId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Status)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, tenantId, deviceId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTenantLimit provides a mock function with given fields: ctx, name, tenant_id
+func (_m *App) GetTenantLimit(ctx context.Context, name string, tenant_id string) (*model.Limit, error) {
+	ret := _m.Called(ctx, name, tenant_id)
+
+	var r0 *model.Limit
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.Limit); ok {
+		r0 = rf(ctx, name, tenant_id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Limit)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, name, tenant_id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTokenAuditRecords provides a mock function with given fields: ctx, filter, skip, limit
+func (_m *App) GetTokenAuditRecords(ctx context.Context, filter store.TokenAuditFilter, skip uint, limit uint) ([]model.TokenAuditRecord, error) {
+	ret := _m.Called(ctx, filter, skip, limit)
+
+	var r0 []model.TokenAuditRecord
+	if rf, ok := ret.Get(0).(func(context.Context, store.TokenAuditFilter, uint, uint) []model.TokenAuditRecord); ok {
+		r0 = rf(ctx, filter, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.TokenAuditRecord)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, store.TokenAuditFilter, uint, uint) error); ok {
+		r1 = rf(ctx, filter, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ImportPreauthorizedDevices provides a mock function with given fields: ctx, r
+func (_m *App) ImportPreauthorizedDevices(ctx context.Context, r *model.PreAuthImportReader) (*model.PreAuthImportResult, error) {
+	ret := _m.Called(ctx, r)
+
+	var r0 *model.PreAuthImportResult
+	if rf, ok := ret.Get(0).(func(context.Context, *model.PreAuthImportReader) *model.PreAuthImportResult); ok {
+		r0 = rf(ctx, r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.PreAuthImportResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.PreAuthImportReader) error); ok {
+		r1 = rf(ctx, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IntrospectToken provides a mock function with given fields: ctx, token
+func (_m *App) IntrospectToken(ctx context.Context, token string) (*model.TokenIntrospection, error) {
+	ret := _m.Called(ctx, token)
+
+	var r0 *model.TokenIntrospection
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.TokenIntrospection); ok {
+		r0 = rf(ctx, token)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TokenIntrospection)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IssueRefreshToken provides a mock function with given fields: ctx, token
+func (_m *App) IssueRefreshToken(ctx context.Context, token string) (string, error) {
+	ret := _m.Called(ctx, token)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, token)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewAuthChallenge provides a mock function with given fields: ctx, req
+func (_m *App) NewAuthChallenge(ctx context.Context, req *model.AuthChallengeReq) (*model.AuthChallenge, error) {
+	ret := _m.Called(ctx, req)
+
+	var r0 *model.AuthChallenge
+	if rf, ok := ret.Get(0).(func(context.Context, *model.AuthChallengeReq) *model.AuthChallenge); ok {
+		r0 = rf(ctx, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AuthChallenge)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.AuthChallengeReq) error); ok {
+		r1 = rf(ctx, req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PollDeviceAuthorization provides a mock function with given fields: ctx, deviceCode
+func (_m *App) PollDeviceAuthorization(ctx context.Context, deviceCode string) (string, error) {
+	ret := _m.Called(ctx, deviceCode)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, deviceCode)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, deviceCode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PreauthorizeDevice provides a mock function with given fields: ctx, req
+func (_m *App) PreauthorizeDevice(ctx context.Context, req *model.PreAuthReq) error {
+	ret := _m.Called(ctx, req)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.PreAuthReq) error); ok {
+		r0 = rf(ctx, req)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ProvisionTenant provides a mock function with given fields: ctx, tenant_id
+func (_m *App) ProvisionTenant(ctx context.Context, tenant_id string) error {
+	ret := _m.Called(ctx, tenant_id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, tenant_id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PurgeRejectedDevices provides a mock function with given fields: ctx, olderThan, dryRun
+func (_m *App) PurgeRejectedDevices(ctx context.Context, olderThan time.Duration, dryRun bool) (int, error) {
+	ret := _m.Called(ctx, olderThan, dryRun)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration, bool) int); ok {
+		r0 = rf(ctx, olderThan, dryRun)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Duration, bool) error); ok {
+		r1 = rf(ctx, olderThan, dryRun)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// QuarantineDevice provides a mock function with given fields: ctx, devId
+func (_m *App) QuarantineDevice(ctx context.Context, devId string) error {
+	ret := _m.Called(ctx, devId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, devId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RefreshToken provides a mock function with given fields: ctx, refreshToken
+func (_m *App) RefreshToken(ctx context.Context, refreshToken string) (string, string, error) {
+	ret := _m.Called(ctx, refreshToken)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, refreshToken)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func(context.Context, string) string); ok {
+		r1 = rf(ctx, refreshToken)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string) error); ok {
+		r2 = rf(ctx, refreshToken)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// RejectDeviceAuth provides a mock function with given fields: ctx, dev_id, auth_id
+func (_m *App) RejectDeviceAuth(ctx context.Context, dev_id string, auth_id string) error {
+	ret := _m.Called(ctx, dev_id, auth_id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, dev_id, auth_id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReleaseDeviceQuarantine provides a mock function with given fields: ctx, devId
+func (_m *App) ReleaseDeviceQuarantine(ctx context.Context, devId string) error {
+	ret := _m.Called(ctx, devId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, devId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RenewToken provides a mock function with given fields: ctx, token
+func (_m *App) RenewToken(ctx context.Context, token string) (string, error) {
+	ret := _m.Called(ctx, token)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, token)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ResetDeviceAuth provides a mock function with given fields: ctx, dev_id, auth_id
+func (_m *App) ResetDeviceAuth(ctx context.Context, dev_id string, auth_id string) error {
+	ret := _m.Called(ctx, dev_id, auth_id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, dev_id, auth_id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ResolveAuthSetConflict provides a mock function with given fields: ctx, devId, authId, others
+func (_m *App) ResolveAuthSetConflict(ctx context.Context, devId string, authId string, others string) error {
+	ret := _m.Called(ctx, devId, authId, others)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, devId, authId, others)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ResumeTenant provides a mock function with given fields: ctx, tenantId
+func (_m *App) ResumeTenant(ctx context.Context, tenantId string) error {
+	ret := _m.Called(ctx, tenantId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, tenantId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeDeviceKey provides a mock function with given fields: ctx, dev_id, auth_id
+func (_m *App) RevokeDeviceKey(ctx context.Context, dev_id string, auth_id string) error {
+	ret := _m.Called(ctx, dev_id, auth_id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, dev_id, auth_id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeDeviceTokens provides a mock function with given fields: ctx, dev_id
+func (_m *App) RevokeDeviceTokens(ctx context.Context, dev_id string) error {
+	ret := _m.Called(ctx, dev_id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, dev_id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeToken provides a mock function with given fields: ctx, token_id
+func (_m *App) RevokeToken(ctx context.Context, token_id string) error {
+	ret := _m.Called(ctx, token_id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, token_id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RotateDeviceKey provides a mock function with given fields: ctx, r
+func (_m *App) RotateDeviceKey(ctx context.Context, r *model.KeyRotationReq) error {
+	ret := _m.Called(ctx, r)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.KeyRotationReq) error); ok {
+		r0 = rf(ctx, r)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ScheduleDecommission provides a mock function with given fields: ctx, devId, at
+func (_m *App) ScheduleDecommission(ctx context.Context, devId string, at time.Time) error {
+	ret := _m.Called(ctx, devId, at)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, devId, at)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetDeviceAuthorizationStatus provides a mock function with given fields: ctx, userCode, status
+func (_m *App) SetDeviceAuthorizationStatus(ctx context.Context, userCode string, status string) error {
+	ret := _m.Called(ctx, userCode, status)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, userCode, status)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetDeviceGroup provides a mock function with given fields: ctx, dev_id, group
+func (_m *App) SetDeviceGroup(ctx context.Context, dev_id string, group string) error {
+	ret := _m.Called(ctx, dev_id, group)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, dev_id, group)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTenantLimit provides a mock function with given fields: ctx, tenant_id, limit
+func (_m *App) SetTenantLimit(ctx context.Context, tenant_id string, limit model.Limit) error {
+	ret := _m.Called(ctx, tenant_id, limit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.Limit) error); ok {
+		r0 = rf(ctx, tenant_id, limit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StartDeviceTransfer provides a mock function with given fields: ctx, req
+func (_m *App) StartDeviceTransfer(ctx context.Context, req *model.TransferReq) (*model.Transfer, error) {
+	ret := _m.Called(ctx, req)
+
+	var r0 *model.Transfer
+	if rf, ok := ret.Get(0).(func(context.Context, *model.TransferReq) *model.Transfer); ok {
+		r0 = rf(ctx, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Transfer)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.TransferReq) error); ok {
+		r1 = rf(ctx, req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SubmitAuthRequest provides a mock function with given fields: ctx, r
+func (_m *App) SubmitAuthRequest(ctx context.Context, r *model.AuthReq) (string, error) {
+	ret := _m.Called(ctx, r)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, *model.AuthReq) string); ok {
+		r0 = rf(ctx, r)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.AuthReq) error); ok {
+		r1 = rf(ctx, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SubmitDeviceAuthorization provides a mock function with given fields: ctx, r
+func (_m *App) SubmitDeviceAuthorization(ctx context.Context, r *model.AuthReq) (*model.DeviceAuthorization, error) {
+	ret := _m.Called(ctx, r)
+
+	var r0 *model.DeviceAuthorization
+	if rf, ok := ret.Get(0).(func(context.Context, *model.AuthReq) *model.DeviceAuthorization); ok {
+		r0 = rf(ctx, r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceAuthorization)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.AuthReq) error); ok {
+		r1 = rf(ctx, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SuspendTenant provides a mock function with given fields: ctx, tenantId
+func (_m *App) SuspendTenant(ctx context.Context, tenantId string) error {
+	ret := _m.Called(ctx, tenantId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, tenantId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateDeviceAnnotations provides a mock function with given fields: ctx, dev_id, a
+func (_m *App) UpdateDeviceAnnotations(ctx context.Context, dev_id string, a *model.DeviceAnnotations) error {
+	ret := _m.Called(ctx, dev_id, a)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *model.DeviceAnnotations) error); ok {
+		r0 = rf(ctx, dev_id, a)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateDevicesStatus provides a mock function with given fields: ctx, req
+func (_m *App) UpdateDevicesStatus(ctx context.Context, req *model.DevicesStatusReq) ([]model.DeviceStatusResult, error) {
+	ret := _m.Called(ctx, req)
+
+	var r0 []model.DeviceStatusResult
+	if rf, ok := ret.Get(0).(func(context.Context, *model.DevicesStatusReq) []model.DeviceStatusResult); ok {
+		r0 = rf(ctx, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceStatusResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.DevicesStatusReq) error); ok {
+		r1 = rf(ctx, req)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -0,0 +1,79 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mocks
+
+import crypto "crypto"
+import mock "github.com/stretchr/testify/mock"
+import model "github.com/mendersoftware/deviceauth/model"
+import x509 "crypto/x509"
+
+// TPMVerifier is an autogenerated mock type for the TPMVerifier type
+type TPMVerifier struct {
+	mock.Mock
+}
+
+// MakeCredential provides a mock function with given fields: req
+func (_m *TPMVerifier) MakeCredential(req *model.TPMCredentialReq) (*model.TPMCredential, *model.TPMActivation, error) {
+	ret := _m.Called(req)
+
+	var r0 *model.TPMCredential
+	if rf, ok := ret.Get(0).(func(*model.TPMCredentialReq) *model.TPMCredential); ok {
+		r0 = rf(req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TPMCredential)
+		}
+	}
+
+	var r1 *model.TPMActivation
+	if rf, ok := ret.Get(1).(func(*model.TPMCredentialReq) *model.TPMActivation); ok {
+		r1 = rf(req)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*model.TPMActivation)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(*model.TPMCredentialReq) error); ok {
+		r2 = rf(req)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Verify provides a mock function with given fields: att, key, qualifyingData, activation
+func (_m *TPMVerifier) Verify(att *model.TPMAttestation, key crypto.PublicKey, qualifyingData []byte, activation *model.TPMActivation) (*x509.Certificate, error) {
+	ret := _m.Called(att, key, qualifyingData, activation)
+
+	var r0 *x509.Certificate
+	if rf, ok := ret.Get(0).(func(*model.TPMAttestation, crypto.PublicKey, []byte, *model.TPMActivation) *x509.Certificate); ok {
+		r0 = rf(att, key, qualifyingData, activation)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*x509.Certificate)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*model.TPMAttestation, crypto.PublicKey, []byte, *model.TPMActivation) error); ok {
+		r1 = rf(att, key, qualifyingData, activation)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
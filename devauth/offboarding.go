@@ -0,0 +1,239 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	ctxhttpheader "github.com/mendersoftware/go-lib-micro/context/httpheader"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+const (
+	// header carrying the URI of the request a token is verified for, set
+	// by the API gateway
+	HdrOriginalURI = "X-Original-URI"
+)
+
+func (d *DevAuth) offboardingEnabled() bool {
+	return len(d.config.OffboardingTokenScope) > 0
+}
+
+// issueOffboardingToken records a final, short lived token for the auth set
+// of a device being rejected or decommissioned, if the tenant has a grace
+// period set. The token is handed out on the device's next auth request, see
+// claimOffboardingToken. Failures are logged only, they must not stop the
+// device from being cut off.
+func (d *DevAuth) issueOffboardingToken(ctx context.Context, aset *model.AuthSet, reason string) {
+	l := log.FromContext(ctx)
+
+	if !d.offboardingEnabled() {
+		return
+	}
+
+	grace, err := d.GetLimit(ctx, model.LimitOffboardingGracePeriod)
+	if err != nil {
+		l.Errorf("failed to get offboarding grace period: %v", err)
+		return
+	}
+	if grace.Value == 0 {
+		return
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		l.Errorf("failed to assign uuid: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(time.Duration(grace.Value) * time.Second)
+
+	rawJwt := &jwt.Token{
+		Claims: jwt.Claims{
+			ID:        uid.String(),
+			ExpiresAt: expiresAt.Unix(),
+			Subject:   aset.DeviceId,
+			Scope:     jwt.ScopeOffboarding,
+			Device:    true,
+		},
+	}
+	if d.verifyTenant {
+		rawJwt.Claims.Tenant = tenantFromContext(ctx)
+	}
+	iss := d.tokenIssuer(rawJwt.Claims.Tenant)
+	rawJwt.Claims.Issuer = iss.Issuer
+	rawJwt.Claims.Audience = iss.Audience
+
+	raw, err := rawJwt.MarshalJWT(d.signToken(ctx))
+	if err != nil {
+		l.Errorf("failed to generate offboarding token: %v", err)
+		return
+	}
+
+	err = d.db.AddOffboardingToken(ctx, model.OffboardingToken{
+		Id:           rawJwt.Claims.ID,
+		DeviceId:     aset.DeviceId,
+		Reason:       reason,
+		IdDataSha256: aset.IdDataSha256,
+		PubKey:       aset.PubKey,
+		Token:        string(raw),
+		CreatedTs:    now,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		l.Errorf("failed to store offboarding token: %v", err)
+		return
+	}
+
+	l.Infof("offboarding token %s issued to device %s auth set %s (%s), expires at %s",
+		rawJwt.Claims.ID, aset.DeviceId, aset.Id, reason,
+		expiresAt.Format(time.RFC3339))
+	d.auditToken(ctx, model.TokenAuditRecord{
+		Action:   model.TokenAuditActionIssued,
+		TokenId:  rawJwt.Claims.ID,
+		DeviceId: aset.DeviceId,
+		Trigger:  model.TokenAuditTriggerOffboarding,
+	})
+}
+
+// claimOffboardingToken returns the offboarding token waiting for the auth
+// request's auth set, if any; each token is handed out once
+func (d *DevAuth) claimOffboardingToken(ctx context.Context, r *model.AuthReq) (string, error) {
+	if !d.offboardingEnabled() {
+		return "", nil
+	}
+
+	_, idDataSha256, err := parseIdData(r.IdData)
+	if err != nil {
+		return "", MakeErrDevAuthBadRequest(err)
+	}
+
+	tok, err := d.db.ClaimOffboardingToken(ctx, idDataSha256, r.PubKey,
+		time.Now().UTC())
+	switch err {
+	case nil:
+		break
+	case store.ErrOffboardingTokenNotFound:
+		return "", nil
+	default:
+		return "", errors.Wrap(err, "failed to claim offboarding token")
+	}
+
+	log.FromContext(ctx).Infof("offboarding token %s handed out to device %s",
+		tok.Id, tok.DeviceId)
+
+	return tok.Token, nil
+}
+
+// verifyOffboardingToken checks the offboarding token is used within its
+// scope, as given by the original request URI, and records the use
+func (d *DevAuth) verifyOffboardingToken(ctx context.Context, token *jwt.Token) error {
+	l := log.FromContext(ctx)
+
+	jti := token.Claims.ID
+
+	uri := ctxhttpheader.FromContext(ctx, HdrOriginalURI)
+	if !d.offboardingScopeAllows(uri) {
+		l.Warnf("offboarding token %s of device %s used out of scope: %q",
+			jti, token.Claims.Subject, uri)
+		return jwt.ErrTokenInvalid
+	}
+
+	tok, err := d.db.GetOffboardingToken(ctx, jti)
+	switch err {
+	case nil:
+		break
+	case store.ErrOffboardingTokenNotFound:
+		l.Errorf("offboarding token %s not found", jti)
+		return store.ErrTokenNotFound
+	default:
+		return errors.Wrap(err, "failed to fetch offboarding token")
+	}
+
+	if tok.ClaimedTs == nil {
+		l.Errorf("offboarding token %s used before handed out", jti)
+		return jwt.ErrTokenInvalid
+	}
+
+	if err := d.db.UseOffboardingToken(ctx, jti, time.Now().UTC()); err != nil {
+		return errors.Wrap(err, "failed to record offboarding token use")
+	}
+
+	l.Infof("offboarding token %s of device %s used for %q",
+		jti, tok.DeviceId, uri)
+
+	return nil
+}
+
+func (d *DevAuth) offboardingScopeAllows(uri string) bool {
+	if !d.offboardingEnabled() {
+		return false
+	}
+	return uriInScope(uri, d.config.OffboardingTokenScope)
+}
+
+// uriInScope tells whether the path of the original request URI is one of
+// the prefixes, or below one. The URI is as the gateway received it, not
+// normalized; paths with dot segments, also percent-encoded, are refused
+// rather than resolved, as upstream services may resolve them differently.
+func uriInScope(uri string, prefixes []string) bool {
+	if uri == "" {
+		return false
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+
+	// u.Path is decoded once, which catches double encoded dots too
+	if strings.Contains(u.Path, "..") ||
+		strings.Contains(strings.ToLower(u.Path), "%2e") ||
+		strings.Contains(strings.ToLower(u.RawPath), "%2e") {
+		return false
+	}
+	p := path.Clean(u.Path)
+
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" {
+			continue
+		}
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOffboardingTokens lists the offboarding tokens issued in the tenant,
+// newest first
+func (d *DevAuth) GetOffboardingTokens(ctx context.Context, skip, limit uint) ([]model.OffboardingToken, error) {
+	toks, err := d.db.GetOffboardingTokens(ctx, skip, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list offboarding tokens")
+	}
+	return toks, nil
+}
@@ -0,0 +1,359 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	ctxhttpheader "github.com/mendersoftware/go-lib-micro/context/httpheader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+	mjwt "github.com/mendersoftware/deviceauth/jwt/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+var testOffboardingScope = []string{"/api/devices/v1/deployments/device/deployments/next"}
+
+func TestDevAuthRejectDeviceOffboardingToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		scope []string
+		grace uint64
+
+		issued bool
+	}{
+		"issued": {
+			scope:  testOffboardingScope,
+			grace:  300,
+			issued: true,
+		},
+		"no grace period": {
+			scope: testOffboardingScope,
+		},
+		"disabled": {
+			grace: 300,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctxMatcher := mtesting.ContextMatcher()
+
+			aset := &model.AuthSet{
+				Id:           "aid1",
+				DeviceId:     "dev1",
+				IdDataSha256: []byte("hash1"),
+				PubKey:       "pubkey1",
+				Status:       model.DevStatusAccepted,
+			}
+
+			db := mstore.DataStore{}
+			db.On("GetAuthSetById", ctxMatcher, "aid1").Return(aset, nil)
+			db.On("DeleteTokenByDevId", ctxMatcher, "dev1").Return(nil)
+			db.On("GetLimit", ctxMatcher, model.LimitOffboardingGracePeriod).
+				Return(&model.Limit{
+					Name:  model.LimitOffboardingGracePeriod,
+					Value: tc.grace,
+				}, nil)
+			db.On("AddOffboardingToken", ctxMatcher,
+				mock.MatchedBy(func(tok model.OffboardingToken) bool {
+					return tok.DeviceId == "dev1" &&
+						tok.Reason == model.OffboardingReasonRejected &&
+						tok.PubKey == "pubkey1" &&
+						tok.Token == "offboardingtoken" &&
+						tok.ClaimedTs == nil
+				})).Return(nil)
+			db.On("UpdateAuthSet", ctxMatcher, *aset,
+				model.AuthSetUpdate{
+					Status: model.DevStatusRejected,
+				}).Return(nil)
+			db.On("GetDeviceStatus", ctxMatcher, "dev1").
+				Return(model.DevStatusRejected, nil)
+			db.On("SetDeviceStatus", ctxMatcher,
+				mock.AnythingOfType("string"),
+				mock.AnythingOfType("string")).Return("", nil)
+			db.On("AddDeviceStatusChange", ctxMatcher,
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
+
+			jwth := mjwt.Handler{}
+			jwth.On("ToJWT",
+				mock.MatchedBy(func(jt *jwt.Token) bool {
+					return jt.Claims.Subject == "dev1" &&
+						jt.Claims.Scope == jwt.ScopeOffboarding &&
+						jt.Claims.ExpiresAt <= time.Now().Unix()+int64(tc.grace)
+				})).
+				Return("offboardingtoken", nil)
+
+			devauth := NewDevAuth(&db, nil, &jwth, Config{
+				OffboardingTokenScope: tc.scope,
+			})
+
+			err := devauth.RejectDeviceAuth(context.Background(), "dev1", "aid1")
+			assert.NoError(t, err)
+
+			if tc.issued {
+				db.AssertCalled(t, "AddOffboardingToken", ctxMatcher,
+					mock.AnythingOfType("model.OffboardingToken"))
+			} else {
+				db.AssertNotCalled(t, "AddOffboardingToken",
+					mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestDevAuthSubmitAuthRequestOffboardingToken(t *testing.T) {
+	t.Parallel()
+
+	idData := "{\"mac\":\"00:00:00:01\"}"
+	_, idDataHash, err := parseIdData(idData)
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		nonce             string
+		nonceErr          error
+		challengeRequired bool
+
+		token string
+		err   error
+	}{
+		"ok": {
+			token: "offboardingtoken",
+		},
+		"ok, nonce": {
+			nonce: "nonce1",
+			token: "offboardingtoken",
+		},
+		"error, nonce replayed": {
+			nonce:    "nonce1",
+			nonceErr: store.ErrAuthNonceNotFound,
+			err:      ErrAuthNonceInvalid,
+		},
+		"error, nonce required": {
+			challengeRequired: true,
+			err:               ErrAuthNonceRequired,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctxMatcher := mtesting.ContextMatcher()
+
+			db := mstore.DataStore{}
+			db.On("IncAuthRequestCount", ctxMatcher,
+				mock.AnythingOfType("time.Time")).Return(nil)
+			db.On("UseAuthNonce", ctxMatcher, tc.nonce,
+				mock.AnythingOfType("time.Time")).
+				Return(&model.AuthNonce{Id: tc.nonce}, tc.nonceErr)
+			db.On("ClaimOffboardingToken", ctxMatcher, idDataHash, "pubkey1",
+				mock.AnythingOfType("time.Time")).
+				Return(&model.OffboardingToken{
+					Id:       "jti1",
+					DeviceId: "dev1",
+					Token:    "offboardingtoken",
+				}, nil)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{
+				OffboardingTokenScope: testOffboardingScope,
+				AuthChallengeRequired: tc.challengeRequired,
+			})
+
+			token, err := devauth.SubmitAuthRequest(context.Background(),
+				&model.AuthReq{
+					IdData: idData,
+					PubKey: "pubkey1",
+					Nonce:  tc.nonce,
+				})
+			assert.Equal(t, tc.token, token)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				// verified before the token is handed out
+				db.AssertNotCalled(t, "ClaimOffboardingToken",
+					mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// the device isn't recorded again
+			db.AssertNotCalled(t, "AddDevice", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestURIInScope(t *testing.T) {
+	t.Parallel()
+
+	prefixes := []string{"/api/devices/v1/deployments", "/api/devices/v1/inventory/"}
+
+	testCases := map[string]struct {
+		uri string
+
+		allowed bool
+	}{
+		"prefix": {
+			uri:     "/api/devices/v1/deployments",
+			allowed: true,
+		},
+		"below prefix": {
+			uri:     "/api/devices/v1/deployments/device/deployments/next?artifact_name=foo",
+			allowed: true,
+		},
+		"below prefix with trailing slash": {
+			uri:     "/api/devices/v1/inventory/device/attributes",
+			allowed: true,
+		},
+		"redundant slashes": {
+			uri:     "/api/devices/v1//deployments/./device",
+			allowed: true,
+		},
+		"prefix of a segment": {
+			uri: "/api/devices/v1/deploymentsX/device",
+		},
+		"dot segments": {
+			uri: "/api/devices/v1/deployments/../inventory/device/attributes",
+		},
+		"encoded dot segments": {
+			uri: "/api/devices/v1/deployments/%2e%2E/inventory/device/attributes",
+		},
+		"double encoded dot segments": {
+			uri: "/api/devices/v1/deployments/%252e%252e/inventory/device/attributes",
+		},
+		"encoded slashes": {
+			uri: "/api/devices/v1/deployments%2F..%2Finventory/device/attributes",
+		},
+		"out of scope": {
+			uri: "/api/devices/v1/authentication/auth_requests",
+		},
+		"empty": {},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.allowed, uriInScope(tc.uri, prefixes))
+		})
+	}
+}
+
+func TestDevAuthVerifyOffboardingToken(t *testing.T) {
+	t.Parallel()
+
+	claimed := time.Now()
+
+	testCases := map[string]struct {
+		uri string
+
+		tok    *model.OffboardingToken
+		tokErr error
+
+		err error
+	}{
+		"ok": {
+			uri: "/api/devices/v1/deployments/device/deployments/next?artifact_name=foo",
+			tok: &model.OffboardingToken{
+				Id:        "jti1",
+				DeviceId:  "dev1",
+				ClaimedTs: &claimed,
+			},
+		},
+		"error, out of scope": {
+			uri: "/api/devices/v1/inventory/device/attributes",
+			err: jwt.ErrTokenInvalid,
+		},
+		"error, out of scope, dot segments": {
+			uri: "/api/devices/v1/deployments/device/deployments/next/../../../../inventory/device/attributes",
+			err: jwt.ErrTokenInvalid,
+		},
+		"error, no uri": {
+			err: jwt.ErrTokenInvalid,
+		},
+		"error, not found": {
+			uri:    "/api/devices/v1/deployments/device/deployments/next",
+			tokErr: store.ErrOffboardingTokenNotFound,
+			err:    store.ErrTokenNotFound,
+		},
+		"error, not handed out": {
+			uri: "/api/devices/v1/deployments/device/deployments/next",
+			tok: &model.OffboardingToken{
+				Id:       "jti1",
+				DeviceId: "dev1",
+			},
+			err: jwt.ErrTokenInvalid,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tc.uri != "" {
+				hdr := http.Header{}
+				hdr.Set(HdrOriginalURI, tc.uri)
+				ctx = ctxhttpheader.WithContext(ctx, hdr, HdrOriginalURI)
+			}
+			ctxMatcher := mtesting.ContextMatcher()
+
+			jwth := mjwt.Handler{}
+			jwth.On("FromJWT", "offboardingtoken").Return(&jwt.Token{
+				Claims: jwt.Claims{
+					ID:      "jti1",
+					Subject: "dev1",
+					Scope:   jwt.ScopeOffboarding,
+					Device:  true,
+				},
+			}, nil)
+
+			db := mstore.DataStore{}
+			db.On("GetOffboardingToken", ctxMatcher, "jti1").
+				Return(tc.tok, tc.tokErr)
+			db.On("UseOffboardingToken", ctxMatcher, "jti1",
+				mock.AnythingOfType("time.Time")).Return(nil)
+
+			devauth := NewDevAuth(&db, nil, &jwth, Config{
+				OffboardingTokenScope: testOffboardingScope,
+			})
+
+			err := devauth.VerifyToken(ctx, "offboardingtoken")
+			assert.Equal(t, tc.err, err)
+			if tc.err == nil {
+				db.AssertCalled(t, "UseOffboardingToken", ctxMatcher, "jti1",
+					mock.AnythingOfType("time.Time"))
+			} else {
+				db.AssertNotCalled(t, "UseOffboardingToken",
+					mock.Anything, mock.Anything, mock.Anything)
+			}
+			// never looked up as a regular token
+			db.AssertNotCalled(t, "GetToken", mock.Anything, mock.Anything)
+		})
+	}
+}
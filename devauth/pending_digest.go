@@ -0,0 +1,100 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/notify"
+)
+
+// SendPendingDigests notifies the operators of each tenant of the devices
+// waiting for acceptance; tenants without pending devices are skipped, and
+// tenants failing to count them are logged.
+func (d *DevAuth) SendPendingDigests(ctx context.Context) error {
+	l := log.FromContext(ctx)
+
+	if d.notifier == nil {
+		return nil
+	}
+
+	tenants := []string{""}
+	if d.verifyTenant {
+		ids, err := d.db.GetTenantIds(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list tenants")
+		}
+		tenants = ids
+	}
+
+	for _, tenantId := range tenants {
+		tenantCtx := ctx
+		if tenantId != "" {
+			tenantCtx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenantId,
+			})
+		}
+
+		count, err := d.db.GetDevCountByStatus(tenantCtx, model.DevStatusPending)
+		if err != nil {
+			l.Errorf("pending devices digest failed, tenant: %q: %v",
+				tenantId, err)
+			continue
+		}
+		if count == 0 {
+			continue
+		}
+
+		d.notify(tenantCtx, notify.Notification{
+			Kind:    notify.KindPendingDigest,
+			Subject: "Devices pending acceptance",
+			Message: fmt.Sprintf("%d devices are waiting to be accepted "+
+				"or rejected.", count),
+			Fields: map[string]string{
+				"pending_devices": strconv.Itoa(count),
+			},
+		})
+	}
+
+	return nil
+}
+
+// RunPendingDigest runs SendPendingDigests every interval, until ctx is
+// done
+func (d *DevAuth) RunPendingDigest(ctx context.Context, interval time.Duration) {
+	l := log.FromContext(ctx)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := d.SendPendingDigests(ctx); err != nil {
+			l.Errorf("pending devices digest failed: %v", err)
+		}
+	}
+}
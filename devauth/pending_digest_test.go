@@ -0,0 +1,78 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/notify"
+	mnotify "github.com/mendersoftware/deviceauth/notify/mocks"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthSendPendingDigests(t *testing.T) {
+	t.Parallel()
+
+	ctxMatcher := mtesting.ContextMatcher()
+	tenantMatcher := func(tenantId string) interface{} {
+		return mock.MatchedBy(func(ctx context.Context) bool {
+			ident := identity.FromContext(ctx)
+			return ident != nil && ident.Tenant == tenantId
+		})
+	}
+
+	db := mstore.DataStore{}
+	db.On("GetTenantIds", ctxMatcher).
+		Return([]string{"tenant1", "tenant2", "tenant3"}, nil)
+	db.On("GetDevCountByStatus", tenantMatcher("tenant1"), model.DevStatusPending).
+		Return(3, nil)
+	db.On("GetDevCountByStatus", tenantMatcher("tenant2"), model.DevStatusPending).
+		Return(0, nil)
+	db.On("GetDevCountByStatus", tenantMatcher("tenant3"), model.DevStatusPending).
+		Return(0, errors.New("db connection failed"))
+
+	// tenants without pending devices, or failing to count them, are
+	// not notified
+	notifier := mnotify.Notifier{}
+	notifier.On("Notify", tenantMatcher("tenant1"),
+		mock.MatchedBy(func(n notify.Notification) bool {
+			return n.Kind == notify.KindPendingDigest &&
+				n.TenantId == "tenant1" &&
+				n.Fields["pending_devices"] == "3"
+		})).Return()
+
+	devauth := NewDevAuth(&db, nil, nil, Config{}).WithNotifier(&notifier)
+	devauth.verifyTenant = true
+
+	err := devauth.SendPendingDigests(context.Background())
+	assert.NoError(t, err)
+
+	db.AssertExpectations(t)
+	notifier.AssertExpectations(t)
+	assert.Len(t, notifier.Calls, 1)
+
+	// no notifier, nothing to count
+	db = mstore.DataStore{}
+	devauth = NewDevAuth(&db, nil, nil, Config{})
+	assert.NoError(t, devauth.SendPendingDigests(context.Background()))
+	db.AssertNotCalled(t, "GetTenantIds", ctxMatcher)
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// number of devices written to the database at once by bulk imports
+const preAuthImportBatchSize = 500
+
+type preAuthImport struct {
+	record int
+	dev    *model.Device
+	set    *model.AuthSet
+}
+
+// ImportPreauthorizedDevices preauthorizes the devices read from r,
+// adding them to the database in batches. Malformed records and devices
+// conflicting with existing ones don't stop the import, the result lists
+// them instead. If the input can't be read to the end, the devices read
+// so far are imported and the result is returned along with the error.
+func (d *DevAuth) ImportPreauthorizedDevices(ctx context.Context, r *model.PreAuthImportReader) (*model.PreAuthImportResult, error) {
+	res := &model.PreAuthImportResult{
+		Errors: []model.PreAuthImportError{},
+	}
+
+	batch := make([]preAuthImport, 0, preAuthImportBatchSize)
+	var readErr error
+	for {
+		item, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			readErr = MakeErrDevAuthBadRequest(err)
+			break
+		}
+
+		if item.Err == nil {
+			item.Req.DeviceId = bson.NewObjectId().Hex()
+			item.Req.AuthSetId = bson.NewObjectId().Hex()
+			item.Err = item.Req.Validate()
+		}
+		var imp preAuthImport
+		if item.Err == nil {
+			imp.record = item.Record
+			imp.dev, imp.set, item.Err = newPreauthorizedDevice(&item.Req)
+		}
+		if item.Err != nil {
+			res.Errors = append(res.Errors, model.PreAuthImportError{
+				Record: item.Record,
+				Error:  item.Err.Error(),
+			})
+			continue
+		}
+
+		batch = append(batch, imp)
+		if len(batch) == preAuthImportBatchSize {
+			if err := d.importPreauthorizedBatch(ctx, batch, res); err != nil {
+				return nil, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := d.importPreauthorizedBatch(ctx, batch, res); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(res.Errors, func(i, j int) bool {
+		return res.Errors[i].Record < res.Errors[j].Record
+	})
+
+	return res, readErr
+}
+
+func (d *DevAuth) importPreauthorizedBatch(ctx context.Context, batch []preAuthImport, res *model.PreAuthImportResult) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	l := log.FromContext(ctx)
+
+	fail := func(imp preAuthImport, err error) {
+		msg := ErrDeviceExists.Error()
+		if err != store.ErrObjectExists {
+			l.Errorf("failed to import device of record %d: %v",
+				imp.record, err)
+			msg = "internal error"
+		}
+		res.Errors = append(res.Errors, model.PreAuthImportError{
+			Record: imp.record,
+			Error:  msg,
+		})
+	}
+
+	devs := make([]model.Device, len(batch))
+	for i := range batch {
+		devs[i] = *batch[i].dev
+	}
+
+	errs, err := d.db.AddDevices(ctx, devs)
+	if err != nil {
+		return errors.Wrap(err, "failed to add devices")
+	}
+
+	added := make([]preAuthImport, 0, len(batch))
+	sets := make([]model.AuthSet, 0, len(batch))
+	for i, err := range errs {
+		if err != nil {
+			fail(batch[i], err)
+			continue
+		}
+		added = append(added, batch[i])
+		sets = append(sets, *batch[i].set)
+	}
+
+	errs, err = d.db.AddAuthSets(ctx, sets)
+	if err != nil {
+		return errors.Wrap(err, "failed to add auth sets")
+	}
+
+	ids := make([]string, 0, len(added))
+	for i, err := range errs {
+		if err != nil {
+			fail(added[i], err)
+			continue
+		}
+		ids = append(ids, added[i].dev.Id)
+	}
+
+	res.Preauthorized += len(ids)
+	if len(ids) > 0 {
+		d.recordStatusChanges(ctx, ids, "", model.DevStatusPreauth)
+	}
+
+	return nil
+}
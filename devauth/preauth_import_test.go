@@ -0,0 +1,265 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	"github.com/mendersoftware/deviceauth/utils"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthImportPreauthorizedDevices(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	pubKey, err := utils.SerializePubKey(key.Public())
+	assert.NoError(t, err)
+
+	idData := func(mac string) string {
+		return fmt.Sprintf(`{"mac":"%s"}`, mac)
+	}
+	ndjson := func(lines ...string) string {
+		return strings.Join(lines, "\n")
+	}
+	line := func(mac string) string {
+		b, _ := json.Marshal(map[string]interface{}{
+			"identity_data": json.RawMessage(idData(mac)),
+			"pubkey":        pubKey,
+		})
+		return string(b)
+	}
+	csvRecords := func(records ...[]string) string {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.WriteAll(records)
+		return buf.String()
+	}
+
+	many := make([]string, preAuthImportBatchSize+1)
+	for i := range many {
+		many[i] = line(fmt.Sprintf("m%d", i))
+	}
+
+	testCases := map[string]struct {
+		input  string
+		format string
+
+		// errors of the devices and auth sets added, by identity data
+		devErrs map[string]error
+		devsErr error
+		setErrs map[string]error
+
+		batches int
+		res     *model.PreAuthImportResult
+		err     string
+	}{
+		"ok, ndjson": {
+			input:   ndjson(line("m1"), "", line("m2"), line("m3")),
+			format:  model.PreAuthImportFormatNDJSON,
+			batches: 1,
+			res: &model.PreAuthImportResult{
+				Preauthorized: 3,
+				Errors:        []model.PreAuthImportError{},
+			},
+		},
+		"ok, batches": {
+			input:   ndjson(many...),
+			format:  model.PreAuthImportFormatNDJSON,
+			batches: 2,
+			res: &model.PreAuthImportResult{
+				Preauthorized: preAuthImportBatchSize + 1,
+				Errors:        []model.PreAuthImportError{},
+			},
+		},
+		"ok, csv, some failed": {
+			input: csvRecords(
+				[]string{"serial", "pubkey", "identity_data"},
+				[]string{"1", pubKey, idData("m1")},
+				[]string{"2", pubKey, "{"},
+				[]string{"3", "", idData("m2")},
+				[]string{"4", pubKey, idData("m3")},
+				[]string{"5", pubKey, idData("m4")},
+				[]string{"6"},
+			),
+			format: model.PreAuthImportFormatCSV,
+			devErrs: map[string]error{
+				idData("m3"): store.ErrObjectExists,
+			},
+			setErrs: map[string]error{
+				idData("m4"): errors.New("db error"),
+			},
+			batches: 1,
+			res: &model.PreAuthImportResult{
+				Preauthorized: 1,
+				Errors: []model.PreAuthImportError{
+					{Record: 2, Error: "identity_data: must be a non-empty JSON object"},
+					{Record: 3, Error: "pubkey: non zero value required;"},
+					{Record: 4, Error: "device already exists"},
+					{Record: 5, Error: "internal error"},
+					{Record: 6, Error: "missing fields"},
+				},
+			},
+		},
+		"ok, nothing to import": {
+			input:  ndjson(`{"pubkey": "foo"}`, `{"pubkey": `),
+			format: model.PreAuthImportFormatNDJSON,
+			res: &model.PreAuthImportResult{
+				Errors: []model.PreAuthImportError{
+					{Record: 1, Error: "identity_data: must be a non-empty JSON object"},
+					{Record: 2, Error: "invalid JSON: unexpected end of JSON input"},
+				},
+			},
+		},
+		"error, input cut short": {
+			input:   ndjson(line("m1"), strings.Repeat("x", 65*1024)),
+			format:  model.PreAuthImportFormatNDJSON,
+			batches: 1,
+			res: &model.PreAuthImportResult{
+				Preauthorized: 1,
+				Errors:        []model.PreAuthImportError{},
+			},
+			err: "dev auth: bad request: failed to read record 2: bufio.Scanner: token too long",
+		},
+		"error, db": {
+			input:   ndjson(line("m1")),
+			format:  model.PreAuthImportFormatNDJSON,
+			devsErr: errors.New("db error"),
+			err:     "failed to add devices: db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := mstore.DataStore{}
+			if tc.devsErr != nil {
+				db.On("AddDevices", mtesting.ContextMatcher(),
+					mock.AnythingOfType("[]model.Device")).
+					Return(nil, tc.devsErr)
+			} else if tc.batches > 0 {
+				db.On("AddDevices", mtesting.ContextMatcher(),
+					mock.AnythingOfType("[]model.Device")).
+					Return(func(_ context.Context, devs []model.Device) []error {
+						errs := make([]error, len(devs))
+						for i, dev := range devs {
+							assert.Equal(t, model.DevStatusPreauth, dev.Status)
+							assert.NotEmpty(t, dev.IdDataSha256)
+							errs[i] = tc.devErrs[dev.IdData]
+						}
+						return errs
+					}, nil).
+					Times(tc.batches)
+				db.On("AddAuthSets", mtesting.ContextMatcher(),
+					mock.AnythingOfType("[]model.AuthSet")).
+					Return(func(_ context.Context, sets []model.AuthSet) []error {
+						errs := make([]error, len(sets))
+						for i, set := range sets {
+							assert.Equal(t, model.DevStatusPreauth, set.Status)
+							assert.Equal(t, pubKey, set.PubKey)
+							errs[i] = tc.setErrs[set.IdData]
+						}
+						return errs
+					}, nil).
+					Times(tc.batches)
+				db.On("AddDeviceStatusChanges", mtesting.ContextMatcher(),
+					mock.AnythingOfType("[]model.DeviceStatusChange")).
+					Return(nil).
+					Times(tc.batches)
+			}
+
+			in, err := model.NewPreAuthImportReader(
+				strings.NewReader(tc.input), tc.format)
+			assert.NoError(t, err)
+
+			d := NewDevAuth(&db, nil, nil, Config{})
+			res, err := d.ImportPreauthorizedDevices(ctx, in)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.res, res)
+
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestNewPreAuthImportReader(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input  string
+		format string
+		err    string
+	}{
+		"ok, csv": {
+			input:  "pubkey,identity_data\n",
+			format: model.PreAuthImportFormatCSV,
+		},
+		"ok, ndjson": {
+			format: model.PreAuthImportFormatNDJSON,
+		},
+		"error, csv header": {
+			format: model.PreAuthImportFormatCSV,
+			err:    "missing CSV header",
+		},
+		"error, csv column": {
+			input:  "identity_data\n",
+			format: model.PreAuthImportFormatCSV,
+			err:    "missing CSV column: pubkey",
+		},
+		"error, format": {
+			format: "xml",
+			err:    "unsupported import format: xml",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := model.NewPreAuthImportReader(
+				strings.NewReader(tc.input), tc.format)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/revocation"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+var (
+	ErrDeviceQuarantined    = NewError(ErrKindForbidden, catalog.CodeDeviceQuarantined)
+	ErrDeviceNotQuarantined = NewError(ErrKindConflict, catalog.CodeDeviceNotQuarantined)
+)
+
+// QuarantineDevice sets the device aside while it's investigated, e.g. as
+// possibly compromised: its tokens are revoked, and its auth requests are
+// refused with ErrDeviceQuarantined until it's released. Unlike rejecting
+// the device, this keeps the statuses of its auth sets.
+func (d *DevAuth) QuarantineDevice(ctx context.Context, devId string) error {
+	dev, err := d.db.GetDeviceById(ctx, devId)
+	switch err {
+	case nil:
+		break
+	case store.ErrDevNotFound:
+		return ErrDeviceNotFound
+	default:
+		return errors.Wrap(err, "db get device error")
+	}
+
+	if dev.Status != model.DevStatusQuarantined {
+		if err := d.updateDeviceStatus(ctx, devId, model.DevStatusQuarantined); err != nil {
+			return err
+		}
+	}
+
+	// revoked again when already quarantined, e.g. on a retry after failing
+	// to revoke the first time
+	err = d.deleteDeviceTokens(ctx, devId, revocation.ReasonQuarantined)
+	if err != nil && err != store.ErrTokenNotFound {
+		return errors.Wrap(err, "db delete device tokens error")
+	}
+	if err := d.db.DeleteRefreshTokens(ctx, tenantFromContext(ctx), devId); err != nil {
+		return errors.Wrap(err, "db delete refresh tokens error")
+	}
+
+	return nil
+}
+
+// ReleaseDeviceQuarantine ends the device's quarantine; the device gets the
+// status of its auth sets back, and may authenticate again if one of them
+// is accepted
+func (d *DevAuth) ReleaseDeviceQuarantine(ctx context.Context, devId string) error {
+	dev, err := d.db.GetDeviceById(ctx, devId)
+	switch err {
+	case nil:
+		break
+	case store.ErrDevNotFound:
+		return ErrDeviceNotFound
+	default:
+		return errors.Wrap(err, "db get device error")
+	}
+
+	if dev.Status != model.DevStatusQuarantined {
+		return ErrDeviceNotQuarantined
+	}
+
+	status, err := d.db.GetDeviceStatus(ctx, devId)
+	switch err {
+	case nil:
+		break
+	case store.ErrAuthSetNotFound:
+		status = model.DevStatusRejected
+	default:
+		return errors.Wrap(err, "Cannot determine device status")
+	}
+
+	switch err := d.db.ReleaseQuarantinedDevice(ctx, devId, status); err {
+	case nil:
+		break
+	case store.ErrDevNotFound:
+		// released in the meantime
+		return ErrDeviceNotQuarantined
+	default:
+		return errors.Wrap(err, "failed to release device")
+	}
+
+	d.recordStatusChange(ctx, devId, model.DevStatusQuarantined, status)
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthQuarantineDevice(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dev    *model.Device
+		devErr error
+
+		tokensErr error
+
+		err string
+	}{
+		"ok": {
+			dev: &model.Device{Id: "dev1", Status: model.DevStatusAccepted},
+		},
+		"ok, already quarantined": {
+			dev: &model.Device{Id: "dev1", Status: model.DevStatusQuarantined},
+		},
+		"ok, no tokens": {
+			dev:       &model.Device{Id: "dev1", Status: model.DevStatusPending},
+			tokensErr: store.ErrTokenNotFound,
+		},
+		"error, device not found": {
+			devErr: store.ErrDevNotFound,
+			err:    ErrDeviceNotFound.Error(),
+		},
+		"error, tokens": {
+			dev:       &model.Device{Id: "dev1", Status: model.DevStatusAccepted},
+			tokensErr: errors.New("db connection failed"),
+			err:       "db delete device tokens error: db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := mstore.DataStore{}
+			db.On("GetDeviceById", mtesting.ContextMatcher(), "dev1").
+				Return(tc.dev, tc.devErr)
+			if tc.dev != nil {
+				db.On("SetDeviceStatus", mtesting.ContextMatcher(),
+					"dev1", model.DevStatusQuarantined).
+					Return(tc.dev.Status, nil)
+			}
+			db.On("AddDeviceStatusChange", mtesting.ContextMatcher(),
+				mock.MatchedBy(func(r model.DeviceStatusChange) bool {
+					return r.DeviceId == "dev1" &&
+						r.From == tc.dev.Status &&
+						r.To == model.DevStatusQuarantined
+				})).
+				Return(nil)
+			db.On("DeleteTokenByDevId", mtesting.ContextMatcher(), "dev1").
+				Return(tc.tokensErr)
+			db.On("DeleteRefreshTokens", mtesting.ContextMatcher(), "", "dev1").
+				Return(nil)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.QuarantineDevice(ctx, "dev1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				db.AssertCalled(t, "DeleteRefreshTokens",
+					mtesting.ContextMatcher(), "", "dev1")
+			}
+
+			if tc.dev == nil || tc.dev.Status == model.DevStatusQuarantined {
+				db.AssertNotCalled(t, "SetDeviceStatus",
+					mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestDevAuthReleaseDeviceQuarantine(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dev    *model.Device
+		devErr error
+
+		status    string
+		statusErr error
+
+		releaseErr error
+
+		outStatus string
+		err       string
+	}{
+		"ok": {
+			dev:       &model.Device{Id: "dev1", Status: model.DevStatusQuarantined},
+			status:    model.DevStatusAccepted,
+			outStatus: model.DevStatusAccepted,
+		},
+		"ok, no auth sets": {
+			dev:       &model.Device{Id: "dev1", Status: model.DevStatusQuarantined},
+			statusErr: store.ErrAuthSetNotFound,
+			outStatus: model.DevStatusRejected,
+		},
+		"error, device not found": {
+			devErr: store.ErrDevNotFound,
+			err:    ErrDeviceNotFound.Error(),
+		},
+		"error, not quarantined": {
+			dev: &model.Device{Id: "dev1", Status: model.DevStatusAccepted},
+			err: ErrDeviceNotQuarantined.Error(),
+		},
+		"error, released in the meantime": {
+			dev:        &model.Device{Id: "dev1", Status: model.DevStatusQuarantined},
+			status:     model.DevStatusAccepted,
+			outStatus:  model.DevStatusAccepted,
+			releaseErr: store.ErrDevNotFound,
+			err:        ErrDeviceNotQuarantined.Error(),
+		},
+		"error, db": {
+			dev:        &model.Device{Id: "dev1", Status: model.DevStatusQuarantined},
+			status:     model.DevStatusPending,
+			outStatus:  model.DevStatusPending,
+			releaseErr: errors.New("db connection failed"),
+			err:        "failed to release device: db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := mstore.DataStore{}
+			db.On("GetDeviceById", mtesting.ContextMatcher(), "dev1").
+				Return(tc.dev, tc.devErr)
+			db.On("GetDeviceStatus", mtesting.ContextMatcher(), "dev1").
+				Return(tc.status, tc.statusErr)
+			db.On("ReleaseQuarantinedDevice", mtesting.ContextMatcher(),
+				"dev1", tc.outStatus).
+				Return(tc.releaseErr)
+			db.On("AddDeviceStatusChange", mtesting.ContextMatcher(),
+				mock.MatchedBy(func(r model.DeviceStatusChange) bool {
+					return r.DeviceId == "dev1" &&
+						r.From == model.DevStatusQuarantined &&
+						r.To == tc.outStatus
+				})).
+				Return(nil)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.ReleaseDeviceQuarantine(ctx, "dev1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				db.AssertNotCalled(t, "AddDeviceStatusChange",
+					mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				db.AssertCalled(t, "AddDeviceStatusChange",
+					mtesting.ContextMatcher(), mock.Anything)
+			}
+		})
+	}
+}
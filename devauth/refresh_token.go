@@ -0,0 +1,155 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+var (
+	ErrInvalidRefreshToken = NewError(ErrKindBadRequest, catalog.CodeInvalidRefreshToken)
+)
+
+const (
+	refreshTokenLength = 32
+)
+
+// IssueRefreshToken hands out a refresh token along with a freshly issued
+// device token, for the device to get its next token without another signed
+// auth request; returns an empty string if refresh tokens are disabled
+func (d *DevAuth) IssueRefreshToken(ctx context.Context, token string) (string, error) {
+	if d.config.RefreshExpirationTime == 0 {
+		return "", nil
+	}
+
+	jwToken, err := d.jwt.FromJWT(token)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse token")
+	}
+
+	// continue in the context of device's tenant
+	if jwToken.Claims.Tenant != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{
+			Tenant: jwToken.Claims.Tenant,
+		})
+	}
+
+	tok, err := d.db.GetToken(ctx, jwToken.Claims.ID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get token")
+	}
+
+	return d.issueRefreshToken(ctx, jwToken.Claims.Tenant, tok.DevId, tok.AuthSetId)
+}
+
+// RefreshToken exchanges a refresh token for a new device token and refresh
+// token; the auth set the refresh token was issued for must still be accepted
+func (d *DevAuth) RefreshToken(ctx context.Context, refreshToken string) (string, string, error) {
+	if d.config.RefreshExpirationTime == 0 {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	rt, err := d.db.UseRefreshToken(ctx, hashCode(refreshToken), time.Now())
+	if err != nil {
+		if err == store.ErrRefreshTokenNotFound {
+			return "", "", ErrInvalidRefreshToken
+		}
+		return "", "", errors.Wrap(err, "failed to use refresh token")
+	}
+
+	// continue in the context of device's tenant
+	if rt.TenantId != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{
+			Tenant: rt.TenantId,
+		})
+	}
+
+	l := log.FromContext(ctx)
+
+	authSet, err := d.db.GetAuthSetById(ctx, rt.AuthSetId)
+	if err != nil && err != store.ErrDevNotFound {
+		return "", "", errors.Wrap(err, "db get auth set error")
+	}
+	if authSet == nil || authSet.Status != model.DevStatusAccepted {
+		l.Warnf("refresh token of device %s used, auth set %s no longer accepted",
+			rt.DeviceId, rt.AuthSetId)
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	dev, err := d.db.GetDeviceById(ctx, authSet.DeviceId)
+	if err != nil {
+		return "", "", errors.Wrap(err, "db get device error")
+	}
+	if dev.Decommissioning {
+		l.Warnf("refresh token of device %s used, device is being decommissioned",
+			rt.DeviceId)
+		return "", "", ErrInvalidRefreshToken
+	}
+	if dev.Status == model.DevStatusQuarantined {
+		l.Warnf("refresh token of device %s used, device is quarantined",
+			rt.DeviceId)
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	token, err := d.issueToken(ctx, authSet, model.TokenAuditTriggerRefreshToken)
+	switch err {
+	case nil:
+		break
+	case ErrTenantSuspended:
+		l.Warnf("refresh token of device %s used, tenant is suspended",
+			rt.DeviceId)
+		return "", "", ErrInvalidRefreshToken
+	default:
+		return "", "", err
+	}
+
+	refreshToken, err = d.issueRefreshToken(ctx, rt.TenantId, rt.DeviceId, rt.AuthSetId)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, refreshToken, nil
+}
+
+func (d *DevAuth) issueRefreshToken(ctx context.Context, tenantId, devId, authSetId string) (string, error) {
+	buf := make([]byte, refreshTokenLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "failed to generate refresh token")
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(buf)
+
+	err := d.db.AddRefreshToken(ctx, model.RefreshToken{
+		Id:        hashCode(refreshToken),
+		TenantId:  tenantId,
+		DeviceId:  devId,
+		AuthSetId: authSetId,
+		ExpiresAt: time.Now().Add(time.Duration(d.config.RefreshExpirationTime) * time.Second),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to store refresh token")
+	}
+
+	return refreshToken, nil
+}
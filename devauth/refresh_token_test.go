@@ -0,0 +1,238 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+	mjwt "github.com/mendersoftware/deviceauth/jwt/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthIssueRefreshToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		expiration int64
+		tokenErr   error
+
+		err string
+	}{
+		"ok": {
+			expiration: 3600,
+		},
+		"ok, disabled": {},
+		"error, token": {
+			expiration: 3600,
+			tokenErr:   errors.New("db error"),
+			err:        "failed to get token: db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tenantCtx := mock.MatchedBy(func(ctx context.Context) bool {
+				ident := identity.FromContext(ctx)
+				return ident != nil && ident.Tenant == "tenant1"
+			})
+
+			ja := &mjwt.Handler{}
+			ja.On("FromJWT", "token").Return(&jwt.Token{
+				Claims: jwt.Claims{ID: "jti", Subject: "dev1", Tenant: "tenant1"},
+			}, nil)
+
+			db := &mstore.DataStore{}
+			var rt model.RefreshToken
+			db.On("GetToken", tenantCtx, "jti").
+				Return(&model.Token{Id: "jti", DevId: "dev1", AuthSetId: "aid1"},
+					tc.tokenErr)
+			db.On("AddRefreshToken", tenantCtx,
+				mock.AnythingOfType("model.RefreshToken")).
+				Run(func(args mock.Arguments) {
+					rt = args.Get(1).(model.RefreshToken)
+				}).
+				Return(nil)
+
+			d := NewDevAuth(db, nil, ja, Config{RefreshExpirationTime: tc.expiration})
+
+			refreshToken, err := d.IssueRefreshToken(context.Background(), "token")
+			switch {
+			case tc.err != "":
+				assert.EqualError(t, err, tc.err)
+			case tc.expiration == 0:
+				assert.NoError(t, err)
+				assert.Empty(t, refreshToken)
+				db.AssertNotCalled(t, "AddRefreshToken", mock.Anything, mock.Anything)
+			default:
+				assert.NoError(t, err)
+				assert.NotEmpty(t, refreshToken)
+				assert.Equal(t, hashCode(refreshToken), rt.Id)
+				assert.Equal(t, "tenant1", rt.TenantId)
+				assert.Equal(t, "dev1", rt.DeviceId)
+				assert.Equal(t, "aid1", rt.AuthSetId)
+				assert.WithinDuration(t, time.Now().Add(time.Hour), rt.ExpiresAt, time.Minute)
+			}
+		})
+	}
+}
+
+func TestDevAuthRefreshToken(t *testing.T) {
+	t.Parallel()
+
+	rt := &model.RefreshToken{
+		TenantId:  "tenant1",
+		DeviceId:  "dev1",
+		AuthSetId: "aid1",
+	}
+
+	testCases := map[string]struct {
+		expiration int64
+
+		rt    *model.RefreshToken
+		rtErr error
+
+		authSet *model.AuthSet
+		asErr   error
+		dev     *model.Device
+
+		suspended bool
+
+		err error
+	}{
+		"ok": {
+			expiration: 3600,
+			rt:         rt,
+			authSet: &model.AuthSet{Id: "aid1", DeviceId: "dev1",
+				Status: model.DevStatusAccepted},
+			dev: &model.Device{Id: "dev1"},
+		},
+		"error, disabled": {
+			err: ErrInvalidRefreshToken,
+		},
+		"error, not found": {
+			expiration: 3600,
+			rtErr:      store.ErrRefreshTokenNotFound,
+			err:        ErrInvalidRefreshToken,
+		},
+		"error, db": {
+			expiration: 3600,
+			rtErr:      errors.New("db error"),
+			err:        errors.New("failed to use refresh token: db error"),
+		},
+		"error, auth set rejected": {
+			expiration: 3600,
+			rt:         rt,
+			authSet: &model.AuthSet{Id: "aid1", DeviceId: "dev1",
+				Status: model.DevStatusRejected},
+			err: ErrInvalidRefreshToken,
+		},
+		"error, auth set removed": {
+			expiration: 3600,
+			rt:         rt,
+			asErr:      store.ErrDevNotFound,
+			err:        ErrInvalidRefreshToken,
+		},
+		"error, device decommissioning": {
+			expiration: 3600,
+			rt:         rt,
+			authSet: &model.AuthSet{Id: "aid1", DeviceId: "dev1",
+				Status: model.DevStatusAccepted},
+			dev: &model.Device{Id: "dev1", Decommissioning: true},
+			err: ErrInvalidRefreshToken,
+		},
+		"error, tenant suspended": {
+			expiration: 3600,
+			rt:         rt,
+			authSet: &model.AuthSet{Id: "aid1", DeviceId: "dev1",
+				Status: model.DevStatusAccepted},
+			dev:       &model.Device{Id: "dev1"},
+			suspended: true,
+			err:       ErrInvalidRefreshToken,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctxMatcher := mtesting.ContextMatcher()
+			tenantCtx := mock.MatchedBy(func(ctx context.Context) bool {
+				ident := identity.FromContext(ctx)
+				return ident != nil && ident.Tenant == "tenant1"
+			})
+
+			db := &mstore.DataStore{}
+			db.On("UseRefreshToken", ctxMatcher, hashCode("refresh"),
+				mock.AnythingOfType("time.Time")).
+				Return(tc.rt, tc.rtErr)
+			db.On("GetAuthSetById", tenantCtx, "aid1").
+				Return(tc.authSet, tc.asErr)
+			db.On("GetDeviceById", tenantCtx, "dev1").
+				Return(tc.dev, nil)
+			db.On("IsTenantSuspended", tenantCtx).
+				Return(tc.suspended, nil)
+			db.On("AddToken", tenantCtx,
+				mock.AnythingOfType("model.Token")).Return(nil)
+			db.On("GetLimit", tenantCtx, model.LimitTokenExpiration).
+				Return(nil, store.ErrLimitNotFound)
+			db.On("AddRefreshToken", tenantCtx,
+				mock.MatchedBy(func(t model.RefreshToken) bool {
+					return t.AuthSetId == "aid1" &&
+						t.Id != hashCode("refresh")
+				})).Return(nil)
+
+			ja := &mjwt.Handler{}
+			ja.On("ToJWT",
+				mock.MatchedBy(func(jt *jwt.Token) bool {
+					return jt.Claims.Subject == "dev1" &&
+						jt.Claims.Tenant == "tenant1"
+				})).
+				Return("dummytoken", nil)
+
+			d := NewDevAuth(db, nil, ja, Config{RefreshExpirationTime: tc.expiration})
+			d.verifyTenant = true
+
+			token, refreshToken, err := d.RefreshToken(context.Background(), "refresh")
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "dummytoken", token)
+				assert.NotEmpty(t, refreshToken)
+				assert.NotEqual(t, "refresh", refreshToken)
+			}
+			if tc.suspended {
+				db.AssertNotCalled(t, "AddToken", tenantCtx,
+					mock.AnythingOfType("model.Token"))
+				db.AssertNotCalled(t, "AddRefreshToken", tenantCtx,
+					mock.AnythingOfType("model.RefreshToken"))
+			}
+		})
+	}
+}
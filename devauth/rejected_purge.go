@@ -0,0 +1,136 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+)
+
+// number of stale rejected devices fetched at once by the purge
+const rejectedPurgeBatchSize = 100
+
+var (
+	ErrRejectedRetentionNotSet = NewError(ErrKindBadRequest, catalog.CodeRejectedRetentionNotSet)
+)
+
+// PurgeRejectedDevices decommissions the rejected devices which haven't
+// attempted to authenticate for longer than olderThan, or than the
+// configured retention if not given. With dryRun, the devices are only
+// counted. Returns the number of purged devices; devices failing to
+// decommission are logged and skipped.
+func (d *DevAuth) PurgeRejectedDevices(ctx context.Context, olderThan time.Duration, dryRun bool) (int, error) {
+	l := log.FromContext(ctx)
+
+	if olderThan <= 0 {
+		olderThan = time.Duration(d.config.RejectedDeviceRetention) * time.Second
+	}
+	if olderThan <= 0 {
+		return 0, ErrRejectedRetentionNotSet
+	}
+
+	before := time.Now().UTC().Add(-olderThan)
+
+	// purged devices are gone from the list, skip over the counted and
+	// failed ones only
+	purged := 0
+	var skip uint
+	for {
+		devs, err := d.db.GetStaleRejectedDevices(ctx, before, skip, rejectedPurgeBatchSize)
+		if err != nil {
+			return purged, errors.Wrap(err, "failed to list stale rejected devices")
+		}
+
+		for _, dev := range devs {
+			if dryRun {
+				purged++
+				skip++
+				continue
+			}
+			if err := d.DecommissionDevice(ctx, dev.Id); err != nil {
+				l.Errorf("failed to purge rejected device %s: %v", dev.Id, err)
+				skip++
+				continue
+			}
+			purged++
+		}
+
+		if len(devs) < rejectedPurgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// PurgeStaleRejectedDevices runs PurgeRejectedDevices with the configured
+// retention, in all tenants. Tenants failing to purge are logged and
+// retried on the next run.
+func (d *DevAuth) PurgeStaleRejectedDevices(ctx context.Context) error {
+	l := log.FromContext(ctx)
+
+	tenants := []string{""}
+	if d.verifyTenant {
+		ids, err := d.db.GetTenantIds(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list tenants")
+		}
+		tenants = ids
+	}
+
+	for _, tenantId := range tenants {
+		tenantCtx := ctx
+		if tenantId != "" {
+			tenantCtx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenantId,
+			})
+		}
+
+		n, err := d.PurgeRejectedDevices(tenantCtx, 0, false)
+		if err != nil {
+			l.Errorf("rejected devices purge failed, tenant: %q: %v",
+				tenantId, err)
+		}
+		if n > 0 {
+			l.Infof("purged %d rejected devices, tenant: %q", n, tenantId)
+		}
+	}
+
+	return nil
+}
+
+// RunRejectedDevicePurge runs PurgeStaleRejectedDevices every interval,
+// until ctx is done
+func (d *DevAuth) RunRejectedDevicePurge(ctx context.Context, interval time.Duration) {
+	l := log.FromContext(ctx)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := d.PurgeStaleRejectedDevices(ctx); err != nil {
+			l.Errorf("rejected devices purge failed: %v", err)
+		}
+	}
+}
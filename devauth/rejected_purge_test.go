@@ -0,0 +1,224 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	morchestrator "github.com/mendersoftware/deviceauth/client/orchestrator/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthPurgeRejectedDevices(t *testing.T) {
+	t.Parallel()
+
+	ctxMatcher := mtesting.ContextMatcher()
+	// the cutoff, give or take the test run time
+	beforeMatcher := func(age time.Duration) interface{} {
+		return mock.MatchedBy(func(before time.Time) bool {
+			d := time.Since(before) - age
+			return d >= 0 && d < time.Minute
+		})
+	}
+
+	fullBatch := make([]model.Device, rejectedPurgeBatchSize)
+	for i := range fullBatch {
+		fullBatch[i] = model.Device{Id: "stale"}
+	}
+
+	testCases := map[string]struct {
+		retention int64
+		olderThan time.Duration
+		dryRun    bool
+
+		age     time.Duration
+		batches [][]model.Device
+		listErr error
+
+		purged   []string
+		failed   []string
+		outCount int
+		outErr   error
+	}{
+		"ok, configured retention": {
+			retention: 30 * 24 * 3600,
+
+			age: 30 * 24 * time.Hour,
+			batches: [][]model.Device{
+				{{Id: "dev1"}, {Id: "dev2"}},
+			},
+
+			purged:   []string{"dev1", "dev2"},
+			outCount: 2,
+		},
+		"ok, given age overrides retention": {
+			retention: 30 * 24 * 3600,
+			olderThan: 7 * 24 * time.Hour,
+
+			age: 7 * 24 * time.Hour,
+			batches: [][]model.Device{
+				{{Id: "dev1"}, {Id: "dev2"}},
+			},
+
+			purged:   []string{"dev1", "dev2"},
+			outCount: 2,
+		},
+		"ok, failed devices skipped": {
+			olderThan: 7 * 24 * time.Hour,
+
+			age: 7 * 24 * time.Hour,
+			batches: [][]model.Device{
+				{{Id: "dev1"}, {Id: "dev2"}},
+			},
+
+			purged:   []string{"dev2"},
+			failed:   []string{"dev1"},
+			outCount: 1,
+		},
+		"ok, dry run": {
+			olderThan: 7 * 24 * time.Hour,
+			dryRun:    true,
+
+			age: 7 * 24 * time.Hour,
+			batches: [][]model.Device{
+				fullBatch,
+				{{Id: "dev1"}},
+			},
+
+			outCount: rejectedPurgeBatchSize + 1,
+		},
+		"error, no retention": {
+			outErr: ErrRejectedRetentionNotSet,
+		},
+		"error, db": {
+			olderThan: 7 * 24 * time.Hour,
+
+			age:     7 * 24 * time.Hour,
+			listErr: errors.New("db connection failed"),
+
+			outErr: errors.New("failed to list stale rejected devices: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			db := &mstore.DataStore{}
+			co := &morchestrator.ClientRunner{}
+
+			if tc.listErr != nil {
+				db.On("GetStaleRejectedDevices", ctxMatcher,
+					beforeMatcher(tc.age), uint(0), uint(rejectedPurgeBatchSize)).
+					Return(nil, tc.listErr)
+			}
+			// the dry run pages through the devices, the purge finds the
+			// purged ones gone
+			skip := uint(0)
+			for _, devs := range tc.batches {
+				db.On("GetStaleRejectedDevices", ctxMatcher,
+					beforeMatcher(tc.age), skip, uint(rejectedPurgeBatchSize)).
+					Return(devs, nil)
+				if tc.dryRun {
+					skip += uint(len(devs))
+				}
+			}
+			for _, id := range tc.failed {
+				db.On("UpdateDevice", ctxMatcher, model.Device{Id: id},
+					mock.AnythingOfType("model.DeviceUpdate")).
+					Return(errors.New("db connection failed"))
+			}
+			for _, id := range tc.purged {
+				db.On("UpdateDevice", ctxMatcher, model.Device{Id: id},
+					mock.AnythingOfType("model.DeviceUpdate")).Return(nil)
+				db.On("DeleteAuthSetsForDevice", ctxMatcher, id).Return(nil)
+				db.On("DeleteTokenByDevId", ctxMatcher, id).Return(nil)
+				db.On("DeleteDevice", ctxMatcher, id).Return(nil)
+			}
+			co.On("SubmitDeviceDecommisioningJob", ctxMatcher,
+				mock.AnythingOfType("orchestrator.DecommissioningReq")).Return(nil)
+
+			devauth := NewDevAuth(db, co, nil, Config{
+				RejectedDeviceRetention: tc.retention,
+			})
+
+			n, err := devauth.PurgeRejectedDevices(context.Background(),
+				tc.olderThan, tc.dryRun)
+			if tc.outErr != nil {
+				assert.EqualError(t, err, tc.outErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.outCount, n)
+
+			if tc.dryRun {
+				db.AssertNotCalled(t, "UpdateDevice",
+					mock.Anything, mock.Anything, mock.Anything)
+			}
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDevAuthPurgeStaleRejectedDevices(t *testing.T) {
+	t.Parallel()
+
+	ctxMatcher := mtesting.ContextMatcher()
+	tenantMatcher := func(tenantId string) interface{} {
+		return mock.MatchedBy(func(ctx context.Context) bool {
+			ident := identity.FromContext(ctx)
+			return ident != nil && ident.Tenant == tenantId
+		})
+	}
+
+	db := mstore.DataStore{}
+	db.On("GetTenantIds", ctxMatcher).Return([]string{"tenant1", "tenant2"}, nil)
+	db.On("GetStaleRejectedDevices", tenantMatcher("tenant1"),
+		mock.AnythingOfType("time.Time"), uint(0), uint(rejectedPurgeBatchSize)).
+		Return(nil, errors.New("db connection failed"))
+	db.On("GetStaleRejectedDevices", tenantMatcher("tenant2"),
+		mock.AnythingOfType("time.Time"), uint(0), uint(rejectedPurgeBatchSize)).
+		Return([]model.Device{{Id: "dev1"}}, nil)
+	db.On("UpdateDevice", ctxMatcher, model.Device{Id: "dev1"},
+		mock.AnythingOfType("model.DeviceUpdate")).Return(nil)
+	db.On("DeleteAuthSetsForDevice", ctxMatcher, "dev1").Return(nil)
+	db.On("DeleteTokenByDevId", ctxMatcher, "dev1").Return(nil)
+	db.On("DeleteDevice", ctxMatcher, "dev1").Return(nil)
+
+	co := morchestrator.ClientRunner{}
+	co.On("SubmitDeviceDecommisioningJob", ctxMatcher,
+		mock.AnythingOfType("orchestrator.DecommissioningReq")).Return(nil)
+
+	devauth := NewDevAuth(&db, &co, nil, Config{
+		RejectedDeviceRetention: 30 * 24 * 3600,
+	})
+	devauth.verifyTenant = true
+
+	// tenant1 failing doesn't stop tenant2
+	err := devauth.PurgeStaleRejectedDevices(context.Background())
+	assert.NoError(t, err)
+
+	db.AssertCalled(t, "DeleteDevice", ctxMatcher, "dev1")
+	db.AssertExpectations(t)
+}
@@ -0,0 +1,79 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/revocation"
+)
+
+// WithRevocationPublisher will make devauth push token revocations to the
+// gateways verifying tokens offline, as they happen. Returns an updated
+// devauth.
+func (d *DevAuth) WithRevocationPublisher(p revocation.Publisher) *DevAuth {
+	d.revocations = p
+	return d
+}
+
+// publishRevocation records the revocation in the token audit trail, and
+// pushes it for the tenant in context, if configured
+func (d *DevAuth) publishRevocation(ctx context.Context, e revocation.Event) {
+	trigger := e.Reason
+	if trigger == "" {
+		trigger = revocation.ReasonRevoked
+	}
+	d.auditToken(ctx, model.TokenAuditRecord{
+		Action:   model.TokenAuditActionRevoked,
+		TokenId:  e.TokenId,
+		DeviceId: e.DeviceId,
+		Trigger:  trigger,
+	})
+
+	if d.revocations == nil {
+		return
+	}
+
+	if ident := identity.FromContext(ctx); ident != nil {
+		e.TenantId = ident.Tenant
+	}
+	d.revocations.Publish(ctx, e)
+}
+
+// deleteDeviceTokens deletes all tokens of the device and publishes the
+// revocation; returns store.ErrTokenNotFound if the device has none
+func (d *DevAuth) deleteDeviceTokens(ctx context.Context, devId, reason string) error {
+	if err := d.db.DeleteTokenByDevId(ctx, devId); err != nil {
+		return err
+	}
+
+	d.publishRevocation(ctx, revocation.Event{
+		Kind:     revocation.KindDeviceRevoked,
+		DeviceId: devId,
+		Reason:   reason,
+	})
+	return nil
+}
+
+// GetRevocationGateways returns the revocation delivery status of the
+// gateways, none if revocations are not published
+func (d *DevAuth) GetRevocationGateways(ctx context.Context) ([]revocation.GatewayStatus, error) {
+	if d.revocations == nil {
+		return []revocation.GatewayStatus{}, nil
+	}
+	return d.revocations.Status(), nil
+}
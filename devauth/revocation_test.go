@@ -0,0 +1,158 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/revocation"
+	mrevocation "github.com/mendersoftware/deviceauth/revocation/mocks"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthPublishRevocation(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		revoke func(ctx context.Context, d *DevAuth) error
+
+		dbErr error
+
+		event *revocation.Event
+		err   string
+	}{
+		"token": {
+			revoke: func(ctx context.Context, d *DevAuth) error {
+				return d.RevokeToken(ctx, "jti1")
+			},
+			event: &revocation.Event{
+				Kind:     revocation.KindTokenRevoked,
+				TenantId: "tenant1",
+				TokenId:  "jti1",
+			},
+		},
+		"token, not found": {
+			revoke: func(ctx context.Context, d *DevAuth) error {
+				return d.RevokeToken(ctx, "jti1")
+			},
+			dbErr: store.ErrTokenNotFound,
+			err:   store.ErrTokenNotFound.Error(),
+		},
+		"device tokens": {
+			revoke: func(ctx context.Context, d *DevAuth) error {
+				return d.DeleteTokens(ctx, "tenant1", "dev1")
+			},
+			event: &revocation.Event{
+				Kind:     revocation.KindDeviceRevoked,
+				TenantId: "tenant1",
+				DeviceId: "dev1",
+				Reason:   revocation.ReasonRevoked,
+			},
+		},
+		"device tokens, none": {
+			revoke: func(ctx context.Context, d *DevAuth) error {
+				return d.DeleteTokens(ctx, "tenant1", "dev1")
+			},
+			dbErr: store.ErrTokenNotFound,
+		},
+		"device tokens, error": {
+			revoke: func(ctx context.Context, d *DevAuth) error {
+				return d.DeleteTokens(ctx, "tenant1", "dev1")
+			},
+			dbErr: errors.New("db error"),
+			err:   "failed to delete tokens for tenant: tenant1, device id: dev1: db error",
+		},
+		"tenant tokens": {
+			revoke: func(ctx context.Context, d *DevAuth) error {
+				return d.DeleteTokens(ctx, "tenant1", "")
+			},
+			event: &revocation.Event{
+				Kind:     revocation.KindTenantRevoked,
+				TenantId: "tenant1",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Tenant: "tenant1"})
+
+			db := &mstore.DataStore{}
+			db.On("DeleteToken", mtesting.ContextMatcher(), "jti1").
+				Return(tc.dbErr)
+			db.On("DeleteTokenByDevId", mtesting.ContextMatcher(), "dev1").
+				Return(tc.dbErr)
+			db.On("DeleteTokens", mtesting.ContextMatcher()).
+				Return(tc.dbErr)
+			db.On("DeleteRefreshTokens", mtesting.ContextMatcher(),
+				"tenant1", mock.AnythingOfType("string")).
+				Return(nil)
+
+			publisher := &mrevocation.Publisher{}
+			if tc.event != nil {
+				publisher.On("Publish", mtesting.ContextMatcher(), *tc.event).
+					Return()
+			}
+
+			d := NewDevAuth(db, nil, nil, Config{}).
+				WithRevocationPublisher(publisher)
+
+			err := tc.revoke(ctx, d)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			publisher.AssertExpectations(t)
+			if tc.event == nil {
+				publisher.AssertNotCalled(t, "Publish",
+					mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestDevAuthGetRevocationGateways(t *testing.T) {
+	t.Parallel()
+
+	d := NewDevAuth(&mstore.DataStore{}, nil, nil, Config{})
+
+	status, err := d.GetRevocationGateways(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []revocation.GatewayStatus{}, status)
+
+	gateways := []revocation.GatewayStatus{
+		{Name: "edge", URL: "https://edge", Delivered: 2},
+	}
+	publisher := &mrevocation.Publisher{}
+	publisher.On("Status").Return(gateways)
+
+	status, err = d.WithRevocationPublisher(publisher).
+		GetRevocationGateways(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, gateways, status)
+}
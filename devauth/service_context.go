@@ -0,0 +1,88 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	ctxhttpheader "github.com/mendersoftware/go-lib-micro/context/httpheader"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+)
+
+const (
+	// subject of the tokens deviceauth authorizes its own requests with
+	serviceTokenSubject = "deviceauth"
+	// expiration of the service tokens, long enough for the workflows
+	// started with them to finish
+	serviceTokenExpiration = time.Hour
+)
+
+// serviceContext returns a context for requests deviceauth makes on its own,
+// not on behalf of the caller, e.g. from background jobs: the requests are
+// done for the tenant, authorized with a short lived token signed by
+// deviceauth. The request ID in ctx is kept, a new one is assigned if
+// there's none.
+func (d *DevAuth) serviceContext(ctx context.Context, tenantId string) (context.Context, error) {
+	if requestid.FromContext(ctx) == "" {
+		uid, err := uuid.NewV4()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate request id")
+		}
+		ctx = requestid.WithContext(ctx, uid.String())
+	}
+
+	if tenantId != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{
+			Tenant: tenantId,
+		})
+	}
+
+	tid, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate token id")
+	}
+
+	rawJwt := &jwt.Token{
+		Claims: jwt.Claims{
+			ID:        tid.String(),
+			ExpiresAt: time.Now().Add(serviceTokenExpiration).Unix(),
+			Subject:   serviceTokenSubject,
+			Tenant:    tenantId,
+		},
+	}
+	iss := d.tokenIssuer(tenantId)
+	rawJwt.Claims.Issuer = iss.Issuer
+	rawJwt.Claims.Audience = iss.Audience
+
+	raw, err := rawJwt.MarshalJWT(d.signToken(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate service token")
+	}
+
+	ctx = ctxhttpheader.WithContext(ctx,
+		http.Header{
+			"Authorization": []string{fmt.Sprintf("Bearer %s", raw)},
+		},
+		"Authorization")
+
+	return ctx, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+// countAuthRequest counts the auth request in the hourly statistics;
+// failures are only logged, the statistics don't hold up the device
+func (d *DevAuth) countAuthRequest(ctx context.Context) {
+	if err := d.db.IncAuthRequestCount(ctx, time.Now()); err != nil {
+		log.FromContext(ctx).Errorf("failed to count auth request: %v", err)
+	}
+}
+
+// GetStatistics aggregates the state of the tenant's devices, and their
+// activity in the period up to now, rounded up to whole hours. Every hour
+// of the period is listed in the auth request counts, the ones without
+// requests too.
+func (d *DevAuth) GetStatistics(ctx context.Context, period time.Duration) (*model.Statistics, error) {
+	hours := int((period + time.Hour - 1) / time.Hour)
+	if hours < 1 {
+		hours = 1
+	}
+
+	last := time.Now().UTC().Truncate(time.Hour)
+	since := last.Add(-time.Duration(hours-1) * time.Hour)
+
+	stats, err := d.db.GetStatistics(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]int, len(stats.AuthRequests))
+	for _, c := range stats.AuthRequests {
+		counts[c.Hour.Unix()] = c.Count
+	}
+
+	stats.AuthRequests = make([]model.HourlyCount, hours)
+	for i := range stats.AuthRequests {
+		hour := since.Add(time.Duration(i) * time.Hour)
+		stats.AuthRequests[i] = model.HourlyCount{
+			Hour:  hour,
+			Count: counts[hour.Unix()],
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestDevAuthGetStatistics(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		period time.Duration
+		hours  int
+		dbErr  error
+	}{
+		"ok": {
+			period: 3 * time.Hour,
+			hours:  3,
+		},
+		"ok, rounded up": {
+			period: 90 * time.Minute,
+			hours:  2,
+		},
+		"ok, at least an hour": {
+			hours: 1,
+		},
+		"error": {
+			period: time.Hour,
+			dbErr:  errors.New("db failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			rate := 0.5
+
+			var since time.Time
+			db := &mstore.DataStore{}
+			db.On("GetStatistics", ctx, mock.AnythingOfType("time.Time")).
+				Return(func(_ context.Context, s time.Time) *model.Statistics {
+					since = s
+					if tc.dbErr != nil {
+						return nil
+					}
+					return &model.Statistics{
+						Devices: model.DeviceCounts{Count: 2, Pending: 2},
+						// only the last hour had requests
+						AuthRequests: []model.HourlyCount{{
+							Hour:  s.Add(time.Duration(tc.hours-1) * time.Hour),
+							Count: 7,
+						}},
+						AcceptanceRate: &rate,
+					}
+				}, tc.dbErr)
+
+			d := NewDevAuth(db, nil, nil, Config{})
+			stats, err := d.GetStatistics(ctx, tc.period)
+
+			if tc.dbErr != nil {
+				assert.EqualError(t, err, tc.dbErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+
+			assert.Equal(t, since, since.Truncate(time.Hour))
+			assert.WithinDuration(t, time.Now(),
+				since.Add(time.Duration(tc.hours)*time.Hour), time.Hour)
+
+			assert.Equal(t, model.DeviceCounts{Count: 2, Pending: 2}, stats.Devices)
+			assert.Equal(t, &rate, stats.AcceptanceRate)
+			if assert.Len(t, stats.AuthRequests, tc.hours) {
+				for i, c := range stats.AuthRequests {
+					assert.Equal(t, since.Add(time.Duration(i)*time.Hour), c.Hour)
+					if i == tc.hours-1 {
+						assert.Equal(t, 7, c.Count)
+					} else {
+						assert.Equal(t, 0, c.Count)
+					}
+				}
+			}
+		})
+	}
+}
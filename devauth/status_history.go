@@ -0,0 +1,98 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// recordStatusChange adds the change of the device's status to its
+// history, along with the user and the client address of the request.
+// Failures are only logged, the status is changed already.
+func (d *DevAuth) recordStatusChange(ctx context.Context, devId, from, to string) {
+	l := log.FromContext(ctx)
+
+	r, err := newStatusChange(ctx, devId, from, to)
+	if err != nil {
+		l.Error(err.Error())
+		return
+	}
+
+	if err := d.db.AddDeviceStatusChange(ctx, *r); err != nil {
+		l.Errorf("failed to record device %s status change from %q to %q: %v",
+			devId, from, to, err)
+	}
+}
+
+// recordStatusChanges is recordStatusChange for many devices at once
+func (d *DevAuth) recordStatusChanges(ctx context.Context, devIds []string, from, to string) {
+	l := log.FromContext(ctx)
+
+	rs := make([]model.DeviceStatusChange, len(devIds))
+	for i, id := range devIds {
+		r, err := newStatusChange(ctx, id, from, to)
+		if err != nil {
+			l.Error(err.Error())
+			return
+		}
+		rs[i] = *r
+	}
+
+	if err := d.db.AddDeviceStatusChanges(ctx, rs); err != nil {
+		l.Errorf("failed to record status changes of %d devices from %q to %q: %v",
+			len(devIds), from, to, err)
+	}
+}
+
+func newStatusChange(ctx context.Context, devId, from, to string) (*model.DeviceStatusChange, error) {
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to assign uuid")
+	}
+
+	r := &model.DeviceStatusChange{
+		Id:        uid.String(),
+		DeviceId:  devId,
+		From:      from,
+		To:        to,
+		SourceIP:  sourceIPFromContext(ctx),
+		Timestamp: time.Now().UTC(),
+	}
+	if ident := identity.FromContext(ctx); ident != nil && ident.IsUser {
+		r.UserId = ident.Subject
+	}
+	return r, nil
+}
+
+// GetDeviceStatusHistory lists the status changes of the device, the
+// newest first; the history outlives the device
+func (d *DevAuth) GetDeviceStatusHistory(ctx context.Context, devId string, skip, limit uint) ([]model.DeviceStatusChange, error) {
+	return d.db.GetDeviceStatusHistory(ctx, devId, skip, limit)
+}
+
+// GetDeviceStatusChanges lists the status changes of all devices
+// following the cursor, the oldest first, e.g. to follow them as they
+// happen
+func (d *DevAuth) GetDeviceStatusChanges(ctx context.Context, after *store.Cursor, limit uint) ([]model.DeviceStatusChange, error) {
+	return d.db.GetDeviceStatusChanges(ctx, after, limit)
+}
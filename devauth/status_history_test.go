@@ -0,0 +1,162 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthUpdateDeviceStatusHistory(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		identity *identity.Identity
+		sourceIP string
+		prev     string
+		dbErr    error
+
+		recorded bool
+		userId   string
+	}{
+		"ok, by user": {
+			identity: &identity.Identity{
+				Subject: "user1",
+				IsUser:  true,
+			},
+			sourceIP: "10.0.0.1",
+			prev:     model.DevStatusPending,
+			recorded: true,
+			userId:   "user1",
+		},
+		"ok, by device": {
+			identity: &identity.Identity{
+				Subject:  "dev1",
+				IsDevice: true,
+			},
+			sourceIP: "10.0.0.2",
+			prev:     model.DevStatusPending,
+			recorded: true,
+		},
+		"ok, status unchanged": {
+			prev: model.DevStatusAccepted,
+		},
+		"ok, history not recorded": {
+			prev:     model.DevStatusPending,
+			dbErr:    errors.New("db failed"),
+			recorded: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := WithSourceIP(context.Background(), tc.sourceIP)
+			if tc.identity != nil {
+				ctx = identity.WithContext(ctx, tc.identity)
+			}
+
+			db := &mstore.DataStore{}
+			db.On("SetDeviceStatus", mtesting.ContextMatcher(),
+				"dev1", model.DevStatusAccepted).
+				Return(tc.prev, nil)
+			if tc.recorded {
+				db.On("AddDeviceStatusChange",
+					mtesting.ContextMatcher(),
+					mock.MatchedBy(func(c model.DeviceStatusChange) bool {
+						return c.Id != "" &&
+							c.DeviceId == "dev1" &&
+							c.From == tc.prev &&
+							c.To == model.DevStatusAccepted &&
+							c.UserId == tc.userId &&
+							c.SourceIP == tc.sourceIP &&
+							time.Since(c.Timestamp) < time.Minute
+					})).
+					Return(tc.dbErr)
+			}
+
+			d := NewDevAuth(db, nil, nil, Config{})
+			err := d.updateDeviceStatus(ctx, "dev1", model.DevStatusAccepted)
+			assert.NoError(t, err)
+
+			db.AssertExpectations(t)
+			if !tc.recorded {
+				db.AssertNotCalled(t, "AddDeviceStatusChange",
+					mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestDevAuthGetDeviceStatusHistory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	history := []model.DeviceStatusChange{
+		{
+			Id:       "1",
+			DeviceId: "dev1",
+			From:     model.DevStatusPending,
+			To:       model.DevStatusAccepted,
+			UserId:   "user1",
+		},
+	}
+
+	db := &mstore.DataStore{}
+	db.On("GetDeviceStatusHistory", ctx, "dev1", uint(10), uint(21)).
+		Return(history, nil)
+
+	d := NewDevAuth(db, nil, nil, Config{})
+	res, err := d.GetDeviceStatusHistory(ctx, "dev1", 10, 21)
+	assert.NoError(t, err)
+	assert.Equal(t, history, res)
+}
+
+func TestDevAuthGetDeviceStatusChanges(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	changes := []model.DeviceStatusChange{
+		{
+			Id:       "2",
+			DeviceId: "dev2",
+			To:       model.DevStatusPending,
+		},
+	}
+	after := store.StatusChangeCursor(&model.DeviceStatusChange{Id: "1"})
+
+	db := &mstore.DataStore{}
+	db.On("GetDeviceStatusChanges", ctx, after, uint(100)).
+		Return(changes, nil)
+
+	d := NewDevAuth(db, nil, nil, Config{})
+	res, err := d.GetDeviceStatusChanges(ctx, after, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, changes, res)
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+)
+
+var (
+	ErrTenantSuspended = NewError(ErrKindUnauthorized, catalog.CodeTenantSuspended)
+)
+
+// SuspendTenant suspends the tenant, e.g. for an unpaid account: all its
+// tokens, refresh tokens and pending device authorizations are revoked, and
+// no tokens are issued to its devices until ResumeTenant.
+func (d *DevAuth) SuspendTenant(ctx context.Context, tenantId string) error {
+	l := log.FromContext(ctx)
+
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: tenantId,
+	})
+
+	// marked first, so that no tokens are issued once revoked, see
+	// issueToken
+	if err := d.db.SetTenantSuspended(tenantCtx, true); err != nil {
+		return errors.Wrapf(err, "failed to suspend tenant %s", tenantId)
+	}
+	l.Infof("tenant %s suspended", tenantId)
+
+	if err := d.DeleteTokens(ctx, tenantId, ""); err != nil {
+		return err
+	}
+
+	if err := d.db.DeleteDeviceCodes(ctx, tenantId); err != nil {
+		return errors.Wrapf(err, "failed to delete device codes for tenant: %v", tenantId)
+	}
+
+	return nil
+}
+
+// ResumeTenant lifts the tenant's suspension; its devices have to
+// authenticate again to get tokens
+func (d *DevAuth) ResumeTenant(ctx context.Context, tenantId string) error {
+	l := log.FromContext(ctx)
+
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: tenantId,
+	})
+
+	if err := d.db.SetTenantSuspended(tenantCtx, false); err != nil {
+		return errors.Wrapf(err, "failed to resume tenant %s", tenantId)
+	}
+	l.Infof("tenant %s resumed", tenantId)
+
+	return nil
+}
+
+// checkTenantSuspended returns ErrTenantSuspended if the tenant of the
+// context is suspended
+func (d *DevAuth) checkTenantSuspended(ctx context.Context) error {
+	suspended, err := d.db.IsTenantSuspended(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to check tenant status")
+	}
+	if suspended {
+		log.FromContext(ctx).Warnf("token request of suspended tenant refused")
+		return ErrTenantSuspended
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestDevAuthSuspendTenant(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		suspendErr error
+		tokensErr  error
+		codesErr   error
+
+		err string
+	}{
+		"ok": {},
+		"error, suspend": {
+			suspendErr: errors.New("db connection failed"),
+			err:        "failed to suspend tenant foo: db connection failed",
+		},
+		"error, tokens": {
+			tokensErr: errors.New("db connection failed"),
+			err: "failed to delete tokens for tenant: foo, device id: : " +
+				"db connection failed",
+		},
+		"error, device codes": {
+			codesErr: errors.New("db connection failed"),
+			err: "failed to delete device codes for tenant: foo: " +
+				"db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tenantCtx := mock.MatchedBy(func(ctx context.Context) bool {
+				id := identity.FromContext(ctx)
+				return id != nil && id.Tenant == "foo"
+			})
+
+			db := mstore.DataStore{}
+			db.On("SetTenantSuspended", tenantCtx, true).
+				Return(tc.suspendErr)
+			db.On("DeleteTokens", tenantCtx).
+				Return(tc.tokensErr)
+			db.On("DeleteRefreshTokens", tenantCtx, "foo", "").
+				Return(nil)
+			db.On("DeleteDeviceCodes", mock.Anything, "foo").
+				Return(tc.codesErr)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.SuspendTenant(context.Background(), "foo")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				db.AssertCalled(t, "DeleteRefreshTokens", tenantCtx, "foo", "")
+				db.AssertCalled(t, "DeleteDeviceCodes", mock.Anything, "foo")
+			}
+
+			if tc.suspendErr != nil {
+				db.AssertNotCalled(t, "DeleteTokens", mock.Anything)
+			}
+		})
+	}
+}
+
+func TestDevAuthResumeTenant(t *testing.T) {
+	t.Parallel()
+
+	db := mstore.DataStore{}
+	db.On("SetTenantSuspended",
+		mock.MatchedBy(func(ctx context.Context) bool {
+			id := identity.FromContext(ctx)
+			return id != nil && id.Tenant == "foo"
+		}), false).
+		Return(nil)
+
+	devauth := NewDevAuth(&db, nil, nil, Config{})
+
+	assert.NoError(t, devauth.ResumeTenant(context.Background(), "foo"))
+	db.AssertExpectations(t)
+}
+
+func TestDevAuthCheckTenantSuspended(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		suspended bool
+		dbErr     error
+
+		err error
+	}{
+		"ok": {},
+		"suspended": {
+			suspended: true,
+			err:       ErrTenantSuspended,
+		},
+		"error, db": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("failed to check tenant status: db connection failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			db := mstore.DataStore{}
+			db.On("IsTenantSuspended", mock.Anything).
+				Return(tc.suspended, tc.dbErr)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.checkTenantSuspended(context.Background())
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.suspended {
+				assert.Equal(t, ErrKindUnauthorized, KindOf(err))
+			}
+		})
+	}
+}
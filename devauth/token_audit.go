@@ -0,0 +1,77 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/satori/go.uuid"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+type sourceIPKey struct{}
+
+// WithSourceIP returns a context carrying the address of the client whose
+// request is handled, as recorded in the token audit trail and with new
+// auth sets
+func WithSourceIP(ctx context.Context, ip string) context.Context {
+	if ip == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, sourceIPKey{}, ip)
+}
+
+func sourceIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(sourceIPKey{}).(string)
+	return ip
+}
+
+// auditToken adds the record to the token audit trail, if enabled, along
+// with the user and the client address of the request. Failures are only
+// logged, the tokens are issued or revoked already.
+func (d *DevAuth) auditToken(ctx context.Context, r model.TokenAuditRecord) {
+	if !d.config.TokenAudit {
+		return
+	}
+
+	l := log.FromContext(ctx)
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		l.Errorf("failed to assign uuid: %v", err)
+		return
+	}
+	r.Id = uid.String()
+	r.Timestamp = time.Now().UTC()
+	r.SourceIP = sourceIPFromContext(ctx)
+	if ident := identity.FromContext(ctx); ident != nil && ident.IsUser {
+		r.UserId = ident.Subject
+	}
+
+	if err := d.db.AddTokenAuditRecord(ctx, r); err != nil {
+		l.Errorf("failed to record token %s %s of device %s: %v",
+			r.TokenId, r.Action, r.DeviceId, err)
+	}
+}
+
+// GetTokenAuditRecords lists the tenant's token audit trail, the newest
+// records first
+func (d *DevAuth) GetTokenAuditRecords(ctx context.Context, filter store.TokenAuditFilter, skip, limit uint) ([]model.TokenAuditRecord, error) {
+	return d.db.GetTokenAuditRecords(ctx, filter, skip, limit)
+}
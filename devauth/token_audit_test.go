@@ -0,0 +1,166 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/revocation"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthAuditToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		disabled bool
+		identity *identity.Identity
+		sourceIP string
+		dbErr    error
+
+		userId string
+	}{
+		"ok, device": {
+			identity: &identity.Identity{
+				Subject:  "dev1",
+				IsDevice: true,
+			},
+			sourceIP: "10.0.0.1",
+		},
+		"ok, user": {
+			identity: &identity.Identity{
+				Subject: "user1",
+				IsUser:  true,
+			},
+			sourceIP: "10.0.0.1",
+			userId:   "user1",
+		},
+		"ok, no identity": {},
+		"ok, disabled": {
+			disabled: true,
+		},
+		"error, db": {
+			dbErr: errors.New("db failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := WithSourceIP(context.Background(), tc.sourceIP)
+			if tc.identity != nil {
+				ctx = identity.WithContext(ctx, tc.identity)
+			}
+
+			db := &mstore.DataStore{}
+			if !tc.disabled {
+				db.On("AddTokenAuditRecord",
+					mtesting.ContextMatcher(),
+					mock.MatchedBy(func(r model.TokenAuditRecord) bool {
+						return r.Id != "" &&
+							r.Action == model.TokenAuditActionIssued &&
+							r.TokenId == "jti1" &&
+							r.DeviceId == "dev1" &&
+							r.Trigger == model.TokenAuditTriggerAuthRequest &&
+							r.UserId == tc.userId &&
+							r.SourceIP == tc.sourceIP &&
+							time.Since(r.Timestamp) < time.Minute
+					})).
+					Return(tc.dbErr)
+			}
+
+			d := NewDevAuth(db, nil, nil, Config{
+				TokenAudit: !tc.disabled,
+			})
+			d.auditToken(ctx, model.TokenAuditRecord{
+				Action:   model.TokenAuditActionIssued,
+				TokenId:  "jti1",
+				DeviceId: "dev1",
+				Trigger:  model.TokenAuditTriggerAuthRequest,
+			})
+
+			db.AssertExpectations(t)
+			if tc.disabled {
+				assert.Len(t, db.Calls, 0)
+			}
+		})
+	}
+}
+
+func TestDevAuthPublishRevocationAudit(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		event revocation.Event
+
+		record model.TokenAuditRecord
+	}{
+		"token": {
+			event: revocation.Event{
+				Kind:    revocation.KindTokenRevoked,
+				TokenId: "jti1",
+			},
+			record: model.TokenAuditRecord{
+				Action:  model.TokenAuditActionRevoked,
+				TokenId: "jti1",
+				Trigger: revocation.ReasonRevoked,
+			},
+		},
+		"device": {
+			event: revocation.Event{
+				Kind:     revocation.KindDeviceRevoked,
+				DeviceId: "dev1",
+				Reason:   revocation.ReasonDecommissioned,
+			},
+			record: model.TokenAuditRecord{
+				Action:   model.TokenAuditActionRevoked,
+				DeviceId: "dev1",
+				Trigger:  revocation.ReasonDecommissioned,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			db := &mstore.DataStore{}
+			db.On("AddTokenAuditRecord",
+				mtesting.ContextMatcher(),
+				mock.MatchedBy(func(r model.TokenAuditRecord) bool {
+					r.Id = ""
+					r.Timestamp = time.Time{}
+					return assert.ObjectsAreEqual(tc.record, r)
+				})).
+				Return(nil)
+
+			d := NewDevAuth(db, nil, nil, Config{TokenAudit: true})
+			d.publishRevocation(context.Background(), tc.event)
+
+			db.AssertExpectations(t)
+		})
+	}
+}
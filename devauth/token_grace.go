@@ -0,0 +1,32 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrTokenExpiryGrace is returned by VerifyToken for tokens which have
+// expired, but no longer ago than the expiry grace period; such tokens are
+// still accepted, and the device should authenticate again
+var ErrTokenExpiryGrace = errors.New("token expired, within grace period")
+
+// withinExpiryGrace tells if a token expired at exp is still in the expiry
+// grace period
+func (d *DevAuth) withinExpiryGrace(exp time.Time) bool {
+	grace := time.Duration(d.config.TokenExpiryGrace) * time.Second
+	return grace > 0 && time.Since(exp) <= grace
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+	mjwt "github.com/mendersoftware/deviceauth/jwt/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	uto "github.com/mendersoftware/deviceauth/utils/to"
+)
+
+func TestDevAuthVerifyTokenExpiryGrace(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	testCases := map[string]struct {
+		grace int64
+
+		// token expiration claim, and sliding expiration time
+		exp       time.Time
+		expiresAt *time.Time
+
+		outErr error
+	}{
+		"ok, not expired": {
+			grace: 60,
+			exp:   now.Add(time.Hour),
+		},
+		"ok, expired within grace period": {
+			grace:  60,
+			exp:    now.Add(-30 * time.Second),
+			outErr: ErrTokenExpiryGrace,
+		},
+		"ok, not used within grace period": {
+			grace:     60,
+			exp:       now.Add(time.Hour),
+			expiresAt: uto.TimePtr(now.Add(-30 * time.Second)),
+			outErr:    ErrTokenExpiryGrace,
+		},
+		"error, expired beyond grace period": {
+			grace:  60,
+			exp:    now.Add(-120 * time.Second),
+			outErr: jwt.ErrTokenExpired,
+		},
+		"error, not used beyond grace period": {
+			grace:     60,
+			exp:       now.Add(time.Hour),
+			expiresAt: uto.TimePtr(now.Add(-120 * time.Second)),
+			outErr:    jwt.ErrTokenExpired,
+		},
+		"error, expired, no grace period": {
+			exp:    now.Add(-30 * time.Second),
+			outErr: jwt.ErrTokenExpired,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			var jwtErr error
+			if !now.Before(tc.exp) {
+				jwtErr = jwt.ErrTokenExpired
+			}
+			ja := &mjwt.Handler{}
+			ja.On("FromJWT", "token").Return(&jwt.Token{
+				Claims: jwt.Claims{
+					ID:        "jti",
+					Subject:   "foodev",
+					ExpiresAt: tc.exp.Unix(),
+					Device:    true,
+				},
+			}, jwtErr)
+
+			db := &mstore.DataStore{}
+			if tc.outErr == jwt.ErrTokenExpired {
+				db.On("DeleteExpiredToken", ctx, "jti").Return(nil)
+			}
+			if jwtErr == nil || tc.outErr != jwt.ErrTokenExpired {
+				db.On("GetToken", ctx, "jti").Return(&model.Token{
+					Id:        "jti",
+					AuthSetId: "foo",
+					ExpiresAt: tc.expiresAt,
+				}, nil)
+			}
+			if tc.outErr != jwt.ErrTokenExpired {
+				db.On("GetAuthSetById", ctx, "foo").Return(&model.AuthSet{
+					Id:       "foo",
+					Status:   model.DevStatusAccepted,
+					DeviceId: "foodev",
+				}, nil)
+				db.On("GetDeviceById", ctx, "foodev").
+					Return(&model.Device{Id: "foodev"}, nil)
+			}
+
+			// expired tokens are never extended, UpdateTokenExpiration
+			// is not expected
+			devauth := NewDevAuth(db, nil, ja, Config{
+				ExpirationTime:   3600,
+				MaxLifetime:      86400,
+				TokenExpiryGrace: tc.grace,
+			})
+			err := devauth.VerifyToken(ctx, "token")
+			assert.Equal(t, tc.outErr, err)
+			db.AssertExpectations(t)
+		})
+	}
+}
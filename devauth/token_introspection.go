@@ -0,0 +1,81 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// IntrospectToken tells if a device token is active, and if so, what it
+// was issued for (RFC 7662); a token is active if it passes VerifyToken.
+func (d *DevAuth) IntrospectToken(ctx context.Context, raw string) (*model.TokenIntrospection, error) {
+	err := d.VerifyToken(ctx, raw)
+	switch err {
+	case nil:
+		break
+	case jwt.ErrTokenExpired, jwt.ErrTokenInvalid, store.ErrTokenNotFound,
+		ErrTokenExpiryGrace:
+		return &model.TokenIntrospection{Active: false}, nil
+	default:
+		return nil, err
+	}
+
+	token, err := d.jwt.FromJWT(raw)
+	if err != nil {
+		// expired in between
+		return &model.TokenIntrospection{Active: false}, nil
+	}
+
+	dev, err := d.db.GetDeviceById(ctx, token.Claims.Subject)
+	switch err {
+	case nil:
+		break
+	case store.ErrDevNotFound:
+		return &model.TokenIntrospection{Active: false}, nil
+	default:
+		return nil, errors.Wrap(err, "failed to get device")
+	}
+
+	claims := token.Claims
+	expiresAt := claims.ExpiresAt
+	if d.config.MaxLifetime > 0 && claims.Scope != jwt.ScopeOffboarding {
+		// report the sliding expiration time rather than the max lifetime
+		tok, err := d.db.GetToken(ctx, claims.ID)
+		if err == nil && tok.ExpiresAt != nil {
+			expiresAt = tok.ExpiresAt.Unix()
+		}
+	}
+
+	return &model.TokenIntrospection{
+		Active:    true,
+		Scope:     claims.Scope,
+		TokenType: model.TokenTypeBearer,
+		ExpiresAt: expiresAt,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ID:        claims.ID,
+		DeviceId:  claims.Subject,
+		Tenant:    claims.Tenant,
+		Status:    dev.Status,
+	}, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+	mjwt "github.com/mendersoftware/deviceauth/jwt/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestDevAuthIntrospectToken(t *testing.T) {
+	t.Parallel()
+
+	token := &jwt.Token{
+		Claims: jwt.Claims{
+			ID:        "jti",
+			Subject:   "dev1",
+			Issuer:    "Mender",
+			Audience:  "mender",
+			Tenant:    "tenant1",
+			Device:    true,
+			IssuedAt:  1700000000,
+			ExpiresAt: 1700003600,
+		},
+	}
+
+	testCases := map[string]struct {
+		jwtErr      error
+		getTokenErr error
+		dev         *model.Device
+		getDevErr   error
+
+		out *model.TokenIntrospection
+		err string
+	}{
+		"active": {
+			dev: &model.Device{Id: "dev1", Status: model.DevStatusAccepted},
+			out: &model.TokenIntrospection{
+				Active:    true,
+				TokenType: "Bearer",
+				ExpiresAt: 1700003600,
+				IssuedAt:  1700000000,
+				Subject:   "dev1",
+				Audience:  "mender",
+				Issuer:    "Mender",
+				ID:        "jti",
+				DeviceId:  "dev1",
+				Tenant:    "tenant1",
+				Status:    model.DevStatusAccepted,
+			},
+		},
+		"inactive, invalid token": {
+			jwtErr: jwt.ErrTokenInvalid,
+			out:    &model.TokenIntrospection{Active: false},
+		},
+		"inactive, revoked token": {
+			getTokenErr: store.ErrTokenNotFound,
+			out:         &model.TokenIntrospection{Active: false},
+		},
+		"inactive, device decommissioned": {
+			dev: &model.Device{Id: "dev1", Status: model.DevStatusAccepted,
+				Decommissioning: true},
+			out: &model.TokenIntrospection{Active: false},
+		},
+		"error, device": {
+			dev:       &model.Device{Id: "dev1", Status: model.DevStatusAccepted},
+			getDevErr: errors.New("db error"),
+			err:       "db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			ja := &mjwt.Handler{}
+			if tc.jwtErr != nil {
+				ja.On("FromJWT", "token").Return(nil, tc.jwtErr)
+			} else {
+				ja.On("FromJWT", "token").Return(token, nil)
+			}
+			db.On("GetToken", ctx, "jti").
+				Return(&model.Token{Id: "jti", AuthSetId: "aid"}, tc.getTokenErr)
+			db.On("GetAuthSetById", ctx, "aid").
+				Return(&model.AuthSet{Id: "aid", DeviceId: "dev1",
+					Status: model.DevStatusAccepted}, nil)
+			db.On("GetDeviceById", ctx, "dev1").Return(tc.dev, tc.getDevErr)
+
+			d := NewDevAuth(db, nil, ja, Config{Issuer: "Mender", Audience: "mender"}).
+				WithTenantVerification(nil)
+
+			out, err := d.IntrospectToken(ctx, "token")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+)
+
+// TokenIssuer is the issuer ('iss') and audience ('aud') of device tokens
+type TokenIssuer struct {
+	Issuer   string `json:"iss"`
+	Audience string `json:"aud"`
+}
+
+// LoadTenantTokenIssuers reads the per tenant token issuers from a JSON file,
+// by tenant id, e.g. {"<tenant id>": {"iss": "eu-1.mender", "aud": "eu-1"}}
+func LoadTenantTokenIssuers(path string) (map[string]TokenIssuer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tenant token issuers")
+	}
+
+	var issuers map[string]TokenIssuer
+	if err := json.Unmarshal(data, &issuers); err != nil {
+		return nil, errors.Wrap(err, "failed to parse tenant token issuers")
+	}
+	return issuers, nil
+}
+
+// tokenIssuer returns the issuer and audience of the tenant's tokens; the
+// configured defaults for what the tenant doesn't have set
+func (d *DevAuth) tokenIssuer(tenant string) TokenIssuer {
+	iss := TokenIssuer{
+		Issuer:   d.config.Issuer,
+		Audience: d.config.Audience,
+	}
+	if t, ok := d.config.TenantIssuers[tenant]; ok && tenant != "" {
+		if t.Issuer != "" {
+			iss.Issuer = t.Issuer
+		}
+		if t.Audience != "" {
+			iss.Audience = t.Audience
+		}
+	}
+	return iss
+}
+
+// verifyTokenIssuer checks that the token was issued for its tenant by this
+// deployment, so that tokens can't be replayed across clusters
+func (d *DevAuth) verifyTokenIssuer(ctx context.Context, claims *jwt.Claims) error {
+	iss := d.tokenIssuer(claims.Tenant)
+	if claims.Issuer != iss.Issuer || claims.Audience != iss.Audience {
+		log.FromContext(ctx).Errorf("Token %s issued by %q for %q, expected %q for %q",
+			claims.ID, claims.Issuer, claims.Audience, iss.Issuer, iss.Audience)
+		return jwt.ErrTokenInvalid
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+)
+
+func TestDevAuthTokenIssuer(t *testing.T) {
+	t.Parallel()
+
+	d := NewDevAuth(nil, nil, nil, Config{
+		Issuer:   "Mender",
+		Audience: "mender",
+		TenantIssuers: map[string]TokenIssuer{
+			"tenant1": {Issuer: "mender-eu-1", Audience: "eu-1"},
+			"tenant2": {Audience: "us-1"},
+		},
+	})
+
+	testCases := map[string]struct {
+		tenant string
+
+		issuer TokenIssuer
+	}{
+		"no tenant": {
+			issuer: TokenIssuer{Issuer: "Mender", Audience: "mender"},
+		},
+		"tenant": {
+			tenant: "tenant1",
+			issuer: TokenIssuer{Issuer: "mender-eu-1", Audience: "eu-1"},
+		},
+		"tenant, audience only": {
+			tenant: "tenant2",
+			issuer: TokenIssuer{Issuer: "Mender", Audience: "us-1"},
+		},
+		"tenant, defaults": {
+			tenant: "tenant3",
+			issuer: TokenIssuer{Issuer: "Mender", Audience: "mender"},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.issuer, d.tokenIssuer(tc.tenant))
+
+			err := d.verifyTokenIssuer(context.Background(), &jwt.Claims{
+				Tenant:   tc.tenant,
+				Issuer:   tc.issuer.Issuer,
+				Audience: tc.issuer.Audience,
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDevAuthVerifyTokenIssuer(t *testing.T) {
+	t.Parallel()
+
+	d := NewDevAuth(nil, nil, nil, Config{
+		Issuer: "Mender",
+		TenantIssuers: map[string]TokenIssuer{
+			"tenant1": {Issuer: "mender-eu-1", Audience: "eu-1"},
+		},
+	})
+
+	testCases := map[string]struct {
+		claims jwt.Claims
+
+		err error
+	}{
+		"ok": {
+			claims: jwt.Claims{Issuer: "Mender"},
+		},
+		"ok, tenant": {
+			claims: jwt.Claims{Tenant: "tenant1", Issuer: "mender-eu-1", Audience: "eu-1"},
+		},
+		"error, issuer of other deployment": {
+			claims: jwt.Claims{Issuer: "mender-eu-1"},
+			err:    jwt.ErrTokenInvalid,
+		},
+		"error, tenant token of other deployment": {
+			claims: jwt.Claims{Tenant: "tenant1", Issuer: "mender-us-1", Audience: "eu-1"},
+			err:    jwt.ErrTokenInvalid,
+		},
+		"error, audience": {
+			claims: jwt.Claims{Tenant: "tenant1", Issuer: "mender-eu-1", Audience: "us-1"},
+			err:    jwt.ErrTokenInvalid,
+		},
+		"error, missing audience": {
+			claims: jwt.Claims{Tenant: "tenant1", Issuer: "mender-eu-1"},
+			err:    jwt.ErrTokenInvalid,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := d.verifyTokenIssuer(context.Background(), &tc.claims)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLoadTenantTokenIssuers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "issuers")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "issuers.json")
+	assert.NoError(t, ioutil.WriteFile(path,
+		[]byte(`{"tenant1": {"iss": "mender-eu-1", "aud": "eu-1"}}`), 0600))
+
+	issuers, err := LoadTenantTokenIssuers(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]TokenIssuer{
+		"tenant1": {Issuer: "mender-eu-1", Audience: "eu-1"},
+	}, issuers)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"tenant1": `), 0600))
+	_, err = LoadTenantTokenIssuers(path)
+	assert.EqualError(t, err,
+		"failed to parse tenant token issuers: unexpected end of JSON input")
+
+	_, err = LoadTenantTokenIssuers(filepath.Join(dir, "none.json"))
+	assert.Error(t, err)
+}
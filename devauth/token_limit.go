@@ -0,0 +1,50 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deviceauth/revocation"
+)
+
+// limitDeviceTokens revokes the device's oldest tokens beyond the max
+// device tokens, if set. Failures are only logged, the new token is
+// already issued.
+func (d *DevAuth) limitDeviceTokens(ctx context.Context, devId string) {
+	if d.config.MaxDeviceTokens <= 0 {
+		return
+	}
+
+	l := log.FromContext(ctx)
+
+	ids, err := d.db.DeleteOldestDeviceTokens(ctx, devId, d.config.MaxDeviceTokens)
+	if err != nil {
+		l.Errorf("failed to revoke excess tokens of device %s: %v", devId, err)
+		return
+	}
+
+	for _, id := range ids {
+		l.Infof("Token %v of device %v revoked, max device tokens reached",
+			id, devId)
+		d.publishRevocation(ctx, revocation.Event{
+			Kind:     revocation.KindTokenRevoked,
+			TokenId:  id,
+			DeviceId: devId,
+			Reason:   revocation.ReasonMaxTokens,
+		})
+	}
+}
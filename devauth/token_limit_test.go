@@ -0,0 +1,86 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/revocation"
+	mrevocation "github.com/mendersoftware/deviceauth/revocation/mocks"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthLimitDeviceTokens(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		maxTokens int
+
+		revoked []string
+		dbErr   error
+	}{
+		"ok, unlimited": {},
+		"ok, within limit": {
+			maxTokens: 3,
+		},
+		"ok, oldest revoked": {
+			maxTokens: 3,
+			revoked:   []string{"jti1", "jti2"},
+		},
+		"error, db": {
+			maxTokens: 3,
+			dbErr:     errors.New("db failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			if tc.maxTokens > 0 {
+				db.On("DeleteOldestDeviceTokens",
+					mtesting.ContextMatcher(), "dev1", tc.maxTokens).
+					Return(tc.revoked, tc.dbErr)
+			}
+
+			pub := &mrevocation.Publisher{}
+			for _, id := range tc.revoked {
+				pub.On("Publish", mtesting.ContextMatcher(), revocation.Event{
+					Kind:     revocation.KindTokenRevoked,
+					TokenId:  id,
+					DeviceId: "dev1",
+					Reason:   revocation.ReasonMaxTokens,
+				}).Return()
+			}
+
+			d := NewDevAuth(db, nil, nil, Config{
+				MaxDeviceTokens: tc.maxTokens,
+			}).WithRevocationPublisher(pub)
+			d.limitDeviceTokens(ctx, "dev1")
+
+			db.AssertExpectations(t)
+			pub.AssertExpectations(t)
+			assert.Len(t, pub.Calls, len(tc.revoked))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+)
+
+// PurgeExpiredTokens deletes the expired tokens of all tenants from the
+// database, batchSize at a time; returns the number of purged tokens.
+// Tenants failing to purge are logged and retried on the next run.
+func (d *DevAuth) PurgeExpiredTokens(ctx context.Context, batchSize int) (int, error) {
+	l := log.FromContext(ctx)
+
+	tenants := []string{""}
+	if d.verifyTenant {
+		ids, err := d.db.GetTenantIds(ctx)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to list tenants")
+		}
+		tenants = ids
+	}
+
+	now := time.Now().UTC()
+	purged := 0
+	for _, tenantId := range tenants {
+		tenantCtx := ctx
+		if tenantId != "" {
+			tenantCtx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenantId,
+			})
+		}
+
+		n, err := d.db.DeleteExpiredTokens(tenantCtx, now, batchSize)
+		purged += n
+		if err != nil {
+			l.Errorf("expired tokens purge failed, tenant: %q: %v",
+				tenantId, err)
+		}
+	}
+
+	return purged, nil
+}
+
+// RunTokenPurge runs PurgeExpiredTokens every interval, until ctx is done
+func (d *DevAuth) RunTokenPurge(ctx context.Context, interval time.Duration, batchSize int) {
+	l := log.FromContext(ctx)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		n, err := d.PurgeExpiredTokens(ctx, batchSize)
+		if err != nil {
+			l.Errorf("expired tokens purge failed: %v", err)
+			continue
+		}
+		if n > 0 {
+			l.Infof("purged %d expired tokens", n)
+		}
+	}
+}
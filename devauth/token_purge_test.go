@@ -0,0 +1,108 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestDevAuthPurgeExpiredTokens(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		verifyTenant bool
+
+		tenants    []string
+		tenantsErr error
+		// per tenant purged tokens and errors
+		purged map[string]int
+		errs   map[string]error
+
+		out int
+		err string
+	}{
+		"ok, single tenant": {
+			purged: map[string]int{"": 3},
+			out:    3,
+		},
+		"ok, multi tenant": {
+			verifyTenant: true,
+			tenants:      []string{"tenant1", "tenant2"},
+			purged:       map[string]int{"tenant1": 2, "tenant2": 5},
+			out:          7,
+		},
+		"ok, tenant failed": {
+			verifyTenant: true,
+			tenants:      []string{"tenant1", "tenant2"},
+			purged:       map[string]int{"tenant1": 1, "tenant2": 5},
+			errs:         map[string]error{"tenant1": errors.New("db error")},
+			out:          6,
+		},
+		"error, tenants": {
+			verifyTenant: true,
+			tenantsErr:   errors.New("db error"),
+			err:          "failed to list tenants: db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			db := &mstore.DataStore{}
+			if tc.verifyTenant {
+				db.On("GetTenantIds", context.Background()).
+					Return(tc.tenants, tc.tenantsErr)
+			}
+			for tenant, n := range tc.purged {
+				tenant := tenant
+				db.On("DeleteExpiredTokens",
+					mock.MatchedBy(func(ctx context.Context) bool {
+						ident := identity.FromContext(ctx)
+						if tenant == "" {
+							return ident == nil
+						}
+						return ident != nil && ident.Tenant == tenant
+					}),
+					mock.MatchedBy(func(now time.Time) bool {
+						return time.Since(now) < time.Minute
+					}),
+					100).
+					Return(n, tc.errs[tenant])
+			}
+
+			d := NewDevAuth(db, nil, nil, Config{})
+			d.verifyTenant = tc.verifyTenant
+
+			n, err := d.PurgeExpiredTokens(context.Background(), 100)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.out, n)
+				db.AssertExpectations(t)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/revocation"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// RenewToken exchanges a valid device token for a new one, without another
+// signed auth request; the renewed token is revoked. Tokens expired within
+// the grace period may be renewed, offboarding tokens may not.
+func (d *DevAuth) RenewToken(ctx context.Context, raw string) (string, error) {
+	l := log.FromContext(ctx)
+
+	tok, authSet, err := d.verifyToken(ctx, raw, false)
+	switch err {
+	case nil, ErrTokenExpiryGrace:
+		break
+	case jwt.ErrTokenExpired, jwt.ErrTokenInvalid, store.ErrTokenNotFound:
+		return "", ErrDevAuthUnauthorized
+	default:
+		return "", err
+	}
+
+	token, err := d.issueToken(ctx, authSet, model.TokenAuditTriggerRenewal)
+	if err != nil {
+		return "", err
+	}
+
+	l.Infof("Token %v of device %v renewed", tok.Id, tok.DevId)
+	switch err := d.db.DeleteToken(ctx, tok.Id); err {
+	case nil:
+		d.publishRevocation(ctx, revocation.Event{
+			Kind:     revocation.KindTokenRevoked,
+			TokenId:  tok.Id,
+			DeviceId: tok.DevId,
+			Reason:   revocation.ReasonRenewed,
+		})
+	case store.ErrTokenNotFound:
+		break
+	default:
+		// the new token is issued already, the old one expires anyway
+		l.Errorf("failed to revoke renewed token %s: %v", tok.Id, err)
+	}
+
+	return token, nil
+}
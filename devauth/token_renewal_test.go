@@ -0,0 +1,148 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+	mjwt "github.com/mendersoftware/deviceauth/jwt/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestDevAuthRenewToken(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	testCases := map[string]struct {
+		exp     time.Time
+		scope   string
+		grace   int64
+		authSet *model.AuthSet
+
+		revokeErr error
+
+		err error
+	}{
+		"ok": {
+			exp: now.Add(time.Hour),
+		},
+		"ok, expired within grace period": {
+			exp:   now.Add(-30 * time.Second),
+			grace: 60,
+		},
+		"ok, revoking renewed token failed": {
+			exp:       now.Add(time.Hour),
+			revokeErr: errors.New("db failed"),
+		},
+		"error, expired": {
+			exp: now.Add(-30 * time.Second),
+			err: ErrDevAuthUnauthorized,
+		},
+		"error, offboarding token": {
+			exp:   now.Add(time.Hour),
+			scope: jwt.ScopeOffboarding,
+			err:   ErrDevAuthUnauthorized,
+		},
+		"error, auth set not accepted": {
+			exp: now.Add(time.Hour),
+			authSet: &model.AuthSet{
+				Id:       "aid1",
+				DeviceId: "dev1",
+				Status:   model.DevStatusRejected,
+			},
+			err: ErrDevAuthUnauthorized,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			var jwtErr error
+			if !now.Before(tc.exp) {
+				jwtErr = jwt.ErrTokenExpired
+			}
+			ja := &mjwt.Handler{}
+			ja.On("FromJWT", "old-token").Return(&jwt.Token{
+				Claims: jwt.Claims{
+					ID:        "jti1",
+					Subject:   "dev1",
+					ExpiresAt: tc.exp.Unix(),
+					Scope:     tc.scope,
+					Device:    true,
+				},
+			}, jwtErr)
+			ja.On("ToJWT",
+				mock.MatchedBy(func(jt *jwt.Token) bool {
+					return jt.Claims.Subject == "dev1" &&
+						jt.Claims.ID != "jti1"
+				})).
+				Return("new-token", nil)
+
+			authSet := tc.authSet
+			if authSet == nil {
+				authSet = &model.AuthSet{
+					Id:       "aid1",
+					DeviceId: "dev1",
+					Status:   model.DevStatusAccepted,
+				}
+			}
+
+			db := &mstore.DataStore{}
+			db.On("DeleteToken", ctx, "jti1").Return(tc.revokeErr)
+			db.On("DeleteExpiredToken", ctx, "jti1").Return(nil)
+			db.On("GetToken", ctx, "jti1").Return(&model.Token{
+				Id:        "jti1",
+				DevId:     "dev1",
+				AuthSetId: "aid1",
+			}, nil)
+			db.On("GetAuthSetById", ctx, "aid1").Return(authSet, nil)
+			db.On("GetDeviceById", ctx, "dev1").
+				Return(&model.Device{Id: "dev1"}, nil)
+			db.On("GetLimit", ctx, model.LimitTokenExpiration).
+				Return(nil, store.ErrLimitNotFound)
+			db.On("AddToken", ctx,
+				mock.MatchedBy(func(tok model.Token) bool {
+					return tok.DevId == "dev1" && tok.AuthSetId == "aid1"
+				})).Return(nil)
+
+			d := NewDevAuth(db, nil, ja, Config{
+				TokenExpiryGrace: tc.grace,
+			})
+			token, err := d.RenewToken(ctx, "old-token")
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+				db.AssertNotCalled(t, "AddToken", mock.Anything, mock.Anything)
+				db.AssertNotCalled(t, "DeleteToken", ctx, "jti1")
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "new-token", token)
+				db.AssertCalled(t, "DeleteToken", ctx, "jti1")
+			}
+		})
+	}
+}
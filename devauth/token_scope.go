@@ -0,0 +1,121 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	ctxhttpheader "github.com/mendersoftware/go-lib-micro/context/httpheader"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+)
+
+// TokenScopePolicy restricts the device APIs the tokens of tenants may call,
+// with the token's 'scp' claim; each scope allows the device API path
+// prefixes listed for it
+type TokenScopePolicy struct {
+	// device API path prefixes, by scope
+	Scopes map[string][]string `json:"scopes"`
+	// scope of the tokens of tenants not listed; unrestricted if empty
+	Default string `json:"default"`
+	// scope of the tokens, by tenant id; unrestricted if empty
+	Tenants map[string]string `json:"tenants"`
+}
+
+// LoadTokenScopePolicy reads the token scope policy from a JSON file, e.g.
+// {"scopes": {"deployments": ["/api/devices/v1/deployments"]},
+// "tenants": {"<tenant id>": "deployments"}}
+func LoadTokenScopePolicy(path string) (*TokenScopePolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read token scope policy")
+	}
+
+	var policy TokenScopePolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, errors.Wrap(err, "failed to parse token scope policy")
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid token scope policy")
+	}
+	return &policy, nil
+}
+
+func (p *TokenScopePolicy) Validate() error {
+	for scope, prefixes := range p.Scopes {
+		if scope == "" || scope == jwt.ScopeOffboarding {
+			return errors.Errorf("invalid scope name: %q", scope)
+		}
+		if len(prefixes) == 0 {
+			return errors.Errorf("scope %s allows no paths", scope)
+		}
+		for _, prefix := range prefixes {
+			if !strings.HasPrefix(prefix, "/") {
+				return errors.Errorf("scope %s: invalid path prefix: %q",
+					scope, prefix)
+			}
+		}
+	}
+
+	if _, ok := p.Scopes[p.Default]; p.Default != "" && !ok {
+		return errors.Errorf("unknown default scope: %s", p.Default)
+	}
+	for tenant, scope := range p.Tenants {
+		if _, ok := p.Scopes[scope]; scope != "" && !ok {
+			return errors.Errorf("tenant %s: unknown scope: %s", tenant, scope)
+		}
+	}
+	return nil
+}
+
+// tokenScope returns the scope of the tenant's tokens; empty if they're not
+// restricted
+func (d *DevAuth) tokenScope(tenant string) string {
+	p := d.config.TokenScopes
+	if p == nil {
+		return ""
+	}
+	if scope, ok := p.Tenants[tenant]; ok && tenant != "" {
+		return scope
+	}
+	return p.Default
+}
+
+// verifyTokenScope checks the token is used within its scope, if it has
+// one, as given by the original request URI
+func (d *DevAuth) verifyTokenScope(ctx context.Context, claims *jwt.Claims) error {
+	if claims.Scope == "" {
+		return nil
+	}
+
+	uri := ctxhttpheader.FromContext(ctx, HdrOriginalURI)
+	if !d.tokenScopeAllows(claims.Scope, uri) {
+		log.FromContext(ctx).Warnf("Token %s of device %s used out of scope %s: %q",
+			claims.ID, claims.Subject, claims.Scope, uri)
+		return jwt.ErrTokenInvalid
+	}
+	return nil
+}
+
+func (d *DevAuth) tokenScopeAllows(scope, uri string) bool {
+	if d.config.TokenScopes == nil {
+		return false
+	}
+	return uriInScope(uri, d.config.TokenScopes.Scopes[scope])
+}
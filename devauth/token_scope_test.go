@@ -0,0 +1,211 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ctxhttpheader "github.com/mendersoftware/go-lib-micro/context/httpheader"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/jwt"
+)
+
+var testTokenScopes = &TokenScopePolicy{
+	Scopes: map[string][]string{
+		"deployments": {"/api/devices/v1/deployments"},
+		"inventory": {
+			"/api/devices/v1/inventory",
+			"/api/devices/v1/deployments/device/deployments/next",
+		},
+	},
+	Default: "inventory",
+	Tenants: map[string]string{
+		"tenant1": "deployments",
+		"tenant2": "",
+	},
+}
+
+func TestLoadTokenScopePolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scopes")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "scopes.json")
+
+	testCases := map[string]struct {
+		data string
+
+		policy *TokenScopePolicy
+		err    string
+	}{
+		"ok": {
+			data: `{"scopes": {"deployments": ["/api/devices/v1/deployments"]},
+				"tenants": {"tenant1": "deployments"}}`,
+			policy: &TokenScopePolicy{
+				Scopes: map[string][]string{
+					"deployments": {"/api/devices/v1/deployments"},
+				},
+				Tenants: map[string]string{"tenant1": "deployments"},
+			},
+		},
+		"error, parse": {
+			data: `{"scopes": `,
+			err:  "failed to parse token scope policy: unexpected end of JSON input",
+		},
+		"error, reserved scope": {
+			data: `{"scopes": {"mender.offboarding": ["/api/devices"]}}`,
+			err:  `invalid token scope policy: invalid scope name: "mender.offboarding"`,
+		},
+		"error, no paths": {
+			data: `{"scopes": {"deployments": []}}`,
+			err:  "invalid token scope policy: scope deployments allows no paths",
+		},
+		"error, path prefix": {
+			data: `{"scopes": {"deployments": ["api/devices"]}}`,
+			err:  `invalid token scope policy: scope deployments: invalid path prefix: "api/devices"`,
+		},
+		"error, unknown default": {
+			data: `{"scopes": {"deployments": ["/api/devices"]}, "default": "foo"}`,
+			err:  "invalid token scope policy: unknown default scope: foo",
+		},
+		"error, unknown tenant scope": {
+			data: `{"scopes": {"deployments": ["/api/devices"]}, "tenants": {"tenant1": "foo"}}`,
+			err:  "invalid token scope policy: tenant tenant1: unknown scope: foo",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, ioutil.WriteFile(path, []byte(tc.data), 0600))
+
+			policy, err := LoadTokenScopePolicy(path)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.policy, policy)
+			}
+		})
+	}
+
+	_, err = LoadTokenScopePolicy(filepath.Join(dir, "none.json"))
+	assert.Error(t, err)
+}
+
+func TestDevAuthTokenScope(t *testing.T) {
+	t.Parallel()
+
+	d := NewDevAuth(nil, nil, nil, Config{TokenScopes: testTokenScopes})
+
+	assert.Equal(t, "deployments", d.tokenScope("tenant1"))
+	assert.Equal(t, "", d.tokenScope("tenant2"))
+	assert.Equal(t, "inventory", d.tokenScope("tenant3"))
+	assert.Equal(t, "inventory", d.tokenScope(""))
+
+	d = NewDevAuth(nil, nil, nil, Config{})
+	assert.Equal(t, "", d.tokenScope("tenant1"))
+}
+
+func TestDevAuthVerifyTokenScope(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		scope  string
+		uri    string
+		policy *TokenScopePolicy
+
+		err error
+	}{
+		"ok, no scope": {
+			uri:    "/api/devices/v1/inventory/device/attributes",
+			policy: testTokenScopes,
+		},
+		"ok, no scope, no policy": {
+			uri: "/api/devices/v1/inventory/device/attributes",
+		},
+		"ok, in scope": {
+			scope:  "deployments",
+			uri:    "/api/devices/v1/deployments/device/deployments/next?artifact_name=foo",
+			policy: testTokenScopes,
+		},
+		"ok, in scope, other prefix": {
+			scope:  "inventory",
+			uri:    "/api/devices/v1/deployments/device/deployments/next",
+			policy: testTokenScopes,
+		},
+		"error, out of scope": {
+			scope:  "deployments",
+			uri:    "/api/devices/v1/inventory/device/attributes",
+			policy: testTokenScopes,
+			err:    jwt.ErrTokenInvalid,
+		},
+		"error, out of scope, dot segments": {
+			scope:  "deployments",
+			uri:    "/api/devices/v1/deployments/../inventory/device/attributes",
+			policy: testTokenScopes,
+			err:    jwt.ErrTokenInvalid,
+		},
+		"error, out of scope, prefix of a segment": {
+			scope:  "deployments",
+			uri:    "/api/devices/v1/deploymentsX/device",
+			policy: testTokenScopes,
+			err:    jwt.ErrTokenInvalid,
+		},
+		"error, no uri": {
+			scope:  "deployments",
+			policy: testTokenScopes,
+			err:    jwt.ErrTokenInvalid,
+		},
+		"error, unknown scope": {
+			scope:  "foo",
+			uri:    "/api/devices/v1/deployments/device/deployments/next",
+			policy: testTokenScopes,
+			err:    jwt.ErrTokenInvalid,
+		},
+		"error, no policy": {
+			scope: "deployments",
+			uri:   "/api/devices/v1/deployments/device/deployments/next",
+			err:   jwt.ErrTokenInvalid,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tc.uri != "" {
+				hdr := http.Header{}
+				hdr.Set(HdrOriginalURI, tc.uri)
+				ctx = ctxhttpheader.WithContext(ctx, hdr, HdrOriginalURI)
+			}
+
+			d := NewDevAuth(nil, nil, nil, Config{TokenScopes: tc.policy})
+
+			err := d.verifyTokenScope(ctx, &jwt.Claims{
+				ID:      "jti",
+				Subject: "dev1",
+				Scope:   tc.scope,
+			})
+			assert.Equal(t, tc.err, err)
+		})
+	}
+}
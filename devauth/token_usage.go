@@ -0,0 +1,156 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// tokenUsage collects the last use of verified tokens, per tenant, until
+// they're written to the database in bulk
+type tokenUsage struct {
+	lock  sync.Mutex
+	usage map[string]map[string]model.TokenUsage
+}
+
+func newTokenUsage() *tokenUsage {
+	return &tokenUsage{
+		usage: make(map[string]map[string]model.TokenUsage),
+	}
+}
+
+func (u *tokenUsage) record(tenant string, usage model.TokenUsage) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	tokens, ok := u.usage[tenant]
+	if !ok {
+		tokens = make(map[string]model.TokenUsage)
+		u.usage[tenant] = tokens
+	}
+	tokens[usage.TokenId] = usage
+}
+
+// take returns the collected usage and starts over
+func (u *tokenUsage) take() map[string]map[string]model.TokenUsage {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	usage := u.usage
+	u.usage = make(map[string]map[string]model.TokenUsage)
+	return usage
+}
+
+// WithTokenUsageTracking will make devauth record the last time tokens pass
+// verification; the records are kept in memory until written to the
+// database with FlushTokenUsage. Returns an updated devauth.
+func (d *DevAuth) WithTokenUsageTracking() *DevAuth {
+	d.tokenUsage = newTokenUsage()
+	return d
+}
+
+func (d *DevAuth) recordTokenUsage(ctx context.Context, tok *model.Token) {
+	if d.tokenUsage == nil {
+		return
+	}
+
+	tenant := ""
+	if ident := identity.FromContext(ctx); ident != nil {
+		tenant = ident.Tenant
+	}
+	d.tokenUsage.record(tenant, model.TokenUsage{
+		TokenId:  tok.Id,
+		DeviceId: tok.DevId,
+		LastUsed: time.Now(),
+	})
+}
+
+// FlushTokenUsage writes the recorded token usage to the database; usage
+// failing to be written is dropped
+func (d *DevAuth) FlushTokenUsage(ctx context.Context) error {
+	if d.tokenUsage == nil {
+		return nil
+	}
+
+	var lastErr error
+	for tenant, tokens := range d.tokenUsage.take() {
+		usage := make([]model.TokenUsage, 0, len(tokens))
+		for _, u := range tokens {
+			usage = append(usage, u)
+		}
+
+		tenantCtx := ctx
+		if tenant != "" {
+			tenantCtx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenant,
+			})
+		}
+		if err := d.db.SetTokensLastUsed(tenantCtx, usage); err != nil {
+			lastErr = errors.Wrapf(err,
+				"failed to record token usage for tenant: %v", tenant)
+		}
+	}
+	return lastErr
+}
+
+// RunTokenUsageFlush writes the recorded token usage to the database every
+// interval, until the context is done
+func (d *DevAuth) RunTokenUsageFlush(ctx context.Context, interval time.Duration) {
+	l := log.FromContext(ctx)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := d.FlushTokenUsage(ctx); err != nil {
+			l.Errorf("token usage flush failed: %v", err)
+		}
+	}
+}
+
+// GetDeviceTokens lists the tokens of a device
+func (d *DevAuth) GetDeviceTokens(ctx context.Context, devId string) ([]model.DeviceToken, error) {
+	if _, err := d.db.GetDeviceById(ctx, devId); err != nil {
+		if err == store.ErrDevNotFound {
+			return nil, ErrDeviceNotFound
+		}
+		return nil, errors.Wrap(err, "db get device error")
+	}
+
+	tokens, err := d.db.GetTokensByDevId(ctx, devId)
+	if err != nil {
+		return nil, errors.Wrap(err, "db get tokens error")
+	}
+
+	res := make([]model.DeviceToken, len(tokens))
+	for i := range tokens {
+		res[i] = model.NewDeviceToken(tokens[i])
+	}
+	return res, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+)
+
+func TestDevAuthFlushTokenUsage(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		tracking bool
+		dbErr    error
+
+		err string
+	}{
+		"ok": {
+			tracking: true,
+		},
+		"ok, not tracking": {},
+		"error, db": {
+			tracking: true,
+			dbErr:    errors.New("db failed"),
+			err:      "failed to record token usage for tenant: foo: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			tenantCtx := identity.WithContext(ctx, &identity.Identity{
+				Tenant: "foo",
+			})
+
+			db := &mstore.DataStore{}
+			d := NewDevAuth(db, nil, nil, Config{})
+			if tc.tracking {
+				d = d.WithTokenUsageTracking()
+			}
+
+			d.recordTokenUsage(tenantCtx, &model.Token{Id: "jti1", DevId: "dev1"})
+			d.recordTokenUsage(tenantCtx, &model.Token{Id: "jti1", DevId: "dev1"})
+
+			if tc.tracking {
+				db.On("SetTokensLastUsed",
+					mock.MatchedBy(func(c context.Context) bool {
+						ident := identity.FromContext(c)
+						return ident != nil && ident.Tenant == "foo"
+					}),
+					mock.MatchedBy(func(u []model.TokenUsage) bool {
+						return len(u) == 1 &&
+							u[0].TokenId == "jti1" &&
+							u[0].DeviceId == "dev1" &&
+							time.Since(u[0].LastUsed) < time.Minute
+					})).
+					Return(tc.dbErr).Once()
+			}
+
+			err := d.FlushTokenUsage(ctx)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// usage is written once
+			assert.NoError(t, d.FlushTokenUsage(ctx))
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDevAuthGetDeviceTokens(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		devErr    error
+		tokens    []model.Token
+		tokensErr error
+
+		out []model.DeviceToken
+		err string
+	}{
+		"ok": {
+			tokens: []model.Token{
+				{Id: "jti1", DevId: "dev1", AuthSetId: "aid1",
+					Token: "token1", LastUsed: &ts},
+				{Id: "jti2", DevId: "dev1", AuthSetId: "aid2",
+					Token: "token2", ExpiresAt: &ts},
+			},
+			out: []model.DeviceToken{
+				{Id: "jti1", AuthSetId: "aid1", LastUsed: &ts},
+				{Id: "jti2", AuthSetId: "aid2", ExpiresAt: &ts},
+			},
+		},
+		"ok, no tokens": {
+			tokens: []model.Token{},
+			out:    []model.DeviceToken{},
+		},
+		"error, device not found": {
+			devErr: store.ErrDevNotFound,
+			err:    ErrDeviceNotFound.Error(),
+		},
+		"error, db": {
+			tokensErr: errors.New("db failed"),
+			err:       "db get tokens error: db failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetDeviceById", ctx, "dev1").
+				Return(&model.Device{Id: "dev1"}, tc.devErr)
+			db.On("GetTokensByDevId", ctx, "dev1").
+				Return(tc.tokens, tc.tokensErr)
+
+			d := NewDevAuth(db, nil, nil, Config{})
+
+			tokens, err := d.GetDeviceTokens(ctx, "dev1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.out, tokens)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+var (
+	ErrTPMAttestationDisabled = NewError(ErrKindBadRequest, catalog.CodeTPMAttestationDisabled)
+)
+
+// TPMVerifier verifies TPM attestations of device keys, see tpm.Verifier
+type TPMVerifier interface {
+	// MakeCredential makes a credential for the TPM to activate, bound
+	// to its EK and AK, returns what to pass to Verify along
+	MakeCredential(req *model.TPMCredentialReq) (*model.TPMCredential, *model.TPMActivation, error)
+	// Verify returns the EK certificate of the TPM holding key
+	Verify(att *model.TPMAttestation, key crypto.PublicKey, qualifyingData []byte, activation *model.TPMActivation) (*x509.Certificate, error)
+}
+
+// verifyTPMAttestation verifies the TPM attestation of the auth request, if
+// any. A failed verification doesn't fail the request, the result is
+// recorded with the auth set for the operator to decide on.
+func (d *DevAuth) verifyTPMAttestation(ctx context.Context, r *model.AuthReq, nonce *model.AuthNonce) (*model.TPMAttestationResult, error) {
+	if r.TPMAttestation == nil {
+		return nil, nil
+	}
+
+	if d.tpmVerifier == nil {
+		return nil, ErrTPMAttestationDisabled
+	}
+
+	// binds the attestation to the identity
+	qualifyingData := sha256.Sum256([]byte(r.IdData))
+
+	res := &model.TPMAttestationResult{
+		Timestamp: time.Now(),
+	}
+
+	// the credential handed out with the nonce proves the AK resident in
+	// the TPM; without it the attestation doesn't verify
+	var activation *model.TPMActivation
+	if nonce != nil {
+		activation = nonce.TPMActivation
+	}
+
+	ekCert, err := d.tpmVerifier.Verify(r.TPMAttestation, r.PubKeyStruct,
+		qualifyingData[:], activation)
+	if err != nil {
+		log.FromContext(ctx).Warnf("TPM attestation verification failed: %v", err)
+		res.Error = err.Error()
+		return res, nil
+	}
+
+	res.Verified = true
+	res.EKIssuer = ekCert.Issuer.String()
+	res.EKSerial = ekCert.SerialNumber.String()
+	return res, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/devauth/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthVerifyTPMAttestation(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	ekCert, _ := mtesting.IssueCert("EK", key.Public(), nil, key, false, t)
+
+	idData := `{"mac":"00:01:02:03:04:05"}`
+	qualifyingData := sha256.Sum256([]byte(idData))
+
+	att := &model.TPMAttestation{
+		EKCertificate: "ek",
+	}
+	activation := &model.TPMActivation{
+		SecretDigest: []byte("secret"),
+	}
+
+	testCases := map[string]struct {
+		att      *model.TPMAttestation
+		nonce    *model.AuthNonce
+		disabled bool
+
+		ekCert    interface{}
+		verifyErr error
+
+		res *model.TPMAttestationResult
+		err error
+	}{
+		"ok": {
+			att:    att,
+			nonce:  &model.AuthNonce{TPMActivation: activation},
+			ekCert: ekCert,
+			res: &model.TPMAttestationResult{
+				Verified: true,
+				EKIssuer: "CN=EK",
+				EKSerial: ekCert.SerialNumber.String(),
+			},
+		},
+		"ok, no attestation": {},
+		"ok, no attestation, disabled": {
+			disabled: true,
+		},
+		"ok, not activated": {
+			att:       att,
+			nonce:     &model.AuthNonce{},
+			verifyErr: errors.New("AK not activated"),
+			res: &model.TPMAttestationResult{
+				Error: "AK not activated",
+			},
+		},
+		"ok, verification failed": {
+			att:       att,
+			verifyErr: errors.New("EK certificate verification failed"),
+			res: &model.TPMAttestationResult{
+				Error: "EK certificate verification failed",
+			},
+		},
+		"error, disabled": {
+			att:      att,
+			disabled: true,
+			err:      ErrTPMAttestationDisabled,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			verifier := &mocks.TPMVerifier{}
+			var act *model.TPMActivation
+			if tc.nonce != nil {
+				act = tc.nonce.TPMActivation
+			}
+			verifier.On("Verify", tc.att, key.Public(), qualifyingData[:], act).
+				Return(tc.ekCert, tc.verifyErr)
+
+			d := NewDevAuth(nil, nil, nil, Config{})
+			if !tc.disabled {
+				d = d.WithTPMAttestation(verifier)
+			}
+
+			res, err := d.verifyTPMAttestation(context.Background(), &model.AuthReq{
+				IdData:         idData,
+				PubKeyStruct:   key.Public(),
+				TPMAttestation: tc.att,
+			}, tc.nonce)
+			assert.Equal(t, tc.err, err)
+			if tc.res != nil {
+				assert.NotNil(t, res)
+				assert.WithinDuration(t, time.Now(), res.Timestamp, time.Second)
+				res.Timestamp = time.Time{}
+			}
+			assert.Equal(t, tc.res, res)
+		})
+	}
+}
@@ -0,0 +1,402 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/revocation"
+	"github.com/mendersoftware/deviceauth/store"
+	uto "github.com/mendersoftware/deviceauth/utils/to"
+)
+
+var (
+	ErrTransferNotFound       = NewError(ErrKindNotFound, catalog.CodeTransferNotFound)
+	ErrTransferInProgress     = NewError(ErrKindConflict, catalog.CodeTransferInProgress)
+	ErrTransferNotPending     = NewError(ErrKindConflict, catalog.CodeTransferNotPending)
+	ErrTransferTenantDisabled = NewError(ErrKindBadRequest, catalog.CodeTransferTenantDisabled)
+	ErrTransferNotApprovable  = NewError(ErrKindConflict, catalog.CodeTransferNotApprovable)
+)
+
+func tenantFromContext(ctx context.Context) string {
+	if ident := identity.FromContext(ctx); ident != nil {
+		return ident.Tenant
+	}
+	return ""
+}
+
+// StartDeviceTransfer moves a device to a new owner, and optionally to another
+// tenant.
+// Within the tenant, the device's tokens are revoked and its accepted auth
+// sets reset to pending right away; the transfer completes when the device
+// is accepted again. A transfer to another tenant waits for the destination
+// tenant to accept it, see AcceptDeviceTransfer, the device keeps working
+// until then.
+func (d *DevAuth) StartDeviceTransfer(ctx context.Context, req *model.TransferReq) (*model.Transfer, error) {
+	l := log.FromContext(ctx)
+
+	tenantId := tenantFromContext(ctx)
+
+	toTenantId := req.ToTenantId
+	if toTenantId == tenantId {
+		toTenantId = ""
+	}
+	if toTenantId != "" && !d.verifyTenant {
+		return nil, ErrTransferTenantDisabled
+	}
+
+	dev, err := d.db.GetDeviceById(ctx, req.DeviceId)
+	switch err {
+	case nil:
+		break
+	case store.ErrDevNotFound:
+		return nil, ErrDeviceNotFound
+	default:
+		return nil, errors.Wrap(err, "db get device by id error")
+	}
+
+	if dev.TransferId != "" {
+		return nil, ErrTransferInProgress
+	}
+
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate transfer id")
+	}
+
+	now := time.Now().UTC()
+	transfer := model.Transfer{
+		Id:           uid.String(),
+		DeviceId:     dev.Id,
+		TenantId:     tenantId,
+		FromOwner:    dev.Owner,
+		ToOwner:      req.ToOwner,
+		ToTenantId:   toTenantId,
+		IdDataSha256: dev.IdDataSha256,
+		Status:       model.TransferStatusPendingAcceptance,
+		CreatedTs:    now,
+		UpdatedTs:    now,
+	}
+	if toTenantId != "" {
+		transfer.Status = model.TransferStatusPendingApproval
+	}
+
+	if err := d.db.AddTransfer(ctx, transfer); err != nil {
+		return nil, errors.Wrap(err, "failed to add transfer")
+	}
+
+	if toTenantId != "" {
+		if err := d.db.UpdateDevice(ctx, model.Device{Id: dev.Id},
+			model.DeviceUpdate{
+				TransferId: &transfer.Id,
+			}); err != nil {
+			return nil, errors.Wrap(err, "failed to mark device for transfer")
+		}
+	} else {
+		if err := d.deleteDeviceTokens(ctx, dev.Id,
+			revocation.ReasonTransferred); err != nil &&
+			err != store.ErrTokenNotFound {
+			return nil, errors.Wrap(err, "db delete device tokens error")
+		}
+
+		// the new owner has to accept the device again
+		if err := d.db.UpdateAuthSet(ctx,
+			bson.M{
+				model.AuthSetKeyDeviceId: dev.Id,
+				model.AuthSetKeyStatus:   model.DevStatusAccepted,
+			},
+			model.AuthSetUpdate{
+				Status: model.DevStatusPending,
+			}); err != nil && err != store.ErrAuthSetNotFound {
+			return nil, errors.Wrap(err, "failed to reset auth sets")
+		}
+
+		if err := d.db.UpdateDevice(ctx, model.Device{Id: dev.Id},
+			model.DeviceUpdate{
+				Owner:      &transfer.ToOwner,
+				TransferId: &transfer.Id,
+			}); err != nil {
+			return nil, errors.Wrap(err, "failed to mark device for transfer")
+		}
+
+		if err := d.updateDeviceStatus(ctx, dev.Id, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	l.Infof("device %s transfer %s started, to owner: %q, to tenant: %q",
+		dev.Id, transfer.Id, transfer.ToOwner, transfer.ToTenantId)
+
+	return &transfer, nil
+}
+
+// GetDeviceTransfer returns a transfer from or to the tenant
+func (d *DevAuth) GetDeviceTransfer(ctx context.Context, id string) (*model.Transfer, error) {
+	transfer, err := d.db.GetTransfer(ctx, id)
+	switch err {
+	case nil:
+		break
+	case store.ErrTransferNotFound:
+		return nil, ErrTransferNotFound
+	default:
+		return nil, errors.Wrap(err, "failed to fetch transfer")
+	}
+
+	tenantId := tenantFromContext(ctx)
+	if transfer.TenantId != tenantId && transfer.ToTenantId != tenantId {
+		return nil, ErrTransferNotFound
+	}
+
+	return transfer, nil
+}
+
+// CancelDeviceTransfer cancels a pending transfer from the tenant. A device
+// transferred within the tenant gets its previous owner back, its auth sets
+// are left pending; a device transferred to another tenant stays
+// decommissioned if the destination tenant already accepted the transfer.
+func (d *DevAuth) CancelDeviceTransfer(ctx context.Context, id string) error {
+	transfer, err := d.GetDeviceTransfer(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if transfer.TenantId != tenantFromContext(ctx) {
+		return ErrTransferNotFound
+	}
+	if !transfer.Pending() {
+		return ErrTransferNotPending
+	}
+
+	err = d.setTransferStatus(ctx, transfer, model.TransferStatusCancelled, "")
+	switch err {
+	case nil:
+		break
+	case store.ErrTransferNotFound:
+		// changed in the meantime
+		return ErrTransferNotPending
+	default:
+		return err
+	}
+
+	switch transfer.Status {
+	case model.TransferStatusPendingAcceptance:
+		return d.unmarkDeviceForTransfer(ctx, transfer.DeviceId, &transfer.FromOwner)
+	case model.TransferStatusPendingApproval:
+		return d.unmarkDeviceForTransfer(ctx, transfer.DeviceId, nil)
+	}
+	return nil
+}
+
+// AcceptDeviceTransfer accepts a transfer from another tenant to the tenant
+// in context. The device is decommissioned in the source tenant, the
+// transfer completes when it enrolls in the tenant with the same identity
+// data.
+func (d *DevAuth) AcceptDeviceTransfer(ctx context.Context, id string) error {
+	l := log.FromContext(ctx)
+
+	transfer, err := d.getTransferToTenant(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// claim the transfer first, so that it can't be cancelled or declined
+	// while the device is being decommissioned
+	err = d.setTransferStatus(ctx, transfer, model.TransferStatusPendingEnrollment, "")
+	switch err {
+	case nil:
+		break
+	case store.ErrTransferNotFound:
+		return ErrTransferNotApprovable
+	default:
+		return err
+	}
+
+	// the device is decommissioned by deviceauth in the source tenant, not
+	// on behalf of the destination tenant's user
+	srcCtx, err := d.serviceContext(ctx, transfer.TenantId)
+	if err == nil {
+		err = d.deleteDeviceTokens(srcCtx, transfer.DeviceId,
+			revocation.ReasonTransferred)
+		if err == store.ErrTokenNotFound {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = d.DecommissionDevice(srcCtx, transfer.DeviceId)
+	}
+	if err != nil {
+		// let the transfer be accepted again
+		transfer.Status = model.TransferStatusPendingEnrollment
+		if err := d.setTransferStatus(ctx, transfer,
+			model.TransferStatusPendingApproval, ""); err != nil {
+			l.Errorf("failed to reset transfer %s: %v", transfer.Id, err)
+		}
+		return errors.Wrap(err, "failed to decommission device")
+	}
+
+	l.Infof("device %s transfer %s accepted by tenant %s",
+		transfer.DeviceId, transfer.Id, transfer.ToTenantId)
+
+	return nil
+}
+
+// DeclineDeviceTransfer declines a transfer from another tenant to the tenant
+// in context; the device stays in the source tenant.
+func (d *DevAuth) DeclineDeviceTransfer(ctx context.Context, id string) error {
+	transfer, err := d.getTransferToTenant(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = d.setTransferStatus(ctx, transfer, model.TransferStatusDeclined, "")
+	switch err {
+	case nil:
+		break
+	case store.ErrTransferNotFound:
+		return ErrTransferNotApprovable
+	default:
+		return err
+	}
+
+	srcCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: transfer.TenantId,
+	})
+	return d.unmarkDeviceForTransfer(srcCtx, transfer.DeviceId, nil)
+}
+
+// getTransferToTenant returns a transfer to the tenant in context, awaiting
+// its approval
+func (d *DevAuth) getTransferToTenant(ctx context.Context, id string) (*model.Transfer, error) {
+	transfer, err := d.GetDeviceTransfer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if transfer.ToTenantId == "" ||
+		transfer.ToTenantId != tenantFromContext(ctx) {
+		return nil, ErrTransferNotFound
+	}
+	if transfer.Status != model.TransferStatusPendingApproval {
+		return nil, ErrTransferNotApprovable
+	}
+
+	return transfer, nil
+}
+
+// unmarkDeviceForTransfer clears the device's transfer, and restores its
+// owner if given
+func (d *DevAuth) unmarkDeviceForTransfer(ctx context.Context, devId string, owner *string) error {
+	err := d.db.UpdateDevice(ctx, model.Device{Id: devId},
+		model.DeviceUpdate{
+			Owner:      owner,
+			TransferId: to.StringPtr(""),
+		})
+	if err != nil && err != store.ErrDevNotFound {
+		return errors.Wrap(err, "failed to unmark device for transfer")
+	}
+	return nil
+}
+
+// completeTransfer finishes a transfer within the tenant, when the device
+// got accepted
+func (d *DevAuth) completeTransfer(ctx context.Context, dev *model.Device) error {
+	err := d.setTransferStatus(ctx, &model.Transfer{
+		Id:     dev.TransferId,
+		Status: model.TransferStatusPendingAcceptance,
+	}, model.TransferStatusCompleted, "")
+	switch err {
+	case nil:
+		break
+	case store.ErrTransferNotFound:
+		// not a transfer within the tenant, e.g. one waiting for
+		// another tenant's approval
+		return nil
+	default:
+		return err
+	}
+
+	return d.unmarkDeviceForTransfer(ctx, dev.Id, nil)
+}
+
+// completeTenantTransfer finishes a transfer to the tenant in context, if
+// there's one waiting for the device that just enrolled
+func (d *DevAuth) completeTenantTransfer(ctx context.Context, dev *model.Device) error {
+	tenantId := tenantFromContext(ctx)
+	if tenantId == "" {
+		return nil
+	}
+
+	transfer, err := d.db.GetPendingTransferByIdDataHash(ctx, tenantId, dev.IdDataSha256)
+	switch err {
+	case nil:
+		break
+	case store.ErrTransferNotFound:
+		return nil
+	default:
+		return errors.Wrap(err, "failed to fetch transfer")
+	}
+
+	err = d.setTransferStatus(ctx, transfer, model.TransferStatusCompleted, dev.Id)
+	switch err {
+	case nil:
+		break
+	case store.ErrTransferNotFound:
+		// completed or cancelled in the meantime
+		return nil
+	default:
+		return err
+	}
+
+	if transfer.ToOwner != "" {
+		if err := d.db.UpdateDevice(ctx, model.Device{Id: dev.Id},
+			model.DeviceUpdate{
+				Owner: &transfer.ToOwner,
+			}); err != nil {
+			return errors.Wrap(err, "failed to set device owner")
+		}
+	}
+
+	log.FromContext(ctx).Infof("device %s transfer %s completed, device enrolled as %s",
+		transfer.DeviceId, transfer.Id, dev.Id)
+
+	return nil
+}
+
+// setTransferStatus moves the transfer from its current status to the given
+// one; returns store.ErrTransferNotFound if its status has changed in the
+// meantime
+func (d *DevAuth) setTransferStatus(ctx context.Context, transfer *model.Transfer, status, newDevId string) error {
+	err := d.db.UpdateTransfer(ctx, transfer.Id, transfer.Status,
+		model.TransferUpdate{
+			Status:      status,
+			NewDeviceId: newDevId,
+			UpdatedTs:   uto.TimePtr(time.Now().UTC()),
+		})
+	switch err {
+	case nil, store.ErrTransferNotFound:
+		return err
+	default:
+		return errors.Wrap(err, "failed to update transfer")
+	}
+}
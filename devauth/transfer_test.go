@@ -0,0 +1,537 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package devauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deviceauth/client/orchestrator"
+	morchestrator "github.com/mendersoftware/deviceauth/client/orchestrator/mocks"
+	"github.com/mendersoftware/deviceauth/jwt"
+	mjwt "github.com/mendersoftware/deviceauth/jwt/mocks"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+	mstore "github.com/mendersoftware/deviceauth/store/mocks"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+func TestDevAuthStartDeviceTransfer(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		req model.TransferReq
+
+		dev    *model.Device
+		devErr error
+
+		verifyTenant bool
+
+		status string
+		err    string
+	}{
+		"ok, within tenant": {
+			req: model.TransferReq{
+				DeviceId: "dev1",
+				ToOwner:  "bob",
+			},
+			dev: &model.Device{
+				Id:    "dev1",
+				Owner: "alice",
+			},
+			status: model.TransferStatusPendingAcceptance,
+		},
+		"ok, to tenant": {
+			req: model.TransferReq{
+				DeviceId:   "dev1",
+				ToOwner:    "bob",
+				ToTenantId: "tenant2",
+			},
+			dev: &model.Device{
+				Id:    "dev1",
+				Owner: "alice",
+			},
+			verifyTenant: true,
+			status:       model.TransferStatusPendingApproval,
+		},
+		"error, device not found": {
+			req: model.TransferReq{
+				DeviceId: "dev1",
+				ToOwner:  "bob",
+			},
+			devErr: store.ErrDevNotFound,
+			err:    ErrDeviceNotFound.Error(),
+		},
+		"error, transfer in progress": {
+			req: model.TransferReq{
+				DeviceId: "dev1",
+				ToOwner:  "bob",
+			},
+			dev: &model.Device{
+				Id:         "dev1",
+				TransferId: "transfer1",
+			},
+			err: ErrTransferInProgress.Error(),
+		},
+		"error, no tenant verification": {
+			req: model.TransferReq{
+				DeviceId:   "dev1",
+				ToTenantId: "tenant2",
+			},
+			err: ErrTransferTenantDisabled.Error(),
+		},
+		"error, db": {
+			req: model.TransferReq{
+				DeviceId: "dev1",
+				ToOwner:  "bob",
+			},
+			devErr: errors.New("db connection failed"),
+			err:    "db get device by id error: db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Tenant: "tenant1"})
+			ctxMatcher := mtesting.ContextMatcher()
+
+			db := mstore.DataStore{}
+			db.On("GetDeviceById", ctxMatcher, tc.req.DeviceId).
+				Return(tc.dev, tc.devErr)
+			db.On("AddTransfer", ctxMatcher,
+				mock.MatchedBy(func(tr model.Transfer) bool {
+					return tr.DeviceId == tc.req.DeviceId &&
+						tr.TenantId == "tenant1" &&
+						tr.FromOwner == "alice" &&
+						tr.ToOwner == tc.req.ToOwner
+				})).Return(nil)
+			db.On("DeleteTokenByDevId", ctxMatcher, tc.req.DeviceId).
+				Return(nil)
+			db.On("UpdateAuthSet", ctxMatcher,
+				mock.AnythingOfType("bson.M"),
+				model.AuthSetUpdate{
+					Status: model.DevStatusPending,
+				}).Return(nil)
+			db.On("UpdateDevice", ctxMatcher,
+				model.Device{Id: tc.req.DeviceId},
+				mock.MatchedBy(func(u model.DeviceUpdate) bool {
+					if u.TransferId == nil || *u.TransferId == "" {
+						return false
+					}
+					if tc.req.ToTenantId != "" {
+						// the owner changes once the
+						// destination tenant accepts
+						return u.Owner == nil
+					}
+					return u.Owner != nil && *u.Owner == tc.req.ToOwner
+				})).Return(nil)
+			db.On("GetDeviceStatus", ctxMatcher, tc.req.DeviceId).
+				Return(model.DevStatusPending, nil)
+			db.On("SetDeviceStatus", ctxMatcher,
+				tc.req.DeviceId, model.DevStatusPending).
+				Return(model.DevStatusAccepted, nil)
+			db.On("AddDeviceStatusChange", ctxMatcher,
+				mock.AnythingOfType("model.DeviceStatusChange")).Return(nil)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+			devauth.verifyTenant = tc.verifyTenant
+
+			transfer, err := devauth.StartDeviceTransfer(ctx, &tc.req)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Nil(t, transfer)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, transfer.Id)
+				assert.Equal(t, tc.status, transfer.Status)
+				if tc.req.ToTenantId != "" {
+					// the device keeps working until the
+					// destination tenant accepts it
+					db.AssertNotCalled(t, "DeleteTokenByDevId",
+						ctxMatcher, tc.req.DeviceId)
+				} else {
+					db.AssertCalled(t, "DeleteTokenByDevId",
+						ctxMatcher, tc.req.DeviceId)
+				}
+			}
+		})
+	}
+}
+
+func TestDevAuthCancelDeviceTransfer(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		transfer    *model.Transfer
+		transferErr error
+
+		updateErr error
+
+		owner *string
+
+		err string
+	}{
+		"ok": {
+			transfer: &model.Transfer{
+				Id:        "transfer1",
+				DeviceId:  "dev1",
+				TenantId:  "tenant1",
+				FromOwner: "alice",
+				ToOwner:   "bob",
+				Status:    model.TransferStatusPendingAcceptance,
+			},
+			owner: to.StringPtr("alice"),
+		},
+		"ok, pending approval": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant1",
+				FromOwner:  "alice",
+				ToOwner:    "bob",
+				ToTenantId: "tenant2",
+				Status:     model.TransferStatusPendingApproval,
+			},
+		},
+		"error, changed in the meantime": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant1",
+				ToTenantId: "tenant2",
+				Status:     model.TransferStatusPendingApproval,
+			},
+			updateErr: store.ErrTransferNotFound,
+			err:       ErrTransferNotPending.Error(),
+		},
+		"error, not found": {
+			transferErr: store.ErrTransferNotFound,
+			err:         ErrTransferNotFound.Error(),
+		},
+		"error, transfer to tenant": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant2",
+				ToTenantId: "tenant1",
+				Status:     model.TransferStatusPendingEnrollment,
+			},
+			err: ErrTransferNotFound.Error(),
+		},
+		"error, other tenant": {
+			transfer: &model.Transfer{
+				Id:       "transfer1",
+				DeviceId: "dev1",
+				TenantId: "tenant2",
+				Status:   model.TransferStatusPendingAcceptance,
+			},
+			err: ErrTransferNotFound.Error(),
+		},
+		"error, completed": {
+			transfer: &model.Transfer{
+				Id:       "transfer1",
+				DeviceId: "dev1",
+				TenantId: "tenant1",
+				Status:   model.TransferStatusCompleted,
+			},
+			err: ErrTransferNotPending.Error(),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Tenant: "tenant1"})
+			ctxMatcher := mtesting.ContextMatcher()
+
+			db := mstore.DataStore{}
+			db.On("GetTransfer", ctxMatcher, "transfer1").
+				Return(tc.transfer, tc.transferErr)
+			db.On("UpdateDevice", ctxMatcher,
+				model.Device{Id: "dev1"},
+				model.DeviceUpdate{
+					Owner:      tc.owner,
+					TransferId: to.StringPtr(""),
+				}).Return(nil)
+			if tc.transfer != nil {
+				db.On("UpdateTransfer", ctxMatcher, "transfer1",
+					tc.transfer.Status,
+					mock.MatchedBy(func(u model.TransferUpdate) bool {
+						return u.Status == model.TransferStatusCancelled
+					})).Return(tc.updateErr)
+			}
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.CancelDeviceTransfer(ctx, "transfer1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				db.AssertNotCalled(t, "UpdateDevice",
+					mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				db.AssertExpectations(t)
+			}
+		})
+	}
+}
+
+func TestDevAuthAcceptDeviceTransfer(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		transfer    *model.Transfer
+		transferErr error
+
+		updateErr       error
+		decommissionErr error
+
+		err string
+	}{
+		"ok": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant2",
+				ToOwner:    "bob",
+				ToTenantId: "tenant1",
+				Status:     model.TransferStatusPendingApproval,
+			},
+		},
+		"error, not found": {
+			transferErr: store.ErrTransferNotFound,
+			err:         ErrTransferNotFound.Error(),
+		},
+		"error, transfer from tenant": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant1",
+				ToTenantId: "tenant2",
+				Status:     model.TransferStatusPendingApproval,
+			},
+			err: ErrTransferNotFound.Error(),
+		},
+		"error, already accepted": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant2",
+				ToTenantId: "tenant1",
+				Status:     model.TransferStatusPendingEnrollment,
+			},
+			err: ErrTransferNotApprovable.Error(),
+		},
+		"error, changed in the meantime": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant2",
+				ToTenantId: "tenant1",
+				Status:     model.TransferStatusPendingApproval,
+			},
+			updateErr: store.ErrTransferNotFound,
+			err:       ErrTransferNotApprovable.Error(),
+		},
+		"error, decommissioning": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant2",
+				ToTenantId: "tenant1",
+				Status:     model.TransferStatusPendingApproval,
+			},
+			decommissionErr: errors.New("orchestrator unavailable"),
+			err:             "failed to decommission device: submit device decommissioning job error: orchestrator unavailable",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Tenant: "tenant1"})
+			ctxMatcher := mtesting.ContextMatcher()
+			// the device is decommissioned in the source tenant
+			srcMatcher := mock.MatchedBy(func(ctx context.Context) bool {
+				ident := identity.FromContext(ctx)
+				return ident != nil && ident.Tenant == "tenant2"
+			})
+
+			db := mstore.DataStore{}
+			db.On("GetTransfer", ctxMatcher, "transfer1").
+				Return(tc.transfer, tc.transferErr)
+			db.On("UpdateTransfer", ctxMatcher, "transfer1",
+				model.TransferStatusPendingApproval,
+				mock.MatchedBy(func(u model.TransferUpdate) bool {
+					return u.Status == model.TransferStatusPendingEnrollment
+				})).Return(tc.updateErr)
+			db.On("UpdateTransfer", ctxMatcher, "transfer1",
+				model.TransferStatusPendingEnrollment,
+				mock.MatchedBy(func(u model.TransferUpdate) bool {
+					return u.Status == model.TransferStatusPendingApproval
+				})).Return(nil)
+			db.On("DeleteTokenByDevId", srcMatcher, "dev1").Return(nil)
+			db.On("UpdateDevice", srcMatcher, model.Device{Id: "dev1"},
+				mock.AnythingOfType("model.DeviceUpdate")).Return(nil)
+			db.On("DeleteAuthSetsForDevice", srcMatcher, "dev1").Return(nil)
+			db.On("DeleteDevice", srcMatcher, "dev1").Return(nil)
+
+			co := morchestrator.ClientRunner{}
+			co.On("SubmitDeviceDecommisioningJob", srcMatcher,
+				mock.MatchedBy(func(req orchestrator.DecommissioningReq) bool {
+					return req.DeviceId == "dev1" &&
+						req.Authorization == "Bearer servicetoken"
+				})).Return(tc.decommissionErr)
+
+			jwth := mjwt.Handler{}
+			jwth.On("ToJWT",
+				mock.MatchedBy(func(jt *jwt.Token) bool {
+					return jt.Claims.Tenant == "tenant2"
+				})).
+				Return("servicetoken", nil)
+
+			devauth := NewDevAuth(&db, &co, &jwth, Config{})
+
+			err := devauth.AcceptDeviceTransfer(ctx, "transfer1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				db.AssertNotCalled(t, "DeleteDevice", srcMatcher, "dev1")
+			} else {
+				assert.NoError(t, err)
+				db.AssertCalled(t, "DeleteDevice", srcMatcher, "dev1")
+			}
+
+			if tc.decommissionErr != nil {
+				// can be accepted again
+				db.AssertCalled(t, "UpdateTransfer", ctxMatcher, "transfer1",
+					model.TransferStatusPendingEnrollment,
+					mock.AnythingOfType("model.TransferUpdate"))
+			}
+		})
+	}
+}
+
+func TestDevAuthDeclineDeviceTransfer(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		transfer    *model.Transfer
+		transferErr error
+
+		updateErr error
+
+		err string
+	}{
+		"ok": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant2",
+				ToOwner:    "bob",
+				ToTenantId: "tenant1",
+				Status:     model.TransferStatusPendingApproval,
+			},
+		},
+		"error, not found": {
+			transferErr: store.ErrTransferNotFound,
+			err:         ErrTransferNotFound.Error(),
+		},
+		"error, transfer within other tenant": {
+			transfer: &model.Transfer{
+				Id:       "transfer1",
+				DeviceId: "dev1",
+				TenantId: "tenant1",
+				Status:   model.TransferStatusPendingAcceptance,
+			},
+			err: ErrTransferNotFound.Error(),
+		},
+		"error, cancelled": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant2",
+				ToTenantId: "tenant1",
+				Status:     model.TransferStatusCancelled,
+			},
+			err: ErrTransferNotApprovable.Error(),
+		},
+		"error, changed in the meantime": {
+			transfer: &model.Transfer{
+				Id:         "transfer1",
+				DeviceId:   "dev1",
+				TenantId:   "tenant2",
+				ToTenantId: "tenant1",
+				Status:     model.TransferStatusPendingApproval,
+			},
+			updateErr: store.ErrTransferNotFound,
+			err:       ErrTransferNotApprovable.Error(),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Tenant: "tenant1"})
+			ctxMatcher := mtesting.ContextMatcher()
+			srcMatcher := mock.MatchedBy(func(ctx context.Context) bool {
+				ident := identity.FromContext(ctx)
+				return ident != nil && ident.Tenant == "tenant2"
+			})
+
+			db := mstore.DataStore{}
+			db.On("GetTransfer", ctxMatcher, "transfer1").
+				Return(tc.transfer, tc.transferErr)
+			db.On("UpdateTransfer", ctxMatcher, "transfer1",
+				model.TransferStatusPendingApproval,
+				mock.MatchedBy(func(u model.TransferUpdate) bool {
+					return u.Status == model.TransferStatusDeclined
+				})).Return(tc.updateErr)
+			db.On("UpdateDevice", srcMatcher, model.Device{Id: "dev1"},
+				model.DeviceUpdate{
+					TransferId: to.StringPtr(""),
+				}).Return(nil)
+
+			devauth := NewDevAuth(&db, nil, nil, Config{})
+
+			err := devauth.DeclineDeviceTransfer(ctx, "transfer1")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				db.AssertNotCalled(t, "UpdateDevice",
+					mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				db.AssertExpectations(t)
+			}
+		})
+	}
+}
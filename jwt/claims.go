@@ -14,9 +14,16 @@
 package jwt
 
 import (
+	"encoding/json"
 	"time"
 )
 
+const (
+	// scope of the final token given to an offboarded device, valid for a
+	// limited set of device API endpoints only
+	ScopeOffboarding = "mender.offboarding"
+)
+
 type Claims struct {
 	Audience  string `json:"aud,omitempty"`
 	ExpiresAt int64  `json:"exp,omitempty"`
@@ -28,6 +35,35 @@ type Claims struct {
 	Scope     string `json:"scp,omitempty"`
 	Tenant    string `json:"mender.tenant,omitempty"`
 	Device    bool   `json:"mender.device,omitempty"`
+	SpiffeID  string `json:"spiffe_id,omitempty"`
+
+	// additional claims, see ClaimsTemplate; never override the ones
+	// above. Only issued, not parsed back, verifying tokens doesn't need
+	// them.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// claims without the custom marshaling
+type stdClaims Claims
+
+func (c *Claims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal((*stdClaims)(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+
+	all := make(map[string]interface{}, len(c.Extra))
+	for k, v := range c.Extra {
+		all[k] = v
+	}
+	var std map[string]json.RawMessage
+	if err := json.Unmarshal(data, &std); err != nil {
+		return nil, err
+	}
+	for k, v := range std {
+		all[k] = v
+	}
+	return json.Marshal(all)
 }
 
 // Valid checks if claims are valid. Returns error if validation fails.
@@ -0,0 +1,146 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// claims set by the service itself, which templates can't override
+	reservedClaims = []string{
+		"aud", "exp", "jti", "iat", "iss", "nbf", "sub", "scp",
+		"mender.tenant", "mender.device", "spiffe_id",
+	}
+
+	claimsPlaceholder = regexp.MustCompile(`{{\s*([a-z_]+(?:\.[^{}\s]+)?)\s*}}`)
+)
+
+// ClaimsTemplate defines the additional claims of device tokens, by claim
+// name. String values may contain placeholders, substituted when a token is
+// issued: '{{device_id}}', '{{tenant}}', '{{status}}' and
+// '{{id_data.<attribute>}}'. A value that is a single placeholder gets the
+// value as is, e.g. a list for a multi-valued identity attribute, and the
+// claim is left out if there's no value; other values are used verbatim.
+type ClaimsTemplate map[string]interface{}
+
+// ClaimsData is what the placeholders of a ClaimsTemplate are filled in
+// with
+type ClaimsData struct {
+	DeviceId string
+	Tenant   string
+	Status   string
+	IdData   map[string]interface{}
+}
+
+// LoadClaimsTemplate reads a claims template from a JSON file, e.g.
+// {"region": "eu-1", "mender.mac": "{{id_data.mac}}"}
+func LoadClaimsTemplate(path string) (ClaimsTemplate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read claims template")
+	}
+
+	var tmpl ClaimsTemplate
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		return nil, errors.Wrap(err, "failed to parse claims template")
+	}
+	if err := tmpl.Validate(); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Validate checks that the template doesn't override reserved claims, and
+// only uses known placeholders
+func (t ClaimsTemplate) Validate() error {
+	for name, v := range t {
+		for _, r := range reservedClaims {
+			if name == r {
+				return errors.Errorf("claims template: reserved claim %s", name)
+			}
+		}
+
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		for _, m := range claimsPlaceholder.FindAllStringSubmatch(s, -1) {
+			switch field := m[1]; {
+			case field == "device_id", field == "tenant", field == "status",
+				strings.HasPrefix(field, "id_data."):
+			default:
+				return errors.Errorf("claims template: unknown placeholder %s in claim %s",
+					m[0], name)
+			}
+		}
+	}
+	return nil
+}
+
+// Claims fills in the template
+func (t ClaimsTemplate) Claims(data ClaimsData) map[string]interface{} {
+	if len(t) == 0 {
+		return nil
+	}
+
+	claims := make(map[string]interface{}, len(t))
+	for name, v := range t {
+		s, ok := v.(string)
+		if !ok {
+			claims[name] = v
+			continue
+		}
+
+		if m := claimsPlaceholder.FindStringSubmatch(s); m != nil && m[0] == s {
+			if val := data.value(m[1]); val != nil {
+				claims[name] = val
+			}
+			continue
+		}
+
+		claims[name] = claimsPlaceholder.ReplaceAllStringFunc(s, func(p string) string {
+			val := data.value(claimsPlaceholder.FindStringSubmatch(p)[1])
+			if val == nil {
+				return ""
+			}
+			return fmt.Sprint(val)
+		})
+	}
+	return claims
+}
+
+func (d ClaimsData) value(field string) interface{} {
+	var s string
+	switch field {
+	case "device_id":
+		s = d.DeviceId
+	case "tenant":
+		s = d.Tenant
+	case "status":
+		s = d.Status
+	default:
+		return d.IdData[strings.TrimPrefix(field, "id_data.")]
+	}
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimsMarshalExtra(t *testing.T) {
+	claims := &Claims{
+		ID:        "foo",
+		Subject:   "dev1",
+		ExpiresAt: 1700000000,
+		Extra: map[string]interface{}{
+			"region": "eu-1",
+			// can't override the standard claims
+			"sub": "dev2",
+		},
+	}
+
+	data, err := json.Marshal(claims)
+	assert.NoError(t, err)
+	assert.JSONEq(t,
+		`{"jti": "foo", "sub": "dev1", "exp": 1700000000, "region": "eu-1"}`,
+		string(data))
+
+	claims.Extra = nil
+	data, err = json.Marshal(claims)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"exp":1700000000,"jti":"foo","sub":"dev1"}`, string(data))
+}
+
+func TestClaimsTemplateValidate(t *testing.T) {
+	testCases := map[string]struct {
+		tmpl ClaimsTemplate
+
+		err string
+	}{
+		"ok": {
+			tmpl: ClaimsTemplate{
+				"region":     "eu-1",
+				"ref":        "{{tenant}}/{{ device_id }}",
+				"mender.mac": "{{id_data.mac}}",
+				"state":      "{{status}}",
+				"tier":       3,
+			},
+		},
+		"error, reserved claim": {
+			tmpl: ClaimsTemplate{"mender.tenant": "foo"},
+			err:  "claims template: reserved claim mender.tenant",
+		},
+		"error, unknown placeholder": {
+			tmpl: ClaimsTemplate{"owner": "{{user}}"},
+			err:  "claims template: unknown placeholder {{user}} in claim owner",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.tmpl.Validate()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClaimsTemplateClaims(t *testing.T) {
+	tmpl := ClaimsTemplate{
+		"region":  "eu-1",
+		"tier":    float64(3),
+		"ref":     "{{tenant}}/{{device_id}}",
+		"state":   "{{ status }}",
+		"macs":    "{{id_data.mac}}",
+		"sn":      "sn-{{id_data.sn}}",
+		"missing": "{{id_data.foo}}",
+	}
+
+	claims := tmpl.Claims(ClaimsData{
+		DeviceId: "dev1",
+		Status:   "accepted",
+		IdData: map[string]interface{}{
+			"mac": []interface{}{"00:01:02:03:04:05", "00:01:02:03:04:06"},
+			"sn":  "0001",
+		},
+	})
+	assert.Equal(t, map[string]interface{}{
+		"region": "eu-1",
+		"tier":   float64(3),
+		"ref":    "/dev1",
+		"state":  "accepted",
+		"macs":   []interface{}{"00:01:02:03:04:05", "00:01:02:03:04:06"},
+		"sn":     "sn-0001",
+	}, claims)
+
+	assert.Nil(t, ClaimsTemplate{}.Claims(ClaimsData{DeviceId: "dev1"}))
+}
+
+func TestLoadClaimsTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claims")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testCases := map[string]struct {
+		data string
+
+		tmpl ClaimsTemplate
+		err  string
+	}{
+		"ok": {
+			data: `{"region": "eu-1", "mender.mac": "{{id_data.mac}}"}`,
+			tmpl: ClaimsTemplate{
+				"region":     "eu-1",
+				"mender.mac": "{{id_data.mac}}",
+			},
+		},
+		"error, bad json": {
+			data: `{"region": `,
+			err:  "failed to parse claims template: unexpected end of JSON input",
+		},
+		"error, invalid template": {
+			data: `{"sub": "foo"}`,
+			err:  "claims template: reserved claim sub",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "claims.json")
+			assert.NoError(t, ioutil.WriteFile(path, []byte(tc.data), 0600))
+
+			tmpl, err := LoadClaimsTemplate(path)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.tmpl, tmpl)
+			}
+		})
+	}
+
+	_, err = LoadClaimsTemplate(filepath.Join(dir, "none.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// JWE algorithms of encrypted tokens: direct encryption with the
+	// shared key, AES-256 GCM
+	jweAlg = "dir"
+	jweEnc = "A256GCM"
+
+	jweKeySize = 32
+)
+
+var (
+	ErrEncryptionKey = errors.New("jwt: encryption key must be 256 bits, base64 encoded")
+
+	// protected header of encrypted tokens, also their additional
+	// authenticated data
+	jweHeader = base64.RawURLEncoding.EncodeToString(
+		[]byte(`{"alg":"` + jweAlg + `","enc":"` + jweEnc + `","cty":"JWT"}`))
+)
+
+// ParseEncryptionKey reads a token encryption key, 256 random bits base64
+// encoded, e.g. as generated with 'openssl rand -base64 32'
+func ParseEncryptionKey(data []byte) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != jweKeySize {
+		return nil, ErrEncryptionKey
+	}
+	return key, nil
+}
+
+// JWEHandler encrypts the tokens of another handler with a key shared with
+// the API gateway (JWE compact serialization, nested JWT), so that token
+// claims can't be read by devices or intermediaries. Tokens are decrypted
+// before they're verified; tokens that aren't encrypted are passed on as is,
+// so tokens issued before enabling encryption stay valid.
+type JWEHandler struct {
+	handler Handler
+	aead    cipher.AEAD
+}
+
+func NewJWEHandler(handler Handler, key []byte) (*JWEHandler, error) {
+	if len(key) != jweKeySize {
+		return nil, ErrEncryptionKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to setup token encryption")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to setup token encryption")
+	}
+
+	return &JWEHandler{
+		handler: handler,
+		aead:    aead,
+	}, nil
+}
+
+func (j *JWEHandler) ToJWT(t *Token) (string, error) {
+	raw, err := j.handler.ToJWT(t)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, j.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", errors.Wrap(err, "failed to generate token iv")
+	}
+
+	sealed := j.aead.Seal(nil, iv, []byte(raw), []byte(jweHeader))
+	ciphertext, tag := sealed[:len(raw)], sealed[len(raw):]
+
+	// no encrypted key with direct encryption, its segment stays empty
+	return jweHeader + ".." +
+		base64.RawURLEncoding.EncodeToString(iv) + "." +
+		base64.RawURLEncoding.EncodeToString(ciphertext) + "." +
+		base64.RawURLEncoding.EncodeToString(tag), nil
+}
+
+func (j *JWEHandler) FromJWT(tokstr string) (*Token, error) {
+	segs := strings.Split(tokstr, ".")
+	switch len(segs) {
+	case 3:
+		return j.handler.FromJWT(tokstr)
+	case 5:
+	default:
+		return nil, ErrTokenSegments
+	}
+
+	raw, err := j.decrypt(segs)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	return j.handler.FromJWT(raw)
+}
+
+func (j *JWEHandler) decrypt(segs []string) (string, error) {
+	hdrData, err := base64.RawURLEncoding.DecodeString(segs[0])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode token header")
+	}
+	var hdr struct {
+		Alg string `json:"alg"`
+		Enc string `json:"enc"`
+	}
+	if err := json.Unmarshal(hdrData, &hdr); err != nil {
+		return "", errors.Wrap(err, "failed to parse token header")
+	}
+	if hdr.Alg != jweAlg || hdr.Enc != jweEnc || segs[1] != "" {
+		return "", errors.New("unexpected encryption method: " +
+			hdr.Alg + "/" + hdr.Enc)
+	}
+
+	var parts [3][]byte
+	for i, seg := range segs[2:] {
+		parts[i], err = base64.RawURLEncoding.DecodeString(seg)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to decode token segment")
+		}
+	}
+	iv, ciphertext, tag := parts[0], parts[1], parts[2]
+	if len(iv) != j.aead.NonceSize() || len(tag) != j.aead.Overhead() {
+		return "", errors.New("malformed encrypted token")
+	}
+
+	// the protected header, as sent, is the additional authenticated data
+	raw, err := j.aead.Open(nil, iv, append(ciphertext, tag...), []byte(segs[0]))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt token")
+	}
+	return string(raw), nil
+}
+
+// JWKS returns the keys of the wrapped handler; the gateway verifies tokens
+// with them once it decrypted them
+func (j *JWEHandler) JWKS() []JWK {
+	if ks, ok := j.handler.(KeySet); ok {
+		return ks.JWKS()
+	}
+	return nil
+}
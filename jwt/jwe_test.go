@@ -0,0 +1,138 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0x2a}, 32)
+
+	testCases := map[string]struct {
+		data string
+
+		err error
+	}{
+		"ok": {
+			data: base64.StdEncoding.EncodeToString(key) + "\n",
+		},
+		"error, short key": {
+			data: base64.StdEncoding.EncodeToString(key[:16]),
+			err:  ErrEncryptionKey,
+		},
+		"error, not base64": {
+			data: "not a key",
+			err:  ErrEncryptionKey,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := ParseEncryptionKey([]byte(tc.data))
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, key, out)
+			}
+		})
+	}
+}
+
+func TestJWEHandler(t *testing.T) {
+	rsHandler := NewJWTHandlerRS256(loadPrivKey("./testdata/private.pem", t))
+	key := bytes.Repeat([]byte{0x2a}, 32)
+
+	_, err := NewJWEHandler(rsHandler, key[:16])
+	assert.EqualError(t, err, ErrEncryptionKey.Error())
+
+	j, err := NewJWEHandler(rsHandler, key)
+	assert.NoError(t, err)
+
+	token := &Token{
+		Claims: Claims{
+			ID:        "someid",
+			Subject:   "foo",
+			Issuer:    "Mender",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}
+	expired := &Token{
+		Claims: Claims{
+			ID:        "someid",
+			Subject:   "foo",
+			Issuer:    "Mender",
+			ExpiresAt: time.Now().Add(-time.Hour).Unix(),
+		},
+	}
+
+	raw, err := j.ToJWT(token)
+	assert.NoError(t, err)
+	segs := strings.Split(raw, ".")
+	assert.Len(t, segs, 5)
+	assert.Empty(t, segs[1])
+
+	// claims aren't readable without the key
+	_, err = rsHandler.FromJWT(raw)
+	assert.Error(t, err)
+
+	out, err := j.FromJWT(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, token.Claims, out.Claims)
+
+	// each token gets its own iv
+	raw2, err := j.ToJWT(token)
+	assert.NoError(t, err)
+	assert.NotEqual(t, raw, raw2)
+
+	// expired tokens are decrypted, and reported as expired
+	expRaw, err := j.ToJWT(expired)
+	assert.NoError(t, err)
+	_, err = j.FromJWT(expRaw)
+	assert.EqualError(t, err, ErrTokenExpired.Error())
+
+	// tokens issued before encryption was enabled
+	plain, err := rsHandler.ToJWT(token)
+	assert.NoError(t, err)
+	out, err = j.FromJWT(plain)
+	assert.NoError(t, err)
+	assert.Equal(t, token.Claims, out.Claims)
+
+	// tampered tokens, or tokens encrypted with another key
+	tampered := strings.Join(append(segs[:3:3], segs[4], segs[3]), ".")
+	_, err = j.FromJWT(tampered)
+	assert.EqualError(t, err, ErrTokenInvalid.Error())
+
+	other, err := NewJWEHandler(rsHandler, bytes.Repeat([]byte{0x2b}, 32))
+	assert.NoError(t, err)
+	_, err = other.FromJWT(raw)
+	assert.EqualError(t, err, ErrTokenInvalid.Error())
+
+	otherHdr := base64.RawURLEncoding.EncodeToString(
+		[]byte(`{"alg":"RSA-OAEP","enc":"A256GCM"}`))
+	_, err = j.FromJWT(strings.Join(append([]string{otherHdr}, segs[1:]...), "."))
+	assert.EqualError(t, err, ErrTokenInvalid.Error())
+
+	_, err = j.FromJWT("foo.bar")
+	assert.EqualError(t, err, ErrTokenSegments.Error())
+
+	assert.Equal(t, rsHandler.JWKS(), j.JWKS())
+}
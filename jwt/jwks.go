@@ -0,0 +1,149 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// JWK is a public JSON Web Key (RFC 7517), of the types the token handlers
+// sign with
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC, OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, as served to token verifiers. The version
+// changes whenever the keys, or their order, do; verifiers caching the set
+// can tell a rotation from it.
+type JWKS struct {
+	Keys    []JWK  `json:"keys"`
+	Version string `json:"version,omitempty"`
+}
+
+// KeySet is implemented by handlers which can publish their verification
+// keys
+type KeySet interface {
+	JWKS() []JWK
+}
+
+// NewJWK builds the JWK of a public key used with the signing algorithm;
+// the key ID is the key's RFC 7638 thumbprint
+func NewJWK(pub crypto.PublicKey, alg string) (*JWK, error) {
+	var jwk *JWK
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		jwk = &JWK{
+			Kty: "RSA",
+			N:   b64(key.N.Bytes()),
+			E:   b64(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk = &JWK{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   b64(key.X.FillBytes(make([]byte, size))),
+			Y:   b64(key.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		jwk = &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   b64(key),
+		}
+	default:
+		return nil, errors.New("jwt: unsupported public key type")
+	}
+
+	jwk.Use = "sig"
+	jwk.Alg = alg
+	jwk.Kid = jwk.thumbprint()
+	return jwk, nil
+}
+
+// thumbprint computes the RFC 7638 thumbprint, over the required members
+// in lexicographic order
+func (k *JWK) thumbprint() string {
+	var members interface{}
+	switch k.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return b64(sum[:])
+}
+
+// KeySetVersion is the version of a key set: a digest of the key IDs, in
+// order, the signing key first
+func KeySetVersion(keys []JWK) string {
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k.Kid))
+		h.Write([]byte{0})
+	}
+	return b64(h.Sum(nil)[:16])
+}
+
+// keyID is the 'kid' of tokens signed with the private key
+func keyID(pub crypto.PublicKey) string {
+	jwk, err := NewJWK(pub, "")
+	if err != nil {
+		return ""
+	}
+	return jwk.Kid
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJWK(t *testing.T) {
+	// RFC 7638, sec. 3.1
+	n, _ := base64.RawURLEncoding.DecodeString(
+		"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPF" +
+			"FxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93l" +
+			"qt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHz" +
+			"u6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPks" +
+			"INHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	pub := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: 65537,
+	}
+
+	jwk, err := NewJWK(pub, "RS256")
+	assert.NoError(t, err)
+	assert.Equal(t, "RSA", jwk.Kty)
+	assert.Equal(t, "AQAB", jwk.E)
+	assert.Equal(t, "sig", jwk.Use)
+	assert.Equal(t, "RS256", jwk.Alg)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jwk.Kid)
+
+	_, err = NewJWK("foo", "RS256")
+	assert.EqualError(t, err, "jwt: unsupported public key type")
+}
+
+func TestJWKSKeyID(t *testing.T) {
+	rsHandler := NewJWTHandlerRS256(loadPrivKey("./testdata/private.pem", t))
+	esHandler, err := NewJWTHandlerES256(loadECPrivKey("./testdata/private_ec.pem", t))
+	assert.NoError(t, err)
+	edHandler := NewJWTHandlerEdDSA(loadEd25519PrivKey("./testdata/private_ed25519.pem", t))
+
+	testCases := map[string]struct {
+		handler Handler
+		kty     string
+		crv     string
+	}{
+		"RS256": {
+			handler: rsHandler,
+			kty:     "RSA",
+		},
+		"ES256": {
+			handler: esHandler,
+			kty:     "EC",
+			crv:     "P-256",
+		},
+		"EdDSA": {
+			handler: edHandler,
+			kty:     "OKP",
+			crv:     "Ed25519",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			keys := tc.handler.(KeySet).JWKS()
+			if assert.Len(t, keys, 1) {
+				assert.Equal(t, tc.kty, keys[0].Kty)
+				assert.Equal(t, tc.crv, keys[0].Crv)
+				assert.Equal(t, name, keys[0].Alg)
+			}
+
+			// issued tokens point at the key
+			raw, err := tc.handler.ToJWT(&Token{Claims: Claims{Subject: "foo"}})
+			assert.NoError(t, err)
+			parsed, _ := jwtgo.Parse(raw, nil)
+			if assert.NotNil(t, parsed) {
+				assert.Equal(t, keys[0].Kid, parsed.Header["kid"])
+			}
+		})
+	}
+
+	ring := NewKeyRing(edHandler, rsHandler)
+	keys := ring.JWKS()
+	if assert.Len(t, keys, 2) {
+		assert.Equal(t, "EdDSA", keys[0].Alg)
+		assert.Equal(t, "RS256", keys[1].Alg)
+	}
+}
+
+func TestKeySetVersion(t *testing.T) {
+	t.Parallel()
+
+	a := JWK{Kid: "a"}
+	b := JWK{Kid: "b"}
+
+	assert.Equal(t,
+		KeySetVersion([]JWK{a, b}), KeySetVersion([]JWK{{Kid: "a"}, {Kid: "b"}}))
+	assert.NotEqual(t, KeySetVersion([]JWK{a, b}), KeySetVersion([]JWK{b, a}))
+	assert.NotEqual(t, KeySetVersion([]JWK{a}), KeySetVersion([]JWK{a, b}))
+	assert.NotEqual(t,
+		KeySetVersion([]JWK{{Kid: "ab"}}), KeySetVersion([]JWK{a, b}))
+}
@@ -14,15 +14,36 @@
 package jwt
 
 import (
+	"crypto"
 	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	jwtgo "github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 )
 
+const (
+	// max number of distinct token headers remembered as valid
+	maxCachedHeaders = 16
+)
+
 var (
-	ErrTokenExpired = errors.New("jwt: token expired")
-	ErrTokenInvalid = errors.New("jwt: token invalid")
+	ErrTokenExpired  = errors.New("jwt: token expired")
+	ErrTokenInvalid  = errors.New("jwt: token invalid")
+	ErrTokenSegments = errors.New("token contains an invalid number of segments")
+
+	// scratch buffers for decoding token segments
+	bufPool = sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, 0, 1024)
+			return &buf
+		},
+	}
 )
 
 // Handler jwt generator/verifier
@@ -38,50 +59,203 @@ type Handler interface {
 // JWTHandlerRS256 is an RS256-specific JWTHandler
 type JWTHandlerRS256 struct {
 	privKey *rsa.PrivateKey
+	kid     string
+	mu      sync.RWMutex
+
+	parser tokenParser
 }
 
 func NewJWTHandlerRS256(privKey *rsa.PrivateKey) *JWTHandlerRS256 {
-	return &JWTHandlerRS256{
-		privKey: privKey,
+	j := &JWTHandlerRS256{
+		parser: tokenParser{
+			alg: jwtgo.SigningMethodRS256.Alg(),
+		},
 	}
+	j.SetPrivateKey(privKey)
+	return j
+}
+
+// SetPrivateKey replaces the signing key, e.g. after it was rotated in an
+// external secret store
+func (j *JWTHandlerRS256) SetPrivateKey(privKey *rsa.PrivateKey) {
+	var kid string
+	if privKey != nil {
+		kid = keyID(&privKey.PublicKey)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.privKey = privKey
+	j.kid = kid
+}
+
+func (j *JWTHandlerRS256) key() (*rsa.PrivateKey, string) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.privKey, j.kid
 }
 
 func (j *JWTHandlerRS256) ToJWT(token *Token) (string, error) {
+	key, kid := j.key()
+
 	//generate
 	jt := jwtgo.NewWithClaims(jwtgo.SigningMethodRS256, &token.Claims)
+	jt.Header["kid"] = kid
 
 	//sign
-	data, err := jt.SignedString(j.privKey)
+	data, err := jt.SignedString(key)
 	return data, err
 }
 
+func (j *JWTHandlerRS256) KeyID() string {
+	_, kid := j.key()
+	return kid
+}
+
+func (j *JWTHandlerRS256) JWKS() []JWK {
+	key, _ := j.key()
+	if key == nil {
+		return nil
+	}
+	jwk, err := NewJWK(&key.PublicKey, jwtgo.SigningMethodRS256.Alg())
+	if err != nil {
+		return nil
+	}
+	return []JWK{*jwk}
+}
+
 func (j *JWTHandlerRS256) FromJWT(tokstr string) (*Token, error) {
-	jwttoken, err := jwtgo.ParseWithClaims(tokstr, &Claims{},
-		func(token *jwtgo.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwtgo.SigningMethodRSA); !ok {
-				return nil, errors.New("unexpected signing method: " + token.Method.Alg())
-			}
-			return &j.privKey.PublicKey, nil
-		},
-	)
+	return j.parser.parse(tokstr, func(input, sig []byte) error {
+		key, _ := j.key()
+		digest := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256,
+			digest[:], sig)
+	})
+}
+
+// tokenParser parses and verifies tokens signed with a single method. It is on the hot path of every device API call, so instead of
+// going through jwt-go it works directly on the token string: segments are
+// sliced in place, base64 is decoded into pooled buffers and known good
+// headers are remembered.
+type tokenParser struct {
+	alg string
+
+	// headers known to be valid
+	headers    sync.Map
+	numHeaders int32
+}
+
+// parse verifies the token's signature with verify, given the signing input
+// (header and payload) and the decoded signature, then parses and validates
+// claims; verify must not retain the arguments
+func (p *tokenParser) parse(tokstr string, verify func(input, sig []byte) error) (*Token, error) {
+	dot1 := strings.IndexByte(tokstr, '.')
+	dot2 := strings.LastIndexByte(tokstr, '.')
+	if dot1 < 0 || dot1 == dot2 ||
+		strings.IndexByte(tokstr[dot1+1:dot2], '.') >= 0 {
+		return nil, ErrTokenSegments
+	}
+	header, payload, sig := tokstr[:dot1], tokstr[dot1+1:dot2], tokstr[dot2+1:]
+
+	if err := p.checkHeader(header); err != nil {
+		return nil, err
+	}
+
+	bufp := bufPool.Get().(*[]byte)
+	defer bufPool.Put(bufp)
+
+	// signature first, claims of tokens with a bad signature are never
+	// looked at
+	buf, err := decodeSegment((*bufp)[:0], sig)
+	if err != nil {
+		return nil, err
+	}
+	input := append(buf[len(buf):], tokstr[:dot2]...)
+	*bufp = buf
+
+	if err := verify(input, buf); err != nil {
+		return nil, err
+	}
 
-	// our Claims return Mender-specific validation errors
-	// go-jwt will wrap them in a generic ValidationError - unwrap and return directly
+	buf, err = decodeSegment(buf[:0], payload)
+	*bufp = buf
 	if err != nil {
-		err, ok := err.(*jwtgo.ValidationError)
-		if ok && err.Inner != nil {
-			return nil, err.Inner
-		} else {
-			return nil, err
+		return nil, err
+	}
+
+	token := &Token{}
+	if err := json.Unmarshal(buf, &token.Claims); err != nil {
+		return nil, errors.Wrap(err, "failed to parse token claims")
+	}
+
+	// our Claims return Mender-specific validation errors; the claims of
+	// expired tokens, with a good signature, are returned with the error
+	if err := token.Claims.Valid(); err != nil {
+		if err == ErrTokenExpired {
+			return token, err
 		}
+		return nil, err
 	}
 
-	token := Token{}
+	return token, nil
+}
 
-	if claims, ok := jwttoken.Claims.(*Claims); ok && jwttoken.Valid {
-		token.Claims = *claims
-		return &token, nil
-	} else {
-		return nil, ErrTokenInvalid
+// checkHeader verifies that the token is signed with the parser's method
+func (p *tokenParser) checkHeader(header string) error {
+	if _, ok := p.headers.Load(header); ok {
+		return nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode token header")
+	}
+
+	var hdr struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(data, &hdr); err != nil {
+		return errors.Wrap(err, "failed to parse token header")
+	}
+
+	if hdr.Alg != p.alg {
+		return errors.New("unexpected signing method: " + hdr.Alg)
+	}
+
+	// all tokens we issue share the header, don't let garbage grow the
+	// cache though
+	if atomic.AddInt32(&p.numHeaders, 1) <= maxCachedHeaders {
+		p.headers.Store(header, struct{}{})
+	}
+	return nil
+}
+
+// decodeSegment appends the decoded base64url segment to dst
+func decodeSegment(dst []byte, seg string) ([]byte, error) {
+	n := base64.RawURLEncoding.DecodedLen(len(seg))
+	if cap(dst)-len(dst) < n {
+		grown := make([]byte, len(dst), len(dst)+n)
+		copy(grown, dst)
+		dst = grown
+	}
+
+	out := dst[len(dst) : len(dst)+n]
+	// base64 decoding needs its input as []byte; decode in chunks
+	// through a stack buffer to avoid copying the segment
+	var chunk [512]byte
+	written := 0
+	for len(seg) > 0 {
+		c := len(seg)
+		if c > len(chunk) {
+			c = len(chunk)
+		}
+		k := copy(chunk[:], seg[:c])
+		w, err := base64.RawURLEncoding.Decode(out[written:], chunk[:k])
+		if err != nil {
+			return dst, errors.Wrap(err, "failed to decode token segment")
+		}
+		written += w
+		seg = seg[c:]
 	}
+	return dst[:len(dst)+written], nil
 }
@@ -0,0 +1,146 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"sync"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+var (
+	// SigningMethodEdDSA implements EdDSA (Ed25519) signing, which jwt-go
+	// lacks
+	SigningMethodEdDSA = &signingMethodEdDSA{}
+
+	ErrEdDSAKey = errors.New("jwt: EdDSA requires an Ed25519 key")
+
+	errEdDSAVerification = errors.New("crypto/ed25519: verification error")
+)
+
+func init() {
+	jwtgo.RegisterSigningMethod(SigningMethodEdDSA.Alg(),
+		func() jwtgo.SigningMethod {
+			return SigningMethodEdDSA
+		})
+}
+
+type signingMethodEdDSA struct{}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", ErrEdDSAKey
+	}
+	return jwtgo.EncodeSegment(ed25519.Sign(privKey, []byte(signingString))), nil
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	pubKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return ErrEdDSAKey
+	}
+
+	sig, err := jwtgo.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pubKey, []byte(signingString), sig) {
+		return errEdDSAVerification
+	}
+	return nil
+}
+
+// JWTHandlerEdDSA is an EdDSA (Ed25519) specific JWTHandler
+type JWTHandlerEdDSA struct {
+	privKey ed25519.PrivateKey
+	kid     string
+	mu      sync.RWMutex
+
+	parser tokenParser
+}
+
+func NewJWTHandlerEdDSA(privKey ed25519.PrivateKey) *JWTHandlerEdDSA {
+	j := &JWTHandlerEdDSA{
+		parser: tokenParser{
+			alg: SigningMethodEdDSA.Alg(),
+		},
+	}
+	j.SetPrivateKey(privKey)
+	return j
+}
+
+// SetPrivateKey replaces the signing key, e.g. after it was rotated in an
+// external secret store
+func (j *JWTHandlerEdDSA) SetPrivateKey(privKey ed25519.PrivateKey) {
+	var kid string
+	if len(privKey) == ed25519.PrivateKeySize {
+		kid = keyID(privKey.Public())
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.privKey = privKey
+	j.kid = kid
+}
+
+func (j *JWTHandlerEdDSA) key() (ed25519.PrivateKey, string) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.privKey, j.kid
+}
+
+func (j *JWTHandlerEdDSA) ToJWT(token *Token) (string, error) {
+	key, kid := j.key()
+
+	//generate
+	jt := jwtgo.NewWithClaims(SigningMethodEdDSA, &token.Claims)
+	jt.Header["kid"] = kid
+
+	//sign
+	data, err := jt.SignedString(key)
+	return data, err
+}
+
+func (j *JWTHandlerEdDSA) KeyID() string {
+	_, kid := j.key()
+	return kid
+}
+
+func (j *JWTHandlerEdDSA) JWKS() []JWK {
+	key, _ := j.key()
+	jwk, err := NewJWK(key.Public(), SigningMethodEdDSA.Alg())
+	if err != nil {
+		return nil
+	}
+	return []JWK{*jwk}
+}
+
+func (j *JWTHandlerEdDSA) FromJWT(tokstr string) (*Token, error) {
+	return j.parser.parse(tokstr, func(input, sig []byte) error {
+		key, _ := j.key()
+		pubKey := key.Public().(ed25519.PublicKey)
+		if !ed25519.Verify(pubKey, input, sig) {
+			return errEdDSAVerification
+		}
+		return nil
+	})
+}
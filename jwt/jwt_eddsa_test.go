@@ -0,0 +1,87 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/keys"
+)
+
+func TestJWTHandlerEdDSAToFromJWT(t *testing.T) {
+	key := loadEd25519PrivKey("./testdata/private_ed25519.pem", t)
+	jwtHandler := NewJWTHandlerEdDSA(key)
+
+	token := &Token{
+		Claims: Claims{
+			ID:        "someid",
+			Subject:   "foo",
+			Issuer:    "Mender",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			Tenant:    "foobar",
+			Device:    true,
+		},
+	}
+
+	raw, err := jwtHandler.ToJWT(token)
+	assert.NoError(t, err)
+
+	// verifiable by anyone with the public key
+	parsed, err := jwtgo.Parse(raw, func(token *jwtgo.Token) (interface{}, error) {
+		assert.Equal(t, "EdDSA", token.Header["alg"])
+		return key.Public(), nil
+	})
+	if assert.NoError(t, err) {
+		mc := parsed.Claims.(jwtgo.MapClaims)
+		assert.Equal(t, "foo", mc["sub"])
+		assert.Equal(t, "foobar", mc["mender.tenant"])
+	}
+
+	out, err := jwtHandler.FromJWT(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, token.Claims, out.Claims)
+
+	// tampered signature
+	_, err = jwtHandler.FromJWT(raw[:len(raw)-4] + "AAAA")
+	assert.EqualError(t, err, "crypto/ed25519: verification error")
+
+	// RS256 tokens are not accepted
+	rsRaw, err := NewJWTHandlerRS256(loadPrivKey("./testdata/private.pem", t)).
+		ToJWT(token)
+	assert.NoError(t, err)
+	_, err = jwtHandler.FromJWT(rsRaw)
+	assert.EqualError(t, err, "unexpected signing method: RS256")
+}
+
+func TestSigningMethodEdDSAWrongKey(t *testing.T) {
+	_, err := SigningMethodEdDSA.Sign("foo", loadPrivKey("./testdata/private.pem", t))
+	assert.EqualError(t, err, ErrEdDSAKey.Error())
+
+	err = SigningMethodEdDSA.Verify("foo", "bar", "baz")
+	assert.EqualError(t, err, ErrEdDSAKey.Error())
+}
+
+func loadEd25519PrivKey(path string, t *testing.T) ed25519.PrivateKey {
+	key, err := keys.LoadEd25519Private(path)
+	if err != nil {
+		t.Fatalf("failed to load key: %v", err)
+	}
+
+	return key
+}
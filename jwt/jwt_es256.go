@@ -0,0 +1,127 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"math/big"
+	"sync"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrES256Key = errors.New("jwt: ES256 requires a P-256 key")
+
+	errES256Verification = errors.New("crypto/ecdsa: verification error")
+)
+
+// JWTHandlerES256 is an ES256-specific JWTHandler
+type JWTHandlerES256 struct {
+	privKey *ecdsa.PrivateKey
+	kid     string
+	mu      sync.RWMutex
+
+	parser tokenParser
+}
+
+func NewJWTHandlerES256(privKey *ecdsa.PrivateKey) (*JWTHandlerES256, error) {
+	if err := checkES256Key(privKey); err != nil {
+		return nil, err
+	}
+
+	return &JWTHandlerES256{
+		privKey: privKey,
+		kid:     keyID(&privKey.PublicKey),
+		parser: tokenParser{
+			alg: jwtgo.SigningMethodES256.Alg(),
+		},
+	}, nil
+}
+
+// SetPrivateKey replaces the signing key, e.g. after it was rotated in an
+// external secret store
+func (j *JWTHandlerES256) SetPrivateKey(privKey *ecdsa.PrivateKey) error {
+	if err := checkES256Key(privKey); err != nil {
+		return err
+	}
+
+	kid := keyID(&privKey.PublicKey)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.privKey = privKey
+	j.kid = kid
+	return nil
+}
+
+func (j *JWTHandlerES256) key() (*ecdsa.PrivateKey, string) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.privKey, j.kid
+}
+
+func (j *JWTHandlerES256) ToJWT(token *Token) (string, error) {
+	key, kid := j.key()
+
+	//generate
+	jt := jwtgo.NewWithClaims(jwtgo.SigningMethodES256, &token.Claims)
+	jt.Header["kid"] = kid
+
+	//sign
+	data, err := jt.SignedString(key)
+	return data, err
+}
+
+func (j *JWTHandlerES256) KeyID() string {
+	_, kid := j.key()
+	return kid
+}
+
+func (j *JWTHandlerES256) JWKS() []JWK {
+	key, _ := j.key()
+	jwk, err := NewJWK(&key.PublicKey, jwtgo.SigningMethodES256.Alg())
+	if err != nil {
+		return nil
+	}
+	return []JWK{*jwk}
+}
+
+func (j *JWTHandlerES256) FromJWT(tokstr string) (*Token, error) {
+	return j.parser.parse(tokstr, func(input, sig []byte) error {
+		// JWS signatures are R and S, as fixed size big endian integers
+		if len(sig) != 64 {
+			return errES256Verification
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+
+		key, _ := j.key()
+		digest := sha256.Sum256(input)
+		if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+			return errES256Verification
+		}
+		return nil
+	})
+}
+
+func checkES256Key(privKey *ecdsa.PrivateKey) error {
+	if privKey == nil || privKey.Curve != elliptic.P256() {
+		return ErrES256Key
+	}
+	return nil
+}
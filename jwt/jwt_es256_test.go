@@ -0,0 +1,105 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/keys"
+)
+
+func TestNewJWTHandlerES256(t *testing.T) {
+	jwtHandler, err := NewJWTHandlerES256(loadECPrivKey("./testdata/private_ec.pem", t))
+	assert.NoError(t, err)
+	assert.NotNil(t, jwtHandler)
+
+	jwtHandler, err = NewJWTHandlerES256(loadECPrivKey("./testdata/private_ec_p384.pem", t))
+	assert.EqualError(t, err, ErrES256Key.Error())
+	assert.Nil(t, jwtHandler)
+}
+
+func TestJWTHandlerES256ToFromJWT(t *testing.T) {
+	key := loadECPrivKey("./testdata/private_ec.pem", t)
+	jwtHandler, err := NewJWTHandlerES256(key)
+	assert.NoError(t, err)
+
+	token := &Token{
+		Claims: Claims{
+			ID:        "someid",
+			Subject:   "foo",
+			Issuer:    "Mender",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			Tenant:    "foobar",
+			Device:    true,
+		},
+	}
+
+	raw, err := jwtHandler.ToJWT(token)
+	assert.NoError(t, err)
+
+	// verifiable by anyone with the public key
+	parsed, err := jwtgo.Parse(raw, func(token *jwtgo.Token) (interface{}, error) {
+		assert.Equal(t, "ES256", token.Header["alg"])
+		return &key.PublicKey, nil
+	})
+	if assert.NoError(t, err) {
+		mc := parsed.Claims.(jwtgo.MapClaims)
+		assert.Equal(t, "foo", mc["sub"])
+		assert.Equal(t, "foobar", mc["mender.tenant"])
+	}
+
+	out, err := jwtHandler.FromJWT(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, token.Claims, out.Claims)
+
+	// tampered signature
+	_, err = jwtHandler.FromJWT(raw[:len(raw)-4] + "AAAA")
+	assert.EqualError(t, err, "crypto/ecdsa: verification error")
+
+	// RS256 tokens are not accepted
+	rsRaw, err := NewJWTHandlerRS256(loadPrivKey("./testdata/private.pem", t)).
+		ToJWT(token)
+	assert.NoError(t, err)
+	_, err = jwtHandler.FromJWT(rsRaw)
+	assert.EqualError(t, err, "unexpected signing method: RS256")
+
+	// expired
+	token.Claims.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+	raw, err = jwtHandler.ToJWT(token)
+	assert.NoError(t, err)
+	_, err = jwtHandler.FromJWT(raw)
+	assert.EqualError(t, err, ErrTokenExpired.Error())
+}
+
+func TestJWTHandlerES256SetPrivateKey(t *testing.T) {
+	jwtHandler, err := NewJWTHandlerES256(loadECPrivKey("./testdata/private_ec.pem", t))
+	assert.NoError(t, err)
+
+	err = jwtHandler.SetPrivateKey(loadECPrivKey("./testdata/private_ec_p384.pem", t))
+	assert.EqualError(t, err, ErrES256Key.Error())
+}
+
+func loadECPrivKey(path string, t *testing.T) *ecdsa.PrivateKey {
+	key, err := keys.LoadECPrivate(path)
+	if err != nil {
+		t.Fatalf("failed to load key: %v", err)
+	}
+
+	return key
+}
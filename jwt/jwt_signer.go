@@ -0,0 +1,151 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSignerKey = errors.New("jwt: signer key doesn't match its algorithm")
+)
+
+// Signer signs device tokens with a key held outside of the service, e.g. in
+// Vault; only the public key is known to the service, tokens are verified
+// locally
+type Signer interface {
+	// Algorithm returns the JWS algorithm ('alg' header) of the signatures:
+	// RS256, ES256 or EdDSA
+	Algorithm() string
+	PublicKey() crypto.PublicKey
+	// Sign returns the JWS signature of the signing input
+	Sign(input []byte) ([]byte, error)
+}
+
+// JWTHandlerSigner is a JWTHandler delegating token signing to a Signer
+type JWTHandlerSigner struct {
+	signer Signer
+	method jwtgo.SigningMethod
+	kid    string
+	verify func(input, sig []byte) error
+
+	parser tokenParser
+}
+
+func NewJWTHandlerSigner(signer Signer) (*JWTHandlerSigner, error) {
+	alg := signer.Algorithm()
+	verify, err := newVerifier(alg, signer.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTHandlerSigner{
+		signer: signer,
+		method: jwtgo.GetSigningMethod(alg),
+		kid:    keyID(signer.PublicKey()),
+		verify: verify,
+		parser: tokenParser{
+			alg: alg,
+		},
+	}, nil
+}
+
+func (j *JWTHandlerSigner) KeyID() string {
+	return j.kid
+}
+
+func (j *JWTHandlerSigner) ToJWT(token *Token) (string, error) {
+	//generate
+	jt := jwtgo.NewWithClaims(j.method, &token.Claims)
+	jt.Header["kid"] = j.kid
+
+	input, err := jt.SigningString()
+	if err != nil {
+		return "", err
+	}
+
+	//sign
+	sig, err := j.signer.Sign([]byte(input))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign token")
+	}
+
+	return input + "." + jwtgo.EncodeSegment(sig), nil
+}
+
+func (j *JWTHandlerSigner) JWKS() []JWK {
+	jwk, err := NewJWK(j.signer.PublicKey(), j.signer.Algorithm())
+	if err != nil {
+		return nil
+	}
+	return []JWK{*jwk}
+}
+
+func (j *JWTHandlerSigner) FromJWT(tokstr string) (*Token, error) {
+	return j.parser.parse(tokstr, j.verify)
+}
+
+// newVerifier returns the signature verification function for the algorithm
+// and public key
+func newVerifier(alg string, pub crypto.PublicKey) (func(input, sig []byte) error, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if alg != jwtgo.SigningMethodRS256.Alg() {
+			break
+		}
+		return func(input, sig []byte) error {
+			digest := sha256.Sum256(input)
+			return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig)
+		}, nil
+	case *ecdsa.PublicKey:
+		if alg != jwtgo.SigningMethodES256.Alg() || key.Curve != elliptic.P256() {
+			break
+		}
+		return func(input, sig []byte) error {
+			// JWS signatures are R and S, as fixed size big endian
+			// integers
+			if len(sig) != 64 {
+				return errES256Verification
+			}
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+
+			digest := sha256.Sum256(input)
+			if !ecdsa.Verify(key, digest[:], r, s) {
+				return errES256Verification
+			}
+			return nil
+		}, nil
+	case ed25519.PublicKey:
+		if alg != SigningMethodEdDSA.Alg() {
+			break
+		}
+		return func(input, sig []byte) error {
+			if !ed25519.Verify(key, input, sig) {
+				return errEdDSAVerification
+			}
+			return nil
+		}, nil
+	}
+	return nil, ErrSignerKey
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// localSigner signs with a private key in memory, like a remote signer would
+type localSigner struct {
+	alg string
+	key crypto.Signer
+	err error
+}
+
+func (s *localSigner) Algorithm() string {
+	return s.alg
+}
+
+func (s *localSigner) PublicKey() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *localSigner) Sign(input []byte) ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	switch key := s.key.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(key, input), nil
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(input)
+		r, ss, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		ss.FillBytes(sig[32:])
+		return sig, nil
+	default:
+		digest := sha256.Sum256(input)
+		return s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+}
+
+func TestJWTHandlerSigner(t *testing.T) {
+	rsaKey := loadPrivKey("./testdata/private.pem", t)
+	ecKey := loadECPrivKey("./testdata/private_ec.pem", t)
+	ecP384Key := loadECPrivKey("./testdata/private_ec_p384.pem", t)
+	edKey := loadEd25519PrivKey("./testdata/private_ed25519.pem", t)
+
+	testCases := map[string]struct {
+		signer *localSigner
+		verify Handler
+
+		err     string
+		signErr string
+	}{
+		"ok, RS256": {
+			signer: &localSigner{alg: "RS256", key: rsaKey},
+			verify: NewJWTHandlerRS256(rsaKey),
+		},
+		"ok, ES256": {
+			signer: &localSigner{alg: "ES256", key: ecKey},
+		},
+		"ok, EdDSA": {
+			signer: &localSigner{alg: "EdDSA", key: edKey},
+			verify: NewJWTHandlerEdDSA(edKey),
+		},
+		"error, algorithm mismatch": {
+			signer: &localSigner{alg: "ES256", key: rsaKey},
+			err:    ErrSignerKey.Error(),
+		},
+		"error, ES256 curve": {
+			signer: &localSigner{alg: "ES256", key: ecP384Key},
+			err:    ErrSignerKey.Error(),
+		},
+		"error, signing": {
+			signer:  &localSigner{alg: "EdDSA", key: edKey, err: errors.New("vault down")},
+			signErr: "failed to sign token: vault down",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			h, err := NewJWTHandlerSigner(tc.signer)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+
+			token := &Token{
+				Claims: Claims{
+					ID:        "someid",
+					Subject:   "foo",
+					Issuer:    "Mender",
+					ExpiresAt: time.Now().Add(time.Hour).Unix(),
+				},
+			}
+
+			raw, err := h.ToJWT(token)
+			if tc.signErr != "" {
+				assert.EqualError(t, err, tc.signErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			out, err := h.FromJWT(raw)
+			assert.NoError(t, err)
+			assert.Equal(t, token.Claims, out.Claims)
+
+			// same tokens as with the key on disk
+			if tc.verify != nil {
+				_, err = tc.verify.FromJWT(raw)
+				assert.NoError(t, err)
+			}
+
+			if assert.Len(t, h.JWKS(), 1) {
+				assert.Equal(t, h.KeyID(), h.JWKS()[0].Kid)
+				assert.Equal(t, tc.signer.alg, h.JWKS()[0].Alg)
+			}
+
+			// tampered
+			_, err = h.FromJWT(raw[:len(raw)-4] + "AAAA")
+			assert.Error(t, err)
+		})
+	}
+}
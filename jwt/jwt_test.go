@@ -14,8 +14,10 @@
 package jwt
 
 import (
+	"crypto/rand"
 	"crypto/rsa"
 	"testing"
+	"time"
 
 	jwtgo "github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
@@ -155,6 +157,30 @@ func TestJWTHandlerRS256FromJWT(t *testing.T) {
 			outToken: Token{},
 			outErr:   errors.New("token contains an invalid number of segments"),
 		},
+		"error - too many segments": {
+			privKey: key,
+
+			inToken: "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.e30.e30.e30",
+
+			outErr: errors.New("token contains an invalid number of segments"),
+		},
+		"error - unexpected signing method": {
+			privKey: key,
+
+			inToken: "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9." +
+				"eyJzdWIiOiJmb28ifQ." +
+				"sXpY2Lj9vBvk3ZbYdrvE8dQ8Zg0GRkZbW0a8bJr4w_0",
+
+			outErr: errors.New("unexpected signing method: HS256"),
+		},
+		"error - malformed signature": {
+			privKey: key,
+
+			inToken: "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." +
+				"eyJzdWIiOiJmb28ifQ.!!!",
+
+			outErr: errors.New("failed to decode token segment: illegal base64 data at input byte 0"),
+		},
 	}
 
 	for name, tc := range testCases {
@@ -171,6 +197,62 @@ func TestJWTHandlerRS256FromJWT(t *testing.T) {
 	}
 }
 
+func TestJWTHandlerRS256FromJWTExpired(t *testing.T) {
+	jwtHandler := NewJWTHandlerRS256(loadPrivKey("./testdata/private.pem", t))
+
+	raw, err := jwtHandler.ToJWT(&Token{
+		Claims: Claims{
+			ID:        "foo",
+			Subject:   "bar",
+			Issuer:    "Mender",
+			ExpiresAt: time.Now().Add(-time.Hour).Unix(),
+		},
+	})
+	assert.NoError(t, err)
+
+	// parsed twice, the second time with a cached header
+	for i := 0; i < 2; i++ {
+		token, err := jwtHandler.FromJWT(raw)
+		assert.Equal(t, ErrTokenExpired, err)
+		if assert.NotNil(t, token) {
+			assert.Equal(t, "foo", token.Claims.ID)
+		}
+	}
+}
+
+func TestJWTHandlerRS256SetPrivateKey(t *testing.T) {
+	privKey := loadPrivKey("./testdata/private.pem", t)
+	newKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+
+	jwtHandler := NewJWTHandlerRS256(privKey)
+
+	token := &Token{
+		Claims: Claims{
+			ID:        "foo",
+			Subject:   "bar",
+			Issuer:    "Mender",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}
+
+	oldRaw, err := jwtHandler.ToJWT(token)
+	assert.NoError(t, err)
+
+	jwtHandler.SetPrivateKey(newKey)
+
+	// tokens signed with the previous key are no longer valid
+	_, err = jwtHandler.FromJWT(oldRaw)
+	assert.EqualError(t, err, "crypto/rsa: verification error")
+
+	newRaw, err := jwtHandler.ToJWT(token)
+	assert.NoError(t, err)
+
+	parsed, err := jwtHandler.FromJWT(newRaw)
+	assert.NoError(t, err)
+	assert.Equal(t, token.Claims, parsed.Claims)
+}
+
 func loadPrivKey(path string, t *testing.T) *rsa.PrivateKey {
 	key, err := keys.LoadRSAPrivate(path)
 	if err != nil {
@@ -194,3 +276,33 @@ func parseGeneratedTokenRS256(t *testing.T, token string, key *rsa.PrivateKey) *
 
 	return tokenParsed
 }
+
+func BenchmarkJWTHandlerRS256FromJWT(b *testing.B) {
+	key, err := keys.LoadRSAPrivate("./testdata/private.pem")
+	if err != nil {
+		b.Fatalf("failed to load key: %v", err)
+	}
+	jwtHandler := NewJWTHandlerRS256(key)
+
+	raw, err := jwtHandler.ToJWT(&Token{
+		Claims: Claims{
+			ID:        "c8ae4a0b-2a2b-4a1a-9e0b-43b8e0a4e6a1",
+			Subject:   "5c8a1f1e-4d0a-4e55-9a79-2d2a4b2b4a3e",
+			Issuer:    "Mender",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			Tenant:    "5abcb6de7a673a0001287c71",
+			Device:    true,
+		},
+	})
+	if err != nil {
+		b.Fatalf("failed to generate token: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := jwtHandler.FromJWT(raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
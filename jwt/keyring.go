@@ -0,0 +1,253 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/keys"
+)
+
+var (
+	ErrNoSigningKey = errors.New("jwt: no signing key")
+)
+
+// KeyHandler is a Handler signing with a single key, identified by its kid
+type KeyHandler interface {
+	Handler
+	KeySet
+	KeyID() string
+}
+
+// NewKeyHandler creates the handler for the signing algorithm (RS256, ES256
+// or EdDSA) and the PEM encoded private key
+func NewKeyHandler(alg string, privKeyPEM []byte) (KeyHandler, error) {
+	switch alg {
+	case "RS256":
+		key, err := keys.ParseRSAPrivate(privKeyPEM)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read rsa private key")
+		}
+		return NewJWTHandlerRS256(key), nil
+	case "ES256":
+		key, err := keys.ParseECPrivate(privKeyPEM)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read ec private key")
+		}
+		return NewJWTHandlerES256(key)
+	case "EdDSA":
+		key, err := keys.ParseEd25519Private(privKeyPEM)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read ed25519 private key")
+		}
+		return NewJWTHandlerEdDSA(key), nil
+	default:
+		return nil, errors.Errorf("unsupported JWT signing algorithm: %s", alg)
+	}
+}
+
+// KeyRing issues and verifies tokens with multiple keys, so that the signing
+// key can be rotated without invalidating the tokens already issued.
+//
+// The ring holds managed keys, added and retired at runtime, and the keys
+// from the service configuration. Tokens are signed with the newest managed
+// key, or the first configured one if there are none, and verified with the
+// key named by their 'kid' header.
+type KeyRing struct {
+	mu         sync.RWMutex
+	managed    []KeyHandler
+	configured []KeyHandler
+	// configured keys replaced at runtime, verifying the tokens they
+	// signed until these expire
+	replaced []replacedKey
+
+	// token headers to key IDs
+	kids    sync.Map
+	numKids int32
+}
+
+type replacedKey struct {
+	KeyHandler
+	until time.Time
+}
+
+func NewKeyRing(configured ...KeyHandler) *KeyRing {
+	return &KeyRing{
+		configured: configured,
+	}
+}
+
+// SetKeys replaces the managed keys, newest first
+func (r *KeyRing) SetKeys(managed ...KeyHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.managed = managed
+}
+
+// SetConfigured replaces the keys from the service configuration; tokens
+// signed with keys no longer in the ring are invalid, see ReplaceConfigured
+func (r *KeyRing) SetConfigured(configured ...KeyHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.configured = configured
+}
+
+// ReplaceConfigured replaces the configured signing key, e.g. after it was
+// changed in an external secret store. The replaced key no longer signs, but
+// still verifies tokens until the given time, when the tokens it signed have
+// expired.
+func (r *KeyRing) ReplaceConfigured(k KeyHandler, keepUntil time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	replaced := make([]replacedKey, 0, len(r.replaced)+1)
+	for _, rk := range r.replaced {
+		if now.Before(rk.until) {
+			replaced = append(replaced, rk)
+		}
+	}
+
+	configured := []KeyHandler{k}
+	if len(r.configured) > 0 {
+		replaced = append(replaced, replacedKey{
+			KeyHandler: r.configured[0],
+			until:      keepUntil,
+		})
+		configured = append(configured, r.configured[1:]...)
+	}
+
+	r.configured = configured
+	r.replaced = replaced
+}
+
+// keys lists all keys, the signing one first, the replaced ones last
+func (r *KeyRing) keys() []KeyHandler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := make([]KeyHandler, 0,
+		len(r.managed)+len(r.configured)+len(r.replaced))
+	all = append(all, r.managed...)
+	all = append(all, r.configured...)
+
+	now := time.Now()
+	for _, rk := range r.replaced {
+		if now.Before(rk.until) {
+			all = append(all, rk.KeyHandler)
+		}
+	}
+	return all
+}
+
+func (r *KeyRing) ToJWT(token *Token) (string, error) {
+	r.mu.RLock()
+	var signer KeyHandler
+	if len(r.managed) > 0 {
+		signer = r.managed[0]
+	} else if len(r.configured) > 0 {
+		signer = r.configured[0]
+	}
+	r.mu.RUnlock()
+
+	if signer == nil {
+		return "", ErrNoSigningKey
+	}
+	return signer.ToJWT(token)
+}
+
+// FromJWT verifies the token with the key named by its kid. Tokens issued
+// before key IDs were introduced are tried with every key; the result of the
+// first one verifying the token is returned, otherwise the signing key's
+// error.
+func (r *KeyRing) FromJWT(tokstr string) (*Token, error) {
+	keys := r.keys()
+	if len(keys) == 0 {
+		return nil, ErrTokenInvalid
+	}
+
+	kid, err := r.keyID(tokstr)
+	if err != nil {
+		return nil, err
+	}
+
+	if kid != "" {
+		for _, k := range keys {
+			if k.KeyID() == kid {
+				return k.FromJWT(tokstr)
+			}
+		}
+		return nil, ErrTokenInvalid
+	}
+
+	var firstErr error
+	for _, k := range keys {
+		token, err := k.FromJWT(tokstr)
+		if err == nil || err == ErrTokenExpired {
+			return token, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// JWKS lists the public keys of all keys in the ring
+func (r *KeyRing) JWKS() []JWK {
+	var jwks []JWK
+	for _, k := range r.keys() {
+		jwks = append(jwks, k.JWKS()...)
+	}
+	return jwks
+}
+
+// keyID returns the kid from the token header, or an empty string if there
+// is none
+func (r *KeyRing) keyID(tokstr string) (string, error) {
+	dot := strings.IndexByte(tokstr, '.')
+	if dot < 0 {
+		return "", ErrTokenSegments
+	}
+	header := tokstr[:dot]
+
+	if kid, ok := r.kids.Load(header); ok {
+		return kid.(string), nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode token header")
+	}
+
+	var hdr struct {
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(data, &hdr); err != nil {
+		return "", errors.Wrap(err, "failed to parse token header")
+	}
+
+	// there is one header per key, don't let garbage grow the cache
+	// though
+	if atomic.AddInt32(&r.numKids, 1) <= maxCachedHeaders {
+		r.kids.Store(header, hdr.Kid)
+	}
+	return hdr.Kid, nil
+}
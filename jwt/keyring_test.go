@@ -0,0 +1,216 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKeyHandler(t *testing.T) {
+	testCases := map[string]struct {
+		alg  string
+		path string
+
+		err string
+	}{
+		"ok, RS256": {
+			alg:  "RS256",
+			path: "./testdata/private.pem",
+		},
+		"ok, ES256": {
+			alg:  "ES256",
+			path: "./testdata/private_ec.pem",
+		},
+		"ok, EdDSA": {
+			alg:  "EdDSA",
+			path: "./testdata/private_ed25519.pem",
+		},
+		"error, key mismatch": {
+			alg:  "ES256",
+			path: "./testdata/private.pem",
+			err:  "failed to read ec private key",
+		},
+		"error, ES256 curve": {
+			alg:  "ES256",
+			path: "./testdata/private_ec_p384.pem",
+			err:  ErrES256Key.Error(),
+		},
+		"error, unsupported algorithm": {
+			alg:  "HS256",
+			path: "./testdata/private.pem",
+			err:  "unsupported JWT signing algorithm: HS256",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			pem, err := ioutil.ReadFile(tc.path)
+			assert.NoError(t, err)
+
+			h, err := NewKeyHandler(tc.alg, pem)
+			if tc.err != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, h.KeyID())
+			}
+		})
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	rsHandler := NewJWTHandlerRS256(loadPrivKey("./testdata/private.pem", t))
+	edHandler := NewJWTHandlerEdDSA(loadEd25519PrivKey("./testdata/private_ed25519.pem", t))
+	esHandler, err := NewJWTHandlerES256(loadECPrivKey("./testdata/private_ec.pem", t))
+	assert.NoError(t, err)
+
+	token := &Token{
+		Claims: Claims{
+			ID:        "someid",
+			Subject:   "foo",
+			Issuer:    "Mender",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}
+	expired := &Token{
+		Claims: Claims{
+			ID:        "someid",
+			Subject:   "foo",
+			Issuer:    "Mender",
+			ExpiresAt: time.Now().Add(-time.Hour).Unix(),
+		},
+	}
+
+	ring := NewKeyRing()
+	_, err = ring.ToJWT(token)
+	assert.EqualError(t, err, ErrNoSigningKey.Error())
+
+	// configured keys only, the first one signs
+	ring.SetConfigured(rsHandler)
+
+	rsRaw, err := ring.ToJWT(token)
+	assert.NoError(t, err)
+	out, err := rsHandler.FromJWT(rsRaw)
+	assert.NoError(t, err)
+	assert.Equal(t, token.Claims, out.Claims)
+
+	// a new managed key signs, tokens signed with the previous key are
+	// still valid
+	ring.SetKeys(edHandler)
+
+	edRaw, err := ring.ToJWT(token)
+	assert.NoError(t, err)
+	_, err = edHandler.FromJWT(edRaw)
+	assert.NoError(t, err)
+
+	for _, raw := range []string{edRaw, rsRaw} {
+		out, err = ring.FromJWT(raw)
+		assert.NoError(t, err)
+		assert.Equal(t, token.Claims, out.Claims)
+	}
+
+	edRaw, err = edHandler.ToJWT(expired)
+	assert.NoError(t, err)
+	_, err = ring.FromJWT(edRaw)
+	assert.EqualError(t, err, ErrTokenExpired.Error())
+
+	assert.Len(t, ring.JWKS(), 2)
+	assert.Equal(t, edHandler.KeyID(), ring.JWKS()[0].Kid)
+
+	// unknown keys are rejected
+	esRaw, err := esHandler.ToJWT(token)
+	assert.NoError(t, err)
+	_, err = ring.FromJWT(esRaw)
+	assert.EqualError(t, err, ErrTokenInvalid.Error())
+
+	// retired keys too
+	ring.SetKeys(esHandler)
+	_, err = ring.FromJWT(edRaw)
+	assert.EqualError(t, err, ErrTokenInvalid.Error())
+	out, err = ring.FromJWT(esRaw)
+	assert.NoError(t, err)
+	assert.Equal(t, token.Claims, out.Claims)
+
+	// tokens without a key ID are tried with every key
+	jt := jwtgo.NewWithClaims(jwtgo.SigningMethodRS256, &token.Claims)
+	noKid, err := jt.SignedString(loadPrivKey("./testdata/private.pem", t))
+	assert.NoError(t, err)
+	out, err = ring.FromJWT(noKid)
+	assert.NoError(t, err)
+	assert.Equal(t, token.Claims, out.Claims)
+
+	ring.SetConfigured()
+	_, err = ring.FromJWT(noKid)
+	assert.EqualError(t, err, "unexpected signing method: RS256")
+
+	_, err = ring.FromJWT("foo")
+	assert.EqualError(t, err, ErrTokenSegments.Error())
+}
+
+func TestKeyRingReplaceConfigured(t *testing.T) {
+	rsHandler := NewJWTHandlerRS256(loadPrivKey("./testdata/private.pem", t))
+	edHandler := NewJWTHandlerEdDSA(loadEd25519PrivKey("./testdata/private_ed25519.pem", t))
+	esHandler, err := NewJWTHandlerES256(loadECPrivKey("./testdata/private_ec.pem", t))
+	assert.NoError(t, err)
+
+	token := &Token{
+		Claims: Claims{
+			ID:        "someid",
+			Subject:   "foo",
+			Issuer:    "Mender",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}
+
+	ring := NewKeyRing(rsHandler)
+
+	rsRaw, err := ring.ToJWT(token)
+	assert.NoError(t, err)
+
+	// tokens signed before the key was replaced still verify
+	ring.ReplaceConfigured(edHandler, time.Now().Add(time.Hour))
+
+	edRaw, err := ring.ToJWT(token)
+	assert.NoError(t, err)
+	_, err = edHandler.FromJWT(edRaw)
+	assert.NoError(t, err)
+
+	for _, raw := range []string{rsRaw, edRaw} {
+		out, err := ring.FromJWT(raw)
+		assert.NoError(t, err)
+		assert.Equal(t, token.Claims, out.Claims)
+	}
+	assert.Len(t, ring.JWKS(), 2)
+
+	// until the replaced key's tokens have expired
+	ring.ReplaceConfigured(esHandler, time.Now().Add(-time.Second))
+
+	_, err = ring.FromJWT(edRaw)
+	assert.EqualError(t, err, ErrTokenInvalid.Error())
+	out, err := ring.FromJWT(rsRaw)
+	assert.NoError(t, err)
+	assert.Equal(t, token.Claims, out.Claims)
+
+	esRaw, err := ring.ToJWT(token)
+	assert.NoError(t, err)
+	_, err = esHandler.FromJWT(esRaw)
+	assert.NoError(t, err)
+	assert.Len(t, ring.JWKS(), 2)
+}
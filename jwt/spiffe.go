@@ -0,0 +1,61 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"net/url"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+const spiffeScheme = "spiffe"
+
+var (
+	// SPIFFE trust domain names are restricted to lowercase letters,
+	// digits, dots, dashes and underscores
+	spiffeTrustDomainRe = regexp.MustCompile(`^[a-z0-9._-]+$`)
+
+	ErrSpiffeTrustDomainInvalid = errors.New("invalid SPIFFE trust domain")
+)
+
+// ValidateSpiffeTrustDomain checks that the trust domain can be used
+// as the authority of a SPIFFE ID
+func ValidateSpiffeTrustDomain(trustDomain string) error {
+	if !spiffeTrustDomainRe.MatchString(trustDomain) {
+		return errors.Wrap(ErrSpiffeTrustDomainInvalid, trustDomain)
+	}
+	return nil
+}
+
+// SpiffeID builds the SPIFFE ID of a device:
+//
+//	spiffe://<trust domain>/device/<device id>
+//
+// or, for multi tenant setups:
+//
+//	spiffe://<trust domain>/tenant/<tenant id>/device/<device id>
+func SpiffeID(trustDomain, tenant, deviceId string) string {
+	path := "/device/" + url.PathEscape(deviceId)
+	if tenant != "" {
+		path = "/tenant/" + url.PathEscape(tenant) + path
+	}
+
+	u := url.URL{
+		Scheme: spiffeScheme,
+		Host:   trustDomain,
+		Path:   path,
+	}
+	return u.String()
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSpiffeTrustDomain(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]bool{
+		"mender.io":          true,
+		"prod_cluster-1.org": true,
+		"":                   false,
+		"Mender.io":          false,
+		"mender.io/devices":  false,
+		"mender.io:8443":     false,
+	}
+
+	for td, valid := range testCases {
+		err := ValidateSpiffeTrustDomain(td)
+		if valid {
+			assert.NoError(t, err, td)
+		} else {
+			assert.Error(t, err, td)
+		}
+	}
+}
+
+func TestSpiffeID(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "spiffe://mender.io/device/5c8a1f",
+		SpiffeID("mender.io", "", "5c8a1f"))
+	assert.Equal(t, "spiffe://mender.io/tenant/acme/device/5c8a1f",
+		SpiffeID("mender.io", "acme", "5c8a1f"))
+}
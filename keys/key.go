@@ -14,6 +14,8 @@
 package keys
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -33,6 +35,12 @@ func LoadRSAPrivate(privKeyPath string) (*rsa.PrivateKey, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, ErrMsgPrivKeyReadFailed)
 	}
+	return ParseRSAPrivate(pemData)
+}
+
+// ParseRSAPrivate parses a PEM encoded RSA private key, e.g. fetched from an
+// external secret store
+func ParseRSAPrivate(pemData []byte) (*rsa.PrivateKey, error) {
 	// decode pem key
 	block, _ := pem.Decode(pemData)
 	if block == nil {
@@ -46,3 +54,70 @@ func LoadRSAPrivate(privKeyPath string) (*rsa.PrivateKey, error) {
 	// return parsed key
 	return x509.ParsePKCS1PrivateKey(block.Bytes)
 }
+
+func LoadECPrivate(privKeyPath string) (*ecdsa.PrivateKey, error) {
+	pemData, err := ioutil.ReadFile(privKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrMsgPrivKeyReadFailed)
+	}
+	return ParseECPrivate(pemData)
+}
+
+// ParseECPrivate parses a PEM encoded EC private key, either in SEC 1
+// ('EC PRIVATE KEY') or PKCS #8 ('PRIVATE KEY') form
+func ParseECPrivate(pemData []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New(ErrMsgPrivKeyNotPEMEncoded)
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("server private key is not an EC key")
+		}
+		return ecKey, nil
+	default:
+		return nil, errors.Errorf(
+			"unknown server private key type; got: %s, want: EC PRIVATE KEY",
+			block.Type)
+	}
+}
+
+func LoadEd25519Private(privKeyPath string) (ed25519.PrivateKey, error) {
+	pemData, err := ioutil.ReadFile(privKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrMsgPrivKeyReadFailed)
+	}
+	return ParseEd25519Private(pemData)
+}
+
+// ParseEd25519Private parses a PEM encoded, PKCS #8 Ed25519 private key
+func ParseEd25519Private(pemData []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New(ErrMsgPrivKeyNotPEMEncoded)
+	}
+
+	if got, want := block.Type, "PRIVATE KEY"; got != want {
+		return nil, errors.Errorf(
+			"unknown server private key type; got: %s, want: %s", got, want)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("server private key is not an Ed25519 key")
+	}
+	return edKey, nil
+}
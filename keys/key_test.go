@@ -67,3 +67,86 @@ func TestLoadRsaPrivateKey(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadECPrivateKey(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		privKeyPath string
+		err         string
+	}{
+		"ok, sec1": {
+			privKeyPath: "testdata/private_ec.pem",
+		},
+		"ok, pkcs8": {
+			privKeyPath: "testdata/private_ec_pkcs8.pem",
+		},
+		"error, no file": {
+			privKeyPath: "wrong_path",
+			err:         ErrMsgPrivKeyReadFailed + ": open wrong_path: no such file or directory",
+		},
+		"error, not pem": {
+			privKeyPath: "testdata/private_broken.pem",
+			err:         ErrMsgPrivKeyNotPEMEncoded,
+		},
+		"error, rsa key": {
+			privKeyPath: "testdata/private.pem",
+			err:         "unknown server private key type; got: RSA PRIVATE KEY, want: EC PRIVATE KEY",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			key, err := LoadECPrivate(tc.privKeyPath)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, key)
+			}
+		})
+	}
+}
+
+func TestLoadEd25519PrivateKey(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		privKeyPath string
+		err         string
+	}{
+		"ok": {
+			privKeyPath: "testdata/private_ed25519.pem",
+		},
+		"error, not pem": {
+			privKeyPath: "testdata/private_broken.pem",
+			err:         ErrMsgPrivKeyNotPEMEncoded,
+		},
+		"error, rsa key": {
+			privKeyPath: "testdata/private.pem",
+			err:         "unknown server private key type; got: RSA PRIVATE KEY, want: PRIVATE KEY",
+		},
+		"error, ec key": {
+			privKeyPath: "testdata/private_ec_pkcs8.pem",
+			err:         "server private key is not an Ed25519 key",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			key, err := LoadEd25519Private(tc.privKeyPath)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, key)
+			}
+		})
+	}
+}
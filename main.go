@@ -17,13 +17,16 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/mendersoftware/go-lib-micro/config"
 	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 
 	"github.com/mendersoftware/deviceauth/cmd"
 	dconfig "github.com/mendersoftware/deviceauth/config"
+	"github.com/mendersoftware/deviceauth/secrets"
 	"github.com/mendersoftware/deviceauth/store/mongo"
 )
 
@@ -105,6 +108,83 @@ func doMain(args []string) {
 
 			Action: cmdMaintenance,
 		},
+		{
+			Name:  "server-keys",
+			Usage: "Manage device token signing keys and exit; lists the keys in use by default",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "add",
+					Usage: "Add the private key at `REF`, a secret reference (e.g. vault://secret/data/deviceauth#key) or a file path available to the service, signing new tokens from the next reload on. Only the reference is stored.",
+				},
+				cli.StringFlag{
+					Name:  "algorithm",
+					Usage: "Signing algorithm of the added key: RS256, ES256 or EdDSA.",
+					Value: "RS256",
+				},
+				cli.StringFlag{
+					Name:  "retire",
+					Usage: "Retire the key with given `KID`, tokens signed with it are no longer valid.",
+				},
+			},
+
+			Action: cmdServerKeys,
+		},
+		{
+			Name:  "purge-tokens",
+			Usage: "Delete expired device tokens from the database and exit",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tenant",
+					Usage: "Tenant ID (optional), all tenants by default.",
+				},
+				cli.IntFlag{
+					Name:  "batch-size",
+					Usage: "Number of tokens deleted at once, token_purge_batch_size by default.",
+				},
+			},
+
+			Action: cmdPurgeTokens,
+		},
+		{
+			Name:  "purge-rejected-devices",
+			Usage: "Decommission rejected devices which haven't attempted to authenticate for a while and exit",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tenant",
+					Usage: "Tenant ID (optional), all tenants by default.",
+				},
+				cli.IntFlag{
+					Name:  "days",
+					Usage: "Purge devices inactive for `DAYS` days, rejected_device_retention by default.",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Only count the devices to purge.",
+				},
+			},
+
+			Action: cmdPurgeRejectedDevices,
+		},
+		{
+			Name:  "import-devices",
+			Usage: "Preauthorize the devices listed in a CSV or NDJSON file and exit",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file",
+					Usage: "Import `FILE`; CSV files need a header naming the identity_data and pubkey columns.",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "File format, csv or ndjson; told by the file extension by default.",
+				},
+				cli.StringFlag{
+					Name:  "tenant",
+					Usage: "Tenant ID (optional).",
+				},
+			},
+
+			Action: cmdImportDevices,
+		},
 	}
 
 	app.Action = cmdServer
@@ -122,12 +202,42 @@ func doMain(args []string) {
 		config.Config.SetEnvPrefix("DEVICEAUTH")
 		config.Config.AutomaticEnv()
 
+		if err := resolveDbSecrets(config.Config); err != nil {
+			return cli.NewExitError(
+				fmt.Sprintf("error loading configuration: %s", err),
+				1)
+		}
+
 		return nil
 	}
 
 	app.Run(args)
 }
 
+// resolveDbSecrets replaces secret references in database credentials with
+// actual values; these are resolved only once, on startup
+func resolveDbSecrets(c config.Handler) error {
+	r := secrets.NewResolver()
+
+	for _, key := range []string{
+		dconfig.SettingDbUsername,
+		dconfig.SettingDbPassword,
+	} {
+		if !r.IsRef(c.GetString(key)) {
+			continue
+		}
+
+		val, err := r.ResolveString(context.Background(), c.GetString(key))
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve %s", key)
+		}
+
+		c.Set(key, val)
+	}
+
+	return nil
+}
+
 func cmdServer(args *cli.Context) error {
 	devSetup := args.GlobalBool("dev")
 
@@ -154,6 +264,9 @@ func cmdServer(args *cli.Context) error {
 			2)
 	}
 
+	db = db.WithRevokedTokenRetention(time.Duration(
+		config.Config.GetInt(dconfig.SettingRevokedTokensRetention)) * time.Second)
+
 	if args.Bool("automigrate") {
 		db = db.WithAutomigrate().(*mongo.DataStoreMongo)
 	}
@@ -196,3 +309,50 @@ func cmdMaintenance(args *cli.Context) error {
 	}
 	return nil
 }
+
+func cmdServerKeys(args *cli.Context) error {
+	err := cmd.ServerKeys(args.String("add"), args.String("algorithm"), args.String("retire"))
+	if err != nil {
+		return cli.NewExitError(err, 7)
+	}
+	return nil
+}
+
+func cmdPurgeTokens(args *cli.Context) error {
+	batchSize := args.Int("batch-size")
+	if batchSize <= 0 {
+		batchSize = config.Config.GetInt(dconfig.SettingTokenPurgeBatchSize)
+	}
+
+	err := cmd.PurgeTokens(args.String("tenant"), batchSize)
+	if err != nil {
+		return cli.NewExitError(err, 8)
+	}
+	return nil
+}
+
+func cmdPurgeRejectedDevices(args *cli.Context) error {
+	olderThan := time.Duration(args.Int("days")) * 24 * time.Hour
+	if olderThan <= 0 {
+		olderThan = time.Duration(
+			config.Config.GetInt(dconfig.SettingRejectedDeviceRetention)) * time.Second
+	}
+
+	err := cmd.PurgeRejectedDevices(args.String("tenant"), olderThan, args.Bool("dry-run"))
+	if err != nil {
+		return cli.NewExitError(err, 10)
+	}
+	return nil
+}
+
+func cmdImportDevices(args *cli.Context) error {
+	if args.String("file") == "" {
+		return cli.NewExitError("missing import file", 9)
+	}
+
+	err := cmd.ImportDevices(args.String("file"), args.String("format"), args.String("tenant"))
+	if err != nil {
+		return cli.NewExitError(err, 9)
+	}
+	return nil
+}
@@ -16,7 +16,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/mendersoftware/go-lib-micro/accesslog"
@@ -27,6 +29,9 @@ import (
 	dlog "github.com/mendersoftware/go-lib-micro/log"
 	"github.com/mendersoftware/go-lib-micro/requestid"
 	"github.com/mendersoftware/go-lib-micro/requestlog"
+
+	api_http "github.com/mendersoftware/deviceauth/api/http"
+	"github.com/mendersoftware/deviceauth/devauth"
 )
 
 const (
@@ -59,8 +64,14 @@ var (
 		// catches the panic errors
 		&rest.RecoverMiddleware{},
 
-		// response compression
-		&rest.GzipMiddleware{},
+		// response compression, except for event streams, whose events
+		// would be held back in the compressor
+		&rest.IfMiddleware{
+			Condition: func(r *rest.Request) bool {
+				return !api_http.EventStreamRequest(r)
+			},
+			IfTrue: &rest.GzipMiddleware{},
+		},
 	}
 
 	commonStack = []rest.Middleware{
@@ -85,6 +96,7 @@ var (
 				http.MethodGet,
 				http.MethodPost,
 				http.MethodPut,
+				http.MethodPatch,
 				http.MethodDelete,
 				http.MethodOptions,
 			},
@@ -99,19 +111,30 @@ var (
 				"Accept-Encoding",
 				"Access-Control-Request-Headers",
 				"Header-Access-Control-Request",
+				"Idempotency-Key",
 			},
 
 			// Headers that can be exposed to JS
 			AccessControlExposeHeaders: []string{
 				"Location",
 				"Link",
+				"Idempotent-Replayed",
 			},
 		},
 
 		// verifies the request Content-Type header
 		// The expected Content-Type is 'application/json'
-		// if the content is non-null
-		&rest.ContentTypeCheckerMiddleware{},
+		// if the content is non-null, except for the OAuth 2.0
+		// endpoints taking form encoded bodies, device imports and
+		// JSON merge patches
+		&rest.IfMiddleware{
+			Condition: func(r *rest.Request) bool {
+				return !api_http.FormRequest(r) &&
+					!api_http.ImportRequest(r) &&
+					!api_http.MergePatchRequest(r)
+			},
+			IfTrue: &rest.ContentTypeCheckerMiddleware{},
+		},
 		&requestid.RequestIdMiddleware{},
 		&mctx.UpdateContextMiddleware{
 			Updates: []mctx.UpdateContextFunc{
@@ -129,7 +152,7 @@ var (
 	}
 )
 
-func SetupMiddleware(api *rest.Api, mwtype string) error {
+func SetupMiddleware(api *rest.Api, mwtype string, trustedProxies int) error {
 
 	l := dlog.New(dlog.Ctx{})
 
@@ -151,9 +174,43 @@ func SetupMiddleware(api *rest.Api, mwtype string) error {
 
 	api.Use(commonStack...)
 
+	api.Use(&mctx.UpdateContextMiddleware{
+		Updates: []mctx.UpdateContextFunc{
+			preserveSourceIP(trustedProxies),
+		},
+	})
+
 	return nil
 }
 
 func preserveHeaders(ctx context.Context, r *rest.Request) context.Context {
-	return ctxhttpheader.WithContext(ctx, r.Header, "Authorization")
+	return ctxhttpheader.WithContext(ctx, r.Header,
+		"Authorization", "User-Agent", devauth.HdrOriginalURI)
+}
+
+// preserveSourceIP keeps the client address, for the token audit trail
+func preserveSourceIP(trustedProxies int) mctx.UpdateContextFunc {
+	return func(ctx context.Context, r *rest.Request) context.Context {
+		return devauth.WithSourceIP(ctx, sourceIP(r.Request, trustedProxies))
+	}
+}
+
+// sourceIP is the address of the client; behind trusted proxies, the
+// X-Forwarded-For address appended by the outermost of them. Addresses
+// left of it are set by the client, and can't be trusted.
+func sourceIP(r *http.Request, trustedProxies int) string {
+	if trustedProxies > 0 {
+		var hops []string
+		for _, fwd := range r.Header["X-Forwarded-For"] {
+			hops = append(hops, strings.Split(fwd, ",")...)
+		}
+		if len(hops) >= trustedProxies {
+			return strings.TrimSpace(hops[len(hops)-trustedProxies])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -15,6 +15,7 @@ package main
 
 import (
 	"fmt"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/ant0ine/go-json-rest/rest"
@@ -35,7 +36,7 @@ func TestSetupMiddleware(t *testing.T) {
 		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
 			api := rest.NewApi()
 
-			err := SetupMiddleware(api, td.mwtype)
+			err := SetupMiddleware(api, td.mwtype, 1)
 			if err != nil && td.experr == false {
 				t.Errorf("dod not expect error: %s", err)
 			} else if err == nil && td.experr == true {
@@ -44,3 +45,43 @@ func TestSetupMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestSourceIP(t *testing.T) {
+
+	var tdata = []struct {
+		headers        map[string]string
+		trustedProxies int
+		remoteAddr     string
+		ip             string
+	}{
+		{nil, 0, "10.0.0.1:4321", "10.0.0.1"},
+		{nil, 0, "10.0.0.1", "10.0.0.1"},
+		{map[string]string{"X-Real-IP": "192.168.1.1"}, 1, "10.0.0.1:4321", "10.0.0.1"},
+		{map[string]string{
+			"X-Forwarded-For": "192.168.1.2, 10.0.0.2",
+		}, 0, "10.0.0.1:4321", "10.0.0.1"},
+		{map[string]string{
+			"X-Forwarded-For": "192.168.1.2, 10.0.0.2",
+		}, 1, "10.0.0.1:4321", "10.0.0.2"},
+		{map[string]string{
+			"X-Forwarded-For": "192.168.1.2, 10.0.0.2",
+		}, 2, "10.0.0.1:4321", "192.168.1.2"},
+		{map[string]string{
+			"X-Forwarded-For": "10.0.0.2",
+		}, 2, "10.0.0.1:4321", "10.0.0.1"},
+	}
+
+	for i, td := range tdata {
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://1.2.3.4/", nil)
+			r.RemoteAddr = td.remoteAddr
+			for k, v := range td.headers {
+				r.Header.Set(k, v)
+			}
+
+			if ip := sourceIP(r, td.trustedProxies); ip != td.ip {
+				t.Errorf("expected %s, got %s", td.ip, ip)
+			}
+		})
+	}
+}
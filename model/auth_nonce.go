@@ -0,0 +1,43 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// AuthNonce is a nonce handed out to a device in an auth challenge, to be
+// included in its next auth request; each nonce can be used only once, so
+// captured auth requests can't be replayed
+type AuthNonce struct {
+	Id        string    `bson:"_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	// TPM credential handed out with the nonce, if any
+	TPMActivation *TPMActivation `bson:"tpm_activation,omitempty"`
+}
+
+// AuthChallenge is the response to an auth challenge request
+type AuthChallenge struct {
+	Nonce string `json:"nonce"`
+	// lifetime of the nonce in seconds
+	ExpiresIn int64 `json:"expires_in"`
+	// credential for the TPM to activate, if requested
+	TPMCredential *TPMCredential `json:"tpm_credential,omitempty"`
+}
+
+// AuthChallengeReq is the optional body of the auth challenge request
+type AuthChallengeReq struct {
+	// the TPM the device wants to attest its key with
+	TPM *TPMCredentialReq `json:"tpm,omitempty"`
+}
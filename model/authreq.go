@@ -14,8 +14,9 @@
 package model
 
 import (
-	"crypto/rsa"
+	"crypto/x509"
 	"errors"
+	"time"
 
 	"github.com/mendersoftware/deviceauth/utils"
 )
@@ -26,9 +27,35 @@ type AuthReq struct {
 	IdData      string `json:"id_data" bson:"id_data"`
 	TenantToken string `json:"tenant_token" bson:"tenant_token"`
 	PubKey      string `json:"pubkey"`
+	// PEM encoded X.509 certificate chain, device certificate first; the
+	// device certificate's key is the auth set key
+	Certificate string `json:"certificate,omitempty" bson:"-"`
+	// nonce from an auth challenge, see AuthChallenge
+	Nonce string `json:"nonce,omitempty" bson:"-"`
+	// TPM attestation of the device key
+	TPMAttestation *TPMAttestation `json:"tpm_attestation,omitempty" bson:"-"`
+	// single use token getting the auth set accepted, see BootstrapToken
+	BootstrapToken string `json:"bootstrap_token,omitempty" bson:"-"`
 
 	//helpers, not serialized
-	PubKeyStruct *rsa.PublicKey `json:"-" bson:"-"`
+	//RSA, ECDSA or Ed25519 public key, see utils.KeyType
+	PubKeyStruct interface{} `json:"-" bson:"-"`
+	//parsed Certificate, verified by devauth
+	CertChain []*x509.Certificate `json:"-" bson:"-"`
+	//TLS client certificate the request came with, verified by the
+	//listener
+	ClientCert *x509.Certificate `json:"-" bson:"-"`
+	//request timestamp, if the device signed one along with the request
+	Timestamp *time.Time `json:"-" bson:"-"`
+}
+
+// AuthReqCheck is the outcome of an external auth request check (see
+// devauth.AuthReqHook); a check can either veto the request, or annotate the
+// resulting auth set with additional data
+type AuthReqCheck struct {
+	Reject      bool                   `json:"reject"`
+	Reason      string                 `json:"reason,omitempty"`
+	Annotations map[string]interface{} `json:"annotations,omitempty"`
 }
 
 func (r *AuthReq) Validate() error {
@@ -36,8 +63,29 @@ func (r *AuthReq) Validate() error {
 		return errors.New("id_data must be provided")
 	}
 
+	var certKey string
+	if r.Certificate != "" {
+		chain, err := utils.ParseCertChain(r.Certificate)
+		if err != nil {
+			return err
+		}
+
+		if !utils.IsDeviceKey(chain[0].PublicKey) {
+			return errors.New(utils.ErrMsgUnsupportedKey)
+		}
+		certKey, err = utils.SerializePubKey(chain[0].PublicKey)
+		if err != nil {
+			return err
+		}
+		r.CertChain = chain
+
+		if r.PubKey == "" {
+			r.PubKey = certKey
+		}
+	}
+
 	if r.PubKey == "" {
-		return errors.New("pubkey must be provided")
+		return errors.New("pubkey or certificate must be provided")
 	}
 
 	// normalize pubkey by parsing+serializing the key string
@@ -47,17 +95,20 @@ func (r *AuthReq) Validate() error {
 		return err
 	}
 
-	keyStruct, ok := key.(*rsa.PublicKey)
-	if !ok {
+	if !utils.IsDeviceKey(key) {
 		return errors.New("cannot decode public key")
 	}
-	r.PubKeyStruct = keyStruct
+	r.PubKeyStruct = key
 
-	serialized, err := utils.SerializePubKey(keyStruct)
+	serialized, err := utils.SerializePubKey(key)
 	if err != nil {
 		return err
 	}
 
+	if certKey != "" && serialized != certKey {
+		return errors.New("pubkey doesn't match the certificate")
+	}
+
 	r.PubKey = serialized
 
 	if sorted, err := utils.JsonSort(r.IdData); err != nil {
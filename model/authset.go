@@ -26,6 +26,19 @@ const (
 	AuthSetKeyDeviceId     = "device_id"
 	AuthSetKeyStatus       = "status"
 	AuthSetKeyIdDataSha256 = "id_data_sha256"
+	AuthSetKeyTimestamp    = "ts"
+
+	// auth set conflicts, which usually come from cloned device images or
+	// misconfigured provisioning: the auth set's key is used by another
+	// device too, or the device already has an admitted auth set with a
+	// different key
+	AuthSetConflictPubKey = "pubkey"
+	AuthSetConflictIdData = "id_data"
+
+	// what resolving a conflict does to the auth sets conflicting with the
+	// authoritative one: reject them, or decommission their devices
+	ConflictOthersReject       = "reject"
+	ConflictOthersDecommission = "decommission"
 )
 
 type AuthSet struct {
@@ -34,9 +47,26 @@ type AuthSet struct {
 	IdDataStruct map[string]interface{} `bson:"id_data_struct,omitempty"`
 	IdDataSha256 []byte                 `bson:"id_data_sha256,omitempty"`
 	PubKey       string                 `json:"pubkey" bson:"pubkey,omitempty"`
+	KeyType      string                 `json:"key_type,omitempty" bson:"key_type,omitempty"`
 	DeviceId     string                 `json:"-" bson:"device_id,omitempty"`
 	Timestamp    *time.Time             `json:"ts" bson:"ts,omitempty"`
 	Status       string                 `json:"status" bson:"status,omitempty"`
+	Annotations  map[string]interface{} `json:"annotations,omitempty" bson:"annotations,omitempty"`
+	// one of the AuthSetConflict* kinds, if the auth set is in conflict
+	Conflict string `json:"conflict,omitempty" bson:"conflict,omitempty"`
+
+	TPMAttestation *TPMAttestationResult `json:"tpm_attestation,omitempty" bson:"tpm_attestation,omitempty"`
+
+	// the auth request the auth set was first seen with
+	FirstRequest *AuthSetRequest `json:"first_request,omitempty" bson:"first_request,omitempty"`
+}
+
+// AuthSetRequest describes the origin of an auth request, for
+// troubleshooting enrollment
+type AuthSetRequest struct {
+	SourceIP  string `json:"source_ip,omitempty" bson:"source_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	RequestId string `json:"request_id,omitempty" bson:"request_id,omitempty"`
 }
 
 type AuthSetUpdate struct {
@@ -44,9 +74,16 @@ type AuthSetUpdate struct {
 	IdDataStruct map[string]interface{} `bson:"id_data_struct,omitempty"`
 	IdDataSha256 []byte                 `bson:"id_data_sha256,omitempty"`
 	PubKey       string                 `bson:"pubkey,omitempty"`
+	KeyType      string                 `bson:"key_type,omitempty"`
 	DeviceId     string                 `bson:"device_id,omitempty"`
 	Timestamp    *time.Time             `bson:"ts,omitempty"`
 	Status       string                 `bson:"status,omitempty"`
+	Annotations  map[string]interface{} `bson:"annotations,omitempty"`
+	Conflict     string                 `bson:"conflict,omitempty"`
+
+	TPMAttestation *TPMAttestationResult `bson:"tpm_attestation,omitempty"`
+	// removes the TPM attestation result, e.g. when the key changes
+	ClearTPMAttestation bool `bson:"-"`
 }
 
 type DevAdmAuthSet struct {
@@ -0,0 +1,60 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BootstrapTokenReq is a request for a bootstrap token for a device with the
+// given identity data
+type BootstrapTokenReq struct {
+	IdData map[string]interface{} `json:"identity_data"`
+	// lifetime of the token in seconds; defaults to the configured one
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+}
+
+func (r *BootstrapTokenReq) Validate() error {
+	if len(r.IdData) == 0 {
+		return errors.New("identity_data must be provided")
+	}
+	if r.ExpiresIn < 0 {
+		return errors.New("expires_in must not be negative")
+	}
+	return nil
+}
+
+// BootstrapToken lets the first auth request of a device with the expected
+// identity data in, e.g. embedded by a factory provisioning line: the auth
+// request's auth set is accepted right away. The token can be used once.
+type BootstrapToken struct {
+	// SHA256 hash of the token
+	Id string `json:"-" bson:"_id"`
+
+	// hash of the identity data, see devauth.idDataHash
+	IdDataSha256 []byte `json:"-" bson:"id_data_sha256"`
+
+	CreatedTs time.Time `json:"created_ts" bson:"created_ts"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	// when the token was used
+	UsedTs *time.Time `json:"used_ts,omitempty" bson:"used_ts,omitempty"`
+}
+
+// NewBootstrapToken is a newly issued bootstrap token
+type NewBootstrapToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -16,3 +16,33 @@ package model
 type Count struct {
 	Count int `json:"count"`
 }
+
+// DeviceCounts is the number of devices, in total and per status
+type DeviceCounts struct {
+	Count         int `json:"count"`
+	Pending       int `json:"pending"`
+	Accepted      int `json:"accepted"`
+	Rejected      int `json:"rejected"`
+	Preauthorized int `json:"preauthorized"`
+	Quarantined   int `json:"quarantined"`
+}
+
+// ByStatus returns the number of devices with the status, the total if
+// the status is empty
+func (c DeviceCounts) ByStatus(status string) int {
+	switch status {
+	case DevStatusPending:
+		return c.Pending
+	case DevStatusAccepted:
+		return c.Accepted
+	case DevStatusRejected:
+		return c.Rejected
+	case DevStatusPreauth:
+		return c.Preauthorized
+	case DevStatusQuarantined:
+		return c.Quarantined
+	case "":
+		return c.Count
+	}
+	return 0
+}
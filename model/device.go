@@ -22,9 +22,25 @@ const (
 	DevStatusRejected = "rejected"
 	DevStatusPending  = "pending"
 	DevStatusPreauth  = "preauthorized"
+	// set on the device only, its auth sets keep their statuses
+	DevStatusQuarantined = "quarantined"
 
 	DevKeyIdData = "id_data"
 	DevKeyStatus = "status"
+
+	DevKeyDecommissionAt = "decommission_at"
+	DevKeyAlias          = "alias"
+	DevKeyNotes          = "notes"
+	DevKeyGroup          = "group"
+	DevKeyLabels         = "labels"
+	DevKeyCreatedTs      = "created_ts"
+	DevKeyUpdatedTs      = "updated_ts"
+	DevKeyLastCheckin    = "last_checkin"
+	// set if any of the device's auth sets is in conflict
+	DevKeyConflict = "conflict"
+
+	// identity attribute values, for searching devices; set by the store
+	DevKeyIdDataValues = "id_data_values"
 )
 
 // note: fields with underscores need the 'bson' decorator
@@ -32,23 +48,46 @@ const (
 type Device struct {
 	Id              string                 `json:"id" bson:"_id,omitempty"`
 	PubKey          string                 `json:"-" bson:",omitempty"`
+	KeyType         string                 `json:"key_type,omitempty" bson:"key_type,omitempty"`
 	IdData          string                 `json:"id_data" bson:"id_data,omitempty"`
 	IdDataStruct    map[string]interface{} `bson:"id_data_struct,omitempty"`
 	IdDataSha256    []byte                 `bson:"id_data_sha256,omitempty"`
+	IdDataValues    []string               `json:"-" bson:"id_data_values,omitempty"`
 	Status          string                 `json:"-" bson:",omitempty"`
 	Decommissioning bool                   `json:"decommissioning" bson:",omitempty"`
+	Owner           string                 `json:"owner,omitempty" bson:"owner,omitempty"`
+	Group           string                 `json:"group,omitempty" bson:"group,omitempty"`
+	TransferId      string                 `json:"transfer_id,omitempty" bson:"transfer_id,omitempty"`
+	DecommissionAt  *time.Time             `json:"decommission_at,omitempty" bson:"decommission_at,omitempty"`
+	TokenLastUsed   *time.Time             `json:"token_last_used,omitempty" bson:"token_last_used,omitempty"`
+	LastCheckin     *time.Time             `json:"last_checkin,omitempty" bson:"last_checkin,omitempty"`
+	Alias           string                 `json:"alias,omitempty" bson:"alias,omitempty"`
+	Notes           string                 `json:"notes,omitempty" bson:"notes,omitempty"`
+	Labels          map[string]string      `json:"labels,omitempty" bson:"labels,omitempty"`
+	Conflict        bool                   `json:"conflict,omitempty" bson:"conflict,omitempty"`
 	CreatedTs       time.Time              `json:"created_ts" bson:"created_ts,omitempty"`
 	UpdatedTs       time.Time              `json:"updated_ts" bson:"updated_ts,omitempty"`
 	AuthSets        []AuthSet              `json:"auth_sets" bson:"-"`
 }
 
+// DeviceCheckin is the last time a device verified its token or sent an
+// auth request
+type DeviceCheckin struct {
+	DeviceId string
+	Time     time.Time
+}
+
 type DeviceUpdate struct {
 	PubKey          string                 `json:"-" bson:",omitempty"`
+	KeyType         string                 `json:"-" bson:"key_type,omitempty"`
 	IdData          string                 `json:"id_data" bson:"id_data,omitempty"`
 	IdDataStruct    map[string]interface{} `bson:"id_data_struct,omitempty"`
 	IdDataSha256    []byte                 `bson:"id_data_sha256,omitempty"`
 	Status          string                 `json:"-" bson:",omitempty"`
 	Decommissioning *bool                  `json:"-" bson:",omitempty"`
+	Owner           *string                `json:"-" bson:"owner,omitempty"`
+	TransferId      *string                `json:"-" bson:"transfer_id,omitempty"`
+	Conflict        *bool                  `json:"-" bson:"conflict,omitempty"`
 	UpdatedTs       *time.Time             `json:"updated_ts" bson:"updated_ts,omitempty"`
 }
 
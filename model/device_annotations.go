@@ -0,0 +1,105 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// limits of the alias, notes and labels attached to a device
+	DeviceAliasMaxLength = 256
+	DeviceNotesMaxLength = 4096
+	DeviceLabelsMaxCount = 64
+	DeviceLabelMaxLength = 256
+)
+
+// DeviceAnnotations updates the alias, notes, labels and group operators
+// attach to a device, as a JSON merge patch (RFC 7396). The alias, notes
+// and group are replaced if given, an empty string or null clears them;
+// the labels are merged with the device's ones, a null value removes the
+// label.
+type DeviceAnnotations struct {
+	Alias  *string            `json:"alias"`
+	Notes  *string            `json:"notes"`
+	Labels map[string]*string `json:"labels"`
+	Group  *string            `json:"group"`
+}
+
+// UnmarshalJSON tells null alias, notes and group, which clear them, from
+// missing ones
+func (a *DeviceAnnotations) UnmarshalJSON(b []byte) error {
+	type deviceAnnotations DeviceAnnotations
+	var v deviceAnnotations
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	null := func(key string) bool {
+		raw, ok := fields[key]
+		return ok && bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+	}
+	if null("alias") {
+		v.Alias = new(string)
+	}
+	if null("notes") {
+		v.Notes = new(string)
+	}
+	if null("group") {
+		v.Group = new(string)
+	}
+
+	*a = DeviceAnnotations(v)
+	return nil
+}
+
+func (a *DeviceAnnotations) Validate() error {
+	if a.Alias == nil && a.Notes == nil && len(a.Labels) == 0 && a.Group == nil {
+		return errors.New("alias, notes, labels or group must be provided")
+	}
+	if a.Alias != nil && utf8.RuneCountInString(*a.Alias) > DeviceAliasMaxLength {
+		return errors.Errorf("alias must be at most %d characters long",
+			DeviceAliasMaxLength)
+	}
+	if a.Notes != nil && utf8.RuneCountInString(*a.Notes) > DeviceNotesMaxLength {
+		return errors.Errorf("notes must be at most %d characters long",
+			DeviceNotesMaxLength)
+	}
+	if len(a.Labels) > DeviceLabelsMaxCount {
+		return errors.Errorf("a device can have at most %d labels",
+			DeviceLabelsMaxCount)
+	}
+	for k, v := range a.Labels {
+		// label keys are field names of the device document
+		if k == "" || strings.ContainsAny(k, ".$") {
+			return errors.Errorf("invalid label %q: must not be empty "+
+				"or contain '.' or '$'", k)
+		}
+		if utf8.RuneCountInString(k) > DeviceLabelMaxLength ||
+			(v != nil && utf8.RuneCountInString(*v) > DeviceLabelMaxLength) {
+			return errors.Errorf("invalid label %q: labels must be at "+
+				"most %d characters long", k, DeviceLabelMaxLength)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// grant type of device access token requests (RFC 8628, sec. 3.4)
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// DeviceCode is a pending device authorization grant (RFC 8628); it links the
+// device code, known only to the device, and the user code, presented to
+// the operator, with the auth set submitted by the device
+type DeviceCode struct {
+	// SHA256 hash of the device code
+	Id       string `json:"-" bson:"_id"`
+	UserCode string `json:"user_code" bson:"user_code"`
+
+	TenantId  string `json:"-" bson:"tenant_id,omitempty"`
+	DeviceId  string `json:"device_id" bson:"device_id"`
+	AuthSetId string `json:"auth_id" bson:"auth_id"`
+
+	// identity data of the device, for the operator to verify
+	IdDataStruct map[string]interface{} `json:"identity_data" bson:"-"`
+
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+
+	// minimum polling interval in seconds
+	Interval     int64      `json:"-" bson:"interval"`
+	LastPolledAt *time.Time `json:"-" bson:"last_polled_at,omitempty"`
+}
+
+type DeviceCodeUpdate struct {
+	Interval     int64      `bson:"interval,omitempty"`
+	LastPolledAt *time.Time `bson:"last_polled_at,omitempty"`
+}
+
+// DeviceAuthorization is the response to device authorization request
+// (RFC 8628, sec. 3.2)
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// NormalizeUserCode brings a user code as typed in by the operator to its
+// canonical form (upper case, no separators)
+func NormalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ':
+			return -1
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, code)
+}
+
+// FormatUserCode formats a canonical user code for display, e.g. WDJB-MJHT
+func FormatUserCode(code string) string {
+	if len(code) <= 4 {
+		return code
+	}
+	return code[:len(code)/2] + "-" + code[len(code)/2:]
+}
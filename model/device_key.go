@@ -0,0 +1,37 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// DeviceKey is an accepted public key of a device, i.e. the key of one of
+// its accepted auth sets
+type DeviceKey struct {
+	// auth set id
+	Id        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	KeyType   string     `json:"key_type,omitempty"`
+	Timestamp *time.Time `json:"ts"`
+}
+
+func NewDeviceKey(a AuthSet) DeviceKey {
+	return DeviceKey{
+		Id:        a.Id,
+		PubKey:    a.PubKey,
+		KeyType:   a.KeyType,
+		Timestamp: a.Timestamp,
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"github.com/pkg/errors"
+)
+
+// maximum number of devices a bulk status update applies to
+const DevicesStatusMaxCount = 1000
+
+// DevicesStatusReq is a request to set the admission status of several
+// devices at once, given either by their ids or by a filter on the device
+// listing
+type DevicesStatusReq struct {
+	Status    string               `json:"status"`
+	DeviceIds []string             `json:"device_ids,omitempty"`
+	Filter    *DevicesStatusFilter `json:"filter,omitempty"`
+}
+
+// DevicesStatusFilter selects the devices of a bulk status update, as the
+// query parameters of the device listing do
+type DevicesStatusFilter struct {
+	Status      string `json:"status,omitempty"`
+	Group       string `json:"group,omitempty"`
+	Search      string `json:"search,omitempty"`
+	SearchExact bool   `json:"search_exact,omitempty"`
+}
+
+func (r *DevicesStatusReq) Validate() error {
+	if len(r.DeviceIds) == 0 && r.Filter == nil {
+		return errors.New("device_ids or filter must be provided")
+	}
+	if len(r.DeviceIds) > 0 && r.Filter != nil {
+		return errors.New("device_ids can't be used along with filter")
+	}
+	if len(r.DeviceIds) > DevicesStatusMaxCount {
+		return errors.Errorf("at most %d devices can be updated at once",
+			DevicesStatusMaxCount)
+	}
+	return nil
+}
+
+// DeviceStatusResult is the outcome of a bulk status update for a single
+// device: the status it got, or why it couldn't be updated
+type DeviceStatusResult struct {
+	DeviceId string `json:"device_id"`
+	Status   string `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
@@ -0,0 +1,41 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// IdempotencyRecord is kept for a request made with an Idempotency-Key
+// header, so that retries of the request with the same key get the
+// response of the first one instead of repeating its effects
+type IdempotencyRecord struct {
+	Key string `bson:"_id"`
+
+	// hash of the method, path and body of the request the key was
+	// first used with
+	RequestSha256 []byte `bson:"request_sha256"`
+
+	// nil while the request is being handled
+	Response *IdempotencyResponse `bson:"response,omitempty"`
+
+	CreatedTs time.Time `bson:"created_ts"`
+}
+
+// IdempotencyResponse is the response recorded for an idempotency key
+type IdempotencyResponse struct {
+	Status int                 `bson:"status"`
+	Header map[string][]string `bson:"header,omitempty"`
+	Body   []byte              `bson:"body,omitempty"`
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"crypto/rsa"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/utils"
+)
+
+// KeyPolicy is the minimum strength device public keys must have to enroll
+type KeyPolicy struct {
+	// minimum RSA modulus size in bits; 0 for no minimum
+	MinRSABits int `json:"min_rsa_bits"`
+	// key types devices may enroll with, see utils.KeyType*; any
+	// supported type if empty
+	AllowedKeyTypes []string `json:"allowed_key_types"`
+}
+
+// Check tells why a parsed device public key doesn't meet the policy, if it
+// doesn't; whether the key is supported at all is up to AuthReq.Validate
+func (p KeyPolicy) Check(key interface{}) error {
+	keyType := utils.KeyType(key)
+	if len(p.AllowedKeyTypes) > 0 && !p.allows(keyType) {
+		return errors.Errorf("key type %s is not allowed", keyType)
+	}
+
+	if k, ok := key.(*rsa.PublicKey); ok && k.N.BitLen() < p.MinRSABits {
+		return errors.Errorf("RSA key of %d bits is shorter than the minimum of %d bits",
+			k.N.BitLen(), p.MinRSABits)
+	}
+
+	return nil
+}
+
+// Validate checks that the policy only names supported key types
+func (p KeyPolicy) Validate() error {
+	for _, t := range p.AllowedKeyTypes {
+		switch t {
+		case utils.KeyTypeRSA, utils.KeyTypeEd25519,
+			utils.KeyTypeECDSAP256, utils.KeyTypeECDSAP384:
+		default:
+			return errors.Errorf("unsupported key type: %s", t)
+		}
+	}
+	if p.MinRSABits < 0 {
+		return errors.New("minimum RSA key size can't be negative")
+	}
+	return nil
+}
+
+func (p KeyPolicy) allows(keyType string) bool {
+	for _, t := range p.AllowedKeyTypes {
+		if t == keyType {
+			return true
+		}
+	}
+	return false
+}
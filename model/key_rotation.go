@@ -0,0 +1,97 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"crypto/x509"
+	"errors"
+
+	"github.com/mendersoftware/deviceauth/utils"
+)
+
+// KeyRotationReq is a device's request to replace the public key of its
+// accepted auth set; signed with the current key
+type KeyRotationReq struct {
+	IdData      string `json:"id_data"`
+	TenantToken string `json:"tenant_token"`
+	PubKey      string `json:"pubkey"`
+	NewPubKey   string `json:"new_pubkey"`
+	// PEM encoded X.509 certificate chain of the new key, device
+	// certificate first, as in AuthReq
+	Certificate string `json:"certificate,omitempty"`
+
+	//helpers, not serialized
+	PubKeyStruct    interface{} `json:"-"`
+	NewPubKeyStruct interface{} `json:"-"`
+	//parsed Certificate, verified by devauth
+	CertChain []*x509.Certificate `json:"-"`
+	//TLS client certificate the request came with, verified by the
+	//listener
+	ClientCert *x509.Certificate `json:"-"`
+}
+
+// Validate checks the request, and normalizes the identity data and keys
+// like AuthReq.Validate
+func (r *KeyRotationReq) Validate() error {
+	if r.IdData == "" {
+		return errors.New("id_data must be provided")
+	}
+
+	var err error
+	r.PubKey, r.PubKeyStruct, err = normalizePubKey(r.PubKey)
+	if err != nil {
+		return err
+	}
+	r.NewPubKey, r.NewPubKeyStruct, err = normalizePubKey(r.NewPubKey)
+	if err != nil {
+		return err
+	}
+	if r.NewPubKey == r.PubKey {
+		return errors.New("new_pubkey must differ from pubkey")
+	}
+
+	if r.Certificate != "" {
+		chain, err := utils.ParseCertChain(r.Certificate)
+		if err != nil {
+			return err
+		}
+		certKey, err := utils.SerializePubKey(chain[0].PublicKey)
+		if err != nil {
+			return err
+		}
+		if certKey != r.NewPubKey {
+			return errors.New("new_pubkey doesn't match the certificate")
+		}
+		r.CertChain = chain
+	}
+
+	r.IdData, err = utils.JsonSort(r.IdData)
+	return err
+}
+
+func normalizePubKey(pubkey string) (string, interface{}, error) {
+	key, err := utils.ParsePubKey(pubkey)
+	if err != nil {
+		return "", nil, err
+	}
+	if !utils.IsDeviceKey(key) {
+		return "", nil, errors.New("cannot decode public key")
+	}
+
+	serialized, err := utils.SerializePubKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+	return serialized, key, nil
+}
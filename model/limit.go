@@ -15,10 +15,17 @@ package model
 
 const (
 	LimitMaxDeviceCount = "max_devices"
+	// lifetime of the offboarding token, in seconds; 0 disables offboarding
+	// tokens
+	LimitOffboardingGracePeriod = "offboarding_grace_period"
+	// lifetime of the tenant's device tokens, in seconds; 0 stands for the
+	// global token expiration time
+	LimitTokenExpiration = "token_expiration"
 )
 
 var (
-	ValidLimits = []string{LimitMaxDeviceCount}
+	ValidLimits = []string{LimitMaxDeviceCount, LimitOffboardingGracePeriod,
+		LimitTokenExpiration}
 )
 
 type Limit struct {
@@ -26,6 +33,13 @@ type Limit struct {
 	Value uint64 `bson:"value" json:"value"`
 }
 
+// DeviceLimitUsage is the tenant's limit of accepted devices, 0 for no
+// limit, and the number of devices accepted
+type DeviceLimitUsage struct {
+	Limit uint64 `json:"limit"`
+	Usage int    `json:"usage"`
+}
+
 func (l Limit) IsLess(what uint64) bool {
 	return what < l.Value
 }
@@ -0,0 +1,48 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+const (
+	OffboardingReasonRejected       = "rejected"
+	OffboardingReasonDecommissioned = "decommissioned"
+)
+
+// OffboardingToken is the final, short lived token of a rejected or
+// decommissioned device. The token is handed out once, on the device's next
+// auth request, and is only valid for the configured device API endpoints.
+// Records are kept after expiration, as an audit trail.
+type OffboardingToken struct {
+	// token's 'jti' claim
+	Id       string `json:"id" bson:"_id"`
+	DeviceId string `json:"device_id" bson:"device_id"`
+	Reason   string `json:"reason" bson:"reason"`
+
+	// auth set the token is handed out to
+	IdDataSha256 []byte `json:"-" bson:"id_data_sha256"`
+	PubKey       string `json:"-" bson:"pubkey"`
+
+	Token string `json:"-" bson:"token"`
+
+	CreatedTs time.Time `json:"created_ts" bson:"created_ts"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	// when the device got the token
+	ClaimedTs *time.Time `json:"claimed_ts,omitempty" bson:"claimed_ts,omitempty"`
+	// last successful verification
+	LastUsedTs *time.Time `json:"last_used_ts,omitempty" bson:"last_used_ts,omitempty"`
+	Uses       int        `json:"uses" bson:"uses"`
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	PreAuthImportFormatCSV    = "csv"
+	PreAuthImportFormatNDJSON = "ndjson"
+
+	// CSV columns; the identity data column holds a JSON object
+	PreAuthImportColIdData = "identity_data"
+	PreAuthImportColPubKey = "pubkey"
+
+	// longest NDJSON line accepted
+	preAuthImportMaxLine = 64 * 1024
+)
+
+// PreAuthImportReader reads the devices to preauthorize from a CSV file
+// with a header row naming the identity_data and pubkey columns, or from
+// NDJSON with one {"identity_data": {...}, "pubkey": "..."} object a line.
+// Records are parsed one at a time, so the input can be arbitrarily long.
+type PreAuthImportReader struct {
+	csv       *csv.Reader
+	colIdData int
+	colPubKey int
+
+	lines *bufio.Scanner
+
+	records int
+}
+
+// PreAuthImportItem is a record read by PreAuthImportReader; Req lacks
+// the device and auth set ids, which are up to the importer. Err is set
+// if the record is malformed, the reader can go on after it.
+type PreAuthImportItem struct {
+	// position of the record in the input, from 1, the CSV header aside
+	Record int
+	Req    PreAuthReq
+	Err    error
+}
+
+// PreAuthImportResult sums up an import
+type PreAuthImportResult struct {
+	Preauthorized int                  `json:"preauthorized"`
+	Errors        []PreAuthImportError `json:"errors"`
+}
+
+// PreAuthImportError tells why a record wasn't imported
+type PreAuthImportError struct {
+	Record int    `json:"record"`
+	Error  string `json:"error"`
+}
+
+func NewPreAuthImportReader(r io.Reader, format string) (*PreAuthImportReader, error) {
+	switch format {
+	case PreAuthImportFormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.ReuseRecord = true
+
+		header, err := cr.Read()
+		if err == io.EOF {
+			return nil, errors.New("missing CSV header")
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to read CSV header")
+		}
+
+		ir := &PreAuthImportReader{
+			csv:       cr,
+			colIdData: -1,
+			colPubKey: -1,
+		}
+		for i, name := range header {
+			switch name {
+			case PreAuthImportColIdData:
+				ir.colIdData = i
+			case PreAuthImportColPubKey:
+				ir.colPubKey = i
+			}
+		}
+		if ir.colIdData < 0 {
+			return nil, errors.Errorf("missing CSV column: %s", PreAuthImportColIdData)
+		}
+		if ir.colPubKey < 0 {
+			return nil, errors.Errorf("missing CSV column: %s", PreAuthImportColPubKey)
+		}
+		return ir, nil
+
+	case PreAuthImportFormatNDJSON:
+		s := bufio.NewScanner(r)
+		s.Buffer(make([]byte, 4096), preAuthImportMaxLine)
+		return &PreAuthImportReader{lines: s}, nil
+
+	default:
+		return nil, errors.Errorf("unsupported import format: %s", format)
+	}
+}
+
+// Next returns the next record, io.EOF at the end of the input; other
+// errors mean the input can't be read any further
+func (r *PreAuthImportReader) Next() (*PreAuthImportItem, error) {
+	if r.csv != nil {
+		return r.nextCSV()
+	}
+	return r.nextNDJSON()
+}
+
+func (r *PreAuthImportReader) nextCSV() (*PreAuthImportItem, error) {
+	rec, err := r.csv.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+
+	r.records++
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read record %d", r.records)
+	}
+
+	item := &PreAuthImportItem{Record: r.records}
+	if len(rec) <= r.colIdData || len(rec) <= r.colPubKey {
+		item.Err = errors.New("missing fields")
+		return item, nil
+	}
+
+	item.Req.IdData, item.Err = preAuthImportIdData([]byte(rec[r.colIdData]))
+	item.Req.PubKey = rec[r.colPubKey]
+	return item, nil
+}
+
+func (r *PreAuthImportReader) nextNDJSON() (*PreAuthImportItem, error) {
+	for r.lines.Scan() {
+		line := bytes.TrimSpace(r.lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		r.records++
+		item := &PreAuthImportItem{Record: r.records}
+
+		var in struct {
+			IdData json.RawMessage `json:"identity_data"`
+			PubKey string          `json:"pubkey"`
+		}
+		if err := json.Unmarshal(line, &in); err != nil {
+			item.Err = errors.Wrap(err, "invalid JSON")
+			return item, nil
+		}
+
+		item.Req.IdData, item.Err = preAuthImportIdData(in.IdData)
+		item.Req.PubKey = in.PubKey
+		return item, nil
+	}
+
+	if err := r.lines.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read record %d", r.records+1)
+	}
+	return nil, io.EOF
+}
+
+// preAuthImportIdData checks the identity data is a non-empty JSON object
+func preAuthImportIdData(raw []byte) (string, error) {
+	var idData map[string]interface{}
+	if err := json.Unmarshal(raw, &idData); err != nil || len(idData) == 0 {
+		return "", errors.Errorf("%s: must be a non-empty JSON object",
+			PreAuthImportColIdData)
+	}
+
+	enc, err := json.Marshal(idData)
+	if err != nil {
+		return "", err
+	}
+	return string(enc), nil
+}
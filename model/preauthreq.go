@@ -14,7 +14,6 @@
 package model
 
 import (
-	"crypto/rsa"
 	"encoding/json"
 	"io"
 
@@ -64,12 +63,11 @@ func (r *PreAuthReq) Validate() error {
 		return err
 	}
 
-	keyStruct, ok := key.(*rsa.PublicKey)
-	if !ok {
-		return errors.New("cannot decode key as RSA public key")
+	if !utils.IsDeviceKey(key) {
+		return errors.New("cannot decode key as RSA, ECDSA or Ed25519 public key")
 	}
 
-	serialized, err := utils.SerializePubKey(keyStruct)
+	serialized, err := utils.SerializePubKey(key)
 	if err != nil {
 		return err
 	}
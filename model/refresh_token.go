@@ -0,0 +1,31 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// RefreshToken is a long lived token handed out to a device along with its
+// access token, to be exchanged for a new access token without another
+// signed auth request; each refresh token can be exchanged only once
+type RefreshToken struct {
+	// SHA256 hash of the refresh token
+	Id string `bson:"_id"`
+
+	TenantId  string    `bson:"tenant_id,omitempty"`
+	DeviceId  string    `bson:"device_id"`
+	AuthSetId string    `bson:"auth_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
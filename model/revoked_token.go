@@ -11,17 +11,16 @@
 //    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 //    See the License for the specific language governing permissions and
 //    limitations under the License.
-package http
+package model
 
 import (
-	"github.com/ant0ine/go-json-rest/rest"
-	"github.com/mendersoftware/go-lib-micro/requestid"
-
-	"github.com/mendersoftware/deviceauth/api"
+	"time"
 )
 
-func ContextFromRequest(r *rest.Request) *api.RequestContext {
-	return &api.RequestContext{
-		ReqId: requestid.GetReqId(r),
-	}
+// RevokedToken records a device token deleted before its expiration, so
+// that parties verifying tokens offline can learn about the revocation
+type RevokedToken struct {
+	// token's 'jti' claim
+	Id        string    `json:"jti" bson:"_id"`
+	RevokedTs time.Time `json:"revoked_ts" bson:"revoked_ts"`
 }
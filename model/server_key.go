@@ -0,0 +1,33 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// ServerKey is a device token signing key, added at runtime to rotate keys
+// without restarting the service. The newest key not retired signs new
+// tokens; retired keys are kept as an audit trail.
+type ServerKey struct {
+	// key's 'kid', the JWK thumbprint of its public key
+	Id        string `json:"id" bson:"_id"`
+	Algorithm string `json:"algorithm" bson:"algorithm"`
+	// secret reference to the PEM encoded private key, e.g. vault:// or
+	// file://; the key itself is never stored
+	PrivateKeyRef string `json:"-" bson:"private_key_ref"`
+
+	CreatedTs time.Time  `json:"created_ts" bson:"created_ts"`
+	RetiredTs *time.Time `json:"retired_ts,omitempty" bson:"retired_ts,omitempty"`
+}
@@ -0,0 +1,49 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// Statistics aggregates the state and the activity of the tenant's
+// devices, for dashboards
+type Statistics struct {
+	Devices DeviceCounts `json:"devices"`
+	// number of auth requests received per hour of the period, the
+	// oldest hour first
+	AuthRequests []HourlyCount `json:"auth_requests"`
+	// share of the devices accepted out of those leaving the pending
+	// status in the period; nil if none did
+	AcceptanceRate *float64 `json:"acceptance_rate"`
+	// auth sets waiting to be accepted or rejected
+	PendingBacklog PendingBacklog `json:"pending_backlog"`
+}
+
+// HourlyCount is the number of events which happened in the hour starting
+// at the time
+type HourlyCount struct {
+	Hour  time.Time `json:"hour" bson:"hour"`
+	Count int       `json:"count" bson:"count"`
+}
+
+// PendingBacklog describes the pending auth sets, their ages are in
+// seconds
+type PendingBacklog struct {
+	Count  int   `json:"count"`
+	AgeP50 int64 `json:"age_p50"`
+	AgeP90 int64 `json:"age_p90"`
+	AgeP99 int64 `json:"age_p99"`
+	AgeMax int64 `json:"age_max"`
+}
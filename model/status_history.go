@@ -0,0 +1,34 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// DeviceStatusChange records a change of a device's admission status, to
+// tell who changed it and when
+type DeviceStatusChange struct {
+	Id       string `json:"id" bson:"_id"`
+	DeviceId string `json:"device_id" bson:"device_id"`
+	// status before the change; empty when the device was added
+	From string `json:"from,omitempty" bson:"from,omitempty"`
+	To   string `json:"to" bson:"to"`
+	// user who changed the status with the management API; empty if the
+	// change followed a request of the device
+	UserId string `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	// address of the client whose request changed the status
+	SourceIP  string    `json:"source_ip,omitempty" bson:"source_ip,omitempty"`
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+}
@@ -16,6 +16,7 @@ package model
 import (
 	"encoding/json"
 	"io"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -24,6 +25,13 @@ type NewTenant struct {
 	TenantId string `json:"tenant_id"`
 }
 
+// TenantStatus tells if the tenant is suspended; a suspended tenant's
+// devices can't authenticate
+type TenantStatus struct {
+	Suspended   bool       `json:"suspended" bson:"suspended"`
+	SuspendedTs *time.Time `json:"suspended_ts,omitempty" bson:"suspended_ts,omitempty"`
+}
+
 func ParseNewTenant(source io.Reader) (*NewTenant, error) {
 	jd := json.NewDecoder(source)
 
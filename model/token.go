@@ -13,11 +13,49 @@
 //    limitations under the License.
 package model
 
+import (
+	"time"
+)
+
 type Token struct {
 	Id        string `json:"id" bson:"_id"`
 	DevId     string `json:"dev_id" bson:"dev_id,omitempty"`
 	AuthSetId string `json:"auth_id" bson:"auth_id,omitempty"`
 	Token     string `json:"token" bson:"token,omitempty"`
+	// sliding expiration time, extended on use; nil unless sliding
+	// expiration is enabled
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	// last time the token passed verification
+	LastUsed *time.Time `json:"last_used,omitempty" bson:"last_used,omitempty"`
+	// token's 'exp' claim, the token is purged from the database after
+	Exp *time.Time `json:"-" bson:"exp,omitempty"`
+	// token's issue time
+	IssuedTs *time.Time `json:"-" bson:"issued_ts,omitempty"`
+}
+
+// TokenUsage is the last time a device token passed verification
+type TokenUsage struct {
+	TokenId  string
+	DeviceId string
+	LastUsed time.Time
+}
+
+// DeviceToken is a device token as listed to the operator, without the
+// token itself
+type DeviceToken struct {
+	Id        string     `json:"id"`
+	AuthSetId string     `json:"auth_id"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+func NewDeviceToken(t Token) DeviceToken {
+	return DeviceToken{
+		Id:        t.Id,
+		AuthSetId: t.AuthSetId,
+		ExpiresAt: t.ExpiresAt,
+		LastUsed:  t.LastUsed,
+	}
 }
 
 type TokenFilter struct {
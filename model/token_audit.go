@@ -0,0 +1,48 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+const (
+	TokenAuditActionIssued  = "issued"
+	TokenAuditActionRevoked = "revoked"
+
+	// what token issuances are triggered by; revocations are triggered
+	// for one of the revocation reasons
+	TokenAuditTriggerAuthRequest         = "auth_request"
+	TokenAuditTriggerDeviceAuthorization = "device_authorization"
+	TokenAuditTriggerRefreshToken        = "refresh_token"
+	TokenAuditTriggerRenewal             = "renewal"
+	TokenAuditTriggerOffboarding         = "offboarding"
+)
+
+// TokenAuditRecord records the issuance or revocation of device tokens,
+// for compliance investigations
+type TokenAuditRecord struct {
+	Id     string `json:"id" bson:"_id"`
+	Action string `json:"action" bson:"action"`
+	// token's 'jti' claim; empty if all tokens of the device, or of the
+	// tenant, were revoked
+	TokenId  string `json:"token_id,omitempty" bson:"token_id,omitempty"`
+	DeviceId string `json:"device_id,omitempty" bson:"device_id,omitempty"`
+	Trigger  string `json:"trigger" bson:"trigger"`
+	// user who triggered the action with the management API, if any
+	UserId string `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	// address of the client whose request triggered the action
+	SourceIP  string    `json:"source_ip,omitempty" bson:"source_ip,omitempty"`
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+}
@@ -0,0 +1,39 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+const (
+	// token type reported by token introspection (RFC 7662, sec. 2.2)
+	TokenTypeBearer = "Bearer"
+)
+
+// TokenIntrospection is the response to a token introspection request
+// (RFC 7662, sec. 2.2); inactive tokens report nothing but Active
+type TokenIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ID        string `json:"jti,omitempty"`
+
+	// device and tenant of the token, and the device status
+	DeviceId string `json:"device_id,omitempty"`
+	Tenant   string `json:"tenant_id,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
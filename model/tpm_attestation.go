@@ -0,0 +1,79 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// TPMAttestation is TPM 2.0 attestation data of the device key, see
+// tpm.Verifier; binary structures are base64 encoded
+type TPMAttestation struct {
+	// PEM encoded EK certificate chain, EK certificate first
+	EKCertificate string `json:"ek_certificate"`
+	// TPMT_PUBLIC of the attestation key
+	AKPublic string `json:"ak_public"`
+	// TPMT_PUBLIC of the device key
+	KeyPublic string `json:"key_public"`
+	// TPMS_ATTEST of TPM2_Certify of the device key with the AK,
+	// qualifying data is the SHA256 of the identity data, normalized by
+	// AuthReq.Validate
+	CertifyInfo string `json:"certify_info"`
+	// TPMT_SIGNATURE of CertifyInfo
+	CertifySignature string `json:"certify_signature"`
+	// the secret recovered by TPM2_ActivateCredential from the
+	// TPMCredential handed out with the auth request's nonce
+	ActivatedCredential string `json:"activated_credential"`
+}
+
+// TPMCredentialReq identifies the TPM and AK of a device, for the server to
+// make a credential that only that TPM can activate
+type TPMCredentialReq struct {
+	// PEM encoded EK certificate chain, EK certificate first
+	EKCertificate string `json:"ek_certificate"`
+	// TPMT_PUBLIC of the attestation key
+	AKPublic string `json:"ak_public"`
+}
+
+// TPMCredential holds the arguments of TPM2_ActivateCredential, base64
+// encoded
+type TPMCredential struct {
+	// TPM2B_ID_OBJECT
+	CredentialBlob string `json:"credential_blob"`
+	// TPM2B_ENCRYPTED_SECRET
+	EncryptedSecret string `json:"encrypted_secret"`
+}
+
+// TPMActivation is what a TPMCredential is bound to, kept until the device
+// returns the activated credential
+type TPMActivation struct {
+	// SHA256 of the EK certificate the credential was made for
+	EKCertificateDigest []byte `bson:"ek_certificate_digest"`
+	// name of the AK the credential was made for
+	AKName []byte `bson:"ak_name"`
+	// SHA256 of the credential's secret
+	SecretDigest []byte `bson:"secret_digest"`
+}
+
+// TPMAttestationResult is the outcome of the TPM attestation verification,
+// recorded with the auth set
+type TPMAttestationResult struct {
+	Verified bool `json:"verified" bson:"verified"`
+	// why verification failed
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	// EK certificate issuer and serial number
+	EKIssuer  string    `json:"ek_issuer,omitempty" bson:"ek_issuer,omitempty"`
+	EKSerial  string    `json:"ek_serial,omitempty" bson:"ek_serial,omitempty"`
+	Timestamp time.Time `json:"ts" bson:"ts"`
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// transfer within the tenant, waiting for the device to be accepted
+	// again under the new owner
+	TransferStatusPendingAcceptance = "pending_acceptance"
+	// transfer to another tenant, waiting for the destination tenant to
+	// accept it
+	TransferStatusPendingApproval = "pending_approval"
+	// transfer to another tenant, waiting for the device to enroll there
+	TransferStatusPendingEnrollment = "pending_enrollment"
+	TransferStatusCompleted         = "completed"
+	TransferStatusCancelled         = "cancelled"
+	TransferStatusDeclined          = "declined"
+)
+
+// TransferReq is a request to move a device to another owner, and
+// optionally another tenant
+type TransferReq struct {
+	DeviceId   string `json:"device_id"`
+	ToOwner    string `json:"to_owner"`
+	ToTenantId string `json:"to_tenant_id"`
+}
+
+func (r *TransferReq) Validate() error {
+	if r.ToOwner == "" && r.ToTenantId == "" {
+		return errors.New("to_owner or to_tenant_id must be provided")
+	}
+	return nil
+}
+
+// Transfer tracks a device ownership transfer. Transfers are kept in the
+// common database, as a transfer to another tenant is completed in the
+// destination tenant's context.
+type Transfer struct {
+	Id       string `json:"id" bson:"_id"`
+	DeviceId string `json:"device_id" bson:"device_id"`
+
+	// source tenant
+	TenantId   string `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	FromOwner  string `json:"from_owner,omitempty" bson:"from_owner,omitempty"`
+	ToOwner    string `json:"to_owner,omitempty" bson:"to_owner,omitempty"`
+	ToTenantId string `json:"to_tenant_id,omitempty" bson:"to_tenant_id,omitempty"`
+
+	// identity data hash, to recognize the device enrolling in the
+	// destination tenant
+	IdDataSha256 []byte `json:"-" bson:"id_data_sha256"`
+
+	Status string `json:"status" bson:"status"`
+	// ID of the device in the destination tenant
+	NewDeviceId string `json:"new_device_id,omitempty" bson:"new_device_id,omitempty"`
+
+	CreatedTs time.Time `json:"created_ts" bson:"created_ts"`
+	UpdatedTs time.Time `json:"updated_ts" bson:"updated_ts"`
+}
+
+type TransferUpdate struct {
+	Status      string     `bson:"status,omitempty"`
+	NewDeviceId string     `bson:"new_device_id,omitempty"`
+	UpdatedTs   *time.Time `bson:"updated_ts,omitempty"`
+}
+
+// Pending tells if the transfer can still be completed or cancelled
+func (t *Transfer) Pending() bool {
+	return t.Status == TransferStatusPendingAcceptance ||
+		t.Status == TransferStatusPendingApproval ||
+		t.Status == TransferStatusPendingEnrollment
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SMTPConfig conveys the mail server settings used by email channels
+type SMTPConfig struct {
+	// host:port
+	Addr string
+	// PLAIN auth credentials, optional
+	Username string
+	Password string
+	// sender address
+	From string
+}
+
+type sendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// EmailChannel sends notifications as plain text mail
+type EmailChannel struct {
+	conf     SMTPConfig
+	to       []string
+	sendMail sendMailFunc
+}
+
+func NewEmailChannel(conf SMTPConfig, to []string) *EmailChannel {
+	return &EmailChannel{
+		conf:     conf,
+		to:       to,
+		sendMail: smtp.SendMail,
+	}
+}
+
+func (c *EmailChannel) Send(ctx context.Context, n Notification) error {
+	var auth smtp.Auth
+	if c.conf.Username != "" {
+		host := c.conf.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", c.conf.Username, c.conf.Password, host)
+	}
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %s\r\n", c.conf.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(c.to, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", n.Subject)
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(text(n))
+
+	// net/smtp doesn't support contexts, the deadline is not enforced
+	if err := c.sendMail(c.conf.Addr, auth, c.conf.From, c.to, msg.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to send notification mail")
+	}
+	return nil
+}
+
+// SlackChannel posts notifications to a Slack incoming webhook
+type SlackChannel struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackChannel(url string) *SlackChannel {
+	return &SlackChannel{
+		url:    url,
+		client: &http.Client{},
+	}
+}
+
+func (c *SlackChannel) Send(ctx context.Context, n Notification) error {
+	msg := map[string]string{
+		"text": "*" + n.Subject + "*\n" + text(n),
+	}
+	return post(ctx, c.client, c.url, "", msg)
+}
+
+// WebhookChannel POSTs notifications as JSON to a generic webhook
+type WebhookChannel struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookChannel(url, secret string) *WebhookChannel {
+	return &WebhookChannel{
+		url:    url,
+		secret: secret,
+		client: &http.Client{},
+	}
+}
+
+func (c *WebhookChannel) Send(ctx context.Context, n Notification) error {
+	return post(ctx, c.client, c.url, c.secret, n)
+}
+
+func post(ctx context.Context, client *http.Client, url, secret string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize notification")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create notification request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+
+	rsp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to send notification")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return errors.Errorf("notification request failed with status %v: %s",
+			rsp.Status, body)
+	}
+	return nil
+}
+
+// text renders the message followed by the sorted fields
+func text(n Notification) string {
+	buf := &bytes.Buffer{}
+	buf.WriteString(n.Message)
+
+	keys := make([]string, 0, len(n.Fields))
+	for k := range n.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if len(keys) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, k := range keys {
+		fmt.Fprintf(buf, "\n%s: %s", k, n.Fields[k])
+	}
+	return buf.String()
+}
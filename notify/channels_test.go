@@ -0,0 +1,147 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNotification = Notification{
+	Kind:     KindLimitReached,
+	TenantId: "tenant1",
+	Subject:  "Device limit reached",
+	Message:  "A device could not be accepted.",
+	Fields: map[string]string{
+		"limit":     "10",
+		"device_id": "dev1",
+	},
+	Timestamp: time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestEmailChannel(t *testing.T) {
+	t.Parallel()
+
+	c := NewEmailChannel(SMTPConfig{
+		Addr:     "mail.example.com:587",
+		Username: "user",
+		Password: "pass",
+		From:     "mender@example.com",
+	}, []string{"ops@example.com", "sec@example.com"})
+
+	c.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		assert.Equal(t, "mail.example.com:587", addr)
+		assert.NotNil(t, a)
+		assert.Equal(t, "mender@example.com", from)
+		assert.Equal(t, []string{"ops@example.com", "sec@example.com"}, to)
+		assert.Equal(t,
+			"From: mender@example.com\r\n"+
+				"To: ops@example.com, sec@example.com\r\n"+
+				"Subject: Device limit reached\r\n"+
+				"Content-Type: text/plain; charset=utf-8\r\n\r\n"+
+				"A device could not be accepted.\n\ndevice_id: dev1\nlimit: 10",
+			string(msg))
+		return nil
+	}
+	assert.NoError(t, c.Send(context.Background(), testNotification))
+
+	c.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		return errors.New("connection refused")
+	}
+	assert.EqualError(t, c.Send(context.Background(), testNotification),
+		"failed to send notification mail: connection refused")
+}
+
+func TestSlackChannel(t *testing.T) {
+	t.Parallel()
+
+	var body map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := NewSlackChannel(srv.URL)
+	assert.NoError(t, c.Send(context.Background(), testNotification))
+	assert.Equal(t, map[string]string{
+		"text": "*Device limit reached*\n" +
+			"A device could not be accepted.\n\ndevice_id: dev1\nlimit: 10",
+	}, body)
+}
+
+func TestWebhookChannel(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		secret string
+		status int
+		err    string
+	}{
+		"ok": {
+			status: http.StatusNoContent,
+		},
+		"ok, with secret": {
+			secret: "hooksecret",
+			status: http.StatusOK,
+		},
+		"error": {
+			status: http.StatusBadGateway,
+			err:    "notification request failed with status 502 Bad Gateway: oops",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var rcvd Notification
+			var auth string
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					auth = r.Header.Get("Authorization")
+					data, _ := ioutil.ReadAll(r.Body)
+					json.Unmarshal(data, &rcvd)
+					w.WriteHeader(tc.status)
+					if tc.status >= http.StatusBadRequest {
+						w.Write([]byte("oops"))
+					}
+				}))
+			defer srv.Close()
+
+			c := NewWebhookChannel(srv.URL, tc.secret)
+			err := c.Send(context.Background(), testNotification)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, testNotification, rcvd)
+			if tc.secret != "" {
+				assert.Equal(t, "Bearer "+tc.secret, auth)
+			} else {
+				assert.Empty(t, auth)
+			}
+		})
+	}
+}
@@ -11,8 +11,18 @@
 //    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 //    See the License for the specific language governing permissions and
 //    limitations under the License.
-package api
+package mocks
 
-type RequestContext struct {
-	ReqId string
+import context "context"
+import mock "github.com/stretchr/testify/mock"
+import notify "github.com/mendersoftware/deviceauth/notify"
+
+// Notifier is an autogenerated mock type for the Notifier type
+type Notifier struct {
+	mock.Mock
+}
+
+// Notify provides a mock function with given fields: ctx, n
+func (_m *Notifier) Notify(ctx context.Context, n notify.Notification) {
+	_m.Called(ctx, n)
 }
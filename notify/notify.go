@@ -0,0 +1,325 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// notification kinds
+	KindLimitReached  = "limit_reached"
+	KindSecurityAlert = "security_alert"
+	KindPendingDigest = "pending_digest"
+
+	// channel types
+	ChannelEmail   = "email"
+	ChannelSlack   = "slack"
+	ChannelWebhook = "webhook"
+
+	// default delivery timeout, per channel
+	defaultSendTimeout = time.Duration(10) * time.Second
+
+	defaultQueueSize = 1000
+	defaultRateLimit = 10
+
+	// period the rate limit applies to
+	rateLimitWindow = time.Minute
+)
+
+var (
+	ErrUnknownChannel = errors.New("unknown notification channel type")
+)
+
+// Notification is an operator alert
+type Notification struct {
+	// notification kind, one of Kind*
+	Kind string `json:"kind"`
+	// tenant the notification concerns, empty in single tenant setups
+	TenantId string `json:"tenant_id,omitempty"`
+	// short summary
+	Subject string `json:"subject"`
+	// human readable details
+	Message string `json:"message"`
+	// structured details, e.g. device ID
+	Fields map[string]string `json:"fields,omitempty"`
+	// timestamp
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Notifier delivers notifications to operators; delivery happens in the
+// background and never blocks the caller, notifications may be dropped
+// under load
+type Notifier interface {
+	Notify(ctx context.Context, n Notification)
+}
+
+// Channel is a single notification destination
+type Channel interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// ChannelConfig describes a notification channel
+type ChannelConfig struct {
+	// one of Channel*
+	Type string `json:"type"`
+	// Slack incoming webhook or generic webhook URL
+	URL string `json:"url,omitempty"`
+	// generic webhook shared secret, sent as a bearer token
+	Secret string `json:"secret,omitempty"`
+	// email recipients
+	To []string `json:"to,omitempty"`
+	// notification kinds sent to the channel, all if empty
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// Config is the notification routing configuration
+type Config struct {
+	// channels used for tenants without own configuration
+	Default []ChannelConfig `json:"default"`
+	// per tenant channels
+	Tenants map[string][]ChannelConfig `json:"tenants"`
+	// notifications queued for delivery; notifications are dropped while
+	// the queue is full
+	QueueSize int `json:"queue_size,omitempty"`
+	// notifications of a kind sent per tenant and minute, the rest are
+	// dropped
+	RateLimit int `json:"rate_limit,omitempty"`
+}
+
+// LoadConfig reads the routing configuration from a JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read notification config")
+	}
+
+	var conf Config
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, errors.Wrap(err, "failed to parse notification config")
+	}
+	if conf.QueueSize < 0 || conf.RateLimit < 0 {
+		return nil, errors.New("invalid notification config: " +
+			"queue and rate limit settings must not be negative")
+	}
+	return &conf, nil
+}
+
+type route struct {
+	channel Channel
+	kinds   map[string]bool
+}
+
+func (r route) accepts(kind string) bool {
+	return len(r.kinds) == 0 || r.kinds[kind]
+}
+
+// rate is the number of notifications of a kind sent for a tenant in the
+// current window
+type rate struct {
+	start time.Time
+	count int
+}
+
+// Dispatcher routes notifications to the channels configured for the
+// notification's tenant, one at a time, dropping the notifications over
+// the rate limit. Implements Notifier.
+type Dispatcher struct {
+	defaults []route
+	tenants  map[string][]route
+	timeout  time.Duration
+
+	queue     chan Notification
+	rateLimit int
+
+	lock  sync.Mutex
+	rates map[string]*rate
+}
+
+// NewDispatcher creates a dispatcher; email channels require the SMTP
+// settings to be configured. Notifications are queued until Run is called.
+func NewDispatcher(conf Config, smtp SMTPConfig) (*Dispatcher, error) {
+	queueSize := defaultQueueSize
+	if conf.QueueSize > 0 {
+		queueSize = conf.QueueSize
+	}
+
+	d := &Dispatcher{
+		tenants:   make(map[string][]route, len(conf.Tenants)),
+		timeout:   defaultSendTimeout,
+		queue:     make(chan Notification, queueSize),
+		rateLimit: defaultRateLimit,
+		rates:     make(map[string]*rate),
+	}
+	if conf.RateLimit > 0 {
+		d.rateLimit = conf.RateLimit
+	}
+
+	var err error
+	d.defaults, err = makeRoutes(conf.Default, smtp)
+	if err != nil {
+		return nil, err
+	}
+
+	for tenant, chans := range conf.Tenants {
+		d.tenants[tenant], err = makeRoutes(chans, smtp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "tenant %s", tenant)
+		}
+	}
+	return d, nil
+}
+
+func makeRoutes(confs []ChannelConfig, smtp SMTPConfig) ([]route, error) {
+	routes := make([]route, 0, len(confs))
+	for _, c := range confs {
+		var ch Channel
+		switch c.Type {
+		case ChannelEmail:
+			if smtp.Addr == "" {
+				return nil, errors.New("email channel requires SMTP settings")
+			}
+			if len(c.To) == 0 {
+				return nil, errors.New("email channel requires recipients")
+			}
+			ch = NewEmailChannel(smtp, c.To)
+		case ChannelSlack:
+			if c.URL == "" {
+				return nil, errors.New("slack channel requires a webhook URL")
+			}
+			ch = NewSlackChannel(c.URL)
+		case ChannelWebhook:
+			if c.URL == "" {
+				return nil, errors.New("webhook channel requires a URL")
+			}
+			ch = NewWebhookChannel(c.URL, c.Secret)
+		default:
+			return nil, errors.Wrap(ErrUnknownChannel, c.Type)
+		}
+
+		r := route{channel: ch}
+		if len(c.Kinds) > 0 {
+			r.kinds = make(map[string]bool, len(c.Kinds))
+			for _, k := range c.Kinds {
+				r.kinds[k] = true
+			}
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+func (d *Dispatcher) routes(tenant string) []route {
+	if routes, ok := d.tenants[tenant]; ok {
+		return routes
+	}
+	return d.defaults
+}
+
+// Send delivers the notification to all matching channels, returns the
+// first delivery error
+func (d *Dispatcher) Send(ctx context.Context, n Notification) error {
+	if n.Timestamp.IsZero() {
+		n.Timestamp = time.Now()
+	}
+
+	var firstErr error
+	for _, r := range d.routes(n.TenantId) {
+		if !r.accepts(n.Kind) {
+			continue
+		}
+
+		sctx, cancel := context.WithTimeout(ctx, d.timeout)
+		err := r.channel.Send(sctx, n)
+		cancel()
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// allow tells whether the notification is within the rate limit of its
+// tenant and kind, counting it if so
+func (d *Dispatcher) allow(n Notification, now time.Time) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	key := n.TenantId + "/" + n.Kind
+	r, ok := d.rates[key]
+	if !ok || now.Sub(r.start) >= rateLimitWindow {
+		// forget the windows passed, the map stays as large as the
+		// tenants and kinds notified within a window
+		for k, r := range d.rates {
+			if now.Sub(r.start) >= rateLimitWindow {
+				delete(d.rates, k)
+			}
+		}
+		r = &rate{start: now}
+		d.rates[key] = r
+	}
+
+	if r.count >= d.rateLimit {
+		return false
+	}
+	r.count++
+	return true
+}
+
+// Notify queues the notification for delivery, dropping it if over the
+// rate limit or if the queue is full
+func (d *Dispatcher) Notify(ctx context.Context, n Notification) {
+	l := log.FromContext(ctx)
+
+	if n.Timestamp.IsZero() {
+		n.Timestamp = time.Now()
+	}
+
+	if !d.allow(n, time.Now()) {
+		l.Warnf("%s notification rate limit reached, tenant: %q, dropping",
+			n.Kind, n.TenantId)
+		return
+	}
+
+	select {
+	case d.queue <- n:
+	default:
+		l.Errorf("notification queue full, dropping %s notification", n.Kind)
+	}
+}
+
+// Run delivers the queued notifications, logging failures, until the
+// context is canceled
+func (d *Dispatcher) Run(ctx context.Context) {
+	l := log.FromContext(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-d.queue:
+			if err := d.Send(ctx, n); err != nil {
+				l.Errorf("failed to send %s notification: %v", n.Kind, err)
+			}
+		}
+	}
+}
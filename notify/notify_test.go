@@ -0,0 +1,247 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package notify
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testChannel struct {
+	sent []Notification
+	err  error
+}
+
+func (c *testChannel) Send(ctx context.Context, n Notification) error {
+	c.sent = append(c.sent, n)
+	return c.err
+}
+
+func TestDispatcherSend(t *testing.T) {
+	t.Parallel()
+
+	def := &testChannel{}
+	limitsOnly := &testChannel{}
+	tenant := &testChannel{}
+	failing := &testChannel{err: errors.New("failed")}
+
+	d := &Dispatcher{
+		defaults: []route{
+			{channel: def},
+			{channel: limitsOnly, kinds: map[string]bool{KindLimitReached: true}},
+		},
+		tenants: map[string][]route{
+			"tenant1": {{channel: failing}, {channel: tenant}},
+		},
+		timeout: defaultSendTimeout,
+	}
+
+	err := d.Send(context.Background(), Notification{Kind: KindSecurityAlert})
+	assert.NoError(t, err)
+	err = d.Send(context.Background(), Notification{Kind: KindLimitReached})
+	assert.NoError(t, err)
+
+	assert.Len(t, def.sent, 2)
+	assert.Len(t, limitsOnly.sent, 1)
+	assert.Equal(t, KindLimitReached, limitsOnly.sent[0].Kind)
+	assert.False(t, def.sent[0].Timestamp.IsZero())
+
+	// tenant channels replace the defaults; a failing channel doesn't
+	// prevent delivery to the others
+	err = d.Send(context.Background(),
+		Notification{Kind: KindLimitReached, TenantId: "tenant1"})
+	assert.EqualError(t, err, "failed")
+	assert.Len(t, tenant.sent, 1)
+	assert.Len(t, failing.sent, 1)
+	assert.Len(t, def.sent, 2)
+}
+
+func TestNewDispatcher(t *testing.T) {
+	t.Parallel()
+
+	smtp := SMTPConfig{Addr: "mail:25", From: "mender@example.com"}
+
+	testCases := map[string]struct {
+		conf Config
+		smtp SMTPConfig
+		err  string
+	}{
+		"ok": {
+			conf: Config{
+				Default: []ChannelConfig{
+					{Type: ChannelWebhook, URL: "http://hook"},
+				},
+				Tenants: map[string][]ChannelConfig{
+					"tenant1": {
+						{Type: ChannelSlack, URL: "https://hooks.slack.com/x"},
+						{Type: ChannelEmail, To: []string{"ops@example.com"}},
+					},
+				},
+			},
+			smtp: smtp,
+		},
+		"unknown type": {
+			conf: Config{
+				Default: []ChannelConfig{{Type: "pager"}},
+			},
+			err: "pager: unknown notification channel type",
+		},
+		"email without smtp": {
+			conf: Config{
+				Tenants: map[string][]ChannelConfig{
+					"tenant1": {{Type: ChannelEmail, To: []string{"ops@example.com"}}},
+				},
+			},
+			err: "tenant tenant1: email channel requires SMTP settings",
+		},
+		"email without recipients": {
+			conf: Config{
+				Default: []ChannelConfig{{Type: ChannelEmail}},
+			},
+			smtp: smtp,
+			err:  "email channel requires recipients",
+		},
+		"slack without url": {
+			conf: Config{
+				Default: []ChannelConfig{{Type: ChannelSlack}},
+			},
+			err: "slack channel requires a webhook URL",
+		},
+		"webhook without url": {
+			conf: Config{
+				Default: []ChannelConfig{{Type: ChannelWebhook}},
+			},
+			err: "webhook channel requires a URL",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			d, err := NewDispatcher(tc.conf, tc.smtp)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Nil(t, d)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, d)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "notify")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "notify.json")
+	err = ioutil.WriteFile(path, []byte(`{
+		"default": [{"type": "webhook", "url": "http://hook", "kinds": ["limit_reached"]}],
+		"tenants": {"tenant1": [{"type": "email", "to": ["ops@example.com"]}]}
+	}`), 0600)
+	assert.NoError(t, err)
+
+	conf, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{
+		Default: []ChannelConfig{
+			{Type: ChannelWebhook, URL: "http://hook", Kinds: []string{KindLimitReached}},
+		},
+		Tenants: map[string][]ChannelConfig{
+			"tenant1": {{Type: ChannelEmail, To: []string{"ops@example.com"}}},
+		},
+	}, conf)
+
+	_, err = LoadConfig(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte(`foo`), 0600)
+	assert.NoError(t, err)
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte(`{"rate_limit": -1}`), 0600)
+	assert.NoError(t, err)
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+}
+
+func TestDispatcherNotify(t *testing.T) {
+	t.Parallel()
+
+	ch := &testChannel{}
+	d, err := NewDispatcher(Config{QueueSize: 3, RateLimit: 2}, SMTPConfig{})
+	assert.NoError(t, err)
+	d.defaults = []route{{channel: ch}}
+
+	ctx := context.Background()
+
+	// over the rate limit of the tenant and kind
+	for i := 0; i < 3; i++ {
+		d.Notify(ctx, Notification{Kind: KindSecurityAlert, TenantId: "tenant1"})
+	}
+	// queue full
+	d.Notify(ctx, Notification{Kind: KindLimitReached, TenantId: "tenant1"})
+	d.Notify(ctx, Notification{Kind: KindSecurityAlert, TenantId: "tenant2"})
+	assert.Len(t, d.queue, 3)
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	for len(d.queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if assert.Len(t, ch.sent, 3) {
+		assert.Equal(t, KindSecurityAlert, ch.sent[0].Kind)
+		assert.Equal(t, KindSecurityAlert, ch.sent[1].Kind)
+		assert.Equal(t, KindLimitReached, ch.sent[2].Kind)
+		assert.False(t, ch.sent[0].Timestamp.IsZero())
+	}
+}
+
+func TestDispatcherAllow(t *testing.T) {
+	t.Parallel()
+
+	d := &Dispatcher{rateLimit: 1, rates: make(map[string]*rate)}
+
+	now := time.Now()
+	alert := Notification{Kind: KindSecurityAlert, TenantId: "tenant1"}
+
+	assert.True(t, d.allow(alert, now))
+	assert.False(t, d.allow(alert, now.Add(time.Second)))
+	assert.True(t, d.allow(Notification{Kind: KindLimitReached, TenantId: "tenant1"}, now))
+	assert.True(t, d.allow(Notification{Kind: KindSecurityAlert, TenantId: "tenant2"}, now))
+
+	// next window, passed windows are forgotten
+	assert.True(t, d.allow(alert, now.Add(rateLimitWindow)))
+	assert.Len(t, d.rates, 1)
+}
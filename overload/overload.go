@@ -0,0 +1,152 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package overload
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ModeQueue makes connections over the limit wait in the listener's
+	// accept queue until a slot frees up
+	ModeQueue = "queue"
+	// ModeReject answers connections over the limit with 503 right away
+	ModeReject = "reject"
+
+	// Retry-After sent with 503 responses, in seconds
+	defaultRetryAfter = 1
+
+	rejectResponse = "HTTP/1.1 503 Service Unavailable\r\n" +
+		"Retry-After: 1\r\n" +
+		"Content-Type: application/json\r\n" +
+		"Content-Length: 30\r\n" +
+		"Connection: close\r\n\r\n" +
+		`{"error":"server overloaded"}` + "\n"
+
+	// time allowed for writing the reject response
+	rejectWriteTimeout = time.Second
+)
+
+var (
+	ErrOverloaded  = errors.New("server overloaded")
+	ErrUnknownMode = errors.New("unknown connection limit mode")
+)
+
+// ConcurrencyMiddleware rejects requests with 503 when more than Max
+// requests are already being processed
+type ConcurrencyMiddleware struct {
+	Max int
+
+	once  sync.Once
+	slots chan struct{}
+}
+
+func (mw *ConcurrencyMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	mw.once.Do(func() {
+		mw.slots = make(chan struct{}, mw.Max)
+	})
+
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		select {
+		case mw.slots <- struct{}{}:
+			defer func() { <-mw.slots }()
+			h(w, r)
+		default:
+			l := log.FromContext(r.Context())
+			w.Header().Set("Retry-After", strconv.Itoa(defaultRetryAfter))
+			rest_utils.RestErrWithWarningMsg(w, r, l, ErrOverloaded,
+				http.StatusServiceUnavailable, ErrOverloaded.Error())
+		}
+	}
+}
+
+// LimitListener returns a listener accepting at most max simultaneous
+// connections; connections over the limit are handled according to mode
+func LimitListener(l net.Listener, max int, mode string) (net.Listener, error) {
+	switch mode {
+	case ModeQueue, ModeReject:
+	default:
+		return nil, errors.Wrap(ErrUnknownMode, mode)
+	}
+
+	return &limitListener{
+		Listener: l,
+		slots:    make(chan struct{}, max),
+		reject:   mode == ModeReject,
+	}, nil
+}
+
+type limitListener struct {
+	net.Listener
+	slots  chan struct{}
+	reject bool
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		if !l.reject {
+			l.slots <- struct{}{}
+		}
+
+		c, err := l.Listener.Accept()
+		if err != nil {
+			if !l.reject {
+				<-l.slots
+			}
+			return nil, err
+		}
+
+		if l.reject {
+			select {
+			case l.slots <- struct{}{}:
+			default:
+				go rejectConn(c)
+				continue
+			}
+		}
+
+		return &limitConn{Conn: c, release: l.release}, nil
+	}
+}
+
+func (l *limitListener) release() {
+	<-l.slots
+}
+
+func rejectConn(c net.Conn) {
+	c.SetWriteDeadline(time.Now().Add(rejectWriteTimeout))
+	c.Write([]byte(rejectResponse))
+	c.Close()
+}
+
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,173 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package overload
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyMiddleware(t *testing.T) {
+	t.Parallel()
+
+	rest.ErrorFieldName = "error"
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	api := rest.NewApi()
+	api.Use(&ConcurrencyMiddleware{Max: 1})
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		if r.URL.Path == "/slow" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	h := api.MakeHandler()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	}()
+	<-entered
+
+	// the only slot is taken
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error": "server overloaded", "request_id": ""}`,
+		rec.Body.String())
+
+	close(release)
+	wg.Wait()
+
+	// and free again
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestLimitListenerBadMode(t *testing.T) {
+	t.Parallel()
+
+	_, err := LimitListener(nil, 1, "drop")
+	assert.EqualError(t, err, "drop: unknown connection limit mode")
+}
+
+func TestLimitListenerReject(t *testing.T) {
+	t.Parallel()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ln, err := LimitListener(inner, 1, ModeReject)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	c1, err := net.Dial("tcp", inner.Addr().String())
+	assert.NoError(t, err)
+	defer c1.Close()
+	s1 := <-accepted
+
+	// over the limit, rejected right away
+	c2, err := net.Dial("tcp", inner.Addr().String())
+	assert.NoError(t, err)
+	defer c2.Close()
+	rsp, err := http.ReadResponse(bufio.NewReader(c2), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, rsp.StatusCode)
+	assert.Equal(t, "1", rsp.Header.Get("Retry-After"))
+
+	// closing the first connection frees the slot
+	s1.Close()
+	s1.Close()
+
+	c3, err := net.Dial("tcp", inner.Addr().String())
+	assert.NoError(t, err)
+	defer c3.Close()
+	select {
+	case s3 := <-accepted:
+		s3.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not accepted")
+	}
+}
+
+func TestLimitListenerQueue(t *testing.T) {
+	t.Parallel()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ln, err := LimitListener(inner, 1, ModeQueue)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	c1, err := net.Dial("tcp", inner.Addr().String())
+	assert.NoError(t, err)
+	defer c1.Close()
+	s1 := <-accepted
+
+	// over the limit, waits in the backlog
+	c2, err := net.Dial("tcp", inner.Addr().String())
+	assert.NoError(t, err)
+	defer c2.Close()
+	select {
+	case <-accepted:
+		t.Fatal("connection over the limit accepted")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s1.Close()
+	select {
+	case s2 := <-accepted:
+		s2.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued connection not accepted")
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package overload
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrQueueFull    = errors.New("request queue full")
+	ErrQueueTimeout = errors.New("timed out waiting in request queue")
+)
+
+// Class is a traffic class with its own request queue
+type Class struct {
+	Name string
+	// share of freed workers given to the class when several classes
+	// have requests waiting
+	Weight int
+	// max number of waiting requests
+	QueueSize int
+}
+
+type classQueue struct {
+	Class
+	waiters []chan struct{}
+	current int
+}
+
+// Scheduler runs requests of several traffic classes on a fixed number of
+// workers. When all workers are busy requests are queued per class, and
+// freed workers are handed out to the queues by smooth weighted
+// round-robin, so that e.g. token verification of the accepted fleet is
+// served ahead of enrollment during enrollment storms.
+type Scheduler struct {
+	mu      sync.Mutex
+	free    int
+	timeout time.Duration
+	queues  map[string]*classQueue
+	order   []*classQueue
+}
+
+// NewScheduler creates a scheduler with the given number of workers;
+// requests wait in their queue for at most timeout
+func NewScheduler(workers int, timeout time.Duration, classes ...Class) *Scheduler {
+	s := &Scheduler{
+		free:    workers,
+		timeout: timeout,
+		queues:  make(map[string]*classQueue, len(classes)),
+	}
+	for _, c := range classes {
+		q := &classQueue{Class: c}
+		s.queues[c.Name] = q
+		s.order = append(s.order, q)
+	}
+	return s
+}
+
+// Acquire waits for a worker for a request of the given class. Requests of
+// unknown classes aren't scheduled. The returned function releases the
+// worker.
+func (s *Scheduler) Acquire(ctx context.Context, class string) (func(), error) {
+	s.mu.Lock()
+	q, ok := s.queues[class]
+	if !ok {
+		s.mu.Unlock()
+		return func() {}, nil
+	}
+
+	if s.free > 0 && s.idle() {
+		s.free--
+		s.mu.Unlock()
+		return s.release, nil
+	}
+
+	if len(q.waiters) >= q.QueueSize {
+		s.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	ready := make(chan struct{})
+	q.waiters = append(q.waiters, ready)
+	s.mu.Unlock()
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-ready:
+		return s.release, nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range q.waiters {
+		if w == ready {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return nil, err
+		}
+	}
+
+	// got a worker in the meantime, pass it on
+	s.releaseLocked()
+	return nil, err
+}
+
+func (s *Scheduler) idle() bool {
+	for _, q := range s.order {
+		if len(q.waiters) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked()
+}
+
+// releaseLocked hands the worker to the next waiting request, picked by
+// smooth weighted round-robin over the non-empty queues
+func (s *Scheduler) releaseLocked() {
+	var next *classQueue
+	total := 0
+	for _, q := range s.order {
+		if len(q.waiters) == 0 {
+			continue
+		}
+		q.current += q.Weight
+		total += q.Weight
+		if next == nil || q.current > next.current {
+			next = q
+		}
+	}
+
+	if next == nil {
+		s.free++
+		return
+	}
+
+	next.current -= total
+	ready := next.waiters[0]
+	next.waiters = next.waiters[1:]
+	close(ready)
+}
+
+// PriorityMiddleware schedules requests with the Scheduler; requests that
+// can't get a worker in time are rejected with 503
+type PriorityMiddleware struct {
+	Scheduler *Scheduler
+	// Classify returns the traffic class of the request
+	Classify func(r *rest.Request) string
+}
+
+func (mw *PriorityMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		done, err := mw.Scheduler.Acquire(r.Context(), mw.Classify(r))
+		if err != nil {
+			l := log.FromContext(r.Context())
+			w.Header().Set("Retry-After", strconv.Itoa(defaultRetryAfter))
+			rest_utils.RestErrWithWarningMsg(w, r, l, err,
+				http.StatusServiceUnavailable, ErrOverloaded.Error())
+			return
+		}
+		defer done()
+
+		h(w, r)
+	}
+}
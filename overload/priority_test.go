@@ -0,0 +1,165 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package overload
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/stretchr/testify/assert"
+)
+
+func queued(s *Scheduler, class string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queues[class].waiters)
+}
+
+func waitQueued(t *testing.T, s *Scheduler, class string, n int) {
+	for i := 0; i < 1000; i++ {
+		if queued(s, class) == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d requests not queued in %s", n, class)
+}
+
+func TestSchedulerWeights(t *testing.T) {
+	t.Parallel()
+
+	s := NewScheduler(1, time.Minute,
+		Class{Name: "verify", Weight: 3, QueueSize: 10},
+		Class{Name: "enroll", Weight: 1, QueueSize: 10})
+
+	done, err := s.Acquire(context.Background(), "verify")
+	assert.NoError(t, err)
+
+	type acquired struct {
+		class string
+		done  func()
+	}
+	got := make(chan acquired)
+
+	for i := 0; i < 4; i++ {
+		for _, class := range []string{"enroll", "verify"} {
+			go func(class string) {
+				done, err := s.Acquire(context.Background(), class)
+				assert.NoError(t, err)
+				got <- acquired{class, done}
+			}(class)
+			waitQueued(t, s, class, i+1)
+		}
+	}
+
+	order := []string{}
+	done()
+	for i := 0; i < 8; i++ {
+		a := <-got
+		order = append(order, a.class)
+		a.done()
+	}
+
+	assert.Equal(t, []string{
+		"verify", "verify", "enroll", "verify",
+		"verify", "enroll", "enroll", "enroll",
+	}, order)
+
+	// all workers free again
+	assert.Equal(t, 1, s.free)
+}
+
+func TestSchedulerErrors(t *testing.T) {
+	t.Parallel()
+
+	s := NewScheduler(1, 50*time.Millisecond,
+		Class{Name: "verify", Weight: 1, QueueSize: 1})
+
+	done, err := s.Acquire(context.Background(), "verify")
+	assert.NoError(t, err)
+
+	// unknown classes bypass the scheduler
+	other, err := s.Acquire(context.Background(), "other")
+	assert.NoError(t, err)
+	other()
+
+	timedOut := make(chan error)
+	go func() {
+		_, err := s.Acquire(context.Background(), "verify")
+		timedOut <- err
+	}()
+	waitQueued(t, s, "verify", 1)
+
+	_, err = s.Acquire(context.Background(), "verify")
+	assert.Equal(t, ErrQueueFull, err)
+
+	assert.Equal(t, ErrQueueTimeout, <-timedOut)
+	assert.Equal(t, 0, queued(s, "verify"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := s.Acquire(ctx, "verify")
+		canceled <- err
+	}()
+	waitQueued(t, s, "verify", 1)
+	cancel()
+	assert.Equal(t, context.Canceled, <-canceled)
+
+	done()
+	assert.Equal(t, 1, s.free)
+}
+
+func TestPriorityMiddleware(t *testing.T) {
+	t.Parallel()
+
+	rest.ErrorFieldName = "error"
+
+	s := NewScheduler(1, 10*time.Millisecond,
+		Class{Name: "enroll", Weight: 1, QueueSize: 10})
+
+	api := rest.NewApi()
+	api.Use(&PriorityMiddleware{
+		Scheduler: s,
+		Classify: func(r *rest.Request) string {
+			return r.URL.Path[1:]
+		},
+	})
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	h := api.MakeHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/enroll", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	// the only worker is busy
+	done, err := s.Acquire(context.Background(), "enroll")
+	assert.NoError(t, err)
+	defer done()
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/enroll", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/other", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mocks
+
+import context "context"
+import mock "github.com/stretchr/testify/mock"
+import revocation "github.com/mendersoftware/deviceauth/revocation"
+
+// Publisher is an autogenerated mock type for the Publisher type
+type Publisher struct {
+	mock.Mock
+}
+
+// Publish provides a mock function with given fields: ctx, e
+func (_m *Publisher) Publish(ctx context.Context, e revocation.Event) {
+	_m.Called(ctx, e)
+}
+
+// Status provides a mock function with given fields:
+func (_m *Publisher) Status() []revocation.GatewayStatus {
+	ret := _m.Called()
+
+	var r0 []revocation.GatewayStatus
+	if rf, ok := ret.Get(0).(func() []revocation.GatewayStatus); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]revocation.GatewayStatus)
+		}
+	}
+
+	return r0
+}
@@ -0,0 +1,397 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package revocation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// event kinds
+	KindTokenRevoked  = "token_revoked"
+	KindDeviceRevoked = "device_revoked"
+	KindTenantRevoked = "tenant_revoked"
+
+	// why device tokens were revoked
+	ReasonRevoked        = "revoked"
+	ReasonRejected       = "rejected"
+	ReasonDecommissioned = "decommissioned"
+	ReasonKeyRotated     = "key_rotated"
+	ReasonTransferred    = "transferred"
+	ReasonRenewed        = "renewed"
+	ReasonMaxTokens      = "max_tokens"
+	ReasonQuarantined    = "quarantined"
+
+	defaultMaxAttempts    = 8
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Duration(5) * time.Minute
+	defaultQueueSize      = 1000
+
+	// default delivery timeout, per attempt
+	defaultSendTimeout = time.Duration(10) * time.Second
+)
+
+// Event tells gateways verifying device tokens offline to stop accepting
+// the revoked tokens
+type Event struct {
+	// event kind, one of Kind*
+	Kind string `json:"kind"`
+	// tenant the tokens belong to, empty in single tenant setups
+	TenantId string `json:"tenant_id,omitempty"`
+	// revoked token's 'jti' claim, for token_revoked
+	TokenId string `json:"jti,omitempty"`
+	// device whose tokens are all revoked, the tokens' 'sub' claim, for
+	// device_revoked; the revoked token's device, if known, for
+	// token_revoked
+	DeviceId string `json:"device_id,omitempty"`
+	// one of Reason*, for device_revoked and, if known, token_revoked
+	Reason string `json:"reason,omitempty"`
+	// revocation time
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Publisher pushes revocations to gateways; delivery happens in the
+// background and never blocks the caller
+type Publisher interface {
+	Publish(ctx context.Context, e Event)
+	// delivery status, per gateway
+	Status() []GatewayStatus
+}
+
+// GatewayConfig describes a gateway callback
+type GatewayConfig struct {
+	// name used in the delivery status, defaults to the URL
+	Name string `json:"name,omitempty"`
+	// callback URL events are POSTed to
+	URL string `json:"url"`
+	// shared secret, sent as a bearer token
+	Secret string `json:"secret,omitempty"`
+}
+
+// Config is the revocation publishing configuration
+type Config struct {
+	Gateways []GatewayConfig `json:"gateways"`
+	// delivery attempts per event and gateway, the first one included
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// delay before the first retry in seconds, doubled with each retry
+	// up to max_backoff
+	InitialBackoff int `json:"initial_backoff,omitempty"`
+	MaxBackoff     int `json:"max_backoff,omitempty"`
+	// events queued per gateway; events are dropped while the queue is
+	// full, e.g. when the gateway is down for long
+	QueueSize int `json:"queue_size,omitempty"`
+}
+
+// LoadConfig reads the publishing configuration from a JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read revocation gateways config")
+	}
+
+	var conf Config
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, errors.Wrap(err, "failed to parse revocation gateways config")
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid revocation gateways config")
+	}
+	return &conf, nil
+}
+
+func (c Config) Validate() error {
+	if len(c.Gateways) == 0 {
+		return errors.New("no gateways configured")
+	}
+	names := make(map[string]bool, len(c.Gateways))
+	for _, g := range c.Gateways {
+		if g.URL == "" {
+			return errors.New("gateway requires a URL")
+		}
+		name := g.Name
+		if name == "" {
+			name = g.URL
+		}
+		if names[name] {
+			return errors.Errorf("duplicate gateway: %s", name)
+		}
+		names[name] = true
+	}
+	if c.MaxAttempts < 0 || c.InitialBackoff < 0 || c.MaxBackoff < 0 ||
+		c.QueueSize < 0 {
+		return errors.New("retry and queue settings must not be negative")
+	}
+	return nil
+}
+
+// GatewayStatus is the delivery status of a gateway
+type GatewayStatus struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// events waiting for delivery, the one being delivered included
+	Pending int `json:"pending"`
+	// events delivered
+	Delivered uint64 `json:"delivered"`
+	// events given up on after the max attempts, or rejected by the gateway
+	Failed uint64 `json:"failed"`
+	// events dropped because the queue was full
+	Dropped uint64 `json:"dropped"`
+
+	LastDeliveryTs *time.Time `json:"last_delivery_ts,omitempty"`
+	LastFailureTs  *time.Time `json:"last_failure_ts,omitempty"`
+	// last failed attempt
+	LastError string `json:"last_error,omitempty"`
+}
+
+type gateway struct {
+	conf  GatewayConfig
+	queue chan Event
+
+	// status.Pending is updated as events are queued and handled
+	lock   sync.Mutex
+	status GatewayStatus
+}
+
+// Dispatcher delivers events to all configured gateways, in order, retrying
+// failed deliveries with exponential backoff. Implements Publisher.
+type Dispatcher struct {
+	gateways []*gateway
+	client   *http.Client
+
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	timeout        time.Duration
+}
+
+// NewDispatcher creates a dispatcher; events are queued until Run is called
+func NewDispatcher(conf Config) (*Dispatcher, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	d := &Dispatcher{
+		client:         &http.Client{},
+		maxAttempts:    defaultMaxAttempts,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		timeout:        defaultSendTimeout,
+	}
+	if conf.MaxAttempts > 0 {
+		d.maxAttempts = conf.MaxAttempts
+	}
+	if conf.InitialBackoff > 0 {
+		d.initialBackoff = time.Duration(conf.InitialBackoff) * time.Second
+	}
+	if conf.MaxBackoff > 0 {
+		d.maxBackoff = time.Duration(conf.MaxBackoff) * time.Second
+	}
+
+	queueSize := defaultQueueSize
+	if conf.QueueSize > 0 {
+		queueSize = conf.QueueSize
+	}
+
+	for _, c := range conf.Gateways {
+		if c.Name == "" {
+			c.Name = c.URL
+		}
+		d.gateways = append(d.gateways, &gateway{
+			conf:  c,
+			queue: make(chan Event, queueSize),
+			status: GatewayStatus{
+				Name: c.Name,
+				URL:  c.URL,
+			},
+		})
+	}
+	return d, nil
+}
+
+// Publish queues the event for delivery to all gateways
+func (d *Dispatcher) Publish(ctx context.Context, e Event) {
+	l := log.FromContext(ctx)
+
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	for _, g := range d.gateways {
+		g.lock.Lock()
+		select {
+		case g.queue <- e:
+			g.status.Pending++
+			g.lock.Unlock()
+		default:
+			g.status.Dropped++
+			g.lock.Unlock()
+
+			l.Errorf("revocation queue of gateway %s full, dropping %s event",
+				g.conf.Name, e.Kind)
+		}
+	}
+}
+
+// Run delivers the queued events until the context is canceled
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, g := range d.gateways {
+		wg.Add(1)
+		go func(g *gateway) {
+			defer wg.Done()
+			d.run(ctx, g)
+		}(g)
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) run(ctx context.Context, g *gateway) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-g.queue:
+			d.deliver(ctx, g, e)
+		}
+	}
+}
+
+// deliver sends the event to the gateway, retrying until it succeeds, the
+// gateway rejects it or the attempts run out
+func (d *Dispatcher) deliver(ctx context.Context, g *gateway, e Event) {
+	l := log.FromContext(ctx)
+
+	defer func() {
+		g.lock.Lock()
+		g.status.Pending--
+		g.lock.Unlock()
+	}()
+
+	backoff := d.initialBackoff
+	for attempt := 1; ; attempt++ {
+		sctx, cancel := context.WithTimeout(ctx, d.timeout)
+		err := d.send(sctx, g.conf, e)
+		cancel()
+
+		now := time.Now()
+		if err == nil {
+			g.lock.Lock()
+			g.status.Delivered++
+			g.status.LastDeliveryTs = &now
+			g.lock.Unlock()
+			return
+		}
+
+		g.lock.Lock()
+		g.status.LastFailureTs = &now
+		g.status.LastError = err.Error()
+		giveUp := !retriable(err) || attempt >= d.maxAttempts
+		if giveUp {
+			g.status.Failed++
+		}
+		g.lock.Unlock()
+
+		if giveUp {
+			l.Errorf("failed to deliver %s event to gateway %s after %d attempts: %v",
+				e.Kind, g.conf.Name, attempt, err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+}
+
+// statusError is a delivery refused by the gateway
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// retriable tells whether a failed delivery is worth another attempt;
+// client errors, besides timeouts and throttling, are not
+func retriable(err error) bool {
+	serr, ok := err.(*statusError)
+	if !ok {
+		return true
+	}
+	return serr.code >= http.StatusInternalServerError ||
+		serr.code == http.StatusRequestTimeout ||
+		serr.code == http.StatusTooManyRequests
+}
+
+func (d *Dispatcher) send(ctx context.Context, g GatewayConfig, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize revocation event")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.URL, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create revocation request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.Secret != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Secret)
+	}
+
+	rsp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to send revocation event")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return &statusError{
+			code: rsp.StatusCode,
+			msg: "revocation request failed with status " +
+				rsp.Status + ": " + string(body),
+		}
+	}
+	return nil
+}
+
+// Status returns the delivery status of the gateways, in configuration
+// order
+func (d *Dispatcher) Status() []GatewayStatus {
+	res := make([]GatewayStatus, 0, len(d.gateways))
+	for _, g := range d.gateways {
+		g.lock.Lock()
+		res = append(res, g.status)
+		g.lock.Unlock()
+	}
+	return res
+}
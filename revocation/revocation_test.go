@@ -0,0 +1,234 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testGateway records the events POSTed to it, failing with the given
+// statuses first
+type testGateway struct {
+	lock     sync.Mutex
+	events   []Event
+	auth     []string
+	statuses []int
+}
+
+func (g *testGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.auth = append(g.auth, r.Header.Get("Authorization"))
+	if len(g.statuses) > 0 {
+		code := g.statuses[0]
+		g.statuses = g.statuses[1:]
+		w.WriteHeader(code)
+		return
+	}
+
+	var e Event
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	g.events = append(g.events, e)
+}
+
+func (g *testGateway) attempts() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return len(g.auth)
+}
+
+func makeTestDispatcher(t *testing.T, conf Config) *Dispatcher {
+	d, err := NewDispatcher(conf)
+	assert.NoError(t, err)
+	d.initialBackoff = time.Millisecond
+	d.maxBackoff = 2 * time.Millisecond
+	return d
+}
+
+func TestDispatcherDeliver(t *testing.T) {
+	t.Parallel()
+
+	ok := &testGateway{}
+	okSrv := httptest.NewServer(ok)
+	defer okSrv.Close()
+
+	flaky := &testGateway{
+		statuses: []int{
+			http.StatusServiceUnavailable,
+			http.StatusTooManyRequests,
+		},
+	}
+	flakySrv := httptest.NewServer(flaky)
+	defer flakySrv.Close()
+
+	refusing := &testGateway{statuses: []int{http.StatusForbidden}}
+	refusingSrv := httptest.NewServer(refusing)
+	defer refusingSrv.Close()
+
+	down := &testGateway{statuses: []int{500, 500, 500, 500}}
+	downSrv := httptest.NewServer(down)
+	defer downSrv.Close()
+
+	d := makeTestDispatcher(t, Config{
+		Gateways: []GatewayConfig{
+			{Name: "ok", URL: okSrv.URL, Secret: "secret"},
+			{URL: flakySrv.URL},
+			{Name: "refusing", URL: refusingSrv.URL},
+			{Name: "down", URL: downSrv.URL},
+		},
+		MaxAttempts: 3,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := Event{
+		Kind:     KindDeviceRevoked,
+		TenantId: "tenant1",
+		DeviceId: "dev1",
+		Reason:   ReasonRejected,
+	}
+	d.Publish(ctx, e)
+
+	go d.Run(ctx)
+
+	// wait for all deliveries to finish
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		pending := 0
+		for _, s := range d.Status() {
+			pending += s.Pending
+		}
+		if pending == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	status := d.Status()
+	assert.Len(t, status, 4)
+
+	assert.Len(t, ok.events, 1)
+	assert.Equal(t, []string{"Bearer secret"}, ok.auth)
+	assert.Equal(t, e.DeviceId, ok.events[0].DeviceId)
+	assert.Equal(t, e.Reason, ok.events[0].Reason)
+	assert.False(t, ok.events[0].Timestamp.IsZero())
+	assert.Equal(t, uint64(1), status[0].Delivered)
+	assert.NotNil(t, status[0].LastDeliveryTs)
+	assert.Nil(t, status[0].LastFailureTs)
+
+	// retried until delivered
+	assert.Len(t, flaky.events, 1)
+	assert.Equal(t, []string{"", "", ""}, flaky.auth)
+	assert.Equal(t, flakySrv.URL, status[1].Name)
+	assert.Equal(t, uint64(1), status[1].Delivered)
+	assert.Equal(t, uint64(0), status[1].Failed)
+	assert.NotNil(t, status[1].LastFailureTs)
+
+	// client errors are not retried
+	assert.Equal(t, 1, refusing.attempts())
+	assert.Equal(t, uint64(1), status[2].Failed)
+	assert.Contains(t, status[2].LastError, "403")
+
+	// given up after max attempts
+	assert.Equal(t, 3, down.attempts())
+	assert.Equal(t, uint64(0), status[3].Delivered)
+	assert.Equal(t, uint64(1), status[3].Failed)
+	assert.Contains(t, status[3].LastError, "500")
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	t.Parallel()
+
+	d := makeTestDispatcher(t, Config{
+		Gateways:  []GatewayConfig{{URL: "http://gateway"}},
+		QueueSize: 2,
+	})
+
+	for i := 0; i < 3; i++ {
+		d.Publish(context.Background(), Event{Kind: KindTenantRevoked})
+	}
+
+	status := d.Status()
+	assert.Equal(t, 2, status[0].Pending)
+	assert.Equal(t, uint64(1), status[0].Dropped)
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		data string
+		err  string
+	}{
+		"ok": {
+			data: `{"gateways": [{"name": "edge", "url": "https://edge/revoked"}],
+				"max_attempts": 5}`,
+		},
+		"no gateways": {
+			data: `{"gateways": []}`,
+			err:  "invalid revocation gateways config: no gateways configured",
+		},
+		"no url": {
+			data: `{"gateways": [{"name": "edge"}]}`,
+			err:  "invalid revocation gateways config: gateway requires a URL",
+		},
+		"duplicate": {
+			data: `{"gateways": [{"url": "https://edge"}, {"url": "https://edge"}]}`,
+			err:  "invalid revocation gateways config: duplicate gateway: https://edge",
+		},
+		"negative": {
+			data: `{"gateways": [{"url": "https://edge"}], "queue_size": -1}`,
+			err:  "invalid revocation gateways config: retry and queue settings must not be negative",
+		},
+		"bad json": {
+			data: `{"gateways":`,
+			err:  "failed to parse revocation gateways config: unexpected end of JSON input",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "revocation")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".json")
+			assert.NoError(t, ioutil.WriteFile(path, []byte(tc.data), 0600))
+
+			conf, err := LoadConfig(path)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "edge", conf.Gateways[0].Name)
+				assert.Equal(t, 5, conf.MaxAttempts)
+			}
+		})
+	}
+}
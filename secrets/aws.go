@@ -0,0 +1,233 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	awsService     = "secretsmanager"
+	awsContentType = "application/x-amz-json-1.1"
+	awsTarget      = "secretsmanager.GetSecretValue"
+	awsAlgorithm   = "AWS4-HMAC-SHA256"
+	awsTimeFormat  = "20060102T150405Z"
+	awsDateFormat  = "20060102"
+)
+
+// AWSConfig conveys AWS Secrets Manager provider configuration
+type AWSConfig struct {
+	Region          string
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	// Secrets Manager endpoint, defaults to the regional endpoint
+	Endpoint string
+	// Request timeout
+	Timeout time.Duration
+}
+
+// AWSConfigFromEnv reads AWS configuration from the standard AWS_REGION,
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+// variables
+func AWSConfigFromEnv() AWSConfig {
+	return AWSConfig{
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// AWSProvider reads secrets from AWS Secrets Manager, awssm://<name>[#<key>];
+// if a key is given, the secret string is expected to be a JSON object and
+// the value of the key is returned
+type AWSProvider struct {
+	conf AWSConfig
+	now  func() time.Time
+}
+
+func NewAWSProvider(c AWSConfig) *AWSProvider {
+	if c.Endpoint == "" && c.Region != "" {
+		c.Endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com/",
+			awsService, c.Region)
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultReqTimeout
+	}
+
+	return &AWSProvider{
+		conf: c,
+		now:  time.Now,
+	}
+}
+
+func (p *AWSProvider) GetSecret(ctx context.Context, ref *url.URL) ([]byte, error) {
+	if p.conf.Endpoint == "" {
+		return nil, errors.New("aws region not configured")
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"SecretId": strings.Trim(ref.Host+ref.Path, "/"),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode request")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.conf.Endpoint,
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", awsContentType)
+	req.Header.Set("X-Amz-Target", awsTarget)
+
+	p.sign(req, body)
+
+	ctx, cancel := context.WithTimeout(ctx, p.conf.Timeout)
+	defer cancel()
+
+	rsp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get secret value")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type string `json:"__type"`
+		}
+		_ = json.NewDecoder(rsp.Body).Decode(&apiErr)
+		if strings.HasSuffix(apiErr.Type, "ResourceNotFoundException") {
+			return nil, ErrSecretNotFound
+		}
+		return nil, errors.Errorf("getting secret value failed with status %v %s",
+			rsp.Status, apiErr.Type)
+	}
+
+	var secret struct {
+		SecretString *string `json:"SecretString"`
+		SecretBinary *string `json:"SecretBinary"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&secret); err != nil {
+		return nil, errors.Wrap(err, "failed to decode secret")
+	}
+
+	var data []byte
+	switch {
+	case secret.SecretString != nil:
+		data = []byte(*secret.SecretString)
+	case secret.SecretBinary != nil:
+		data, err = base64.StdEncoding.DecodeString(*secret.SecretBinary)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode secret value")
+		}
+	}
+
+	if ref.Fragment == "" {
+		return data, nil
+	}
+
+	var kv map[string]interface{}
+	if err := json.Unmarshal(data, &kv); err != nil {
+		return nil, errors.Wrap(err, "secret is not a key/value secret")
+	}
+
+	return selectKey(kv, ref.Fragment)
+}
+
+// sign adds AWS signature version 4 headers to the request
+func (p *AWSProvider) sign(req *http.Request, body []byte) {
+	now := p.now().UTC()
+	amzDate := now.Format(awsTimeFormat)
+	date := now.Format(awsDateFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.conf.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.conf.SessionToken)
+	}
+
+	headers := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if p.conf.SessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+
+	var canonHeaders strings.Builder
+	for _, h := range headers {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonReq := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, p.conf.Region, awsService, "aws4_request"}, "/")
+
+	toSign := strings.Join([]string{
+		awsAlgorithm,
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonReq)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+p.conf.SecretAccessKey), date)
+	key = hmacSHA256(key, p.conf.Region)
+	key = hmacSHA256(key, awsService)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsAlgorithm, p.conf.AccessKeyId, scope, signedHeaders,
+		hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
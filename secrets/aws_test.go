@@ -0,0 +1,116 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	ct "github.com/mendersoftware/deviceauth/client/testing"
+)
+
+func TestAWSProviderGetSecret(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		status int
+		body   string
+		ref    string
+
+		res string
+		err string
+	}{
+		"ok, string": {
+			status: http.StatusOK,
+			body:   `{"Name": "deviceauth/mongo", "SecretString": "foo"}`,
+			ref:    "awssm://deviceauth/mongo",
+			res:    "foo",
+		},
+		"ok, key": {
+			status: http.StatusOK,
+			body:   `{"Name": "deviceauth/mongo", "SecretString": "{\"password\": \"bar\"}"}`,
+			ref:    "awssm://deviceauth/mongo#password",
+			res:    "bar",
+		},
+		"ok, binary": {
+			status: http.StatusOK,
+			body:   `{"Name": "deviceauth/mongo", "SecretBinary": "YmF6"}`,
+			ref:    "awssm://deviceauth/mongo",
+			res:    "baz",
+		},
+		"error, not key/value": {
+			status: http.StatusOK,
+			body:   `{"Name": "deviceauth/mongo", "SecretString": "foo"}`,
+			ref:    "awssm://deviceauth/mongo#password",
+			err:    "secret is not a key/value secret: invalid character 'o' in literal false (expecting 'a')",
+		},
+		"error, not found": {
+			status: http.StatusBadRequest,
+			body:   `{"__type": "ResourceNotFoundException", "Message": "not found"}`,
+			ref:    "awssm://deviceauth/mongo",
+			err:    "secret not found",
+		},
+		"error, other": {
+			status: http.StatusBadRequest,
+			body:   `{"__type": "AccessDeniedException"}`,
+			ref:    "awssm://deviceauth/mongo",
+			err:    "getting secret value failed with status 400 Bad Request AccessDeniedException",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, rd := ct.NewMockServer(tc.status, []byte(tc.body))
+			defer s.Close()
+
+			p := NewAWSProvider(AWSConfig{
+				Region:          "eu-west-1",
+				AccessKeyId:     "AKIDEXAMPLE",
+				SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+				Endpoint:        s.URL + "/",
+			})
+			p.now = func() time.Time {
+				return time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+			}
+
+			ref, _ := url.Parse(tc.ref)
+			res, err := p.GetSecret(context.Background(), ref)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.res, string(res))
+
+			var req map[string]string
+			assert.NoError(t, json.Unmarshal(rd.ReqBody, &req))
+			assert.Equal(t, "deviceauth/mongo", req["SecretId"])
+
+			assert.Equal(t, "secretsmanager.GetSecretValue",
+				rd.Headers.Get("X-Amz-Target"))
+			assert.Equal(t, "20181001T120000Z", rd.Headers.Get("X-Amz-Date"))
+			assert.Regexp(t,
+				"^AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20181001/eu-west-1/secretsmanager/aws4_request, "+
+					"SignedHeaders=content-type;host;x-amz-date;x-amz-target, Signature=[0-9a-f]{64}$",
+				rd.Headers.Get("Authorization"))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	GCPSecretManagerAddr = "https://secretmanager.googleapis.com"
+	GCPMetadataTokenURL  = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// GCPConfig conveys GCP Secret Manager provider configuration
+type GCPConfig struct {
+	// Secret Manager API address
+	Addr string
+	// Static OAuth2 access token; if not set, a token for the default service
+	// account is obtained from the metadata server
+	AccessToken string
+	// Metadata server token endpoint
+	MetadataTokenURL string
+	// Request timeout
+	Timeout time.Duration
+}
+
+// GCPConfigFromEnv reads GCP configuration from the environment; a static
+// access token can be provided in GOOGLE_OAUTH_ACCESS_TOKEN
+func GCPConfigFromEnv() GCPConfig {
+	return GCPConfig{
+		AccessToken: os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"),
+	}
+}
+
+// GCPProvider reads secrets from GCP Secret Manager,
+// gcpsm://projects/<project>/secrets/<secret>/versions/<version>
+type GCPProvider struct {
+	conf GCPConfig
+}
+
+func NewGCPProvider(c GCPConfig) *GCPProvider {
+	if c.Addr == "" {
+		c.Addr = GCPSecretManagerAddr
+	}
+	if c.MetadataTokenURL == "" {
+		c.MetadataTokenURL = GCPMetadataTokenURL
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultReqTimeout
+	}
+
+	return &GCPProvider{
+		conf: c,
+	}
+}
+
+func (p *GCPProvider) GetSecret(ctx context.Context, ref *url.URL) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.conf.Timeout)
+	defer cancel()
+
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.Trim(ref.Host+ref.Path, "/")
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	req, err := http.NewRequest(http.MethodGet,
+		strings.TrimRight(p.conf.Addr, "/")+"/v1/"+name+":access", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rsp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to access secret")
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrSecretNotFound
+	default:
+		return nil, errors.Errorf("accessing secret failed with status %v",
+			rsp.Status)
+	}
+
+	var secret struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&secret); err != nil {
+		return nil, errors.Wrap(err, "failed to decode secret")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(secret.Payload.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode secret payload")
+	}
+
+	return data, nil
+}
+
+func (p *GCPProvider) accessToken(ctx context.Context) (string, error) {
+	if p.conf.AccessToken != "" {
+		return p.conf.AccessToken, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.conf.MetadataTokenURL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	rsp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to obtain access token")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("obtaining access token failed with status %v",
+			rsp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&token); err != nil {
+		return "", errors.Wrap(err, "failed to decode access token")
+	}
+
+	return token.AccessToken, nil
+}
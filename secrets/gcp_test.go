@@ -0,0 +1,99 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ct "github.com/mendersoftware/deviceauth/client/testing"
+)
+
+func TestGCPProviderGetSecret(t *testing.T) {
+	t.Parallel()
+
+	tokSrv, tokRd := ct.NewMockServer(http.StatusOK,
+		[]byte(`{"access_token": "metadatatoken", "expires_in": 3599}`))
+	defer tokSrv.Close()
+
+	testCases := map[string]struct {
+		status      int
+		body        string
+		ref         string
+		accessToken string
+
+		path  string
+		token string
+		res   string
+		err   string
+	}{
+		"ok": {
+			status:      http.StatusOK,
+			body:        `{"payload": {"data": "Zm9v"}}`,
+			ref:         "gcpsm://projects/p/secrets/s/versions/3",
+			accessToken: "statictoken",
+
+			path:  "/v1/projects/p/secrets/s/versions/3:access",
+			token: "statictoken",
+			res:   "foo",
+		},
+		"ok, latest, metadata token": {
+			status: http.StatusOK,
+			body:   `{"payload": {"data": "YmFy"}}`,
+			ref:    "gcpsm://projects/p/secrets/s",
+
+			path:  "/v1/projects/p/secrets/s/versions/latest:access",
+			token: "metadatatoken",
+			res:   "bar",
+		},
+		"error, not found": {
+			status:      http.StatusNotFound,
+			ref:         "gcpsm://projects/p/secrets/s",
+			accessToken: "statictoken",
+			err:         "secret not found",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, rd := ct.NewMockServer(tc.status, []byte(tc.body))
+			defer s.Close()
+
+			p := NewGCPProvider(GCPConfig{
+				Addr:             s.URL,
+				AccessToken:      tc.accessToken,
+				MetadataTokenURL: tokSrv.URL,
+			})
+
+			ref, _ := url.Parse(tc.ref)
+			res, err := p.GetSecret(context.Background(), ref)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.res, string(res))
+			assert.Equal(t, tc.path, rd.Url.Path)
+			assert.Equal(t, "Bearer "+tc.token, rd.Headers.Get("Authorization"))
+			if tc.accessToken == "" {
+				assert.Equal(t, "Google", tokRd.Headers.Get("Metadata-Flavor"))
+			}
+		})
+	}
+}
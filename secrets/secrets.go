@@ -0,0 +1,198 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown secret provider")
+	ErrSecretNotFound  = errors.New("secret not found")
+)
+
+// Provider fetches secret values from a single backend; the reference URL
+// scheme selects the provider, the rest of the URL is provider specific.
+type Provider interface {
+	GetSecret(ctx context.Context, ref *url.URL) ([]byte, error)
+}
+
+// Resolver resolves secret references of the form <scheme>://<location>,
+// e.g.:
+//
+//	file:///etc/deviceauth/rsa/private.pem
+//	env://MONGO_PASSWORD
+//	vault://secret/data/deviceauth#mongo_password
+//	awssm://deviceauth/mongo#password
+//	gcpsm://projects/my-project/secrets/mongo-password/versions/latest
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver returns a resolver with all builtin providers registered;
+// the remote providers are configured from their standard environment
+// variables (see NewVaultProvider, NewAWSProvider, NewGCPProvider)
+func NewResolver() *Resolver {
+	r := &Resolver{
+		providers: map[string]Provider{},
+	}
+
+	r.Register("file", FileProvider{})
+	r.Register("env", EnvProvider{})
+	r.Register("vault", NewVaultProvider(VaultConfigFromEnv()))
+	r.Register("awssm", NewAWSProvider(AWSConfigFromEnv()))
+	r.Register("gcpsm", NewGCPProvider(GCPConfigFromEnv()))
+
+	return r
+}
+
+// Register adds (or replaces) a provider for given reference scheme
+func (r *Resolver) Register(scheme string, p Provider) {
+	r.providers[scheme] = p
+}
+
+// IsRef checks if the value is a reference to a secret handled by one of the
+// registered providers; plain values are left as is
+func (r *Resolver) IsRef(value string) bool {
+	idx := strings.Index(value, "://")
+	if idx <= 0 {
+		return false
+	}
+
+	_, ok := r.providers[value[:idx]]
+	return ok
+}
+
+// Resolve fetches the secret referenced by value
+func (r *Resolver) Resolve(ctx context.Context, value string) ([]byte, error) {
+	ref, err := url.Parse(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed secret reference")
+	}
+
+	p, ok := r.providers[ref.Scheme]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownProvider, "scheme %q", ref.Scheme)
+	}
+
+	secret, err := p.GetSecret(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch secret from %s provider",
+			ref.Scheme)
+	}
+
+	return secret, nil
+}
+
+// ResolveString resolves the value if it is a secret reference, otherwise
+// the value is returned unchanged
+func (r *Resolver) ResolveString(ctx context.Context, value string) (string, error) {
+	if !r.IsRef(value) {
+		return value, nil
+	}
+
+	secret, err := r.Resolve(ctx, value)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(secret), "\r\n"), nil
+}
+
+// Watch periodically re-fetches the referenced secret and calls onChange
+// every time its value changes. The initial value is expected to have been
+// fetched by the caller and is passed as current. Fetch errors are logged
+// and the previous value is retained. Watch blocks until ctx is done.
+func (r *Resolver) Watch(ctx context.Context, value string, current []byte,
+	interval time.Duration, onChange func([]byte) error) {
+
+	l := log.FromContext(ctx)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		secret, err := r.Resolve(ctx, value)
+		if err != nil {
+			l.Errorf("failed to refresh secret: %v", err)
+			continue
+		}
+
+		if bytes.Equal(secret, current) {
+			continue
+		}
+
+		if err := onChange(secret); err != nil {
+			l.Errorf("failed to apply refreshed secret: %v", err)
+			continue
+		}
+
+		current = secret
+	}
+}
+
+// FileProvider reads secrets from local files, file:///path/to/secret
+type FileProvider struct{}
+
+func (FileProvider) GetSecret(ctx context.Context, ref *url.URL) ([]byte, error) {
+	data, err := ioutil.ReadFile(ref.Path)
+	if os.IsNotExist(err) {
+		return nil, ErrSecretNotFound
+	}
+	return data, err
+}
+
+// EnvProvider reads secrets from environment variables, env://VARIABLE
+type EnvProvider struct{}
+
+func (EnvProvider) GetSecret(ctx context.Context, ref *url.URL) ([]byte, error) {
+	val, ok := os.LookupEnv(ref.Host)
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	return []byte(val), nil
+}
+
+// selectKey extracts the value of a single key from a JSON encoded secret
+// (as used by AWS secrets manager's key/value secrets and vault KV); a missing
+// key, including an empty one, is ErrSecretNotFound, callers wanting the whole
+// secret don't select a key
+func selectKey(data map[string]interface{}, key string) ([]byte, error) {
+	v, ok := data[key]
+	if !ok {
+		return nil, errors.Wrapf(ErrSecretNotFound, "key %q", key)
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.Errorf("value of key %q is not a string", key)
+	}
+
+	return []byte(s), nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticProvider struct {
+	values [][]byte
+	calls  int
+}
+
+func (p *staticProvider) GetSecret(ctx context.Context, ref *url.URL) ([]byte, error) {
+	if p.calls >= len(p.values) {
+		return nil, errors.New("no more values")
+	}
+	v := p.values[p.calls]
+	p.calls++
+	if v == nil {
+		return nil, errors.New("failed")
+	}
+	return v, nil
+}
+
+func TestResolverIsRef(t *testing.T) {
+	t.Parallel()
+
+	r := NewResolver()
+
+	testCases := map[string]bool{
+		"file:///etc/secret":                 true,
+		"env://FOO":                          true,
+		"vault://secret/data/foo#bar":        true,
+		"awssm://foo/bar#baz":                true,
+		"gcpsm://projects/p/secrets/s":       true,
+		"mongodb://mongo-device-auth":        false,
+		"http://tenantadm":                   false,
+		"/etc/deviceauth/rsa/private.pem":    false,
+		"plain password with :// in it, ok?": false,
+		"":                                   false,
+	}
+
+	for value, isRef := range testCases {
+		assert.Equal(t, isRef, r.IsRef(value), value)
+	}
+}
+
+func TestResolverResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	secretPath := filepath.Join(dir, "secret")
+	assert.NoError(t, ioutil.WriteFile(secretPath, []byte("s3cr3t\n"), 0600))
+
+	os.Setenv("DEVICEAUTH_TEST_SECRET", "envs3cr3t")
+	defer os.Unsetenv("DEVICEAUTH_TEST_SECRET")
+
+	testCases := map[string]struct {
+		value string
+
+		res string
+		err string
+	}{
+		"file": {
+			value: "file://" + secretPath,
+			res:   "s3cr3t",
+		},
+		"file, not found": {
+			value: "file://" + filepath.Join(dir, "missing"),
+			err:   "failed to fetch secret from file provider: secret not found",
+		},
+		"env": {
+			value: "env://DEVICEAUTH_TEST_SECRET",
+			res:   "envs3cr3t",
+		},
+		"env, not found": {
+			value: "env://DEVICEAUTH_TEST_MISSING",
+			err:   "failed to fetch secret from env provider: secret not found",
+		},
+		"not a reference": {
+			value: "plain",
+			res:   "plain",
+		},
+	}
+
+	r := NewResolver()
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			res, err := r.ResolveString(context.Background(), tc.value)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.res, res)
+			}
+		})
+	}
+
+	_, err = r.Resolve(context.Background(), "foo://bar")
+	assert.EqualError(t, err, `scheme "foo": unknown secret provider`)
+}
+
+func TestResolverWatch(t *testing.T) {
+	t.Parallel()
+
+	p := &staticProvider{
+		values: [][]byte{
+			[]byte("v1"),
+			nil,
+			[]byte("v2"),
+			[]byte("v2"),
+			[]byte("v3"),
+		},
+	}
+
+	r := &Resolver{providers: map[string]Provider{}}
+	r.Register("test", p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var changes []string
+	done := make(chan struct{})
+
+	go func() {
+		r.Watch(ctx, "test://foo", []byte("v1"), time.Millisecond,
+			func(v []byte) error {
+				changes = append(changes, string(v))
+				if len(changes) == 2 {
+					cancel()
+				}
+				return nil
+			})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not finish")
+	}
+
+	assert.Equal(t, []string{"v2", "v3"}, changes)
+}
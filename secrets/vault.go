@@ -0,0 +1,120 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// default request timeout for remote secret providers
+	defaultReqTimeout = time.Duration(10) * time.Second
+)
+
+// VaultConfig conveys Vault KV provider configuration
+type VaultConfig struct {
+	// Vault server address, e.g. https://vault:8200
+	Addr string
+	// Vault access token
+	Token string
+	// Request timeout
+	Timeout time.Duration
+}
+
+// VaultConfigFromEnv reads Vault configuration from the standard VAULT_ADDR
+// and VAULT_TOKEN environment variables
+func VaultConfigFromEnv() VaultConfig {
+	return VaultConfig{
+		Addr:  os.Getenv("VAULT_ADDR"),
+		Token: os.Getenv("VAULT_TOKEN"),
+	}
+}
+
+// VaultProvider reads secrets from Vault KV secrets engine (both v1 and v2),
+// vault://<path>#<key>, where path includes the mount point, e.g.
+// vault://secret/data/deviceauth#mongo_password
+type VaultProvider struct {
+	conf VaultConfig
+}
+
+func NewVaultProvider(c VaultConfig) *VaultProvider {
+	if c.Timeout == 0 {
+		c.Timeout = defaultReqTimeout
+	}
+
+	return &VaultProvider{
+		conf: c,
+	}
+}
+
+func (p *VaultProvider) GetSecret(ctx context.Context, ref *url.URL) ([]byte, error) {
+	if p.conf.Addr == "" {
+		return nil, errors.New("vault address not configured")
+	}
+
+	if ref.Fragment == "" {
+		return nil, errors.New("vault secret reference must name a key")
+	}
+
+	path := strings.Trim(ref.Host+ref.Path, "/")
+
+	req, err := http.NewRequest(http.MethodGet,
+		strings.TrimRight(p.conf.Addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("X-Vault-Token", p.conf.Token)
+
+	ctx, cancel := context.WithTimeout(ctx, p.conf.Timeout)
+	defer cancel()
+
+	rsp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read secret")
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrSecretNotFound
+	default:
+		return nil, errors.Errorf("reading secret failed with status %v",
+			rsp.Status)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&secret); err != nil {
+		return nil, errors.Wrap(err, "failed to decode secret")
+	}
+
+	// KV v2 nests the actual secret data and metadata
+	if nested, ok := secret.Data["data"].(map[string]interface{}); ok {
+		if _, ok := secret.Data["metadata"]; ok {
+			return selectKey(nested, ref.Fragment)
+		}
+	}
+
+	return selectKey(secret.Data, ref.Fragment)
+}
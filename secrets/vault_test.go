@@ -0,0 +1,95 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ct "github.com/mendersoftware/deviceauth/client/testing"
+)
+
+func TestVaultProviderGetSecret(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		status int
+		body   string
+		ref    string
+
+		res string
+		err string
+	}{
+		"ok, kv v2": {
+			status: http.StatusOK,
+			body:   `{"data": {"data": {"password": "foo"}, "metadata": {"version": 1}}}`,
+			ref:    "vault://secret/data/deviceauth#password",
+			res:    "foo",
+		},
+		"ok, kv v1": {
+			status: http.StatusOK,
+			body:   `{"data": {"password": "bar"}}`,
+			ref:    "vault://kv/deviceauth#password",
+			res:    "bar",
+		},
+		"error, no key": {
+			status: http.StatusOK,
+			body:   `{"data": {"password": "bar"}}`,
+			ref:    "vault://kv/deviceauth#username",
+			err:    `key "username": secret not found`,
+		},
+		"error, key not given": {
+			ref: "vault://kv/deviceauth",
+			err: "vault secret reference must name a key",
+		},
+		"error, not found": {
+			status: http.StatusNotFound,
+			ref:    "vault://kv/deviceauth#password",
+			err:    "secret not found",
+		},
+		"error, forbidden": {
+			status: http.StatusForbidden,
+			ref:    "vault://kv/deviceauth#password",
+			err:    "reading secret failed with status 403 Forbidden",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, rd := ct.NewMockServer(tc.status, []byte(tc.body))
+			defer s.Close()
+
+			p := NewVaultProvider(VaultConfig{
+				Addr:  s.URL,
+				Token: "token",
+			})
+
+			ref, _ := url.Parse(tc.ref)
+			res, err := p.GetSecret(context.Background(), ref)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.res, string(res))
+			assert.Equal(t, "/v1/"+ref.Host+ref.Path, rd.Url.Path)
+			assert.Equal(t, "token", rd.Headers.Get("X-Vault-Token"))
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// VaultTransitSigner signs device tokens with a key in Vault's transit
+// secrets engine, so that the private key never leaves Vault. The key's
+// latest version at setup signs; the token algorithm follows the key type:
+// RS256 for RSA keys, ES256 for ecdsa-p256 and EdDSA for ed25519 keys.
+type VaultTransitSigner struct {
+	conf VaultConfig
+	// transit engine mount point and key name
+	mount string
+	name  string
+
+	version int
+	keyType string
+	alg     string
+	pubKey  crypto.PublicKey
+}
+
+// NewVaultTransitSigner reads the key's public key from Vault
+func NewVaultTransitSigner(ctx context.Context, c VaultConfig, mount, name string) (*VaultTransitSigner, error) {
+	if c.Timeout == 0 {
+		c.Timeout = defaultReqTimeout
+	}
+
+	s := &VaultTransitSigner{
+		conf:  c,
+		mount: strings.Trim(mount, "/"),
+		name:  name,
+	}
+
+	if err := s.loadKey(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to read vault transit key")
+	}
+
+	return s, nil
+}
+
+func (s *VaultTransitSigner) loadKey(ctx context.Context) error {
+	var key struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := s.do(ctx, http.MethodGet, "keys/"+s.name, nil, &key); err != nil {
+		return err
+	}
+
+	s.version = key.Data.LatestVersion
+	s.keyType = key.Data.Type
+
+	switch {
+	case strings.HasPrefix(s.keyType, "rsa-"):
+		s.alg = "RS256"
+	case s.keyType == "ecdsa-p256":
+		s.alg = "ES256"
+	case s.keyType == "ed25519":
+		s.alg = "EdDSA"
+	default:
+		return errors.Errorf("unsupported key type: %s", s.keyType)
+	}
+
+	latest, ok := key.Data.Keys[strconv.Itoa(s.version)]
+	if !ok {
+		return errors.New("latest key version not found")
+	}
+
+	// ed25519 public keys are base64 encoded, others PEM encoded
+	if s.keyType == "ed25519" {
+		raw, err := base64.StdEncoding.DecodeString(latest.PublicKey)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return errors.New("invalid ed25519 public key")
+		}
+		s.pubKey = ed25519.PublicKey(raw)
+		return nil
+	}
+
+	block, _ := pem.Decode([]byte(latest.PublicKey))
+	if block == nil {
+		return errors.New("public key not PEM-encoded")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse public key")
+	}
+	s.pubKey = pub
+
+	return nil
+}
+
+func (s *VaultTransitSigner) Algorithm() string {
+	return s.alg
+}
+
+func (s *VaultTransitSigner) PublicKey() crypto.PublicKey {
+	return s.pubKey
+}
+
+// Sign signs the input with the key version read at setup; ECDSA signatures
+// are requested in JWS format, RSA ones with PKCS#1 v1.5 padding
+func (s *VaultTransitSigner) Sign(input []byte) ([]byte, error) {
+	req := map[string]interface{}{
+		"input":       base64.StdEncoding.EncodeToString(input),
+		"key_version": s.version,
+	}
+	switch s.keyType {
+	case "ed25519":
+	case "ecdsa-p256":
+		req["marshaling_algorithm"] = "jws"
+	default:
+		req["signature_algorithm"] = "pkcs1v15"
+	}
+
+	var rsp struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	err := s.do(context.Background(), http.MethodPost,
+		"sign/"+s.name+"/sha2-256", req, &rsp)
+	if err != nil {
+		return nil, err
+	}
+
+	// vault:v<version>:<signature>
+	parts := strings.SplitN(rsp.Data.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, errors.New("malformed vault signature")
+	}
+
+	enc := base64.StdEncoding
+	if s.keyType == "ecdsa-p256" {
+		enc = base64.RawURLEncoding
+	}
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode vault signature")
+	}
+
+	return sig, nil
+}
+
+func (s *VaultTransitSigner) do(ctx context.Context, method, path string, body, res interface{}) error {
+	if s.conf.Addr == "" {
+		return errors.New("vault address not configured")
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode request")
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method,
+		strings.TrimRight(s.conf.Addr, "/")+"/v1/"+s.mount+"/"+path, reqBody)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("X-Vault-Token", s.conf.Token)
+
+	ctx, cancel := context.WithTimeout(ctx, s.conf.Timeout)
+	defer cancel()
+
+	rsp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "vault request failed")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return errors.Errorf("vault request failed with status %v",
+			rsp.Status)
+	}
+
+	if err := json.NewDecoder(rsp.Body).Decode(res); err != nil {
+		return errors.Wrap(err, "failed to decode vault response")
+	}
+
+	return nil
+}
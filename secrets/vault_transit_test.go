@@ -0,0 +1,200 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package secrets
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTransitServer mocks the transit engine endpoints for a single key,
+// mounted at 'transit'
+func newTransitServer(t *testing.T, keyType string, key crypto.Signer) *httptest.Server {
+	var pubKey string
+	if keyType == "ed25519" {
+		pubKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	} else {
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		assert.NoError(t, err)
+		pubKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/transit/keys/deviceauth", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get("X-Vault-Token"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"type":           keyType,
+				"latest_version": 2,
+				"keys": map[string]interface{}{
+					"2": map[string]interface{}{"public_key": pubKey},
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/v1/transit/sign/deviceauth/sha2-256", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input               string `json:"input"`
+			KeyVersion          int    `json:"key_version"`
+			SignatureAlgorithm  string `json:"signature_algorithm"`
+			MarshalingAlgorithm string `json:"marshaling_algorithm"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, 2, req.KeyVersion)
+
+		input, err := base64.StdEncoding.DecodeString(req.Input)
+		assert.NoError(t, err)
+		digest := sha256.Sum256(input)
+
+		var sig string
+		switch k := key.(type) {
+		case ed25519.PrivateKey:
+			sig = base64.StdEncoding.EncodeToString(ed25519.Sign(k, input))
+		case *ecdsa.PrivateKey:
+			assert.Equal(t, "jws", req.MarshalingAlgorithm)
+			r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+			assert.NoError(t, err)
+			raw := make([]byte, 64)
+			r.FillBytes(raw[:32])
+			s.FillBytes(raw[32:])
+			sig = base64.RawURLEncoding.EncodeToString(raw)
+		case *rsa.PrivateKey:
+			assert.Equal(t, "pkcs1v15", req.SignatureAlgorithm)
+			raw, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+			assert.NoError(t, err)
+			sig = base64.StdEncoding.EncodeToString(raw)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"signature": "vault:v2:" + sig,
+			},
+		})
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestVaultTransitSigner(t *testing.T) {
+	t.Parallel()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		keyType string
+		key     crypto.Signer
+
+		alg string
+		err string
+	}{
+		"ok, ed25519": {
+			keyType: "ed25519",
+			key:     edKey,
+			alg:     "EdDSA",
+		},
+		"ok, ecdsa-p256": {
+			keyType: "ecdsa-p256",
+			key:     ecKey,
+			alg:     "ES256",
+		},
+		"ok, rsa-2048": {
+			keyType: "rsa-2048",
+			key:     rsaKey,
+			alg:     "RS256",
+		},
+		"error, key type": {
+			keyType: "aes256-gcm96",
+			key:     ecKey,
+			err:     "failed to read vault transit key: unsupported key type: aes256-gcm96",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s := newTransitServer(t, tc.keyType, tc.key)
+			defer s.Close()
+
+			signer, err := NewVaultTransitSigner(context.Background(),
+				VaultConfig{
+					Addr:  s.URL,
+					Token: "token",
+				}, "/transit/", "deviceauth")
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.alg, signer.Algorithm())
+			assert.Equal(t, tc.key.Public(), signer.PublicKey())
+
+			input := []byte("header.payload")
+			sig, err := signer.Sign(input)
+			assert.NoError(t, err)
+
+			digest := sha256.Sum256(input)
+			switch pub := signer.PublicKey().(type) {
+			case ed25519.PublicKey:
+				assert.True(t, ed25519.Verify(pub, input, sig))
+			case *ecdsa.PublicKey:
+				if assert.Len(t, sig, 64) {
+					r := new(big.Int).SetBytes(sig[:32])
+					s := new(big.Int).SetBytes(sig[32:])
+					assert.True(t, ecdsa.Verify(pub, digest[:], r, s))
+				}
+			case *rsa.PublicKey:
+				assert.NoError(t, rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig))
+			}
+		})
+	}
+}
+
+func TestVaultTransitSignerError(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer s.Close()
+
+	_, err := NewVaultTransitSigner(context.Background(),
+		VaultConfig{Addr: s.URL}, "transit", "deviceauth")
+	assert.EqualError(t, err,
+		"failed to read vault transit key: vault request failed with status 403 Forbidden")
+
+	_, err = NewVaultTransitSigner(context.Background(),
+		VaultConfig{}, "transit", "deviceauth")
+	assert.EqualError(t, err,
+		"failed to read vault transit key: vault address not configured")
+}
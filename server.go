@@ -14,7 +14,13 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ant0ine/go-json-rest/rest"
@@ -23,18 +29,28 @@ import (
 	"github.com/pkg/errors"
 
 	api_http "github.com/mendersoftware/deviceauth/api/http"
+	"github.com/mendersoftware/deviceauth/catalog"
+	"github.com/mendersoftware/deviceauth/client/authhook"
 	"github.com/mendersoftware/deviceauth/client/orchestrator"
 	"github.com/mendersoftware/deviceauth/client/tenant"
 	dconfig "github.com/mendersoftware/deviceauth/config"
 	"github.com/mendersoftware/deviceauth/devauth"
 	"github.com/mendersoftware/deviceauth/jwt"
 	"github.com/mendersoftware/deviceauth/keys"
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/notify"
+	"github.com/mendersoftware/deviceauth/overload"
+	"github.com/mendersoftware/deviceauth/revocation"
+	"github.com/mendersoftware/deviceauth/secrets"
+	"github.com/mendersoftware/deviceauth/store"
 	"github.com/mendersoftware/deviceauth/store/mongo"
+	"github.com/mendersoftware/deviceauth/tpm"
+	"github.com/mendersoftware/deviceauth/utils"
 )
 
-func SetupAPI(stacktype string) (*rest.Api, error) {
+func SetupAPI(stacktype string, trustedProxies int) (*rest.Api, error) {
 	api := rest.NewApi()
-	if err := SetupMiddleware(api, stacktype); err != nil {
+	if err := SetupMiddleware(api, stacktype, trustedProxies); err != nil {
 		return nil, errors.Wrap(err, "failed to setup middleware")
 	}
 
@@ -51,9 +67,102 @@ func RunServer(c config.Reader) error {
 
 	l := log.New(log.Ctx{})
 
-	privKey, err := keys.LoadRSAPrivate(c.GetString(dconfig.SettingServerPrivKeyPath))
-	if err != nil {
-		return errors.Wrap(err, "failed to read rsa private key")
+	ctx := context.Background()
+	resolver := secrets.NewResolver()
+	refresh := time.Duration(c.GetInt(dconfig.SettingSecretsRefreshInterval)) * time.Second
+
+	privKeyPath := c.GetString(dconfig.SettingServerPrivKeyPath)
+	keyAlg := c.GetString(dconfig.SettingJWTAlgorithm)
+	signer := c.GetString(dconfig.SettingJWTSigner)
+
+	var privKeyPEM []byte
+	var privKey jwt.KeyHandler
+	var err error
+	switch signer {
+	case "file":
+		if resolver.IsRef(privKeyPath) {
+			privKeyPEM, err = resolver.Resolve(ctx, privKeyPath)
+		} else {
+			privKeyPEM, err = ioutil.ReadFile(privKeyPath)
+		}
+		if err != nil {
+			return errors.Wrap(err, keys.ErrMsgPrivKeyReadFailed)
+		}
+
+		privKey, err = jwt.NewKeyHandler(keyAlg, privKeyPEM)
+		if err != nil {
+			return err
+		}
+	case "vault":
+		l.Infof("signing tokens with vault transit key")
+
+		vs, err := secrets.NewVaultTransitSigner(ctx, secrets.VaultConfigFromEnv(),
+			c.GetString(dconfig.SettingJWTVaultTransitMount),
+			c.GetString(dconfig.SettingJWTVaultTransitKey))
+		if err != nil {
+			return errors.Wrap(err, "failed to setup vault signer")
+		}
+
+		privKey, err = jwt.NewJWTHandlerSigner(vs)
+		if err != nil {
+			return errors.Wrap(err, "failed to setup vault signer")
+		}
+	default:
+		return errors.Errorf("unsupported JWT signer: %s", signer)
+	}
+	configured := []jwt.KeyHandler{privKey}
+
+	if fbPath := c.GetString(dconfig.SettingServerFallbackPrivKeyPath); fbPath != "" {
+		fbAlg := c.GetString(dconfig.SettingJWTFallbackAlgorithm)
+		l.Infof("accepting %s tokens signed with the fallback key", fbAlg)
+
+		var fbPEM []byte
+		if resolver.IsRef(fbPath) {
+			fbPEM, err = resolver.Resolve(ctx, fbPath)
+		} else {
+			fbPEM, err = ioutil.ReadFile(fbPath)
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read fallback private key")
+		}
+
+		fallback, err := jwt.NewKeyHandler(fbAlg, fbPEM)
+		if err != nil {
+			return errors.Wrap(err, "failed to setup fallback key")
+		}
+
+		configured = append(configured, fallback)
+	}
+
+	keyRing := jwt.NewKeyRing(configured...)
+
+	var tokens jwt.Handler = keyRing
+	if c.GetBool(dconfig.SettingJWTEncryption) {
+		l.Infof("encrypting issued tokens")
+
+		keyPath := c.GetString(dconfig.SettingJWTEncryptionKeyPath)
+		if keyPath == "" {
+			return errors.New("jwt_encryption requires jwt_encryption_key_path")
+		}
+
+		var keyData []byte
+		if resolver.IsRef(keyPath) {
+			keyData, err = resolver.Resolve(ctx, keyPath)
+		} else {
+			keyData, err = ioutil.ReadFile(keyPath)
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read token encryption key")
+		}
+
+		encKey, err := jwt.ParseEncryptionKey(keyData)
+		if err != nil {
+			return err
+		}
+		tokens, err = jwt.NewJWEHandler(keyRing, encKey)
+		if err != nil {
+			return err
+		}
 	}
 
 	db, err := mongo.NewDataStoreMongo(
@@ -70,20 +179,162 @@ func RunServer(c config.Reader) error {
 		return errors.Wrap(err, "database connection failed")
 	}
 
-	jwtHandler := jwt.NewJWTHandlerRS256(privKey)
+	db = db.WithRevokedTokenRetention(
+		time.Duration(c.GetInt(dconfig.SettingRevokedTokensRetention)) * time.Second)
+	db = db.WithTokenAuditRetention(
+		time.Duration(c.GetInt(dconfig.SettingTokenAuditRetention)) * time.Second)
+	db = db.WithIdempotencyKeyRetention(
+		time.Duration(c.GetInt(dconfig.SettingIdempotencyKeyRetention)) * time.Second)
+
+	if signer == "file" && resolver.IsRef(privKeyPath) && refresh > 0 {
+		go resolver.Watch(ctx, privKeyPath, privKeyPEM, refresh,
+			func(pem []byte) error {
+				h, err := jwt.NewKeyHandler(keyAlg, pem)
+				if err != nil {
+					return err
+				}
+				// the previous key verifies the tokens it signed
+				// until they expire
+				lifetime := c.GetInt(dconfig.SettingJWTExpirationTimeout)
+				if maxLifetime := c.GetInt(dconfig.SettingJWTMaxLifetime); maxLifetime > lifetime {
+					lifetime = maxLifetime
+				}
+				keepUntil := time.Now().Add(time.Duration(lifetime) * time.Second)
+				keyRing.ReplaceConfigured(h, keepUntil)
+
+				l.Infof("server private key changed, replacing; the previous key "+
+					"verifies tokens until %s", keepUntil.UTC().Format(time.RFC3339))
+				return nil
+			})
+	}
+
+	if err := loadServerKeys(ctx, db, keyRing, resolver); err != nil {
+		return err
+	}
+
+	if interval := c.GetInt(dconfig.SettingServerKeysRefreshInterval); interval > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(interval) * time.Second)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if err := loadServerKeys(ctx, db, keyRing, resolver); err != nil {
+					l.Errorf("failed to reload server keys: %v", err)
+				}
+			}
+		}()
+	}
+
+	spiffeTrustDomain := c.GetString(dconfig.SettingSpiffeTrustDomain)
+	if spiffeTrustDomain != "" {
+		if err := jwt.ValidateSpiffeTrustDomain(spiffeTrustDomain); err != nil {
+			return errors.Wrap(err, "failed to setup SPIFFE identities")
+		}
+	}
+
+	var tenantIssuers map[string]devauth.TokenIssuer
+	if issPath := c.GetString(dconfig.SettingJWTTenantIssuersPath); issPath != "" {
+		tenantIssuers, err = devauth.LoadTenantTokenIssuers(issPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var tokenScopes *devauth.TokenScopePolicy
+	if scopesPath := c.GetString(dconfig.SettingJWTScopesPath); scopesPath != "" {
+		tokenScopes, err = devauth.LoadTokenScopePolicy(scopesPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var claimsTemplate jwt.ClaimsTemplate
+	if tmplPath := c.GetString(dconfig.SettingJWTClaimsTemplatePath); tmplPath != "" {
+		claimsTemplate, err = jwt.LoadClaimsTemplate(tmplPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var deviceCACerts *x509.CertPool
+	if caPath := c.GetString(dconfig.SettingDeviceCACertsPath); caPath != "" {
+		l.Infof("setting up device certificate enrollment")
+
+		deviceCACerts, err = loadCertPool(caPath)
+		if err != nil {
+			return errors.Wrap(err, "failed to load device CA certificates")
+		}
+	}
+
+	var mtlsAttr string
+	if c.GetBool(dconfig.SettingDevicesMTLS) {
+		if c.GetString(dconfig.SettingTLSCertPath) == "" || deviceCACerts == nil {
+			return errors.New("devices mTLS requires tls_cert_path, tls_key_path " +
+				"and device_ca_certs_path")
+		}
+		mtlsAttr = c.GetString(dconfig.SettingDevicesMTLSIdentityAttribute)
+	}
+
+	keyPolicy := model.KeyPolicy{
+		MinRSABits:      c.GetInt(dconfig.SettingKeyPolicyMinRSABits),
+		AllowedKeyTypes: c.GetStringSlice(dconfig.SettingKeyPolicyAllowedKeyTypes),
+	}
+	if err := keyPolicy.Validate(); err != nil {
+		return errors.Wrap(err, "invalid key policy")
+	}
 
 	orchClientConf := orchestrator.Config{
 		OrchestratorAddr: c.GetString(dconfig.SettingOrchestratorAddr),
 		Timeout:          time.Duration(30) * time.Second,
 	}
 
-	devauth := devauth.NewDevAuth(db,
+	// collapse concurrent lookups of the same device, e.g. when a fleet
+	// reconnects after a gateway outage
+	devauth := devauth.NewDevAuth(store.WithSingleflight(db),
 		orchestrator.NewClient(orchClientConf),
-		jwtHandler,
+		tokens,
 		devauth.Config{
 			Issuer:                 c.GetString(dconfig.SettingJWTIssuer),
+			Audience:               c.GetString(dconfig.SettingJWTAudience),
+			TenantIssuers:          tenantIssuers,
+			TokenScopes:            tokenScopes,
 			ExpirationTime:         int64(c.GetInt(dconfig.SettingJWTExpirationTimeout)),
 			MaxDevicesLimitDefault: uint64(c.GetInt(dconfig.SettingMaxDevicesLimitDefault)),
+
+			RefreshExpirationTime: int64(c.GetInt(dconfig.SettingJWTRefreshExpirationTimeout)),
+			MaxLifetime:           int64(c.GetInt(dconfig.SettingJWTMaxLifetime)),
+			TokenExpiryGrace:      int64(c.GetInt(dconfig.SettingJWTExpiryGrace)),
+
+			BootstrapTokenExpirationTime: int64(c.GetInt(dconfig.SettingBootstrapTokenExpirationTimeout)),
+
+			DeviceAuthzVerificationUri: c.GetString(dconfig.SettingDeviceAuthzVerificationUri),
+			DeviceAuthzExpirationTime:  int64(c.GetInt(dconfig.SettingDeviceAuthzExpirationTimeout)),
+			DeviceAuthzInterval:        int64(c.GetInt(dconfig.SettingDeviceAuthzInterval)),
+
+			SpiffeTrustDomain: spiffeTrustDomain,
+
+			OffboardingTokenScope:         c.GetStringSlice(dconfig.SettingOffboardingTokenScope),
+			OffboardingGracePeriodDefault: uint64(c.GetInt(dconfig.SettingOffboardingGracePeriod)),
+
+			DeviceCACerts:         deviceCACerts,
+			MTLSIdentityAttribute: mtlsAttr,
+
+			KeyPolicy: keyPolicy,
+
+			AuthChallengeRequired:       c.GetBool(dconfig.SettingAuthChallengeRequired),
+			AuthChallengeExpirationTime: int64(c.GetInt(dconfig.SettingAuthChallengeExpirationTimeout)),
+
+			AuthReqTimestampRequired: c.GetBool(dconfig.SettingAuthReqTimestampRequired),
+			AuthReqMaxClockSkew:      int64(c.GetInt(dconfig.SettingAuthReqMaxClockSkew)),
+
+			MaxDeviceKeys:   c.GetInt(dconfig.SettingMaxDeviceKeys),
+			MaxDeviceTokens: c.GetInt(dconfig.SettingMaxDeviceTokens),
+
+			TokenAudit: c.GetBool(dconfig.SettingTokenAudit),
+
+			RejectedDeviceRetention: int64(c.GetInt(dconfig.SettingRejectedDeviceRetention)),
+
+			ClaimsTemplate: claimsTemplate,
 		})
 
 	if tadmAddr := c.GetString(dconfig.SettingTenantAdmAddr); tadmAddr != "" {
@@ -96,12 +347,187 @@ func RunServer(c config.Reader) error {
 		devauth = devauth.WithTenantVerification(tc)
 	}
 
-	api, err := SetupAPI(c.GetString(dconfig.SettingMiddleware))
+	if hookAddr := c.GetString(dconfig.SettingAuthReqHookAddr); hookAddr != "" {
+		l.Infof("setting up auth request check hook")
+
+		hookSecretRef := c.GetString(dconfig.SettingAuthReqHookSecret)
+		hookSecret, err := resolver.ResolveString(ctx, hookSecretRef)
+		if err != nil {
+			return errors.Wrap(err, "failed to resolve auth request hook secret")
+		}
+
+		hc := authhook.NewClient(authhook.Config{
+			HookAddr: hookAddr,
+			Secret:   hookSecret,
+		})
+
+		if resolver.IsRef(hookSecretRef) && refresh > 0 {
+			go resolver.Watch(ctx, hookSecretRef, []byte(hookSecret), refresh,
+				func(secret []byte) error {
+					hc.SetSecret(strings.TrimRight(string(secret), "\r\n"))
+					return nil
+				})
+		}
+
+		devauth = devauth.WithAuthReqHooks(hc)
+	}
+
+	if caPath := c.GetString(dconfig.SettingTPMCACertsPath); caPath != "" {
+		l.Infof("setting up TPM attestation")
+
+		tpmCACerts, err := loadCertPool(caPath)
+		if err != nil {
+			return errors.Wrap(err, "failed to load TPM CA certificates")
+		}
+
+		devauth = devauth.WithTPMAttestation(tpm.NewVerifier(tpmCACerts))
+	}
+
+	if notifyPath := c.GetString(dconfig.SettingNotifyConfigPath); notifyPath != "" {
+		l.Infof("setting up operator notifications")
+
+		notifyConf, err := notify.LoadConfig(notifyPath)
+		if err != nil {
+			return err
+		}
+
+		smtpPassword, err := resolver.ResolveString(ctx,
+			c.GetString(dconfig.SettingNotifySMTPPassword))
+		if err != nil {
+			return errors.Wrap(err, "failed to resolve SMTP password")
+		}
+
+		notifier, err := notify.NewDispatcher(*notifyConf, notify.SMTPConfig{
+			Addr:     c.GetString(dconfig.SettingNotifySMTPAddr),
+			Username: c.GetString(dconfig.SettingNotifySMTPUsername),
+			Password: smtpPassword,
+			From:     c.GetString(dconfig.SettingNotifyEmailFrom),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to setup notifications")
+		}
+
+		devauth = devauth.WithNotifier(notifier)
+		go notifier.Run(ctx)
+
+		if interval := c.GetInt(dconfig.SettingNotifyPendingDigestInterval); interval > 0 {
+			l.Infof("sending pending devices digest every %d seconds", interval)
+
+			go devauth.RunPendingDigest(ctx,
+				time.Duration(interval)*time.Second)
+		}
+	}
+
+	if gwPath := c.GetString(dconfig.SettingRevocationGatewaysPath); gwPath != "" {
+		l.Infof("setting up revocation publishing")
+
+		gwConf, err := revocation.LoadConfig(gwPath)
+		if err != nil {
+			return err
+		}
+
+		publisher, err := revocation.NewDispatcher(*gwConf)
+		if err != nil {
+			return errors.Wrap(err, "failed to setup revocation publishing")
+		}
+
+		devauth = devauth.WithRevocationPublisher(publisher)
+		go publisher.Run(ctx)
+	}
+
+	if interval := c.GetInt(dconfig.SettingDecommissionSchedulerInterval); interval > 0 {
+		l.Infof("running scheduled decommissioning every %d seconds", interval)
+
+		go devauth.RunDecommissionScheduler(ctx,
+			time.Duration(interval)*time.Second)
+	}
+
+	if interval := c.GetInt(dconfig.SettingTokenUsageFlushInterval); interval > 0 {
+		l.Infof("recording token usage every %d seconds", interval)
+
+		devauth = devauth.WithTokenUsageTracking()
+		go devauth.RunTokenUsageFlush(ctx,
+			time.Duration(interval)*time.Second)
+	}
+
+	if interval := c.GetInt(dconfig.SettingDeviceCheckinFlushInterval); interval > 0 {
+		l.Infof("recording device check-ins every %d seconds", interval)
+
+		devauth = devauth.WithDeviceCheckinTracking()
+		go devauth.RunDeviceCheckinFlush(ctx,
+			time.Duration(interval)*time.Second)
+	}
+
+	if interval := c.GetInt(dconfig.SettingTokenPurgeInterval); interval > 0 {
+		l.Infof("purging expired tokens every %d seconds", interval)
+
+		go devauth.RunTokenPurge(ctx,
+			time.Duration(interval)*time.Second,
+			c.GetInt(dconfig.SettingTokenPurgeBatchSize))
+	}
+
+	if retention := c.GetInt(dconfig.SettingRejectedDeviceRetention); retention > 0 {
+		if interval := c.GetInt(dconfig.SettingRejectedDevicePurgeInterval); interval > 0 {
+			l.Infof("purging rejected devices inactive for %d seconds, every %d seconds",
+				retention, interval)
+
+			go devauth.RunRejectedDevicePurge(ctx,
+				time.Duration(interval)*time.Second)
+		}
+	}
+
+	api, err := SetupAPI(c.GetString(dconfig.SettingMiddleware),
+		c.GetInt(dconfig.SettingTrustedProxies))
 	if err != nil {
 		return errors.Wrap(err, "API setup failed")
 	}
 
-	devauthapi := api_http.NewDevAuthApiHandlers(devauth, db)
+	if maxReqs := c.GetInt(dconfig.SettingMaxConcurrentRequests); maxReqs > 0 {
+		l.Infof("limiting concurrent requests to %d", maxReqs)
+		// event streams are long-lived, they would hold on to the slots
+		api.Use(&rest.IfMiddleware{
+			Condition: func(r *rest.Request) bool {
+				return !api_http.EventStreamRequest(r)
+			},
+			IfTrue: &overload.ConcurrencyMiddleware{Max: maxReqs},
+		})
+	}
+
+	if workers := c.GetInt(dconfig.SettingPriorityWorkers); workers > 0 {
+		l.Infof("prioritizing token verification, %d workers", workers)
+
+		queueSize := c.GetInt(dconfig.SettingPriorityQueueSize)
+		api.Use(&overload.PriorityMiddleware{
+			Scheduler: overload.NewScheduler(workers,
+				time.Duration(c.GetInt(dconfig.SettingPriorityQueueTimeout))*time.Second,
+				overload.Class{
+					Name:      api_http.TrafficClassVerify,
+					Weight:    c.GetInt(dconfig.SettingPriorityVerifyWeight),
+					QueueSize: queueSize,
+				},
+				overload.Class{
+					Name:      api_http.TrafficClassEnroll,
+					Weight:    c.GetInt(dconfig.SettingPriorityEnrollWeight),
+					QueueSize: queueSize,
+				}),
+			Classify: api_http.TrafficClass,
+		})
+	}
+
+	var apiMiddlewares []rest.Middleware
+	if path := c.GetString(dconfig.SettingErrorTranslationsPath); path != "" {
+		l.Infof("setting up error message translations")
+
+		translations, err := catalog.LoadTranslations(path)
+		if err != nil {
+			return err
+		}
+
+		apiMiddlewares = append(apiMiddlewares,
+			&api_http.TranslationMiddleware{Translator: translations})
+	}
+
+	devauthapi := api_http.NewDevAuthApiHandlers(devauth, db, apiMiddlewares...)
 
 	apph, err := devauthapi.GetApp()
 	if err != nil {
@@ -112,5 +538,86 @@ func RunServer(c config.Reader) error {
 	addr := c.GetString(dconfig.SettingListen)
 	l.Printf("listening on %s", addr)
 
-	return http.ListenAndServe(addr, api.MakeHandler())
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen")
+	}
+
+	if maxConns := c.GetInt(dconfig.SettingMaxConnections); maxConns > 0 {
+		mode := c.GetString(dconfig.SettingConnectionLimitMode)
+		l.Infof("limiting connections to %d, mode: %s", maxConns, mode)
+
+		ln, err = overload.LimitListener(ln, maxConns, mode)
+		if err != nil {
+			return errors.Wrap(err, "failed to setup connection limit")
+		}
+	}
+
+	if certPath := c.GetString(dconfig.SettingTLSCertPath); certPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, c.GetString(dconfig.SettingTLSKeyPath))
+		if err != nil {
+			return errors.Wrap(err, "failed to load TLS certificate")
+		}
+
+		tlsConf := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}
+		if mtlsAttr != "" {
+			l.Infof("requiring client certificates for device authentication")
+
+			// services calling the other APIs have no client
+			// certificates, devauth enforces them on auth requests
+			tlsConf.ClientAuth = tls.VerifyClientCertIfGiven
+			tlsConf.ClientCAs = deviceCACerts
+		}
+
+		ln = tls.NewListener(ln, tlsConf)
+	}
+
+	return http.Serve(ln, api.MakeHandler())
+}
+
+// loadServerKeys replaces the key ring's managed keys with the ones added
+// with the server-keys command, resolving their secret references
+func loadServerKeys(ctx context.Context, db store.DataStore, ring *jwt.KeyRing,
+	resolver *secrets.Resolver) error {
+	serverKeys, err := db.GetServerKeys(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load server keys")
+	}
+
+	handlers := make([]jwt.KeyHandler, 0, len(serverKeys))
+	for _, k := range serverKeys {
+		pem, err := resolver.Resolve(ctx, k.PrivateKeyRef)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve server key %s", k.Id)
+		}
+		h, err := jwt.NewKeyHandler(k.Algorithm, pem)
+		if err != nil {
+			return errors.Wrapf(err, "failed to setup server key %s", k.Id)
+		}
+		handlers = append(handlers, h)
+	}
+
+	ring.SetKeys(handlers...)
+	return nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := utils.ParseCertChain(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
 }
@@ -21,11 +21,11 @@ import (
 
 func TestSetupApi(t *testing.T) {
 	// expecting an error
-	api, err := SetupAPI("foo")
+	api, err := SetupAPI("foo", 0)
 	assert.Nil(t, api)
 	assert.Error(t, err)
 
-	api, err = SetupAPI(EnvDev)
+	api, err = SetupAPI(EnvDev, 1)
 	assert.NotNil(t, api)
 	assert.Nil(t, err)
 }
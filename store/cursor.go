@@ -0,0 +1,119 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+// ErrInvalidCursor is returned for cursors which can't be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor positions a listing right after an item, for paging with range
+// queries on the listing's sort fields instead of skipping items
+type Cursor struct {
+	// sort order of the listing the cursor is valid for
+	Sort string `json:"o,omitempty"`
+	// id of the item
+	Id string `json:"i"`
+	// the item's value of the field sorted by, unless sorted by id
+	Ts  *time.Time `json:"t,omitempty"`
+	Str string     `json:"s,omitempty"`
+}
+
+// Encode returns the cursor as an opaque, URL safe string
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor returned by Cursor.Encode
+func ParseCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Id == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// String returns the sort order as 'field:asc' or 'field:desc'
+func (s DeviceSort) String() string {
+	field := s.Field
+	if field == "" {
+		field = DeviceSortId
+	}
+	if s.Desc {
+		return field + ":desc"
+	}
+	return field + ":asc"
+}
+
+// Cursor returns the cursor positioned right after the device in a
+// listing in the sort order
+func (s DeviceSort) Cursor(dev *model.Device) *Cursor {
+	c := &Cursor{
+		Sort: s.String(),
+		Id:   dev.Id,
+	}
+
+	switch s.Field {
+	case DeviceSortCreatedTs:
+		ts := dev.CreatedTs
+		c.Ts = &ts
+	case DeviceSortStatus:
+		c.Str = dev.Status
+	}
+
+	return c
+}
+
+// StatusChangeSort is the sort order of the status changes of all
+// devices, oldest first
+const StatusChangeSort = "timestamp:asc"
+
+// StatusChangeCursor returns the cursor positioned right after the
+// status change
+func StatusChangeCursor(r *model.DeviceStatusChange) *Cursor {
+	ts := r.Timestamp
+	return &Cursor{
+		Sort: StatusChangeSort,
+		Id:   r.Id,
+		Ts:   &ts,
+	}
+}
+
+// TokenAuditSort is the sort order of the token audit trail, newest first
+const TokenAuditSort = "timestamp:desc"
+
+// TokenAuditCursor returns the cursor positioned right after the record
+// in the token audit trail
+func TokenAuditCursor(r *model.TokenAuditRecord) *Cursor {
+	ts := r.Timestamp
+	return &Cursor{
+		Sort: TokenAuditSort,
+		Id:   r.Id,
+		Ts:   &ts,
+	}
+}
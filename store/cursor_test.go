@@ -0,0 +1,110 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+func TestCursor(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		cursor *Cursor
+		in     string
+
+		err error
+	}{
+		"ok, id": {
+			cursor: &Cursor{Sort: "id:asc", Id: "dev1"},
+		},
+		"ok, time": {
+			cursor: &Cursor{Sort: "created_ts:desc", Id: "dev1", Ts: &ts},
+		},
+		"ok, string": {
+			cursor: &Cursor{Sort: "status:asc", Id: "dev1", Str: "pending"},
+		},
+		"error, not base64": {
+			in:  "not a cursor!",
+			err: ErrInvalidCursor,
+		},
+		"error, not json": {
+			in:  "bm90IGpzb24",
+			err: ErrInvalidCursor,
+		},
+		"error, no id": {
+			in:  Cursor{Sort: "id:asc"}.Encode(),
+			err: ErrInvalidCursor,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			in := tc.in
+			if tc.cursor != nil {
+				in = tc.cursor.Encode()
+			}
+
+			c, err := ParseCursor(in)
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+				assert.Nil(t, c)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.cursor.Sort, c.Sort)
+				assert.Equal(t, tc.cursor.Id, c.Id)
+				assert.Equal(t, tc.cursor.Str, c.Str)
+				if tc.cursor.Ts != nil {
+					assert.True(t, tc.cursor.Ts.Equal(*c.Ts))
+				} else {
+					assert.Nil(t, c.Ts)
+				}
+			}
+		})
+	}
+}
+
+func TestDeviceSortCursor(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	dev := &model.Device{
+		Id:        "dev1",
+		Status:    model.DevStatusPending,
+		CreatedTs: ts,
+	}
+
+	assert.Equal(t,
+		&Cursor{Sort: "id:asc", Id: "dev1"},
+		DeviceSort{}.Cursor(dev))
+	assert.Equal(t,
+		&Cursor{Sort: "id:desc", Id: "dev1"},
+		DeviceSort{Field: DeviceSortId, Desc: true}.Cursor(dev))
+	assert.Equal(t,
+		&Cursor{Sort: "created_ts:desc", Id: "dev1", Ts: &ts},
+		DeviceSort{Field: DeviceSortCreatedTs, Desc: true}.Cursor(dev))
+	assert.Equal(t,
+		&Cursor{Sort: "status:asc", Id: "dev1", Str: model.DevStatusPending},
+		DeviceSort{Field: DeviceSortStatus}.Cursor(dev))
+}
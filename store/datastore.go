@@ -17,6 +17,7 @@ package store
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/mendersoftware/deviceauth/model"
 )
@@ -30,6 +31,22 @@ var (
 	ErrAuthSetNotFound = errors.New("authorization set not found")
 	// limit  set not found
 	ErrLimitNotFound = errors.New("limit not found")
+	// device authorization (device/user code) not found
+	ErrDeviceCodeNotFound = errors.New("device code not found")
+	// auth challenge nonce not found
+	ErrAuthNonceNotFound = errors.New("auth nonce not found")
+	// device transfer not found
+	ErrTransferNotFound = errors.New("transfer not found")
+	// offboarding token not found
+	ErrOffboardingTokenNotFound = errors.New("offboarding token not found")
+	// refresh token not found
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// bootstrap token not found
+	ErrBootstrapTokenNotFound = errors.New("bootstrap token not found")
+	// idempotency key not found
+	ErrIdempotencyRecordNotFound = errors.New("idempotency record not found")
+	// server signing key not found
+	ErrServerKeyNotFound = errors.New("server key not found")
 	// device already exists
 	ErrObjectExists = errors.New("object exists")
 	// device status unknown
@@ -47,6 +64,48 @@ type AuthSetFilter struct {
 
 type DeviceFilter struct {
 	Status string `bson:"status,omitempty"`
+	Group  string `bson:"group,omitempty"`
+	// Search selects devices with an identity attribute value or alias
+	// containing the term, ignoring case, or equal to it if SearchExact
+	// is set
+	Search      string `bson:"-"`
+	SearchExact bool   `bson:"-"`
+	// CreatedAfter, CreatedBefore and UpdatedAfter select devices
+	// created or last updated strictly after or before the time
+	CreatedAfter  *time.Time `bson:"-"`
+	CreatedBefore *time.Time `bson:"-"`
+	UpdatedAfter  *time.Time `bson:"-"`
+	// Conflict selects devices with auth sets in conflict
+	Conflict bool `bson:"-"`
+	// Sort orders the devices; by id if not set
+	Sort DeviceSort `bson:"-"`
+	// After lists the devices following the cursor, in place of skipping
+	After *Cursor `bson:"-"`
+}
+
+const (
+	DeviceSortId        = "id"
+	DeviceSortCreatedTs = "created_ts"
+	DeviceSortStatus    = "status"
+)
+
+// DeviceSort orders device listings by one of the DeviceSort* fields,
+// then by id
+type DeviceSort struct {
+	Field string
+	Desc  bool
+}
+
+// TokenAuditFilter selects token audit records; empty fields match all
+type TokenAuditFilter struct {
+	DeviceId string
+	TokenId  string
+	Action   string
+	// records from, and before, the times
+	From *time.Time
+	To   *time.Time
+	// After lists the records following the cursor, in place of skipping
+	After *Cursor
 }
 
 type DataStore interface {
@@ -63,20 +122,42 @@ type DataStore interface {
 
 	AddDevice(ctx context.Context, d model.Device) error
 
+	// adds the devices in one go; the returned errors match the devices
+	// by index, nil for the ones added and ErrObjectExists for
+	// the ones conflicting with existing devices
+	AddDevices(ctx context.Context, devs []model.Device) ([]error, error)
+
 	// updates a single device with ID `d.Id`, using data from `up`
 	UpdateDevice(ctx context.Context, d model.Device, up model.DeviceUpdate) error
 
+	// sets the status of the device, returns the status it had before;
+	// a quarantined device keeps its status, see ReleaseQuarantinedDevice
+	SetDeviceStatus(ctx context.Context, id, status string) (string, error)
+
+	// sets the status of the device if it's quarantined; returns
+	// ErrDevNotFound if there's no such quarantined device
+	ReleaseQuarantinedDevice(ctx context.Context, id, status string) error
+
 	// deletes device
 	DeleteDevice(ctx context.Context, id string) error
 
 	AddAuthSet(ctx context.Context, set model.AuthSet) error
 
+	// adds the auth sets in one go, the errors as for AddDevices
+	AddAuthSets(ctx context.Context, sets []model.AuthSet) ([]error, error)
+
 	GetAuthSetByIdDataHashKey(ctx context.Context, idDataHash []byte, key string) (*model.AuthSet, error)
 
 	GetAuthSetById(ctx context.Context, id string) (*model.AuthSet, error)
 
 	GetAuthSetsForDevice(ctx context.Context, devid string) ([]model.AuthSet, error)
 
+	// get the auth sets with the key, of any device
+	GetAuthSetsByPubKey(ctx context.Context, key string) ([]model.AuthSet, error)
+
+	// clears the conflict markers of the devices and of their auth sets
+	ClearConflicts(ctx context.Context, devIds []string) error
+
 	// update matching AuthSets and set their fields to values in AuthSetUpdate
 	UpdateAuthSet(ctx context.Context, filter interface{}, mod model.AuthSetUpdate) error
 
@@ -93,30 +174,243 @@ type DataStore interface {
 	// returns ErrTokenNotFound if token not found
 	GetToken(ctx context.Context, jti string) (*model.Token, error)
 
-	// deletes token
+	// deletes token, and records its revocation
 	DeleteToken(ctx context.Context, jti string) error
 
+	// deletes an expired token, without recording it as revoked
+	// returns ErrTokenNotFound if token not found
+	DeleteExpiredToken(ctx context.Context, jti string) error
+
+	// sets the (sliding) expiration time of a token
+	// returns ErrTokenNotFound if token not found
+	UpdateTokenExpiration(ctx context.Context, jti string, expiresAt time.Time) error
+
 	// deletes all (tenant's) tokens (identity in context)
 	DeleteTokens(ctx context.Context) error
 
 	// deletes device token
 	DeleteTokenByDevId(ctx context.Context, dev_id string) error
 
+	// deletes the tokens issued for the auth set, and records their
+	// revocation; returns the ids of the deleted tokens
+	DeleteAuthSetTokens(ctx context.Context, authId string) ([]string, error)
+
+	// retrieves all tokens of a device
+	GetTokensByDevId(ctx context.Context, dev_id string) ([]model.Token, error)
+
+	// records the last use of tokens, on the tokens and their devices;
+	// doesn't move last use timestamps back
+	SetTokensLastUsed(ctx context.Context, usage []model.TokenUsage) error
+
+	// records the last check-in of devices; doesn't move check-in
+	// timestamps back
+	SetDevicesLastCheckin(ctx context.Context, checkins []model.DeviceCheckin) error
+
+	// deletes the tokens expired by now, batchSize at a time; returns the
+	// number of deleted tokens
+	DeleteExpiredTokens(ctx context.Context, now time.Time, batchSize int) (int, error)
+
+	// deletes the device's oldest tokens, by issue time, so that at most
+	// keep are left, and records their revocation; returns the ids of the
+	// deleted tokens
+	DeleteOldestDeviceTokens(ctx context.Context, devId string, keep int) ([]string, error)
+
 	// put limit information into data store
 	PutLimit(ctx context.Context, lim model.Limit) error
 
 	// fetch limit information from data store
 	GetLimit(ctx context.Context, name string) (*model.Limit, error)
 
+	// marks the tenant in the context suspended, or no longer suspended
+	SetTenantSuspended(ctx context.Context, suspended bool) error
+
+	// tells if the tenant in the context is suspended
+	IsTenantSuspended(ctx context.Context) (bool, error)
+
 	// get the number of devices with a given admission status
 	// computed based on aggregated auth set statuses
 	GetDevCountByStatus(ctx context.Context, status string) (int, error)
 
+	// get the number of devices, in total and per admission status,
+	// counted on the indexed device status
+	GetDevCounts(ctx context.Context) (*model.DeviceCounts, error)
+
+	// get the number of devices matching the filter, regardless of its
+	// cursor
+	CountDevices(ctx context.Context, filter DeviceFilter) (int, error)
+
 	// gets device status
 	GetDeviceStatus(ctx context.Context, dev_id string) (string, error)
 
 	GetAuthSets(ctx context.Context, skip, limit int, filter AuthSetFilter) ([]model.DevAdmAuthSet, error)
 
+	// device authorization grants are kept in the common database,
+	// as they must be found without tenant context
+	AddDeviceCode(ctx context.Context, c model.DeviceCode) error
+
+	// returns ErrDeviceCodeNotFound if not found
+	GetDeviceCode(ctx context.Context, id string) (*model.DeviceCode, error)
+
+	// returns ErrDeviceCodeNotFound if not found
+	GetDeviceCodeByUserCode(ctx context.Context, userCode string) (*model.DeviceCode, error)
+
+	UpdateDeviceCode(ctx context.Context, id string, up model.DeviceCodeUpdate) error
+
+	// removes the device code; returns ErrDeviceCodeNotFound if it's
+	// already gone, so that only one caller can claim the code
+	DeleteDeviceCode(ctx context.Context, id string) error
+
+	// removes the device codes of the tenant
+	DeleteDeviceCodes(ctx context.Context, tenantId string) error
+
+	// auth challenge nonces are kept in the common database, as they are
+	// handed out before the tenant is known
+	AddAuthNonce(ctx context.Context, n model.AuthNonce) error
+
+	// removes the nonce, so that it can only be used once, and returns
+	// it; returns ErrAuthNonceNotFound if not found or expired at given time
+	UseAuthNonce(ctx context.Context, id string, now time.Time) (*model.AuthNonce, error)
+
+	// device transfers are kept in the common database, so that transfers
+	// to other tenants can be completed in the destination tenant
+	AddTransfer(ctx context.Context, t model.Transfer) error
+
+	// returns ErrTransferNotFound if not found
+	GetTransfer(ctx context.Context, id string) (*model.Transfer, error)
+
+	// finds the transfer waiting for the device with given identity data to
+	// enroll in the tenant; returns ErrTransferNotFound if there's none
+	GetPendingTransferByIdDataHash(ctx context.Context, tenantId string, idDataHash []byte) (*model.Transfer, error)
+
+	// updates the transfer if it's still in the given status, so that
+	// concurrent status changes don't override each other; returns
+	// ErrTransferNotFound if there's no such transfer in that status
+	UpdateTransfer(ctx context.Context, id, status string, up model.TransferUpdate) error
+
+	// sets the time the device is to be decommissioned at, nil clears it
+	// returns ErrDevNotFound if device not found
+	SetDeviceDecommissionAt(ctx context.Context, id string, at *time.Time) error
+
+	// clears the decommissioning time of the device if it's due by now, so
+	// that only one caller decommissions it; returns ErrDevNotFound if
+	// device not found or not due
+	ClaimDecommission(ctx context.Context, id string, now time.Time) error
+
+	// sets the group of the device, empty removes it from its group
+	// returns ErrDevNotFound if device not found
+	SetDeviceGroup(ctx context.Context, id, group string) error
+
+	// updates the notes and labels of the device
+	// returns ErrDevNotFound if device not found
+	UpdateDeviceAnnotations(ctx context.Context, id string, a model.DeviceAnnotations) error
+
+	// list devices scheduled for decommissioning, up to the given time
+	// (all if zero), soonest first
+	GetScheduledDecommissions(ctx context.Context, until time.Time, skip, limit uint) ([]model.Device, error)
+
+	// list rejected devices which last checked in before the given time,
+	// or, never having checked in, were last updated before it
+	GetStaleRejectedDevices(ctx context.Context, before time.Time, skip, limit uint) ([]model.Device, error)
+
+	// list IDs of the tenants having own databases
+	GetTenantIds(ctx context.Context) ([]string, error)
+
+	AddOffboardingToken(ctx context.Context, t model.OffboardingToken) error
+
+	// returns ErrOffboardingTokenNotFound if not found
+	GetOffboardingToken(ctx context.Context, id string) (*model.OffboardingToken, error)
+
+	// marks the unclaimed, unexpired offboarding token of the auth set as
+	// claimed at given time and returns it; returns
+	// ErrOffboardingTokenNotFound if there's none
+	ClaimOffboardingToken(ctx context.Context, idDataHash []byte, pubkey string, now time.Time) (*model.OffboardingToken, error)
+
+	// records a use of the offboarding token
+	UseOffboardingToken(ctx context.Context, id string, now time.Time) error
+
+	// list offboarding tokens, newest first
+	GetOffboardingTokens(ctx context.Context, skip, limit uint) ([]model.OffboardingToken, error)
+
+	// refresh tokens are kept in the common database, as they are
+	// exchanged without tenant context
+	AddRefreshToken(ctx context.Context, t model.RefreshToken) error
+
+	// removes the refresh token, so that it can only be exchanged once, and
+	// returns it; returns ErrRefreshTokenNotFound if not found or expired
+	// at given time
+	UseRefreshToken(ctx context.Context, id string, now time.Time) (*model.RefreshToken, error)
+
+	// removes the refresh tokens of the tenant, or of one of its devices
+	// if the device ID is set
+	DeleteRefreshTokens(ctx context.Context, tenantId, deviceId string) error
+
+	// removes the refresh tokens issued for the auth set
+	DeleteAuthSetRefreshTokens(ctx context.Context, authId string) error
+
+	// stores a bootstrap token
+	AddBootstrapToken(ctx context.Context, t model.BootstrapToken) error
+
+	// finds the unused, unexpired bootstrap token for the identity data and
+	// marks it used; returns ErrBootstrapTokenNotFound if there's none
+	UseBootstrapToken(ctx context.Context, id string, idDataHash []byte, now time.Time) (*model.BootstrapToken, error)
+
+	// marks the bootstrap token used at the given time unused again;
+	// returns ErrBootstrapTokenNotFound if there's no such token
+	ReleaseBootstrapToken(ctx context.Context, id string, usedAt time.Time) error
+
+	// lists the tokens deleted since the given time, i.e. revoked,
+	// oldest first; token deletes record the revocations
+	GetRevokedTokens(ctx context.Context, since time.Time, skip, limit uint) ([]model.RevokedToken, error)
+
+	// stores a token audit record
+	AddTokenAuditRecord(ctx context.Context, r model.TokenAuditRecord) error
+
+	// lists token audit records, the newest first
+	GetTokenAuditRecords(ctx context.Context, filter TokenAuditFilter, skip, limit uint) ([]model.TokenAuditRecord, error)
+
+	// stores a change of a device's status
+	AddDeviceStatusChange(ctx context.Context, r model.DeviceStatusChange) error
+
+	// stores several status changes at once
+	AddDeviceStatusChanges(ctx context.Context, rs []model.DeviceStatusChange) error
+
+	// lists the status changes of the device, the newest first
+	GetDeviceStatusHistory(ctx context.Context, devId string, skip, limit uint) ([]model.DeviceStatusChange, error)
+
+	// lists the status changes of all devices following the cursor,
+	// oldest first
+	GetDeviceStatusChanges(ctx context.Context, after *Cursor, limit uint) ([]model.DeviceStatusChange, error)
+
+	// stores the record of an idempotency key; returns ErrObjectExists
+	// if the key is already taken
+	AddIdempotencyRecord(ctx context.Context, r model.IdempotencyRecord) error
+
+	// returns ErrIdempotencyRecordNotFound if not found or expired
+	GetIdempotencyRecord(ctx context.Context, key string) (*model.IdempotencyRecord, error)
+
+	// records the response of the request made with the key
+	SetIdempotencyResponse(ctx context.Context, key string, resp model.IdempotencyResponse) error
+
+	// frees the key, e.g. if the request failed and may be retried
+	DeleteIdempotencyRecord(ctx context.Context, key string) error
+
+	// counts an auth request received at the time, per hour
+	IncAuthRequestCount(ctx context.Context, t time.Time) error
+
+	// aggregates the state of the devices and their activity since the
+	// time
+	GetStatistics(ctx context.Context, since time.Time) (*model.Statistics, error)
+
+	// server signing keys are global, the tenant in the context is ignored
+	AddServerKey(ctx context.Context, key model.ServerKey) error
+
+	// list server signing keys not retired, newest first
+	GetServerKeys(ctx context.Context) ([]model.ServerKey, error)
+
+	// marks the server signing key as retired at given time; returns
+	// ErrServerKeyNotFound if not found or already retired
+	RetireServerKey(ctx context.Context, id string, now time.Time) error
+
 	MigrateTenant(ctx context.Context, version string, tenant string) error
 	WithAutomigrate() DataStore
 }
@@ -17,12 +17,27 @@ import context "context"
 import mock "github.com/stretchr/testify/mock"
 import model "github.com/mendersoftware/deviceauth/model"
 import store "github.com/mendersoftware/deviceauth/store"
+import time "time"
 
 // DataStore is an autogenerated mock type for the DataStore type
 type DataStore struct {
 	mock.Mock
 }
 
+// AddAuthNonce provides a mock function with given fields: ctx, n
+func (_m *DataStore) AddAuthNonce(ctx context.Context, n model.AuthNonce) error {
+	ret := _m.Called(ctx, n)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.AuthNonce) error); ok {
+		r0 = rf(ctx, n)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // AddAuthSet provides a mock function with given fields: ctx, set
 func (_m *DataStore) AddAuthSet(ctx context.Context, set model.AuthSet) error {
 	ret := _m.Called(ctx, set)
@@ -37,6 +52,43 @@ func (_m *DataStore) AddAuthSet(ctx context.Context, set model.AuthSet) error {
 	return r0
 }
 
+// AddAuthSets provides a mock function with given fields: ctx, sets
+func (_m *DataStore) AddAuthSets(ctx context.Context, sets []model.AuthSet) ([]error, error) {
+	ret := _m.Called(ctx, sets)
+
+	var r0 []error
+	if rf, ok := ret.Get(0).(func(context.Context, []model.AuthSet) []error); ok {
+		r0 = rf(ctx, sets)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.AuthSet) error); ok {
+		r1 = rf(ctx, sets)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddBootstrapToken provides a mock function with given fields: ctx, t
+func (_m *DataStore) AddBootstrapToken(ctx context.Context, t model.BootstrapToken) error {
+	ret := _m.Called(ctx, t)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.BootstrapToken) error); ok {
+		r0 = rf(ctx, t)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // AddDevice provides a mock function with given fields: ctx, d
 func (_m *DataStore) AddDevice(ctx context.Context, d model.Device) error {
 	ret := _m.Called(ctx, d)
@@ -51,13 +103,13 @@ func (_m *DataStore) AddDevice(ctx context.Context, d model.Device) error {
 	return r0
 }
 
-// AddToken provides a mock function with given fields: ctx, t
-func (_m *DataStore) AddToken(ctx context.Context, t model.Token) error {
-	ret := _m.Called(ctx, t)
+// AddDeviceCode provides a mock function with given fields: ctx, c
+func (_m *DataStore) AddDeviceCode(ctx context.Context, c model.DeviceCode) error {
+	ret := _m.Called(ctx, c)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, model.Token) error); ok {
-		r0 = rf(ctx, t)
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceCode) error); ok {
+		r0 = rf(ctx, c)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -65,13 +117,13 @@ func (_m *DataStore) AddToken(ctx context.Context, t model.Token) error {
 	return r0
 }
 
-// DeleteAuthSetForDevice provides a mock function with given fields: ctx, devId, authId
-func (_m *DataStore) DeleteAuthSetForDevice(ctx context.Context, devId string, authId string) error {
-	ret := _m.Called(ctx, devId, authId)
+// AddDeviceStatusChange provides a mock function with given fields: ctx, r
+func (_m *DataStore) AddDeviceStatusChange(ctx context.Context, r model.DeviceStatusChange) error {
+	ret := _m.Called(ctx, r)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
-		r0 = rf(ctx, devId, authId)
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceStatusChange) error); ok {
+		r0 = rf(ctx, r)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -79,13 +131,13 @@ func (_m *DataStore) DeleteAuthSetForDevice(ctx context.Context, devId string, a
 	return r0
 }
 
-// DeleteAuthSetsForDevice provides a mock function with given fields: ctx, devid
-func (_m *DataStore) DeleteAuthSetsForDevice(ctx context.Context, devid string) error {
-	ret := _m.Called(ctx, devid)
+// AddDeviceStatusChanges provides a mock function with given fields: ctx, rs
+func (_m *DataStore) AddDeviceStatusChanges(ctx context.Context, rs []model.DeviceStatusChange) error {
+	ret := _m.Called(ctx, rs)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, devid)
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceStatusChange) error); ok {
+		r0 = rf(ctx, rs)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -93,13 +145,36 @@ func (_m *DataStore) DeleteAuthSetsForDevice(ctx context.Context, devid string)
 	return r0
 }
 
-// DeleteDevice provides a mock function with given fields: ctx, id
-func (_m *DataStore) DeleteDevice(ctx context.Context, id string) error {
-	ret := _m.Called(ctx, id)
+// AddDevices provides a mock function with given fields: ctx, devs
+func (_m *DataStore) AddDevices(ctx context.Context, devs []model.Device) ([]error, error) {
+	ret := _m.Called(ctx, devs)
+
+	var r0 []error
+	if rf, ok := ret.Get(0).(func(context.Context, []model.Device) []error); ok {
+		r0 = rf(ctx, devs)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.Device) error); ok {
+		r1 = rf(ctx, devs)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddIdempotencyRecord provides a mock function with given fields: ctx, r
+func (_m *DataStore) AddIdempotencyRecord(ctx context.Context, r model.IdempotencyRecord) error {
+	ret := _m.Called(ctx, r)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, id)
+	if rf, ok := ret.Get(0).(func(context.Context, model.IdempotencyRecord) error); ok {
+		r0 = rf(ctx, r)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -107,13 +182,13 @@ func (_m *DataStore) DeleteDevice(ctx context.Context, id string) error {
 	return r0
 }
 
-// DeleteToken provides a mock function with given fields: ctx, jti
-func (_m *DataStore) DeleteToken(ctx context.Context, jti string) error {
-	ret := _m.Called(ctx, jti)
+// AddOffboardingToken provides a mock function with given fields: ctx, t
+func (_m *DataStore) AddOffboardingToken(ctx context.Context, t model.OffboardingToken) error {
+	ret := _m.Called(ctx, t)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, jti)
+	if rf, ok := ret.Get(0).(func(context.Context, model.OffboardingToken) error); ok {
+		r0 = rf(ctx, t)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -121,13 +196,13 @@ func (_m *DataStore) DeleteToken(ctx context.Context, jti string) error {
 	return r0
 }
 
-// DeleteTokenByDevId provides a mock function with given fields: ctx, dev_id
-func (_m *DataStore) DeleteTokenByDevId(ctx context.Context, dev_id string) error {
-	ret := _m.Called(ctx, dev_id)
+// AddRefreshToken provides a mock function with given fields: ctx, t
+func (_m *DataStore) AddRefreshToken(ctx context.Context, t model.RefreshToken) error {
+	ret := _m.Called(ctx, t)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, dev_id)
+	if rf, ok := ret.Get(0).(func(context.Context, model.RefreshToken) error); ok {
+		r0 = rf(ctx, t)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -135,13 +210,13 @@ func (_m *DataStore) DeleteTokenByDevId(ctx context.Context, dev_id string) erro
 	return r0
 }
 
-// DeleteTokens provides a mock function with given fields: ctx
-func (_m *DataStore) DeleteTokens(ctx context.Context) error {
-	ret := _m.Called(ctx)
+// AddServerKey provides a mock function with given fields: ctx, key
+func (_m *DataStore) AddServerKey(ctx context.Context, key model.ServerKey) error {
+	ret := _m.Called(ctx, key)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
-		r0 = rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, model.ServerKey) error); ok {
+		r0 = rf(ctx, key)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -149,68 +224,78 @@ func (_m *DataStore) DeleteTokens(ctx context.Context) error {
 	return r0
 }
 
-// GetAuthSetById provides a mock function with given fields: ctx, id
-func (_m *DataStore) GetAuthSetById(ctx context.Context, id string) (*model.AuthSet, error) {
-	ret := _m.Called(ctx, id)
+// AddToken provides a mock function with given fields: ctx, t
+func (_m *DataStore) AddToken(ctx context.Context, t model.Token) error {
+	ret := _m.Called(ctx, t)
 
-	var r0 *model.AuthSet
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.AuthSet); ok {
-		r0 = rf(ctx, id)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.Token) error); ok {
+		r0 = rf(ctx, t)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.AuthSet)
-		}
+		r0 = ret.Error(0)
 	}
 
-	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, id)
+	return r0
+}
+
+// AddTokenAuditRecord provides a mock function with given fields: ctx, r
+func (_m *DataStore) AddTokenAuditRecord(ctx context.Context, r model.TokenAuditRecord) error {
+	ret := _m.Called(ctx, r)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.TokenAuditRecord) error); ok {
+		r0 = rf(ctx, r)
 	} else {
-		r1 = ret.Error(1)
+		r0 = ret.Error(0)
 	}
 
-	return r0, r1
+	return r0
 }
 
-// GetAuthSetByIdDataHashKey provides a mock function with given fields: ctx, idDataHash, key
-func (_m *DataStore) GetAuthSetByIdDataHashKey(ctx context.Context, idDataHash []byte, key string) (*model.AuthSet, error) {
-	ret := _m.Called(ctx, idDataHash, key)
+// AddTransfer provides a mock function with given fields: ctx, t
+func (_m *DataStore) AddTransfer(ctx context.Context, t model.Transfer) error {
+	ret := _m.Called(ctx, t)
 
-	var r0 *model.AuthSet
-	if rf, ok := ret.Get(0).(func(context.Context, []byte, string) *model.AuthSet); ok {
-		r0 = rf(ctx, idDataHash, key)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.Transfer) error); ok {
+		r0 = rf(ctx, t)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.AuthSet)
-		}
+		r0 = ret.Error(0)
 	}
 
-	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, []byte, string) error); ok {
-		r1 = rf(ctx, idDataHash, key)
+	return r0
+}
+
+// ClaimDecommission provides a mock function with given fields: ctx, id, now
+func (_m *DataStore) ClaimDecommission(ctx context.Context, id string, now time.Time) error {
+	ret := _m.Called(ctx, id, now)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, id, now)
 	} else {
-		r1 = ret.Error(1)
+		r0 = ret.Error(0)
 	}
 
-	return r0, r1
+	return r0
 }
 
-// GetAuthSets provides a mock function with given fields: ctx, skip, limit, filter
-func (_m *DataStore) GetAuthSets(ctx context.Context, skip int, limit int, filter store.AuthSetFilter) ([]model.DevAdmAuthSet, error) {
-	ret := _m.Called(ctx, skip, limit, filter)
+// ClaimOffboardingToken provides a mock function with given fields: ctx, idDataHash, pubkey, now
+func (_m *DataStore) ClaimOffboardingToken(ctx context.Context, idDataHash []byte, pubkey string, now time.Time) (*model.OffboardingToken, error) {
+	ret := _m.Called(ctx, idDataHash, pubkey, now)
 
-	var r0 []model.DevAdmAuthSet
-	if rf, ok := ret.Get(0).(func(context.Context, int, int, store.AuthSetFilter) []model.DevAdmAuthSet); ok {
-		r0 = rf(ctx, skip, limit, filter)
+	var r0 *model.OffboardingToken
+	if rf, ok := ret.Get(0).(func(context.Context, []byte, string, time.Time) *model.OffboardingToken); ok {
+		r0 = rf(ctx, idDataHash, pubkey, now)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.DevAdmAuthSet)
+			r0 = ret.Get(0).(*model.OffboardingToken)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, int, int, store.AuthSetFilter) error); ok {
-		r1 = rf(ctx, skip, limit, filter)
+	if rf, ok := ret.Get(1).(func(context.Context, []byte, string, time.Time) error); ok {
+		r1 = rf(ctx, idDataHash, pubkey, now)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -218,43 +303,34 @@ func (_m *DataStore) GetAuthSets(ctx context.Context, skip int, limit int, filte
 	return r0, r1
 }
 
-// GetAuthSetsForDevice provides a mock function with given fields: ctx, devid
-func (_m *DataStore) GetAuthSetsForDevice(ctx context.Context, devid string) ([]model.AuthSet, error) {
-	ret := _m.Called(ctx, devid)
-
-	var r0 []model.AuthSet
-	if rf, ok := ret.Get(0).(func(context.Context, string) []model.AuthSet); ok {
-		r0 = rf(ctx, devid)
-	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.AuthSet)
-		}
-	}
+// ClearConflicts provides a mock function with given fields: ctx, devIds
+func (_m *DataStore) ClearConflicts(ctx context.Context, devIds []string) error {
+	ret := _m.Called(ctx, devIds)
 
-	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, devid)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string) error); ok {
+		r0 = rf(ctx, devIds)
 	} else {
-		r1 = ret.Error(1)
+		r0 = ret.Error(0)
 	}
 
-	return r0, r1
+	return r0
 }
 
-// GetDevCountByStatus provides a mock function with given fields: ctx, status
-func (_m *DataStore) GetDevCountByStatus(ctx context.Context, status string) (int, error) {
-	ret := _m.Called(ctx, status)
+// CountDevices provides a mock function with given fields: ctx, filter
+func (_m *DataStore) CountDevices(ctx context.Context, filter store.DeviceFilter) (int, error) {
+	ret := _m.Called(ctx, filter)
 
 	var r0 int
-	if rf, ok := ret.Get(0).(func(context.Context, string) int); ok {
-		r0 = rf(ctx, status)
+	if rf, ok := ret.Get(0).(func(context.Context, store.DeviceFilter) int); ok {
+		r0 = rf(ctx, filter)
 	} else {
 		r0 = ret.Get(0).(int)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, status)
+	if rf, ok := ret.Get(1).(func(context.Context, store.DeviceFilter) error); ok {
+		r1 = rf(ctx, filter)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -262,45 +338,50 @@ func (_m *DataStore) GetDevCountByStatus(ctx context.Context, status string) (in
 	return r0, r1
 }
 
-// GetDeviceById provides a mock function with given fields: ctx, id
-func (_m *DataStore) GetDeviceById(ctx context.Context, id string) (*model.Device, error) {
-	ret := _m.Called(ctx, id)
+// DeleteAuthSetForDevice provides a mock function with given fields: ctx, devId, authId
+func (_m *DataStore) DeleteAuthSetForDevice(ctx context.Context, devId string, authId string) error {
+	ret := _m.Called(ctx, devId, authId)
 
-	var r0 *model.Device
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Device); ok {
-		r0 = rf(ctx, id)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, devId, authId)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.Device)
-		}
+		r0 = ret.Error(0)
 	}
 
-	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, id)
+	return r0
+}
+
+// DeleteAuthSetRefreshTokens provides a mock function with given fields: ctx, authId
+func (_m *DataStore) DeleteAuthSetRefreshTokens(ctx context.Context, authId string) error {
+	ret := _m.Called(ctx, authId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, authId)
 	} else {
-		r1 = ret.Error(1)
+		r0 = ret.Error(0)
 	}
 
-	return r0, r1
+	return r0
 }
 
-// GetDeviceByIdentityDataHash provides a mock function with given fields: ctx, idataHash
-func (_m *DataStore) GetDeviceByIdentityDataHash(ctx context.Context, idataHash []byte) (*model.Device, error) {
-	ret := _m.Called(ctx, idataHash)
+// DeleteAuthSetTokens provides a mock function with given fields: ctx, authId
+func (_m *DataStore) DeleteAuthSetTokens(ctx context.Context, authId string) ([]string, error) {
+	ret := _m.Called(ctx, authId)
 
-	var r0 *model.Device
-	if rf, ok := ret.Get(0).(func(context.Context, []byte) *model.Device); ok {
-		r0 = rf(ctx, idataHash)
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, string) []string); ok {
+		r0 = rf(ctx, authId)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.Device)
+			r0 = ret.Get(0).([]string)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, []byte) error); ok {
-		r1 = rf(ctx, idataHash)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, authId)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -308,43 +389,800 @@ func (_m *DataStore) GetDeviceByIdentityDataHash(ctx context.Context, idataHash
 	return r0, r1
 }
 
-// GetDeviceStatus provides a mock function with given fields: ctx, dev_id
-func (_m *DataStore) GetDeviceStatus(ctx context.Context, dev_id string) (string, error) {
-	ret := _m.Called(ctx, dev_id)
+// DeleteAuthSetsForDevice provides a mock function with given fields: ctx, devid
+func (_m *DataStore) DeleteAuthSetsForDevice(ctx context.Context, devid string) error {
+	ret := _m.Called(ctx, devid)
 
-	var r0 string
-	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
-		r0 = rf(ctx, dev_id)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, devid)
 	} else {
-		r0 = ret.Get(0).(string)
+		r0 = ret.Error(0)
 	}
 
-	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, dev_id)
+	return r0
+}
+
+// DeleteDevice provides a mock function with given fields: ctx, id
+func (_m *DataStore) DeleteDevice(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
 	} else {
-		r1 = ret.Error(1)
+		r0 = ret.Error(0)
 	}
 
-	return r0, r1
+	return r0
 }
 
-// GetDevices provides a mock function with given fields: ctx, skip, limit, filter
-func (_m *DataStore) GetDevices(ctx context.Context, skip uint, limit uint, filter store.DeviceFilter) ([]model.Device, error) {
-	ret := _m.Called(ctx, skip, limit, filter)
+// DeleteDeviceCode provides a mock function with given fields: ctx, id
+func (_m *DataStore) DeleteDeviceCode(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
 
-	var r0 []model.Device
-	if rf, ok := ret.Get(0).(func(context.Context, uint, uint, store.DeviceFilter) []model.Device); ok {
-		r0 = rf(ctx, skip, limit, filter)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteDeviceCodes provides a mock function with given fields: ctx, tenantId
+func (_m *DataStore) DeleteDeviceCodes(ctx context.Context, tenantId string) error {
+	ret := _m.Called(ctx, tenantId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, tenantId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteExpiredToken provides a mock function with given fields: ctx, jti
+func (_m *DataStore) DeleteExpiredToken(ctx context.Context, jti string) error {
+	ret := _m.Called(ctx, jti)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, jti)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteExpiredTokens provides a mock function with given fields: ctx, now, batchSize
+func (_m *DataStore) DeleteExpiredTokens(ctx context.Context, now time.Time, batchSize int) (int, error) {
+	ret := _m.Called(ctx, now, batchSize)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int) int); ok {
+		r0 = rf(ctx, now, batchSize)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int) error); ok {
+		r1 = rf(ctx, now, batchSize)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteIdempotencyRecord provides a mock function with given fields: ctx, key
+func (_m *DataStore) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	ret := _m.Called(ctx, key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteOldestDeviceTokens provides a mock function with given fields: ctx, devId, keep
+func (_m *DataStore) DeleteOldestDeviceTokens(ctx context.Context, devId string, keep int) ([]string, error) {
+	ret := _m.Called(ctx, devId, keep)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []string); ok {
+		r0 = rf(ctx, devId, keep)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, devId, keep)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteRefreshTokens provides a mock function with given fields: ctx, tenantId, deviceId
+func (_m *DataStore) DeleteRefreshTokens(ctx context.Context, tenantId string, deviceId string) error {
+	ret := _m.Called(ctx, tenantId, deviceId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, tenantId, deviceId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteToken provides a mock function with given fields: ctx, jti
+func (_m *DataStore) DeleteToken(ctx context.Context, jti string) error {
+	ret := _m.Called(ctx, jti)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, jti)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteTokenByDevId provides a mock function with given fields: ctx, dev_id
+func (_m *DataStore) DeleteTokenByDevId(ctx context.Context, dev_id string) error {
+	ret := _m.Called(ctx, dev_id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, dev_id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteTokens provides a mock function with given fields: ctx
+func (_m *DataStore) DeleteTokens(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetAuthSetById provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetAuthSetById(ctx context.Context, id string) (*model.AuthSet, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.AuthSet
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.AuthSet); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AuthSet)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAuthSetByIdDataHashKey provides a mock function with given fields: ctx, idDataHash, key
+func (_m *DataStore) GetAuthSetByIdDataHashKey(ctx context.Context, idDataHash []byte, key string) (*model.AuthSet, error) {
+	ret := _m.Called(ctx, idDataHash, key)
+
+	var r0 *model.AuthSet
+	if rf, ok := ret.Get(0).(func(context.Context, []byte, string) *model.AuthSet); ok {
+		r0 = rf(ctx, idDataHash, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AuthSet)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []byte, string) error); ok {
+		r1 = rf(ctx, idDataHash, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAuthSets provides a mock function with given fields: ctx, skip, limit, filter
+func (_m *DataStore) GetAuthSets(ctx context.Context, skip int, limit int, filter store.AuthSetFilter) ([]model.DevAdmAuthSet, error) {
+	ret := _m.Called(ctx, skip, limit, filter)
+
+	var r0 []model.DevAdmAuthSet
+	if rf, ok := ret.Get(0).(func(context.Context, int, int, store.AuthSetFilter) []model.DevAdmAuthSet); ok {
+		r0 = rf(ctx, skip, limit, filter)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DevAdmAuthSet)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int, int, store.AuthSetFilter) error); ok {
+		r1 = rf(ctx, skip, limit, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAuthSetsByPubKey provides a mock function with given fields: ctx, key
+func (_m *DataStore) GetAuthSetsByPubKey(ctx context.Context, key string) ([]model.AuthSet, error) {
+	ret := _m.Called(ctx, key)
+
+	var r0 []model.AuthSet
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.AuthSet); ok {
+		r0 = rf(ctx, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.AuthSet)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAuthSetsForDevice provides a mock function with given fields: ctx, devid
+func (_m *DataStore) GetAuthSetsForDevice(ctx context.Context, devid string) ([]model.AuthSet, error) {
+	ret := _m.Called(ctx, devid)
+
+	var r0 []model.AuthSet
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.AuthSet); ok {
+		r0 = rf(ctx, devid)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.AuthSet)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, devid)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevCountByStatus provides a mock function with given fields: ctx, status
+func (_m *DataStore) GetDevCountByStatus(ctx context.Context, status string) (int, error) {
+	ret := _m.Called(ctx, status)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string) int); ok {
+		r0 = rf(ctx, status)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, status)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevCounts provides a mock function with given fields: ctx
+func (_m *DataStore) GetDevCounts(ctx context.Context) (*model.DeviceCounts, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.DeviceCounts
+	if rf, ok := ret.Get(0).(func(context.Context) *model.DeviceCounts); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceCounts)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceById provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetDeviceById(ctx context.Context, id string) (*model.Device, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Device); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceByIdentityDataHash provides a mock function with given fields: ctx, idataHash
+func (_m *DataStore) GetDeviceByIdentityDataHash(ctx context.Context, idataHash []byte) (*model.Device, error) {
+	ret := _m.Called(ctx, idataHash)
+
+	var r0 *model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, []byte) *model.Device); ok {
+		r0 = rf(ctx, idataHash)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []byte) error); ok {
+		r1 = rf(ctx, idataHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceCode provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetDeviceCode(ctx context.Context, id string) (*model.DeviceCode, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.DeviceCode
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.DeviceCode); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceCode)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceCodeByUserCode provides a mock function with given fields: ctx, userCode
+func (_m *DataStore) GetDeviceCodeByUserCode(ctx context.Context, userCode string) (*model.DeviceCode, error) {
+	ret := _m.Called(ctx, userCode)
+
+	var r0 *model.DeviceCode
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.DeviceCode); ok {
+		r0 = rf(ctx, userCode)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceCode)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userCode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceStatus provides a mock function with given fields: ctx, dev_id
+func (_m *DataStore) GetDeviceStatus(ctx context.Context, dev_id string) (string, error) {
+	ret := _m.Called(ctx, dev_id)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, dev_id)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, dev_id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceStatusChanges provides a mock function with given fields: ctx, after, limit
+func (_m *DataStore) GetDeviceStatusChanges(ctx context.Context, after *store.Cursor, limit uint) ([]model.DeviceStatusChange, error) {
+	ret := _m.Called(ctx, after, limit)
+
+	var r0 []model.DeviceStatusChange
+	if rf, ok := ret.Get(0).(func(context.Context, *store.Cursor, uint) []model.DeviceStatusChange); ok {
+		r0 = rf(ctx, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceStatusChange)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *store.Cursor, uint) error); ok {
+		r1 = rf(ctx, after, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceStatusHistory provides a mock function with given fields: ctx, devId, skip, limit
+func (_m *DataStore) GetDeviceStatusHistory(ctx context.Context, devId string, skip uint, limit uint) ([]model.DeviceStatusChange, error) {
+	ret := _m.Called(ctx, devId, skip, limit)
+
+	var r0 []model.DeviceStatusChange
+	if rf, ok := ret.Get(0).(func(context.Context, string, uint, uint) []model.DeviceStatusChange); ok {
+		r0 = rf(ctx, devId, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceStatusChange)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, uint, uint) error); ok {
+		r1 = rf(ctx, devId, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevices provides a mock function with given fields: ctx, skip, limit, filter
+func (_m *DataStore) GetDevices(ctx context.Context, skip uint, limit uint, filter store.DeviceFilter) ([]model.Device, error) {
+	ret := _m.Called(ctx, skip, limit, filter)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, uint, uint, store.DeviceFilter) []model.Device); ok {
+		r0 = rf(ctx, skip, limit, filter)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uint, uint, store.DeviceFilter) error); ok {
+		r1 = rf(ctx, skip, limit, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetIdempotencyRecord provides a mock function with given fields: ctx, key
+func (_m *DataStore) GetIdempotencyRecord(ctx context.Context, key string) (*model.IdempotencyRecord, error) {
+	ret := _m.Called(ctx, key)
+
+	var r0 *model.IdempotencyRecord
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.IdempotencyRecord); ok {
+		r0 = rf(ctx, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.IdempotencyRecord)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLimit provides a mock function with given fields: ctx, name
+func (_m *DataStore) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 *model.Limit
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Limit); ok {
+		r0 = rf(ctx, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Limit)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOffboardingToken provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetOffboardingToken(ctx context.Context, id string) (*model.OffboardingToken, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.OffboardingToken
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.OffboardingToken); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.OffboardingToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOffboardingTokens provides a mock function with given fields: ctx, skip, limit
+func (_m *DataStore) GetOffboardingTokens(ctx context.Context, skip uint, limit uint) ([]model.OffboardingToken, error) {
+	ret := _m.Called(ctx, skip, limit)
+
+	var r0 []model.OffboardingToken
+	if rf, ok := ret.Get(0).(func(context.Context, uint, uint) []model.OffboardingToken); ok {
+		r0 = rf(ctx, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.OffboardingToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uint, uint) error); ok {
+		r1 = rf(ctx, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPendingTransferByIdDataHash provides a mock function with given fields: ctx, tenantId, idDataHash
+func (_m *DataStore) GetPendingTransferByIdDataHash(ctx context.Context, tenantId string, idDataHash []byte) (*model.Transfer, error) {
+	ret := _m.Called(ctx, tenantId, idDataHash)
+
+	var r0 *model.Transfer
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte) *model.Transfer); ok {
+		r0 = rf(ctx, tenantId, idDataHash)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Transfer)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []byte) error); ok {
+		r1 = rf(ctx, tenantId, idDataHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRevokedTokens provides a mock function with given fields: ctx, since, skip, limit
+func (_m *DataStore) GetRevokedTokens(ctx context.Context, since time.Time, skip uint, limit uint) ([]model.RevokedToken, error) {
+	ret := _m.Called(ctx, since, skip, limit)
+
+	var r0 []model.RevokedToken
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, uint, uint) []model.RevokedToken); ok {
+		r0 = rf(ctx, since, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.RevokedToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, uint, uint) error); ok {
+		r1 = rf(ctx, since, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetScheduledDecommissions provides a mock function with given fields: ctx, until, skip, limit
+func (_m *DataStore) GetScheduledDecommissions(ctx context.Context, until time.Time, skip uint, limit uint) ([]model.Device, error) {
+	ret := _m.Called(ctx, until, skip, limit)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, uint, uint) []model.Device); ok {
+		r0 = rf(ctx, until, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, uint, uint) error); ok {
+		r1 = rf(ctx, until, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetServerKeys provides a mock function with given fields: ctx
+func (_m *DataStore) GetServerKeys(ctx context.Context) ([]model.ServerKey, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.ServerKey
+	if rf, ok := ret.Get(0).(func(context.Context) []model.ServerKey); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ServerKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetStaleRejectedDevices provides a mock function with given fields: ctx, before, skip, limit
+func (_m *DataStore) GetStaleRejectedDevices(ctx context.Context, before time.Time, skip uint, limit uint) ([]model.Device, error) {
+	ret := _m.Called(ctx, before, skip, limit)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, uint, uint) []model.Device); ok {
+		r0 = rf(ctx, before, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, uint, uint) error); ok {
+		r1 = rf(ctx, before, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetStatistics provides a mock function with given fields: ctx, since
+func (_m *DataStore) GetStatistics(ctx context.Context, since time.Time) (*model.Statistics, error) {
+	ret := _m.Called(ctx, since)
+
+	var r0 *model.Statistics
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) *model.Statistics); ok {
+		r0 = rf(ctx, since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Statistics)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTenantIds provides a mock function with given fields: ctx
+func (_m *DataStore) GetTenantIds(ctx context.Context) ([]string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetToken provides a mock function with given fields: ctx, jti
+func (_m *DataStore) GetToken(ctx context.Context, jti string) (*model.Token, error) {
+	ret := _m.Called(ctx, jti)
+
+	var r0 *model.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Token); ok {
+		r0 = rf(ctx, jti)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.Device)
+			r0 = ret.Get(0).(*model.Token)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, uint, uint, store.DeviceFilter) error); ok {
-		r1 = rf(ctx, skip, limit, filter)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, jti)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -352,22 +1190,45 @@ func (_m *DataStore) GetDevices(ctx context.Context, skip uint, limit uint, filt
 	return r0, r1
 }
 
-// GetLimit provides a mock function with given fields: ctx, name
-func (_m *DataStore) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
-	ret := _m.Called(ctx, name)
+// GetTokenAuditRecords provides a mock function with given fields: ctx, filter, skip, limit
+func (_m *DataStore) GetTokenAuditRecords(ctx context.Context, filter store.TokenAuditFilter, skip uint, limit uint) ([]model.TokenAuditRecord, error) {
+	ret := _m.Called(ctx, filter, skip, limit)
 
-	var r0 *model.Limit
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Limit); ok {
-		r0 = rf(ctx, name)
+	var r0 []model.TokenAuditRecord
+	if rf, ok := ret.Get(0).(func(context.Context, store.TokenAuditFilter, uint, uint) []model.TokenAuditRecord); ok {
+		r0 = rf(ctx, filter, skip, limit)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.Limit)
+			r0 = ret.Get(0).([]model.TokenAuditRecord)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, store.TokenAuditFilter, uint, uint) error); ok {
+		r1 = rf(ctx, filter, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTokensByDevId provides a mock function with given fields: ctx, dev_id
+func (_m *DataStore) GetTokensByDevId(ctx context.Context, dev_id string) ([]model.Token, error) {
+	ret := _m.Called(ctx, dev_id)
+
+	var r0 []model.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.Token); ok {
+		r0 = rf(ctx, dev_id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Token)
 		}
 	}
 
 	var r1 error
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, name)
+		r1 = rf(ctx, dev_id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -375,22 +1236,57 @@ func (_m *DataStore) GetLimit(ctx context.Context, name string) (*model.Limit, e
 	return r0, r1
 }
 
-// GetToken provides a mock function with given fields: ctx, jti
-func (_m *DataStore) GetToken(ctx context.Context, jti string) (*model.Token, error) {
-	ret := _m.Called(ctx, jti)
+// GetTransfer provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetTransfer(ctx context.Context, id string) (*model.Transfer, error) {
+	ret := _m.Called(ctx, id)
 
-	var r0 *model.Token
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Token); ok {
-		r0 = rf(ctx, jti)
+	var r0 *model.Transfer
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Transfer); ok {
+		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.Token)
+			r0 = ret.Get(0).(*model.Transfer)
 		}
 	}
 
 	var r1 error
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, jti)
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IncAuthRequestCount provides a mock function with given fields: ctx, t
+func (_m *DataStore) IncAuthRequestCount(ctx context.Context, t time.Time) error {
+	ret := _m.Called(ctx, t)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) error); ok {
+		r0 = rf(ctx, t)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// IsTenantSuspended provides a mock function with given fields: ctx
+func (_m *DataStore) IsTenantSuspended(ctx context.Context) (bool, error) {
+	ret := _m.Called(ctx)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context) bool); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -426,6 +1322,153 @@ func (_m *DataStore) PutLimit(ctx context.Context, lim model.Limit) error {
 	return r0
 }
 
+// ReleaseBootstrapToken provides a mock function with given fields: ctx, id, usedAt
+func (_m *DataStore) ReleaseBootstrapToken(ctx context.Context, id string, usedAt time.Time) error {
+	ret := _m.Called(ctx, id, usedAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, id, usedAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReleaseQuarantinedDevice provides a mock function with given fields: ctx, id, status
+func (_m *DataStore) ReleaseQuarantinedDevice(ctx context.Context, id string, status string) error {
+	ret := _m.Called(ctx, id, status)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, status)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RetireServerKey provides a mock function with given fields: ctx, id, now
+func (_m *DataStore) RetireServerKey(ctx context.Context, id string, now time.Time) error {
+	ret := _m.Called(ctx, id, now)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, id, now)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetDeviceDecommissionAt provides a mock function with given fields: ctx, id, at
+func (_m *DataStore) SetDeviceDecommissionAt(ctx context.Context, id string, at *time.Time) error {
+	ret := _m.Called(ctx, id, at)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *time.Time) error); ok {
+		r0 = rf(ctx, id, at)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetDeviceGroup provides a mock function with given fields: ctx, id, group
+func (_m *DataStore) SetDeviceGroup(ctx context.Context, id string, group string) error {
+	ret := _m.Called(ctx, id, group)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, group)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetDeviceStatus provides a mock function with given fields: ctx, id, status
+func (_m *DataStore) SetDeviceStatus(ctx context.Context, id string, status string) (string, error) {
+	ret := _m.Called(ctx, id, status)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) string); ok {
+		r0 = rf(ctx, id, status)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, id, status)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetDevicesLastCheckin provides a mock function with given fields: ctx, checkins
+func (_m *DataStore) SetDevicesLastCheckin(ctx context.Context, checkins []model.DeviceCheckin) error {
+	ret := _m.Called(ctx, checkins)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceCheckin) error); ok {
+		r0 = rf(ctx, checkins)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetIdempotencyResponse provides a mock function with given fields: ctx, key, resp
+func (_m *DataStore) SetIdempotencyResponse(ctx context.Context, key string, resp model.IdempotencyResponse) error {
+	ret := _m.Called(ctx, key, resp)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.IdempotencyResponse) error); ok {
+		r0 = rf(ctx, key, resp)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTenantSuspended provides a mock function with given fields: ctx, suspended
+func (_m *DataStore) SetTenantSuspended(ctx context.Context, suspended bool) error {
+	ret := _m.Called(ctx, suspended)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, bool) error); ok {
+		r0 = rf(ctx, suspended)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTokensLastUsed provides a mock function with given fields: ctx, usage
+func (_m *DataStore) SetTokensLastUsed(ctx context.Context, usage []model.TokenUsage) error {
+	ret := _m.Called(ctx, usage)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []model.TokenUsage) error); ok {
+		r0 = rf(ctx, usage)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpdateAuthSet provides a mock function with given fields: ctx, filter, mod
 func (_m *DataStore) UpdateAuthSet(ctx context.Context, filter interface{}, mod model.AuthSetUpdate) error {
 	ret := _m.Called(ctx, filter, mod)
@@ -454,6 +1497,145 @@ func (_m *DataStore) UpdateDevice(ctx context.Context, d model.Device, up model.
 	return r0
 }
 
+// UpdateDeviceAnnotations provides a mock function with given fields: ctx, id, a
+func (_m *DataStore) UpdateDeviceAnnotations(ctx context.Context, id string, a model.DeviceAnnotations) error {
+	ret := _m.Called(ctx, id, a)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.DeviceAnnotations) error); ok {
+		r0 = rf(ctx, id, a)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateDeviceCode provides a mock function with given fields: ctx, id, up
+func (_m *DataStore) UpdateDeviceCode(ctx context.Context, id string, up model.DeviceCodeUpdate) error {
+	ret := _m.Called(ctx, id, up)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.DeviceCodeUpdate) error); ok {
+		r0 = rf(ctx, id, up)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateTokenExpiration provides a mock function with given fields: ctx, jti, expiresAt
+func (_m *DataStore) UpdateTokenExpiration(ctx context.Context, jti string, expiresAt time.Time) error {
+	ret := _m.Called(ctx, jti, expiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, jti, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateTransfer provides a mock function with given fields: ctx, id, status, up
+func (_m *DataStore) UpdateTransfer(ctx context.Context, id string, status string, up model.TransferUpdate) error {
+	ret := _m.Called(ctx, id, status, up)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, model.TransferUpdate) error); ok {
+		r0 = rf(ctx, id, status, up)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UseAuthNonce provides a mock function with given fields: ctx, id, now
+func (_m *DataStore) UseAuthNonce(ctx context.Context, id string, now time.Time) (*model.AuthNonce, error) {
+	ret := _m.Called(ctx, id, now)
+
+	var r0 *model.AuthNonce
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) *model.AuthNonce); ok {
+		r0 = rf(ctx, id, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AuthNonce)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, id, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UseBootstrapToken provides a mock function with given fields: ctx, id, idDataHash, now
+func (_m *DataStore) UseBootstrapToken(ctx context.Context, id string, idDataHash []byte, now time.Time) (*model.BootstrapToken, error) {
+	ret := _m.Called(ctx, id, idDataHash, now)
+
+	var r0 *model.BootstrapToken
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte, time.Time) *model.BootstrapToken); ok {
+		r0 = rf(ctx, id, idDataHash, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.BootstrapToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []byte, time.Time) error); ok {
+		r1 = rf(ctx, id, idDataHash, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UseOffboardingToken provides a mock function with given fields: ctx, id, now
+func (_m *DataStore) UseOffboardingToken(ctx context.Context, id string, now time.Time) error {
+	ret := _m.Called(ctx, id, now)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, id, now)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UseRefreshToken provides a mock function with given fields: ctx, id, now
+func (_m *DataStore) UseRefreshToken(ctx context.Context, id string, now time.Time) (*model.RefreshToken, error) {
+	ret := _m.Called(ctx, id, now)
+
+	var r0 *model.RefreshToken
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) *model.RefreshToken); ok {
+		r0 = rf(ctx, id, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.RefreshToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, id, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // WithAutomigrate provides a mock function with given fields:
 func (_m *DataStore) WithAutomigrate() store.DataStore {
 	ret := _m.Called()
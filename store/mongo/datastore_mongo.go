@@ -17,7 +17,10 @@ package mongo
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"net"
+	"regexp"
+	"sort"
 	"sync"
 	"time"
 
@@ -35,16 +38,76 @@ import (
 )
 
 const (
-	DbVersion     = "1.5.0"
+	DbVersion     = "1.7.0"
 	DbName        = "deviceauth"
 	DbDevicesColl = "devices"
 	DbAuthSetColl = "auth_sets"
 	DbTokensColl  = "tokens"
 	DbLimitsColl  = "limits"
 
+	DbDeviceCodesColl = "device_codes"
+	DbTransfersColl   = "transfers"
+
+	DbOffboardingTokensColl = "offboarding_tokens"
+	DbServerKeysColl        = "server_keys"
+	DbAuthNoncesColl        = "auth_nonces"
+	DbRefreshTokensColl     = "refresh_tokens"
+	DbBootstrapTokensColl   = "bootstrap_tokens"
+	DbRevokedTokensColl     = "revoked_tokens"
+	DbTokenAuditColl        = "token_audit"
+	DbStatusHistoryColl     = "status_history"
+	DbIdempotencyColl       = "idempotency_records"
+	DbAuthRequestCountsColl = "auth_request_counts"
+	DbTenantStatusColl      = "tenant_status"
+
 	indexDevices_IdentityData                       = "devices:IdentityData"
+	indexDevices_DecommissionAt                     = "devices:DecommissionAt"
+	indexDevices_Status                             = "devices:Status"
+	indexDevices_IdentityDataValues                 = "devices:IdentityDataValues"
+	indexDevices_CreatedTs                          = "devices:CreatedTs"
+	indexDevices_Group                              = "devices:Group"
+	indexDevices_UpdatedTs                          = "devices:UpdatedTs"
+	indexDevices_Conflict                           = "devices:Conflict"
+	indexDevices_Alias                              = "devices:Alias"
 	indexAuthSet_DeviceId_IdentityData_PubKey       = "auth_sets:DeviceId:IdData:PubKey"
 	indexAuthSet_DeviceId_IdentityDataSha256_PubKey = "auth_sets:IdDataSha256:PubKey"
+	indexAuthSet_Status_Timestamp                   = "auth_sets:Status:Ts"
+	indexAuthSet_PubKey                             = "auth_sets:PubKey"
+	indexDeviceCodes_UserCode                       = "device_codes:UserCode"
+	indexDeviceCodes_ExpiresAt                      = "device_codes:ExpiresAt"
+	indexTransfers_IdDataSha256                     = "transfers:IdDataSha256"
+	indexOffboardingTokens_IdDataSha256_PubKey      = "offboarding_tokens:IdDataSha256:PubKey"
+	indexAuthNonces_ExpiresAt                       = "auth_nonces:ExpiresAt"
+	indexRefreshTokens_ExpiresAt                    = "refresh_tokens:ExpiresAt"
+	indexRefreshTokens_TenantId_DeviceId            = "refresh_tokens:TenantId:DeviceId"
+	indexBootstrapTokens_ExpiresAt                  = "bootstrap_tokens:ExpiresAt"
+	indexRevokedTokens_RevokedTs                    = "revoked_tokens:RevokedTs"
+	indexTokens_Exp                                 = "tokens:Exp"
+	indexTokens_ExpiresAt                           = "tokens:ExpiresAt"
+	indexTokens_DevId_IssuedTs                      = "tokens:DevId:IssuedTs"
+	indexTokenAudit_Timestamp                       = "token_audit:Timestamp"
+	indexTokenAudit_DeviceId_Timestamp              = "token_audit:DeviceId:Timestamp"
+	indexStatusHistory_DeviceId_Timestamp           = "status_history:DeviceId:Timestamp"
+	indexStatusHistory_Timestamp                    = "status_history:Timestamp"
+	indexIdempotencyRecords_CreatedTs               = "idempotency_records:CreatedTs"
+	indexAuthRequestCounts_Hour                     = "auth_request_counts:Hour"
+
+	// how long token revocations are kept by default, the default
+	// token lifetime
+	DefaultRevokedTokenRetention = 7 * 24 * time.Hour
+
+	// how long token audit records are kept by default
+	DefaultTokenAuditRetention = 90 * 24 * time.Hour
+
+	// how long idempotency keys are kept by default
+	DefaultIdempotencyKeyRetention = 24 * time.Hour
+
+	// how long the hourly auth request counts are kept, a day more than
+	// the longest statistics period
+	AuthRequestCountRetention = 8 * 24 * time.Hour
+
+	// id of the only document of the tenant status collection
+	tenantStatusId = "tenant"
 )
 
 var (
@@ -73,6 +136,10 @@ type DataStoreMongo struct {
 	session     *mgo.Session
 	automigrate bool
 	multitenant bool
+
+	revokedTokenRetention   time.Duration
+	tokenAuditRetention     time.Duration
+	idempotencyKeyRetention time.Duration
 }
 
 func NewDataStoreMongoWithSession(session *mgo.Session) *DataStoreMongo {
@@ -144,9 +211,32 @@ func (db *DataStoreMongo) GetDevices(ctx context.Context, skip, limit uint, filt
 
 	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
 
+	query := deviceQuery(filter)
+	if filter.After != nil {
+		var field string
+		var value interface{}
+		switch filter.Sort.Field {
+		case store.DeviceSortCreatedTs:
+			if filter.After.Ts == nil {
+				return nil, store.ErrInvalidCursor
+			}
+			field, value = model.DevKeyCreatedTs, *filter.After.Ts
+		case store.DeviceSortStatus:
+			field, value = model.DevKeyStatus, filter.After.Str
+		}
+		if field == "" {
+			// sorted by id only
+			query["_id"] = bson.M{rangeOp(filter.Sort.Desc): filter.After.Id}
+		} else {
+			query["$or"] = rangeAfter(field, value, filter.Sort.Desc,
+				filter.After.Id, false)
+		}
+	}
+
 	res := []model.Device{}
 
-	err := c.Find(filter).Sort("_id").Skip(int(skip)).Limit(int(limit)).All(&res)
+	err := c.Find(query).Sort(deviceSortFields(filter.Sort)...).
+		Skip(int(skip)).Limit(int(limit)).All(&res)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to fetch device list")
 	}
@@ -210,6 +300,10 @@ func (db *DataStoreMongo) AddDevice(ctx context.Context, d model.Device) error {
 		d.Id = bson.NewObjectId().Hex()
 	}
 
+	if d.IdDataStruct != nil {
+		d.IdDataValues = idDataValues(d.IdDataStruct)
+	}
+
 	if err := c.Insert(d); err != nil {
 		if mgo.IsDup(err) {
 			return store.ErrObjectExists
@@ -219,6 +313,175 @@ func (db *DataStoreMongo) AddDevice(ctx context.Context, d model.Device) error {
 	return nil
 }
 
+func (db *DataStoreMongo) AddDevices(ctx context.Context, devs []model.Device) ([]error, error) {
+	if len(devs) == 0 {
+		return nil, nil
+	}
+
+	s := db.session.Copy()
+	defer s.Close()
+
+	if err := db.EnsureIndexes(ctx, s); err != nil {
+		return nil, err
+	}
+
+	bulk := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl).Bulk()
+	bulk.Unordered()
+
+	for _, d := range devs {
+		if d.Id == "" {
+			d.Id = bson.NewObjectId().Hex()
+		}
+		if d.IdDataStruct != nil {
+			d.IdDataValues = idDataValues(d.IdDataStruct)
+		}
+		bulk.Insert(d)
+	}
+
+	_, err := bulk.Run()
+	return bulkInsertErrors(err, len(devs), "failed to store devices")
+}
+
+// bulkInsertErrors sorts the error of an unordered bulk insert of n
+// documents out by document, duplicates get store.ErrObjectExists;
+// errors which can't be attributed to a document are returned as such
+func bulkInsertErrors(err error, n int, msg string) ([]error, error) {
+	errs := make([]error, n)
+	if err == nil {
+		return errs, nil
+	}
+
+	berr, ok := err.(*mgo.BulkError)
+	if !ok {
+		return nil, errors.Wrap(err, msg)
+	}
+
+	for _, c := range berr.Cases() {
+		if c.Index < 0 || c.Index >= n {
+			return nil, errors.Wrap(err, msg)
+		}
+		if mgo.IsDup(c.Err) {
+			errs[c.Index] = store.ErrObjectExists
+		} else {
+			errs[c.Index] = errors.Wrap(c.Err, msg)
+		}
+	}
+
+	return errs, nil
+}
+
+func (db *DataStoreMongo) CountDevices(ctx context.Context, filter store.DeviceFilter) (int, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+
+	count, err := c.Find(deviceQuery(filter)).Count()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to count devices")
+	}
+	return count, nil
+}
+
+// deviceQuery returns the query selecting the devices matching the
+// filter, regardless of the cursor
+func deviceQuery(filter store.DeviceFilter) bson.M {
+	query := bson.M{}
+	if filter.Status != "" {
+		query[model.DevKeyStatus] = filter.Status
+	}
+	if filter.Group != "" {
+		query[model.DevKeyGroup] = filter.Group
+	}
+	if filter.Search != "" {
+		var term interface{} = filter.Search
+		if !filter.SearchExact {
+			term = bson.RegEx{
+				Pattern: regexp.QuoteMeta(filter.Search),
+				Options: "i",
+			}
+		}
+		// under $and, the cursor of a paginated listing is an $or too
+		query["$and"] = []bson.M{{"$or": []bson.M{
+			{model.DevKeyIdDataValues: term},
+			{model.DevKeyAlias: term},
+		}}}
+	}
+	if filter.CreatedAfter != nil || filter.CreatedBefore != nil {
+		created := bson.M{}
+		if filter.CreatedAfter != nil {
+			created["$gt"] = *filter.CreatedAfter
+		}
+		if filter.CreatedBefore != nil {
+			created["$lt"] = *filter.CreatedBefore
+		}
+		query[model.DevKeyCreatedTs] = created
+	}
+	if filter.UpdatedAfter != nil {
+		query[model.DevKeyUpdatedTs] = bson.M{"$gt": *filter.UpdatedAfter}
+	}
+	if filter.Conflict {
+		query[model.DevKeyConflict] = true
+	}
+	return query
+}
+
+// deviceSortFields returns the fields to sort devices by, ids breaking
+// ties for stable paging
+func deviceSortFields(sort store.DeviceSort) []string {
+	field := "_id"
+	switch sort.Field {
+	case store.DeviceSortCreatedTs:
+		field = model.DevKeyCreatedTs
+	case store.DeviceSortStatus:
+		field = model.DevKeyStatus
+	}
+	if sort.Desc {
+		field = "-" + field
+	}
+
+	if field == "_id" || field == "-_id" {
+		return []string{field}
+	}
+	return []string{field, "_id"}
+}
+
+// rangeOp returns the operator selecting the values following a value in
+// ascending or descending order
+func rangeOp(desc bool) string {
+	if desc {
+		return "$lt"
+	}
+	return "$gt"
+}
+
+// rangeAfter returns the '$or' clauses selecting the items following the
+// item with the value and id in a listing sorted by the field, then by id
+func rangeAfter(field string, value interface{}, desc bool, id string, idDesc bool) []bson.M {
+	return []bson.M{
+		{field: bson.M{rangeOp(desc): value}},
+		{field: value, "_id": bson.M{rangeOp(idDesc): id}},
+	}
+}
+
+// idDataValues lists the identity attribute values, those of array
+// attributes one by one, as strings
+func idDataValues(idData map[string]interface{}) []string {
+	values := []string{}
+	for _, v := range idData {
+		switch v := v.(type) {
+		case []interface{}:
+			for _, e := range v {
+				values = append(values, fmt.Sprint(e))
+			}
+		default:
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
 func (db *DataStoreMongo) UpdateDevice(ctx context.Context,
 	d model.Device, updev model.DeviceUpdate) error {
 
@@ -240,6 +503,251 @@ func (db *DataStoreMongo) UpdateDevice(ctx context.Context,
 	return nil
 }
 
+func (db *DataStoreMongo) SetDeviceStatus(ctx context.Context, id, status string) (string, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+
+	var prev model.Device
+	_, err := c.Find(bson.M{
+		"_id":              id,
+		model.DevKeyStatus: bson.M{"$ne": model.DevStatusQuarantined},
+	}).Select(bson.M{model.DevKeyStatus: 1}).
+		Apply(mgo.Change{
+			Update: bson.M{
+				"$set": bson.M{
+					model.DevKeyStatus: status,
+					"updated_ts":       time.Now().UTC(),
+				},
+			},
+		}, &prev)
+	if err == mgo.ErrNotFound {
+		// missing or quarantined
+		n, err := c.FindId(id).Count()
+		if err != nil {
+			return "", errors.Wrap(err, "failed to update device status")
+		}
+		if n == 0 {
+			return "", store.ErrDevNotFound
+		}
+		return model.DevStatusQuarantined, nil
+	} else if err != nil {
+		return "", errors.Wrap(err, "failed to update device status")
+	}
+
+	return prev.Status, nil
+}
+
+func (db *DataStoreMongo) ReleaseQuarantinedDevice(ctx context.Context, id, status string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+
+	err := c.Update(bson.M{
+		"_id":              id,
+		model.DevKeyStatus: model.DevStatusQuarantined,
+	}, bson.M{
+		"$set": bson.M{
+			model.DevKeyStatus: status,
+			"updated_ts":       time.Now().UTC(),
+		},
+	})
+	if err == mgo.ErrNotFound {
+		return store.ErrDevNotFound
+	} else if err != nil {
+		return errors.Wrap(err, "failed to release quarantined device")
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) SetDeviceDecommissionAt(ctx context.Context, id string, at *time.Time) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+
+	update := bson.M{
+		"$set":   bson.M{"updated_ts": time.Now().UTC()},
+		"$unset": bson.M{model.DevKeyDecommissionAt: ""},
+	}
+	if at != nil {
+		update = bson.M{
+			"$set": bson.M{
+				model.DevKeyDecommissionAt: *at,
+				"updated_ts":               time.Now().UTC(),
+			},
+		}
+	}
+
+	if err := c.UpdateId(id, update); err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrDevNotFound
+		}
+		return errors.Wrap(err, "failed to update device")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) ClaimDecommission(ctx context.Context, id string, now time.Time) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+
+	filter := bson.M{
+		"_id":                      id,
+		model.DevKeyDecommissionAt: bson.M{"$lte": now},
+	}
+	change := mgo.Change{
+		Update: bson.M{
+			"$set":   bson.M{"updated_ts": time.Now().UTC()},
+			"$unset": bson.M{model.DevKeyDecommissionAt: ""},
+		},
+	}
+	if _, err := c.Find(filter).Apply(change, nil); err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrDevNotFound
+		}
+		return errors.Wrap(err, "failed to update device")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) SetDeviceGroup(ctx context.Context, id, group string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+
+	update := bson.M{
+		"$set":   bson.M{"updated_ts": time.Now().UTC()},
+		"$unset": bson.M{model.DevKeyGroup: ""},
+	}
+	if group != "" {
+		update = bson.M{
+			"$set": bson.M{
+				model.DevKeyGroup: group,
+				"updated_ts":      time.Now().UTC(),
+			},
+		}
+	}
+
+	if err := c.UpdateId(id, update); err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrDevNotFound
+		}
+		return errors.Wrap(err, "failed to update device")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) UpdateDeviceAnnotations(ctx context.Context, id string, a model.DeviceAnnotations) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+
+	set := bson.M{"updated_ts": time.Now().UTC()}
+	unset := bson.M{}
+	if a.Alias != nil {
+		if *a.Alias == "" {
+			unset[model.DevKeyAlias] = ""
+		} else {
+			set[model.DevKeyAlias] = *a.Alias
+		}
+	}
+	if a.Notes != nil {
+		if *a.Notes == "" {
+			unset[model.DevKeyNotes] = ""
+		} else {
+			set[model.DevKeyNotes] = *a.Notes
+		}
+	}
+	if a.Group != nil {
+		if *a.Group == "" {
+			unset[model.DevKeyGroup] = ""
+		} else {
+			set[model.DevKeyGroup] = *a.Group
+		}
+	}
+	for k, v := range a.Labels {
+		key := model.DevKeyLabels + "." + k
+		if v == nil {
+			unset[key] = ""
+		} else {
+			set[key] = *v
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	if err := c.UpdateId(id, update); err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrDevNotFound
+		}
+		return errors.Wrap(err, "failed to update device")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetScheduledDecommissions(ctx context.Context, until time.Time, skip, limit uint) ([]model.Device, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+
+	cond := bson.M{"$exists": true}
+	if !until.IsZero() {
+		cond["$lte"] = until
+	}
+
+	res := []model.Device{}
+
+	err := c.Find(bson.M{model.DevKeyDecommissionAt: cond}).
+		Sort(model.DevKeyDecommissionAt, "_id").
+		Skip(int(skip)).Limit(int(limit)).All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch scheduled decommissions")
+	}
+	return res, nil
+}
+
+func (db *DataStoreMongo) GetStaleRejectedDevices(ctx context.Context, before time.Time, skip, limit uint) ([]model.Device, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+
+	query := bson.M{
+		model.DevKeyStatus: model.DevStatusRejected,
+		"$or": []bson.M{
+			{model.DevKeyLastCheckin: bson.M{"$lt": before}},
+			{
+				model.DevKeyLastCheckin: bson.M{"$exists": false},
+				model.DevKeyUpdatedTs:   bson.M{"$lt": before},
+			},
+		},
+	}
+
+	res := []model.Device{}
+
+	err := c.Find(query).Sort("_id").
+		Skip(int(skip)).Limit(int(limit)).All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch stale rejected devices")
+	}
+	return res, nil
+}
+
 func (db *DataStoreMongo) DeleteDevice(ctx context.Context, id string) error {
 	s := db.session.Copy()
 	defer s.Close()
@@ -254,90 +762,339 @@ func (db *DataStoreMongo) DeleteDevice(ctx context.Context, id string) error {
 		}
 	}
 
-	return nil
+	return nil
+}
+
+func (db *DataStoreMongo) AddToken(ctx context.Context, t model.Token) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	if err := db.EnsureIndexes(ctx, s); err != nil {
+		return err
+	}
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
+
+	if err := c.Insert(t); err != nil {
+		return errors.Wrap(err, "failed to store token")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetToken(ctx context.Context, jti string) (*model.Token, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
+
+	res := model.Token{}
+
+	err := c.FindId(jti).One(&res)
+
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, store.ErrTokenNotFound
+		} else {
+			return nil, errors.Wrap(err, "failed to fetch token")
+		}
+	}
+
+	return &res, nil
+}
+
+func (db *DataStoreMongo) DeleteToken(ctx context.Context, jti string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	database := s.DB(ctxstore.DbFromContext(ctx, DbName))
+	err := database.C(DbTokensColl).RemoveId(jti)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrTokenNotFound
+		} else {
+			return errors.Wrap(err, "failed to remove token")
+		}
+	}
+
+	return db.addRevokedTokens(database, []string{jti})
+}
+
+func (db *DataStoreMongo) DeleteExpiredToken(ctx context.Context, jti string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
+	if err := c.RemoveId(jti); err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrTokenNotFound
+		}
+		return errors.Wrap(err, "failed to remove token")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) UpdateTokenExpiration(ctx context.Context, jti string, expiresAt time.Time) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
+	err := c.UpdateId(jti, bson.M{"$set": bson.M{"expires_at": expiresAt}})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrTokenNotFound
+		}
+		return errors.Wrap(err, "failed to update token")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteTokens(ctx context.Context) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	database := s.DB(ctxstore.DbFromContext(ctx, DbName))
+	_, err := db.removeTokens(database, nil)
+
+	return err
+}
+
+func (db *DataStoreMongo) DeleteTokenByDevId(ctx context.Context, devId string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	database := s.DB(ctxstore.DbFromContext(ctx, DbName))
+	ids, err := db.removeTokens(database, bson.M{"dev_id": devId})
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		return store.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteAuthSetTokens(ctx context.Context, authId string) ([]string, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	database := s.DB(ctxstore.DbFromContext(ctx, DbName))
+	return db.removeTokens(database, bson.M{"auth_id": authId})
+}
+
+// removeTokens removes the tokens matching the filter and records them as
+// revoked; returns the ids of the removed tokens
+func (db *DataStoreMongo) removeTokens(database *mgo.Database, filter bson.M) ([]string, error) {
+	c := database.C(DbTokensColl)
+
+	var toks []struct {
+		Id string `bson:"_id"`
+	}
+	if err := c.Find(filter).Select(bson.M{"_id": 1}).All(&toks); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch tokens")
+	}
+	if len(toks) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(toks))
+	for i, t := range toks {
+		ids[i] = t.Id
+	}
+
+	// remove only the tokens about to be recorded
+	if _, err := c.RemoveAll(bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return nil, errors.Wrap(err, "failed to remove tokens")
+	}
+
+	if err := db.addRevokedTokens(database, ids); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
 }
 
-func (db *DataStoreMongo) AddToken(ctx context.Context, t model.Token) error {
+func (db *DataStoreMongo) GetTokensByDevId(ctx context.Context, devId string) ([]model.Token, error) {
 	s := db.session.Copy()
 	defer s.Close()
 
-	if err := db.EnsureIndexes(ctx, s); err != nil {
-		return err
-	}
-
 	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
 
-	if err := c.Insert(t); err != nil {
-		return errors.Wrap(err, "failed to store token")
+	res := []model.Token{}
+	if err := c.Find(bson.M{"dev_id": devId}).All(&res); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch tokens")
 	}
 
-	return nil
+	return res, nil
 }
 
-func (db *DataStoreMongo) GetToken(ctx context.Context, jti string) (*model.Token, error) {
+func (db *DataStoreMongo) SetTokensLastUsed(ctx context.Context, usage []model.TokenUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+
 	s := db.session.Copy()
 	defer s.Close()
 
-	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
+	database := s.DB(ctxstore.DbFromContext(ctx, DbName))
 
-	res := model.Token{}
+	tokens := database.C(DbTokensColl).Bulk()
+	tokens.Unordered()
+	devices := database.C(DbDevicesColl).Bulk()
+	devices.Unordered()
 
-	err := c.FindId(jti).One(&res)
+	for _, u := range usage {
+		tokens.Update(bson.M{"_id": u.TokenId},
+			bson.M{"$max": bson.M{"last_used": u.LastUsed}})
+		devices.Update(bson.M{"_id": u.DeviceId},
+			bson.M{"$max": bson.M{"token_last_used": u.LastUsed}})
+	}
 
-	if err != nil {
-		if err == mgo.ErrNotFound {
-			return nil, store.ErrTokenNotFound
-		} else {
-			return nil, errors.Wrap(err, "failed to fetch token")
-		}
+	if _, err := tokens.Run(); err != nil {
+		return errors.Wrap(err, "failed to update tokens")
+	}
+	if _, err := devices.Run(); err != nil {
+		return errors.Wrap(err, "failed to update devices")
 	}
 
-	return &res, nil
+	return nil
 }
 
-func (db *DataStoreMongo) DeleteToken(ctx context.Context, jti string) error {
+func (db *DataStoreMongo) SetDevicesLastCheckin(ctx context.Context, checkins []model.DeviceCheckin) error {
+	if len(checkins) == 0 {
+		return nil
+	}
+
 	s := db.session.Copy()
 	defer s.Close()
 
-	c := db.session.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
-	err := c.RemoveId(jti)
-	if err != nil {
-		if err == mgo.ErrNotFound {
-			return store.ErrTokenNotFound
-		} else {
-			return errors.Wrap(err, "failed to remove token")
-		}
+	bulk := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl).Bulk()
+	bulk.Unordered()
+
+	for _, c := range checkins {
+		bulk.Update(bson.M{"_id": c.DeviceId},
+			bson.M{"$max": bson.M{model.DevKeyLastCheckin: c.Time}})
+	}
+
+	if _, err := bulk.Run(); err != nil {
+		return errors.Wrap(err, "failed to update devices")
 	}
 
 	return nil
 }
 
-func (db *DataStoreMongo) DeleteTokens(ctx context.Context) error {
+func (db *DataStoreMongo) ensureTokenExpIndexes(c *mgo.Collection) error {
+	for _, idx := range []mgo.Index{
+		{
+			Key:        []string{"exp"},
+			Name:       indexTokens_Exp,
+			Sparse:     true,
+			Background: false,
+		},
+		{
+			Key:        []string{"expires_at"},
+			Name:       indexTokens_ExpiresAt,
+			Sparse:     true,
+			Background: false,
+		},
+	} {
+		if err := c.EnsureIndex(idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteExpiredTokens(ctx context.Context, now time.Time, batchSize int) (int, error) {
 	s := db.session.Copy()
 	defer s.Close()
 
-	c := db.session.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
-	_, err := c.RemoveAll(nil)
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
 
-	return err
+	if err := db.ensureTokenExpIndexes(c); err != nil {
+		return 0, err
+	}
+
+	// tokens issued before the 'exp' claim was stored are left alone,
+	// unless they have sliding expiration
+	filter := bson.M{"$or": []bson.M{
+		{"exp": bson.M{"$lte": now}},
+		{"expires_at": bson.M{"$lte": now}},
+	}}
+
+	removed := 0
+	for {
+		var toks []struct {
+			Id string `bson:"_id"`
+		}
+		err := c.Find(filter).Select(bson.M{"_id": 1}).
+			Limit(batchSize).All(&toks)
+		if err != nil {
+			return removed, errors.Wrap(err, "failed to fetch expired tokens")
+		}
+		if len(toks) == 0 {
+			return removed, nil
+		}
+
+		ids := make([]string, len(toks))
+		for i, t := range toks {
+			ids[i] = t.Id
+		}
+
+		ci, err := c.RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return removed, errors.Wrap(err, "failed to remove expired tokens")
+		}
+		removed += ci.Removed
+
+		if len(toks) < batchSize {
+			return removed, nil
+		}
+	}
 }
 
-func (db *DataStoreMongo) DeleteTokenByDevId(ctx context.Context, devId string) error {
+func (db *DataStoreMongo) DeleteOldestDeviceTokens(ctx context.Context, devId string, keep int) ([]string, error) {
 	s := db.session.Copy()
 	defer s.Close()
 
-	c := db.session.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
-	ci, err := c.RemoveAll(bson.M{"dev_id": devId})
+	database := s.DB(ctxstore.DbFromContext(ctx, DbName))
+	c := database.C(DbTokensColl)
 
-	if ci.Removed == 0 {
-		return store.ErrTokenNotFound
+	if err := c.EnsureIndex(mgo.Index{
+		Key:        []string{"dev_id", "issued_ts"},
+		Name:       indexTokens_DevId_IssuedTs,
+		Background: false,
+	}); err != nil {
+		return nil, err
 	}
 
+	// tokens issued before the issue time was stored sort first, as the
+	// oldest
+	var toks []struct {
+		Id string `bson:"_id"`
+	}
+	err := c.Find(bson.M{"dev_id": devId}).Sort("-issued_ts").
+		Skip(keep).Select(bson.M{"_id": 1}).All(&toks)
 	if err != nil {
-		return errors.Wrap(err, "failed to remove tokens")
+		return nil, errors.Wrap(err, "failed to fetch tokens")
+	}
+	if len(toks) == 0 {
+		return nil, nil
 	}
 
-	return nil
+	ids := make([]string, len(toks))
+	for i, t := range toks {
+		ids[i] = t.Id
+	}
+
+	if _, err := db.removeTokens(database, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
 
 func (db *DataStoreMongo) Migrate(ctx context.Context, version string) error {
@@ -421,6 +1178,14 @@ func (db *DataStoreMongo) MigrateTenant(ctx context.Context, database, version s
 			ms:  db,
 			ctx: ctx,
 		},
+		&migration_1_6_0{
+			ms:  db,
+			ctx: ctx,
+		},
+		&migration_1_7_0{
+			ms:  db,
+			ctx: ctx,
+		},
 	}
 
 	ver, err := migrate.NewVersion(version)
@@ -433,6 +1198,13 @@ func (db *DataStoreMongo) MigrateTenant(ctx context.Context, database, version s
 		return errors.Wrap(err, "failed to apply migrations")
 	}
 
+	// the retention is configured, and may change between versions
+	s := db.session.Copy()
+	defer s.Close()
+	if err := db.ensureRevokedTokenIndexes(s.DB(database)); err != nil {
+		return errors.Wrap(err, "failed to ensure revoked tokens index")
+	}
+
 	return nil
 }
 
@@ -459,6 +1231,32 @@ func (db *DataStoreMongo) AddAuthSet(ctx context.Context, set model.AuthSet) err
 	return nil
 }
 
+func (db *DataStoreMongo) AddAuthSets(ctx context.Context, sets []model.AuthSet) ([]error, error) {
+	if len(sets) == 0 {
+		return nil, nil
+	}
+
+	s := db.session.Copy()
+	defer s.Close()
+
+	if err := db.EnsureIndexes(ctx, s); err != nil {
+		return nil, err
+	}
+
+	bulk := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbAuthSetColl).Bulk()
+	bulk.Unordered()
+
+	for _, set := range sets {
+		if set.Id == "" {
+			set.Id = bson.NewObjectId().Hex()
+		}
+		bulk.Insert(set)
+	}
+
+	_, err := bulk.Run()
+	return bulkInsertErrors(err, len(sets), "failed to store auth sets")
+}
+
 func (db *DataStoreMongo) GetAuthSetByIdDataHashKey(ctx context.Context, idDataHash []byte, key string) (*model.AuthSet, error) {
 	s := db.session.Copy()
 	defer s.Close()
@@ -525,13 +1323,57 @@ func (db *DataStoreMongo) GetAuthSetsForDevice(ctx context.Context, devid string
 	return res, nil
 }
 
+func (db *DataStoreMongo) GetAuthSetsByPubKey(ctx context.Context, key string) ([]model.AuthSet, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbAuthSetColl)
+
+	res := []model.AuthSet{}
+
+	err := c.Find(bson.M{model.AuthSetKeyPubKey: key}).All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch auth sets")
+	}
+
+	return res, nil
+}
+
+func (db *DataStoreMongo) ClearConflicts(ctx context.Context, devIds []string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	database := s.DB(ctxstore.DbFromContext(ctx, DbName))
+
+	unset := bson.M{"$unset": bson.M{model.DevKeyConflict: ""}}
+
+	_, err := database.C(DbAuthSetColl).UpdateAll(
+		bson.M{model.AuthSetKeyDeviceId: bson.M{"$in": devIds}}, unset)
+	if err != nil {
+		return errors.Wrap(err, "failed to clear auth set conflicts")
+	}
+
+	_, err = database.C(DbDevicesColl).UpdateAll(
+		bson.M{"_id": bson.M{"$in": devIds}}, unset)
+	if err != nil {
+		return errors.Wrap(err, "failed to clear device conflicts")
+	}
+
+	return nil
+}
+
 func (db *DataStoreMongo) UpdateAuthSet(ctx context.Context, filter interface{}, mod model.AuthSetUpdate) error {
 	s := db.session.Copy()
 	defer s.Close()
 
 	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbAuthSetColl)
 
-	ci, err := c.UpdateAll(filter, bson.M{"$set": mod})
+	update := bson.M{"$set": mod}
+	if mod.ClearTPMAttestation {
+		update["$unset"] = bson.M{"tpm_attestation": ""}
+	}
+
+	ci, err := c.UpdateAll(filter, update)
 	if err != nil {
 		return errors.Wrap(err, "failed to update auth set")
 	} else if ci.Updated == 0 {
@@ -584,10 +1426,35 @@ func (db *DataStoreMongo) WithMultitenant() *DataStoreMongo {
 	return db
 }
 
+// WithRevokedTokenRetention sets how long token revocations are kept,
+// should not be shorter than the token lifetime
+func (db *DataStoreMongo) WithRevokedTokenRetention(d time.Duration) *DataStoreMongo {
+	db.revokedTokenRetention = d
+	return db
+}
+
+// WithTokenAuditRetention sets how long token audit records are kept
+func (db *DataStoreMongo) WithTokenAuditRetention(d time.Duration) *DataStoreMongo {
+	db.tokenAuditRetention = d
+	return db
+}
+
+// WithIdempotencyKeyRetention sets how long idempotency keys, and the
+// responses recorded for them, are kept
+func (db *DataStoreMongo) WithIdempotencyKeyRetention(d time.Duration) *DataStoreMongo {
+	db.idempotencyKeyRetention = d
+	return db
+}
+
 func (db *DataStoreMongo) WithAutomigrate() store.DataStore {
 	return &DataStoreMongo{
 		session:     db.session,
 		automigrate: true,
+
+		revokedTokenRetention: db.revokedTokenRetention,
+		tokenAuditRetention:   db.tokenAuditRetention,
+
+		idempotencyKeyRetention: db.idempotencyKeyRetention,
 	}
 }
 
@@ -606,6 +1473,120 @@ func (db *DataStoreMongo) EnsureIndexes(ctx context.Context, s *mgo.Session) err
 		return err
 	}
 
+	// devices scheduled for decommissioning
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+		C(DbDevicesColl).EnsureIndex(mgo.Index{
+		Key:        []string{model.DevKeyDecommissionAt},
+		Name:       indexDevices_DecommissionAt,
+		Sparse:     true,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// device counts per status
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+		C(DbDevicesColl).EnsureIndex(mgo.Index{
+		Key:        []string{model.DevKeyStatus},
+		Name:       indexDevices_Status,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// device search by identity attribute values
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+		C(DbDevicesColl).EnsureIndex(mgo.Index{
+		Key:        []string{model.DevKeyIdDataValues},
+		Name:       indexDevices_IdentityDataValues,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// device listing sorted by creation time
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+		C(DbDevicesColl).EnsureIndex(mgo.Index{
+		Key:        []string{model.DevKeyCreatedTs},
+		Name:       indexDevices_CreatedTs,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// device listing by group
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+		C(DbDevicesColl).EnsureIndex(mgo.Index{
+		Key:        []string{model.DevKeyGroup},
+		Name:       indexDevices_Group,
+		Sparse:     true,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// device listing by update time
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+		C(DbDevicesColl).EnsureIndex(mgo.Index{
+		Key:        []string{model.DevKeyUpdatedTs},
+		Name:       indexDevices_UpdatedTs,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// listing of devices in conflict
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+		C(DbDevicesColl).EnsureIndex(mgo.Index{
+		Key:        []string{model.DevKeyConflict},
+		Name:       indexDevices_Conflict,
+		Sparse:     true,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// device search by alias
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+		C(DbDevicesColl).EnsureIndex(mgo.Index{
+		Key:        []string{model.DevKeyAlias},
+		Name:       indexDevices_Alias,
+		Sparse:     true,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// auth set conflicts, the same key used by several devices
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+		C(DbAuthSetColl).EnsureIndex(mgo.Index{
+		Key:        []string{model.AuthSetKeyPubKey},
+		Name:       indexAuthSet_PubKey,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// pending auth sets by age, for statistics
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+		C(DbAuthSetColl).EnsureIndex(mgo.Index{
+		Key:        []string{model.AuthSetKeyStatus, model.AuthSetKeyTimestamp},
+		Name:       indexAuthSet_Status_Timestamp,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
 	// auth requests
 	return s.DB(ctxstore.DbFromContext(ctx, DbName)).
 		C(DbAuthSetColl).EnsureIndex(mgo.Index{
@@ -658,6 +1639,42 @@ func (db *DataStoreMongo) GetLimit(ctx context.Context, name string) (*model.Lim
 	return &lim, nil
 }
 
+func (db *DataStoreMongo) SetTenantSuspended(ctx context.Context, suspended bool) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTenantStatusColl)
+
+	status := model.TenantStatus{Suspended: suspended}
+	if suspended {
+		now := time.Now().UTC()
+		status.SuspendedTs = &now
+	}
+
+	if _, err := c.UpsertId(tenantStatusId, status); err != nil {
+		return errors.Wrap(err, "failed to update tenant status")
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) IsTenantSuspended(ctx context.Context) (bool, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTenantStatusColl)
+
+	var status model.TenantStatus
+	err := c.FindId(tenantStatusId).One(&status)
+	switch err {
+	case nil:
+		return status.Suspended, nil
+	case mgo.ErrNotFound:
+		return false, nil
+	default:
+		return false, errors.Wrap(err, "failed to fetch tenant status")
+	}
+}
+
 func (db *DataStoreMongo) GetDevCountByStatus(ctx context.Context, status string) (int, error) {
 	s := db.session.Copy()
 	defer s.Close()
@@ -803,6 +1820,37 @@ func (db *DataStoreMongo) GetDevCountByStatus(ctx context.Context, status string
 	return resp["count"].(int), err
 }
 
+func (db *DataStoreMongo) GetDevCounts(ctx context.Context) (*model.DeviceCounts, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+
+	total, err := c.Count()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count devices")
+	}
+	counts := &model.DeviceCounts{Count: total}
+
+	for _, cnt := range []struct {
+		status string
+		count  *int
+	}{
+		{model.DevStatusPending, &counts.Pending},
+		{model.DevStatusAccepted, &counts.Accepted},
+		{model.DevStatusRejected, &counts.Rejected},
+		{model.DevStatusPreauth, &counts.Preauthorized},
+		{model.DevStatusQuarantined, &counts.Quarantined},
+	} {
+		*cnt.count, err = c.Find(bson.M{model.DevKeyStatus: cnt.status}).Count()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to count %s devices", cnt.status)
+		}
+	}
+
+	return counts, nil
+}
+
 func (db *DataStoreMongo) GetDeviceStatus(ctx context.Context, devId string) (string, error) {
 	s := db.session.Copy()
 	defer s.Close()
@@ -903,3 +1951,18 @@ func getDeviceStatus(statuses map[string]int) (string, error) {
 func (db *DataStoreMongo) GetTenantDbs() ([]string, error) {
 	return migrate.GetTenantDbs(db.session, ctxstore.IsTenantDb(DbName))
 }
+
+func (db *DataStoreMongo) GetTenantIds(ctx context.Context) ([]string, error) {
+	tdbs, err := db.GetTenantDbs()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve tenant DBs")
+	}
+
+	ids := make([]string, 0, len(tdbs))
+	for _, tdb := range tdbs {
+		if id := ctxstore.TenantFromDbName(tdb, DbName); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// auth nonces are handed out before the device presents its tenant token,
+// so they are always kept in the common database
+
+func (db *DataStoreMongo) ensureAuthNonceIndexes(s *mgo.Session) error {
+	c := s.DB(DbName).C(DbAuthNoncesColl)
+
+	// expired nonces are removed by mongo
+	return c.EnsureIndex(mgo.Index{
+		Key:         []string{"expires_at"},
+		Name:        indexAuthNonces_ExpiresAt,
+		ExpireAfter: time.Second,
+		Background:  false,
+	})
+}
+
+func (db *DataStoreMongo) AddAuthNonce(ctx context.Context, n model.AuthNonce) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	if err := db.ensureAuthNonceIndexes(s); err != nil {
+		return err
+	}
+
+	c := s.DB(DbName).C(DbAuthNoncesColl)
+
+	if err := c.Insert(n); err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrObjectExists
+		}
+		return errors.Wrap(err, "failed to store auth nonce")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) UseAuthNonce(ctx context.Context, id string, now time.Time) (*model.AuthNonce, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbAuthNoncesColl)
+
+	var res model.AuthNonce
+
+	// mongo removes expired documents only periodically
+	_, err := c.Find(bson.M{
+		"_id":        id,
+		"expires_at": bson.M{"$gt": now},
+	}).Apply(mgo.Change{
+		Remove: true,
+	}, &res)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, store.ErrAuthNonceNotFound
+		}
+		return nil, errors.Wrap(err, "failed to remove auth nonce")
+	}
+
+	return &res, nil
+}
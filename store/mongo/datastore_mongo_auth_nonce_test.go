@@ -0,0 +1,78 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreAuthNonce(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreAuthNonce in short mode.")
+	}
+
+	// tenant context must not matter
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now()
+
+	activation := &model.TPMActivation{
+		EKCertificateDigest: []byte("ek"),
+		AKName:              []byte("ak"),
+		SecretDigest:        []byte("secret"),
+	}
+	assert.NoError(t, db.AddAuthNonce(ctx, model.AuthNonce{
+		Id:            "nonce1",
+		ExpiresAt:     now.Add(time.Minute),
+		TPMActivation: activation,
+	}))
+	assert.NoError(t, db.AddAuthNonce(ctx, model.AuthNonce{
+		Id:        "nonce2",
+		ExpiresAt: now.Add(-time.Minute),
+	}))
+
+	err := db.AddAuthNonce(ctx, model.AuthNonce{
+		Id:        "nonce1",
+		ExpiresAt: now.Add(time.Minute),
+	})
+	assert.EqualError(t, err, store.ErrObjectExists.Error())
+
+	// nonces can be used once
+	n, err := db.UseAuthNonce(context.Background(), "nonce1", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "nonce1", n.Id)
+	assert.Equal(t, activation, n.TPMActivation)
+	_, err = db.UseAuthNonce(ctx, "nonce1", now)
+	assert.EqualError(t, err, store.ErrAuthNonceNotFound.Error())
+
+	// expired, not removed by mongo yet
+	_, err = db.UseAuthNonce(ctx, "nonce2", now)
+	assert.EqualError(t, err, store.ErrAuthNonceNotFound.Error())
+
+	_, err = db.UseAuthNonce(ctx, "nonce3", now)
+	assert.EqualError(t, err, store.ErrAuthNonceNotFound.Error())
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func (db *DataStoreMongo) ensureBootstrapTokenIndexes(ctx context.Context, s *mgo.Session) error {
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbBootstrapTokensColl)
+
+	// expired tokens are removed by mongo
+	return c.EnsureIndex(mgo.Index{
+		Key:         []string{"expires_at"},
+		Name:        indexBootstrapTokens_ExpiresAt,
+		ExpireAfter: time.Second,
+		Background:  false,
+	})
+}
+
+func (db *DataStoreMongo) AddBootstrapToken(ctx context.Context, t model.BootstrapToken) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	if err := db.ensureBootstrapTokenIndexes(ctx, s); err != nil {
+		return err
+	}
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbBootstrapTokensColl)
+
+	if err := c.Insert(t); err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrObjectExists
+		}
+		return errors.Wrap(err, "failed to store bootstrap token")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) UseBootstrapToken(ctx context.Context, id string, idDataHash []byte, now time.Time) (*model.BootstrapToken, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbBootstrapTokensColl)
+
+	var res model.BootstrapToken
+
+	// find and mark in one go, the token is used once
+	_, err := c.Find(bson.M{
+		"_id":                        id,
+		model.AuthSetKeyIdDataSha256: idDataHash,
+		"used_ts":                    bson.M{"$exists": false},
+		"expires_at":                 bson.M{"$gt": now},
+	}).Apply(mgo.Change{
+		Update:    bson.M{"$set": bson.M{"used_ts": now}},
+		ReturnNew: true,
+	}, &res)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, store.ErrBootstrapTokenNotFound
+		}
+		return nil, errors.Wrap(err, "failed to use bootstrap token")
+	}
+
+	return &res, nil
+}
+
+func (db *DataStoreMongo) ReleaseBootstrapToken(ctx context.Context, id string, usedAt time.Time) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbBootstrapTokensColl)
+
+	err := c.Update(bson.M{
+		"_id":     id,
+		"used_ts": usedAt,
+	}, bson.M{
+		"$unset": bson.M{"used_ts": ""},
+	})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrBootstrapTokenNotFound
+		}
+		return errors.Wrap(err, "failed to release bootstrap token")
+	}
+
+	return nil
+}
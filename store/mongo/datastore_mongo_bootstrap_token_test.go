@@ -0,0 +1,81 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreBootstrapToken(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreBootstrapToken in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	tok := model.BootstrapToken{
+		Id:           "hash1",
+		IdDataSha256: []byte("idhash1"),
+		CreatedTs:    now,
+		ExpiresAt:    now.Add(time.Minute),
+	}
+
+	assert.NoError(t, db.AddBootstrapToken(ctx, tok))
+	assert.EqualError(t, db.AddBootstrapToken(ctx, tok),
+		store.ErrObjectExists.Error())
+
+	// other identity data
+	_, err := db.UseBootstrapToken(ctx, "hash1", []byte("idhash2"), now)
+	assert.EqualError(t, err, store.ErrBootstrapTokenNotFound.Error())
+
+	// expired
+	_, err = db.UseBootstrapToken(ctx, "hash1", []byte("idhash1"),
+		now.Add(time.Hour))
+	assert.EqualError(t, err, store.ErrBootstrapTokenNotFound.Error())
+
+	// other tenant
+	_, err = db.UseBootstrapToken(context.Background(), "hash1",
+		[]byte("idhash1"), now)
+	assert.EqualError(t, err, store.ErrBootstrapTokenNotFound.Error())
+
+	res, err := db.UseBootstrapToken(ctx, "hash1", []byte("idhash1"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, now, res.UsedTs.UTC())
+
+	// used once only
+	_, err = db.UseBootstrapToken(ctx, "hash1", []byte("idhash1"), now)
+	assert.EqualError(t, err, store.ErrBootstrapTokenNotFound.Error())
+
+	// released by the user only
+	err = db.ReleaseBootstrapToken(ctx, "hash1", now.Add(time.Second))
+	assert.EqualError(t, err, store.ErrBootstrapTokenNotFound.Error())
+	assert.NoError(t, db.ReleaseBootstrapToken(ctx, "hash1", now))
+	_, err = db.UseBootstrapToken(ctx, "hash1", []byte("idhash1"), now)
+	assert.NoError(t, err)
+}
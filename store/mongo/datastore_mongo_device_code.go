@@ -0,0 +1,151 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// device codes are looked up without tenant context (device polling for
+// a token, operator entering a user code), so they are always kept in the
+// common database; the tenant is recorded with each code instead
+
+func (db *DataStoreMongo) ensureDeviceCodeIndexes(s *mgo.Session) error {
+	c := s.DB(DbName).C(DbDeviceCodesColl)
+
+	err := c.EnsureIndex(mgo.Index{
+		Unique:     true,
+		Key:        []string{"user_code"},
+		Name:       indexDeviceCodes_UserCode,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// expired codes are removed by mongo
+	return c.EnsureIndex(mgo.Index{
+		Key:         []string{"expires_at"},
+		Name:        indexDeviceCodes_ExpiresAt,
+		ExpireAfter: time.Second,
+		Background:  false,
+	})
+}
+
+func (db *DataStoreMongo) AddDeviceCode(ctx context.Context, dc model.DeviceCode) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	if err := db.ensureDeviceCodeIndexes(s); err != nil {
+		return err
+	}
+
+	c := s.DB(DbName).C(DbDeviceCodesColl)
+
+	if err := c.Insert(dc); err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrObjectExists
+		}
+		return errors.Wrap(err, "failed to store device code")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetDeviceCode(ctx context.Context, id string) (*model.DeviceCode, error) {
+	return db.getDeviceCode(bson.M{"_id": id})
+}
+
+func (db *DataStoreMongo) GetDeviceCodeByUserCode(ctx context.Context, userCode string) (*model.DeviceCode, error) {
+	return db.getDeviceCode(bson.M{"user_code": userCode})
+}
+
+func (db *DataStoreMongo) getDeviceCode(filter bson.M) (*model.DeviceCode, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbDeviceCodesColl)
+
+	var res model.DeviceCode
+
+	err := c.Find(filter).One(&res)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, store.ErrDeviceCodeNotFound
+		}
+		return nil, errors.Wrap(err, "failed to fetch device code")
+	}
+
+	return &res, nil
+}
+
+func (db *DataStoreMongo) UpdateDeviceCode(ctx context.Context, id string, up model.DeviceCodeUpdate) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbDeviceCodesColl)
+
+	err := c.UpdateId(id, bson.M{"$set": up})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrDeviceCodeNotFound
+		}
+		return errors.Wrap(err, "failed to update device code")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteDeviceCode(ctx context.Context, id string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbDeviceCodesColl)
+
+	err := c.RemoveId(id)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrDeviceCodeNotFound
+		}
+		return errors.Wrap(err, "failed to remove device code")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteDeviceCodes(ctx context.Context, tenantId string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbDeviceCodesColl)
+
+	filter := bson.M{"tenant_id": tenantId}
+	if tenantId == "" {
+		filter["tenant_id"] = bson.M{"$exists": false}
+	}
+
+	if _, err := c.RemoveAll(filter); err != nil {
+		return errors.Wrap(err, "failed to remove device codes")
+	}
+
+	return nil
+}
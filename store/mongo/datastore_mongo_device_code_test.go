@@ -0,0 +1,115 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreDeviceCode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreDeviceCode in short mode.")
+	}
+
+	// tenant context must not matter
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+
+	dc := model.DeviceCode{
+		Id:        "devcode1",
+		UserCode:  "WDJBMJHT",
+		TenantId:  tenant,
+		DeviceId:  "dev1",
+		AuthSetId: "aid1",
+		ExpiresAt: expires,
+		Interval:  5,
+	}
+
+	assert.NoError(t, db.AddDeviceCode(ctx, dc))
+
+	// user codes must be unique
+	err := db.AddDeviceCode(ctx, model.DeviceCode{
+		Id:        "devcode2",
+		UserCode:  "WDJBMJHT",
+		ExpiresAt: expires,
+	})
+	assert.EqualError(t, err, store.ErrObjectExists.Error())
+
+	res, err := db.GetDeviceCode(context.Background(), "devcode1")
+	assert.NoError(t, err)
+	res.ExpiresAt = res.ExpiresAt.UTC()
+	assert.Equal(t, dc, *res)
+
+	res, err = db.GetDeviceCodeByUserCode(context.Background(), "WDJBMJHT")
+	assert.NoError(t, err)
+	res.ExpiresAt = res.ExpiresAt.UTC()
+	assert.Equal(t, dc, *res)
+
+	_, err = db.GetDeviceCode(ctx, "devcode2")
+	assert.EqualError(t, err, store.ErrDeviceCodeNotFound.Error())
+
+	_, err = db.GetDeviceCodeByUserCode(ctx, "FOOBARBA")
+	assert.EqualError(t, err, store.ErrDeviceCodeNotFound.Error())
+
+	polled := time.Now().UTC().Truncate(time.Millisecond)
+	assert.NoError(t, db.UpdateDeviceCode(ctx, "devcode1", model.DeviceCodeUpdate{
+		Interval:     10,
+		LastPolledAt: &polled,
+	}))
+
+	res, err = db.GetDeviceCode(ctx, "devcode1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), res.Interval)
+	assert.Equal(t, polled, res.LastPolledAt.UTC())
+
+	err = db.UpdateDeviceCode(ctx, "devcode2", model.DeviceCodeUpdate{Interval: 1})
+	assert.EqualError(t, err, store.ErrDeviceCodeNotFound.Error())
+
+	assert.NoError(t, db.DeleteDeviceCode(ctx, "devcode1"))
+	assert.EqualError(t, db.DeleteDeviceCode(ctx, "devcode1"),
+		store.ErrDeviceCodeNotFound.Error())
+
+	// all codes of a tenant
+	for i, c := range []model.DeviceCode{
+		{Id: "devcode3", UserCode: "BCDFGHJK", TenantId: tenant},
+		{Id: "devcode4", UserCode: "LMNPQRST", TenantId: tenant},
+		{Id: "devcode5", UserCode: "VWXZBCDF", TenantId: "tenant2"},
+	} {
+		c.ExpiresAt = expires
+		assert.NoError(t, db.AddDeviceCode(ctx, c), "code %d", i)
+	}
+
+	assert.NoError(t, db.DeleteDeviceCodes(ctx, tenant))
+
+	_, err = db.GetDeviceCode(ctx, "devcode3")
+	assert.EqualError(t, err, store.ErrDeviceCodeNotFound.Error())
+	_, err = db.GetDeviceCode(ctx, "devcode4")
+	assert.EqualError(t, err, store.ErrDeviceCodeNotFound.Error())
+	_, err = db.GetDeviceCode(ctx, "devcode5")
+	assert.NoError(t, err)
+}
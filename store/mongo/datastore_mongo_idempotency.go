@@ -0,0 +1,111 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func (db *DataStoreMongo) ensureIdempotencyIndexes(c *mgo.Collection) error {
+	retention := db.idempotencyKeyRetention
+	if retention == 0 {
+		retention = DefaultIdempotencyKeyRetention
+	}
+
+	// expired keys are removed by mongo
+	return c.EnsureIndex(mgo.Index{
+		Key:         []string{"created_ts"},
+		Name:        indexIdempotencyRecords_CreatedTs,
+		ExpireAfter: retention,
+		Background:  false,
+	})
+}
+
+func (db *DataStoreMongo) AddIdempotencyRecord(ctx context.Context, r model.IdempotencyRecord) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbIdempotencyColl)
+
+	if err := db.ensureIdempotencyIndexes(c); err != nil {
+		return err
+	}
+
+	if err := c.Insert(r); err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrObjectExists
+		}
+		return errors.Wrap(err, "failed to store idempotency record")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetIdempotencyRecord(ctx context.Context, key string) (*model.IdempotencyRecord, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbIdempotencyColl)
+
+	var res model.IdempotencyRecord
+
+	err := c.FindId(key).One(&res)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, store.ErrIdempotencyRecordNotFound
+		}
+		return nil, errors.Wrap(err, "failed to fetch idempotency record")
+	}
+
+	return &res, nil
+}
+
+func (db *DataStoreMongo) SetIdempotencyResponse(ctx context.Context, key string, resp model.IdempotencyResponse) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbIdempotencyColl)
+
+	err := c.UpdateId(key, bson.M{"$set": bson.M{"response": resp}})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrIdempotencyRecordNotFound
+		}
+		return errors.Wrap(err, "failed to update idempotency record")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbIdempotencyColl)
+
+	err := c.RemoveId(key)
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrap(err, "failed to remove idempotency record")
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreIdempotencyRecords(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreIdempotencyRecords in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "tenant-foo",
+	})
+
+	d := getDb(ctx)
+	defer d.session.Close()
+
+	rec := model.IdempotencyRecord{
+		Key:           "key1",
+		RequestSha256: []byte("hash"),
+		CreatedTs:     time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	_, err := d.GetIdempotencyRecord(ctx, "key1")
+	assert.Equal(t, store.ErrIdempotencyRecordNotFound, err)
+
+	assert.NoError(t, d.AddIdempotencyRecord(ctx, rec))
+	assert.Equal(t, store.ErrObjectExists, d.AddIdempotencyRecord(ctx, rec))
+
+	res, err := d.GetIdempotencyRecord(ctx, "key1")
+	assert.NoError(t, err)
+	assert.Equal(t, &rec, res)
+
+	resp := model.IdempotencyResponse{
+		Status: 204,
+		Header: map[string][]string{"Location": {"devices/foo"}},
+	}
+	assert.NoError(t, d.SetIdempotencyResponse(ctx, "key1", resp))
+	assert.Equal(t, store.ErrIdempotencyRecordNotFound,
+		d.SetIdempotencyResponse(ctx, "key2", resp))
+
+	res, err = d.GetIdempotencyRecord(ctx, "key1")
+	assert.NoError(t, err)
+	assert.Equal(t, &resp, res.Response)
+
+	assert.NoError(t, d.DeleteIdempotencyRecord(ctx, "key1"))
+	assert.NoError(t, d.DeleteIdempotencyRecord(ctx, "key1"))
+
+	_, err = d.GetIdempotencyRecord(ctx, "key1")
+	assert.Equal(t, store.ErrIdempotencyRecordNotFound, err)
+}
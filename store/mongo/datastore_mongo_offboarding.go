@@ -0,0 +1,141 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func (db *DataStoreMongo) ensureOffboardingTokenIndexes(ctx context.Context, s *mgo.Session) error {
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbOffboardingTokensColl)
+
+	return c.EnsureIndex(mgo.Index{
+		Key:        []string{model.AuthSetKeyIdDataSha256, model.AuthSetKeyPubKey},
+		Name:       indexOffboardingTokens_IdDataSha256_PubKey,
+		Background: false,
+	})
+}
+
+func (db *DataStoreMongo) AddOffboardingToken(ctx context.Context, t model.OffboardingToken) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	if err := db.ensureOffboardingTokenIndexes(ctx, s); err != nil {
+		return err
+	}
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbOffboardingTokensColl)
+
+	if err := c.Insert(t); err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrObjectExists
+		}
+		return errors.Wrap(err, "failed to store offboarding token")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetOffboardingToken(ctx context.Context, id string) (*model.OffboardingToken, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbOffboardingTokensColl)
+
+	var res model.OffboardingToken
+
+	err := c.FindId(id).One(&res)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, store.ErrOffboardingTokenNotFound
+		}
+		return nil, errors.Wrap(err, "failed to fetch offboarding token")
+	}
+
+	return &res, nil
+}
+
+func (db *DataStoreMongo) ClaimOffboardingToken(ctx context.Context, idDataHash []byte, pubkey string, now time.Time) (*model.OffboardingToken, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbOffboardingTokensColl)
+
+	var res model.OffboardingToken
+
+	// find and mark in one go, the token is handed out once
+	_, err := c.Find(bson.M{
+		model.AuthSetKeyIdDataSha256: idDataHash,
+		model.AuthSetKeyPubKey:       pubkey,
+		"claimed_ts":                 bson.M{"$exists": false},
+		"expires_at":                 bson.M{"$gt": now},
+	}).Apply(mgo.Change{
+		Update:    bson.M{"$set": bson.M{"claimed_ts": now}},
+		ReturnNew: true,
+	}, &res)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, store.ErrOffboardingTokenNotFound
+		}
+		return nil, errors.Wrap(err, "failed to claim offboarding token")
+	}
+
+	return &res, nil
+}
+
+func (db *DataStoreMongo) UseOffboardingToken(ctx context.Context, id string, now time.Time) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbOffboardingTokensColl)
+
+	err := c.UpdateId(id, bson.M{
+		"$set": bson.M{"last_used_ts": now},
+		"$inc": bson.M{"uses": 1},
+	})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrOffboardingTokenNotFound
+		}
+		return errors.Wrap(err, "failed to update offboarding token")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetOffboardingTokens(ctx context.Context, skip, limit uint) ([]model.OffboardingToken, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbOffboardingTokensColl)
+
+	res := []model.OffboardingToken{}
+
+	err := c.Find(nil).Sort("-created_ts", "_id").
+		Skip(int(skip)).Limit(int(limit)).All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch offboarding tokens")
+	}
+
+	return res, nil
+}
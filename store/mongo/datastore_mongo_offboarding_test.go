@@ -0,0 +1,103 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreOffboardingToken(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreOffboardingToken in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	tok := model.OffboardingToken{
+		Id:           "jti1",
+		DeviceId:     "dev1",
+		Reason:       model.OffboardingReasonRejected,
+		IdDataSha256: []byte("hash1"),
+		PubKey:       "pubkey1",
+		Token:        "token1",
+		CreatedTs:    now,
+		ExpiresAt:    now.Add(time.Minute),
+	}
+
+	assert.NoError(t, db.AddOffboardingToken(ctx, tok))
+	assert.EqualError(t, db.AddOffboardingToken(ctx, tok),
+		store.ErrObjectExists.Error())
+
+	// other key
+	_, err := db.ClaimOffboardingToken(ctx, []byte("hash1"), "pubkey2", now)
+	assert.EqualError(t, err, store.ErrOffboardingTokenNotFound.Error())
+
+	// expired
+	_, err = db.ClaimOffboardingToken(ctx, []byte("hash1"), "pubkey1",
+		now.Add(time.Hour))
+	assert.EqualError(t, err, store.ErrOffboardingTokenNotFound.Error())
+
+	// other tenant
+	_, err = db.ClaimOffboardingToken(context.Background(),
+		[]byte("hash1"), "pubkey1", now)
+	assert.EqualError(t, err, store.ErrOffboardingTokenNotFound.Error())
+
+	res, err := db.ClaimOffboardingToken(ctx, []byte("hash1"), "pubkey1", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "token1", res.Token)
+	assert.Equal(t, now, res.ClaimedTs.UTC())
+
+	// handed out once only
+	_, err = db.ClaimOffboardingToken(ctx, []byte("hash1"), "pubkey1", now)
+	assert.EqualError(t, err, store.ErrOffboardingTokenNotFound.Error())
+
+	assert.NoError(t, db.UseOffboardingToken(ctx, "jti1", now))
+	assert.NoError(t, db.UseOffboardingToken(ctx, "jti1", now.Add(time.Second)))
+	assert.EqualError(t, db.UseOffboardingToken(ctx, "jti2", now),
+		store.ErrOffboardingTokenNotFound.Error())
+
+	res, err = db.GetOffboardingToken(ctx, "jti1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res.Uses)
+	assert.Equal(t, now.Add(time.Second), res.LastUsedTs.UTC())
+
+	_, err = db.GetOffboardingToken(ctx, "jti2")
+	assert.EqualError(t, err, store.ErrOffboardingTokenNotFound.Error())
+
+	tok.Id = "jti2"
+	tok.CreatedTs = now.Add(time.Second)
+	assert.NoError(t, db.AddOffboardingToken(ctx, tok))
+
+	toks, err := db.GetOffboardingTokens(ctx, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, toks, 2) {
+		assert.Equal(t, "jti2", toks[0].Id)
+		assert.Equal(t, "jti1", toks[1].Id)
+	}
+}
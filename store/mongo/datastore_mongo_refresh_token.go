@@ -0,0 +1,128 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// refresh tokens are exchanged by devices without tenant context, so they are
+// always kept in the common database; the tenant is recorded with each token
+// instead
+
+func (db *DataStoreMongo) ensureRefreshTokenIndexes(s *mgo.Session) error {
+	c := s.DB(DbName).C(DbRefreshTokensColl)
+
+	err := c.EnsureIndex(mgo.Index{
+		Key:        []string{"tenant_id", "device_id"},
+		Name:       indexRefreshTokens_TenantId_DeviceId,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	// expired tokens are removed by mongo
+	return c.EnsureIndex(mgo.Index{
+		Key:         []string{"expires_at"},
+		Name:        indexRefreshTokens_ExpiresAt,
+		ExpireAfter: time.Second,
+		Background:  false,
+	})
+}
+
+func (db *DataStoreMongo) AddRefreshToken(ctx context.Context, t model.RefreshToken) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	if err := db.ensureRefreshTokenIndexes(s); err != nil {
+		return err
+	}
+
+	c := s.DB(DbName).C(DbRefreshTokensColl)
+
+	if err := c.Insert(t); err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrObjectExists
+		}
+		return errors.Wrap(err, "failed to store refresh token")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) UseRefreshToken(ctx context.Context, id string, now time.Time) (*model.RefreshToken, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbRefreshTokensColl)
+
+	var res model.RefreshToken
+
+	// mongo removes expired documents only periodically
+	_, err := c.Find(bson.M{
+		"_id":        id,
+		"expires_at": bson.M{"$gt": now},
+	}).Apply(mgo.Change{Remove: true}, &res)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, store.ErrRefreshTokenNotFound
+		}
+		return nil, errors.Wrap(err, "failed to remove refresh token")
+	}
+
+	return &res, nil
+}
+
+func (db *DataStoreMongo) DeleteRefreshTokens(ctx context.Context, tenantId, deviceId string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbRefreshTokensColl)
+
+	filter := bson.M{"tenant_id": tenantId}
+	if tenantId == "" {
+		filter["tenant_id"] = bson.M{"$exists": false}
+	}
+	if deviceId != "" {
+		filter["device_id"] = deviceId
+	}
+
+	if _, err := c.RemoveAll(filter); err != nil {
+		return errors.Wrap(err, "failed to remove refresh tokens")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteAuthSetRefreshTokens(ctx context.Context, authId string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbRefreshTokensColl)
+
+	if _, err := c.RemoveAll(bson.M{"auth_id": authId}); err != nil {
+		return errors.Wrap(err, "failed to remove refresh tokens")
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreRefreshToken(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreRefreshToken in short mode.")
+	}
+
+	// tenant context must not matter
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now()
+
+	tokens := []model.RefreshToken{
+		{
+			Id:        "token1",
+			TenantId:  tenant,
+			DeviceId:  "dev1",
+			AuthSetId: "aid1",
+			ExpiresAt: now.Add(time.Hour),
+		},
+		{
+			Id:        "token2",
+			TenantId:  tenant,
+			DeviceId:  "dev1",
+			AuthSetId: "aid1",
+			ExpiresAt: now.Add(-time.Hour),
+		},
+		{
+			Id:        "token3",
+			TenantId:  tenant,
+			DeviceId:  "dev2",
+			AuthSetId: "aid2",
+			ExpiresAt: now.Add(time.Hour),
+		},
+		{
+			Id:        "token4",
+			DeviceId:  "dev1",
+			AuthSetId: "aid3",
+			ExpiresAt: now.Add(time.Hour),
+		},
+	}
+	for _, tok := range tokens {
+		assert.NoError(t, db.AddRefreshToken(ctx, tok))
+	}
+
+	err := db.AddRefreshToken(ctx, tokens[0])
+	assert.EqualError(t, err, store.ErrObjectExists.Error())
+
+	// refresh tokens can be used once
+	tok, err := db.UseRefreshToken(context.Background(), "token1", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "aid1", tok.AuthSetId)
+	assert.Equal(t, tenant, tok.TenantId)
+
+	_, err = db.UseRefreshToken(ctx, "token1", now)
+	assert.EqualError(t, err, store.ErrRefreshTokenNotFound.Error())
+
+	// expired, not removed by mongo yet
+	_, err = db.UseRefreshToken(ctx, "token2", now)
+	assert.EqualError(t, err, store.ErrRefreshTokenNotFound.Error())
+
+	// tokens of the device's other auth sets are kept
+	assert.NoError(t, db.DeleteAuthSetRefreshTokens(ctx, "aid2"))
+	_, err = db.UseRefreshToken(ctx, "token3", now)
+	assert.EqualError(t, err, store.ErrRefreshTokenNotFound.Error())
+	assert.NoError(t, db.AddRefreshToken(ctx, tokens[2]))
+
+	// tokens of other tenants' devices are kept
+	assert.NoError(t, db.DeleteRefreshTokens(ctx, tenant, "dev2"))
+	_, err = db.UseRefreshToken(ctx, "token3", now)
+	assert.EqualError(t, err, store.ErrRefreshTokenNotFound.Error())
+
+	assert.NoError(t, db.DeleteRefreshTokens(ctx, tenant, ""))
+	tok, err = db.UseRefreshToken(ctx, "token4", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "aid3", tok.AuthSetId)
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+// mongo error codes of a missing collection or index
+const (
+	errCodeNamespaceNotFound = 26
+	errCodeIndexNotFound     = 27
+)
+
+// ensureRevokedTokenIndexes updates the expiry of the index expiring
+// revocations to the configured retention, or creates the index; run on
+// migration, not with every revocation
+func (db *DataStoreMongo) ensureRevokedTokenIndexes(database *mgo.Database) error {
+	retention := db.revokedTokenRetention
+	if retention == 0 {
+		retention = DefaultRevokedTokenRetention
+	}
+
+	err := database.Run(bson.D{
+		{Name: "collMod", Value: DbRevokedTokensColl},
+		{Name: "index", Value: bson.M{
+			"keyPattern":         bson.M{"revoked_ts": 1},
+			"expireAfterSeconds": int(retention.Seconds()),
+		}},
+	}, nil)
+	qerr, ok := err.(*mgo.QueryError)
+	if err == nil {
+		return nil
+	} else if !ok || (qerr.Code != errCodeNamespaceNotFound && qerr.Code != errCodeIndexNotFound) {
+		return errors.Wrap(err, "failed to update revoked tokens retention")
+	}
+
+	// revocations are removed by mongo once the revoked tokens would
+	// have expired anyway
+	return database.C(DbRevokedTokensColl).EnsureIndex(mgo.Index{
+		Key:         []string{"revoked_ts"},
+		Name:        indexRevokedTokens_RevokedTs,
+		ExpireAfter: retention,
+		Background:  false,
+	})
+}
+
+func (db *DataStoreMongo) addRevokedTokens(database *mgo.Database, ids []string) error {
+	now := time.Now().UTC()
+
+	bulk := database.C(DbRevokedTokensColl).Bulk()
+	bulk.Unordered()
+	for _, id := range ids {
+		bulk.Upsert(bson.M{"_id": id},
+			bson.M{"$setOnInsert": model.RevokedToken{
+				Id:        id,
+				RevokedTs: now,
+			}})
+	}
+
+	if _, err := bulk.Run(); err != nil {
+		return errors.Wrap(err, "failed to store revoked tokens")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetRevokedTokens(ctx context.Context, since time.Time, skip, limit uint) ([]model.RevokedToken, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbRevokedTokensColl)
+
+	res := []model.RevokedToken{}
+
+	// oldest first, pages stay stable as new revocations are appended
+	err := c.Find(bson.M{"revoked_ts": bson.M{"$gte": since}}).
+		Sort("revoked_ts", "_id").
+		Skip(int(skip)).Limit(int(limit)).All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch revoked tokens")
+	}
+
+	return res, nil
+}
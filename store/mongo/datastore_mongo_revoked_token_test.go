@@ -0,0 +1,111 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreRevokedTokens(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreRevokedTokens in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx).WithRevokedTokenRetention(time.Hour)
+	defer db.session.Close()
+
+	start := time.Now().UTC().Add(-time.Second)
+
+	for _, tok := range []model.Token{
+		{Id: "jti1", DevId: "dev1"},
+		{Id: "jti2", DevId: "dev1"},
+		{Id: "jti3", DevId: "dev2"},
+		{Id: "jti4", DevId: "dev3"},
+		{Id: "jti5", DevId: "dev3"},
+	} {
+		assert.NoError(t, db.AddToken(ctx, tok))
+	}
+
+	// expired tokens are not revoked
+	assert.NoError(t, db.DeleteExpiredToken(ctx, "jti5"))
+	assert.Equal(t, store.ErrTokenNotFound, db.DeleteExpiredToken(ctx, "jti5"))
+
+	// revocation times are stored with millisecond precision
+	assert.NoError(t, db.DeleteToken(ctx, "jti3"))
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, db.DeleteTokenByDevId(ctx, "dev1"))
+
+	// other tenant
+	toks, err := db.GetRevokedTokens(context.Background(), start, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, toks, 0)
+
+	toks, err = db.GetRevokedTokens(ctx, start, 0, 10)
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, tok := range toks {
+		ids = append(ids, tok.Id)
+		assert.False(t, tok.RevokedTs.Before(start))
+	}
+	assert.Equal(t, []string{"jti3", "jti1", "jti2"}, ids)
+
+	// paging
+	toks, err = db.GetRevokedTokens(ctx, start, 1, 1)
+	assert.NoError(t, err)
+	assert.Len(t, toks, 1)
+	assert.Equal(t, "jti1", toks[0].Id)
+
+	// since
+	toks, err = db.GetRevokedTokens(ctx, time.Now().Add(time.Minute), 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, toks, 0)
+
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, db.DeleteTokens(ctx))
+	toks, err = db.GetRevokedTokens(ctx, start, 3, 10)
+	assert.NoError(t, err)
+	assert.Len(t, toks, 1)
+	assert.Equal(t, "jti4", toks[0].Id)
+
+	// the index is set up on migration, and follows retention changes
+	dbName := ctxstore.DbFromContext(ctx, DbName)
+	s := db.session.Copy()
+	defer s.Close()
+	for _, retention := range []time.Duration{time.Hour, 2 * time.Hour} {
+		db = db.WithRevokedTokenRetention(retention)
+		assert.NoError(t, db.MigrateTenant(ctx, dbName, DbVersion))
+		verifyIndexes(t, s.DB(dbName).C(DbRevokedTokensColl),
+			[]mgo.Index{
+				{
+					Key:         []string{"revoked_ts"},
+					Name:        indexRevokedTokens_RevokedTs,
+					ExpireAfter: retention,
+				},
+			})
+	}
+}
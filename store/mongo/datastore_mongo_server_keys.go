@@ -0,0 +1,85 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// server signing keys live in the main database, they are used for the
+// tokens of all tenants
+
+func (db *DataStoreMongo) AddServerKey(ctx context.Context, key model.ServerKey) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbServerKeysColl)
+
+	if err := c.Insert(key); err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrObjectExists
+		}
+		return errors.Wrap(err, "failed to store server key")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetServerKeys(ctx context.Context) ([]model.ServerKey, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbServerKeysColl)
+
+	res := []model.ServerKey{}
+
+	err := c.Find(bson.M{
+		"retired_ts": bson.M{"$exists": false},
+	}).Sort("-created_ts", "_id").All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch server keys")
+	}
+
+	return res, nil
+}
+
+func (db *DataStoreMongo) RetireServerKey(ctx context.Context, id string, now time.Time) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbServerKeysColl)
+
+	err := c.Update(bson.M{
+		"_id":        id,
+		"retired_ts": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{"retired_ts": now},
+	})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrServerKeyNotFound
+		}
+		return errors.Wrap(err, "failed to retire server key")
+	}
+
+	return nil
+}
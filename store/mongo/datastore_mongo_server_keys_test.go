@@ -0,0 +1,83 @@
+// Copyright 2018 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreServerKeys(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreServerKeys in short mode.")
+	}
+
+	ctx := context.Background()
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	key1 := model.ServerKey{
+		Id:            "kid1",
+		Algorithm:     "RS256",
+		PrivateKeyRef: "file:///etc/deviceauth/key1.pem",
+		CreatedTs:     now.Add(-time.Hour),
+	}
+	key2 := model.ServerKey{
+		Id:            "kid2",
+		Algorithm:     "EdDSA",
+		PrivateKeyRef: "vault://secret/data/deviceauth#key2",
+		CreatedTs:     now,
+	}
+
+	assert.NoError(t, db.AddServerKey(ctx, key1))
+	assert.NoError(t, db.AddServerKey(ctx, key2))
+	assert.EqualError(t, db.AddServerKey(ctx, key1),
+		store.ErrObjectExists.Error())
+
+	// keys are global
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: tenant,
+	})
+
+	keys, err := db.GetServerKeys(tenantCtx)
+	assert.NoError(t, err)
+	if assert.Len(t, keys, 2) {
+		assert.Equal(t, "kid2", keys[0].Id)
+		assert.Equal(t, "vault://secret/data/deviceauth#key2",
+			keys[0].PrivateKeyRef)
+		assert.Equal(t, "kid1", keys[1].Id)
+	}
+
+	assert.NoError(t, db.RetireServerKey(ctx, "kid2", now))
+	assert.EqualError(t, db.RetireServerKey(ctx, "kid2", now),
+		store.ErrServerKeyNotFound.Error())
+	assert.EqualError(t, db.RetireServerKey(ctx, "kid3", now),
+		store.ErrServerKeyNotFound.Error())
+
+	keys, err = db.GetServerKeys(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, keys, 1) {
+		assert.Equal(t, "kid1", keys[0].Id)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+func (db *DataStoreMongo) IncAuthRequestCount(ctx context.Context, t time.Time) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbAuthRequestCountsColl)
+
+	err := c.EnsureIndex(mgo.Index{
+		Key:         []string{"hour"},
+		Name:        indexAuthRequestCounts_Hour,
+		Unique:      true,
+		ExpireAfter: AuthRequestCountRetention,
+		Background:  false,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Upsert(bson.M{"hour": t.UTC().Truncate(time.Hour)},
+		bson.M{"$inc": bson.M{"count": 1}})
+	if err != nil {
+		return errors.Wrap(err, "failed to count auth request")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetStatistics(ctx context.Context, since time.Time) (*model.Statistics, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	database := s.DB(ctxstore.DbFromContext(ctx, DbName))
+
+	stats := &model.Statistics{}
+
+	counts, err := countDevicesByStatus(database.C(DbDevicesColl))
+	if err != nil {
+		return nil, err
+	}
+	stats.Devices = *counts
+
+	stats.AuthRequests = []model.HourlyCount{}
+	err = database.C(DbAuthRequestCountsColl).
+		Find(bson.M{"hour": bson.M{"$gte": since}}).
+		Sort("hour").All(&stats.AuthRequests)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch auth request counts")
+	}
+
+	stats.AcceptanceRate, err = acceptanceRate(database.C(DbStatusHistoryColl), since)
+	if err != nil {
+		return nil, err
+	}
+
+	backlog, err := pendingBacklog(database.C(DbAuthSetColl), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	stats.PendingBacklog = *backlog
+
+	return stats, nil
+}
+
+func countDevicesByStatus(c *mgo.Collection) (*model.DeviceCounts, error) {
+	var res []struct {
+		Status string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}
+
+	err := c.Pipe([]bson.M{
+		{"$group": bson.M{
+			"_id":   "$" + model.DevKeyStatus,
+			"count": bson.M{"$sum": 1},
+		}},
+	}).All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count devices")
+	}
+
+	counts := &model.DeviceCounts{}
+	for _, r := range res {
+		counts.Count += r.Count
+		switch r.Status {
+		case model.DevStatusPending:
+			counts.Pending = r.Count
+		case model.DevStatusAccepted:
+			counts.Accepted = r.Count
+		case model.DevStatusRejected:
+			counts.Rejected = r.Count
+		case model.DevStatusPreauth:
+			counts.Preauthorized = r.Count
+		case model.DevStatusQuarantined:
+			counts.Quarantined = r.Count
+		}
+	}
+
+	return counts, nil
+}
+
+// acceptanceRate returns the share of the devices accepted out of those
+// leaving the pending status since the time, nil if none did
+func acceptanceRate(c *mgo.Collection, since time.Time) (*float64, error) {
+	var res []struct {
+		Status string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}
+
+	err := c.Pipe([]bson.M{
+		{"$match": bson.M{
+			"timestamp": bson.M{"$gte": since},
+			"from":      model.DevStatusPending,
+			"to": bson.M{"$in": []string{
+				model.DevStatusAccepted,
+				model.DevStatusRejected,
+			}},
+		}},
+		{"$group": bson.M{
+			"_id":   "$to",
+			"count": bson.M{"$sum": 1},
+		}},
+	}).All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count device status decisions")
+	}
+
+	accepted, total := 0, 0
+	for _, r := range res {
+		if r.Status == model.DevStatusAccepted {
+			accepted = r.Count
+		}
+		total += r.Count
+	}
+	if total == 0 {
+		return nil, nil
+	}
+
+	rate := float64(accepted) / float64(total)
+	return &rate, nil
+}
+
+// pendingBacklog returns the number of pending auth sets and the
+// percentiles of their ages at the time, using the nearest rank
+func pendingBacklog(c *mgo.Collection, now time.Time) (*model.PendingBacklog, error) {
+	match := bson.M{model.AuthSetKeyStatus: model.DevStatusPending}
+
+	n, err := c.Find(match).Count()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count pending auth sets")
+	}
+
+	backlog := &model.PendingBacklog{Count: n}
+	if n == 0 {
+		return backlog, nil
+	}
+
+	for _, pct := range []struct {
+		p   float64
+		age *int64
+	}{
+		{50, &backlog.AgeP50},
+		{90, &backlog.AgeP90},
+		{99, &backlog.AgeP99},
+		{100, &backlog.AgeMax},
+	} {
+		rank := int(math.Ceil(pct.p / 100 * float64(n)))
+
+		var res struct {
+			Timestamp time.Time `bson:"ts"`
+		}
+		// the youngest first, the rank-th one is as old as the
+		// percentile
+		err := c.Pipe([]bson.M{
+			{"$match": match},
+			{"$sort": bson.D{{Name: model.AuthSetKeyTimestamp, Value: -1}}},
+			{"$skip": rank - 1},
+			{"$limit": 1},
+			{"$project": bson.M{model.AuthSetKeyTimestamp: 1}},
+		}).One(&res)
+		switch err {
+		case nil:
+		case mgo.ErrNotFound:
+			// the backlog shrank in the meantime
+			continue
+		default:
+			return nil, errors.Wrap(err, "failed to fetch pending auth set age")
+		}
+
+		*pct.age = int64(now.Sub(res.Timestamp) / time.Second)
+	}
+
+	return backlog, nil
+}
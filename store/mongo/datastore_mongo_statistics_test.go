@@ -0,0 +1,147 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	uto "github.com/mendersoftware/deviceauth/utils/to"
+)
+
+func TestStoreGetStatistics(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreGetStatistics in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	// no data yet
+	stats, err := db.GetStatistics(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Statistics{
+		AuthRequests: []model.HourlyCount{},
+	}, stats)
+
+	for i, status := range []string{
+		model.DevStatusPending,
+		model.DevStatusPending,
+		model.DevStatusAccepted,
+		model.DevStatusRejected,
+	} {
+		err := db.AddDevice(ctx, model.Device{
+			Id:     fmt.Sprintf("dev%d", i),
+			IdData: fmt.Sprintf("foo-%04d", i),
+			Status: status,
+		})
+		assert.NoError(t, err)
+	}
+
+	now := time.Now().UTC()
+	for i, age := range []time.Duration{
+		10 * time.Second,
+		20 * time.Second,
+		30 * time.Second,
+		400 * time.Second,
+	} {
+		err := db.AddAuthSet(ctx, model.AuthSet{
+			Id:        fmt.Sprintf("aset%d", i),
+			DeviceId:  fmt.Sprintf("dev%d", i),
+			IdData:    fmt.Sprintf("foo-%04d", i),
+			PubKey:    fmt.Sprintf("pubkey-%04d", i),
+			Status:    model.DevStatusPending,
+			Timestamp: uto.TimePtr(now.Add(-age)),
+		})
+		assert.NoError(t, err)
+	}
+	err = db.AddAuthSet(ctx, model.AuthSet{
+		Id:        "aset-accepted",
+		DeviceId:  "dev2",
+		IdData:    "foo-0002",
+		PubKey:    "pubkey-accepted",
+		Status:    model.DevStatusAccepted,
+		Timestamp: uto.TimePtr(now.Add(-time.Hour)),
+	})
+	assert.NoError(t, err)
+
+	hour := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	for _, ts := range []time.Time{
+		hour.Add(-time.Minute),
+		hour,
+		hour.Add(59 * time.Minute),
+		hour.Add(time.Hour),
+	} {
+		assert.NoError(t, db.IncAuthRequestCount(ctx, ts))
+	}
+
+	for i, c := range []model.DeviceStatusChange{
+		{From: model.DevStatusPending, To: model.DevStatusAccepted},
+		{From: model.DevStatusPending, To: model.DevStatusAccepted},
+		{From: model.DevStatusPending, To: model.DevStatusAccepted},
+		{From: model.DevStatusPending, To: model.DevStatusRejected},
+		{From: model.DevStatusAccepted, To: model.DevStatusRejected},
+		{To: model.DevStatusPending},
+	} {
+		c.Id = fmt.Sprintf("c%d", i)
+		c.DeviceId = "dev0"
+		c.Timestamp = hour
+		assert.NoError(t, db.AddDeviceStatusChange(ctx, c))
+	}
+	// before the period
+	assert.NoError(t, db.AddDeviceStatusChange(ctx, model.DeviceStatusChange{
+		Id:        "c-old",
+		DeviceId:  "dev0",
+		From:      model.DevStatusPending,
+		To:        model.DevStatusRejected,
+		Timestamp: hour.Add(-2 * time.Hour),
+	}))
+
+	stats, err = db.GetStatistics(ctx, hour)
+	assert.NoError(t, err)
+
+	assert.Equal(t, model.DeviceCounts{
+		Count:    4,
+		Pending:  2,
+		Accepted: 1,
+		Rejected: 1,
+	}, stats.Devices)
+
+	if assert.Len(t, stats.AuthRequests, 2) {
+		assert.True(t, hour.Equal(stats.AuthRequests[0].Hour))
+		assert.Equal(t, 2, stats.AuthRequests[0].Count)
+		assert.True(t, hour.Add(time.Hour).Equal(stats.AuthRequests[1].Hour))
+		assert.Equal(t, 1, stats.AuthRequests[1].Count)
+	}
+
+	if assert.NotNil(t, stats.AcceptanceRate) {
+		assert.Equal(t, 0.75, *stats.AcceptanceRate)
+	}
+
+	assert.Equal(t, 4, stats.PendingBacklog.Count)
+	assert.InDelta(t, 20, stats.PendingBacklog.AgeP50, 2)
+	assert.InDelta(t, 400, stats.PendingBacklog.AgeP90, 2)
+	assert.InDelta(t, 400, stats.PendingBacklog.AgeP99, 2)
+	assert.InDelta(t, 400, stats.PendingBacklog.AgeMax, 2)
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func (db *DataStoreMongo) AddDeviceStatusChange(ctx context.Context, r model.DeviceStatusChange) error {
+	return db.AddDeviceStatusChanges(ctx, []model.DeviceStatusChange{r})
+}
+
+func (db *DataStoreMongo) AddDeviceStatusChanges(ctx context.Context, rs []model.DeviceStatusChange) error {
+	if len(rs) == 0 {
+		return nil
+	}
+
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbStatusHistoryColl)
+
+	for _, idx := range []mgo.Index{
+		{
+			Key:        []string{"device_id", "timestamp"},
+			Name:       indexStatusHistory_DeviceId_Timestamp,
+			Background: false,
+		},
+		{
+			Key:        []string{"timestamp", "_id"},
+			Name:       indexStatusHistory_Timestamp,
+			Background: false,
+		},
+	} {
+		if err := c.EnsureIndex(idx); err != nil {
+			return err
+		}
+	}
+
+	docs := make([]interface{}, len(rs))
+	for i := range rs {
+		docs[i] = rs[i]
+	}
+
+	if err := c.Insert(docs...); err != nil {
+		return errors.Wrap(err, "failed to store device status change")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetDeviceStatusHistory(ctx context.Context, devId string, skip, limit uint) ([]model.DeviceStatusChange, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbStatusHistoryColl)
+
+	res := []model.DeviceStatusChange{}
+
+	err := c.Find(bson.M{"device_id": devId}).Sort("-timestamp", "-_id").
+		Skip(int(skip)).Limit(int(limit)).All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch device status history")
+	}
+
+	return res, nil
+}
+
+func (db *DataStoreMongo) GetDeviceStatusChanges(ctx context.Context, after *store.Cursor, limit uint) ([]model.DeviceStatusChange, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbStatusHistoryColl)
+
+	query := bson.M{}
+	if after != nil {
+		if after.Ts == nil {
+			return nil, store.ErrInvalidCursor
+		}
+		query["$or"] = rangeAfter("timestamp", *after.Ts, false,
+			after.Id, false)
+	}
+
+	res := []model.DeviceStatusChange{}
+
+	err := c.Find(query).Sort("timestamp", "_id").
+		Limit(int(limit)).All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch device status changes")
+	}
+
+	return res, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreDeviceStatusHistory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreDeviceStatusHistory in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "tenant-foo",
+	})
+
+	d := getDb(ctx)
+	defer d.session.Close()
+
+	dev := model.Device{
+		Id:     "dev1",
+		IdData: "{\"mac\":\"00:00:00:01\"}",
+		Status: model.DevStatusPending,
+	}
+	assert.NoError(t, d.AddDevice(ctx, dev))
+
+	prev, err := d.SetDeviceStatus(ctx, "dev1", model.DevStatusAccepted)
+	assert.NoError(t, err)
+	assert.Equal(t, model.DevStatusPending, prev)
+
+	prev, err = d.SetDeviceStatus(ctx, "dev1", model.DevStatusRejected)
+	assert.NoError(t, err)
+	assert.Equal(t, model.DevStatusAccepted, prev)
+
+	_, err = d.SetDeviceStatus(ctx, "dev2", model.DevStatusRejected)
+	assert.Equal(t, store.ErrDevNotFound, err)
+
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	changes := []model.DeviceStatusChange{
+		{
+			Id:        "c1",
+			DeviceId:  "dev1",
+			To:        model.DevStatusPending,
+			Timestamp: ts,
+		},
+		{
+			Id:        "c2",
+			DeviceId:  "dev1",
+			From:      model.DevStatusPending,
+			To:        model.DevStatusAccepted,
+			UserId:    "user1",
+			Timestamp: ts.Add(time.Minute),
+		},
+		{
+			Id:        "c3",
+			DeviceId:  "dev2",
+			To:        model.DevStatusPending,
+			Timestamp: ts.Add(time.Hour),
+		},
+	}
+	for _, c := range changes {
+		assert.NoError(t, d.AddDeviceStatusChange(ctx, c))
+	}
+
+	ids := func(changes []model.DeviceStatusChange) []string {
+		ids := []string{}
+		for _, c := range changes {
+			ids = append(ids, c.Id)
+		}
+		return ids
+	}
+
+	testCases := map[string]struct {
+		devId string
+		skip  uint
+		limit uint
+
+		ids []string
+	}{
+		"newest first": {
+			devId: "dev1",
+			limit: 10,
+			ids:   []string{"c2", "c1"},
+		},
+		"paging": {
+			devId: "dev1",
+			skip:  1,
+			limit: 1,
+			ids:   []string{"c1"},
+		},
+		"none": {
+			devId: "dev3",
+			limit: 10,
+			ids:   []string{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			res, err := d.GetDeviceStatusHistory(ctx, tc.devId, tc.skip, tc.limit)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ids, ids(res))
+		})
+	}
+
+	since := ts.Add(time.Second)
+	changesCases := map[string]struct {
+		after *store.Cursor
+		limit uint
+
+		ids []string
+		err error
+	}{
+		"oldest first": {
+			limit: 10,
+			ids:   []string{"c1", "c2", "c3"},
+		},
+		"after change": {
+			after: store.StatusChangeCursor(&changes[0]),
+			limit: 10,
+			ids:   []string{"c2", "c3"},
+		},
+		"after time": {
+			after: &store.Cursor{Sort: store.StatusChangeSort, Ts: &since},
+			limit: 1,
+			ids:   []string{"c2"},
+		},
+		"after last": {
+			after: store.StatusChangeCursor(&changes[2]),
+			limit: 10,
+			ids:   []string{},
+		},
+		"invalid cursor": {
+			after: &store.Cursor{Sort: store.StatusChangeSort, Id: "c1"},
+			limit: 10,
+			err:   store.ErrInvalidCursor,
+		},
+	}
+
+	for name, tc := range changesCases {
+		t.Run(name, func(t *testing.T) {
+			res, err := d.GetDeviceStatusChanges(ctx, tc.after, tc.limit)
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ids, ids(res))
+		})
+	}
+}
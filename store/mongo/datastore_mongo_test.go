@@ -242,6 +242,83 @@ func TestStoreAddDevice(t *testing.T) {
 	assert.EqualError(t, err, store.ErrObjectExists.Error())
 }
 
+func TestStoreAddDevices(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreAddDevices in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+	d := getDb(ctx)
+	defer d.session.Close()
+
+	err := d.AddDevice(ctx, model.Device{
+		Id:           "dev0",
+		IdData:       "iddata0",
+		IdDataSha256: getIdDataHash("iddata0"),
+	})
+	assert.NoError(t, err)
+
+	newDev := func(id, idData string) model.Device {
+		return model.Device{
+			Id:           id,
+			IdData:       idData,
+			IdDataSha256: getIdDataHash(idData),
+			IdDataStruct: map[string]interface{}{"sn": idData},
+			Status:       model.DevStatusPreauth,
+		}
+	}
+
+	errs, err := d.AddDevices(ctx, []model.Device{
+		newDev("dev1", "iddata1"),
+		newDev("dev2", "iddata0"),
+		newDev("dev3", "iddata3"),
+		newDev("dev4", "iddata1"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []error{nil, store.ErrObjectExists, nil, store.ErrObjectExists}, errs)
+
+	for _, id := range []string{"dev1", "dev3"} {
+		dev, err := d.GetDeviceById(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, model.DevStatusPreauth, dev.Status)
+		assert.NotEmpty(t, dev.IdDataValues)
+	}
+	_, err = d.GetDeviceById(ctx, "dev2")
+	assert.Equal(t, store.ErrDevNotFound, err)
+
+	sets := []model.AuthSet{
+		{
+			Id:           "aid1",
+			DeviceId:     "dev1",
+			IdData:       "iddata1",
+			IdDataSha256: getIdDataHash("iddata1"),
+			PubKey:       "key1",
+			Status:       model.DevStatusPreauth,
+		},
+		{
+			Id:           "aid1",
+			DeviceId:     "dev3",
+			IdData:       "iddata3",
+			IdDataSha256: getIdDataHash("iddata3"),
+			PubKey:       "key3",
+			Status:       model.DevStatusPreauth,
+		},
+	}
+	errs, err = d.AddAuthSets(ctx, sets)
+	assert.NoError(t, err)
+	assert.Equal(t, []error{nil, store.ErrObjectExists}, errs)
+
+	set, err := d.GetAuthSetById(ctx, "aid1")
+	assert.NoError(t, err)
+	assert.Equal(t, "dev1", set.DeviceId)
+
+	errs, err = d.AddDevices(ctx, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+}
+
 func TestStoreUpdateDevice(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping TestUpdateDevice in short mode.")
@@ -504,6 +581,151 @@ func TestStoreDeleteToken(t *testing.T) {
 	}
 }
 
+func TestStoreUpdateTokenExpiration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreUpdateTokenExpiration in short mode.")
+	}
+
+	dbCtx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+	d := getDb(dbCtx)
+	defer d.session.Close()
+	s := d.session.Copy()
+	defer s.Close()
+
+	err := setUpTokens(s, dbCtx)
+	assert.NoError(t, err, "failed to setup input data")
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+
+	err = d.UpdateTokenExpiration(dbCtx, token1.Id, expiresAt)
+	assert.NoError(t, err)
+
+	tok, err := d.GetToken(dbCtx, token1.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, tok.ExpiresAt) {
+		assert.True(t, expiresAt.Equal(*tok.ExpiresAt))
+	}
+
+	err = d.UpdateTokenExpiration(dbCtx, "id3", expiresAt)
+	assert.Equal(t, store.ErrTokenNotFound, err)
+}
+
+func TestStoreGetTokensByDevId(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreGetTokensByDevId in short mode.")
+	}
+
+	dbCtx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+	d := getDb(dbCtx)
+	defer d.session.Close()
+	s := d.session.Copy()
+	defer s.Close()
+
+	err := setUpTokens(s, dbCtx)
+	assert.NoError(t, err, "failed to setup input data")
+
+	tokens, err := d.GetTokensByDevId(dbCtx, token1.DevId)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Token{*token1}, tokens)
+
+	tokens, err = d.GetTokensByDevId(dbCtx, "devId3")
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 0)
+}
+
+func TestStoreSetTokensLastUsed(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreSetTokensLastUsed in short mode.")
+	}
+
+	dbCtx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+	d := getDb(dbCtx)
+	defer d.session.Close()
+	s := d.session.Copy()
+	defer s.Close()
+
+	assert.NoError(t, setUpTokens(s, dbCtx))
+	assert.NoError(t, setUpDevices(s, dbCtx))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	before := now.Add(-time.Minute)
+
+	err := d.SetTokensLastUsed(dbCtx, []model.TokenUsage{
+		{TokenId: token1.Id, DeviceId: dev1.Id, LastUsed: now},
+		{TokenId: "id3", DeviceId: "id3", LastUsed: now},
+	})
+	assert.NoError(t, err)
+
+	// doesn't move back
+	err = d.SetTokensLastUsed(dbCtx, []model.TokenUsage{
+		{TokenId: token1.Id, DeviceId: dev1.Id, LastUsed: before},
+	})
+	assert.NoError(t, err)
+
+	tok, err := d.GetToken(dbCtx, token1.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, tok.LastUsed) {
+		assert.True(t, now.Equal(*tok.LastUsed))
+	}
+
+	tok, err = d.GetToken(dbCtx, token2.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, tok.LastUsed)
+
+	dev, err := d.GetDeviceById(dbCtx, dev1.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dev.TokenLastUsed) {
+		assert.True(t, now.Equal(*dev.TokenLastUsed))
+	}
+}
+
+func TestStoreSetDevicesLastCheckin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreSetDevicesLastCheckin in short mode.")
+	}
+
+	dbCtx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+	d := getDb(dbCtx)
+	defer d.session.Close()
+	s := d.session.Copy()
+	defer s.Close()
+
+	assert.NoError(t, setUpDevices(s, dbCtx))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	before := now.Add(-time.Minute)
+
+	err := d.SetDevicesLastCheckin(dbCtx, []model.DeviceCheckin{
+		{DeviceId: dev1.Id, Time: now},
+		{DeviceId: "id3", Time: now},
+	})
+	assert.NoError(t, err)
+
+	// doesn't move back
+	err = d.SetDevicesLastCheckin(dbCtx, []model.DeviceCheckin{
+		{DeviceId: dev1.Id, Time: before},
+	})
+	assert.NoError(t, err)
+
+	dev, err := d.GetDeviceById(dbCtx, dev1.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dev.LastCheckin) {
+		assert.True(t, now.Equal(*dev.LastCheckin))
+	}
+
+	dev, err = d.GetDeviceById(dbCtx, dev2.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, dev.LastCheckin)
+}
+
 func TestStoreDeleteTokens(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping TestDeleteTokens in short mode.")
@@ -686,6 +908,153 @@ func TestStoreDeleteTokenByDevId(t *testing.T) {
 	}
 }
 
+func TestStoreDeleteExpiredTokens(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreDeleteExpiredTokens in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "tenant-foo",
+	})
+
+	d := getDb(ctx)
+	defer d.session.Close()
+
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	for _, tok := range []model.Token{
+		{Id: "expired1", DevId: "dev1", Exp: &past},
+		{Id: "expired2", DevId: "dev1", Exp: &past},
+		{Id: "expired3", DevId: "dev2", Exp: &future, ExpiresAt: &past},
+		{Id: "valid1", DevId: "dev2", Exp: &future},
+		{Id: "valid2", DevId: "dev2", Exp: &future, ExpiresAt: &future},
+		// issued before 'exp' was stored
+		{Id: "legacy", DevId: "dev3"},
+	} {
+		assert.NoError(t, d.AddToken(ctx, tok))
+	}
+
+	// other tenant
+	n, err := d.DeleteExpiredTokens(context.Background(), now, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = d.DeleteExpiredTokens(ctx, now, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	toks := []model.Token{}
+	s := d.session.Copy()
+	defer s.Close()
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl).
+		Find(nil).Sort("_id").All(&toks)
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, tok := range toks {
+		ids = append(ids, tok.Id)
+	}
+	assert.Equal(t, []string{"legacy", "valid1", "valid2"}, ids)
+
+	// expired tokens are not revoked
+	revoked, err := d.GetRevokedTokens(ctx, time.Time{}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, revoked, 0)
+}
+
+func TestStoreDeleteOldestDeviceTokens(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreDeleteOldestDeviceTokens in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "tenant-foo",
+	})
+
+	d := getDb(ctx)
+	defer d.session.Close()
+
+	now := time.Now().UTC()
+	issued := func(ago time.Duration) *time.Time {
+		ts := now.Add(-ago)
+		return &ts
+	}
+
+	for _, tok := range []model.Token{
+		{Id: "newest", DevId: "dev1", IssuedTs: issued(time.Second)},
+		{Id: "oldest", DevId: "dev1", IssuedTs: issued(time.Hour)},
+		{Id: "middle", DevId: "dev1", IssuedTs: issued(time.Minute)},
+		// issued before the issue time was stored
+		{Id: "legacy", DevId: "dev1"},
+		{Id: "other", DevId: "dev2", IssuedTs: issued(time.Hour)},
+	} {
+		assert.NoError(t, d.AddToken(ctx, tok))
+	}
+
+	ids, err := d.DeleteOldestDeviceTokens(ctx, "dev1", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"oldest", "legacy"}, ids)
+
+	// within the limit
+	ids, err = d.DeleteOldestDeviceTokens(ctx, "dev1", 2)
+	assert.NoError(t, err)
+	assert.Len(t, ids, 0)
+
+	toks := []model.Token{}
+	s := d.session.Copy()
+	defer s.Close()
+	err = s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokensColl).
+		Find(nil).Sort("_id").All(&toks)
+	assert.NoError(t, err)
+	left := []string{}
+	for _, tok := range toks {
+		left = append(left, tok.Id)
+	}
+	assert.Equal(t, []string{"middle", "newest", "other"}, left)
+
+	// deleted tokens are revoked
+	revoked, err := d.GetRevokedTokens(ctx, time.Time{}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, revoked, 2)
+}
+
+func TestStoreDeleteAuthSetTokens(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreDeleteAuthSetTokens in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "tenant-foo",
+	})
+
+	d := getDb(ctx)
+	defer d.session.Close()
+
+	for _, tok := range []model.Token{
+		{Id: "tok1", DevId: "dev1", AuthSetId: "aid1"},
+		{Id: "tok2", DevId: "dev1", AuthSetId: "aid2"},
+		{Id: "tok3", DevId: "dev1", AuthSetId: "aid1"},
+	} {
+		assert.NoError(t, d.AddToken(ctx, tok))
+	}
+
+	ids, err := d.DeleteAuthSetTokens(ctx, "aid1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tok1", "tok3"}, ids)
+
+	ids, err = d.DeleteAuthSetTokens(ctx, "aid1")
+	assert.NoError(t, err)
+	assert.Len(t, ids, 0)
+
+	_, err = d.GetToken(ctx, "tok2")
+	assert.NoError(t, err)
+
+	revoked, err := d.GetRevokedTokens(ctx, time.Time{}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, revoked, 2)
+}
+
 func verifyIndexes(t *testing.T, coll *mgo.Collection, expected []mgo.Index) {
 	idxs, err := coll.Indexes()
 	assert.NoError(t, err)
@@ -727,7 +1096,7 @@ func TestStoreMigrate(t *testing.T) {
 		DbVersion + " no automigrate": {
 			automigrate: false,
 			version:     DbVersion,
-			err:         "failed to apply migrations: db needs migration: deviceauth has version 0.0.0, needs version 1.5.0",
+			err:         "failed to apply migrations: db needs migration: deviceauth has version 0.0.0, needs version 1.7.0",
 		},
 		DbVersion + " multitenant": {
 			automigrate: true,
@@ -739,7 +1108,7 @@ func TestStoreMigrate(t *testing.T) {
 			automigrate: false,
 			tenantDbs:   []string{"deviceauth-tenant1id", "deviceauth-tenant2id"},
 			version:     DbVersion,
-			err:         "failed to apply migrations: db needs migration: deviceauth-tenant1id has version 0.0.0, needs version 1.5.0",
+			err:         "failed to apply migrations: db needs migration: deviceauth-tenant1id has version 0.0.0, needs version 1.7.0",
 		},
 		"0.1 error": {
 			automigrate: true,
@@ -797,7 +1166,52 @@ func TestStoreMigrate(t *testing.T) {
 								Key:        []string{model.DevKeyIdData},
 								Name:       indexDevices_IdentityData,
 								Background: false,
-							}})
+							},
+								{
+									Key:        []string{model.DevKeyDecommissionAt},
+									Name:       indexDevices_DecommissionAt,
+									Sparse:     true,
+									Background: false,
+								},
+								{
+									Key:        []string{model.DevKeyStatus},
+									Name:       indexDevices_Status,
+									Background: false,
+								},
+								{
+									Key:        []string{model.DevKeyIdDataValues},
+									Name:       indexDevices_IdentityDataValues,
+									Background: false,
+								},
+								{
+									Key:        []string{model.DevKeyCreatedTs},
+									Name:       indexDevices_CreatedTs,
+									Background: false,
+								},
+								{
+									Key:        []string{model.DevKeyGroup},
+									Name:       indexDevices_Group,
+									Sparse:     true,
+									Background: false,
+								},
+								{
+									Key:        []string{model.DevKeyUpdatedTs},
+									Name:       indexDevices_UpdatedTs,
+									Background: false,
+								},
+								{
+									Key:        []string{model.DevKeyConflict},
+									Name:       indexDevices_Conflict,
+									Sparse:     true,
+									Background: false,
+								},
+								{
+									Key:        []string{model.DevKeyAlias},
+									Name:       indexDevices_Alias,
+									Sparse:     true,
+									Background: false,
+								},
+							})
 						verifyIndexes(t, db.session.DB(d).C(DbAuthSetColl),
 							[]mgo.Index{{
 								Unique: true,
@@ -819,6 +1233,19 @@ func TestStoreMigrate(t *testing.T) {
 									Name:       indexAuthSet_DeviceId_IdentityDataSha256_PubKey,
 									Background: false,
 								},
+								{
+									Key:        []string{model.AuthSetKeyPubKey},
+									Name:       indexAuthSet_PubKey,
+									Background: false,
+								},
+								{
+									Key: []string{
+										model.AuthSetKeyStatus,
+										model.AuthSetKeyTimestamp,
+									},
+									Name:       indexAuthSet_Status_Timestamp,
+									Background: false,
+								},
 							})
 					}
 				}
@@ -919,48 +1346,452 @@ func TestStoreGetDevices(t *testing.T) {
 			expectedStartId: 0,
 			expectedEndId:   devCount - 1,
 		},
-		"filter preauthorized": {
-			skip:            0,
-			limit:           devCount,
-			filter:          store.DeviceFilter{Status: model.DevStatusPreauth},
-			expectedCount:   devCount,
-			expectedStartId: 0,
-			expectedEndId:   devCount - 1,
+		"filter preauthorized": {
+			skip:            0,
+			limit:           devCount,
+			filter:          store.DeviceFilter{Status: model.DevStatusPreauth},
+			expectedCount:   devCount,
+			expectedStartId: 0,
+			expectedEndId:   devCount - 1,
+		},
+		"filter pending": {
+			skip:            0,
+			limit:           devCount,
+			filter:          store.DeviceFilter{Status: model.DevStatusPending},
+			expectedCount:   devCount,
+			expectedStartId: 0,
+			expectedEndId:   devCount - 1,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			dbdevs, err := db.GetDevices(ctx, tc.skip, tc.limit, tc.filter)
+			assert.NoError(t, err)
+
+			emptyFilter := store.DeviceFilter{}
+			if tc.filter != emptyFilter {
+				for _, d := range dbdevs {
+					assert.Equal(t, tc.filter.Status, d.Status)
+					assert.Len(t, dbdevs, devsCountByStatus[tc.filter.Status])
+				}
+			} else {
+				assert.Len(t, dbdevs, tc.expectedCount)
+				for i, dbidx := tc.expectedStartId, 0; i <= tc.expectedEndId; i, dbidx = i+1, dbidx+1 {
+					// make sure that ID is not empty
+					assert.NotEmpty(t, dbdevs[dbidx].Id)
+					// clear it now so that next assert does not fail
+					dbdevs[dbidx].Id = ""
+					assert.EqualValues(t, devs_list[i], dbdevs[dbidx])
+				}
+			}
+		})
+	}
+}
+
+func TestStoreGetDevicesSearch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreGetDevicesSearch in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	for _, dev := range []model.Device{
+		{
+			Id:     "1",
+			IdData: `{"mac":"00:11:22:AA:BB:CC","sn":"SN0001"}`,
+			IdDataStruct: map[string]interface{}{
+				"mac": "00:11:22:AA:BB:CC",
+				"sn":  "SN0001",
+			},
+			Status: model.DevStatusAccepted,
+		},
+		{
+			Id:     "2",
+			IdData: `{"mac":["00:11:22:dd:ee:ff","00:11:33:00:00:01"],"sn":"SN00012"}`,
+			IdDataStruct: map[string]interface{}{
+				"mac": []interface{}{"00:11:22:dd:ee:ff", "00:11:33:00:00:01"},
+				"sn":  "SN00012",
+			},
+			Status: model.DevStatusPending,
+		},
+		{
+			Id:     "3",
+			IdData: `{"sn":"SN0003","rev":2}`,
+			IdDataStruct: map[string]interface{}{
+				"sn":  "SN0003",
+				"rev": 2,
+			},
+			Alias:  "Lobby kiosk",
+			Status: model.DevStatusPending,
+		},
+	} {
+		assert.NoError(t, db.AddDevice(ctx, dev))
+	}
+
+	testCases := map[string]struct {
+		filter store.DeviceFilter
+
+		ids []string
+	}{
+		"substring": {
+			filter: store.DeviceFilter{Search: "sn0001"},
+			ids:    []string{"1", "2"},
+		},
+		"substring, array attribute": {
+			filter: store.DeviceFilter{Search: "33:00"},
+			ids:    []string{"2"},
+		},
+		"substring, regex characters quoted": {
+			filter: store.DeviceFilter{Search: "SN.*"},
+			ids:    []string{},
+		},
+		"exact": {
+			filter: store.DeviceFilter{Search: "SN0001", SearchExact: true},
+			ids:    []string{"1"},
+		},
+		"exact, case sensitive": {
+			filter: store.DeviceFilter{Search: "sn0001", SearchExact: true},
+			ids:    []string{},
+		},
+		"exact, number": {
+			filter: store.DeviceFilter{Search: "2", SearchExact: true},
+			ids:    []string{"3"},
+		},
+		"with status": {
+			filter: store.DeviceFilter{
+				Status: model.DevStatusPending,
+				Search: "00:11:22",
+			},
+			ids: []string{"2"},
+		},
+		"alias": {
+			filter: store.DeviceFilter{Search: "kiosk"},
+			ids:    []string{"3"},
+		},
+		"alias, exact": {
+			filter: store.DeviceFilter{Search: "Lobby kiosk", SearchExact: true},
+			ids:    []string{"3"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devs, err := db.GetDevices(ctx, 0, 10, tc.filter)
+			assert.NoError(t, err)
+
+			ids := []string{}
+			for _, d := range devs {
+				ids = append(ids, d.Id)
+			}
+			assert.Equal(t, tc.ids, ids)
+
+			count, err := db.CountDevices(ctx, tc.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, len(tc.ids), count)
+		})
+	}
+}
+
+func TestStoreGetDevicesSort(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreGetDevicesSort in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	for _, dev := range []model.Device{
+		{
+			Id:        "1",
+			IdData:    "foo-0001",
+			Status:    model.DevStatusPending,
+			CreatedTs: ts.Add(time.Minute),
+		},
+		{
+			Id:        "2",
+			IdData:    "foo-0002",
+			Status:    model.DevStatusAccepted,
+			CreatedTs: ts,
+		},
+		{
+			Id:        "3",
+			IdData:    "foo-0003",
+			Status:    model.DevStatusPending,
+			CreatedTs: ts.Add(time.Hour),
+		},
+		{
+			Id:        "4",
+			IdData:    "foo-0004",
+			Status:    model.DevStatusAccepted,
+			CreatedTs: ts.Add(time.Hour),
+		},
+	} {
+		assert.NoError(t, db.AddDevice(ctx, dev))
+	}
+
+	testCases := map[string]struct {
+		filter store.DeviceFilter
+
+		ids []string
+	}{
+		"default": {
+			ids: []string{"1", "2", "3", "4"},
+		},
+		"id, desc": {
+			filter: store.DeviceFilter{
+				Sort: store.DeviceSort{Field: store.DeviceSortId, Desc: true},
+			},
+			ids: []string{"4", "3", "2", "1"},
+		},
+		"created_ts": {
+			filter: store.DeviceFilter{
+				Sort: store.DeviceSort{Field: store.DeviceSortCreatedTs},
+			},
+			ids: []string{"2", "1", "3", "4"},
+		},
+		"created_ts, desc, pending": {
+			filter: store.DeviceFilter{
+				Status: model.DevStatusPending,
+				Sort:   store.DeviceSort{Field: store.DeviceSortCreatedTs, Desc: true},
+			},
+			ids: []string{"3", "1"},
+		},
+		"status": {
+			filter: store.DeviceFilter{
+				Sort: store.DeviceSort{Field: store.DeviceSortStatus},
+			},
+			ids: []string{"2", "4", "1", "3"},
+		},
+		"after, id, desc": {
+			filter: store.DeviceFilter{
+				Sort:  store.DeviceSort{Field: store.DeviceSortId, Desc: true},
+				After: &store.Cursor{Id: "3"},
+			},
+			ids: []string{"2", "1"},
+		},
+		"after, created_ts, desc": {
+			filter: store.DeviceFilter{
+				Sort: store.DeviceSort{Field: store.DeviceSortCreatedTs, Desc: true},
+				After: &store.Cursor{
+					Id: "3",
+					Ts: uto.TimePtr(ts.Add(time.Hour)),
+				},
+			},
+			ids: []string{"4", "1", "2"},
+		},
+		"after, status": {
+			filter: store.DeviceFilter{
+				Sort: store.DeviceSort{Field: store.DeviceSortStatus},
+				After: &store.Cursor{
+					Id:  "4",
+					Str: model.DevStatusAccepted,
+				},
+			},
+			ids: []string{"1", "3"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devs, err := db.GetDevices(ctx, 0, 10, tc.filter)
+			assert.NoError(t, err)
+
+			ids := []string{}
+			for _, d := range devs {
+				ids = append(ids, d.Id)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestStoreGetDevicesTimeRange(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreGetDevicesTimeRange in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	for _, dev := range []model.Device{
+		{
+			Id:        "1",
+			IdData:    "foo-0001",
+			Status:    model.DevStatusPending,
+			CreatedTs: ts,
+			UpdatedTs: ts.Add(2 * time.Hour),
+		},
+		{
+			Id:        "2",
+			IdData:    "foo-0002",
+			Status:    model.DevStatusAccepted,
+			CreatedTs: ts.Add(time.Hour),
+			UpdatedTs: ts.Add(time.Hour),
+		},
+		{
+			Id:        "3",
+			IdData:    "foo-0003",
+			Status:    model.DevStatusPending,
+			CreatedTs: ts.Add(2 * time.Hour),
+			UpdatedTs: ts.Add(2 * time.Hour),
+		},
+	} {
+		assert.NoError(t, db.AddDevice(ctx, dev))
+	}
+
+	testCases := map[string]struct {
+		filter store.DeviceFilter
+
+		ids []string
+	}{
+		"created after": {
+			filter: store.DeviceFilter{CreatedAfter: uto.TimePtr(ts)},
+			ids:    []string{"2", "3"},
+		},
+		"created before": {
+			filter: store.DeviceFilter{
+				CreatedBefore: uto.TimePtr(ts.Add(2 * time.Hour)),
+			},
+			ids: []string{"1", "2"},
+		},
+		"created between, pending": {
+			filter: store.DeviceFilter{
+				Status:        model.DevStatusPending,
+				CreatedAfter:  uto.TimePtr(ts.Add(-time.Minute)),
+				CreatedBefore: uto.TimePtr(ts.Add(3 * time.Hour)),
+			},
+			ids: []string{"1", "3"},
+		},
+		"updated after": {
+			filter: store.DeviceFilter{
+				UpdatedAfter: uto.TimePtr(ts.Add(time.Hour)),
+			},
+			ids: []string{"1", "3"},
 		},
-		"filter pending": {
-			skip:            0,
-			limit:           devCount,
-			filter:          store.DeviceFilter{Status: model.DevStatusPending},
-			expectedCount:   devCount,
-			expectedStartId: 0,
-			expectedEndId:   devCount - 1,
+		"none": {
+			filter: store.DeviceFilter{
+				CreatedAfter: uto.TimePtr(ts.Add(2 * time.Hour)),
+			},
+			ids: []string{},
 		},
 	}
 
-	for name := range testCases {
-		tc := testCases[name]
-		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
-			dbdevs, err := db.GetDevices(ctx, tc.skip, tc.limit, tc.filter)
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devs, err := db.GetDevices(ctx, 0, 10, tc.filter)
 			assert.NoError(t, err)
 
-			emptyFilter := store.DeviceFilter{}
-			if tc.filter != emptyFilter {
-				for _, d := range dbdevs {
-					assert.Equal(t, tc.filter.Status, d.Status)
-					assert.Len(t, dbdevs, devsCountByStatus[tc.filter.Status])
-				}
-			} else {
-				assert.Len(t, dbdevs, tc.expectedCount)
-				for i, dbidx := tc.expectedStartId, 0; i <= tc.expectedEndId; i, dbidx = i+1, dbidx+1 {
-					// make sure that ID is not empty
-					assert.NotEmpty(t, dbdevs[dbidx].Id)
-					// clear it now so that next assert does not fail
-					dbdevs[dbidx].Id = ""
-					assert.EqualValues(t, devs_list[i], dbdevs[dbidx])
-				}
+			ids := []string{}
+			for _, d := range devs {
+				ids = append(ids, d.Id)
 			}
+			assert.Equal(t, tc.ids, ids)
+
+			count, err := db.CountDevices(ctx, tc.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, len(tc.ids), count)
+		})
+	}
+}
+
+func TestStoreAuthSetConflicts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreAuthSetConflicts in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	for i, key := range []string{"key1", "key1", "key2"} {
+		id := fmt.Sprintf("%d", i+1)
+		err := db.AddDevice(ctx, model.Device{
+			Id:     id,
+			IdData: fmt.Sprintf("foo-%04d", i),
+			Status: model.DevStatusPending,
+		})
+		assert.NoError(t, err)
+		err = db.AddAuthSet(ctx, model.AuthSet{
+			Id:       "aid" + id,
+			DeviceId: id,
+			IdData:   fmt.Sprintf("foo-%04d", i),
+			PubKey:   key,
+			Status:   model.DevStatusPending,
 		})
+		assert.NoError(t, err)
+	}
+
+	sets, err := db.GetAuthSetsByPubKey(ctx, "key1")
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, s := range sets {
+		ids = append(ids, s.Id)
+	}
+	assert.Len(t, ids, 2)
+	assert.Contains(t, ids, "aid1")
+	assert.Contains(t, ids, "aid2")
+
+	sets, err = db.GetAuthSetsByPubKey(ctx, "key3")
+	assert.NoError(t, err)
+	assert.Len(t, sets, 0)
+
+	err = db.UpdateAuthSet(ctx, model.AuthSet{PubKey: "key1"},
+		model.AuthSetUpdate{Conflict: model.AuthSetConflictPubKey})
+	assert.NoError(t, err)
+	for _, id := range []string{"1", "2"} {
+		err = db.UpdateDevice(ctx, model.Device{Id: id},
+			model.DeviceUpdate{Conflict: to.BoolPtr(true)})
+		assert.NoError(t, err)
+	}
+
+	set, err := db.GetAuthSetById(ctx, "aid2")
+	assert.NoError(t, err)
+	assert.Equal(t, model.AuthSetConflictPubKey, set.Conflict)
+
+	filter := store.DeviceFilter{Conflict: true}
+	devs, err := db.GetDevices(ctx, 0, 10, filter)
+	assert.NoError(t, err)
+	ids = []string{}
+	for _, d := range devs {
+		assert.True(t, d.Conflict)
+		ids = append(ids, d.Id)
 	}
+	assert.Equal(t, []string{"1", "2"}, ids)
+
+	count, err := db.CountDevices(ctx, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	err = db.ClearConflicts(ctx, []string{"1", "2"})
+	assert.NoError(t, err)
+
+	set, err = db.GetAuthSetById(ctx, "aid2")
+	assert.NoError(t, err)
+	assert.Equal(t, "", set.Conflict)
+
+	count, err = db.CountDevices(ctx, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
 }
 
 func TestStoreAuthSet(t *testing.T) {
@@ -1688,6 +2519,48 @@ func TestStoreGetDevCountByStatus(t *testing.T) {
 	}
 }
 
+func TestStoreGetDevCounts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreGetDevCounts in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	statuses := []string{
+		model.DevStatusPending,
+		model.DevStatusPending,
+		model.DevStatusAccepted,
+		model.DevStatusAccepted,
+		model.DevStatusAccepted,
+		model.DevStatusRejected,
+		model.DevStatusPreauth,
+	}
+	for i, status := range statuses {
+		err := db.AddDevice(ctx, model.Device{
+			Id:     fmt.Sprintf("%d", i),
+			IdData: fmt.Sprintf("foo-%04d", i),
+			PubKey: fmt.Sprintf("pubkey-%04d", i),
+			Status: status,
+		})
+		assert.NoError(t, err)
+	}
+
+	counts, err := db.GetDevCounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.DeviceCounts{
+		Count:         7,
+		Pending:       2,
+		Accepted:      3,
+		Rejected:      1,
+		Preauthorized: 1,
+	}, counts)
+}
+
 // generate a list of devices having the desired number of total accepted/preauthorized/pending/rejected devices
 // auth sets for these devs will generated semi-randomly to aggregate to a given device's target status
 func getDevsWithStatuses(accepted, preauthorized, pending, rejected int) map[*model.Device][]model.AuthSet {
@@ -2418,3 +3291,338 @@ func getIdDataHash(idData string) []byte {
 	hash.Write([]byte(idData))
 	return hash.Sum(nil)
 }
+
+func TestStoreScheduledDecommissions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreScheduledDecommissions in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	for _, id := range []string{"dev1", "dev2", "dev3"} {
+		assert.NoError(t, db.AddDevice(ctx, model.Device{
+			Id:     id,
+			IdData: "{\"sn\":\"" + id + "\"}",
+		}))
+	}
+
+	assert.NoError(t, db.SetDeviceDecommissionAt(ctx, "dev1",
+		uto.TimePtr(now.Add(time.Hour))))
+	assert.NoError(t, db.SetDeviceDecommissionAt(ctx, "dev2",
+		uto.TimePtr(now.Add(-time.Hour))))
+	assert.EqualError(t, db.SetDeviceDecommissionAt(ctx, "dev4",
+		uto.TimePtr(now)), store.ErrDevNotFound.Error())
+
+	devs, err := db.GetScheduledDecommissions(ctx, time.Time{}, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, devs, 2) {
+		assert.Equal(t, "dev2", devs[0].Id)
+		assert.Equal(t, "dev1", devs[1].Id)
+		assert.Equal(t, now.Add(time.Hour), devs[1].DecommissionAt.UTC())
+	}
+
+	devs, err = db.GetScheduledDecommissions(ctx, now, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, devs, 1) {
+		assert.Equal(t, "dev2", devs[0].Id)
+	}
+
+	// only due devices are claimed, once
+	assert.EqualError(t, db.ClaimDecommission(ctx, "dev1", now),
+		store.ErrDevNotFound.Error())
+	assert.NoError(t, db.ClaimDecommission(ctx, "dev2", now))
+	assert.EqualError(t, db.ClaimDecommission(ctx, "dev2", now),
+		store.ErrDevNotFound.Error())
+	assert.EqualError(t, db.ClaimDecommission(ctx, "dev3", now),
+		store.ErrDevNotFound.Error())
+
+	// cancel
+	assert.NoError(t, db.SetDeviceDecommissionAt(ctx, "dev2",
+		uto.TimePtr(now.Add(-time.Hour))))
+	assert.NoError(t, db.SetDeviceDecommissionAt(ctx, "dev2", nil))
+
+	devs, err = db.GetScheduledDecommissions(ctx, now, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, devs, 0)
+
+	dev, err := db.GetDeviceById(ctx, "dev2")
+	assert.NoError(t, err)
+	assert.Nil(t, dev.DecommissionAt)
+
+	// not visible to other tenants
+	devs, err = db.GetScheduledDecommissions(context.Background(),
+		time.Time{}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, devs, 0)
+}
+
+func TestStoreGetStaleRejectedDevices(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreGetStaleRejectedDevices in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	old := now.Add(-30 * 24 * time.Hour)
+	before := now.Add(-7 * 24 * time.Hour)
+
+	devs := []model.Device{
+		// stale, by last check-in
+		{Id: "dev1", Status: model.DevStatusRejected, UpdatedTs: now, LastCheckin: &old},
+		// stale, never checked in
+		{Id: "dev2", Status: model.DevStatusRejected, UpdatedTs: old},
+		// checked in recently
+		{Id: "dev3", Status: model.DevStatusRejected, UpdatedTs: old, LastCheckin: &now},
+		// updated recently
+		{Id: "dev4", Status: model.DevStatusRejected, UpdatedTs: now},
+		// not rejected
+		{Id: "dev5", Status: model.DevStatusPending, UpdatedTs: old, LastCheckin: &old},
+	}
+	for _, d := range devs {
+		d.IdData = "{\"sn\":\"" + d.Id + "\"}"
+		assert.NoError(t, db.AddDevice(ctx, d))
+	}
+
+	res, err := db.GetStaleRejectedDevices(ctx, before, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, res, 2) {
+		assert.Equal(t, "dev1", res[0].Id)
+		assert.Equal(t, "dev2", res[1].Id)
+	}
+
+	res, err = db.GetStaleRejectedDevices(ctx, before, 1, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, res, 1) {
+		assert.Equal(t, "dev2", res[0].Id)
+	}
+
+	// not visible to other tenants
+	res, err = db.GetStaleRejectedDevices(context.Background(), before, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, res, 0)
+}
+
+func TestStoreQuarantinedDevice(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreQuarantinedDevice in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	devs := []model.Device{
+		{Id: "dev1", IdData: "{\"sn\":\"0001\"}", Status: model.DevStatusAccepted},
+		{Id: "dev2", IdData: "{\"sn\":\"0002\"}", Status: model.DevStatusPending},
+	}
+	for _, d := range devs {
+		assert.NoError(t, db.AddDevice(ctx, d))
+	}
+
+	prev, err := db.SetDeviceStatus(ctx, "dev1", model.DevStatusQuarantined)
+	assert.NoError(t, err)
+	assert.Equal(t, model.DevStatusAccepted, prev)
+
+	// auth set changes don't lift the quarantine
+	prev, err = db.SetDeviceStatus(ctx, "dev1", model.DevStatusPending)
+	assert.NoError(t, err)
+	assert.Equal(t, model.DevStatusQuarantined, prev)
+
+	dev, err := db.GetDeviceById(ctx, "dev1")
+	assert.NoError(t, err)
+	assert.Equal(t, model.DevStatusQuarantined, dev.Status)
+
+	err = db.ReleaseQuarantinedDevice(ctx, "dev2", model.DevStatusAccepted)
+	assert.Equal(t, store.ErrDevNotFound, err)
+	err = db.ReleaseQuarantinedDevice(ctx, "dev3", model.DevStatusAccepted)
+	assert.Equal(t, store.ErrDevNotFound, err)
+
+	err = db.ReleaseQuarantinedDevice(ctx, "dev1", model.DevStatusPending)
+	assert.NoError(t, err)
+
+	dev, err = db.GetDeviceById(ctx, "dev1")
+	assert.NoError(t, err)
+	assert.Equal(t, model.DevStatusPending, dev.Status)
+
+	dev, err = db.GetDeviceById(ctx, "dev2")
+	assert.NoError(t, err)
+	assert.Equal(t, model.DevStatusPending, dev.Status)
+}
+
+func TestStoreDeviceGroup(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreDeviceGroup in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	for _, id := range []string{"dev1", "dev2", "dev3"} {
+		assert.NoError(t, db.AddDevice(ctx, model.Device{
+			Id:     id,
+			IdData: "{\"sn\":\"" + id + "\"}",
+		}))
+	}
+
+	assert.NoError(t, db.SetDeviceGroup(ctx, "dev1", "site-1"))
+	assert.NoError(t, db.SetDeviceGroup(ctx, "dev2", "site-1"))
+	assert.NoError(t, db.SetDeviceGroup(ctx, "dev3", "site-2"))
+	assert.EqualError(t, db.SetDeviceGroup(ctx, "dev4", "site-1"),
+		store.ErrDevNotFound.Error())
+
+	filter := store.DeviceFilter{Group: "site-1"}
+	devs, err := db.GetDevices(ctx, 0, 10, filter)
+	assert.NoError(t, err)
+	if assert.Len(t, devs, 2) {
+		assert.Equal(t, "dev1", devs[0].Id)
+		assert.Equal(t, "site-1", devs[0].Group)
+		assert.Equal(t, "dev2", devs[1].Id)
+	}
+
+	count, err := db.CountDevices(ctx, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// remove from group
+	assert.NoError(t, db.SetDeviceGroup(ctx, "dev2", ""))
+
+	devs, err = db.GetDevices(ctx, 0, 10, filter)
+	assert.NoError(t, err)
+	if assert.Len(t, devs, 1) {
+		assert.Equal(t, "dev1", devs[0].Id)
+	}
+
+	dev, err := db.GetDeviceById(ctx, "dev2")
+	assert.NoError(t, err)
+	assert.Equal(t, "", dev.Group)
+}
+
+func TestStoreUpdateDeviceAnnotations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreUpdateDeviceAnnotations in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	str := func(s string) *string {
+		return &s
+	}
+
+	assert.NoError(t, db.AddDevice(ctx, model.Device{
+		Id:     "dev1",
+		IdData: "{\"sn\":\"dev1\"}",
+	}))
+
+	assert.NoError(t, db.UpdateDeviceAnnotations(ctx, "dev1",
+		model.DeviceAnnotations{
+			Alias: str("lobby-kiosk"),
+			Notes: str("rejected, not ours"),
+			Labels: map[string]*string{
+				"owner": str("ops"),
+				"site":  str("lab"),
+			},
+			Group: str("site-1"),
+		}))
+
+	dev, err := db.GetDeviceById(ctx, "dev1")
+	assert.NoError(t, err)
+	assert.Equal(t, "rejected, not ours", dev.Notes)
+	assert.Equal(t, map[string]string{"owner": "ops", "site": "lab"},
+		dev.Labels)
+	assert.Equal(t, "site-1", dev.Group)
+	assert.Equal(t, "lobby-kiosk", dev.Alias)
+
+	// labels are merged, notes kept unless given
+	assert.NoError(t, db.UpdateDeviceAnnotations(ctx, "dev1",
+		model.DeviceAnnotations{
+			Labels: map[string]*string{
+				"owner": str("qa"),
+				"site":  nil,
+			},
+		}))
+
+	dev, err = db.GetDeviceById(ctx, "dev1")
+	assert.NoError(t, err)
+	assert.Equal(t, "rejected, not ours", dev.Notes)
+	assert.Equal(t, map[string]string{"owner": "qa"}, dev.Labels)
+
+	// clear alias, notes and group
+	assert.NoError(t, db.UpdateDeviceAnnotations(ctx, "dev1",
+		model.DeviceAnnotations{
+			Alias: str(""),
+			Notes: str(""),
+			Group: str(""),
+		}))
+
+	dev, err = db.GetDeviceById(ctx, "dev1")
+	assert.NoError(t, err)
+	assert.Equal(t, "", dev.Alias)
+	assert.Equal(t, "", dev.Notes)
+	assert.Equal(t, "", dev.Group)
+
+	assert.EqualError(t, db.UpdateDeviceAnnotations(ctx, "dev2",
+		model.DeviceAnnotations{Notes: str("foo")}),
+		store.ErrDevNotFound.Error())
+}
+
+func TestStoreTenantSuspended(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreTenantSuspended in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+	otherCtx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "other",
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	// not suspended unless marked
+	suspended, err := db.IsTenantSuspended(ctx)
+	assert.NoError(t, err)
+	assert.False(t, suspended)
+
+	assert.NoError(t, db.SetTenantSuspended(ctx, true))
+
+	suspended, err = db.IsTenantSuspended(ctx)
+	assert.NoError(t, err)
+	assert.True(t, suspended)
+
+	suspended, err = db.IsTenantSuspended(otherCtx)
+	assert.NoError(t, err)
+	assert.False(t, suspended)
+
+	assert.NoError(t, db.SetTenantSuspended(ctx, false))
+
+	suspended, err = db.IsTenantSuspended(ctx)
+	assert.NoError(t, err)
+	assert.False(t, suspended)
+}
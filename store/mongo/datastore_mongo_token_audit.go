@@ -0,0 +1,114 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func (db *DataStoreMongo) ensureTokenAuditIndexes(c *mgo.Collection) error {
+	retention := db.tokenAuditRetention
+	if retention == 0 {
+		retention = DefaultTokenAuditRetention
+	}
+
+	for _, idx := range []mgo.Index{
+		{
+			Key:         []string{"timestamp"},
+			Name:        indexTokenAudit_Timestamp,
+			ExpireAfter: retention,
+			Background:  false,
+		},
+		{
+			Key:        []string{"device_id", "timestamp"},
+			Name:       indexTokenAudit_DeviceId_Timestamp,
+			Background: false,
+		},
+	} {
+		if err := c.EnsureIndex(idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) AddTokenAuditRecord(ctx context.Context, r model.TokenAuditRecord) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokenAuditColl)
+
+	if err := db.ensureTokenAuditIndexes(c); err != nil {
+		return err
+	}
+
+	if err := c.Insert(r); err != nil {
+		return errors.Wrap(err, "failed to store token audit record")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetTokenAuditRecords(ctx context.Context, filter store.TokenAuditFilter, skip, limit uint) ([]model.TokenAuditRecord, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbTokenAuditColl)
+
+	query := bson.M{}
+	if filter.DeviceId != "" {
+		query["device_id"] = filter.DeviceId
+	}
+	if filter.TokenId != "" {
+		query["token_id"] = filter.TokenId
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.From != nil || filter.To != nil {
+		ts := bson.M{}
+		if filter.From != nil {
+			ts["$gte"] = *filter.From
+		}
+		if filter.To != nil {
+			ts["$lt"] = *filter.To
+		}
+		query["timestamp"] = ts
+	}
+	if filter.After != nil {
+		if filter.After.Ts == nil {
+			return nil, store.ErrInvalidCursor
+		}
+		query["$or"] = rangeAfter("timestamp", *filter.After.Ts, true,
+			filter.After.Id, true)
+	}
+
+	res := []model.TokenAuditRecord{}
+
+	err := c.Find(query).Sort("-timestamp", "-_id").
+		Skip(int(skip)).Limit(int(limit)).All(&res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch token audit records")
+	}
+
+	return res, nil
+}
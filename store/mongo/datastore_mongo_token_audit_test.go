@@ -0,0 +1,131 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreTokenAuditRecords(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreTokenAuditRecords in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "tenant-foo",
+	})
+
+	d := getDb(ctx)
+	defer d.session.Close()
+
+	ts := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	recs := []model.TokenAuditRecord{
+		{
+			Id:        "rec1",
+			Action:    model.TokenAuditActionIssued,
+			TokenId:   "jti1",
+			DeviceId:  "dev1",
+			Trigger:   model.TokenAuditTriggerAuthRequest,
+			Timestamp: ts,
+		},
+		{
+			Id:        "rec2",
+			Action:    model.TokenAuditActionRevoked,
+			TokenId:   "jti1",
+			DeviceId:  "dev1",
+			Trigger:   "renewed",
+			Timestamp: ts.Add(time.Minute),
+		},
+		{
+			Id:        "rec3",
+			Action:    model.TokenAuditActionIssued,
+			TokenId:   "jti2",
+			DeviceId:  "dev2",
+			Trigger:   model.TokenAuditTriggerAuthRequest,
+			Timestamp: ts.Add(time.Hour),
+		},
+	}
+	for _, r := range recs {
+		assert.NoError(t, d.AddTokenAuditRecord(ctx, r))
+	}
+
+	ids := func(recs []model.TokenAuditRecord) []string {
+		ids := []string{}
+		for _, r := range recs {
+			ids = append(ids, r.Id)
+		}
+		return ids
+	}
+
+	from := ts.Add(time.Minute)
+	to := ts.Add(time.Hour)
+	testCases := map[string]struct {
+		filter store.TokenAuditFilter
+		skip   uint
+		limit  uint
+
+		ids []string
+	}{
+		"all, newest first": {
+			limit: 10,
+			ids:   []string{"rec3", "rec2", "rec1"},
+		},
+		"paging": {
+			skip:  1,
+			limit: 1,
+			ids:   []string{"rec2"},
+		},
+		"device": {
+			filter: store.TokenAuditFilter{DeviceId: "dev1"},
+			limit:  10,
+			ids:    []string{"rec2", "rec1"},
+		},
+		"token, action": {
+			filter: store.TokenAuditFilter{
+				TokenId: "jti1",
+				Action:  model.TokenAuditActionIssued,
+			},
+			limit: 10,
+			ids:   []string{"rec1"},
+		},
+		"time range": {
+			filter: store.TokenAuditFilter{From: &from, To: &to},
+			limit:  10,
+			ids:    []string{"rec2"},
+		},
+		"after": {
+			filter: store.TokenAuditFilter{
+				After: store.TokenAuditCursor(&recs[2]),
+			},
+			limit: 10,
+			ids:   []string{"rec2", "rec1"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			res, err := d.GetTokenAuditRecords(ctx, tc.filter, tc.skip, tc.limit)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ids, ids(res))
+		})
+	}
+}
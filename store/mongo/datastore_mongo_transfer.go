@@ -0,0 +1,107 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+// transfers to another tenant are completed when the device enrolls in the
+// destination tenant, so, like device codes, transfers are kept in the
+// common database, with the source and destination tenants recorded
+
+func (db *DataStoreMongo) ensureTransferIndexes(s *mgo.Session) error {
+	c := s.DB(DbName).C(DbTransfersColl)
+
+	return c.EnsureIndex(mgo.Index{
+		Key:        []string{"to_tenant_id", "id_data_sha256", "status"},
+		Name:       indexTransfers_IdDataSha256,
+		Background: false,
+	})
+}
+
+func (db *DataStoreMongo) AddTransfer(ctx context.Context, t model.Transfer) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	if err := db.ensureTransferIndexes(s); err != nil {
+		return err
+	}
+
+	c := s.DB(DbName).C(DbTransfersColl)
+
+	if err := c.Insert(t); err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrObjectExists
+		}
+		return errors.Wrap(err, "failed to store transfer")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetTransfer(ctx context.Context, id string) (*model.Transfer, error) {
+	return db.getTransfer(bson.M{"_id": id})
+}
+
+func (db *DataStoreMongo) GetPendingTransferByIdDataHash(ctx context.Context, tenantId string, idDataHash []byte) (*model.Transfer, error) {
+	return db.getTransfer(bson.M{
+		"to_tenant_id":   tenantId,
+		"id_data_sha256": idDataHash,
+		"status":         model.TransferStatusPendingEnrollment,
+	})
+}
+
+func (db *DataStoreMongo) getTransfer(filter bson.M) (*model.Transfer, error) {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbTransfersColl)
+
+	var res model.Transfer
+
+	err := c.Find(filter).One(&res)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, store.ErrTransferNotFound
+		}
+		return nil, errors.Wrap(err, "failed to fetch transfer")
+	}
+
+	return &res, nil
+}
+
+func (db *DataStoreMongo) UpdateTransfer(ctx context.Context, id, status string, up model.TransferUpdate) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	c := s.DB(DbName).C(DbTransfersColl)
+
+	err := c.Update(bson.M{"_id": id, "status": status}, bson.M{"$set": up})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrTransferNotFound
+		}
+		return errors.Wrap(err, "failed to update transfer")
+	}
+
+	return nil
+}
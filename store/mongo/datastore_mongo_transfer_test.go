@@ -0,0 +1,103 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/store"
+)
+
+func TestStoreTransfer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestStoreTransfer in short mode.")
+	}
+
+	// tenant context must not matter
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	tr := model.Transfer{
+		Id:           "transfer1",
+		DeviceId:     "dev1",
+		TenantId:     tenant,
+		ToOwner:      "fleet-b",
+		ToTenantId:   "tenant2",
+		IdDataSha256: []byte("hash1"),
+		Status:       model.TransferStatusPendingEnrollment,
+		CreatedTs:    now,
+		UpdatedTs:    now,
+	}
+
+	assert.NoError(t, db.AddTransfer(ctx, tr))
+	assert.EqualError(t, db.AddTransfer(ctx, tr), store.ErrObjectExists.Error())
+
+	res, err := db.GetTransfer(context.Background(), "transfer1")
+	assert.NoError(t, err)
+	res.CreatedTs = res.CreatedTs.UTC()
+	res.UpdatedTs = res.UpdatedTs.UTC()
+	assert.Equal(t, tr, *res)
+
+	_, err = db.GetTransfer(ctx, "transfer2")
+	assert.EqualError(t, err, store.ErrTransferNotFound.Error())
+
+	res, err = db.GetPendingTransferByIdDataHash(context.Background(),
+		"tenant2", []byte("hash1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "transfer1", res.Id)
+
+	// other tenant
+	_, err = db.GetPendingTransferByIdDataHash(ctx, tenant, []byte("hash1"))
+	assert.EqualError(t, err, store.ErrTransferNotFound.Error())
+
+	assert.NoError(t, db.UpdateTransfer(ctx, "transfer1",
+		model.TransferStatusPendingEnrollment, model.TransferUpdate{
+			Status:      model.TransferStatusCompleted,
+			NewDeviceId: "dev2",
+		}))
+
+	// already completed
+	err = db.UpdateTransfer(ctx, "transfer1",
+		model.TransferStatusPendingEnrollment, model.TransferUpdate{
+			Status: model.TransferStatusCancelled,
+		})
+	assert.EqualError(t, err, store.ErrTransferNotFound.Error())
+
+	res, err = db.GetTransfer(ctx, "transfer1")
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransferStatusCompleted, res.Status)
+	assert.Equal(t, "dev2", res.NewDeviceId)
+
+	// no longer pending
+	_, err = db.GetPendingTransferByIdDataHash(ctx, "tenant2", []byte("hash1"))
+	assert.EqualError(t, err, store.ErrTransferNotFound.Error())
+
+	err = db.UpdateTransfer(ctx, "transfer2",
+		model.TransferStatusPendingEnrollment, model.TransferUpdate{
+			Status: model.TransferStatusCancelled,
+		})
+	assert.EqualError(t, err, store.ErrTransferNotFound.Error())
+}
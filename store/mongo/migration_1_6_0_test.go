@@ -0,0 +1,146 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/utils"
+)
+
+func TestMigration_1_6_0(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigration_1_6_0 in short mode.")
+	}
+
+	rsaKey := `-----BEGIN PUBLIC KEY-----
+MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAzogVU7RGDilbsoUt/DdH
+VJvcepl0A5+xzGQ50cq1VE/Dyyy8Zp0jzRXCnnu9nu395mAFSZGotZVr+sWEpO3c
+yC3VmXdBZmXmQdZqbdD/GuixJOYfqta2ytbIUPRXFN7/I7sgzxnXWBYXYmObYvdP
+okP0mQanY+WKxp7Q16pt1RoqoAd0kmV39g13rFl35muSHbSBoAW3GBF3gO+mF5Ty
+1ddp/XcgLOsmvNNjY+2HOD5F/RX0fs07mWnbD7x+xz7KEKjF+H7ZpkqCwmwCXaf0
+iyYyh1852rti3Afw4mDxuVSD7sd9ggvYMc0QHIpQNkD4YWOhNiE1AB0zH57VbUYG
+UwIDAQAB
+-----END PUBLIC KEY-----`
+
+	ecKey := `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEAcrvVOPBFKySuO62p2W+6AZm98k5
+jxUBPCRbCO3Oxbqa8Z0ar0tGLBS1r0/3HsmYT2OoxY/gBukZb+itsyv/mA==
+-----END PUBLIC KEY-----`
+
+	ts := time.Now()
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+	db.Wipe()
+	db := NewDataStoreMongoWithSession(db.Session())
+	s := db.session
+
+	devs := []model.Device{
+		{
+			Id:        "1",
+			IdData:    "{\"sn\":\"0001\"}",
+			PubKey:    rsaKey,
+			Status:    "accepted",
+			CreatedTs: ts,
+			UpdatedTs: ts,
+		},
+		{
+			Id:        "2",
+			IdData:    "{\"sn\":\"0002\"}",
+			PubKey:    "legacy",
+			Status:    "pending",
+			CreatedTs: ts,
+			UpdatedTs: ts,
+		},
+	}
+
+	asets := []model.AuthSet{
+		{
+			Id:        "1",
+			DeviceId:  "1",
+			IdData:    "{\"sn\":\"0001\"}",
+			Status:    "rejected",
+			PubKey:    rsaKey,
+			Timestamp: &ts,
+		},
+		{
+			Id:        "2",
+			DeviceId:  "1",
+			IdData:    "{\"sn\":\"0001\"}",
+			Status:    "accepted",
+			PubKey:    ecKey,
+			Timestamp: &ts,
+		},
+		{
+			Id:        "3",
+			DeviceId:  "2",
+			IdData:    "{\"sn\":\"0002\"}",
+			Status:    "pending",
+			PubKey:    "legacy",
+			Timestamp: &ts,
+		},
+	}
+
+	for _, d := range devs {
+		err := db.AddDevice(ctx, d)
+		assert.NoError(t, err)
+	}
+
+	for _, a := range asets {
+		err := db.AddAuthSet(ctx, a)
+		assert.NoError(t, err)
+	}
+
+	mig160 := migration_1_6_0{
+		ms:  db,
+		ctx: ctx,
+	}
+	err := mig160.Up(migrate.MakeVersion(1, 6, 0))
+	assert.NoError(t, err)
+
+	expectedDevs := map[string]string{
+		"1": utils.KeyTypeRSA,
+		"2": "",
+	}
+	for id, keyType := range expectedDevs {
+		var dev model.Device
+		err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+			C(DbDevicesColl).FindId(id).One(&dev)
+		assert.NoError(t, err)
+		assert.Equal(t, keyType, dev.KeyType)
+	}
+
+	expectedSets := map[string]string{
+		"1": utils.KeyTypeRSA,
+		"2": utils.KeyTypeECDSAP256,
+		"3": "",
+	}
+	for id, keyType := range expectedSets {
+		var set model.AuthSet
+		err = s.DB(ctxstore.DbFromContext(ctx, DbName)).
+			C(DbAuthSetColl).FindId(id).One(&set)
+		assert.NoError(t, err)
+		assert.Equal(t, keyType, set.KeyType)
+	}
+}
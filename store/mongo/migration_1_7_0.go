@@ -0,0 +1,80 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+// migration_1_7_0 records the identity attribute values of existing
+// devices, for searching them
+type migration_1_7_0 struct {
+	ms  *DataStoreMongo
+	ctx context.Context
+}
+
+func (m *migration_1_7_0) Up(from migrate.Version) error {
+	s := m.ms.session.Copy()
+
+	defer s.Close()
+
+	db := s.DB(ctxstore.DbFromContext(m.ctx, DbName))
+
+	iter := db.C(DbDevicesColl).Find(nil).Iter()
+
+	var dev model.Device
+
+	for iter.Next(&dev) {
+		idDataStruct := dev.IdDataStruct
+		if idDataStruct == nil {
+			var err error
+			idDataStruct, err = decode(dev.IdData)
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse id data of device %v: %v", dev.Id, dev.IdData)
+			}
+		}
+
+		values := idDataValues(idDataStruct)
+		if len(values) == 0 {
+			continue
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				model.DevKeyIdDataValues: values,
+			},
+		}
+
+		if err := db.C(DbDevicesColl).UpdateId(dev.Id, update); err != nil {
+			return errors.Wrapf(err, "failed to update device %v", dev.Id)
+		}
+	}
+
+	if err := iter.Close(); err != nil {
+		return errors.Wrap(err, "failed to close DB iterator")
+	}
+
+	return nil
+}
+
+func (m *migration_1_7_0) Version() migrate.Version {
+	return migrate.MakeVersion(1, 7, 0)
+}
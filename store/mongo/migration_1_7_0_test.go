@@ -0,0 +1,91 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+	ctxstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+func TestMigration_1_7_0(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigration_1_7_0 in short mode.")
+	}
+
+	ts := time.Now()
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+	db.Wipe()
+	db := NewDataStoreMongoWithSession(db.Session())
+	s := db.session
+
+	devs := []model.Device{
+		{
+			Id:     "1",
+			IdData: "{\"sn\":\"0001\",\"mac\":\"00:00:00:01\"}",
+			IdDataStruct: map[string]interface{}{
+				"sn":  "0001",
+				"mac": "00:00:00:01",
+			},
+			PubKey:    "pubkey1",
+			Status:    "accepted",
+			CreatedTs: ts,
+			UpdatedTs: ts,
+		},
+		{
+			// id data never parsed
+			Id:        "2",
+			IdData:    "{\"sn\":\"0002\",\"mac\":[\"00:00:00:02\",\"00:00:00:03\"]}",
+			PubKey:    "pubkey2",
+			Status:    "pending",
+			CreatedTs: ts,
+			UpdatedTs: ts,
+		},
+	}
+
+	c := s.DB(ctxstore.DbFromContext(ctx, DbName)).C(DbDevicesColl)
+	for _, d := range devs {
+		// as stored by previous versions
+		err := c.Insert(d)
+		assert.NoError(t, err)
+	}
+
+	mig170 := migration_1_7_0{
+		ms:  db,
+		ctx: ctx,
+	}
+	err := mig170.Up(migrate.MakeVersion(1, 7, 0))
+	assert.NoError(t, err)
+
+	expected := map[string][]string{
+		"1": {"0001", "00:00:00:01"},
+		"2": {"0002", "00:00:00:02", "00:00:00:03"},
+	}
+	for id, values := range expected {
+		var dev model.Device
+		err = c.FindId(id).One(&dev)
+		assert.NoError(t, err)
+		assert.Equal(t, values, dev.IdDataValues)
+	}
+}
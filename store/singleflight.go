@@ -0,0 +1,227 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+// flightCall is an in-flight datastore read shared by concurrent callers
+type flightCall struct {
+	wg   sync.WaitGroup
+	val  interface{}
+	err  error
+	dups int
+}
+
+// flightGroup collapses concurrent calls with the same key into one
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return c.val, c.err
+}
+
+// singleflightDataStore deduplicates concurrent reads of the same device,
+// auth set or token, e.g. during reconnect storms of a device fleet
+type singleflightDataStore struct {
+	DataStore
+	group flightGroup
+}
+
+// WithSingleflight wraps the datastore so that concurrent lookups of the
+// same device, auth set or token (per tenant) result in a single query.
+// Callers get their own deep copy of the result, which they are free to
+// modify.
+func WithSingleflight(ds DataStore) DataStore {
+	return &singleflightDataStore{
+		DataStore: ds,
+	}
+}
+
+func (s *singleflightDataStore) do(ctx context.Context, kind, id string,
+	fn func() (interface{}, error)) (interface{}, error) {
+
+	tenant := ""
+	if ident := identity.FromContext(ctx); ident != nil {
+		tenant = ident.Tenant
+	}
+
+	v, err := s.group.do(kind+"/"+tenant+"/"+id, fn)
+
+	// the shared query ran with another caller's context; don't fail
+	// this caller because of that caller's cancellation
+	if (err == context.Canceled || err == context.DeadlineExceeded) &&
+		ctx.Err() == nil {
+		return fn()
+	}
+	return v, err
+}
+
+func (s *singleflightDataStore) GetDeviceById(ctx context.Context, id string) (*model.Device, error) {
+	v, err := s.do(ctx, "device", id, func() (interface{}, error) {
+		return s.DataStore.GetDeviceById(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return copyDevice(v.(*model.Device)), nil
+}
+
+func (s *singleflightDataStore) GetAuthSetById(ctx context.Context, id string) (*model.AuthSet, error) {
+	v, err := s.do(ctx, "authset", id, func() (interface{}, error) {
+		return s.DataStore.GetAuthSetById(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	aset := copyAuthSet(*v.(*model.AuthSet))
+	return &aset, nil
+}
+
+func (s *singleflightDataStore) GetToken(ctx context.Context, jti string) (*model.Token, error) {
+	v, err := s.do(ctx, "token", jti, func() (interface{}, error) {
+		return s.DataStore.GetToken(ctx, jti)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tok := *v.(*model.Token)
+	tok.ExpiresAt = copyTime(tok.ExpiresAt)
+	tok.LastUsed = copyTime(tok.LastUsed)
+	tok.Exp = copyTime(tok.Exp)
+	tok.IssuedTs = copyTime(tok.IssuedTs)
+	return &tok, nil
+}
+
+func copyDevice(d *model.Device) *model.Device {
+	dev := *d
+	dev.IdDataStruct = copyMap(d.IdDataStruct)
+	dev.IdDataSha256 = copyBytes(d.IdDataSha256)
+	if d.IdDataValues != nil {
+		dev.IdDataValues = append([]string{}, d.IdDataValues...)
+	}
+	dev.DecommissionAt = copyTime(d.DecommissionAt)
+	dev.TokenLastUsed = copyTime(d.TokenLastUsed)
+	dev.LastCheckin = copyTime(d.LastCheckin)
+	if d.Labels != nil {
+		dev.Labels = make(map[string]string, len(d.Labels))
+		for k, v := range d.Labels {
+			dev.Labels[k] = v
+		}
+	}
+	if d.AuthSets != nil {
+		dev.AuthSets = make([]model.AuthSet, len(d.AuthSets))
+		for i, a := range d.AuthSets {
+			dev.AuthSets[i] = copyAuthSet(a)
+		}
+	}
+	return &dev
+}
+
+func copyAuthSet(a model.AuthSet) model.AuthSet {
+	a.IdDataStruct = copyMap(a.IdDataStruct)
+	a.IdDataSha256 = copyBytes(a.IdDataSha256)
+	a.Timestamp = copyTime(a.Timestamp)
+	a.Annotations = copyMap(a.Annotations)
+	if a.TPMAttestation != nil {
+		tpm := *a.TPMAttestation
+		a.TPMAttestation = &tpm
+	}
+	if a.FirstRequest != nil {
+		req := *a.FirstRequest
+		a.FirstRequest = &req
+	}
+	return a
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// copyMap copies a map decoded from JSON or BSON, with nested maps and
+// slices
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = copyValue(v)
+	}
+	return c
+}
+
+func copyValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return copyMap(val)
+	case []interface{}:
+		c := make([]interface{}, len(val))
+		for i, e := range val {
+			c[i] = copyValue(e)
+		}
+		return c
+	case []string:
+		return append([]string{}, val...)
+	case []byte:
+		return copyBytes(val)
+	}
+	return v
+}
@@ -0,0 +1,234 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+)
+
+// blockingDataStore counts lookups, which block until released
+type blockingDataStore struct {
+	DataStore
+
+	calls   int32
+	release chan struct{}
+	err     error
+}
+
+func (s *blockingDataStore) GetDeviceById(ctx context.Context, id string) (*model.Device, error) {
+	atomic.AddInt32(&s.calls, 1)
+	<-s.release
+	if s.err != nil {
+		return nil, s.err
+	}
+	return testDevice(id), nil
+}
+
+func testDevice(id string) *model.Device {
+	return &model.Device{
+		Id: id,
+		IdDataStruct: map[string]interface{}{
+			"mac": "00:01",
+			"ifs": []interface{}{"eth0"},
+		},
+		IdDataSha256: []byte{1, 2},
+		Labels:       map[string]string{"env": "prod"},
+		AuthSets: []model.AuthSet{
+			{Id: "aset1", IdDataStruct: map[string]interface{}{"mac": "00:01"}},
+		},
+	}
+}
+
+func (s *blockingDataStore) GetAuthSetById(ctx context.Context, id string) (*model.AuthSet, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return &model.AuthSet{Id: id}, nil
+}
+
+func (s *blockingDataStore) GetToken(ctx context.Context, jti string) (*model.Token, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return &model.Token{Id: jti}, nil
+}
+
+// waitDups waits until n callers joined the in-flight call for key
+func waitDups(t *testing.T, g *flightGroup, key string, n int) {
+	for i := 0; i < 1000; i++ {
+		g.mu.Lock()
+		c, ok := g.calls[key]
+		dups := 0
+		if ok {
+			dups = c.dups
+		}
+		g.mu.Unlock()
+
+		if dups == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("callers didn't join the call for %s", key)
+}
+
+func TestSingleflightGetDeviceById(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		err error
+	}{
+		"ok":    {},
+		"error": {err: errors.New("db failed")},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			const callers = 10
+
+			db := &blockingDataStore{
+				release: make(chan struct{}),
+				err:     tc.err,
+			}
+			ds := WithSingleflight(db).(*singleflightDataStore)
+
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Tenant: "tenant1"})
+
+			devs := make([]*model.Device, callers)
+			errs := make([]error, callers)
+			wg := sync.WaitGroup{}
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					devs[i], errs[i] = ds.GetDeviceById(ctx, "dev1")
+				}(i)
+			}
+
+			waitDups(t, &ds.group, "device/tenant1/dev1", callers-1)
+			close(db.release)
+			wg.Wait()
+
+			assert.Equal(t, int32(1), db.calls)
+			for i := 0; i < callers; i++ {
+				if tc.err != nil {
+					assert.Equal(t, tc.err, errs[i])
+					assert.Nil(t, devs[i])
+				} else {
+					assert.NoError(t, errs[i])
+					assert.Equal(t, testDevice("dev1"), devs[i])
+				}
+			}
+			if tc.err == nil {
+				// every caller gets its own copy
+				assert.False(t, devs[0] == devs[1])
+
+				devs[0].IdDataStruct["mac"] = "00:02"
+				devs[0].IdDataStruct["ifs"].([]interface{})[0] = "wlan0"
+				devs[0].IdDataSha256[0] = 3
+				devs[0].Labels["env"] = "dev"
+				devs[0].AuthSets[0].IdDataStruct["mac"] = "00:02"
+				assert.Equal(t, testDevice("dev1"), devs[1])
+			}
+
+			// completed calls aren't cached
+			_, _ = ds.GetDeviceById(ctx, "dev1")
+			assert.Equal(t, int32(2), db.calls)
+		})
+	}
+}
+
+func TestSingleflightKeys(t *testing.T) {
+	t.Parallel()
+
+	db := &blockingDataStore{
+		release: make(chan struct{}),
+	}
+	ds := WithSingleflight(db).(*singleflightDataStore)
+
+	ctx1 := identity.WithContext(context.Background(),
+		&identity.Identity{Tenant: "tenant1"})
+	ctx2 := identity.WithContext(context.Background(),
+		&identity.Identity{Tenant: "tenant2"})
+
+	// the same device ID in different tenants is a different device
+	wg := sync.WaitGroup{}
+	for _, ctx := range []context.Context{ctx1, ctx2} {
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+			_, err := ds.GetDeviceById(ctx, "dev1")
+			assert.NoError(t, err)
+		}(ctx)
+	}
+
+	waitDups(t, &ds.group, "device/tenant1/dev1", 0)
+	waitDups(t, &ds.group, "device/tenant2/dev1", 0)
+	close(db.release)
+	wg.Wait()
+	assert.Equal(t, int32(2), db.calls)
+
+	aset, err := ds.GetAuthSetById(ctx1, "aid1")
+	assert.NoError(t, err)
+	assert.Equal(t, &model.AuthSet{Id: "aid1"}, aset)
+
+	tok, err := ds.GetToken(ctx1, "jti1")
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Token{Id: "jti1"}, tok)
+}
+
+func TestSingleflightCanceledLeader(t *testing.T) {
+	t.Parallel()
+
+	g := &singleflightDataStore{}
+	leaderCtx, cancel := context.WithCancel(context.Background())
+
+	started := make(chan struct{})
+	leaderDone := make(chan error)
+	go func() {
+		_, err := g.do(leaderCtx, "device", "dev1", func() (interface{}, error) {
+			close(started)
+			<-leaderCtx.Done()
+			return nil, leaderCtx.Err()
+		})
+		leaderDone <- err
+	}()
+	<-started
+
+	followerDone := make(chan interface{})
+	go func() {
+		v, err := g.do(context.Background(), "device", "dev1",
+			func() (interface{}, error) {
+				return "follower result", nil
+			})
+		assert.NoError(t, err)
+		followerDone <- v
+	}()
+
+	waitDups(t, &g.group, "device//dev1", 1)
+	cancel()
+
+	assert.Equal(t, context.Canceled, <-leaderDone)
+	assert.Equal(t, "follower result", <-followerDone)
+}
@@ -0,0 +1,250 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deviceauth/model"
+	"github.com/mendersoftware/deviceauth/utils"
+)
+
+var (
+	// EK certificates without subject carry the TPM manufacturer, model
+	// and version in a critical subject alternative name
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+)
+
+const (
+	credentialSecretSize = 32
+)
+
+// Verifier verifies TPM 2.0 attestations of device keys
+type Verifier struct {
+	// CA certificates of TPM manufacturers
+	roots *x509.CertPool
+}
+
+// NewVerifier creates a verifier of TPM attestations, with EK
+// certificates verified against roots
+func NewVerifier(roots *x509.CertPool) *Verifier {
+	return &Verifier{roots: roots}
+}
+
+// MakeCredential verifies the EK certificate and the AK of a device and
+// makes a credential for its TPM to activate, which proves the AK resident
+// in the same TPM as the EK. Returns the credential and what it is bound to,
+// to be passed to Verify along with the attestation.
+func (v *Verifier) MakeCredential(req *model.TPMCredentialReq) (*model.TPMCredential, *model.TPMActivation, error) {
+	ekCert, err := v.verifyEKCert(req.EKCertificate)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, akName, err := parseAK(req.AKPublic)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret := make([]byte, credentialSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate credential secret")
+	}
+	blob, encSecret, err := MakeCredential(ekCert.PublicKey, akName, secret)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to make credential")
+	}
+
+	cred := &model.TPMCredential{
+		CredentialBlob:  base64.StdEncoding.EncodeToString(blob),
+		EncryptedSecret: base64.StdEncoding.EncodeToString(encSecret),
+	}
+
+	ekDigest := sha256.Sum256(ekCert.Raw)
+	secretDigest := sha256.Sum256(secret)
+	activation := &model.TPMActivation{
+		EKCertificateDigest: ekDigest[:],
+		AKName:              akName,
+		SecretDigest:        secretDigest[:],
+	}
+
+	return cred, activation, nil
+}
+
+// Verify checks that key is held by a genuine TPM: the EK certificate chain
+// must lead to one of the TPM manufacturer CAs, the AK be a restricted
+// signing key fixed to its TPM, and the TPM2_Certify attestation be signed
+// by the AK, carry qualifyingData and certify key, fixed to the TPM. The AK
+// is proven resident in the same TPM as the EK by the credential made for
+// them by MakeCredential, described by activation: the attestation must
+// carry its secret, which only that TPM can recover. Returns the EK
+// certificate.
+func (v *Verifier) Verify(att *model.TPMAttestation, key crypto.PublicKey, qualifyingData []byte, activation *model.TPMActivation) (*x509.Certificate, error) {
+	ekCert, err := v.verifyEKCert(att.EKCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	akPub, akName, err := parseAK(att.AKPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyActivation(att, ekCert, akName, activation); err != nil {
+		return nil, err
+	}
+
+	keyPub, err := parsePublic(att.KeyPublic, "key public area")
+	if err != nil {
+		return nil, err
+	}
+	if keyPub.Attributes&attrFixedTPM == 0 {
+		return nil, errors.New("key is not fixed to the TPM")
+	}
+	if k, ok := keyPub.Key.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(key) {
+		return nil, errors.New("key public area doesn't match the device key")
+	}
+
+	certifyInfo, err := decode(att.CertifyInfo, "certify info")
+	if err != nil {
+		return nil, err
+	}
+	sig, err := decode(att.CertifySignature, "certify signature")
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifySignature(akPub.Key, certifyInfo, sig); err != nil {
+		return nil, errors.Wrap(err, "certify signature verification failed")
+	}
+
+	info, err := ParseCertifyInfo(certifyInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse certify info")
+	}
+	if !bytes.Equal(info.ExtraData, qualifyingData) {
+		return nil, errors.New("certify info qualifying data mismatch")
+	}
+	name, err := keyPub.Name()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(info.Name, name) {
+		return nil, errors.New("certified key is not the device key")
+	}
+
+	return ekCert, nil
+}
+
+// verifyActivation checks that the attestation carries the secret of the
+// credential made for its EK and AK
+func verifyActivation(att *model.TPMAttestation, ekCert *x509.Certificate, akName []byte, activation *model.TPMActivation) error {
+	if activation == nil {
+		return errors.New("AK not activated, the auth request's nonce " +
+			"must come with a TPM credential")
+	}
+
+	ekDigest := sha256.Sum256(ekCert.Raw)
+	if !bytes.Equal(ekDigest[:], activation.EKCertificateDigest) ||
+		!bytes.Equal(akName, activation.AKName) {
+		return errors.New("TPM credential was made for another EK or AK")
+	}
+
+	secret, err := decode(att.ActivatedCredential, "activated credential")
+	if err != nil {
+		return err
+	}
+	secretDigest := sha256.Sum256(secret)
+	if subtle.ConstantTimeCompare(secretDigest[:], activation.SecretDigest) != 1 {
+		return errors.New("activated credential mismatch")
+	}
+	return nil
+}
+
+func (v *Verifier) verifyEKCert(data string) (*x509.Certificate, error) {
+	chain, err := utils.ParseCertChain(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse EK certificate")
+	}
+
+	ekCert := chain[0]
+	unhandled := ekCert.UnhandledCriticalExtensions[:0]
+	for _, oid := range ekCert.UnhandledCriticalExtensions {
+		if !oid.Equal(oidSubjectAltName) {
+			unhandled = append(unhandled, oid)
+		}
+	}
+	ekCert.UnhandledCriticalExtensions = unhandled
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = ekCert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "EK certificate verification failed")
+	}
+
+	return ekCert, nil
+}
+
+// parseAK parses the AK public area, which must be of a restricted signing
+// key fixed to the TPM, returns the AK's name along
+func parseAK(data string) (*Public, []byte, error) {
+	akPub, err := parsePublic(data, "AK public area")
+	if err != nil {
+		return nil, nil, err
+	}
+	if akPub.Attributes&(attrFixedTPM|attrRestricted|attrSign) !=
+		attrFixedTPM|attrRestricted|attrSign {
+		return nil, nil, errors.New("AK is not a restricted signing key fixed to the TPM")
+	}
+	name, err := akPub.Name()
+	if err != nil {
+		return nil, nil, err
+	}
+	return akPub, name, nil
+}
+
+func parsePublic(data, what string) (*Public, error) {
+	raw, err := decode(data, what)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := ParsePublic(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", what)
+	}
+	return pub, nil
+}
+
+func decode(data, what string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s", what)
+	}
+	return raw, nil
+}
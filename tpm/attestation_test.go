@@ -0,0 +1,323 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package tpm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deviceauth/model"
+	mtesting "github.com/mendersoftware/deviceauth/utils/testing"
+)
+
+// tpmWriter encodes big endian TPM structures
+type tpmWriter struct {
+	bytes.Buffer
+}
+
+func (w *tpmWriter) write(fields ...interface{}) *tpmWriter {
+	for _, f := range fields {
+		binary.Write(&w.Buffer, binary.BigEndian, f)
+	}
+	return w
+}
+
+func (w *tpmWriter) sized(data []byte) *tpmWriter {
+	w.write(uint16(len(data)))
+	w.Write(data)
+	return w
+}
+
+func eccPublic(key *ecdsa.PublicKey, attrs uint32) []byte {
+	w := &tpmWriter{}
+	w.write(uint16(algECC), uint16(algSHA256), attrs).sized(nil)
+	w.write(uint16(algNull), uint16(algECDSA), uint16(algSHA256))
+	w.write(uint16(eccNistP256), uint16(algNull))
+	w.sized(key.X.Bytes()).sized(key.Y.Bytes())
+	return w.Bytes()
+}
+
+func rsaPublic(key *rsa.PublicKey, attrs uint32) []byte {
+	w := &tpmWriter{}
+	w.write(uint16(algRSA), uint16(algSHA256), attrs).sized(nil)
+	w.write(uint16(algNull), uint16(algNull))
+	w.write(uint16(key.N.BitLen()), uint32(0))
+	w.sized(key.N.Bytes())
+	return w.Bytes()
+}
+
+func certifyInfo(extraData, name []byte) []byte {
+	w := &tpmWriter{}
+	w.write(uint32(generatedValue), uint16(stAttestCertify))
+	w.sized([]byte("signer")).sized(extraData)
+	w.write(uint64(1234), uint32(1), uint32(2), uint8(1), uint64(0x20190823))
+	w.sized(name).sized([]byte("qualified"))
+	return w.Bytes()
+}
+
+func ecdsaSignature(key *ecdsa.PrivateKey, data []byte, t *testing.T) []byte {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	assert.NoError(t, err)
+
+	w := &tpmWriter{}
+	w.write(uint16(algECDSA), uint16(algSHA256))
+	w.sized(r.Bytes()).sized(s.Bytes())
+	return w.Bytes()
+}
+
+func name(pubArea []byte) []byte {
+	digest := sha256.Sum256(pubArea)
+	return append([]byte{0x00, 0x0B}, digest[:]...)
+}
+
+func TestParsePublic(t *testing.T) {
+	t.Parallel()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+
+	pub, err := ParsePublic(eccPublic(&ecKey.PublicKey, attrFixedTPM|attrSign))
+	assert.NoError(t, err)
+	assert.Equal(t, &ecKey.PublicKey, pub.Key)
+	assert.Equal(t, uint32(attrFixedTPM|attrSign), pub.Attributes)
+
+	pub, err = ParsePublic(rsaPublic(&rsaKey.PublicKey, attrFixedTPM))
+	assert.NoError(t, err)
+	assert.Equal(t, &rsaKey.PublicKey, pub.Key)
+
+	pubArea := eccPublic(&ecKey.PublicKey, attrFixedTPM)
+	pub, err = ParsePublic(pubArea)
+	assert.NoError(t, err)
+	n, err := pub.Name()
+	assert.NoError(t, err)
+	assert.Equal(t, name(pubArea), n)
+
+	_, err = ParsePublic(pubArea[:len(pubArea)-1])
+	assert.EqualError(t, err, "truncated TPM structure")
+
+	_, err = ParsePublic(append(pubArea, 0))
+	assert.EqualError(t, err, "trailing data after TPM public area")
+
+	_, err = ParsePublic([]byte{0x00, 0x08, 0x00, 0x0B, 0, 0, 0, 0, 0, 0, 0x00, 0x10, 0x00, 0x10})
+	assert.EqualError(t, err, "unsupported TPM key type: 0x0008")
+}
+
+func TestVerifierVerify(t *testing.T) {
+	t.Parallel()
+
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		return key
+	}
+
+	caKey, otherCAKey, akKey, devKey := newKey(), newKey(), newKey(), newKey()
+	// credentials can only be made for RSA EKs
+	ekKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	ca, _ := mtesting.IssueCert("TPM CA", caKey.Public(), nil, caKey, true, t)
+	otherCA, _ := mtesting.IssueCert("other CA", otherCAKey.Public(), nil, otherCAKey, true, t)
+	_, ekCert := mtesting.IssueCert("EK", ekKey.Public(), ca, caKey, false, t)
+	_, otherEKCert := mtesting.IssueCert("EK", ekKey.Public(), otherCA, otherCAKey, false, t)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	qualifyingData := sha256.Sum256([]byte(`{"mac":"00:01:02:03:04:05"}`))
+
+	akPub := eccPublic(&akKey.PublicKey, attrFixedTPM|attrRestricted|attrSign)
+	keyPub := eccPublic(&devKey.PublicKey, attrFixedTPM|attrSign)
+	info := certifyInfo(qualifyingData[:], name(keyPub))
+
+	b64 := base64.StdEncoding.EncodeToString
+
+	v := NewVerifier(roots)
+
+	cred, activation, err := v.MakeCredential(&model.TPMCredentialReq{
+		EKCertificate: ekCert,
+		AKPublic:      b64(akPub),
+	})
+	assert.NoError(t, err)
+	blob, _ := base64.StdEncoding.DecodeString(cred.CredentialBlob)
+	encSecret, _ := base64.StdEncoding.DecodeString(cred.EncryptedSecret)
+	secret, err := activateCredential(ekKey, name(akPub), blob, encSecret)
+	assert.NoError(t, err)
+
+	_, _, err = v.MakeCredential(&model.TPMCredentialReq{
+		EKCertificate: otherEKCert,
+		AKPublic:      b64(akPub),
+	})
+	assert.EqualError(t, err, "EK certificate verification failed: "+
+		"x509: certificate signed by unknown authority")
+	_, _, err = v.MakeCredential(&model.TPMCredentialReq{
+		EKCertificate: ekCert,
+		AKPublic:      b64(eccPublic(&akKey.PublicKey, attrFixedTPM|attrSign)),
+	})
+	assert.EqualError(t, err, "AK is not a restricted signing key fixed to the TPM")
+
+	// made for another AK of the same TPM
+	otherAKPub := eccPublic(&devKey.PublicKey, attrFixedTPM|attrRestricted|attrSign)
+	_, otherActivation, err := v.MakeCredential(&model.TPMCredentialReq{
+		EKCertificate: ekCert,
+		AKPublic:      b64(otherAKPub),
+	})
+	assert.NoError(t, err)
+
+	attestation := func(modify func(a *model.TPMAttestation)) *model.TPMAttestation {
+		a := &model.TPMAttestation{
+			EKCertificate:       ekCert,
+			AKPublic:            b64(akPub),
+			KeyPublic:           b64(keyPub),
+			CertifyInfo:         b64(info),
+			CertifySignature:    b64(ecdsaSignature(akKey, info, t)),
+			ActivatedCredential: b64(secret),
+		}
+		if modify != nil {
+			modify(a)
+		}
+		return a
+	}
+
+	testCases := map[string]struct {
+		att          *model.TPMAttestation
+		key          interface{}
+		activation   *model.TPMActivation
+		noActivation bool
+
+		err string
+	}{
+		"ok": {
+			att: attestation(nil),
+			key: &devKey.PublicKey,
+		},
+		"error, not activated": {
+			att:          attestation(nil),
+			key:          &devKey.PublicKey,
+			noActivation: true,
+			err: "AK not activated, the auth request's nonce " +
+				"must come with a TPM credential",
+		},
+		"error, credential of another AK": {
+			att:        attestation(nil),
+			key:        &devKey.PublicKey,
+			activation: otherActivation,
+			err:        "TPM credential was made for another EK or AK",
+		},
+		"error, credential not activated by the TPM": {
+			att: attestation(func(a *model.TPMAttestation) {
+				a.ActivatedCredential = b64([]byte("guessed"))
+			}),
+			key: &devKey.PublicKey,
+			err: "activated credential mismatch",
+		},
+		"error, EK not trusted": {
+			att: attestation(func(a *model.TPMAttestation) {
+				a.EKCertificate = otherEKCert
+			}),
+			key: &devKey.PublicKey,
+			err: "EK certificate verification failed: " +
+				"x509: certificate signed by unknown authority",
+		},
+		"error, AK not restricted": {
+			att: attestation(func(a *model.TPMAttestation) {
+				a.AKPublic = b64(eccPublic(&akKey.PublicKey, attrFixedTPM|attrSign))
+			}),
+			key: &devKey.PublicKey,
+			err: "AK is not a restricted signing key fixed to the TPM",
+		},
+		"error, key not fixed to TPM": {
+			att: attestation(func(a *model.TPMAttestation) {
+				a.KeyPublic = b64(eccPublic(&devKey.PublicKey, attrSign))
+			}),
+			key: &devKey.PublicKey,
+			err: "key is not fixed to the TPM",
+		},
+		"error, other device key": {
+			att: attestation(nil),
+			key: &akKey.PublicKey,
+			err: "key public area doesn't match the device key",
+		},
+		"error, not signed by AK": {
+			att: attestation(func(a *model.TPMAttestation) {
+				a.CertifySignature = b64(ecdsaSignature(devKey, info, t))
+			}),
+			key: &devKey.PublicKey,
+			err: "certify signature verification failed: " +
+				"crypto/ecdsa: verification error",
+		},
+		"error, other qualifying data": {
+			att: attestation(func(a *model.TPMAttestation) {
+				info := certifyInfo([]byte("foo"), name(keyPub))
+				a.CertifyInfo = b64(info)
+				a.CertifySignature = b64(ecdsaSignature(akKey, info, t))
+			}),
+			key: &devKey.PublicKey,
+			err: "certify info qualifying data mismatch",
+		},
+		"error, other key certified": {
+			att: attestation(func(a *model.TPMAttestation) {
+				info := certifyInfo(qualifyingData[:], name(akPub))
+				a.CertifyInfo = b64(info)
+				a.CertifySignature = b64(ecdsaSignature(akKey, info, t))
+			}),
+			key: &devKey.PublicKey,
+			err: "certified key is not the device key",
+		},
+		"error, bad encoding": {
+			att: attestation(func(a *model.TPMAttestation) {
+				a.AKPublic = "foo"
+			}),
+			key: &devKey.PublicKey,
+			err: "failed to decode AK public area: " +
+				"illegal base64 data at input byte 0",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			act := activation
+			if tc.activation != nil {
+				act = tc.activation
+			}
+			if tc.noActivation {
+				act = nil
+			}
+
+			ek, err := v.Verify(tc.att, tc.key, qualifyingData[:], act)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "EK", ek.Subject.CommonName)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package tpm
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// the default EK templates use AES-128 to protect credentials, see
+	// TCG EK Credential Profile, 2.1.5
+	credentialSeedSize = 16
+)
+
+// MakeCredential is the TPM2_MakeCredential command: it protects secret so
+// that it can only be recovered with TPM2_ActivateCredential by the TPM
+// holding the EK, and only if that TPM also holds the object with the
+// given name, see TPM 2.0 Library, Part 1, 24. Returns the TPM2B_ID_OBJECT
+// and TPM2B_ENCRYPTED_SECRET arguments of TPM2_ActivateCredential. Only RSA
+// EKs with SHA256 name algorithm are supported, as in the default templates.
+func MakeCredential(ek crypto.PublicKey, name, secret []byte) ([]byte, []byte, error) {
+	ekKey, ok := ek.(*rsa.PublicKey)
+	if !ok {
+		return nil, nil, errors.New("unsupported EK key type, only RSA EKs are supported")
+	}
+	h := crypto.SHA256
+
+	seed := make([]byte, credentialSeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate seed")
+	}
+	encSeed, err := rsa.EncryptOAEP(h.New(), rand.Reader, ekKey, seed,
+		[]byte("IDENTITY\x00"))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to encrypt seed")
+	}
+
+	symKey := kdfa(h, seed, "STORAGE", name, nil, credentialSeedSize*8)
+	block, err := aes.NewCipher(symKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create cipher")
+	}
+	encIdentity := sized(secret)
+	cipher.NewCFBEncrypter(block, make([]byte, block.BlockSize())).
+		XORKeyStream(encIdentity, encIdentity)
+
+	mac := hmac.New(h.New, kdfa(h, seed, "INTEGRITY", nil, nil, h.Size()*8))
+	mac.Write(encIdentity)
+	mac.Write(name)
+
+	idObject := append(sized(mac.Sum(nil)), encIdentity...)
+	return sized(idObject), sized(encSeed), nil
+}
+
+// kdfa is the KDFa key derivation function, SP800-108 in counter mode with
+// HMAC, see TPM 2.0 Library, Part 1, 11.4.9.2
+func kdfa(h crypto.Hash, key []byte, label string, contextU, contextV []byte, bits int) []byte {
+	var out []byte
+	var buf [4]byte
+	for counter := uint32(1); len(out)*8 < bits; counter++ {
+		mac := hmac.New(h.New, key)
+		binary.BigEndian.PutUint32(buf[:], counter)
+		mac.Write(buf[:])
+		mac.Write([]byte(label))
+		mac.Write([]byte{0})
+		mac.Write(contextU)
+		mac.Write(contextV)
+		binary.BigEndian.PutUint32(buf[:], uint32(bits))
+		mac.Write(buf[:])
+		out = mac.Sum(out)
+	}
+	return out[:bits/8]
+}
+
+// sized encodes data as a TPM2B structure
+func sized(data []byte) []byte {
+	buf := make([]byte, 2, 2+len(data))
+	binary.BigEndian.PutUint16(buf, uint16(len(data)))
+	return append(buf, data...)
+}
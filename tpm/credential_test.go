@@ -0,0 +1,120 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// activateCredential is what the TPM does on TPM2_ActivateCredential
+func activateCredential(ek *rsa.PrivateKey, name, credBlob, encSecret []byte) ([]byte, error) {
+	h := crypto.SHA256
+
+	r := &reader{Reader: bytes.NewReader(encSecret)}
+	encSeed := r.sized()
+	r = &reader{Reader: bytes.NewReader(credBlob)}
+	idObject := r.sized()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	seed, err := rsa.DecryptOAEP(h.New(), nil, ek, encSeed, []byte("IDENTITY\x00"))
+	if err != nil {
+		return nil, err
+	}
+
+	r = &reader{Reader: bytes.NewReader(idObject)}
+	integrity := r.sized()
+	if r.err != nil {
+		return nil, r.err
+	}
+	encIdentity := idObject[2+len(integrity):]
+
+	mac := hmac.New(h.New, kdfa(h, seed, "INTEGRITY", nil, nil, h.Size()*8))
+	mac.Write(encIdentity)
+	mac.Write(name)
+	if !hmac.Equal(integrity, mac.Sum(nil)) {
+		return nil, errors.New("integrity check failed")
+	}
+
+	block, err := aes.NewCipher(kdfa(h, seed, "STORAGE", name, nil, len(seed)*8))
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(encIdentity))
+	cipher.NewCFBDecrypter(block, make([]byte, block.BlockSize())).
+		XORKeyStream(plain, encIdentity)
+
+	r = &reader{Reader: bytes.NewReader(plain)}
+	secret := r.sized()
+	return secret, r.err
+}
+
+func TestMakeCredential(t *testing.T) {
+	t.Parallel()
+
+	ek, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otherEK, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	akName := name([]byte("AK"))
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	blob, encSecret, err := MakeCredential(&ek.PublicKey, akName, secret)
+	assert.NoError(t, err)
+
+	res, err := activateCredential(ek, akName, blob, encSecret)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, res)
+
+	// only the TPM holding both the EK and the AK can activate it
+	_, err = activateCredential(ek, name([]byte("other AK")), blob, encSecret)
+	assert.EqualError(t, err, "integrity check failed")
+	_, err = activateCredential(otherEK, akName, blob, encSecret)
+	assert.EqualError(t, err, "crypto/rsa: decryption error")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, _, err = MakeCredential(&ecKey.PublicKey, akName, secret)
+	assert.EqualError(t, err, "unsupported EK key type, only RSA EKs are supported")
+}
+
+func TestKDFa(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("key")
+	// output longer than one digest is built from consecutive blocks
+	assert.Len(t, kdfa(crypto.SHA256, key, "STORAGE", nil, nil, 384), 48)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte{0, 0, 0, 1})
+	mac.Write([]byte("STORAGE\x00u"))
+	mac.Write([]byte{0, 0, 0, 128})
+	assert.Equal(t, mac.Sum(nil)[:16],
+		kdfa(crypto.SHA256, key, "STORAGE", []byte("u"), nil, 128))
+}
@@ -0,0 +1,279 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/binary"
+	"io"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// TPM 2.0 constants, see TPM 2.0 Library, Part 2: Structures
+const (
+	algRSA    = 0x0001
+	algSHA1   = 0x0004
+	algSHA256 = 0x000B
+	algSHA384 = 0x000C
+	algNull   = 0x0010
+	algRSASSA = 0x0014
+	algRSAPSS = 0x0016
+	algECDSA  = 0x0018
+	algECC    = 0x0023
+
+	eccNistP256 = 0x0003
+	eccNistP384 = 0x0004
+
+	generatedValue     = 0xff544347
+	stAttestCertify    = 0x8017
+	defaultRSAExponent = 65537
+
+	attrFixedTPM   = 0x00000002
+	attrRestricted = 0x00010000
+	attrSign       = 0x00040000
+)
+
+var errTruncated = errors.New("truncated TPM structure")
+
+// Public is a parsed TPMT_PUBLIC
+type Public struct {
+	NameAlg    uint16
+	Attributes uint32
+	Key        crypto.PublicKey
+
+	// the encoded structure, for computing the name
+	raw []byte
+}
+
+// Name computes the TPM name of the object, its name algorithm followed by
+// the digest of the public area
+func (p *Public) Name() ([]byte, error) {
+	h, err := hashOf(p.NameAlg)
+	if err != nil {
+		return nil, err
+	}
+	d := h.New()
+	d.Write(p.raw)
+
+	name := make([]byte, 2, 2+h.Size())
+	binary.BigEndian.PutUint16(name, p.NameAlg)
+	return d.Sum(name), nil
+}
+
+// ParsePublic parses a TPMT_PUBLIC of an RSA or ECC (NIST P-256/P-384) key
+func ParsePublic(data []byte) (*Public, error) {
+	r := &reader{Reader: bytes.NewReader(data)}
+
+	var typ uint16
+	p := &Public{raw: data}
+	r.read(&typ, &p.NameAlg, &p.Attributes)
+	r.sized() // authPolicy
+
+	// parameters: symmetric, scheme
+	if alg := r.uint16(); alg != algNull {
+		r.read(new(uint16), new(uint16)) // keyBits, mode
+	}
+	if alg := r.uint16(); alg != algNull {
+		r.uint16() // hashAlg
+	}
+
+	switch typ {
+	case algRSA:
+		var keyBits uint16
+		var exponent uint32
+		r.read(&keyBits, &exponent)
+		modulus := r.sized()
+		if exponent == 0 {
+			exponent = defaultRSAExponent
+		}
+		p.Key = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(exponent),
+		}
+	case algECC:
+		curveId := r.uint16()
+		if alg := r.uint16(); alg != algNull { // kdf
+			r.uint16()
+		}
+		x, y := r.sized(), r.sized()
+
+		var curve elliptic.Curve
+		switch curveId {
+		case eccNistP256:
+			curve = elliptic.P256()
+		case eccNistP384:
+			curve = elliptic.P384()
+		default:
+			return nil, errors.Errorf("unsupported TPM ECC curve: 0x%04x", curveId)
+		}
+		p.Key = &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+	default:
+		return nil, errors.Errorf("unsupported TPM key type: 0x%04x", typ)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.Len() > 0 {
+		return nil, errors.New("trailing data after TPM public area")
+	}
+	return p, nil
+}
+
+// CertifyInfo is a parsed TPMS_ATTEST of the TPM2_Certify command
+type CertifyInfo struct {
+	ExtraData     []byte
+	Name          []byte
+	QualifiedName []byte
+}
+
+// ParseCertifyInfo parses a TPMS_ATTEST, which must be generated by the TPM
+// and of the certify type
+func ParseCertifyInfo(data []byte) (*CertifyInfo, error) {
+	r := &reader{Reader: bytes.NewReader(data)}
+
+	var magic uint32
+	var typ uint16
+	r.read(&magic, &typ)
+	if r.err == nil && magic != generatedValue {
+		return nil, errors.New("attestation not generated by a TPM")
+	}
+	if r.err == nil && typ != stAttestCertify {
+		return nil, errors.Errorf("unexpected attestation type: 0x%04x", typ)
+	}
+
+	info := &CertifyInfo{}
+	r.sized() // qualifiedSigner
+	info.ExtraData = r.sized()
+	// clockInfo: clock, resetCount, restartCount, safe; firmwareVersion
+	r.read(new(uint64), new(uint32), new(uint32), new(uint8), new(uint64))
+	info.Name = r.sized()
+	info.QualifiedName = r.sized()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return info, nil
+}
+
+// VerifySignature verifies a TPMT_SIGNATURE (RSASSA, RSAPSS or ECDSA) made
+// with key over data
+func VerifySignature(key crypto.PublicKey, data, sig []byte) error {
+	r := &reader{Reader: bytes.NewReader(sig)}
+
+	var sigAlg, hashAlg uint16
+	r.read(&sigAlg, &hashAlg)
+	if r.err != nil {
+		return r.err
+	}
+
+	h, err := hashOf(hashAlg)
+	if err != nil {
+		return err
+	}
+	d := h.New()
+	d.Write(data)
+	digest := d.Sum(nil)
+
+	switch sigAlg {
+	case algRSASSA, algRSAPSS:
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RSA signature made with non-RSA key")
+		}
+		s := r.sized()
+		if r.err != nil {
+			return r.err
+		}
+		if sigAlg == algRSASSA {
+			return rsa.VerifyPKCS1v15(k, h, digest, s)
+		}
+		return rsa.VerifyPSS(k, h, digest, s, nil)
+	case algECDSA:
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("ECDSA signature made with non-ECC key")
+		}
+		sr, ss := r.sized(), r.sized()
+		if r.err != nil {
+			return r.err
+		}
+		if !ecdsa.Verify(k, digest, new(big.Int).SetBytes(sr), new(big.Int).SetBytes(ss)) {
+			return errors.New("crypto/ecdsa: verification error")
+		}
+		return nil
+	default:
+		return errors.Errorf("unsupported TPM signature algorithm: 0x%04x", sigAlg)
+	}
+}
+
+func hashOf(alg uint16) (crypto.Hash, error) {
+	switch alg {
+	case algSHA1:
+		return crypto.SHA1, nil
+	case algSHA256:
+		return crypto.SHA256, nil
+	case algSHA384:
+		return crypto.SHA384, nil
+	default:
+		return 0, errors.Errorf("unsupported TPM hash algorithm: 0x%04x", alg)
+	}
+}
+
+// reader reads big endian TPM structures, remembering the first error
+type reader struct {
+	*bytes.Reader
+	err error
+}
+
+func (r *reader) read(fields ...interface{}) {
+	for _, f := range fields {
+		if r.err != nil {
+			return
+		}
+		if err := binary.Read(r.Reader, binary.BigEndian, f); err != nil {
+			r.err = errTruncated
+		}
+	}
+}
+
+func (r *reader) uint16() uint16 {
+	var v uint16
+	r.read(&v)
+	return v
+}
+
+// sized reads a TPM2B structure
+func (r *reader) sized() []byte {
+	size := r.uint16()
+	if r.err != nil {
+		return nil
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r.Reader, buf); err != nil {
+		r.err = errTruncated
+		return nil
+	}
+	return buf
+}
@@ -14,15 +14,20 @@
 package utils
 
 import (
-	"bytes"
 	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/sha256"
+	_ "crypto/sha512"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
+	"math/big"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -30,38 +35,245 @@ import (
 const (
 	ErrMsgVerify = "verification failed"
 
+	ErrMsgUnsupportedKey = "unsupported public key type"
+
 	//PEM identifier of an RSA public key, needed for decoding
 	//key content from a string
 	PubKeyBlockType = "PUBLIC KEY"
+	CertBlockType   = "CERTIFICATE"
+
+	// device key types, as recorded with devices and auth sets
+	KeyTypeRSA       = "rsa"
+	KeyTypeEd25519   = "ed25519"
+	KeyTypeECDSAP256 = "ecdsa-p256"
+	KeyTypeECDSAP384 = "ecdsa-p384"
+
+	// auth request signature algorithms, as declared by devices, see
+	// VerifyAuthReqSignAlg
+	SigAlgRSASHA256    = "rsa-sha256"
+	SigAlgRSASHA384    = "rsa-sha384"
+	SigAlgRSASHA512    = "rsa-sha512"
+	SigAlgRSAPSSSHA256 = "rsa-pss-sha256"
+	SigAlgRSAPSSSHA384 = "rsa-pss-sha384"
+	SigAlgRSAPSSSHA512 = "rsa-pss-sha512"
+	SigAlgECDSASHA256  = "ecdsa-sha256"
+	SigAlgECDSASHA384  = "ecdsa-sha384"
+	SigAlgECDSASHA512  = "ecdsa-sha512"
+	SigAlgEd25519      = "ed25519"
 )
 
+// digests tried in turn when the device doesn't declare the signature
+// algorithm
+var sigDigests = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+var sigAlgs = map[string]crypto.Hash{
+	SigAlgRSASHA256:    crypto.SHA256,
+	SigAlgRSASHA384:    crypto.SHA384,
+	SigAlgRSASHA512:    crypto.SHA512,
+	SigAlgRSAPSSSHA256: crypto.SHA256,
+	SigAlgRSAPSSSHA384: crypto.SHA384,
+	SigAlgRSAPSSSHA512: crypto.SHA512,
+	SigAlgECDSASHA256:  crypto.SHA256,
+	SigAlgECDSASHA384:  crypto.SHA384,
+	SigAlgECDSASHA512:  crypto.SHA512,
+	SigAlgEd25519:      0,
+}
+
+// VerifyAuthReqSign verifies an auth request signature made with the device's
+// private key; RSA (PKCS #1 v1.5 or PSS padding) and ECDSA (ASN.1 encoded)
+// signatures are made over the SHA256, SHA384 or SHA512 of the content,
+// Ed25519 ones over the content itself
 func VerifyAuthReqSign(signature string, pubkey interface{}, content []byte) error {
-	hash := sha256.New()
-	_, err := bytes.NewReader(content).WriteTo(hash)
+	decodedSig, err := base64.StdEncoding.DecodeString(string(signature))
 	if err != nil {
 		return errors.Wrap(err, ErrMsgVerify)
 	}
 
-	decodedSig, err := base64.StdEncoding.DecodeString(string(signature))
-	if err != nil {
-		return errors.Wrap(err, ErrMsgVerify)
+	switch key := pubkey.(type) {
+	case *rsa.PublicKey:
+		var verr error
+		for _, digest := range sigDigests {
+			hash := digest.New()
+			hash.Write(content)
+			hashed := hash.Sum(nil)
+
+			err := rsa.VerifyPKCS1v15(key, digest, hashed, decodedSig)
+			if err == nil {
+				return nil
+			}
+			// crypto libraries on some devices default to PSS
+			// padding
+			if rsa.VerifyPSS(key, digest, hashed, decodedSig,
+				&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}) == nil {
+				return nil
+			}
+			if verr == nil {
+				verr = err
+			}
+		}
+		return errors.Wrap(verr, ErrMsgVerify)
+	case *ecdsa.PublicKey:
+		if KeyType(key) == "" {
+			return errors.Wrap(errors.New(ErrMsgUnsupportedKey), ErrMsgVerify)
+		}
+
+		for _, digest := range sigDigests {
+			hash := digest.New()
+			hash.Write(content)
+			hashed := hash.Sum(nil)
+			if ecdsa.VerifyASN1(key, hashed, decodedSig) ||
+				verifyECDSARaw(key, hashed, decodedSig) {
+				return nil
+			}
+		}
+		return errors.Wrap(errors.New("crypto/ecdsa: verification error"),
+			ErrMsgVerify)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, content, decodedSig) {
+			return errors.Wrap(errors.New("crypto/ed25519: verification error"),
+				ErrMsgVerify)
+		}
+	default:
+		return errors.Wrap(errors.New(ErrMsgUnsupportedKey), ErrMsgVerify)
 	}
 
-	key, ok := pubkey.(*rsa.PublicKey)
+	return nil
+}
+
+// IsSignatureAlg tells if alg is a known auth request signature algorithm,
+// see SigAlg*
+func IsSignatureAlg(alg string) bool {
+	_, ok := sigAlgs[alg]
+	return ok
+}
+
+// VerifyAuthReqSignAlg verifies an auth request signature made with the
+// algorithm declared by the device; the algorithm must match the type of the
+// device's key. With no algorithm declared, falls back to VerifyAuthReqSign.
+func VerifyAuthReqSignAlg(alg, signature string, pubkey interface{}, content []byte) error {
+	if alg == "" {
+		return VerifyAuthReqSign(signature, pubkey, content)
+	}
+
+	digest, ok := sigAlgs[alg]
 	if !ok {
-		return errors.Wrap(err, ErrMsgVerify)
+		return errors.Wrap(errors.Errorf("unsupported signature algorithm: %s", alg),
+			ErrMsgVerify)
 	}
 
-	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash.Sum(nil), decodedSig)
+	decodedSig, err := base64.StdEncoding.DecodeString(signature)
 	if err != nil {
 		return errors.Wrap(err, ErrMsgVerify)
 	}
 
+	var hashed []byte
+	if digest != 0 {
+		hash := digest.New()
+		hash.Write(content)
+		hashed = hash.Sum(nil)
+	}
+
+	switch key := pubkey.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case SigAlgRSASHA256, SigAlgRSASHA384, SigAlgRSASHA512:
+			err = rsa.VerifyPKCS1v15(key, digest, hashed, decodedSig)
+		case SigAlgRSAPSSSHA256, SigAlgRSAPSSSHA384, SigAlgRSAPSSSHA512:
+			err = rsa.VerifyPSS(key, digest, hashed, decodedSig,
+				&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		default:
+			err = errors.Errorf("signature algorithm %s does not match the key", alg)
+		}
+		if err != nil {
+			return errors.Wrap(err, ErrMsgVerify)
+		}
+	case *ecdsa.PublicKey:
+		if KeyType(key) == "" {
+			return errors.Wrap(errors.New(ErrMsgUnsupportedKey), ErrMsgVerify)
+		}
+		if alg != SigAlgECDSASHA256 && alg != SigAlgECDSASHA384 &&
+			alg != SigAlgECDSASHA512 {
+			return errors.Wrap(errors.Errorf(
+				"signature algorithm %s does not match the key", alg),
+				ErrMsgVerify)
+		}
+
+		if !ecdsa.VerifyASN1(key, hashed, decodedSig) &&
+			!verifyECDSARaw(key, hashed, decodedSig) {
+			return errors.Wrap(errors.New("crypto/ecdsa: verification error"),
+				ErrMsgVerify)
+		}
+	case ed25519.PublicKey:
+		if alg != SigAlgEd25519 {
+			return errors.Wrap(errors.Errorf(
+				"signature algorithm %s does not match the key", alg),
+				ErrMsgVerify)
+		}
+		if !ed25519.Verify(key, content, decodedSig) {
+			return errors.Wrap(errors.New("crypto/ed25519: verification error"),
+				ErrMsgVerify)
+		}
+	default:
+		return errors.Wrap(errors.New(ErrMsgUnsupportedKey), ErrMsgVerify)
+	}
+
 	return nil
 }
 
-//ParsePubKey
+// verifyECDSARaw verifies a raw ECDSA signature, r and s as fixed size big
+// endian integers, as made by secure elements (e.g. Microchip ATECC608)
+func verifyECDSARaw(key *ecdsa.PublicKey, hash, sig []byte) bool {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	if len(sig) != 2*size {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:size])
+	s := new(big.Int).SetBytes(sig[size:])
+	return ecdsa.Verify(key, hash, r, s)
+}
+
+// IsDeviceKey tells if a parsed public key is of a type devices can
+// authenticate with
+func IsDeviceKey(key interface{}) bool {
+	return KeyType(key) != ""
+}
+
+// KeyType names the type of a parsed device public key, see KeyType*;
+// empty if devices can't authenticate with the key
+func KeyType(key interface{}) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return KeyTypeRSA
+	case ed25519.PublicKey:
+		return KeyTypeEd25519
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return KeyTypeECDSAP256
+		case elliptic.P384():
+			return KeyTypeECDSAP384
+		}
+	}
+	return ""
+}
+
+// PubKeyType names the type of a PEM encoded device public key, see KeyType
+func PubKeyType(pubkey string) string {
+	key, err := ParsePubKey(pubkey)
+	if err != nil {
+		return ""
+	}
+	return KeyType(key)
+}
+
+// ParsePubKey parses a public key, PEM encoded (PKIX); devices with minimal
+// crypto stacks may also send base64 encoded DER (PKIX), or a key in the
+// OpenSSH authorized_keys format, see SerializePubKey for normalizing it
 func ParsePubKey(pubkey string) (interface{}, error) {
+	if !strings.Contains(pubkey, "-----BEGIN") {
+		return parseBarePubKey(strings.TrimSpace(pubkey))
+	}
+
 	block, _ := pem.Decode([]byte(pubkey))
 	if block == nil || block.Type != PubKeyBlockType {
 		return nil, errors.New("cannot decode public key")
@@ -75,10 +287,59 @@ func ParsePubKey(pubkey string) (interface{}, error) {
 	return key, nil
 }
 
+// PubKeyFingerprint returns the hex encoded SHA-256 digest of the DER
+// encoding (PKIX) of the public key, as with
+// 'openssl pkey -pubin -outform der | sha256sum'; empty if the key can't be
+// parsed
+func PubKeyFingerprint(pubkey string) string {
+	key, err := ParsePubKey(pubkey)
+	if err != nil {
+		return ""
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseCertChain parses a PEM encoded X.509 certificate chain, in the given
+// order
+func ParseCertChain(chain string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	rest := []byte(chain)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != CertBlockType {
+			return nil, errors.New("cannot decode certificate")
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode certificate")
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("cannot decode certificate")
+	}
+
+	return certs, nil
+}
+
 func SerializePubKey(key interface{}) (string, error) {
 
 	switch key.(type) {
-	case *rsa.PublicKey, *dsa.PublicKey, *ecdsa.PublicKey:
+	case *rsa.PublicKey, *dsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
 		break
 	default:
 		return "", errors.New("unrecognizable public key type")
@@ -14,8 +14,15 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha512"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"testing"
@@ -29,33 +36,117 @@ import (
 func TestVerifyAuthReqSign(t *testing.T) {
 	t.Parallel()
 
+	content := `{
+				"id_data": {"mac": "deadbeef"},
+				"tenant_token": "token"
+				"seq_no": 1
+			}`
+
 	testCases := []struct {
 		content   string
 		pubkeyStr string
 		privkey   *rsa.PrivateKey
+		pss       bool
+		edPrivkey ed25519.PrivateKey
+		ecPrivkey *ecdsa.PrivateKey
+		ecRaw     bool
 		err       string
 	}{
 		{
 			//correctly signed, matching keypair
-			`{
-				"id_data": {"mac": "deadbeef"},
-				"tenant_token": "token"
-				"seq_no": 1
-			}`,
-			test.LoadPubKeyStr("testdata/public.pem", t),
-			test.LoadPrivKey("testdata/private.pem", t),
-			"",
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+			privkey:   test.LoadPrivKey("testdata/private.pem", t),
 		},
 		{
 			//mismatched keypair
-			`{
-				"id_data": {"mac": "deadbeef"},
-				"tenant_token": "token"
-				"seq_no": 1
-			}`,
-			test.LoadPubKeyStr("testdata/public.pem", t),
-			test.LoadPrivKey("testdata/private_invalid.pem", t),
-			"verification failed: crypto/rsa: verification error",
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+			privkey:   test.LoadPrivKey("testdata/private_invalid.pem", t),
+			err:       "verification failed: crypto/rsa: verification error",
+		},
+		{
+			//RSA-PSS, correctly signed, matching keypair
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+			privkey:   test.LoadPrivKey("testdata/private.pem", t),
+			pss:       true,
+		},
+		{
+			//RSA-PSS, mismatched keypair
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+			privkey:   test.LoadPrivKey("testdata/private_invalid.pem", t),
+			pss:       true,
+			err:       "verification failed: crypto/rsa: verification error",
+		},
+		{
+			//Ed25519, correctly signed, matching keypair
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ed25519.pem", t),
+			edPrivkey: test.LoadEd25519PrivKey("testdata/private_ed25519.pem", t),
+		},
+		{
+			//Ed25519, mismatched keypair
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ed25519.pem", t),
+			edPrivkey: test.LoadEd25519PrivKey("testdata/private_ed25519_invalid.pem", t),
+			err:       "verification failed: crypto/ed25519: verification error",
+		},
+		{
+			//ECDSA P-256, correctly signed, matching keypair
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p256.pem", t),
+			ecPrivkey: test.LoadECDSAPrivKey("testdata/private_ecdsa_p256.pem", t),
+		},
+		{
+			//ECDSA P-384, correctly signed, matching keypair
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p384.pem", t),
+			ecPrivkey: test.LoadECDSAPrivKey("testdata/private_ecdsa_p384.pem", t),
+		},
+		{
+			//ECDSA P-256, raw (r,s) signature, matching keypair
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p256.pem", t),
+			ecPrivkey: test.LoadECDSAPrivKey("testdata/private_ecdsa_p256.pem", t),
+			ecRaw:     true,
+		},
+		{
+			//ECDSA P-384, raw (r,s) signature, matching keypair
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p384.pem", t),
+			ecPrivkey: test.LoadECDSAPrivKey("testdata/private_ecdsa_p384.pem", t),
+			ecRaw:     true,
+		},
+		{
+			//ECDSA, raw (r,s) signature, mismatched keypair
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p256.pem", t),
+			ecPrivkey: test.LoadECDSAPrivKey("testdata/private_ecdsa_p384.pem", t),
+			ecRaw:     true,
+			err:       "verification failed: crypto/ecdsa: verification error",
+		},
+		{
+			//ECDSA, mismatched keypair
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p256.pem", t),
+			ecPrivkey: test.LoadECDSAPrivKey("testdata/private_ecdsa_p384.pem", t),
+			err:       "verification failed: crypto/ecdsa: verification error",
+		},
+		{
+			//ECDSA, unsupported curve
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p521.pem", t),
+			ecPrivkey: test.LoadECDSAPrivKey("testdata/private_ecdsa_p384.pem", t),
+			err:       "verification failed: " + ErrMsgUnsupportedKey,
+		},
+		{
+			//RSA signature, Ed25519 key
+			content:   content,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ed25519.pem", t),
+			privkey:   test.LoadPrivKey("testdata/private.pem", t),
+			err:       "verification failed: crypto/ed25519: verification error",
 		},
 	}
 
@@ -64,7 +155,18 @@ func TestVerifyAuthReqSign(t *testing.T) {
 		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
 			t.Parallel()
 
-			signed := test.AuthReqSign([]byte(tc.content), tc.privkey, t)
+			var signed []byte
+			if tc.edPrivkey != nil {
+				signed = test.AuthReqSignEd25519([]byte(tc.content), tc.edPrivkey, t)
+			} else if tc.ecPrivkey != nil && tc.ecRaw {
+				signed = test.AuthReqSignECDSARaw([]byte(tc.content), tc.ecPrivkey, t)
+			} else if tc.ecPrivkey != nil {
+				signed = test.AuthReqSignECDSA([]byte(tc.content), tc.ecPrivkey, t)
+			} else if tc.pss {
+				signed = test.AuthReqSignPSS([]byte(tc.content), tc.privkey, t)
+			} else {
+				signed = test.AuthReqSign([]byte(tc.content), tc.privkey, t)
+			}
 
 			pubkey, err := ParsePubKey(tc.pubkeyStr)
 			assert.NoError(t, err)
@@ -82,15 +184,251 @@ func TestVerifyAuthReqSign(t *testing.T) {
 	}
 }
 
+func TestVerifyAuthReqSignUnsupportedKey(t *testing.T) {
+	t.Parallel()
+
+	err := VerifyAuthReqSign("c2lnbmF0dXJl", &dsa.PublicKey{}, []byte("content"))
+	assert.EqualError(t, err, "verification failed: "+ErrMsgUnsupportedKey)
+}
+
+func TestVerifyAuthReqSignAlg(t *testing.T) {
+	t.Parallel()
+
+	content := []byte(`{"id_data": {"mac": "deadbeef"}}`)
+
+	privkey := test.LoadPrivKey("testdata/private.pem", t)
+	digest := sha512.Sum512(content)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, privkey, crypto.SHA512, digest[:])
+	assert.NoError(t, err)
+	sigSHA512 := base64.StdEncoding.EncodeToString(sig)
+
+	ecPrivkey := test.LoadECDSAPrivKey("testdata/private_ecdsa_p384.pem", t)
+	digest384 := sha512.Sum384(content)
+	sig, err = ecdsa.SignASN1(rand.Reader, ecPrivkey, digest384[:])
+	assert.NoError(t, err)
+	sigECDSASHA384 := base64.StdEncoding.EncodeToString(sig)
+
+	testCases := map[string]struct {
+		alg       string
+		signature string
+		pubkeyStr string
+
+		err string
+	}{
+		"ok, no algorithm": {
+			signature: string(test.AuthReqSign(content, privkey, t)),
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+		},
+		"ok, no algorithm, sha512": {
+			signature: sigSHA512,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+		},
+		"ok, no algorithm, ecdsa sha384": {
+			signature: sigECDSASHA384,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p384.pem", t),
+		},
+		"ok, ecdsa-sha384": {
+			alg:       SigAlgECDSASHA384,
+			signature: sigECDSASHA384,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p384.pem", t),
+		},
+		"ok, rsa-sha256": {
+			alg:       SigAlgRSASHA256,
+			signature: string(test.AuthReqSign(content, privkey, t)),
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+		},
+		"ok, rsa-sha512": {
+			alg:       SigAlgRSASHA512,
+			signature: sigSHA512,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+		},
+		"ok, rsa-pss-sha256": {
+			alg:       SigAlgRSAPSSSHA256,
+			signature: string(test.AuthReqSignPSS(content, privkey, t)),
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+		},
+		"ok, ecdsa-sha256": {
+			alg: SigAlgECDSASHA256,
+			signature: string(test.AuthReqSignECDSA(content,
+				test.LoadECDSAPrivKey("testdata/private_ecdsa_p256.pem", t), t)),
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p256.pem", t),
+		},
+		"ok, ed25519": {
+			alg: SigAlgEd25519,
+			signature: string(test.AuthReqSignEd25519(content,
+				test.LoadEd25519PrivKey("testdata/private_ed25519.pem", t), t)),
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ed25519.pem", t),
+		},
+		"error, digest mismatch": {
+			alg:       SigAlgRSASHA256,
+			signature: sigSHA512,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+			err:       "verification failed: crypto/rsa: verification error",
+		},
+		"error, ecdsa digest mismatch": {
+			alg:       SigAlgECDSASHA512,
+			signature: sigECDSASHA384,
+			pubkeyStr: test.LoadPubKeyStr("testdata/public_ecdsa_p384.pem", t),
+			err:       "verification failed: crypto/ecdsa: verification error",
+		},
+		"error, padding mismatch": {
+			alg:       SigAlgRSAPSSSHA256,
+			signature: string(test.AuthReqSign(content, privkey, t)),
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+			err:       "verification failed: crypto/rsa: verification error",
+		},
+		"error, algorithm does not match the key": {
+			alg:       SigAlgECDSASHA256,
+			signature: string(test.AuthReqSign(content, privkey, t)),
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+			err:       "verification failed: signature algorithm ecdsa-sha256 does not match the key",
+		},
+		"error, unsupported algorithm": {
+			alg:       "dsa-sha1",
+			signature: string(test.AuthReqSign(content, privkey, t)),
+			pubkeyStr: test.LoadPubKeyStr("testdata/public.pem", t),
+			err:       "verification failed: unsupported signature algorithm: dsa-sha1",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			pubkey, err := ParsePubKey(tc.pubkeyStr)
+			assert.NoError(t, err)
+
+			err = VerifyAuthReqSignAlg(tc.alg, tc.signature, pubkey, content)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPubKeyType(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		keyPath string
+		out     string
+	}{
+		"rsa": {
+			keyPath: "testdata/public.pem",
+			out:     KeyTypeRSA,
+		},
+		"ed25519": {
+			keyPath: "testdata/public_ed25519.pem",
+			out:     KeyTypeEd25519,
+		},
+		"ecdsa p256": {
+			keyPath: "testdata/public_ecdsa_p256.pem",
+			out:     KeyTypeECDSAP256,
+		},
+		"ecdsa p384": {
+			keyPath: "testdata/public_ecdsa_p384.pem",
+			out:     KeyTypeECDSAP384,
+		},
+		"ecdsa p521, unsupported": {
+			keyPath: "testdata/public_ecdsa_p521.pem",
+		},
+		"bad key": {
+			keyPath: "testdata/public_bad_key_content.pem",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(fmt.Sprintf("tc %s", i), func(t *testing.T) {
+			t.Parallel()
+
+			out := PubKeyType(test.LoadPubKeyStr(tc.keyPath, t))
+			assert.Equal(t, tc.out, out)
+		})
+	}
+}
+
+func TestPubKeyFingerprint(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		keyPath string
+		out     string
+	}{
+		"rsa": {
+			keyPath: "testdata/public.pem",
+			out:     "427219bf24916e859c9a2cab3ebe8005a85ad54829bfb95ac67e1e230c60398d",
+		},
+		"ed25519": {
+			keyPath: "testdata/public_ed25519.pem",
+			out:     "b787899cbf4fc582999bb7c6d7e8aa6c12c255e34dcca9ec4bf755c858c78b31",
+		},
+		"bad key": {
+			keyPath: "testdata/public_bad_key_content.pem",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(fmt.Sprintf("tc %s", i), func(t *testing.T) {
+			t.Parallel()
+
+			out := PubKeyFingerprint(test.LoadPubKeyStr(tc.keyPath, t))
+			assert.Equal(t, tc.out, out)
+		})
+	}
+}
+
 func TestParsePubKey(t *testing.T) {
 	t.Parallel()
 
 	testCases := map[string]struct {
 		pubkey string
+		pem    string
 		err    error
 	}{
 		"ok": {
 			pubkey: test.LoadPubKeyStr("testdata/public.pem", t),
+			pem:    "testdata/public.pem",
+		},
+		"ok, base64 der": {
+			pubkey: test.LoadPubKeyStr("testdata/public.der.b64", t),
+			pem:    "testdata/public.pem",
+		},
+		"ok, ssh rsa": {
+			pubkey: test.LoadPubKeyStr("testdata/public.ssh", t),
+			pem:    "testdata/public.pem",
+		},
+		"ok, ssh ecdsa p256": {
+			pubkey: test.LoadPubKeyStr("testdata/public_ecdsa_p256.ssh", t),
+			pem:    "testdata/public_ecdsa_p256.pem",
+		},
+		"ok, ssh ecdsa p384": {
+			pubkey: test.LoadPubKeyStr("testdata/public_ecdsa_p384.ssh", t),
+			pem:    "testdata/public_ecdsa_p384.pem",
+		},
+		"ok, ssh ed25519": {
+			pubkey: test.LoadPubKeyStr("testdata/public_ed25519.ssh", t),
+			pem:    "testdata/public_ed25519.pem",
+		},
+		"error, not base64": {
+			pubkey: "foo",
+			err:    errors.New("cannot decode public key"),
+		},
+		"error, ssh key type mismatch": {
+			pubkey: "ssh-rsa AAAAC3NzaC1lZDI1NTE5AAAAIJSZ4DhSjP5K3QVJ78iaQlUUVzArHcVg8i3ibYcJD8Xx",
+			err:    errors.New("cannot decode public key: key type mismatch"),
+		},
+		"error, ssh truncated key": {
+			pubkey: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJSZ4DhS",
+			err:    errors.New("cannot decode public key: truncated key"),
+		},
+		"error, ssh unsupported key": {
+			pubkey: "ssh-dss AAAAB3NzaC1kc3M=",
+			err:    errors.New("cannot decode public key: unsupported public key type"),
 		},
 		"error, bad pem block": {
 			pubkey: test.LoadPubKeyStr("testdata/public_bad_pem.pem", t),
@@ -114,7 +452,65 @@ func TestParsePubKey(t *testing.T) {
 				assert.Nil(t, key)
 			} else {
 				assert.NoError(t, err)
-				assert.NotNil(t, key)
+				expected, err := ParsePubKey(test.LoadPubKeyStr(tc.pem, t))
+				assert.NoError(t, err)
+				assert.Equal(t, expected, key)
+			}
+		})
+	}
+}
+
+func TestParseCertChain(t *testing.T) {
+	t.Parallel()
+
+	caKey := test.LoadECDSAPrivKey("testdata/private_ecdsa_p256.pem", t)
+	devKey := test.LoadEd25519PrivKey("testdata/private_ed25519.pem", t)
+
+	ca, caPEM := test.IssueCert("ca", caKey.Public(), nil, caKey, true, t)
+	_, devPEM := test.IssueCert("dev", devKey.Public(), ca, caKey, false, t)
+
+	testCases := map[string]struct {
+		chain string
+
+		subjects []string
+		err      string
+	}{
+		"ok, single": {
+			chain:    devPEM,
+			subjects: []string{"dev"},
+		},
+		"ok, chain": {
+			chain:    devPEM + caPEM,
+			subjects: []string{"dev", "ca"},
+		},
+		"error, empty": {
+			chain: "",
+			err:   "cannot decode certificate",
+		},
+		"error, public key": {
+			chain: test.LoadPubKeyStr("testdata/public_ed25519.pem", t),
+			err:   "cannot decode certificate",
+		},
+		"error, garbage": {
+			chain: "-----BEGIN CERTIFICATE-----\nZm9v\n-----END CERTIFICATE-----\n",
+			err:   "cannot decode certificate",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			certs, err := ParseCertChain(tc.chain)
+			if tc.err != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			if assert.Len(t, certs, len(tc.subjects)) {
+				for i, s := range tc.subjects {
+					assert.Equal(t, s, certs[i].Subject.CommonName)
+				}
 			}
 		})
 	}
@@ -139,6 +535,13 @@ okP0mQanY+WKxp7Q16pt1RoqoAd0kmV39g13rFl35muSHbSBoAW3GBF3gO+mF5Ty
 iyYyh1852rti3Afw4mDxuVSD7sd9ggvYMc0QHIpQNkD4YWOhNiE1AB0zH57VbUYG
 UwIDAQAB
 -----END PUBLIC KEY-----
+`,
+		},
+		"ok, Ed25519": {
+			keyPath: "testdata/public_ed25519.pem",
+			out: `-----BEGIN PUBLIC KEY-----
+MCowBQYDK2VwAyEAlJngOFKM/krdBUnvyJpCVRRXMCsdxWDyLeJthwkPxfE=
+-----END PUBLIC KEY-----
 `,
 		},
 	}
@@ -0,0 +1,156 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OpenSSH public key types, see RFC 4253, sec. 6.6, RFC 5656 and RFC 8709
+const (
+	sshKeyTypeRSA       = "ssh-rsa"
+	sshKeyTypeEd25519   = "ssh-ed25519"
+	sshKeyTypeECDSAP256 = "ecdsa-sha2-nistp256"
+	sshKeyTypeECDSAP384 = "ecdsa-sha2-nistp384"
+)
+
+var errDecodePubKey = errors.New("cannot decode public key")
+
+// parseBarePubKey parses a public key without PEM armor: an OpenSSH
+// authorized_keys line ('<type> <base64 key> [comment]'), or base64
+// encoded DER
+func parseBarePubKey(pubkey string) (interface{}, error) {
+	if fields := strings.Fields(pubkey); len(fields) >= 2 &&
+		(strings.HasPrefix(fields[0], "ssh-") ||
+			strings.HasPrefix(fields[0], "ecdsa-sha2-")) {
+		return parseSSHPubKey(fields[0], fields[1])
+	}
+
+	// line breaks are common in base64 copied from PEM files
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(pubkey), ""))
+	if err != nil {
+		return nil, errDecodePubKey
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, errDecodePubKey.Error())
+	}
+	return key, nil
+}
+
+func parseSSHPubKey(keyType, data string) (interface{}, error) {
+	blob, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errDecodePubKey
+	}
+
+	r := &sshReader{buf: blob}
+	if string(r.string()) != keyType {
+		return nil, errors.Wrap(errors.New("key type mismatch"), errDecodePubKey.Error())
+	}
+
+	var key interface{}
+	switch keyType {
+	case sshKeyTypeRSA:
+		e := r.mpint()
+		n := r.mpint()
+		if r.err == nil && !e.IsInt64() {
+			r.err = errors.New("rsa exponent too large")
+		}
+		if r.err == nil {
+			key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		}
+	case sshKeyTypeEd25519:
+		raw := r.string()
+		if r.err == nil && len(raw) != ed25519.PublicKeySize {
+			r.err = errors.New("bad ed25519 key size")
+		}
+		if r.err == nil {
+			key = ed25519.PublicKey(raw)
+		}
+	case sshKeyTypeECDSAP256, sshKeyTypeECDSAP384:
+		curve := elliptic.P256()
+		if keyType == sshKeyTypeECDSAP384 {
+			curve = elliptic.P384()
+		}
+		r.string() // curve name, implied by the key type
+		point := r.string()
+		if r.err == nil {
+			x, y := elliptic.Unmarshal(curve, point)
+			if x == nil {
+				r.err = errors.New("bad ecdsa point")
+			} else {
+				key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+			}
+		}
+	default:
+		return nil, errors.Wrap(errors.New(ErrMsgUnsupportedKey), errDecodePubKey.Error())
+	}
+
+	if r.err == nil && len(r.buf) > 0 {
+		r.err = errors.New("trailing data")
+	}
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, errDecodePubKey.Error())
+	}
+	return key, nil
+}
+
+// sshReader reads the SSH wire encoding (RFC 4251, sec. 5); the first error
+// sticks
+type sshReader struct {
+	buf []byte
+	err error
+}
+
+func (r *sshReader) string() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < 4 {
+		r.err = errors.New("truncated key")
+		return nil
+	}
+	n := binary.BigEndian.Uint32(r.buf)
+	if uint64(n) > uint64(len(r.buf)-4) {
+		r.err = errors.New("truncated key")
+		return nil
+	}
+	s := r.buf[4 : 4+n]
+	r.buf = r.buf[4+n:]
+	return s
+}
+
+func (r *sshReader) mpint() *big.Int {
+	b := r.string()
+	if r.err != nil {
+		return nil
+	}
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		r.err = errors.New("negative integer")
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
@@ -0,0 +1,323 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+// Package schema validates JSON documents against JSON Schemas. Only the
+// subset of draft 4 keywords needed for API payloads is supported: type,
+// enum, properties, required, additionalProperties, minProperties, items,
+// minItems, maxItems, minLength, maxLength, pattern, minimum and maximum.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Schema is a compiled JSON Schema
+type Schema struct {
+	Type                 typeList           `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	MinProperties        *int               `json:"minProperties"`
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+
+	pattern *regexp.Regexp
+}
+
+// typeList is the 'type' keyword, given either as a single type or a list
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*t = typeList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.New("type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+// Compile parses a JSON Schema
+func Compile(src string) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal([]byte(src), &s); err != nil {
+		return nil, errors.Wrap(err, "failed to parse schema")
+	}
+
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// MustCompile is like Compile but panics on errors, for schemas embedded in
+// the code
+func MustCompile(src string) *Schema {
+	s, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "invalid pattern %q", s.Pattern)
+		}
+		s.pattern = re
+	}
+
+	for _, p := range s.Properties {
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+
+	return nil
+}
+
+// ValidationError describes a single schema violation
+type ValidationError struct {
+	// Path of the offending value, e.g. 'identity_data.mac' or
+	// 'items[2]'; '(root)' for the document itself
+	Path string
+	// Constraint is the violated schema keyword
+	Constraint string
+	Message    string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors lists all schema violations found in a document
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks a JSON document against the schema, returning
+// ValidationErrors for violations; an error of any other type means the
+// document is not valid JSON
+func (s *Schema) Validate(doc []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return err
+	}
+
+	return s.ValidateValue(v)
+}
+
+// ValidateValue checks a value decoded from JSON against the schema
+func (s *Schema) ValidateValue(v interface{}) error {
+	var errs ValidationErrors
+	s.validate("", v, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) validate(path string, v interface{}, errs *ValidationErrors) {
+	failAt := func(path, constraint, format string, args ...interface{}) {
+		if path == "" {
+			path = "(root)"
+		}
+		*errs = append(*errs, &ValidationError{
+			Path:       path,
+			Constraint: constraint,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+	fail := func(constraint, format string, args ...interface{}) {
+		failAt(path, constraint, format, args...)
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(v) {
+		fail("type", "must be of type %s", strings.Join(s.Type, " or "))
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		vals := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			vals[i] = fmt.Sprint(e)
+		}
+		fail("enum", "must be one of: %s", strings.Join(vals, ", "))
+		return
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		// a null required property counts as missing, unless its schema
+		// allows null
+		missing := map[string]bool{}
+		for _, name := range s.Required {
+			pv, ok := val[name]
+			if !ok || (pv == nil && !s.Properties[name].allowsNull()) {
+				missing[name] = true
+				failAt(join(path, name), "required", "is required")
+			}
+		}
+
+		if s.MinProperties != nil && len(val) < *s.MinProperties {
+			fail("minProperties", "must have at least %d properties", *s.MinProperties)
+		}
+
+		// sorted, for stable error messages
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if missing[name] {
+				continue
+			}
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					failAt(join(path, name), "additionalProperties",
+						"is not allowed")
+				}
+				continue
+			}
+			prop.validate(join(path, name), val[name], errs)
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			fail("minItems", "must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			fail("maxItems", "must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.MinLength != nil && n < *s.MinLength {
+			if *s.MinLength == 1 {
+				fail("minLength", "must not be empty")
+			} else {
+				fail("minLength", "must be at least %d characters long", *s.MinLength)
+			}
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("maxLength", "must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			fail("pattern", "must match pattern '%s'", s.Pattern)
+		}
+
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			fail("minimum", "must be greater than or equal to %v", *s.Minimum)
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			fail("maximum", "must be less than or equal to %v", *s.Maximum)
+		}
+	}
+}
+
+func (t typeList) matches(v interface{}) bool {
+	for _, typ := range t {
+		switch val := v.(type) {
+		case nil:
+			if typ == "null" {
+				return true
+			}
+		case bool:
+			if typ == "boolean" {
+				return true
+			}
+		case string:
+			if typ == "string" {
+				return true
+			}
+		case float64:
+			if typ == "number" ||
+				(typ == "integer" && val == float64(int64(val))) {
+				return true
+			}
+		case []interface{}:
+			if typ == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if typ == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowsNull tells whether null is a valid value of the schema
+func (s *Schema) allowsNull() bool {
+	return s == nil || len(s.Type) == 0 || s.Type.matches(nil)
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	b, _ := json.Marshal(v)
+	for _, e := range enum {
+		eb, _ := json.Marshal(e)
+		if string(b) == string(eb) {
+			return true
+		}
+	}
+	return false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 8},
+		"serial": {"type": "string", "pattern": "^[0-9]+$"},
+		"status": {"enum": ["accepted", "rejected"]},
+		"count": {"type": "integer", "minimum": 0, "maximum": 10},
+		"tags": {
+			"type": "array",
+			"maxItems": 2,
+			"items": {"type": "string"}
+		},
+		"attrs": {
+			"type": ["object", "null"],
+			"properties": {
+				"mac": {"type": "string"}
+			},
+			"additionalProperties": false
+		}
+	},
+	"required": ["name"]
+}`
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	s := MustCompile(testSchema)
+
+	testCases := map[string]struct {
+		doc string
+
+		errs ValidationErrors
+		err  string
+	}{
+		"ok": {
+			doc: `{"name": "dev", "serial": "0001", "status": "accepted",
+				"count": 3, "tags": ["a"], "attrs": {"mac": "00:01"}}`,
+		},
+		"ok, null": {
+			doc: `{"name": "dev", "attrs": null}`,
+		},
+		"error, malformed": {
+			doc: `{"name": `,
+			err: "unexpected end of JSON input",
+		},
+		"error, not an object": {
+			doc: `["dev"]`,
+			errs: ValidationErrors{
+				{Path: "(root)", Constraint: "type", Message: "must be of type object"},
+			},
+		},
+		"error, required": {
+			doc: `{}`,
+			errs: ValidationErrors{
+				{Path: "name", Constraint: "required", Message: "is required"},
+			},
+		},
+		"error, required null": {
+			doc: `{"name": null}`,
+			errs: ValidationErrors{
+				{Path: "name", Constraint: "required", Message: "is required"},
+			},
+		},
+		"error, strings": {
+			doc: `{"name": "", "serial": "a1", "status": "pending"}`,
+			errs: ValidationErrors{
+				{Path: "name", Constraint: "minLength", Message: "must not be empty"},
+				{Path: "serial", Constraint: "pattern", Message: "must match pattern '^[0-9]+$'"},
+				{Path: "status", Constraint: "enum", Message: "must be one of: accepted, rejected"},
+			},
+		},
+		"error, numbers": {
+			doc: `{"name": "device-0001", "count": 1.5}`,
+			errs: ValidationErrors{
+				{Path: "count", Constraint: "type", Message: "must be of type integer"},
+				{Path: "name", Constraint: "maxLength", Message: "must be at most 8 characters long"},
+			},
+		},
+		"error, nested": {
+			doc: `{"name": "dev", "count": 11, "tags": ["a", 1, "c"],
+				"attrs": {"mac": 1, "sn": "0001"}}`,
+			errs: ValidationErrors{
+				{Path: "attrs.mac", Constraint: "type", Message: "must be of type string"},
+				{Path: "attrs.sn", Constraint: "additionalProperties", Message: "is not allowed"},
+				{Path: "count", Constraint: "maximum", Message: "must be less than or equal to 10"},
+				{Path: "tags", Constraint: "maxItems", Message: "must have at most 2 items"},
+				{Path: "tags[1]", Constraint: "type", Message: "must be of type string"},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := s.Validate([]byte(tc.doc))
+			switch {
+			case tc.errs != nil:
+				assert.Equal(t, tc.errs, err)
+			case tc.err != "":
+				assert.EqualError(t, err, tc.err)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	errs := ValidationErrors{
+		{Path: "name", Constraint: "required", Message: "is required"},
+		{Path: "status", Constraint: "enum", Message: "must be one of: accepted, rejected"},
+	}
+
+	assert.EqualError(t, errs,
+		"name: is required; status: must be one of: accepted, rejected")
+}
+
+func TestCompile(t *testing.T) {
+	_, err := Compile(`{"type": 1}`)
+	assert.EqualError(t, err,
+		"failed to parse schema: type must be a string or a list of strings")
+
+	_, err = Compile(`{"properties": {"sn": {"pattern": "("}}}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid pattern "("`)
+}
@@ -16,14 +16,19 @@ package testing
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/pem"
 	"io/ioutil"
+	"math/big"
 	"testing"
+	"time"
 )
 
 const (
@@ -47,6 +52,61 @@ func AuthReqSign(data []byte, privkey *rsa.PrivateKey, t *testing.T) []byte {
 	return b64
 }
 
+func AuthReqSignPSS(data []byte, privkey *rsa.PrivateKey, t *testing.T) []byte {
+	digest := sha256.Sum256(data)
+
+	sig, err := rsa.SignPSS(rand.Reader, privkey, crypto.SHA256, digest[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []byte(base64.StdEncoding.EncodeToString(sig))
+}
+
+func AuthReqSignEd25519(data []byte, privkey ed25519.PrivateKey, t *testing.T) []byte {
+	sig := ed25519.Sign(privkey, data)
+
+	b64 := make([]byte, base64.StdEncoding.EncodedLen(len(sig)))
+	base64.StdEncoding.Encode(b64, sig)
+
+	return b64
+}
+
+func AuthReqSignECDSA(data []byte, privkey *ecdsa.PrivateKey, t *testing.T) []byte {
+	hash := sha256.Sum256(data)
+
+	sig, err := ecdsa.SignASN1(rand.Reader, privkey, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b64 := make([]byte, base64.StdEncoding.EncodedLen(len(sig)))
+	base64.StdEncoding.Encode(b64, sig)
+
+	return b64
+}
+
+// AuthReqSignECDSARaw signs like a secure element would: r and s as fixed
+// size big endian integers instead of an ASN.1 sequence.
+func AuthReqSignECDSARaw(data []byte, privkey *ecdsa.PrivateKey, t *testing.T) []byte {
+	hash := sha256.Sum256(data)
+
+	r, s, err := ecdsa.Sign(rand.Reader, privkey, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := (privkey.Curve.Params().BitSize + 7) / 8
+	sig := make([]byte, 2*size)
+	r.FillBytes(sig[:size])
+	s.FillBytes(sig[size:])
+
+	b64 := make([]byte, base64.StdEncoding.EncodedLen(len(sig)))
+	base64.StdEncoding.Encode(b64, sig)
+
+	return b64
+}
+
 func LoadPrivKey(path string, t *testing.T) *rsa.PrivateKey {
 	pem_data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -76,3 +136,82 @@ func LoadPubKeyStr(path string, t *testing.T) string {
 
 	return string(pem_data)
 }
+
+func LoadEd25519PrivKey(path string, t *testing.T) ed25519.PrivateKey {
+	edKey, ok := loadPKCS8PrivKey(path, t).(ed25519.PrivateKey)
+	if !ok {
+		t.Fatal("not an Ed25519 private key")
+	}
+
+	return edKey
+}
+
+func LoadECDSAPrivKey(path string, t *testing.T) *ecdsa.PrivateKey {
+	ecKey, ok := loadPKCS8PrivKey(path, t).(*ecdsa.PrivateKey)
+	if !ok {
+		t.Fatal("not an ECDSA private key")
+	}
+
+	return ecKey
+}
+
+func loadPKCS8PrivKey(path string, t *testing.T) interface{} {
+	pem_data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(pem_data)
+
+	if block == nil ||
+		block.Type != "PRIVATE KEY" {
+		t.Fatal("cannot decode private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// IssueCert creates a certificate for the public key, signed by the parent
+// certificate's key, or self-signed if parent is nil; returns the
+// certificate and its PEM encoding
+func IssueCert(cn string, pub crypto.PublicKey, parent *x509.Certificate,
+	parentKey crypto.Signer, isCA bool, t *testing.T) (*x509.Certificate, string) {
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	if parent == nil {
+		parent = tmpl
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: der,
+	}))
+}